@@ -1,19 +1,30 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"os"
+	"os/user"
 	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/atip/atip-discover/internal/config"
 	"github.com/atip/atip-discover/internal/discovery"
+	"github.com/atip/atip-discover/internal/hashcache"
 	"github.com/atip/atip-discover/internal/output"
 	"github.com/atip/atip-discover/internal/registry"
+	"github.com/atip/atip-discover/internal/remote"
+	"github.com/atip/atip-discover/internal/rpc"
+	"github.com/atip/atip-discover/internal/tui"
 	"github.com/atip/atip-discover/internal/validator"
 	"github.com/atip/atip-discover/internal/xdg"
 )
@@ -45,12 +56,36 @@ var atipMetadata = map[string]interface{}{
 		"scan": map[string]interface{}{
 			"description": "Scan for ATIP-compatible tools in PATH",
 			"options": []map[string]interface{}{
-				{"name": "allow-path", "flags": []string{"--allow-path"}, "type": "string", "description": "Additional directory to scan"},
-				{"name": "skip", "flags": []string{"--skip"}, "type": "string", "description": "Comma-separated list of tools to skip"},
+				{"name": "allow-path", "flags": []string{"--allow-path"}, "type": "string", "variadic": true, "description": "Additional directory to scan (repeatable)"},
+				{"name": "add-path", "flags": []string{"--add-path"}, "type": "string", "variadic": true, "description": "Directory to scan alongside the configured safe paths (repeatable)"},
+				{"name": "skip", "flags": []string{"--skip"}, "type": "string", "variadic": true, "description": "Tool to skip in addition to discovery.skip_list (repeatable; glob, or regex prefixed with re:)"},
+				{"name": "skip-file", "flags": []string{"--skip-file"}, "type": "file", "description": "File of skip patterns, one per line"},
+				{"name": "policy", "flags": []string{"--policy"}, "type": "file", "description": "JSON policy file of extra rules (require-effects, require-homepage-for-network, ban-command-names) probed metadata must pass"},
+				{"name": "probe-allow", "flags": []string{"--probe-allow"}, "type": "string", "variadic": true, "description": "Only probe tools matching this pattern (repeatable; replaces discovery.probe_allow)"},
 				{"name": "timeout", "flags": []string{"--timeout", "-t"}, "type": "string", "default": "2s", "description": "Timeout for probing each tool"},
+				{"name": "timeout-override", "flags": []string{"--timeout-override"}, "type": "string", "variadic": true, "description": "Probe timeout for one tool as name=duration (repeatable; e.g. terraform=10s)"},
+				{"name": "deadline", "flags": []string{"--deadline"}, "type": "string", "description": "Stop the whole scan after this long (e.g. 30s); unfinished probes are canceled and the result is partial, with deadline_exceeded set"},
+				{"name": "probe-retries", "flags": []string{"--probe-retries"}, "type": "integer", "default": 0, "description": "Retry a probe this many times if the tool fails to start or prints no ATIP JSON"},
 				{"name": "parallel", "flags": []string{"--parallel", "-p"}, "type": "integer", "default": 4, "description": "Number of parallel probes"},
-				{"name": "dry-run", "flags": []string{"--dry-run", "-n"}, "type": "boolean", "description": "Show what would be scanned"},
+				{"name": "dry-run", "flags": []string{"--dry-run", "-n"}, "type": "boolean", "description": "Show which executables would be probed or skipped, and why"},
 				{"name": "safe-paths-only", "flags": []string{"--safe-paths-only"}, "type": "boolean", "default": true, "description": "Only scan safe paths"},
+				{"name": "from-path", "flags": []string{"--from-path"}, "type": "boolean", "description": "Scan the directories listed in $PATH"},
+				{"name": "max-depth", "flags": []string{"--max-depth"}, "type": "integer", "default": 1, "description": "Directory levels to scan under each path; subdirectories must be safe paths and symlinked directories are not followed"},
+				{"name": "allow-owner", "flags": []string{"--allow-owner"}, "type": "string", "description": "Comma-separated users or UIDs trusted to own scanned directories"},
+				{"name": "allow-group", "flags": []string{"--allow-group"}, "type": "string", "description": "Comma-separated groups or GIDs trusted to own scanned directories"},
+				{"name": "prune", "flags": []string{"--prune"}, "type": "boolean", "description": "Remove registry entries whose executable was deleted from a scanned directory"},
+				{"name": "fail-on-error", "flags": []string{"--fail-on-error"}, "type": "boolean", "description": "Exit 4 if any probe failed"},
+				{"name": "fail-if-none", "flags": []string{"--fail-if-none"}, "type": "boolean", "description": "Exit 3 if no tools were found in the scanned directories"},
+				{"name": "min-atip-version", "flags": []string{"--min-atip-version"}, "type": "string", "description": "Flag tools declaring an older ATIP version as unsupported (e.g. 0.4)"},
+				{"name": "max-atip-version", "flags": []string{"--max-atip-version"}, "type": "string", "description": "Flag tools declaring a newer ATIP version as unsupported (e.g. 0.6)"},
+				{"name": "offline", "flags": []string{"--offline"}, "type": "boolean", "description": "Fail instead of probing (only --dry-run works)"},
+				{"name": "adapt-help", "flags": []string{"--adapt-help"}, "type": "boolean", "description": "Infer partial metadata from --help for tools without --agent (source inferred)"},
+				{"name": "verify-checksums", "flags": []string{"--verify-checksums"}, "type": "boolean", "description": "Check executables against the binary hash their metadata declares (hashes are cached by path, size and mtime)"},
+				{"name": "error-kinds", "flags": []string{"--error-kinds"}, "type": "string", "description": "Comma-separated error kinds to report, or all (default: all but no_agent_support)"},
+				{"name": "include-shims", "flags": []string{"--include-shims"}, "type": "boolean", "description": "Also load shims from the shims directory into the registry (source shim)"},
+				{"name": "prefer-shims", "flags": []string{"--prefer-shims"}, "type": "boolean", "description": "With --include-shims, let shims replace registered tools of the same name whatever discovery.source_precedence says"},
+				{"name": "output", "flags": []string{"-o"}, "type": "enum", "enum": []string{"json", "ndjson", "table", "quiet"}, "default": "json", "description": "Output format; ndjson streams a line per tool and error as probes complete, then a summary"},
+				{"name": "output-file", "flags": []string{"--output-file"}, "type": "file", "description": "Write output to this file (atomically) instead of stdout"},
 			},
 			"effects": map[string]interface{}{
 				"filesystem": map[string]interface{}{"read": true, "write": true, "paths": []string{"~/.local/share/agent-tools/"}},
@@ -62,8 +97,17 @@ var atipMetadata = map[string]interface{}{
 			"description": "List discovered ATIP tools from the registry",
 			"arguments":   []map[string]interface{}{{"name": "pattern", "type": "string", "required": false, "description": "Filter pattern for tool names"}},
 			"options": []map[string]interface{}{
-				{"name": "source", "flags": []string{"--source"}, "type": "enum", "enum": []string{"all", "native", "shim"}, "default": "all", "description": "Filter by source type"},
+				{"name": "source", "flags": []string{"--source"}, "type": "enum", "enum": []string{"all", "native", "inferred", "shim"}, "default": "all", "description": "Filter by source type"},
+				{"name": "platform", "flags": []string{"--platform"}, "type": "string", "default": "all", "description": "Filter by platform (e.g. linux-amd64)"},
+				{"name": "tag", "flags": []string{"--tag"}, "type": "string", "description": "Filter by inferred or manual tag (e.g. vcs)"},
+				{"name": "annotation", "flags": []string{"--annotation"}, "type": "string", "description": "Filter by annotation, key=value or just key (can be repeated; all must match)"},
+				{"name": "sort", "flags": []string{"--sort"}, "type": "enum", "enum": []string{"name", "version", "source"}, "default": "name", "description": "Sort order"},
+				{"name": "offline", "flags": []string{"--offline"}, "type": "boolean", "description": "Read only the registry and cache; never execute tools"},
+				{"name": "effects", "flags": []string{"--effects"}, "type": "boolean", "description": "Tag each tool with badges for the effects of its commands"},
+				{"name": "wide", "flags": []string{"--wide"}, "type": "boolean", "description": "With -o table, add PATH and LAST_VERIFIED columns and show full descriptions"},
+				{"name": "interactive", "flags": []string{"--interactive"}, "type": "boolean", "description": "Browse the tools in a terminal UI with live name filtering and a detail pane (requires a terminal)"},
 				{"name": "output", "flags": []string{"-o"}, "type": "enum", "enum": []string{"json", "table", "quiet"}, "default": "json", "description": "Output format"},
+				{"name": "output-file", "flags": []string{"--output-file"}, "type": "file", "description": "Write output to this file (atomically) instead of stdout"},
 			},
 			"effects": map[string]interface{}{
 				"filesystem": map[string]interface{}{"read": true, "write": false},
@@ -75,7 +119,206 @@ var atipMetadata = map[string]interface{}{
 			"description": "Get full ATIP metadata for a specific tool",
 			"arguments":   []map[string]interface{}{{"name": "tool-name", "type": "string", "required": true, "description": "Name of the tool"}},
 			"options": []map[string]interface{}{
+				{"name": "offline", "flags": []string{"--offline"}, "type": "boolean", "description": "Read only the registry and cache; never execute tools"},
+				{"name": "effects", "flags": []string{"--effects"}, "type": "boolean", "description": "Summarize which commands touch the network, are destructive or write files"},
+				{"name": "trust", "flags": []string{"--trust"}, "type": "boolean", "description": "Summarize the trust source, verification and signature the metadata declares"},
+				{"name": "registry", "flags": []string{"--registry"}, "type": "string", "description": "Fetch the tool's shim from this remote registry and cache it for offline use"},
+				{"name": "version", "flags": []string{"--version"}, "type": "string", "description": "Version to fetch with --registry (default: latest)"},
+				{"name": "platform", "flags": []string{"--platform"}, "type": "string", "description": "Platform to fetch with --registry (default: this host's)"},
+				{"name": "timeout", "flags": []string{"--timeout"}, "type": "string", "default": "30s", "description": "Timeout for fetching from --registry"},
+				{"name": "etag-only", "flags": []string{"--etag-only"}, "type": "boolean", "description": "Print the metadata's ETag (its sha256 digest) instead of the metadata"},
+				{"name": "if-none-match", "flags": []string{"--if-none-match"}, "type": "string", "description": "Exit 5 without output if the metadata's ETag is one of these (comma-separated, * for any)"},
 				{"name": "output", "flags": []string{"-o"}, "type": "enum", "enum": []string{"json", "table", "quiet"}, "default": "json", "description": "Output format"},
+				{"name": "output-file", "flags": []string{"--output-file"}, "type": "file", "description": "Write output to this file (atomically) instead of stdout"},
+			},
+			"effects": map[string]interface{}{
+				"filesystem": map[string]interface{}{"read": true, "write": true, "paths": []string{"~/.cache/agent-tools/"}},
+				"network":    true, // Only with --registry
+				"idempotent": true,
+			},
+		},
+		"tag": map[string]interface{}{
+			"description": "Tag a tool in the registry; manual tags survive scans and refreshes",
+			"arguments": []map[string]interface{}{
+				{"name": "tool-name", "type": "string", "required": true, "description": "Name of the tool"},
+				{"name": "tags", "type": "string", "required": true, "variadic": true, "description": "Tags to add (letters, digits, '.', '_' and '-')"},
+			},
+			"options": []map[string]interface{}{
+				{"name": "output", "flags": []string{"-o"}, "type": "enum", "enum": []string{"json", "table", "quiet"}, "default": "json", "description": "Output format"},
+			},
+			"effects": map[string]interface{}{
+				"filesystem": map[string]interface{}{"read": true, "write": true, "paths": []string{"~/.local/share/agent-tools/"}},
+				"network":    false,
+				"idempotent": true,
+			},
+		},
+		"annotate": map[string]interface{}{
+			"description": "Set or remove key=value annotations on a tool; annotations survive scans and refreshes",
+			"arguments": []map[string]interface{}{
+				{"name": "tool-name", "type": "string", "required": true, "description": "Name of the tool"},
+				{"name": "annotations", "type": "string", "required": true, "variadic": true, "description": "key=value to set, key- to remove"},
+			},
+			"options": []map[string]interface{}{
+				{"name": "output", "flags": []string{"-o"}, "type": "enum", "enum": []string{"json", "table", "quiet"}, "default": "json", "description": "Output format"},
+			},
+			"effects": map[string]interface{}{
+				"filesystem": map[string]interface{}{"read": true, "write": true, "paths": []string{"~/.local/share/agent-tools/"}},
+				"network":    false,
+				"idempotent": true,
+			},
+		},
+		"doctor": map[string]interface{}{
+			"description": "Diagnose the discovery environment (directories, safe paths, registry, probing)",
+			"options": []map[string]interface{}{
+				{"name": "offline", "flags": []string{"--offline"}, "type": "boolean", "description": "Skip the sample probe"},
+				{"name": "output", "flags": []string{"-o"}, "type": "enum", "enum": []string{"json", "table", "quiet"}, "default": "json", "description": "Output format"},
+			},
+			"effects": map[string]interface{}{
+				"filesystem": map[string]interface{}{"read": true, "write": true},
+				"network":    false,
+				"idempotent": true,
+			},
+		},
+		"cache": map[string]interface{}{
+			"description": "Manage cached tool metadata",
+			"commands": map[string]interface{}{
+				"prune": map[string]interface{}{
+					"description": "Remove expired cached metadata and trim the cache to its size budget",
+					"options": []map[string]interface{}{
+						{"name": "output", "flags": []string{"-o"}, "type": "enum", "enum": []string{"json", "table", "quiet"}, "default": "json", "description": "Output format"},
+					},
+					"effects": map[string]interface{}{
+						"filesystem": map[string]interface{}{"read": true, "write": true, "paths": []string{"~/.cache/agent-tools/"}},
+						"network":    false,
+						"idempotent": true,
+					},
+				},
+			},
+		},
+		"config": map[string]interface{}{
+			"description": "Inspect the effective configuration",
+			"commands": map[string]interface{}{
+				"show": map[string]interface{}{
+					"description": "Print the configuration after merging file, environment and flags",
+					"options": []map[string]interface{}{
+						{"name": "verbose", "flags": []string{"-v"}, "type": "boolean", "description": "Show the source of each value"},
+						{"name": "timeout", "flags": []string{"--timeout"}, "type": "string", "description": "Override the probe timeout"},
+						{"name": "parallel", "flags": []string{"--parallel"}, "type": "integer", "description": "Override the number of parallel probes"},
+						{"name": "skip", "flags": []string{"--skip"}, "type": "string", "variadic": true, "description": "Tool to skip in addition to discovery.skip_list (repeatable)"},
+						{"name": "skip-file", "flags": []string{"--skip-file"}, "type": "file", "description": "Override the skip file"},
+						{"name": "output", "flags": []string{"-o"}, "type": "enum", "enum": []string{"json", "table", "quiet"}, "default": "json", "description": "Output format"},
+					},
+					"effects": map[string]interface{}{
+						"filesystem": map[string]interface{}{"read": true, "write": false},
+						"network":    false,
+						"idempotent": true,
+					},
+				},
+				"validate": map[string]interface{}{
+					"description": "Validate the effective configuration (exits 1 if invalid)",
+					"options": []map[string]interface{}{
+						{"name": "output", "flags": []string{"-o"}, "type": "enum", "enum": []string{"json", "table", "quiet"}, "default": "json", "description": "Output format"},
+					},
+					"effects": map[string]interface{}{
+						"filesystem": map[string]interface{}{"read": true, "write": false},
+						"network":    false,
+						"idempotent": true,
+					},
+				},
+			},
+		},
+		"registry": map[string]interface{}{
+			"description": "Manage the registry of discovered tools",
+			"commands": map[string]interface{}{
+				"diff": map[string]interface{}{
+					"description": "Compare discovered tools with a remote registry's catalog",
+					"arguments":   []map[string]interface{}{{"name": "registry-url", "type": "string", "required": true, "description": "Base URL of the remote registry"}},
+					"options": []map[string]interface{}{
+						{"name": "timeout", "flags": []string{"--timeout"}, "type": "string", "default": "30s", "description": "Timeout for fetching the catalog"},
+						{"name": "offline", "flags": []string{"--offline"}, "type": "boolean", "description": "Fail instead of fetching"},
+						{"name": "output", "flags": []string{"-o"}, "type": "enum", "enum": []string{"json", "table", "quiet"}, "default": "json", "description": "Output format"},
+						{"name": "output-file", "flags": []string{"--output-file"}, "type": "file", "description": "Write output to this file (atomically) instead of stdout"},
+					},
+					"effects": map[string]interface{}{
+						"filesystem": map[string]interface{}{"read": true, "write": false},
+						"network":    true,
+						"idempotent": true,
+					},
+				},
+				"export": map[string]interface{}{
+					"description": "Export the registry as JSON, or JSON Lines with --ndjson",
+					"arguments":   []map[string]interface{}{{"name": "file", "type": "file", "required": false, "description": "Write the export to this file (atomically) instead of stdout"}},
+					"options": []map[string]interface{}{
+						{"name": "ndjson", "flags": []string{"--ndjson"}, "type": "boolean", "description": "Write one registry entry per line"},
+						{"name": "include-metadata", "flags": []string{"--include-metadata"}, "type": "boolean", "description": "Include each tool's cached metadata"},
+					},
+					"effects": map[string]interface{}{
+						"filesystem": map[string]interface{}{"read": true, "write": true},
+						"network":    false,
+						"idempotent": true,
+					},
+				},
+				"load-shims": map[string]interface{}{
+					"description": "Load shims from the shims directory into the registry (source shim)",
+					"options": []map[string]interface{}{
+						{"name": "prefer-shims", "flags": []string{"--prefer-shims"}, "type": "boolean", "description": "Let shims replace registered tools of the same name whatever discovery.source_precedence says"},
+						{"name": "output", "flags": []string{"-o"}, "type": "enum", "enum": []string{"json", "table", "quiet"}, "default": "json", "description": "Output format"},
+					},
+					"effects": map[string]interface{}{
+						"filesystem": map[string]interface{}{"read": true, "write": true, "paths": []string{"~/.local/share/agent-tools/", "~/.cache/agent-tools/"}},
+						"network":    false,
+						"idempotent": true,
+					},
+				},
+				"import": map[string]interface{}{
+					"description": "Add registry entries or ATIP metadata from a JSON Lines file (or a JSON export) to the registry",
+					"arguments":   []map[string]interface{}{{"name": "file", "type": "file", "required": true, "description": "File to import, - for stdin"}},
+					"options": []map[string]interface{}{
+						{"name": "strict", "flags": []string{"--strict"}, "type": "boolean", "description": "Import nothing if any line is invalid"},
+						{"name": "replace", "flags": []string{"--replace"}, "type": "boolean", "description": "Replace the registry instead of merging into it"},
+						{"name": "output", "flags": []string{"-o"}, "type": "enum", "enum": []string{"json", "table", "quiet"}, "default": "json", "description": "Output format"},
+					},
+					"effects": map[string]interface{}{
+						"filesystem": map[string]interface{}{"read": true, "write": true, "paths": []string{"~/.local/share/agent-tools/", "~/.cache/agent-tools/"}},
+						"network":    false,
+						"idempotent": true,
+					},
+				},
+			},
+		},
+		"schema": map[string]interface{}{
+			"description": "Print the embedded ATIP JSON Schema",
+			"options": []map[string]interface{}{
+				{"name": "version", "flags": []string{"--version"}, "type": "string", "default": validator.SchemaVersion, "description": "ATIP version of the schema"},
+			},
+			"effects": map[string]interface{}{
+				"filesystem": map[string]interface{}{"read": false, "write": false},
+				"network":    false,
+				"idempotent": true,
+			},
+			"commands": map[string]interface{}{
+				"validate": map[string]interface{}{
+					"description": "Validate an ATIP metadata file against the schema (exits 1 if invalid)",
+					"arguments":   []map[string]interface{}{{"name": "file", "type": "file", "required": true, "description": "Metadata file to validate"}},
+					"options": []map[string]interface{}{
+						{"name": "version", "flags": []string{"--version"}, "type": "string", "default": validator.SchemaVersion, "description": "ATIP version of the schema"},
+						{"name": "policy", "flags": []string{"--policy"}, "type": "file", "description": "JSON policy file of extra rules the metadata must pass"},
+						{"name": "strict-version", "flags": []string{"--strict-version"}, "type": "boolean", "description": "Require the version to be a semantic version (a leading v is accepted)"},
+						{"name": "output", "flags": []string{"-o"}, "type": "enum", "enum": []string{"json", "table", "quiet"}, "default": "json", "description": "Output format"},
+					},
+					"effects": map[string]interface{}{
+						"filesystem": map[string]interface{}{"read": true, "write": false},
+						"network":    false,
+						"idempotent": true,
+					},
+				},
+			},
+		},
+		"info": map[string]interface{}{
+			"description": "Show build metadata, data directories and registry size, e.g. for bug reports",
+			"options": []map[string]interface{}{
+				{"name": "output", "flags": []string{"-o"}, "type": "enum", "enum": []string{"json", "table", "quiet"}, "default": "json", "description": "Output format"},
+				{"name": "output-file", "flags": []string{"--output-file"}, "type": "file", "description": "Write output to this file (atomically) instead of stdout"},
 			},
 			"effects": map[string]interface{}{
 				"filesystem": map[string]interface{}{"read": true, "write": false},
@@ -83,8 +326,28 @@ var atipMetadata = map[string]interface{}{
 				"idempotent": true,
 			},
 		},
+		"serve": map[string]interface{}{
+			"description": "Answer line-delimited JSON list, get, search and scan requests on stdin, keeping the registry loaded between them",
+			"options": []map[string]interface{}{
+				{"name": "stdio", "flags": []string{"--stdio"}, "type": "boolean", "description": "Read requests from stdin and write responses to stdout (required)"},
+				{"name": "offline", "flags": []string{"--offline"}, "type": "boolean", "description": "Refuse scan requests, which probe executables"},
+			},
+			"effects": map[string]interface{}{
+				"filesystem": map[string]interface{}{"read": true, "write": true, "paths": []string{"~/.local/share/agent-tools/"}},
+				"network":    false,
+				"idempotent": false,
+			},
+		},
 		"refresh": map[string]interface{}{
 			"description": "Refresh cached metadata for tools",
+			"options": []map[string]interface{}{
+				{"name": "since", "flags": []string{"--since"}, "type": "string", "description": "Only refresh tools last verified longer ago than this duration (e.g. 24h)"},
+				{"name": "stale-only", "flags": []string{"--stale-only"}, "type": "boolean", "description": "Only refresh tools whose executable changed"},
+				{"name": "repair-cache", "flags": []string{"--repair-cache"}, "type": "boolean", "description": "Only refresh tools whose cached metadata is corrupt"},
+				{"name": "offline", "flags": []string{"--offline"}, "type": "boolean", "description": "Fail instead of probing"},
+				{"name": "output", "flags": []string{"-o"}, "type": "enum", "enum": []string{"json", "table", "quiet"}, "default": "json", "description": "Output format"},
+				{"name": "output-file", "flags": []string{"--output-file"}, "type": "file", "description": "Write output to this file (atomically) instead of stdout"},
+			},
 			"effects": map[string]interface{}{
 				"filesystem": map[string]interface{}{"read": true, "write": true},
 				"network":    false,
@@ -94,6 +357,7 @@ var atipMetadata = map[string]interface{}{
 	},
 	"globalOptions": []map[string]interface{}{
 		{"name": "output", "flags": []string{"-o"}, "type": "enum", "enum": []string{"json", "table", "quiet"}, "default": "json", "description": "Output format"},
+		{"name": "compact", "flags": []string{"--compact"}, "type": "boolean", "description": "With -o json, write minified single-line JSON instead of indented"},
 		{"name": "verbose", "flags": []string{"-v"}, "type": "boolean", "description": "Enable verbose logging"},
 	},
 }
@@ -123,7 +387,7 @@ func main() {
 
 	switch cmd {
 	case "--version":
-		fmt.Printf("atip-discover %s\n", Version)
+		runVersion(os.Args[2:])
 		os.Exit(0)
 	case "-v":
 		// Check if this is the only argument (version) or if there's a command
@@ -145,8 +409,24 @@ func main() {
 		runGet(os.Args[2:])
 	case "refresh":
 		runRefresh(os.Args[2:])
+	case "tag":
+		runTag(os.Args[2:])
+	case "annotate":
+		runAnnotate(os.Args[2:])
+	case "doctor":
+		runDoctor(os.Args[2:])
+	case "cache":
+		runCache(os.Args[2:])
+	case "config":
+		runConfig(os.Args[2:])
 	case "registry":
 		runRegistry(os.Args[2:])
+	case "schema":
+		runSchema(os.Args[2:])
+	case "info":
+		runInfo(os.Args[2:])
+	case "serve":
+		runServe(os.Args[2:])
 	default:
 		fmt.Fprintf(os.Stderr, "Unknown command: %s\n", cmd)
 		printUsage()
@@ -156,71 +436,246 @@ func main() {
 
 func runScan(args []string) {
 	fs := flag.NewFlagSet("scan", flag.ExitOnError)
-	allowPaths := fs.String("allow-path", "", "Additional path to scan (can be repeated)")
-	skipList := fs.String("skip", "", "Comma-separated list of tools to skip")
-	timeoutStr := fs.String("timeout", "2s", "Timeout for probing each tool")
-	parallelism := fs.Int("parallel", 4, "Number of parallel probes")
-	outputFormat := fs.String("o", "json", "Output format (json, table, quiet)")
-	dryRun := fs.Bool("dry-run", false, "Show what would be scanned without scanning")
+	var allowPaths, addPaths, skipList, probeAllow, timeoutOverrides listFlag
+	fs.Var(&allowPaths, "allow-path", "Additional path to scan (can be repeated)")
+	fs.Var(&addPaths, "add-path", "Path to scan alongside the configured safe paths (can be repeated)")
+	fs.Var(&skipList, "skip", "Tool to skip, in addition to discovery.skip_list (can be repeated)")
+	skipFile := fs.String("skip-file", "", "File of skip patterns, one per line")
+	policyFile := fs.String("policy", "", "Policy file of extra rules probed metadata must pass")
+	fs.Var(&probeAllow, "probe-allow", "Only probe tools matching this pattern (can be repeated)")
+	timeoutStr := fs.String("timeout", "", "Timeout for probing each tool (default discovery.scan_timeout, 2s)")
+	fs.Var(&timeoutOverrides, "timeout-override", "Timeout for one tool as name=duration (can be repeated)")
+	deadlineStr := fs.String("deadline", "", "Stop the whole scan after this long and report partial results (e.g. 30s)")
+	parallelism := fs.Int("parallel", 0, "Number of parallel probes (default discovery.parallelism, 4)")
+	probeRetries := fs.Int("probe-retries", 0, "Retries for probes that fail transiently")
+	outputFormat := fs.String("o", "json", "Output format (json, ndjson, table, quiet)")
+	addCompactFlag(fs)
+	outputFile := fs.String("output-file", "", "Write output to this file instead of stdout")
+	dryRun := fs.Bool("dry-run", false, "Show which executables would be probed or skipped, without probing")
 	verbose := fs.Bool("v", false, "Verbose output")
 	safePathsOnly := fs.Bool("safe-paths-only", true, "Only scan safe paths")
+	fromPath := fs.Bool("from-path", false, "Scan the directories listed in $PATH")
+	maxDepth := fs.Int("max-depth", 1, "Directory levels to scan under each path (1 scans only the path itself)")
+	allowOwners := fs.String("allow-owner", "", "Comma-separated users or UIDs trusted to own scanned directories")
+	allowGroups := fs.String("allow-group", "", "Comma-separated groups or GIDs trusted to own scanned directories")
+	prune := fs.Bool("prune", false, "Remove registry entries whose executable was deleted")
+	failOnError := fs.Bool("fail-on-error", false, "Exit 4 if any probe failed")
+	failIfNone := fs.Bool("fail-if-none", false, "Exit 3 if no tools were found")
+	minAtip := fs.String("min-atip-version", "", "Flag tools declaring an older ATIP version (e.g. 0.4)")
+	maxAtip := fs.String("max-atip-version", "", "Flag tools declaring a newer ATIP version (e.g. 0.6)")
+	offline := fs.Bool("offline", false, "Refuse to probe (scan fails unless --dry-run)")
+	verifyChecksums := fs.Bool("verify-checksums", false, "Check executables against the binary hash their metadata declares")
+	adaptHelp := fs.Bool("adapt-help", false, "Infer partial metadata from --help for tools without --agent")
+	errorKindsStr := fs.String("error-kinds", "", "Comma-separated error kinds to report, or all (default: all but no_agent_support)")
+	includeShims := fs.Bool("include-shims", false, "Also load shims from the shims directory into the registry")
+	preferShims := fs.Bool("prefer-shims", false, "With --include-shims, let shims replace native tools of the same name")
 
 	fs.Parse(args)
+	errorFormat = *outputFormat
 
-	// Ensure data directories exist
+	// Ensure data and cache directories exist
 	if err := xdg.EnsureDataDirs(); err != nil {
-		exitWithError("Failed to create data directories", err)
+		exitWithError(codeDataDirFailed, "Failed to create data directories", err)
+	}
+	if err := xdg.EnsureCacheDirs(); err != nil {
+		exitWithError(codeDataDirFailed, "Failed to create cache directories", err)
 	}
 
 	// Load config
-	cfg := config.Default()
-	configPath := filepath.Join(xdg.AgentToolsConfigDir(), "config.json")
-	if loadedCfg, err := config.Load(configPath); err == nil {
-		cfg = loadedCfg
+	cfg := loadConfig()
+
+	// Apply environment variables, --add-path, --probe-allow, --skip,
+	// --skip-file, and --timeout and --parallel if given, like config show
+	// does
+	flags := make(map[string]interface{})
+	if len(addPaths) > 0 {
+		flags["add-path"] = []string(addPaths)
+	}
+	if len(skipList) > 0 {
+		flags["skip"] = splitDeprecated("skip", skipList, nil)
+	}
+	if *skipFile != "" {
+		flags["skip-file"] = *skipFile
+	}
+	if len(probeAllow) > 0 {
+		flags["probe-allow"] = []string(probeAllow)
+	}
+	var err error
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "timeout":
+			if _, err := time.ParseDuration(*timeoutStr); err != nil {
+				exitWithError(codeInvalidTimeout, "Invalid timeout", err)
+			}
+			flags["timeout"] = *timeoutStr
+		case "parallel":
+			if *parallelism < 1 {
+				exitWithError(codeInvalidArgument, "Invalid --parallel", fmt.Errorf("%d is less than 1", *parallelism))
+			}
+			flags["parallel"] = *parallelism
+		}
+	})
+	if err := cfg.Merge(configEnv(), flags); err != nil {
+		exitWithError(codeInvalidConfig, "Invalid environment configuration", err)
+	}
+
+	var deadline time.Duration
+	if *deadlineStr != "" {
+		deadline, err = time.ParseDuration(*deadlineStr)
+		if err == nil && deadline <= 0 {
+			err = fmt.Errorf("%s is not positive", *deadlineStr)
+		}
+		if err != nil {
+			exitWithError(codeInvalidTimeout, "Invalid --deadline", err)
+		}
 	}
 
-	// Apply environment variables
-	envVars := map[string]string{
-		"ATIP_DISCOVER_TIMEOUT":    os.Getenv("ATIP_DISCOVER_TIMEOUT"),
-		"ATIP_DISCOVER_PARALLEL":   os.Getenv("ATIP_DISCOVER_PARALLEL"),
-		"ATIP_DISCOVER_SKIP":       os.Getenv("ATIP_DISCOVER_SKIP"),
-		"ATIP_DISCOVER_SAFE_PATHS": os.Getenv("ATIP_DISCOVER_SAFE_PATHS"),
+	if *probeRetries < 0 {
+		exitWithError(codeInvalidArgument, "Invalid --probe-retries", fmt.Errorf("%d is negative", *probeRetries))
 	}
-	if err := cfg.Merge(envVars, nil); err != nil {
-		exitWithError("Invalid environment configuration", err)
+	if *maxDepth < 1 {
+		exitWithError(codeInvalidArgument, "Invalid --max-depth", fmt.Errorf("%d is less than 1", *maxDepth))
 	}
 
-	// Parse timeout
-	timeout, err := time.ParseDuration(*timeoutStr)
+	errorKinds, err := parseErrorKinds(*errorKindsStr)
+	if err != nil {
+		exitWithError(codeInvalidArgument, "Invalid --error-kinds", err)
+	}
+	if *preferShims && !*includeShims {
+		exitWithError(codeInvalidArgument, "--prefer-shims requires --include-shims", nil)
+	}
+
+	// ndjson streams events to stdout as probes complete, so it can't be
+	// written atomically to a file
+	stream := *outputFormat == string(output.FormatNDJSON)
+	if stream && *outputFile != "" {
+		exitWithError(codeInvalidArgument, "--output-file can't be used with -o ndjson", nil)
+	}
+
+	// Per-tool timeouts from config, overridden by --timeout-override
+	toolTimeouts := make(map[string]time.Duration)
+	for name, d := range cfg.Discovery.Timeouts {
+		toolTimeouts[name] = d
+	}
+	overrides, err := parseTimeoutOverrides(timeoutOverrides)
 	if err != nil {
-		exitWithError("Invalid timeout", err)
+		exitWithError(codeInvalidTimeout, "Invalid --timeout-override", err)
+	}
+	for name, d := range overrides {
+		toolTimeouts[name] = d
+	}
+	cfg.Discovery.Timeouts = toolTimeouts
+
+	// Resolve trusted owners and groups
+	if *allowOwners != "" {
+		uids, err := resolveIDs(strings.Split(*allowOwners, ","), lookupUID)
+		if err != nil {
+			exitWithError(codeInvalidArgument, "Invalid --allow-owner", err)
+		}
+		cfg.Discovery.TrustedUIDs = append(cfg.Discovery.TrustedUIDs, uids...)
 	}
+	if *allowGroups != "" {
+		gids, err := resolveIDs(strings.Split(*allowGroups, ","), lookupGID)
+		if err != nil {
+			exitWithError(codeInvalidArgument, "Invalid --allow-group", err)
+		}
+		cfg.Discovery.TrustedGIDs = append(cfg.Discovery.TrustedGIDs, gids...)
+	}
+	safePathOpts := safePathOptions(cfg.Discovery)
 
-	// Parse skip list
-	var skipListSlice []string
-	if *skipList != "" {
-		skipListSlice = strings.Split(*skipList, ",")
+	// Organization policy is checked after the schema
+	var policyValidator *validator.Validator
+	if *policyFile != "" {
+		if policyValidator, err = validator.NewWithPolicy(xdg.ExpandTilde(*policyFile)); err != nil {
+			exitWithError(codeInvalidConfig, "Failed to load policy", err)
+		}
 	}
 
 	// Determine paths to scan
 	var scanPaths []string
-	if *allowPaths != "" {
-		scanPaths = strings.Split(*allowPaths, ",")
-	} else if *safePathsOnly {
-		scanPaths = cfg.Discovery.SafePaths
+	if len(allowPaths) > 0 {
+		scanPaths = splitDeprecated("allow-path", allowPaths, func(path string) bool {
+			_, err := os.Stat(path)
+			return err == nil
+		})
+	} else if *safePathsOnly && !*fromPath {
+		scanPaths = cfg.Discovery.ScanPaths()
+		for i, path := range scanPaths {
+			scanPaths[i] = xdg.ExpandTilde(path)
+		}
+	}
+
+	// Add $PATH entries, keeping order and dropping duplicates
+	pathEntries := make(map[string]bool)
+	if *fromPath {
+		dirs, dropped := discovery.SplitPathList(os.Getenv("PATH"))
+		for _, entry := range dropped {
+			fmt.Fprintf(os.Stderr, "Warning: Skipping relative or empty PATH entry: %q\n", entry)
+		}
+		seen := make(map[string]bool)
+		for _, path := range scanPaths {
+			seen[path] = true
+		}
+		for _, dir := range dirs {
+			pathEntries[dir] = true
+			if !seen[dir] {
+				seen[dir] = true
+				scanPaths = append(scanPaths, dir)
+			}
+		}
+	}
+
+	// Load existing registry for incremental scan
+	reg, err := loadRegistry()
+	if err != nil {
+		exitWithError(codeRegistryLoadFailed, "Failed to load registry", err)
+	}
+
+	// Build existing registry map for incremental scanning
+	existingRegistry := make(map[string]time.Time)
+	for _, entry := range reg.Tools {
+		existingRegistry[entry.Path] = entry.ModTime
+	}
+
+	// Create scanner
+	scanner, rerr := newScanner(cfg.Discovery, *maxDepth)
+	if rerr != nil {
+		exitWithError(rerr.Code, rerr.Message, nil)
 	}
 
-	// Dry run mode
+	// Dry run mode: show what each directory's executables would be probed
+	// or skipped for, without probing any
 	if *dryRun {
+		plannedPaths, skippedPaths := checkScanPaths(scanPaths, safePathOpts, *safePathsOnly, nil)
+
+		plan := scanner.Plan(plannedPaths, true, existingRegistry)
+		wouldProbe, wouldSkip := 0, 0
+		for _, dir := range plan {
+			for _, exec := range dir.Executables {
+				if exec.Probe {
+					wouldProbe++
+				} else {
+					wouldSkip++
+				}
+			}
+		}
+
 		result := map[string]interface{}{
-			"scan_paths": scanPaths,
-			"would_scan": scanPaths,
+			"scan_paths":    scanPaths,
+			"would_scan":    scanPaths,
+			"skipped_paths": skippedPaths,
+			"directories":   plan,
+			"would_probe":   wouldProbe,
+			"would_skip":    wouldSkip,
 		}
-		writer, _ := output.NewWriter(output.Format(*outputFormat), os.Stdout)
-		writer.Write(result)
+		writeOutput(*outputFormat, *outputFile, result)
 		return
 	}
 
+	if isOffline(*offline) {
+		exitWithError(codeOffline, "scan probes executables, which offline mode forbids", nil)
+	}
+
 	// Warn if safe-paths-only is disabled
 	if !*safePathsOnly {
 		fmt.Fprintf(os.Stderr, "Warning: Scanning without safe path enforcement. This may execute untrusted code.\n")
@@ -232,13 +687,12 @@ func runScan(args []string) {
 	}
 
 	// Check path safety
-	var safePaths []string
-	for _, path := range scanPaths {
+	safePaths, _ := checkScanPaths(scanPaths, safePathOpts, *safePathsOnly, func(path string, safe bool, err error) {
 		if *verbose {
 			fmt.Fprintf(os.Stderr, "[DEBUG] Checking path: %s\n", path)
 		}
-		safe, err := discovery.IsSafePath(path)
-		if err != nil {
+		switch {
+		case err != nil:
 			// Always print verbose messages if -v flag is set
 			if *verbose {
 				fmt.Fprintf(os.Stderr, "DEBUG: Skipping unsafe path %s: %v\n", path, err)
@@ -246,288 +700,706 @@ func runScan(args []string) {
 			// Check for specific errors and print to stderr
 			if strings.Contains(err.Error(), "world-writable") {
 				fmt.Fprintf(os.Stderr, "Skipping world-writable directory: %s\n", path)
+			} else if strings.Contains(err.Error(), "current directory") {
+				fmt.Fprintf(os.Stderr, "Warning: current directory not allowed, skipping: %s\n", path)
+			} else if pathEntries[path] {
+				fmt.Fprintf(os.Stderr, "Warning: Skipping unsafe PATH entry %s: %v\n", path, err)
 			}
-			if strings.Contains(err.Error(), "current directory") {
-				fmt.Fprintf(os.Stderr, "Error: current directory not allowed: %s\n", path)
-			}
-			continue
-		}
-		if !safe && *safePathsOnly {
+		case !safe && *safePathsOnly:
 			if *verbose {
 				fmt.Fprintf(os.Stderr, "DEBUG: Skipping unsafe path %s\n", path)
 			}
-			continue
-		}
-		if !safe {
+		case !safe:
 			fmt.Fprintf(os.Stderr, "Warning: Scanning potentially unsafe path %s (safe-paths-only disabled)\n", path)
 		}
-		safePaths = append(safePaths, path)
+	})
+
+	if err := scanner.SetAtipVersionRange(*minAtip, *maxAtip); err != nil {
+		exitWithError(codeInvalidArgument, "Invalid ATIP version range", err)
+	}
+	if policyValidator != nil {
+		scanner.SetValidator(policyValidator)
+	}
+	scanner.SetRetries(*probeRetries)
+	scanner.SetAdaptHelp(*adaptHelp)
+
+	// Hashes of unchanged executables are reused from earlier scans
+	var hashes *hashcache.Cache
+	if *verifyChecksums {
+		hashes = hashcache.Load(filepath.Join(xdg.AgentToolsCacheDir(), "hashes.json"))
+		hashes.SetLimits(cfg.Cache.MaxAge, int64(cfg.Cache.MaxSizeMB)*1024*1024)
+		scanner.SetVerifyChecksums(hashes)
+	}
+
+	// Stream tools and the requested kinds of errors as probes complete
+	events := output.NewNDJSONWriter(os.Stdout)
+	if stream {
+		reported := make(map[string]bool)
+		for _, kind := range errorKinds {
+			reported[kind] = true
+		}
+		scanner.SetProgress(func(event discovery.ScanEvent) {
+			if event.Tool != nil {
+				events.Write(struct {
+					Type string `json:"type"`
+					*discovery.DiscoveredTool
+				}{"tool", event.Tool})
+			} else if reported[event.Error.Kind] {
+				events.Write(struct {
+					Type string `json:"type"`
+					*discovery.ScanError
+				}{"error", event.Error})
+			}
+		})
 	}
 
-	// Load existing registry for incremental scan
-	reg, err := loadRegistry()
+	// Scan, stopping at --deadline with whatever finished in time
+	ctx := context.Background()
+	if deadline > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, deadline)
+		defer cancel()
+	}
+	result, err := scanner.Scan(ctx, safePaths, true, existingRegistry)
 	if err != nil {
-		exitWithError("Failed to load registry", err)
+		exitWithError(codeScanFailed, "Scan failed", err)
+	}
+	if result.DeadlineExceeded {
+		fmt.Fprintf(os.Stderr, "Warning: Scan deadline of %s exceeded; %d executable(s) not probed\n", deadline, result.Unprobed)
+	}
+	for _, pe := range result.PathErrors {
+		fmt.Fprintf(os.Stderr, "Warning: Couldn't read %s (%s): %s\n", pe.Path, pe.Reason, pe.Error)
+	}
+	if *verbose {
+		for _, dir := range result.UnsafeDirs {
+			fmt.Fprintf(os.Stderr, "[DEBUG] Skipped unsafe subdirectory: %s\n", dir)
+		}
+	}
+	if hashes != nil {
+		if err := hashes.Save(); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: Failed to save hash cache: %v\n", err)
+		}
 	}
 
-	// Build existing registry map for incremental scanning
-	existingRegistry := make(map[string]time.Time)
-	for _, entry := range reg.Tools {
-		existingRegistry[entry.Path] = entry.ModTime
+	// Update registry, marking tools deleted since the last scan
+	scannedPaths := recordScan(reg, result, *prune)
+
+	// Merge shims alongside the natively discovered tools
+	var shims *registry.ShimLoadResult
+	if *includeShims {
+		shims, err = loadShims(reg, *preferShims)
+		if err != nil {
+			exitWithError(codeRegistryLoadFailed, "Failed to load shims", err)
+		}
 	}
 
-	// Create scanner
-	scanner, err := discovery.NewScanner(timeout, *parallelism, skipListSlice)
-	if err != nil {
-		exitWithError("Failed to create scanner", err)
+	// Update registry metadata
+	reg.LastScan = reg.Now()
+
+	// Save registry
+	if err := reg.Save(); err != nil {
+		exitWithError(codeRegistrySaveFailed, "Failed to save registry", err)
 	}
 
-	// Scan
-	ctx := context.Background()
-	result, err := scanner.Scan(ctx, safePaths, true, existingRegistry)
+	// Report only the requested kinds of errors; counts keep all of them
+	result.FilterErrors(errorKinds)
+
+	// Write output, including what cache maintenance reclaimed
+	cache := pruneCache(reg, cfg)
+	if stream {
+		// The summary replaces the tools and errors arrays, which were
+		// streamed, with the number of events streamed for each
+		events.Write(struct {
+			Type string `json:"type"`
+			*discovery.ScanResult
+			Tools  int                      `json:"tools"`
+			Errors int                      `json:"errors"`
+			Shims  *registry.ShimLoadResult `json:"shims,omitempty"`
+			Cache  *registry.PruneResult    `json:"cache,omitempty"`
+		}{"summary", result, len(result.Tools), len(result.Errors), shims, cache})
+	} else {
+		writeOutput(*outputFormat, *outputFile, struct {
+			*discovery.ScanResult
+			Shims *registry.ShimLoadResult `json:"shims,omitempty"`
+			Cache *registry.PruneResult    `json:"cache,omitempty"`
+		}{result, shims, cache})
+	}
+
+	// Opt-in exit codes for CI; otherwise a completed scan exits 0
+	if *failIfNone && len(reg.Present(scannedPaths)) == 0 {
+		fmt.Fprintf(os.Stderr, "Error: No tools found\n")
+		os.Exit(exitNoneFound)
+	}
+	if *failOnError && result.Failed > 0 {
+		fmt.Fprintf(os.Stderr, "Error: %d probe(s) failed\n", result.Failed)
+		os.Exit(exitProbeFailures)
+	}
+}
+
+// newScanner creates a scanner with d's timeouts, parallelism, skip list,
+// skip file and probe allowlist, descending maxDepth levels into
+// directories that d's trusted owners and groups make safe. The scan
+// command and the serve scan request both use it, so they honour the same
+// settings. Failures carry the error code to report them under.
+func newScanner(d config.DiscoveryConfig, maxDepth int) (*discovery.Scanner, *rpc.Error) {
+	skipList := append([]string{}, d.SkipList...)
+	if d.SkipFile != "" {
+		patterns, err := discovery.LoadSkipFile(xdg.ExpandTilde(d.SkipFile))
+		if err != nil {
+			return nil, rpc.Errorf(codeInvalidSkipList, "Failed to load skip file: %v", err)
+		}
+		skipList = append(skipList, patterns...)
+	}
+	if err := discovery.ValidateSkipList(skipList); err != nil {
+		return nil, rpc.Errorf(codeInvalidSkipList, "Invalid skip list: %v", err)
+	}
+
+	scanner, err := discovery.NewScanner(d.ScanTimeout, d.Parallelism, skipList)
 	if err != nil {
-		exitWithError("Scan failed", err)
+		return nil, rpc.Errorf(codeInternal, "Failed to create scanner: %v", err)
+	}
+	if err := scanner.SetProbeAllow(d.ProbeAllow); err != nil {
+		return nil, rpc.Errorf(codeInvalidArgument, "Invalid probe allowlist: %v", err)
+	}
+	scanner.SetMaxDepth(maxDepth, safePathOptions(d))
+	scanner.SetTimeouts(d.Timeouts)
+	scanner.SetProbeCache(discovery.NewProbeCache())
+	return scanner, nil
+}
+
+// safePathOptions returns the safe path check options for d's trusted
+// owners and groups.
+func safePathOptions(d config.DiscoveryConfig) discovery.SafePathOptions {
+	return discovery.SafePathOptions{
+		TrustedUIDs: d.TrustedUIDs,
+		TrustedGIDs: d.TrustedGIDs,
+	}
+}
+
+// checkScanPaths splits paths into those to scan and those to skip. Paths
+// that fail the safe path check are always skipped; unsafe ones are too if
+// safePathsOnly is set, and scanned otherwise. report, if not nil, is
+// called with each path's verdict, e.g. to warn about it.
+func checkScanPaths(paths []string, opts discovery.SafePathOptions, safePathsOnly bool, report func(path string, safe bool, err error)) (scan, skipped []string) {
+	skipped = []string{}
+	for _, path := range paths {
+		safe, err := discovery.IsSafePathWithOptions(path, opts)
+		if report != nil {
+			report(path, safe, err)
+		}
+		if err != nil || (!safe && safePathsOnly) {
+			skipped = append(skipped, path)
+			continue
+		}
+		scan = append(scan, path)
 	}
+	return scan, skipped
+}
 
-	// Update registry
+// recordScan adds the tools a scan found to reg, caching their metadata,
+// and marks the tools deleted from the scanned directories since the last
+// scan as missing, or with prune removes them. It sets result's
+// Discovered, Updated and Removed counts from the registry's point of view
+// and returns the directories the scan covered, subdirectories included.
+func recordScan(reg *registry.Registry, result *discovery.ScanResult, prune bool) []string {
 	updated := 0
 	discovered := 0
 
 	for _, tool := range result.Tools {
-		// Get mod time
-		info, _ := os.Stat(tool.Path)
-		var modTime time.Time
-		if info != nil {
-			modTime = info.ModTime()
+		// Record the mod time of the binary that was probed, falling back
+		// to the current one
+		modTime := tool.ModTime
+		if modTime.IsZero() {
+			if info, err := os.Stat(tool.Path); err == nil {
+				modTime = info.ModTime()
+			}
 		}
 
 		// Check if tool exists in registry
 		existing, err := reg.Get(tool.Name)
 		isNew := (err != nil)
 
-		if isNew {
-			discovered++
-		} else {
-			// Tool exists - check if version changed
-			if existing.Version != tool.Version {
-				updated++
-			}
-		}
-
 		// Add to registry
 		entry := &registry.RegistryEntry{
 			Name:         tool.Name,
 			Version:      tool.Version,
 			Path:         tool.Path,
 			Source:       tool.Source,
+			Platform:     tool.Platform,
+			AtipVersion:  tool.AtipVersion,
+			Unsupported:  tool.Unsupported,
 			DiscoveredAt: tool.DiscoveredAt,
-			LastVerified: time.Now(),
+			LastVerified: reg.Now(),
 			ModTime:      modTime,
+			Tags:         registry.InferTags(tool.Metadata),
+		}
+		if errors.Is(reg.Add(entry), registry.ErrShadowed) {
+			// A source of higher precedence keeps the tool, and its cache
+			continue
+		}
+
+		if isNew {
+			discovered++
+		} else {
+			// Tool exists - check if version changed
+			if existing.Version != tool.Version {
+				updated++
+			}
 		}
-		reg.Add(entry)
 
 		// Cache metadata (ignore errors - caching is optional)
-		_ = cacheMetadata(ctx, entry, timeout)
+		_ = cacheMetadata(entry, tool.Metadata)
+	}
+
+	// Handle tools deleted from the scanned directories, and subdirectories
+	// with --max-depth, since the last scan. Directories that couldn't be
+	// read are left alone, so tools on an unmounted volume aren't marked
+	// missing or pruned.
+	unreadable := make(map[string]bool, len(result.PathErrors))
+	for _, pe := range result.PathErrors {
+		unreadable[pe.Path] = true
+	}
+	var scannedPaths, readPaths []string
+	for _, dir := range result.Directories {
+		scannedPaths = append(scannedPaths, dir.Path)
+		scannedPaths = append(scannedPaths, dir.Subdirectories...)
+	}
+	for _, path := range scannedPaths {
+		if !unreadable[path] {
+			readPaths = append(readPaths, path)
+		}
+	}
+	for _, entry := range reg.Missing(readPaths) {
+		result.Removed++
+		if prune {
+			reg.Remove(entry.Name)
+		} else {
+			entry.Missing = true
+		}
 	}
 
 	// Override result counts with CLI-level counts
 	result.Discovered = discovered
 	result.Updated = updated
-
-	// Update registry metadata
-	reg.LastScan = time.Now()
-
-	// Save registry
-	if err := reg.Save(); err != nil {
-		exitWithError("Failed to save registry", err)
-	}
-
-	// Write output
-	writer, err := createOutputWriter(*outputFormat)
-	if err != nil {
-		exitWithError("Invalid output format", err)
-	}
-	writer.Write(result)
+	return scannedPaths
 }
 
 func runList(args []string) {
 	fs := flag.NewFlagSet("list", flag.ExitOnError)
 	outputFormat := fs.String("o", "json", "Output format (json, table, quiet)")
+	addCompactFlag(fs)
+	fs.BoolVar(&wideTable, "wide", false, "With -o table, add PATH and LAST_VERIFIED columns and show full descriptions")
+	outputFile := fs.String("output-file", "", "Write output to this file instead of stdout")
 	pattern := fs.String("pattern", "", "Filter by pattern")
-	sourceFilter := fs.String("source", "all", "Filter by source (native, shim, all)")
+	sourceFilter := fs.String("source", "all", "Filter by source (native, inferred, shim, all)")
+	platformFilter := fs.String("platform", "all", "Filter by platform (e.g. linux-amd64, all)")
+	tagFilter := fs.String("tag", "", "Filter by tag (e.g. vcs)")
+	var annotationFilters listFlag
+	fs.Var(&annotationFilters, "annotation", "Filter by annotation key=value or key (can be repeated)")
+	sortKey := fs.String("sort", registry.SortByName, "Sort by name, version or source")
+	offline := fs.Bool("offline", false, "Read only the registry and cache (list never probes)")
+	effects := fs.Bool("effects", false, "Tag each tool with badges for the effects of its commands")
+	interactive := fs.Bool("interactive", false, "Browse the tools in a terminal UI with live filtering")
 	fs.Parse(args)
+	errorFormat = *outputFormat
+	isOffline(*offline)
+	if *interactive {
+		if *outputFile != "" {
+			exitWithError(codeInvalidArgument, "--output-file can't be used with --interactive", nil)
+		}
+		if !tui.IsTerminal(os.Stdin) || !tui.IsTerminal(os.Stdout) {
+			exitWithError(codeNotATerminal, "--interactive requires stdin and stdout to be a terminal", tui.ErrNotTerminal)
+		}
+	}
 
 	// Load registry
 	reg, err := loadRegistry()
 	if err != nil {
-		exitWithError("Failed to load registry", err)
+		exitWithError(codeRegistryLoadFailed, "Failed to load registry", err)
 	}
-	dataDir := xdg.AgentToolsDataDir()
 
 	// List tools
-	tools, err := reg.List(*pattern, *sourceFilter)
+	tools, err := reg.List(registry.ListFilter{
+		Pattern:  *pattern,
+		Source:   *sourceFilter,
+		Platform: *platformFilter,
+		Tag:      *tagFilter,
+	})
 	if err != nil {
-		exitWithError("Failed to list tools", err)
+		exitWithError(codeInvalidArgument, "Failed to list tools", err)
+	}
+	if tools, err = registry.FilterByAnnotations(tools, annotationFilters); err != nil {
+		exitWithError(codeInvalidArgument, "Invalid --annotation", err)
+	}
+	if err := registry.SortEntries(tools, *sortKey); err != nil {
+		exitWithError(codeInvalidArgument, "Invalid --sort", err)
 	}
 
-	// Load descriptions from cached metadata
-	type ToolInfo struct {
-		Name        string `json:"name"`
-		Version     string `json:"version"`
-		Description string `json:"description"`
-		Source      string `json:"source"`
+	if *interactive {
+		browseTools(tools)
+		return
 	}
 
-	var toolInfos []ToolInfo
+	// Load descriptions from cached metadata
+	toolInfos := describeTools(tools, *effects)
+	result := listResult{Count: len(toolInfos), Tools: toolInfos}
+
+	// Write output
+	writeOutput(*outputFormat, *outputFile, result)
+}
+
+// listedTool is a tool as list and search report it: its registry entry
+// with the description and trust from its cached metadata.
+type listedTool struct {
+	Name        string                   `json:"name"`
+	Version     string                   `json:"version"`
+	Description string                   `json:"description"`
+	Source      string                   `json:"source"`
+	Platform    string                   `json:"platform,omitempty"`
+	AtipVersion string                   `json:"atip_version,omitempty"`
+	Unsupported bool                     `json:"unsupported,omitempty"`
+	Missing     bool                     `json:"missing,omitempty"`
+	Partial     bool                     `json:"partial,omitempty"` // Metadata leaves out commands
+	Tags        []string                 `json:"tags,omitempty"`
+	Annotations map[string]string        `json:"annotations,omitempty"`
+	Effects     []string                 `json:"effects,omitempty"`
+	TrustSource string                   `json:"trust_source"`
+	Verified    bool                     `json:"verified"`
+	Signature   string                   `json:"signature,omitempty"`
+	Shadowed    []registry.ShadowedEntry `json:"shadowed,omitempty"` // Sources that lost to this one
+	ETag        string                   `json:"etag,omitempty"`     // Of the cached metadata, see get --if-none-match
+
+	// Only shown by -o table --wide
+	Path         string    `json:"-"`
+	LastVerified time.Time `json:"-"`
+}
+
+// listResult is the output of list and search.
+type listResult struct {
+	Count int          `json:"count"`
+	Tools []listedTool `json:"tools"`
+}
+
+// describeTools loads the cached metadata of each tool for list and
+// search, with effect badges if effects is set.
+func describeTools(tools []*registry.RegistryEntry, effects bool) []listedTool {
+	var toolInfos []listedTool
 	for _, entry := range tools {
 		description := ""
-
-		// Try to load cached metadata
-		cachePath := entry.CachePath(dataDir)
-		if data, err := os.ReadFile(cachePath); err == nil {
-			var metadata validator.AtipMetadata
+		partial := false
+		etag := ""
+		var badges []string
+
+		// Try to load cached metadata; without it, trust is unknown
+		var metadata *validator.AtipMetadata
+		data, err := readCachedMetadata(entry)
+		if errors.Is(err, registry.ErrCorruptMetadata) {
+			fmt.Fprintf(os.Stderr, "Warning: Ignoring corrupt cached metadata for %s; run 'atip-discover refresh --repair-cache'\n", entry.Name)
+		}
+		if err == nil {
+			etag = registry.MetadataDigest(data)
 			if err := json.Unmarshal(data, &metadata); err == nil {
 				description = metadata.Description
+				partial = metadata.Partial
+				if effects {
+					badges = metadata.Effects().Badges
+				}
 			}
 		}
+		trust := metadata.TrustSummary()
 
-		toolInfos = append(toolInfos, ToolInfo{
+		toolInfos = append(toolInfos, listedTool{
 			Name:        entry.Name,
 			Version:     entry.Version,
 			Description: description,
 			Source:      entry.Source,
+			Platform:    entry.Platform,
+			AtipVersion: entry.AtipVersion,
+			Unsupported: entry.Unsupported,
+			Missing:     entry.Missing,
+			Partial:     partial,
+			Tags:        entry.Tags,
+			Annotations: entry.Annotations,
+			Effects:     badges,
+			TrustSource: trust.Source,
+			Verified:    trust.Verified,
+			Signature:   trust.Signature,
+			Shadowed:    entry.Shadowed,
+			ETag:        etag,
+
+			Path:         entry.Path,
+			LastVerified: entry.LastVerified,
 		})
 	}
-
-	// Prepare result
-	result := struct {
-		Count int        `json:"count"`
-		Tools []ToolInfo `json:"tools"`
-	}{
-		Count: len(toolInfos),
-		Tools: toolInfos,
-	}
-
-	// Write output
-	writer, err := createOutputWriter(*outputFormat)
-	if err != nil {
-		exitWithError("Invalid output format", err)
-	}
-	writer.Write(result)
-}
+	return toolInfos
+}
 
 func runGet(args []string) {
 	fs := flag.NewFlagSet("get", flag.ExitOnError)
 	outputFormat := fs.String("o", "json", "Output format (json, table, quiet)")
+	addCompactFlag(fs)
+	outputFile := fs.String("output-file", "", "Write output to this file instead of stdout")
+	offline := fs.Bool("offline", false, "Read only the registry and cache (get never probes)")
+	effects := fs.Bool("effects", false, "Summarize which commands touch the network, are destructive or write files")
+	trust := fs.Bool("trust", false, "Summarize the trust source, verification and signature the metadata declares")
+	registryURL := fs.String("registry", "", "Fetch the tool's shim from this remote registry")
+	version := fs.String("version", "", "Version to fetch with --registry (default: latest)")
+	platform := fs.String("platform", discovery.HostPlatform(), "Platform to fetch with --registry")
+	timeoutStr := fs.String("timeout", "30s", "Timeout for fetching from --registry")
+	etagOnly := fs.Bool("etag-only", false, "Print the metadata's ETag instead of the metadata")
+	ifNoneMatch := fs.String("if-none-match", "", "Exit 5 without output if the metadata's ETag is one of these (comma-separated, * for any)")
 	fs.Parse(args)
+	errorFormat = *outputFormat
 
 	if len(fs.Args()) < 1 {
-		fmt.Fprintf(os.Stderr, "Error: tool name required\n")
-		os.Exit(1)
+		exitWithError(codeInvalidArgument, "tool name required", nil)
 	}
 
+	// Flags may also follow the tool name, e.g. get gh --registry URL
 	toolName := fs.Args()[0]
+	fs.Parse(fs.Args()[1:])
+	errorFormat = *outputFormat
 
 	// Load registry
 	reg, err := loadRegistry()
 	if err != nil {
-		exitWithError("Failed to load registry", err)
+		exitWithError(codeRegistryLoadFailed, "Failed to load registry", err)
 	}
-	dataDir := xdg.AgentToolsDataDir()
 
-	// Get tool
-	entry, err := reg.Get(toolName)
-	if err != nil {
-		// Output error in JSON format
-		errorResult := map[string]interface{}{
-			"error": map[string]string{
-				"code":    "TOOL_NOT_FOUND",
-				"message": fmt.Sprintf("Tool not found: %s", toolName),
-			},
+	var data []byte
+	if *registryURL != "" {
+		if isOffline(*offline) {
+			exitWithError(codeOffline, "get --registry fetches from a remote registry, which offline mode forbids", nil)
+		}
+		timeout, err := time.ParseDuration(*timeoutStr)
+		if err != nil {
+			exitWithError(codeInvalidTimeout, "Invalid timeout", err)
+		}
+
+		shim, err := newRemoteClient(timeout).FetchShim(context.Background(), *registryURL, toolName, *version, *platform)
+		if errors.Is(err, remote.ErrNotFound) {
+			exitWithError(codeToolNotFound, "Tool not found in "+*registryURL, err)
+		}
+		if err != nil {
+			exitWithError(codeRegistryFetchFailed, "Failed to fetch shim from "+*registryURL, err)
+		}
+		v, err := validator.Default()
+		if err != nil {
+			exitWithError(codeInternal, "Failed to load schema", err)
+		}
+		if err := v.ValidateMetadata(shim.Metadata); err != nil {
+			exitWithError(codeRegistryFetchFailed, "Invalid shim from "+*registryURL, err)
+		}
+		// Print the metadata as it is cached, so its ETag matches later
+		// offline reads
+		if data, err = cachedMetadataForm(shim.Data); err != nil {
+			exitWithError(codeRegistryFetchFailed, "Invalid shim from "+*registryURL, err)
+		}
+
+		// Caching is optional, so a failure only means fetching again
+		if err := cacheShim(reg, shim); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: Failed to cache shim: %v\n", err)
+		}
+	} else {
+		isOffline(*offline)
+
+		// Get tool
+		entry, err := reg.Get(toolName)
+		if err != nil {
+			exitWithError(codeToolNotFound, "Tool not found: "+toolName, nil)
+		}
+
+		// Load cached metadata
+		data, err = readCachedMetadata(entry)
+		if errors.Is(err, registry.ErrCorruptMetadata) {
+			exitWithError(codeCacheCorrupt, "Cached metadata for "+toolName+" is corrupt; run 'atip-discover refresh --repair-cache'", err)
+		}
+		if err != nil {
+			exitWithError(codeMetadataUnavailable, "Failed to load tool metadata", err)
 		}
-		data, _ := json.MarshalIndent(errorResult, "", "  ")
-		fmt.Println(string(data))
-		os.Exit(1)
 	}
 
-	// Load cached metadata
-	cachePath := entry.CachePath(dataDir)
-	data, err := os.ReadFile(cachePath)
-	if err != nil {
-		exitWithError("Failed to load tool metadata", err)
+	// Conditional reads, as in HTTP: the ETag is the digest of the metadata
+	// as cached, so it changes exactly when the metadata does
+	etag := registry.MetadataDigest(data)
+	if *ifNoneMatch != "" && etagMatches(*ifNoneMatch, etag) {
+		os.Exit(exitNotModified)
+	}
+	if *etagOnly {
+		if *outputFormat == "json" {
+			writeOutput(*outputFormat, *outputFile, struct {
+				Name string `json:"name"`
+				ETag string `json:"etag"`
+			}{Name: toolName, ETag: etag})
+			return
+		}
+		writeOutputTo(*outputFile, func(w io.Writer) error {
+			_, err := fmt.Fprintln(w, etag)
+			return err
+		})
+		return
+	}
+
+	// Summarize effects instead of printing the metadata
+	if *effects {
+		var metadata validator.AtipMetadata
+		if err := json.Unmarshal(data, &metadata); err != nil {
+			exitWithError(codeMetadataUnavailable, "Failed to parse metadata", err)
+		}
+		summary := metadata.Effects()
+
+		// Show declared paths as they resolve for this user
+		for _, write := range summary.Writes {
+			for i, path := range write.Paths {
+				write.Paths[i] = xdg.ExpandTilde(path)
+			}
+		}
+		writeOutput(*outputFormat, *outputFile, summary)
+		return
+	}
+
+	// Summarize trust instead of printing the metadata
+	if *trust {
+		var metadata validator.AtipMetadata
+		if err := json.Unmarshal(data, &metadata); err != nil {
+			exitWithError(codeMetadataUnavailable, "Failed to parse metadata", err)
+		}
+		writeOutput(*outputFormat, *outputFile, metadata.TrustSummary())
+		return
 	}
 
 	// Output raw JSON metadata
 	if *outputFormat == "json" {
-		fmt.Println(string(data))
+		if compactJSON {
+			var compacted bytes.Buffer
+			if err := json.Compact(&compacted, data); err != nil {
+				exitWithError(codeMetadataUnavailable, "Failed to parse metadata", err)
+			}
+			data = compacted.Bytes()
+		}
+		writeOutputTo(*outputFile, func(w io.Writer) error {
+			_, err := fmt.Fprintln(w, string(data))
+			return err
+		})
 	} else {
 		// For other formats, parse and write
 		var metadata validator.AtipMetadata
 		if err := json.Unmarshal(data, &metadata); err != nil {
-			exitWithError("Failed to parse metadata", err)
+			exitWithError(codeMetadataUnavailable, "Failed to parse metadata", err)
 		}
-		writer, _ := createOutputWriter(*outputFormat)
-		writer.Write(metadata)
+		writeOutput(*outputFormat, *outputFile, metadata)
 	}
 }
 
 func runRefresh(args []string) {
 	fs := flag.NewFlagSet("refresh", flag.ExitOnError)
 	outputFormat := fs.String("o", "json", "Output format (json, table, quiet)")
+	addCompactFlag(fs)
+	outputFile := fs.String("output-file", "", "Write output to this file instead of stdout")
+	since := fs.Duration("since", 0, "Only refresh tools last verified longer ago than this (e.g. 24h)")
+	staleOnly := fs.Bool("stale-only", false, "Only refresh tools whose executable changed")
+	repairCache := fs.Bool("repair-cache", false, "Only refresh tools whose cached metadata is corrupt")
+	offline := fs.Bool("offline", false, "Refuse to probe (refresh fails)")
 	fs.Parse(args)
+	errorFormat = *outputFormat
+
+	if isOffline(*offline) {
+		exitWithError(codeOffline, "refresh probes executables, which offline mode forbids", nil)
+	}
 
 	// Load registry
 	reg, err := loadRegistry()
 	if err != nil {
-		exitWithError("Failed to load registry", err)
+		exitWithError(codeRegistryLoadFailed, "Failed to load registry", err)
 	}
 
 	ctx := context.Background()
-	timeout := 2 * time.Second
-	prober := discovery.NewProber(timeout)
+	cfg := loadConfig()
+	if err := cfg.Merge(configEnv(), nil); err != nil {
+		exitWithError(codeInvalidConfig, "Invalid environment configuration", err)
+	}
+	prober := discovery.NewProber(cfg.Discovery.ScanTimeout, nil)
+	prober.SetTimeouts(cfg.Discovery.Timeouts)
+	prober.SetCache(discovery.NewProbeCache())
 
 	type RefreshTool struct {
 		Name       string `json:"name"`
 		Status     string `json:"status"`
 		OldVersion string `json:"old_version,omitempty"`
 		NewVersion string `json:"new_version,omitempty"`
+		Repaired   bool   `json:"repaired,omitempty"` // Cached metadata was corrupt and has been rewritten
 	}
 
 	var refreshed []RefreshTool
 	refreshedCount := 0
+	skippedCount := 0
 
 	// Refresh each tool
 	for _, entry := range reg.Tools {
 		if entry.Source == "shim" {
 			continue // Skip shims
 		}
+		_, cacheErr := readCachedMetadata(entry)
+		corrupt := errors.Is(cacheErr, registry.ErrCorruptMetadata)
+		if *repairCache {
+			// A corrupt cache needs rewriting however recently the tool was verified
+			if !corrupt {
+				skippedCount++
+				continue
+			}
+		} else if !entry.NeedsRefreshAt(reg.Now(), *since, *staleOnly) {
+			skippedCount++
+			continue
+		}
 
-		oldVersion := entry.Version
-
-		// Probe tool again
-		metadata, err := prober.Probe(ctx, entry.Path)
-		if err != nil {
+		// Tools registered before the allowlist was configured aren't run
+		if !probeAllowed(cfg, entry.Path) {
+			skippedCount++
 			refreshed = append(refreshed, RefreshTool{
 				Name:   entry.Name,
-				Status: "failed",
+				Status: "not_allowed",
 			})
 			continue
 		}
 
-		// Update registry entry with new version and mod time
+		oldVersion := entry.Version
+
+		// Take the mod time first, so a binary replaced while it is probed
+		// is refreshed again next time
 		info, _ := os.Stat(entry.Path)
 		var modTime time.Time
 		if info != nil {
 			modTime = info.ModTime()
 		}
 
+		// Probe tool again, from --help if that's where its metadata came from
+		metadata, err := prober.Probe(ctx, entry.Path)
+		if err != nil && entry.Source == "inferred" {
+			if adapted, adaptErr := prober.Adapt(ctx, entry.Path); adaptErr == nil {
+				metadata, err = adapted, nil
+			}
+		} else if err == nil {
+			entry.Source = "native"
+		}
+		if err != nil {
+			refreshed = append(refreshed, RefreshTool{
+				Name:   entry.Name,
+				Status: "failed",
+			})
+			continue
+		}
+
+		// Update registry entry with new version and mod time
 		entry.Version = metadata.Version
-		entry.LastVerified = time.Now()
+		entry.Platform = discovery.Platform(metadata)
+		entry.AtipVersion = metadata.AtipVersion()
+		entry.LastVerified = reg.Now()
 		entry.ModTime = modTime
+		entry.Tags = registry.InferTags(metadata)
 		reg.Add(entry)
 
 		// Update cache (ignore errors - caching is optional)
-		_ = cacheMetadata(ctx, entry, timeout)
+		cacheErr = cacheMetadata(entry, metadata)
 
 		status := "unchanged"
 		if metadata.Version != oldVersion {
@@ -540,89 +1412,1656 @@ func runRefresh(args []string) {
 			Status:     status,
 			OldVersion: oldVersion,
 			NewVersion: metadata.Version,
+			Repaired:   corrupt && cacheErr == nil,
 		})
 	}
 
 	// Save registry
 	if err := reg.Save(); err != nil {
-		exitWithError("Failed to save registry", err)
+		exitWithError(codeRegistrySaveFailed, "Failed to save registry", err)
 	}
 
 	// Prepare result
 	result := struct {
-		Refreshed int           `json:"refreshed"`
-		Tools     []RefreshTool `json:"tools"`
+		Refreshed int                   `json:"refreshed"`
+		Skipped   int                   `json:"skipped"`
+		Tools     []RefreshTool         `json:"tools"`
+		Cache     *registry.PruneResult `json:"cache,omitempty"`
 	}{
 		Refreshed: refreshedCount,
+		Skipped:   skippedCount,
 		Tools:     refreshed,
+		Cache:     pruneCache(reg, cfg),
 	}
 
 	// Write output
-	writer, err := createOutputWriter(*outputFormat)
+	writeOutput(*outputFormat, *outputFile, result)
+}
+
+func runTag(args []string) {
+	fs := flag.NewFlagSet("tag", flag.ExitOnError)
+	outputFormat := fs.String("o", "json", "Output format (json, table, quiet)")
+	addCompactFlag(fs)
+	fs.Parse(args)
+	errorFormat = *outputFormat
+
+	if len(fs.Args()) < 1 {
+		exitWithError(codeInvalidArgument, "tool name required", nil)
+	}
+
+	// Flags may also follow the tool name, e.g. tag gh -o table vcs
+	toolName := fs.Args()[0]
+	fs.Parse(fs.Args()[1:])
+	errorFormat = *outputFormat
+	if len(fs.Args()) < 1 {
+		exitWithError(codeInvalidArgument, "at least one tag required", nil)
+	}
+
+	reg, err := loadRegistry()
 	if err != nil {
-		exitWithError("Invalid output format", err)
+		exitWithError(codeRegistryLoadFailed, "Failed to load registry", err)
 	}
-	writer.Write(result)
+	entry, err := reg.Get(toolName)
+	if err != nil {
+		exitWithError(codeToolNotFound, "Tool not found: "+toolName, nil)
+	}
+	if err := entry.AddTags(fs.Args()...); err != nil {
+		exitWithError(codeInvalidArgument, "Invalid tag", err)
+	}
+	if err := reg.Save(); err != nil {
+		exitWithError(codeRegistrySaveFailed, "Failed to save registry", err)
+	}
+
+	result := struct {
+		Name       string   `json:"name"`
+		Tags       []string `json:"tags"`
+		ManualTags []string `json:"manual_tags"`
+	}{
+		Name:       entry.Name,
+		Tags:       entry.Tags,
+		ManualTags: entry.ManualTags,
+	}
+	writeOutput(*outputFormat, "", result)
 }
 
-func runRegistry(args []string) {
-	// Placeholder for registry subcommands
-	fmt.Fprintf(os.Stderr, "registry command not yet implemented\n")
-	os.Exit(1)
+func runAnnotate(args []string) {
+	fs := flag.NewFlagSet("annotate", flag.ExitOnError)
+	outputFormat := fs.String("o", "json", "Output format (json, table, quiet)")
+	addCompactFlag(fs)
+	fs.Parse(args)
+	errorFormat = *outputFormat
+
+	if len(fs.Args()) < 1 {
+		exitWithError(codeInvalidArgument, "tool name required", nil)
+	}
+
+	// Flags may also follow the tool name, e.g. annotate gh -o table owner=infra
+	toolName := fs.Args()[0]
+	fs.Parse(fs.Args()[1:])
+	errorFormat = *outputFormat
+	if len(fs.Args()) < 1 {
+		exitWithError(codeInvalidArgument, "at least one annotation required (key=value or key-)", nil)
+	}
+
+	reg, err := loadRegistry()
+	if err != nil {
+		exitWithError(codeRegistryLoadFailed, "Failed to load registry", err)
+	}
+	entry, err := reg.Get(toolName)
+	if err != nil {
+		exitWithError(codeToolNotFound, "Tool not found: "+toolName, nil)
+	}
+	if err := entry.Annotate(fs.Args()...); err != nil {
+		exitWithError(codeInvalidArgument, "Invalid annotation", err)
+	}
+	if err := reg.Save(); err != nil {
+		exitWithError(codeRegistrySaveFailed, "Failed to save registry", err)
+	}
+
+	result := struct {
+		Name        string            `json:"name"`
+		Annotations map[string]string `json:"annotations"`
+	}{
+		Name:        entry.Name,
+		Annotations: entry.Annotations,
+	}
+	if result.Annotations == nil {
+		result.Annotations = map[string]string{}
+	}
+	writeOutput(*outputFormat, "", result)
 }
 
-func printUsage() {
-	fmt.Println("Usage: atip-discover [command] [flags]")
-	fmt.Println()
-	fmt.Println("Commands:")
-	fmt.Println("  scan      Scan for ATIP-compatible tools")
-	fmt.Println("  list      List discovered tools")
-	fmt.Println("  get       Get metadata for a specific tool")
-	fmt.Println("  refresh   Refresh cached metadata")
-	fmt.Println("  registry  Manage the registry")
-	fmt.Println()
-	fmt.Println("Flags:")
-	fmt.Println("  -h, --help     Show this help")
-	fmt.Println("  -v, --version  Show version")
-	fmt.Println("  --agent        Output ATIP metadata (for agent discovery)")
+func runDoctor(args []string) {
+	fs := flag.NewFlagSet("doctor", flag.ExitOnError)
+	outputFormat := fs.String("o", "json", "Output format (json, table, quiet)")
+	addCompactFlag(fs)
+	offline := fs.Bool("offline", false, "Skip the sample probe")
+	fs.Parse(args)
+	errorFormat = *outputFormat
+	skipProbe := isOffline(*offline)
+
+	type DirCheck struct {
+		Path     string `json:"path"`
+		Exists   bool   `json:"exists"`
+		Writable bool   `json:"writable"`
+		Error    string `json:"error,omitempty"`
+	}
+
+	type PathCheck struct {
+		Path   string `json:"path"`
+		Safe   bool   `json:"safe"`
+		Reason string `json:"reason,omitempty"`
+	}
+
+	type ProbeCheck struct {
+		Name       string `json:"name"`
+		Path       string `json:"path"`
+		OK         bool   `json:"ok"`
+		Version    string `json:"version,omitempty"`
+		Error      string `json:"error,omitempty"`
+		DurationMs int64  `json:"duration_ms"`
+	}
+
+	type Report struct {
+		Healthy   bool     `json:"healthy"`
+		Problems  []string `json:"problems"`
+		DataDir   DirCheck `json:"data_dir"`
+		ConfigDir DirCheck `json:"config_dir"`
+		CacheDir  DirCheck `json:"cache_dir"`
+		Config    struct {
+			Path  string `json:"path"`
+			Valid bool   `json:"valid"`
+			Error string `json:"error,omitempty"`
+		} `json:"config"`
+		SafePaths []PathCheck `json:"safe_paths"`
+		Registry  struct {
+			Path    string `json:"path"`
+			Entries int    `json:"entries"`
+			Error   string `json:"error,omitempty"`
+		} `json:"registry"`
+		Probe *ProbeCheck `json:"probe,omitempty"`
+	}
+
+	report := Report{Healthy: true, Problems: []string{}}
+	fail := func(problem string) {
+		report.Healthy = false
+		report.Problems = append(report.Problems, problem)
+	}
+
+	checkDir := func(dir string) DirCheck {
+		exists, writable, err := checkWritable(dir)
+		check := DirCheck{Path: dir, Exists: exists, Writable: writable}
+		if err != nil {
+			check.Error = err.Error()
+		}
+		return check
+	}
+
+	// Directories
+	report.DataDir = checkDir(xdg.AgentToolsDataDir())
+	if !report.DataDir.Writable {
+		fail(fmt.Sprintf("data directory is not writable: %s", report.DataDir.Path))
+	}
+	report.ConfigDir = checkDir(xdg.AgentToolsConfigDir())
+	report.CacheDir = checkDir(xdg.AgentToolsCacheDir())
+
+	// Configuration
+	configPath := config.Find(xdg.AgentToolsConfigDir())
+	report.Config.Path = configPath
+	cfg, err := config.Load(configPath)
+	if err == nil {
+		err = cfg.Merge(configEnv(), nil)
+	}
+	if err == nil {
+		err = cfg.Validate()
+	}
+	if err != nil {
+		report.Config.Error = err.Error()
+		fail(fmt.Sprintf("invalid configuration: %v", err))
+		cfg = config.Default()
+	} else {
+		report.Config.Valid = true
+	}
+
+	// Safe paths
+	safePathOpts := discovery.SafePathOptions{
+		TrustedUIDs: cfg.Discovery.TrustedUIDs,
+		TrustedGIDs: cfg.Discovery.TrustedGIDs,
+	}
+	report.SafePaths = []PathCheck{}
+	for _, path := range cfg.Discovery.SafePaths {
+		check := PathCheck{Path: path}
+		check.Safe, err = discovery.IsSafePathWithOptions(path, safePathOpts)
+		if err != nil {
+			check.Reason = err.Error()
+		}
+		report.SafePaths = append(report.SafePaths, check)
+	}
+
+	// Registry
+	report.Registry.Path = filepath.Join(xdg.AgentToolsDataDir(), "registry.json")
+	reg, err := loadRegistry()
+	if err != nil {
+		report.Registry.Error = err.Error()
+		fail(fmt.Sprintf("registry cannot be loaded: %v", err))
+	} else {
+		report.Registry.Entries = len(reg.Tools)
+
+		// Sample probe of the first native tool by name, so repeated runs
+		// probe the same tool whatever order the registry was written in
+		natives, _ := reg.List(registry.ListFilter{Source: "native"})
+		for _, entry := range natives {
+			if skipProbe || !probeAllowed(cfg, entry.Path) {
+				continue
+			}
+			probe := &ProbeCheck{Name: entry.Name, Path: entry.Path}
+			start := time.Now()
+			prober := discovery.NewProber(cfg.Discovery.ScanTimeout, nil)
+			prober.SetTimeouts(cfg.Discovery.Timeouts)
+			metadata, err := prober.Probe(context.Background(), entry.Path)
+			probe.DurationMs = time.Since(start).Milliseconds()
+			if err != nil {
+				probe.Error = err.Error()
+			} else {
+				probe.OK = true
+				probe.Version = metadata.Version
+			}
+			report.Probe = probe
+			break
+		}
+	}
+
+	writer, err := createOutputWriter(*outputFormat)
+	if err != nil {
+		exitWithError(codeInvalidOutputFormat, "Invalid output format", err)
+	}
+	writer.Write(report)
+
+	if !report.Healthy {
+		os.Exit(1)
+	}
 }
 
-func exitWithError(msg string, err error) {
-	fmt.Fprintf(os.Stderr, "Error: %s: %v\n", msg, err)
-	os.Exit(1)
+// checkWritable reports whether dir exists and whether files can be created in it.
+// If dir does not exist, writability is checked on its nearest existing ancestor,
+// since the directory would be created there.
+func checkWritable(dir string) (exists bool, writable bool, err error) {
+	target := dir
+	for {
+		info, statErr := os.Stat(target)
+		if statErr == nil {
+			if !info.IsDir() {
+				return false, false, fmt.Errorf("%s is not a directory", target)
+			}
+			break
+		}
+		if !os.IsNotExist(statErr) {
+			return false, false, statErr
+		}
+		parent := filepath.Dir(target)
+		if parent == target {
+			return false, false, statErr
+		}
+		target = parent
+	}
+	exists = target == dir
+
+	f, err := os.CreateTemp(target, ".atip-doctor-*")
+	if err != nil {
+		return exists, false, err
+	}
+	f.Close()
+	os.Remove(f.Name())
+
+	return exists, true, nil
 }
 
-// loadRegistry loads the registry from the standard location
-func loadRegistry() (*registry.Registry, error) {
-	dataDir := xdg.AgentToolsDataDir()
-	registryPath := filepath.Join(dataDir, "registry.json")
-	return registry.Load(registryPath, dataDir)
+func runCache(args []string) {
+	if len(args) == 0 || args[0] != "prune" {
+		fmt.Fprintf(os.Stderr, "Usage: atip-discover cache prune [-o format]\n")
+		os.Exit(2)
+	}
+
+	fs := flag.NewFlagSet("cache prune", flag.ExitOnError)
+	outputFormat := fs.String("o", "json", "Output format (json, table, quiet)")
+	addCompactFlag(fs)
+	fs.Parse(args[1:])
+	errorFormat = *outputFormat
+
+	reg, err := loadRegistry()
+	if err != nil {
+		exitWithError(codeRegistryLoadFailed, "Failed to load registry", err)
+	}
+
+	cfg := loadConfig()
+	result, err := reg.PruneCache(xdg.AgentToolsCacheDir(), cfg.Cache.MaxAge, int64(cfg.Cache.MaxSizeMB)*1024*1024)
+	if err != nil {
+		exitWithError(codeCachePruneFailed, "Failed to prune cache", err)
+	}
+
+	writer, err := createOutputWriter(*outputFormat)
+	if err != nil {
+		exitWithError(codeInvalidOutputFormat, "Invalid output format", err)
+	}
+	writer.Write(result)
 }
 
-// createOutputWriter creates an output writer for the given format
-func createOutputWriter(format string) (output.Writer, error) {
-	return output.NewWriter(output.Format(format), os.Stdout)
+func runConfig(args []string) {
+	if len(args) == 0 || (args[0] != "show" && args[0] != "validate") {
+		fmt.Fprintf(os.Stderr, "Usage: atip-discover config show|validate [flags]\n")
+		os.Exit(2)
+	}
+	subcommand := args[0]
+
+	fs := flag.NewFlagSet("config "+subcommand, flag.ExitOnError)
+	outputFormat := fs.String("o", "json", "Output format (json, table, quiet)")
+	addCompactFlag(fs)
+	verbose := fs.Bool("v", false, "Show the source of each value")
+	timeoutStr := fs.String("timeout", "", "Override the probe timeout")
+	parallelism := fs.Int("parallel", 0, "Override the number of parallel probes")
+	var skipList listFlag
+	fs.Var(&skipList, "skip", "Tool to skip, in addition to discovery.skip_list (can be repeated)")
+	skipFile := fs.String("skip-file", "", "Override the skip file")
+	fs.Parse(args[1:])
+	errorFormat = *outputFormat
+
+	// Only flags given on the command line take part in the merge
+	flags := make(map[string]interface{})
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "timeout":
+			flags["timeout"] = *timeoutStr
+		case "parallel":
+			flags["parallel"] = *parallelism
+		case "skip":
+			flags["skip"] = splitDeprecated("skip", skipList, nil)
+		case "skip-file":
+			flags["skip-file"] = *skipFile
+		}
+	})
+
+	writer, err := createOutputWriter(*outputFormat)
+	if err != nil {
+		exitWithError(codeInvalidOutputFormat, "Invalid output format", err)
+	}
+
+	configPath := config.Find(xdg.AgentToolsConfigDir())
+	cfg, sources, err := config.Resolve(configPath, configEnv(), flags)
+	if err == nil && subcommand == "validate" {
+		err = cfg.Validate()
+	}
+
+	if subcommand == "validate" {
+		result := struct {
+			Path  string `json:"path"`
+			Valid bool   `json:"valid"`
+			Error string `json:"error,omitempty"`
+		}{Path: configPath, Valid: err == nil}
+		if err != nil {
+			result.Error = err.Error()
+		}
+		writer.Write(result)
+		if err != nil {
+			os.Exit(1)
+		}
+		return
+	}
+
+	if err != nil {
+		exitWithError(codeInvalidConfig, "Invalid configuration", err)
+	}
+	if *verbose {
+		writer.Write(struct {
+			Path    string                   `json:"path"`
+			Config  *config.Config           `json:"config"`
+			Sources map[string]config.Source `json:"sources"`
+		}{configPath, cfg, sources})
+		return
+	}
+	writer.Write(cfg)
 }
 
-// cacheMetadata saves tool metadata to the cache
-func cacheMetadata(ctx context.Context, tool *registry.RegistryEntry, timeout time.Duration) error {
-	dataDir := xdg.AgentToolsDataDir()
-	cachePath := filepath.Join(dataDir, "tools", tool.Name+".json")
+// Info describes the build and the environment it runs in.
+type Info struct {
+	Version         string `json:"version"`
+	GoVersion       string `json:"go_version"`
+	BuildDate       string `json:"build_date"`
+	Commit          string `json:"commit"`
+	Platform        string `json:"platform"`
+	DataDir         string `json:"data_dir"`
+	ConfigDir       string `json:"config_dir"`
+	CacheDir        string `json:"cache_dir"`
+	ConfigPath      string `json:"config_path"`
+	RegistryEntries int    `json:"registry_entries"`
+	RegistryError   string `json:"registry_error,omitempty"`
+}
 
-	if err := os.MkdirAll(filepath.Dir(cachePath), 0755); err != nil {
-		return err
+// buildInfo gathers the build variables and resolved directories. A
+// registry that can't be loaded is reported rather than fatal.
+func buildInfo() Info {
+	info := Info{
+		Version:    Version,
+		GoVersion:  GoVersion,
+		BuildDate:  BuildDate,
+		Commit:     Commit,
+		Platform:   discovery.HostPlatform(),
+		DataDir:    xdg.AgentToolsDataDir(),
+		ConfigDir:  xdg.AgentToolsConfigDir(),
+		CacheDir:   xdg.AgentToolsCacheDir(),
+		ConfigPath: config.Find(xdg.AgentToolsConfigDir()),
+	}
+	if info.GoVersion == "unknown" {
+		info.GoVersion = runtime.Version()
 	}
 
-	prober := discovery.NewProber(timeout)
-	metadata, err := prober.Probe(ctx, tool.Path)
+	reg, err := loadRegistry()
 	if err != nil {
+		info.RegistryError = err.Error()
+	} else {
+		info.RegistryEntries = len(reg.Tools)
+	}
+	return info
+}
+
+func runInfo(args []string) {
+	fs := flag.NewFlagSet("info", flag.ExitOnError)
+	outputFormat := fs.String("o", "json", "Output format (json, table, quiet)")
+	addCompactFlag(fs)
+	outputFile := fs.String("output-file", "", "Write output to this file instead of stdout")
+	fs.Parse(args)
+	errorFormat = *outputFormat
+
+	writeOutput(*outputFormat, *outputFile, buildInfo())
+}
+
+// runVersion prints the version line, or with -o the same information
+// as info.
+func runVersion(args []string) {
+	fs := flag.NewFlagSet("--version", flag.ExitOnError)
+	outputFormat := fs.String("o", "", "Output format (json, table, quiet)")
+	addCompactFlag(fs)
+	fs.Parse(args)
+
+	if *outputFormat == "" {
+		fmt.Printf("atip-discover %s\n", Version)
+		return
+	}
+	errorFormat = *outputFormat
+	writeOutput(*outputFormat, "", buildInfo())
+}
+
+func runSchema(args []string) {
+	if len(args) > 0 && args[0] == "validate" {
+		runSchemaValidate(args[1:])
+		return
+	}
+
+	fs := flag.NewFlagSet("schema", flag.ExitOnError)
+	version := fs.String("version", validator.SchemaVersion, "ATIP version of the schema")
+	fs.Parse(args)
+
+	schema, err := validator.Schema(*version)
+	if err != nil {
+		exitWithError(codeInvalidArgument, "Unknown schema version", err)
+	}
+	os.Stdout.Write(schema)
+}
+
+func runSchemaValidate(args []string) {
+	fs := flag.NewFlagSet("schema validate", flag.ExitOnError)
+	version := fs.String("version", validator.SchemaVersion, "ATIP version of the schema")
+	outputFormat := fs.String("o", "json", "Output format (json, table, quiet)")
+	addCompactFlag(fs)
+	allErrors := fs.Bool("json-schema-errors", false, "Report every validation error, not just the first")
+	policyFile := fs.String("policy", "", "Policy file of extra rules the metadata must pass")
+	strictVersion := fs.Bool("strict-version", false, "Require the version to be a semantic version (a leading v is accepted)")
+	fs.Parse(args)
+	errorFormat = *outputFormat
+
+	if len(fs.Args()) < 1 {
+		exitWithError(codeInvalidArgument, "metadata file required", nil)
+	}
+	path := fs.Args()[0]
+
+	if _, err := validator.Schema(*version); err != nil {
+		exitWithError(codeInvalidArgument, "Unknown schema version", err)
+	}
+	writer, err := createOutputWriter(*outputFormat)
+	if err != nil {
+		exitWithError(codeInvalidOutputFormat, "Invalid output format", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		exitWithError(codeInvalidArgument, "Failed to read metadata file", err)
+	}
+
+	v, err := validator.Default()
+	if err != nil {
+		exitWithError(codeInternal, "Failed to load schema", err)
+	}
+	if *policyFile != "" {
+		if v, err = validator.NewWithPolicy(xdg.ExpandTilde(*policyFile)); err != nil {
+			exitWithError(codeInvalidConfig, "Failed to load policy", err)
+		}
+	}
+
+	// Errors are classified like the scanner's probe failures
+	var errs []error
+	if *allErrors {
+		verrs, err := v.ValidateAll(data)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%w: %w", discovery.ErrInvalidJSON, err))
+		}
+		for i := range verrs {
+			errs = append(errs, fmt.Errorf("%w: %v", discovery.ErrValidation, &verrs[i]))
+		}
+		if *strictVersion && err == nil {
+			if metadata, err := validator.ParseJSON(data); err == nil && metadata.Version != "" {
+				if _, verr := validator.NormalizeVersion(metadata.Version); verr != nil {
+					errs = append(errs, fmt.Errorf("%w: %v", discovery.ErrValidation, verr))
+				}
+			}
+		}
+	} else if metadata, err := validator.ParseJSON(data); err != nil {
+		errs = append(errs, fmt.Errorf("%w: %w", discovery.ErrInvalidJSON, err))
+	} else {
+		validate := v.ValidateMetadata
+		if *strictVersion {
+			validate = v.ValidateMetadataStrict
+		}
+		if verr := validate(metadata); verr != nil {
+			errs = append(errs, fmt.Errorf("%w: %v", discovery.ErrValidation, verr))
+		}
+	}
+
+	result := struct {
+		Path    string                `json:"path"`
+		Version string                `json:"version"`
+		Valid   bool                  `json:"valid"`
+		Errors  []discovery.ScanError `json:"errors"`
+	}{Path: path, Version: *version, Valid: len(errs) == 0, Errors: []discovery.ScanError{}}
+	for _, err := range errs {
+		result.Errors = append(result.Errors, discovery.ScanError{
+			Path:  path,
+			Kind:  discovery.ErrorKind(err),
+			Error: err.Error(),
+		})
+	}
+	writer.Write(result)
+	if len(errs) > 0 {
+		os.Exit(1)
+	}
+}
+
+func runRegistry(args []string) {
+	if len(args) == 0 {
+		exitWithError(codeInvalidArgument, "registry subcommand required (diff|export|import|load-shims)", nil)
+	}
+	switch args[0] {
+	case "diff":
+		runRegistryDiff(args[1:])
+	case "export":
+		runRegistryExport(args[1:])
+	case "import":
+		runRegistryImport(args[1:])
+	case "load-shims":
+		runRegistryLoadShims(args[1:])
+	default:
+		exitWithError(codeInvalidArgument, fmt.Sprintf("Unknown registry subcommand %q (want diff|export|import|load-shims)", args[0]), nil)
+	}
+}
+
+func runRegistryDiff(args []string) {
+	fs := flag.NewFlagSet("registry diff", flag.ExitOnError)
+	outputFormat := fs.String("o", "json", "Output format (json, table, quiet)")
+	addCompactFlag(fs)
+	outputFile := fs.String("output-file", "", "Write output to this file instead of stdout")
+	timeoutStr := fs.String("timeout", "30s", "Timeout for fetching the remote catalog")
+	offline := fs.Bool("offline", false, "Refuse network access (registry diff fails)")
+	fs.Parse(args)
+	errorFormat = *outputFormat
+
+	if isOffline(*offline) {
+		exitWithError(codeOffline, "registry diff fetches a remote catalog, which offline mode forbids", nil)
+	}
+
+	if len(fs.Args()) < 1 {
+		exitWithError(codeInvalidArgument, "registry URL required", nil)
+	}
+	registryURL := fs.Args()[0]
+
+	timeout, err := time.ParseDuration(*timeoutStr)
+	if err != nil {
+		exitWithError(codeInvalidTimeout, "Invalid timeout", err)
+	}
+
+	reg, err := loadRegistry()
+	if err != nil {
+		exitWithError(codeRegistryLoadFailed, "Failed to load registry", err)
+	}
+
+	// Revalidate the catalog cached by the last diff instead of downloading it
+	client := newRemoteClient(timeout)
+	cached, err := client.FetchCatalogCached(context.Background(), registryURL)
+	if err != nil {
+		exitWithError(codeRegistryFetchFailed, "Failed to fetch catalog from "+registryURL, err)
+	}
+	diff, upToDate := cached.DiffLocal(reg.Tools)
+
+	// Caching is optional, so a failed save only costs a full fetch next time
+	_ = client.SaveCatalog(registryURL, cached)
+
+	// Version and Source fill the table's columns
+	type DiffTool struct {
+		remote.DiffEntry
+		Version string `json:"-"`
+		Source  string `json:"-"`
+	}
+
+	result := struct {
+		Registry  string     `json:"registry"`
+		UpToDate  bool       `json:"up_to_date"` // Catalog and local tools unchanged since the last diff
+		Missing   int        `json:"missing"`
+		Outdated  int        `json:"outdated"`
+		LocalOnly int        `json:"local_only"`
+		Tools     []DiffTool `json:"tools"`
+	}{Registry: registryURL, UpToDate: upToDate, Tools: []DiffTool{}}
+
+	for _, entry := range diff {
+		tool := DiffTool{DiffEntry: entry, Source: entry.Status}
+		switch entry.Status {
+		case remote.StatusMissing:
+			result.Missing++
+			tool.Version = entry.RemoteVersion
+		case remote.StatusOutdated:
+			result.Outdated++
+			tool.Version = entry.LocalVersion + " -> " + entry.RemoteVersion
+		case remote.StatusLocalOnly:
+			result.LocalOnly++
+			tool.Version = entry.LocalVersion
+		}
+		result.Tools = append(result.Tools, tool)
+	}
+
+	writeOutput(*outputFormat, *outputFile, result)
+}
+
+func runRegistryExport(args []string) {
+	fs := flag.NewFlagSet("registry export", flag.ExitOnError)
+	ndjson := fs.Bool("ndjson", false, "Write one registry entry per line (JSON Lines)")
+	includeMetadata := fs.Bool("include-metadata", false, "Include each tool's cached metadata")
+	addCompactFlag(fs)
+	fs.Parse(args)
+
+	// Flags may also follow the file, e.g. registry export tools.ndjson --ndjson
+	var path string
+	if fs.NArg() > 0 {
+		path = fs.Arg(0)
+		fs.Parse(fs.Args()[1:])
+	}
+
+	reg, err := loadRegistry()
+	if err != nil {
+		exitWithError(codeRegistryLoadFailed, "Failed to load registry", err)
+	}
+
+	records := make([]*registry.Record, 0, len(reg.Tools))
+	for _, entry := range reg.Tools {
+		record := &registry.Record{RegistryEntry: *entry}
+		if *includeMetadata {
+			data, err := readCachedMetadata(entry)
+			if err == nil {
+				record.Metadata = data
+			} else if !os.IsNotExist(err) {
+				fmt.Fprintf(os.Stderr, "Warning: Exporting %s without metadata: %v\n", entry.Name, err)
+			}
+		}
+		records = append(records, record)
+	}
+
+	writeOutputTo(path, func(w io.Writer) error {
+		if *ndjson {
+			enc := json.NewEncoder(w)
+			for _, record := range records {
+				if err := enc.Encode(record); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		writer, _ := newWriter(string(output.FormatJSON), w)
+		return writer.Write(registry.Export{Version: reg.Version, LastScan: reg.LastScan, Tools: records})
+	})
+}
+
+func runRegistryImport(args []string) {
+	fs := flag.NewFlagSet("registry import", flag.ExitOnError)
+	outputFormat := fs.String("o", "json", "Output format (json, table, quiet)")
+	addCompactFlag(fs)
+	strict := fs.Bool("strict", false, "Import nothing if any line is invalid")
+	replace := fs.Bool("replace", false, "Replace the registry instead of merging into it")
+	fs.Parse(args)
+	errorFormat = *outputFormat
+
+	if fs.NArg() < 1 {
+		exitWithError(codeInvalidArgument, "import file required", nil)
+	}
+
+	// Flags may also follow the file, e.g. registry import tools.ndjson --strict
+	path := fs.Arg(0)
+	fs.Parse(fs.Args()[1:])
+	errorFormat = *outputFormat
+
+	var data []byte
+	var err error
+	if path == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		exitWithError(codeInvalidImport, "Failed to read import", err)
+	}
+
+	v, err := validator.Default()
+	if err != nil {
+		exitWithError(codeInternal, "Failed to load schema", err)
+	}
+	records, errs := registry.ParseImport(data, v)
+	if *strict && len(errs) > 0 {
+		msg := fmt.Sprintf("line %d: %s", errs[0].Line, errs[0].Error)
+		if len(errs) > 1 {
+			msg += fmt.Sprintf(" (and %d more invalid lines)", len(errs)-1)
+		}
+		exitWithError(codeInvalidImport, "Nothing imported, "+msg, nil)
+	}
+
+	reg, err := loadRegistry()
+	if err != nil {
+		exitWithError(codeRegistryLoadFailed, "Failed to load registry", err)
+	}
+	if *replace {
+		reg.Tools = nil
+	}
+
+	shadowed := 0
+	for _, record := range records {
+		entry := record.RegistryEntry
+		if errors.Is(reg.Add(&entry), registry.ErrShadowed) {
+			shadowed++
+			continue
+		}
+		if record.Metadata != nil {
+			// Caching is optional, so the tool is imported without it
+			if err := writeCachedMetadata(&entry, record.Metadata); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: Failed to cache metadata for %s: %v\n", entry.Name, err)
+			}
+		}
+	}
+
+	if err := reg.Save(); err != nil {
+		exitWithError(codeRegistrySaveFailed, "Failed to save registry", err)
+	}
+
+	if errs == nil {
+		errs = []registry.ImportError{}
+	}
+	result := struct {
+		Imported int                    `json:"imported"`
+		Shadowed int                    `json:"shadowed"`
+		Failed   int                    `json:"failed"`
+		Errors   []registry.ImportError `json:"errors"`
+	}{
+		Imported: len(records) - shadowed,
+		Shadowed: shadowed,
+		Failed:   len(errs),
+		Errors:   errs,
+	}
+	writeOutput(*outputFormat, "", result)
+}
+
+func runRegistryLoadShims(args []string) {
+	fs := flag.NewFlagSet("registry load-shims", flag.ExitOnError)
+	outputFormat := fs.String("o", "json", "Output format (json, table, quiet)")
+	addCompactFlag(fs)
+	preferShims := fs.Bool("prefer-shims", false, "Let shims replace native tools of the same name")
+	fs.Parse(args)
+	errorFormat = *outputFormat
+
+	reg, err := loadRegistry()
+	if err != nil {
+		exitWithError(codeRegistryLoadFailed, "Failed to load registry", err)
+	}
+
+	result, err := loadShims(reg, *preferShims)
+	if err != nil {
+		exitWithError(codeRegistryLoadFailed, "Failed to load shims", err)
+	}
+
+	if err := reg.Save(); err != nil {
+		exitWithError(codeRegistrySaveFailed, "Failed to save registry", err)
+	}
+	writeOutput(*outputFormat, "", result)
+}
+
+func runServe(args []string) {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	stdio := fs.Bool("stdio", false, "Answer line-delimited JSON requests on stdin with responses on stdout")
+	offline := fs.Bool("offline", false, "Refuse scan requests, which probe executables")
+	fs.Parse(args)
+
+	if !*stdio {
+		exitWithError(codeInvalidArgument, "serve requires --stdio", nil)
+	}
+
+	// Ensure data and cache directories exist, for scans
+	if err := xdg.EnsureDataDirs(); err != nil {
+		exitWithError(codeDataDirFailed, "Failed to create data directories", err)
+	}
+	if err := xdg.EnsureCacheDirs(); err != nil {
+		exitWithError(codeDataDirFailed, "Failed to create cache directories", err)
+	}
+
+	cfg := loadConfig()
+	if err := cfg.Merge(configEnv(), nil); err != nil {
+		exitWithError(codeInvalidConfig, "Invalid environment configuration", err)
+	}
+
+	// The registry stays loaded between requests
+	reg, err := loadRegistry()
+	if err != nil {
+		exitWithError(codeRegistryLoadFailed, "Failed to load registry", err)
+	}
+
+	s := &stdioServer{reg: reg, cfg: cfg, offline: isOffline(*offline)}
+	server := rpc.NewServer()
+	server.Handle("list", s.list)
+	server.Handle("get", s.get)
+	server.Handle("search", s.search)
+	server.Handle("scan", s.scan)
+	if err := server.Serve(os.Stdin, os.Stdout); err != nil {
+		exitWithError(codeInternal, "Serve failed", err)
+	}
+}
+
+// stdioServer answers serve --stdio requests from a registry loaded once.
+// Requests are answered one at a time, so handlers don't lock it.
+type stdioServer struct {
+	reg     *registry.Registry
+	cfg     *config.Config
+	offline bool // Refuse scans
+}
+
+// list answers a list request like the list command with the same filters.
+func (s *stdioServer) list(params json.RawMessage) (interface{}, error) {
+	var p struct {
+		Pattern     string   `json:"pattern"`
+		Source      string   `json:"source"`
+		Platform    string   `json:"platform"`
+		Tag         string   `json:"tag"`
+		Annotations []string `json:"annotations"`
+		Sort        string   `json:"sort"`
+		Effects     bool     `json:"effects"`
+	}
+	if err := rpc.DecodeParams(params, &p); err != nil {
+		return nil, err
+	}
+	if p.Sort == "" {
+		p.Sort = registry.SortByName
+	}
+
+	tools, err := s.reg.List(registry.ListFilter{Pattern: p.Pattern, Source: p.Source, Platform: p.Platform, Tag: p.Tag})
+	if err != nil {
+		return nil, rpc.Errorf(codeInvalidArgument, "Failed to list tools: %v", err)
+	}
+	if tools, err = registry.FilterByAnnotations(tools, p.Annotations); err != nil {
+		return nil, rpc.Errorf(codeInvalidArgument, "Invalid annotations: %v", err)
+	}
+	if err := registry.SortEntries(tools, p.Sort); err != nil {
+		return nil, rpc.Errorf(codeInvalidArgument, "Invalid sort: %v", err)
+	}
+	toolInfos := describeTools(tools, p.Effects)
+	return listResult{Count: len(toolInfos), Tools: toolInfos}, nil
+}
+
+// get answers a get request with a tool's cached metadata and its ETag.
+// With if_none_match, metadata whose ETag matches is left out and
+// not_modified set instead, as get --if-none-match exits 5.
+func (s *stdioServer) get(params json.RawMessage) (interface{}, error) {
+	var p struct {
+		Name        string `json:"name"`
+		IfNoneMatch string `json:"if_none_match"`
+	}
+	if err := rpc.DecodeParams(params, &p); err != nil {
+		return nil, err
+	}
+	if p.Name == "" {
+		return nil, rpc.Errorf(codeInvalidArgument, "tool name required")
+	}
+
+	entry, err := s.reg.Get(p.Name)
+	if err != nil {
+		return nil, rpc.Errorf(codeToolNotFound, "Tool not found: %s", p.Name)
+	}
+	data, err := readCachedMetadata(entry)
+	if errors.Is(err, registry.ErrCorruptMetadata) {
+		return nil, rpc.Errorf(codeCacheCorrupt, "Cached metadata for %s is corrupt; run 'atip-discover refresh --repair-cache': %v", p.Name, err)
+	}
+	if err == nil && !json.Valid(data) {
+		err = errors.New("invalid JSON")
+	}
+	if err != nil {
+		return nil, rpc.Errorf(codeMetadataUnavailable, "Failed to load tool metadata: %v", err)
+	}
+
+	result := struct {
+		Name        string          `json:"name"`
+		ETag        string          `json:"etag"`
+		NotModified bool            `json:"not_modified,omitempty"`
+		Metadata    json.RawMessage `json:"metadata,omitempty"`
+	}{Name: p.Name, ETag: registry.MetadataDigest(data)}
+	if p.IfNoneMatch != "" && etagMatches(p.IfNoneMatch, result.ETag) {
+		result.NotModified = true
+	} else {
+		result.Metadata = data
+	}
+	return result, nil
+}
+
+// search answers a search request with the tools whose name, description
+// or tags contain every word of the query, ignoring case, as list reports
+// them.
+func (s *stdioServer) search(params json.RawMessage) (interface{}, error) {
+	var p struct {
+		Query string `json:"query"`
+	}
+	if err := rpc.DecodeParams(params, &p); err != nil {
+		return nil, err
+	}
+	terms := strings.Fields(strings.ToLower(p.Query))
+	if len(terms) == 0 {
+		return nil, rpc.Errorf(codeInvalidArgument, "query required")
+	}
+
+	tools, err := s.reg.List(registry.ListFilter{})
+	if err != nil {
+		return nil, rpc.Errorf(codeInternal, "Failed to list tools: %v", err)
+	}
+	matches := []listedTool{}
+	for _, tool := range describeTools(tools, false) {
+		text := strings.ToLower(strings.Join(append([]string{tool.Name, tool.Description}, tool.Tags...), " "))
+		matched := true
+		for _, term := range terms {
+			if !strings.Contains(text, term) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			matches = append(matches, tool)
+		}
+	}
+	return listResult{Count: len(matches), Tools: matches}, nil
+}
+
+// scan answers a scan request by scanning like the scan command, with the
+// configured safe paths unless paths are given, and recording the result
+// in the registry. Paths that fail the safe path check are always skipped
+// and listed in skipped_paths.
+func (s *stdioServer) scan(params json.RawMessage) (interface{}, error) {
+	var p struct {
+		Paths      []string `json:"paths"`
+		MaxDepth   int      `json:"max_depth"`
+		Timeout    string   `json:"timeout"`
+		Parallel   int      `json:"parallel"`
+		Prune      bool     `json:"prune"`
+		ErrorKinds string   `json:"error_kinds"`
+	}
+	if err := rpc.DecodeParams(params, &p); err != nil {
+		return nil, err
+	}
+	if s.offline {
+		return nil, rpc.Errorf(codeOffline, "scan probes executables, which offline mode forbids")
+	}
+
+	discoveryCfg := s.cfg.Discovery
+	if p.Timeout != "" {
+		d, err := time.ParseDuration(p.Timeout)
+		if err == nil && d <= 0 {
+			err = fmt.Errorf("%s is not positive", p.Timeout)
+		}
+		if err != nil {
+			return nil, rpc.Errorf(codeInvalidTimeout, "Invalid timeout: %v", err)
+		}
+		discoveryCfg.ScanTimeout = d
+	}
+	if p.Parallel > 0 {
+		discoveryCfg.Parallelism = p.Parallel
+	}
+	if p.MaxDepth < 0 {
+		return nil, rpc.Errorf(codeInvalidArgument, "Invalid max_depth: %d is negative", p.MaxDepth)
+	}
+	errorKinds, err := parseErrorKinds(p.ErrorKinds)
+	if err != nil {
+		return nil, rpc.Errorf(codeInvalidArgument, "Invalid error_kinds: %v", err)
+	}
+
+	scanner, rerr := newScanner(discoveryCfg, max(p.MaxDepth, 1))
+	if rerr != nil {
+		return nil, rerr
+	}
+
+	paths := p.Paths
+	if len(paths) == 0 {
+		paths = discoveryCfg.ScanPaths()
+	}
+	for i, path := range paths {
+		paths[i] = xdg.ExpandTilde(path)
+	}
+	safePaths, skippedPaths := checkScanPaths(paths, safePathOptions(discoveryCfg), true, nil)
+
+	existingRegistry := make(map[string]time.Time)
+	for _, entry := range s.reg.Tools {
+		existingRegistry[entry.Path] = entry.ModTime
+	}
+	result, err := scanner.Scan(context.Background(), safePaths, true, existingRegistry)
+	if err != nil {
+		return nil, rpc.Errorf(codeScanFailed, "Scan failed: %v", err)
+	}
+	recordScan(s.reg, result, p.Prune)
+	s.reg.LastScan = s.reg.Now()
+	if err := s.reg.Save(); err != nil {
+		return nil, rpc.Errorf(codeRegistrySaveFailed, "Failed to save registry: %v", err)
+	}
+	result.FilterErrors(errorKinds)
+
+	return struct {
+		*discovery.ScanResult
+		SkippedPaths []string `json:"skipped_paths"`
+	}{result, skippedPaths}, nil
+}
+
+func printUsage() {
+	fmt.Println("Usage: atip-discover [command] [flags]")
+	fmt.Println()
+	fmt.Println("Commands:")
+	fmt.Println("  scan      Scan for ATIP-compatible tools")
+	fmt.Println("  list      List discovered tools")
+	fmt.Println("  get       Get metadata for a specific tool")
+	fmt.Println("  refresh   Refresh cached metadata")
+	fmt.Println("  tag       Tag a tool for list --tag")
+	fmt.Println("  annotate  Set or remove key=value annotations on a tool")
+	fmt.Println("  doctor    Diagnose the discovery environment")
+	fmt.Println("  cache     Prune cached metadata (cache prune)")
+	fmt.Println("  config    Show or validate the effective configuration")
+	fmt.Println("  registry  Compare with a remote catalog, export, import or load shims (registry diff|export|import|load-shims)")
+	fmt.Println("  schema    Print the ATIP JSON Schema or validate metadata against it")
+	fmt.Println("  info      Show build and environment information")
+	fmt.Println("  serve     Answer list, get, search and scan requests on stdin (serve --stdio)")
+	fmt.Println()
+	fmt.Println("Flags:")
+	fmt.Println("  -h, --help     Show this help")
+	fmt.Println("  -v, --version  Show version (--version -o json for build information)")
+	fmt.Println("  --agent        Output ATIP metadata (for agent discovery)")
+}
+
+// Error codes reported in the JSON error envelope. They are part of the
+// output contract, so existing codes must not be renamed.
+const (
+	codeInvalidArgument     = "INVALID_ARGUMENT"
+	codeInvalidOutputFormat = "INVALID_OUTPUT_FORMAT"
+	codeInvalidTimeout      = "INVALID_TIMEOUT"
+	codeInvalidConfig       = "INVALID_CONFIG"
+	codeInvalidSkipList     = "INVALID_SKIP_LIST"
+	codeOutputFileFailed    = "OUTPUT_FILE_FAILED"
+	codeOffline             = "OFFLINE"
+	codeToolNotFound        = "TOOL_NOT_FOUND"
+	codeMetadataUnavailable = "METADATA_UNAVAILABLE"
+	codeCacheCorrupt        = "CACHE_CORRUPT"
+	codeInvalidImport       = "INVALID_IMPORT"
+	codeRegistryLoadFailed  = "REGISTRY_LOAD_FAILED"
+	codeRegistrySaveFailed  = "REGISTRY_SAVE_FAILED"
+	codeRegistryFetchFailed = "REGISTRY_FETCH_FAILED"
+	codeDataDirFailed       = "DATA_DIR_FAILED"
+	codeCachePruneFailed    = "CACHE_PRUNE_FAILED"
+	codeScanFailed          = "SCAN_FAILED"
+	codeNotATerminal        = "NOT_A_TERMINAL"
+	codeInternal            = "INTERNAL_ERROR"
+)
+
+// errorExitCodes maps error codes to process exit codes: 1 for a missing
+// tool, 2 for input, configuration and registry errors, 3 for fatal errors.
+var errorExitCodes = map[string]int{
+	codeInvalidArgument:     2,
+	codeInvalidOutputFormat: 2,
+	codeInvalidTimeout:      2,
+	codeInvalidConfig:       2,
+	codeInvalidSkipList:     2,
+	codeOutputFileFailed:    2,
+	codeOffline:             2,
+	codeToolNotFound:        1,
+	codeMetadataUnavailable: 2,
+	codeCacheCorrupt:        2,
+	codeInvalidImport:       2,
+	codeRegistryLoadFailed:  2,
+	codeRegistrySaveFailed:  3,
+	codeRegistryFetchFailed: 2,
+	codeDataDirFailed:       3,
+	codeCachePruneFailed:    3,
+	codeScanFailed:          3,
+	codeNotATerminal:        2,
+	codeInternal:            3,
+}
+
+// Exit codes of a completed scan run with --fail-if-none or --fail-on-error.
+const (
+	exitNoneFound     = 3
+	exitProbeFailures = 4
+)
+
+// exitNotModified is the exit code of get --if-none-match when the
+// metadata's ETag matches, like HTTP's 304 Not Modified.
+const exitNotModified = 5
+
+// etagMatches reports whether etag is in ifNoneMatch, a comma-separated
+// list of ETags as in HTTP's If-None-Match: quotes and a weak "W/" prefix
+// are ignored, and "*" matches any ETag.
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.Trim(strings.TrimPrefix(strings.TrimSpace(candidate), "W/"), `"`)
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// errorFormat is the output format of the running command. With json or
+// ndjson, exitWithError writes the error envelope to stdout instead of text
+// to stderr, on a single line for ndjson.
+var errorFormat string
+
+// compactJSON is set by --compact to write json output on a single line.
+var compactJSON bool
+
+// wideTable is set by list --wide to write table output with every column.
+var wideTable bool
+
+// addCompactFlag registers --compact on a command's flags.
+func addCompactFlag(fs *flag.FlagSet) {
+	fs.BoolVar(&compactJSON, "compact", false, "Write JSON output on a single line, without indentation")
+}
+
+// newWriter returns the writer for an output format: compact JSON for json
+// with --compact, else output.NewWriter's.
+func newWriter(format string, w io.Writer) (output.Writer, error) {
+	if compactJSON && output.Format(format) == output.FormatJSON {
+		return output.NewCompactJSONWriter(w), nil
+	}
+	if wideTable && output.Format(format) == output.FormatTable {
+		return output.NewWideTableWriter(w), nil
+	}
+	return output.NewWriter(output.Format(format), w)
+}
+
+// exitWithError reports a failure and exits with the code's exit status.
+// err may be nil when msg says it all.
+func exitWithError(code, msg string, err error) {
+	if err != nil {
+		msg = fmt.Sprintf("%s: %v", msg, err)
+	}
+
+	if errorFormat == string(output.FormatJSON) || errorFormat == string(output.FormatNDJSON) {
+		envelope := map[string]interface{}{
+			"error": map[string]string{
+				"code":    code,
+				"message": msg,
+			},
+		}
+		writer, _ := newWriter(errorFormat, os.Stdout)
+		writer.Write(envelope)
+	} else {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", msg)
+	}
+
+	exitCode, ok := errorExitCodes[code]
+	if !ok {
+		exitCode = 3
+	}
+	os.Exit(exitCode)
+}
+
+// configEnv returns the environment variables that override configuration
+func configEnv() map[string]string {
+	env := make(map[string]string)
+	for _, name := range config.EnvVars() {
+		env[name] = os.Getenv(name)
+	}
+	return env
+}
+
+// isOffline reports whether offline mode is on, via --offline or the
+// ATIP_DISCOVER_OFFLINE environment variable. In offline mode nothing is
+// executed and nothing is fetched; only the registry and cache are read.
+func isOffline(flagValue bool) bool {
+	if flagValue {
+		return true
+	}
+	env := os.Getenv("ATIP_DISCOVER_OFFLINE")
+	if env == "" {
+		return false
+	}
+	offline, err := strconv.ParseBool(env)
+	if err != nil {
+		exitWithError(codeInvalidConfig, "Invalid ATIP_DISCOVER_OFFLINE", err)
+	}
+	return offline
+}
+
+// listFlag is a flag.Value that collects every occurrence of a repeatable flag.
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listFlag) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// splitDeprecated splits comma-separated values of a repeatable flag, warning
+// that the comma form is deprecated. Values for which literal reports true
+// (e.g. an existing directory with a comma in its name) are kept whole.
+func splitDeprecated(name string, values []string, literal func(string) bool) []string {
+	var result []string
+	for _, value := range values {
+		if !strings.Contains(value, ",") || (literal != nil && literal(value)) {
+			result = append(result, value)
+			continue
+		}
+		fmt.Fprintf(os.Stderr, "Warning: Comma-separated --%s is deprecated; repeat the flag instead\n", name)
+		for _, part := range strings.Split(value, ",") {
+			if part != "" {
+				result = append(result, part)
+			}
+		}
+	}
+	return result
+}
+
+// probeAllowed reports whether the config's probe allowlist lets the
+// executable at path be run. An empty allowlist allows everything.
+func probeAllowed(cfg *config.Config, path string) bool {
+	allow := cfg.Discovery.ProbeAllow
+	return len(allow) == 0 || discovery.MatchesSkipList(filepath.Base(path), allow)
+}
+
+// parseTimeoutOverrides parses --timeout-override values of the form
+// name=duration into per-tool timeouts keyed by executable name.
+func parseTimeoutOverrides(values []string) (map[string]time.Duration, error) {
+	overrides := make(map[string]time.Duration, len(values))
+	for _, value := range values {
+		name, durStr, ok := strings.Cut(value, "=")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("%q is not of the form name=duration", value)
+		}
+		d, err := time.ParseDuration(durStr)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		if d <= 0 {
+			return nil, fmt.Errorf("%s: timeout must be greater than 0", name)
+		}
+		overrides[name] = d
+	}
+	return overrides, nil
+}
+
+// parseErrorKinds parses the comma-separated --error-kinds value. "all"
+// selects every kind, and an empty value every kind but no_agent_support,
+// which most executables on PATH report.
+func parseErrorKinds(value string) ([]string, error) {
+	var kinds []string
+	switch value {
+	case "all":
+		return discovery.ErrorKinds, nil
+	case "":
+		for _, kind := range discovery.ErrorKinds {
+			if kind != discovery.ErrorKindNoAgentSupport {
+				kinds = append(kinds, kind)
+			}
+		}
+		return kinds, nil
+	}
+
+	known := make(map[string]bool, len(discovery.ErrorKinds))
+	for _, kind := range discovery.ErrorKinds {
+		known[kind] = true
+	}
+	for _, kind := range strings.Split(value, ",") {
+		kind = strings.TrimSpace(kind)
+		if kind == "" {
+			continue
+		}
+		if !known[kind] {
+			return nil, fmt.Errorf("unknown kind %q (valid: %s, all)", kind, strings.Join(discovery.ErrorKinds, ", "))
+		}
+		kinds = append(kinds, kind)
+	}
+	return kinds, nil
+}
+
+// resolveIDs converts a list of names or numeric IDs to numeric IDs,
+// using lookup to resolve entries that are not already numeric.
+func resolveIDs(values []string, lookup func(name string) (string, error)) ([]uint32, error) {
+	var ids []uint32
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		idStr := value
+		if _, err := strconv.ParseUint(value, 10, 32); err != nil {
+			idStr, err = lookup(value)
+			if err != nil {
+				return nil, err
+			}
+		}
+		id, err := strconv.ParseUint(idStr, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid id %q for %s", idStr, value)
+		}
+		ids = append(ids, uint32(id))
+	}
+	return ids, nil
+}
+
+// lookupUID resolves a user name to its UID
+func lookupUID(name string) (string, error) {
+	u, err := user.Lookup(name)
+	if err != nil {
+		return "", err
+	}
+	return u.Uid, nil
+}
+
+// lookupGID resolves a group name to its GID
+func lookupGID(name string) (string, error) {
+	g, err := user.LookupGroup(name)
+	if err != nil {
+		return "", err
+	}
+	return g.Gid, nil
+}
+
+// loadConfig loads the user config, falling back to defaults
+func loadConfig() *config.Config {
+	configPath := config.Find(xdg.AgentToolsConfigDir())
+	if cfg, err := config.Load(configPath); err == nil {
+		return cfg
+	}
+	return config.Default()
+}
+
+// pruneCache enforces the configured cache limits after a scan or refresh.
+// Failures are reported as warnings since the cache is regenerable.
+func pruneCache(reg *registry.Registry, cfg *config.Config) *registry.PruneResult {
+	result, err := reg.PruneCache(xdg.AgentToolsCacheDir(), cfg.Cache.MaxAge, int64(cfg.Cache.MaxSizeMB)*1024*1024)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: Failed to prune cache: %v\n", err)
+		return nil
+	}
+	return result
+}
+
+// loadRegistry loads the registry from the standard location, with the
+// configured source precedence
+func loadRegistry() (*registry.Registry, error) {
+	dataDir := xdg.AgentToolsDataDir()
+	registryPath := filepath.Join(dataDir, "registry.json")
+	reg, err := registry.Load(registryPath, dataDir)
+	if err != nil {
+		return nil, err
+	}
+	if err := reg.SetPrecedence(loadConfig().Discovery.SourcePrecedence); err != nil {
+		return nil, fmt.Errorf("invalid discovery.source_precedence: %w", err)
+	}
+	return reg, nil
+}
+
+// createOutputWriter creates an output writer for the given format
+func createOutputWriter(format string) (output.Writer, error) {
+	return output.NewWriter(output.Format(format), os.Stdout)
+}
+
+// writeOutput writes v in the given format to stdout, or to path when set.
+func writeOutput(format, path string, v interface{}) {
+	if _, err := output.NewWriter(output.Format(format), io.Discard); err != nil {
+		exitWithError(codeInvalidOutputFormat, "Invalid output format", err)
+	}
+	writeOutputTo(path, func(w io.Writer) error {
+		writer, _ := newWriter(format, w)
+		return writer.Write(v)
+	})
+}
+
+// writeOutputTo calls write with stdout, or when path is set replaces path
+// atomically with what write produced.
+func writeOutputTo(path string, write func(w io.Writer) error) {
+	if path == "" {
+		write(os.Stdout)
+		return
+	}
+	if err := output.WriteFile(path, write); err != nil {
+		exitWithError(codeOutputFileFailed, "Failed to write output file", err)
+	}
+}
+
+// readCachedMetadata reads a tool's cached metadata from the cache directory,
+// falling back to the data directory where older versions kept it. Metadata
+// that doesn't match the digest recorded when it was cached is reported as
+// registry.ErrCorruptMetadata rather than returned.
+func readCachedMetadata(entry *registry.RegistryEntry) ([]byte, error) {
+	data, err := os.ReadFile(entry.CachePath(xdg.AgentToolsCacheDir()))
+	if os.IsNotExist(err) {
+		if legacy, legacyErr := os.ReadFile(entry.CachePath(xdg.AgentToolsDataDir())); legacyErr == nil {
+			data, err = legacy, nil
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := entry.VerifyMetadata(data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// browseTools runs the interactive tool browser over tools, whose detail pane
+// shows each tool's cached metadata.
+func browseTools(tools []*registry.RegistryEntry) {
+	items := make([]tui.Item, len(tools))
+	byName := make(map[string]*registry.RegistryEntry, len(tools))
+	for i, entry := range tools {
+		items[i] = tui.Item{Name: entry.Name, Version: entry.Version, Source: entry.Source}
+		if data, err := readCachedMetadata(entry); err == nil {
+			var metadata validator.AtipMetadata
+			if json.Unmarshal(data, &metadata) == nil {
+				items[i].Description = metadata.Description
+			}
+		}
+		byName[entry.Name] = entry
+	}
+	load := func(item tui.Item) (string, error) {
+		return toolDetail(byName[item.Name])
+	}
+	if err := tui.Run(tui.NewModel(items, load), os.Stdin, os.Stdout); err != nil {
+		if errors.Is(err, tui.ErrNotTerminal) {
+			exitWithError(codeNotATerminal, "--interactive requires stdin and stdout to be a terminal", err)
+		}
+		exitWithError(codeInternal, "Interactive mode failed", err)
+	}
+}
+
+// toolDetail describes a tool for the interactive detail pane: its registry
+// entry, trust and effects, and the command tree from its cached metadata.
+func toolDetail(entry *registry.RegistryEntry) (string, error) {
+	data, err := readCachedMetadata(entry)
+	if err != nil {
+		return "", err
+	}
+	var metadata validator.AtipMetadata
+	if err := json.Unmarshal(data, &metadata); err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %s (%s)\n", entry.Name, entry.Version, entry.Source)
+	if metadata.Description != "" {
+		fmt.Fprintf(&b, "%s\n", metadata.Description)
+	}
+	fmt.Fprintf(&b, "Path: %s\n", entry.Path)
+	if len(entry.Tags) > 0 {
+		fmt.Fprintf(&b, "Tags: %s\n", strings.Join(entry.Tags, ", "))
+	}
+	trust := metadata.TrustSummary()
+	fmt.Fprintf(&b, "Trust: %s (verified: %t)\n", trust.Source, trust.Verified)
+	if badges := metadata.Effects().Badges; len(badges) > 0 {
+		fmt.Fprintf(&b, "Effects: %s\n", strings.Join(badges, ", "))
+	}
+	if metadata.Partial {
+		fmt.Fprintf(&b, "Partial metadata; some commands are omitted\n")
+	}
+	if len(metadata.Commands) > 0 {
+		fmt.Fprintf(&b, "Commands:\n")
+		writeCommandTree(&b, "  ", metadata.Commands)
+	}
+	return strings.TrimRight(b.String(), "\n"), nil
+}
+
+// writeCommandTree writes one line per command, sorted by name and indented
+// by nesting depth, with its description.
+func writeCommandTree(w io.Writer, indent string, commands map[string]interface{}) {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		cmd, _ := commands[name].(map[string]interface{})
+		description, _ := cmd["description"].(string)
+		if description != "" {
+			fmt.Fprintf(w, "%s%s - %s\n", indent, name, description)
+		} else {
+			fmt.Fprintf(w, "%s%s\n", indent, name)
+		}
+		if nested, ok := cmd["commands"].(map[string]interface{}); ok {
+			writeCommandTree(w, indent+"  ", nested)
+		}
+	}
+}
+
+// loadShims merges the shims in the data directory into the registry, which
+// the caller saves, and caches their metadata so get can serve them.
+// Caching is optional, so failures are reported as warnings.
+func loadShims(reg *registry.Registry, preferShims bool) (*registry.ShimLoadResult, error) {
+	result, err := reg.LoadShims(preferShims)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range result.Entries {
+		data, err := os.ReadFile(entry.Path)
+		if err == nil {
+			err = writeCachedMetadata(entry, data)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: Failed to cache metadata for %s: %v\n", entry.Name, err)
+		}
+	}
+	return result, nil
+}
+
+// newRemoteClient creates a client for remote registries that revalidates
+// the responses it cached on earlier runs instead of downloading them again
+func newRemoteClient(timeout time.Duration) *remote.Client {
+	client := remote.NewClient(timeout)
+	client.SetCacheDir(filepath.Join(xdg.AgentToolsCacheDir(), "remote"))
+	return client
+}
+
+// cacheShim registers a shim fetched from a remote registry and caches its
+// metadata, so get finds it offline. A registered tool whose source takes
+// precedence, e.g. one discovered natively, keeps its own metadata and only
+// records the shim as shadowed.
+func cacheShim(reg *registry.Registry, shim *remote.Shim) error {
+	entry := &registry.RegistryEntry{
+		Name:         shim.Name,
+		Version:      shim.Version,
+		Source:       "shim",
+		Platform:     shim.Platform,
+		AtipVersion:  shim.Metadata.AtipVersion(),
+		LastVerified: reg.Now(),
+		Checksum:     shim.Hash,
+		Tags:         registry.InferTags(shim.Metadata),
+		Verified:     shim.Metadata.Trust != nil && shim.Metadata.Trust.Verified,
+	}
+
+	if err := reg.Add(entry); errors.Is(err, registry.ErrShadowed) {
+		return reg.Save()
+	}
+	if err := writeCachedMetadata(entry, shim.Data); err != nil {
+		return err
+	}
+	return reg.Save()
+}
+
+// writeCachedMetadata caches metadata as given, e.g. by a remote registry or
+// an import, and records its digest in the entry. It is stored in the form
+// cachedMetadataForm returns.
+func writeCachedMetadata(entry *registry.RegistryEntry, raw []byte) error {
+	data, err := cachedMetadataForm(raw)
+	if err != nil {
+		return err
+	}
+
+	cachePath := entry.CachePath(xdg.AgentToolsCacheDir())
+	if err := os.MkdirAll(filepath.Dir(cachePath), 0755); err != nil {
+		return err
+	}
+	entry.SetMetadata(data)
+	return os.WriteFile(cachePath, data, 0644)
+}
+
+// cachedMetadataForm returns raw metadata as writeCachedMetadata caches it:
+// indented, with the atip field in object form like probed metadata.
+func cachedMetadataForm(raw []byte) ([]byte, error) {
+	var metadata map[string]interface{}
+	if err := json.Unmarshal(raw, &metadata); err != nil {
+		return nil, err
+	}
+	if version, ok := metadata["atip"].(string); ok {
+		metadata["atip"] = map[string]interface{}{"version": version}
+	}
+	return json.MarshalIndent(metadata, "", "  ")
+}
+
+// cacheMetadata saves tool metadata to the cache and records its digest in
+// the registry entry, which the caller saves
+func cacheMetadata(tool *registry.RegistryEntry, metadata *validator.AtipMetadata) error {
+	cachePath := filepath.Join(xdg.AgentToolsCacheDir(), "tools", tool.Name+".json")
+
+	if err := os.MkdirAll(filepath.Dir(cachePath), 0755); err != nil {
 		return err
 	}
+	metadata.NormalizeAtip()
 
 	data, err := json.MarshalIndent(metadata, "", "  ")
 	if err != nil {
 		return err
 	}
 
+	tool.SetMetadata(data)
 	return os.WriteFile(cachePath, data, 0644)
 }
@@ -7,11 +7,21 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/atip/atip-discover/internal/registry"
+	"gopkg.in/yaml.v3"
 )
 
+// FileNames lists the config file names looked up in the config
+// directory, in order of precedence.
+var FileNames = []string{"config.json", "config.toml", "config.yaml", "config.yml"}
+
 // Config represents the complete configuration for atip-discover.
 type Config struct {
 	Version   string          `json:"version"`
@@ -22,11 +32,17 @@ type Config struct {
 
 // DiscoveryConfig holds discovery settings.
 type DiscoveryConfig struct {
-	SafePaths       []string      `json:"safe_paths"`
-	AdditionalPaths []string      `json:"additional_paths"`
-	SkipList        []string      `json:"skip_list"`
-	ScanTimeout     time.Duration `json:"scan_timeout"`
-	Parallelism     int           `json:"parallelism"`
+	SafePaths        []string                 `json:"safe_paths"`
+	AdditionalPaths  []string                 `json:"additional_paths"`
+	SkipList         []string                 `json:"skip_list"`
+	SkipFile         string                   `json:"skip_file"`   // Newline-delimited skip patterns
+	ProbeAllow       []string                 `json:"probe_allow"` // Only tools matching one of these are probed (empty = all)
+	ScanTimeout      time.Duration            `json:"scan_timeout"`
+	Timeouts         map[string]time.Duration `json:"timeouts"` // Per-tool scan timeouts by executable name
+	Parallelism      int                      `json:"parallelism"`
+	TrustedUIDs      []uint32                 `json:"trusted_uids"`
+	TrustedGIDs      []uint32                 `json:"trusted_gids"`
+	SourcePrecedence []string                 `json:"source_precedence"` // Which source keeps a tool several provide, highest first
 }
 
 // CacheConfig holds cache settings.
@@ -43,18 +59,24 @@ type OutputConfig struct {
 
 // configJSON is used for JSON marshaling/unmarshaling with duration as strings
 type configJSON struct {
-	Version   string             `json:"version"`
+	Version   string              `json:"version"`
 	Discovery discoveryConfigJSON `json:"discovery"`
 	Cache     cacheConfigJSON     `json:"cache"`
 	Output    OutputConfig        `json:"output"`
 }
 
 type discoveryConfigJSON struct {
-	SafePaths       []string `json:"safe_paths"`
-	AdditionalPaths []string `json:"additional_paths"`
-	SkipList        []string `json:"skip_list"`
-	ScanTimeout     string   `json:"scan_timeout"`
-	Parallelism     int      `json:"parallelism"`
+	SafePaths        []string          `json:"safe_paths"`
+	AdditionalPaths  []string          `json:"additional_paths"`
+	SkipList         []string          `json:"skip_list"`
+	SkipFile         string            `json:"skip_file"`
+	ProbeAllow       []string          `json:"probe_allow"`
+	ScanTimeout      string            `json:"scan_timeout"`
+	Timeouts         map[string]string `json:"timeouts"`
+	Parallelism      int               `json:"parallelism"`
+	TrustedUIDs      []uint32          `json:"trusted_uids"`
+	TrustedGIDs      []uint32          `json:"trusted_gids"`
+	SourcePrecedence []string          `json:"source_precedence"`
 }
 
 type cacheConfigJSON struct {
@@ -62,7 +84,20 @@ type cacheConfigJSON struct {
 	MaxSizeMB int    `json:"max_size_mb"`
 }
 
+// Find returns the path of the first config file from FileNames that
+// exists in dir, or dir/config.json if there is none.
+func Find(dir string) string {
+	for _, name := range FileNames {
+		path := filepath.Join(dir, name)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return filepath.Join(dir, FileNames[0])
+}
+
 // Load loads configuration from the specified file.
+// The format (JSON, TOML or YAML) is chosen by the file extension.
 // If the file doesn't exist, returns default configuration.
 func Load(path string) (*Config, error) {
 	data, err := os.ReadFile(path)
@@ -74,7 +109,7 @@ func Load(path string) (*Config, error) {
 	}
 
 	var cj configJSON
-	if err := json.Unmarshal(data, &cj); err != nil {
+	if err := decode(path, data, &cj); err != nil {
 		return nil, err
 	}
 
@@ -84,6 +119,15 @@ func Load(path string) (*Config, error) {
 		return nil, fmt.Errorf("invalid scan_timeout: %w", err)
 	}
 
+	timeouts := make(map[string]time.Duration, len(cj.Discovery.Timeouts))
+	for name, value := range cj.Discovery.Timeouts {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timeouts.%s: %w", name, err)
+		}
+		timeouts[name] = d
+	}
+
 	maxAge, err := time.ParseDuration(cj.Cache.MaxAge)
 	if err != nil && cj.Cache.MaxAge != "" {
 		return nil, fmt.Errorf("invalid max_age: %w", err)
@@ -92,11 +136,17 @@ func Load(path string) (*Config, error) {
 	cfg := &Config{
 		Version: cj.Version,
 		Discovery: DiscoveryConfig{
-			SafePaths:       cj.Discovery.SafePaths,
-			AdditionalPaths: cj.Discovery.AdditionalPaths,
-			SkipList:        cj.Discovery.SkipList,
-			ScanTimeout:     scanTimeout,
-			Parallelism:     cj.Discovery.Parallelism,
+			SafePaths:        cj.Discovery.SafePaths,
+			AdditionalPaths:  cj.Discovery.AdditionalPaths,
+			SkipList:         cj.Discovery.SkipList,
+			SkipFile:         cj.Discovery.SkipFile,
+			ProbeAllow:       cj.Discovery.ProbeAllow,
+			ScanTimeout:      scanTimeout,
+			Timeouts:         timeouts,
+			Parallelism:      cj.Discovery.Parallelism,
+			TrustedUIDs:      cj.Discovery.TrustedUIDs,
+			TrustedGIDs:      cj.Discovery.TrustedGIDs,
+			SourcePrecedence: cj.Discovery.SourcePrecedence,
 		},
 		Cache: CacheConfig{
 			MaxAge:    maxAge,
@@ -113,6 +163,9 @@ func Load(path string) (*Config, error) {
 	if cfg.Discovery.Parallelism == 0 {
 		cfg.Discovery.Parallelism = defaults.Discovery.Parallelism
 	}
+	if len(cfg.Discovery.SourcePrecedence) == 0 {
+		cfg.Discovery.SourcePrecedence = defaults.Discovery.SourcePrecedence
+	}
 	if cfg.Cache.MaxAge == 0 {
 		cfg.Cache.MaxAge = defaults.Cache.MaxAge
 	}
@@ -129,20 +182,215 @@ func Load(path string) (*Config, error) {
 	return cfg, nil
 }
 
-// Default returns the default configuration.
+// decode decodes data in the format implied by path's extension. TOML and
+// YAML are converted to JSON first, so every format shares the same keys
+// and duration-as-string handling.
+func decode(path string, data []byte, cj *configJSON) error {
+	if isJSON(path) {
+		return json.Unmarshal(data, cj)
+	}
+
+	raw, err := decodeRaw(path, data)
+	if err != nil {
+		return err
+	}
+	converted, err := json.Marshal(raw)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(converted, cj)
+}
+
+// decodeRaw decodes data into a generic map in the format implied by
+// path's extension.
+func decodeRaw(path string, data []byte) (map[string]interface{}, error) {
+	var raw map[string]interface{}
+	switch {
+	case isJSON(path):
+		if err := json.Unmarshal(data, &raw); err != nil {
+			return nil, err
+		}
+	case strings.EqualFold(filepath.Ext(path), ".toml"):
+		if _, err := toml.Decode(string(data), &raw); err != nil {
+			return nil, err
+		}
+	default:
+		if err := yaml.Unmarshal(data, &raw); err != nil {
+			return nil, err
+		}
+	}
+	return raw, nil
+}
+
+func isJSON(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".toml", ".yaml", ".yml":
+		return false
+	}
+	return true
+}
+
+// MarshalJSON encodes the config in the same shape as the config file,
+// with durations as strings.
+func (c *Config) MarshalJSON() ([]byte, error) {
+	timeouts := make(map[string]string, len(c.Discovery.Timeouts))
+	for name, d := range c.Discovery.Timeouts {
+		timeouts[name] = d.String()
+	}
+
+	return json.Marshal(configJSON{
+		Version: c.Version,
+		Discovery: discoveryConfigJSON{
+			SafePaths:        c.Discovery.SafePaths,
+			AdditionalPaths:  c.Discovery.AdditionalPaths,
+			SkipList:         c.Discovery.SkipList,
+			SkipFile:         c.Discovery.SkipFile,
+			ProbeAllow:       c.Discovery.ProbeAllow,
+			ScanTimeout:      c.Discovery.ScanTimeout.String(),
+			Timeouts:         timeouts,
+			Parallelism:      c.Discovery.Parallelism,
+			TrustedUIDs:      c.Discovery.TrustedUIDs,
+			TrustedGIDs:      c.Discovery.TrustedGIDs,
+			SourcePrecedence: c.Discovery.SourcePrecedence,
+		},
+		Cache: cacheConfigJSON{
+			MaxAge:    c.Cache.MaxAge.String(),
+			MaxSizeMB: c.Cache.MaxSizeMB,
+		},
+		Output: c.Output,
+	})
+}
+
+// Source identifies where an effective configuration value came from.
+type Source string
+
+// Configuration value sources, in increasing order of precedence.
+const (
+	SourceDefault Source = "default"
+	SourceFile    Source = "file"
+	SourceEnv     Source = "env"
+	SourceFlag    Source = "flag"
+)
+
+// Keys lists every configuration key as it appears in the config file.
+var Keys = []string{
+	"version",
+	"discovery.safe_paths",
+	"discovery.additional_paths",
+	"discovery.skip_list",
+	"discovery.skip_file",
+	"discovery.probe_allow",
+	"discovery.scan_timeout",
+	"discovery.timeouts",
+	"discovery.parallelism",
+	"discovery.trusted_uids",
+	"discovery.trusted_gids",
+	"discovery.source_precedence",
+	"cache.max_age",
+	"cache.max_size_mb",
+	"output.default_format",
+	"output.color",
+}
+
+// envKeys maps the environment variables read by Merge to the keys they set.
+var envKeys = map[string]string{
+	"ATIP_DISCOVER_TIMEOUT":          "discovery.scan_timeout",
+	"ATIP_DISCOVER_PARALLEL":         "discovery.parallelism",
+	"ATIP_DISCOVER_SKIP":             "discovery.skip_list",
+	"ATIP_DISCOVER_PROBE_ALLOW":      "discovery.probe_allow",
+	"ATIP_DISCOVER_SAFE_PATHS":       "discovery.safe_paths",
+	"ATIP_DISCOVER_ADDITIONAL_PATHS": "discovery.additional_paths",
+}
+
+// EnvVars returns the names of the environment variables Merge reads,
+// sorted, so callers can pass every one of them in.
+func EnvVars() []string {
+	names := make([]string, 0, len(envKeys))
+	for name := range envKeys {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// flagKeys maps the flags read by Merge to the keys they set.
+var flagKeys = map[string]string{
+	"timeout":     "discovery.scan_timeout",
+	"parallel":    "discovery.parallelism",
+	"skip":        "discovery.skip_list",
+	"skip-file":   "discovery.skip_file",
+	"probe-allow": "discovery.probe_allow",
+	"add-path":    "discovery.additional_paths",
+}
+
+// Resolve loads the config file at path, merges env and flags over it, and
+// reports the source of each value keyed by its entry in Keys.
+func Resolve(path string, env map[string]string, flags map[string]interface{}) (*Config, map[string]Source, error) {
+	cfg, err := Load(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sources := make(map[string]Source, len(Keys))
+	for _, key := range Keys {
+		sources[key] = SourceDefault
+	}
+
+	if data, err := os.ReadFile(path); err == nil {
+		raw, err := decodeRaw(path, data)
+		if err != nil {
+			return nil, nil, err
+		}
+		for section, value := range raw {
+			if _, ok := sources[section]; ok {
+				sources[section] = SourceFile
+				continue
+			}
+			fields, ok := value.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			for field := range fields {
+				if key := section + "." + field; sources[key] != "" {
+					sources[key] = SourceFile
+				}
+			}
+		}
+	}
+
+	if err := cfg.Merge(env, flags); err != nil {
+		return nil, nil, err
+	}
+
+	for name, key := range envKeys {
+		if env[name] != "" {
+			sources[key] = SourceEnv
+		}
+	}
+	for name, key := range flagKeys {
+		if _, ok := flags[name]; ok {
+			sources[key] = SourceFlag
+		}
+	}
+
+	return cfg, sources, nil
+}
+
+// Default returns the default configuration. Its safe paths are the
+// usual install locations of the platform it runs on.
 func Default() *Config {
 	return &Config{
 		Version: "1",
 		Discovery: DiscoveryConfig{
-			SafePaths: []string{
-				"/usr/bin",
-				"/usr/local/bin",
-				"/opt/homebrew/bin",
-			},
-			AdditionalPaths: []string{},
-			SkipList:        []string{},
-			ScanTimeout:     2 * time.Second,
-			Parallelism:     4,
+			SafePaths:        defaultSafePaths(),
+			AdditionalPaths:  []string{},
+			SkipList:         []string{},
+			ScanTimeout:      2 * time.Second,
+			Timeouts:         map[string]time.Duration{},
+			Parallelism:      4,
+			TrustedUIDs:      []uint32{},
+			TrustedGIDs:      []uint32{},
+			SourcePrecedence: append([]string{}, registry.DefaultPrecedence...),
 		},
 		Cache: CacheConfig{
 			MaxAge:    24 * time.Hour,
@@ -179,8 +427,22 @@ func (c *Config) Merge(env map[string]string, flags map[string]interface{}) erro
 			c.Discovery.SkipList = strings.Split(skip, ",")
 		}
 
+		if allow := env["ATIP_DISCOVER_PROBE_ALLOW"]; allow != "" {
+			c.Discovery.ProbeAllow = strings.Split(allow, ",")
+		}
+
 		if safePaths := env["ATIP_DISCOVER_SAFE_PATHS"]; safePaths != "" {
-			c.Discovery.SafePaths = strings.Split(safePaths, ":")
+			c.Discovery.SafePaths = filepath.SplitList(safePaths)
+		}
+
+		// Unlike ATIP_DISCOVER_SAFE_PATHS, this adds to the configured
+		// paths instead of replacing them
+		if additional := env["ATIP_DISCOVER_ADDITIONAL_PATHS"]; additional != "" {
+			for _, path := range filepath.SplitList(additional) {
+				if path != "" {
+					c.Discovery.AdditionalPaths = append(c.Discovery.AdditionalPaths, path)
+				}
+			}
 		}
 	}
 
@@ -198,14 +460,42 @@ func (c *Config) Merge(env map[string]string, flags map[string]interface{}) erro
 			c.Discovery.Parallelism = parallel
 		}
 
+		// --skip adds to the skip list rather than replacing it, so a tool
+		// the config excludes is never probed by accident
 		if skip, ok := flags["skip"].([]string); ok {
-			c.Discovery.SkipList = skip
+			c.Discovery.SkipList = append(c.Discovery.SkipList, skip...)
+		}
+
+		if skipFile, ok := flags["skip-file"].(string); ok {
+			c.Discovery.SkipFile = skipFile
+		}
+
+		if allow, ok := flags["probe-allow"].([]string); ok {
+			c.Discovery.ProbeAllow = allow
+		}
+
+		if addPaths, ok := flags["add-path"].([]string); ok {
+			c.Discovery.AdditionalPaths = append(c.Discovery.AdditionalPaths, addPaths...)
 		}
 	}
 
 	return nil
 }
 
+// ScanPaths returns the directories scanned by default: the safe paths
+// followed by the additional paths, without duplicates.
+func (d *DiscoveryConfig) ScanPaths() []string {
+	seen := make(map[string]bool)
+	var paths []string
+	for _, path := range append(append([]string{}, d.SafePaths...), d.AdditionalPaths...) {
+		if path != "" && !seen[path] {
+			seen[path] = true
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
 // Validate validates the configuration.
 func (c *Config) Validate() error {
 	if c.Discovery.Parallelism <= 0 {
@@ -216,6 +506,16 @@ func (c *Config) Validate() error {
 		return errors.New("scan_timeout must be non-negative")
 	}
 
+	for name, timeout := range c.Discovery.Timeouts {
+		if timeout <= 0 {
+			return fmt.Errorf("timeouts.%s must be greater than 0", name)
+		}
+	}
+
+	if err := registry.ValidatePrecedence(c.Discovery.SourcePrecedence); err != nil {
+		return fmt.Errorf("invalid source_precedence: %w", err)
+	}
+
 	validFormats := map[string]bool{
 		"json":  true,
 		"table": true,
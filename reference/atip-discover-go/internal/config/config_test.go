@@ -1,6 +1,7 @@
 package config
 
 import (
+	"encoding/json"
 	"os"
 	"path/filepath"
 	"testing"
@@ -16,10 +17,8 @@ func TestDefault(t *testing.T) {
 	assert.NotNil(t, cfg)
 	assert.Equal(t, "1", cfg.Version)
 
-	// Discovery defaults
-	assert.Contains(t, cfg.Discovery.SafePaths, "/usr/bin")
-	assert.Contains(t, cfg.Discovery.SafePaths, "/usr/local/bin")
-	assert.Contains(t, cfg.Discovery.SafePaths, "/opt/homebrew/bin")
+	// Discovery defaults (safe paths are checked per platform)
+	assert.NotEmpty(t, cfg.Discovery.SafePaths)
 	assert.Equal(t, 2*time.Second, cfg.Discovery.ScanTimeout)
 	assert.Equal(t, 4, cfg.Discovery.Parallelism)
 
@@ -51,7 +50,10 @@ func TestLoad_ValidConfig(t *testing.T) {
 			"additional_paths": ["/opt/tools"],
 			"skip_list": ["dangerous-tool"],
 			"scan_timeout": "5s",
-			"parallelism": 8
+			"timeouts": {"terraform": "10s"},
+			"parallelism": 8,
+			"trusted_uids": [501],
+			"trusted_gids": [20, 80]
 		},
 		"cache": {
 			"max_age": "48h",
@@ -73,13 +75,136 @@ func TestLoad_ValidConfig(t *testing.T) {
 	assert.Equal(t, []string{"/opt/tools"}, cfg.Discovery.AdditionalPaths)
 	assert.Equal(t, []string{"dangerous-tool"}, cfg.Discovery.SkipList)
 	assert.Equal(t, 5*time.Second, cfg.Discovery.ScanTimeout)
+	assert.Equal(t, map[string]time.Duration{"terraform": 10 * time.Second}, cfg.Discovery.Timeouts)
 	assert.Equal(t, 8, cfg.Discovery.Parallelism)
+	assert.Equal(t, []uint32{501}, cfg.Discovery.TrustedUIDs)
+	assert.Equal(t, []uint32{20, 80}, cfg.Discovery.TrustedGIDs)
 	assert.Equal(t, 48*time.Hour, cfg.Cache.MaxAge)
 	assert.Equal(t, 200, cfg.Cache.MaxSizeMB)
 	assert.Equal(t, "table", cfg.Output.DefaultFormat)
 	assert.Equal(t, "always", cfg.Output.Color)
 }
 
+func TestLoad_Formats(t *testing.T) {
+	files := map[string]string{
+		"config.json": `{
+			"version": "1",
+			"discovery": {
+				"safe_paths": ["/custom/bin", "~/bin"],
+				"skip_list": ["dangerous-tool"],
+				"scan_timeout": "5s",
+				"parallelism": 8,
+				"trusted_gids": [20, 80]
+			},
+			"cache": {"max_age": "48h"},
+			"output": {"default_format": "table"}
+		}`,
+		"config.toml": `
+version = "1"
+
+# Discovery settings
+[discovery]
+safe_paths = [
+  "/custom/bin",
+  '~/bin',
+]
+skip_list = ["dangerous-tool"]
+scan_timeout = "5s"
+parallelism = 8
+trusted_gids = [20, 80]
+
+[cache]
+max_age = "48h"
+
+[output]
+default_format = "table"
+`,
+		"config.yaml": `
+version: "1"
+discovery:
+  safe_paths:
+    - /custom/bin
+    - ~/bin
+  skip_list: [dangerous-tool]
+  scan_timeout: 5s
+  parallelism: 8
+  trusted_gids: [20, 80]
+cache:
+  max_age: 48h
+output:
+  default_format: table
+`,
+	}
+	files["config.yml"] = files["config.yaml"]
+
+	var configs []*Config
+	for name, content := range files {
+		t.Run(name, func(t *testing.T) {
+			configPath := filepath.Join(t.TempDir(), name)
+			require.NoError(t, os.WriteFile(configPath, []byte(content), 0644))
+
+			cfg, err := Load(configPath)
+			require.NoError(t, err)
+			assert.Equal(t, []string{"/custom/bin", "~/bin"}, cfg.Discovery.SafePaths)
+			assert.Equal(t, 5*time.Second, cfg.Discovery.ScanTimeout)
+			assert.Equal(t, 48*time.Hour, cfg.Cache.MaxAge)
+			// Missing fields fall back to defaults
+			assert.Equal(t, 100, cfg.Cache.MaxSizeMB)
+			assert.Equal(t, "auto", cfg.Output.Color)
+			configs = append(configs, cfg)
+		})
+	}
+
+	require.Len(t, configs, len(files))
+	for _, cfg := range configs[1:] {
+		assert.Equal(t, configs[0], cfg)
+	}
+}
+
+func TestLoad_InvalidFormats(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		err     string
+	}{
+		{"config.toml", "[discovery\nparallelism = 8", "toml: line 2"},
+		{"config.toml", "parallelism = eight", "toml: line 1"},
+		{"config.toml", "version = \"1\"\nversion = \"2\"", "'version' has already been defined"},
+		{"config.toml", "[discovery]\nparallelism = 8\n[discovery]\nscan_timeout = \"5s\"", "'discovery' has already been defined"},
+		{"config.toml", "version = \"1", "unexpected EOF"},
+		{"config.toml", "[discovery]\nparallelism = \"eight\"", "cannot unmarshal string"},
+		{"config.toml", "[cache]\nmax_age = \"forever\"", "invalid max_age"},
+		{"config.yaml", "discovery: [unclosed", ""},
+		{"config.yaml", "cache:\n  max_age: forever", ""},
+		{"config.yaml", "discovery:\n  timeouts:\n    terraform: slow", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name+"/"+tt.content, func(t *testing.T) {
+			configPath := filepath.Join(t.TempDir(), tt.name)
+			require.NoError(t, os.WriteFile(configPath, []byte(tt.content), 0644))
+
+			_, err := Load(configPath)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.err)
+		})
+	}
+}
+
+func TestFind(t *testing.T) {
+	dir := t.TempDir()
+	assert.Equal(t, filepath.Join(dir, "config.json"), Find(dir))
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "config.yaml"), nil, 0644))
+	assert.Equal(t, filepath.Join(dir, "config.yaml"), Find(dir))
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "config.toml"), nil, 0644))
+	assert.Equal(t, filepath.Join(dir, "config.toml"), Find(dir))
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "config.json"), nil, 0644))
+	assert.Equal(t, filepath.Join(dir, "config.json"), Find(dir))
+}
+
 func TestLoad_InvalidJSON(t *testing.T) {
 	tmpDir := t.TempDir()
 	configPath := filepath.Join(tmpDir, "config.json")
@@ -150,6 +275,19 @@ func TestMerge_CLIFlags(t *testing.T) {
 	assert.Contains(t, cfg.Discovery.SkipList, "tool-b")
 }
 
+func TestMerge_SkipAppends(t *testing.T) {
+	cfg := Default()
+	cfg.Discovery.SkipList = []string{"from-config"}
+
+	err := cfg.Merge(map[string]string{"ATIP_DISCOVER_SKIP": "from-env"}, map[string]interface{}{
+		"skip": []string{"from-flag-a", "from-flag-b"},
+	})
+	require.NoError(t, err)
+
+	// The environment replaces the configured list; --skip adds to it
+	assert.Equal(t, []string{"from-env", "from-flag-a", "from-flag-b"}, cfg.Discovery.SkipList)
+}
+
 func TestMerge_Precedence(t *testing.T) {
 	// Flags should override environment, which overrides config
 	cfg := Default()
@@ -170,6 +308,46 @@ func TestMerge_Precedence(t *testing.T) {
 	assert.Equal(t, 3*time.Second, cfg.Discovery.ScanTimeout)
 }
 
+func TestResolve_Sources(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	content := "discovery:\n  scan_timeout: 1s\n  parallelism: 8\ncache:\n  max_size_mb: 50\n"
+	require.NoError(t, os.WriteFile(configPath, []byte(content), 0644))
+
+	env := map[string]string{
+		"ATIP_DISCOVER_TIMEOUT":  "2s",
+		"ATIP_DISCOVER_PARALLEL": "",
+	}
+	flags := map[string]interface{}{
+		"timeout": "3s",
+	}
+
+	cfg, sources, err := Resolve(configPath, env, flags)
+	require.NoError(t, err)
+
+	assert.Equal(t, 3*time.Second, cfg.Discovery.ScanTimeout)
+	assert.Equal(t, 8, cfg.Discovery.Parallelism)
+	assert.Equal(t, 50, cfg.Cache.MaxSizeMB)
+
+	assert.Equal(t, SourceFlag, sources["discovery.scan_timeout"])
+	assert.Equal(t, SourceFile, sources["discovery.parallelism"])
+	assert.Equal(t, SourceFile, sources["cache.max_size_mb"])
+	assert.Equal(t, SourceDefault, sources["cache.max_age"])
+	assert.Len(t, sources, len(Keys))
+}
+
+func TestConfig_MarshalJSON(t *testing.T) {
+	data, err := json.Marshal(Default())
+	require.NoError(t, err)
+
+	// Round-trips through Load
+	configPath := filepath.Join(t.TempDir(), "config.json")
+	require.NoError(t, os.WriteFile(configPath, data, 0644))
+	cfg, err := Load(configPath)
+	require.NoError(t, err)
+	assert.Equal(t, Default(), cfg)
+	assert.Contains(t, string(data), `"scan_timeout":"2s"`)
+}
+
 func TestValidate(t *testing.T) {
 	tests := []struct {
 		name      string
@@ -202,6 +380,36 @@ func TestValidate(t *testing.T) {
 			},
 			expectErr: true,
 		},
+		{
+			name: "non-positive tool timeout",
+			cfg: &Config{
+				Version: "1",
+				Discovery: DiscoveryConfig{
+					ScanTimeout: 2 * time.Second,
+					Timeouts:    map[string]time.Duration{"terraform": 0},
+					Parallelism: 4,
+				},
+				Output: OutputConfig{
+					DefaultFormat: "json",
+				},
+			},
+			expectErr: true,
+		},
+		{
+			name: "unknown source in source precedence",
+			cfg: &Config{
+				Version: "1",
+				Discovery: DiscoveryConfig{
+					ScanTimeout:      2 * time.Second,
+					Parallelism:      4,
+					SourcePrecedence: []string{"shim", "vendor"},
+				},
+				Output: OutputConfig{
+					DefaultFormat: "json",
+				},
+			},
+			expectErr: true,
+		},
 		{
 			name: "invalid output format",
 			cfg: &Config{
@@ -244,3 +452,70 @@ func TestMerge_SafePaths(t *testing.T) {
 	assert.Contains(t, cfg.Discovery.SafePaths, "/usr/bin")
 	assert.Contains(t, cfg.Discovery.SafePaths, "/custom/bin")
 }
+
+func TestMerge_AdditionalPaths(t *testing.T) {
+	cfg := Default()
+	cfg.Discovery.SafePaths = []string{"/usr/bin", "/usr/local/bin", "/opt/homebrew/bin"}
+	cfg.Discovery.AdditionalPaths = []string{"/opt/company-tools"}
+
+	env := map[string]string{
+		"ATIP_DISCOVER_ADDITIONAL_PATHS": "~/.local/bin::/opt/tools",
+	}
+	flags := map[string]interface{}{
+		"add-path": []string{"/srv/bin", "/usr/bin"},
+	}
+
+	err := cfg.Merge(env, flags)
+	require.NoError(t, err)
+
+	// Additional paths append; the safe paths are kept
+	assert.Equal(t, []string{"/usr/bin", "/usr/local/bin", "/opt/homebrew/bin"}, cfg.Discovery.SafePaths)
+	assert.Equal(t, []string{"/opt/company-tools", "~/.local/bin", "/opt/tools", "/srv/bin", "/usr/bin"}, cfg.Discovery.AdditionalPaths)
+	assert.Equal(t, []string{
+		"/usr/bin", "/usr/local/bin", "/opt/homebrew/bin",
+		"/opt/company-tools", "~/.local/bin", "/opt/tools", "/srv/bin",
+	}, cfg.Discovery.ScanPaths())
+}
+
+func TestLoad_SourcePrecedence(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.json")
+	require.NoError(t, os.WriteFile(configPath, []byte(`{"discovery": {"source_precedence": ["verified-shim", "native"]}}`), 0644))
+
+	cfg, err := Load(configPath)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"verified-shim", "native"}, cfg.Discovery.SourcePrecedence)
+
+	// Without it, the default order applies
+	require.NoError(t, os.WriteFile(configPath, []byte(`{}`), 0644))
+	cfg, err = Load(configPath)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"native", "verified-shim", "shim", "inferred"}, cfg.Discovery.SourcePrecedence)
+}
+
+func TestMerge_ProbeAllow(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.json")
+	require.NoError(t, os.WriteFile(configPath, []byte(`{"discovery": {"probe_allow": ["gh", "kubectl"]}}`), 0644))
+
+	cfg, err := Load(configPath)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"gh", "kubectl"}, cfg.Discovery.ProbeAllow)
+
+	// The environment and then the flag replace the configured allowlist
+	require.NoError(t, cfg.Merge(map[string]string{"ATIP_DISCOVER_PROBE_ALLOW": "gh,jq"}, nil))
+	assert.Equal(t, []string{"gh", "jq"}, cfg.Discovery.ProbeAllow)
+
+	_, sources, err := Resolve(configPath, nil, map[string]interface{}{"probe-allow": []string{"terraform"}})
+	require.NoError(t, err)
+	assert.Equal(t, SourceFlag, sources["discovery.probe_allow"])
+}
+
+func TestEnvVars(t *testing.T) {
+	assert.Equal(t, []string{
+		"ATIP_DISCOVER_ADDITIONAL_PATHS",
+		"ATIP_DISCOVER_PARALLEL",
+		"ATIP_DISCOVER_PROBE_ALLOW",
+		"ATIP_DISCOVER_SAFE_PATHS",
+		"ATIP_DISCOVER_SKIP",
+		"ATIP_DISCOVER_TIMEOUT",
+	}, EnvVars())
+}
@@ -0,0 +1,13 @@
+//go:build darwin
+
+package config
+
+// defaultSafePaths covers the system directories and both Homebrew
+// prefixes: /usr/local on Intel and /opt/homebrew on Apple silicon.
+func defaultSafePaths() []string {
+	return []string{
+		"/usr/bin",
+		"/usr/local/bin",
+		"/opt/homebrew/bin",
+	}
+}
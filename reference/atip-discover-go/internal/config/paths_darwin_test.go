@@ -0,0 +1,20 @@
+//go:build darwin
+
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDefault_DarwinSafePaths(t *testing.T) {
+	paths := Default().Discovery.SafePaths
+
+	assert.Contains(t, paths, "/usr/bin")
+	// Homebrew on Intel and on Apple silicon
+	assert.Contains(t, paths, "/usr/local/bin")
+	assert.Contains(t, paths, "/opt/homebrew/bin")
+
+	assert.NotContains(t, paths, "/snap/bin")
+}
@@ -0,0 +1,17 @@
+//go:build !darwin && !windows
+
+package config
+
+// defaultSafePaths covers the system directories, the user's own
+// ~/.local/bin and the directories snap and flatpak export their
+// commands to.
+func defaultSafePaths() []string {
+	return []string{
+		"/usr/bin",
+		"/usr/local/bin",
+		"/usr/local/sbin",
+		"~/.local/bin",
+		"/snap/bin",
+		"/var/lib/flatpak/exports/bin",
+	}
+}
@@ -0,0 +1,22 @@
+//go:build !darwin && !windows
+
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDefault_UnixSafePaths(t *testing.T) {
+	paths := Default().Discovery.SafePaths
+
+	assert.Contains(t, paths, "/usr/bin")
+	assert.Contains(t, paths, "/usr/local/bin")
+	assert.Contains(t, paths, "/usr/local/sbin")
+	assert.Contains(t, paths, "~/.local/bin")
+	assert.Contains(t, paths, "/snap/bin")
+
+	// Homebrew's prefix is a macOS default only
+	assert.NotContains(t, paths, "/opt/homebrew/bin")
+}
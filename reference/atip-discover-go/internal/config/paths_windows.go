@@ -0,0 +1,29 @@
+//go:build windows
+
+package config
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// defaultSafePaths covers %ProgramFiles% and the per-user
+// %LOCALAPPDATA%\Programs, where user-scope installers put tools.
+func defaultSafePaths() []string {
+	programFiles := os.Getenv("ProgramFiles")
+	if programFiles == "" {
+		programFiles = `C:\Program Files`
+	}
+	paths := []string{programFiles}
+
+	localAppData := os.Getenv("LOCALAPPDATA")
+	if localAppData == "" {
+		if dir, err := os.UserCacheDir(); err == nil {
+			localAppData = dir
+		}
+	}
+	if localAppData != "" {
+		paths = append(paths, filepath.Join(localAppData, "Programs"))
+	}
+	return paths
+}
@@ -0,0 +1,30 @@
+//go:build windows
+
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDefault_WindowsSafePaths(t *testing.T) {
+	t.Setenv("ProgramFiles", `C:\Program Files`)
+	t.Setenv("LOCALAPPDATA", `C:\Users\test\AppData\Local`)
+
+	assert.Equal(t, []string{
+		`C:\Program Files`,
+		`C:\Users\test\AppData\Local\Programs`,
+	}, Default().Discovery.SafePaths)
+}
+
+func TestMerge_SafePathsWindowsSeparator(t *testing.T) {
+	cfg := Default()
+	err := cfg.Merge(map[string]string{
+		"ATIP_DISCOVER_SAFE_PATHS": `C:\tools;D:\bin`,
+	}, nil)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{`C:\tools`, `D:\bin`}, cfg.Discovery.SafePaths)
+}
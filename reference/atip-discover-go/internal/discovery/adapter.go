@@ -0,0 +1,179 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/atip/atip-discover/internal/validator"
+)
+
+// ErrNoHelp is returned by Prober.Adapt when a tool's --help output lists
+// no options, so there is nothing to infer metadata from.
+var ErrNoHelp = errors.New("no options in --help output")
+
+// helpVersionRegex finds a version number in the first lines of --help
+// output, e.g. "mytool 1.2.3" or "mytool version v1.2".
+var helpVersionRegex = regexp.MustCompile(`\bv?(\d+\.\d+(?:\.\d+)?(?:-[0-9A-Za-z.-]+)?)\b`)
+
+// helpVersionLines is how many lines of --help output are searched for a
+// version, since later numbers are usually option defaults.
+const helpVersionLines = 3
+
+// adaptable reports whether a failed --agent probe may be retried as --help:
+// the tool ran but exited non-zero or printed something other than ATIP
+// JSON. Timeouts and crashes are not retried.
+func adaptable(err error) bool {
+	switch ErrorKind(err) {
+	case ErrorKindNoAgentSupport, ErrorKindInvalidJSON:
+		return true
+	}
+	return false
+}
+
+// Adapt runs the executable at path with --help, within its probe timeout,
+// and infers partial metadata from the output with InferFromHelp. Tools
+// often exit non-zero after printing help, to stderr, so the exit status is
+// ignored and the stderr of a failed run is read as well. It returns
+// ErrNoHelp if no options are found.
+func (p *Prober) Adapt(ctx context.Context, path string) (*validator.AtipMetadata, error) {
+	return p.adapt(ctx, path, p.cacheModTime(path))
+}
+
+// adapt implements Adapt, caching the result under modTime.
+func (p *Prober) adapt(ctx context.Context, path string, modTime time.Time) (*validator.AtipMetadata, error) {
+	metadata, _, err := p.cache.do(ctx, path, modTime, "--help", func() (*validator.AtipMetadata, int, error) {
+		metadata, err := p.adaptOnce(ctx, path)
+		return metadata, 0, err
+	})
+	return metadata, err
+}
+
+// adaptOnce runs the tool with --help a single time.
+func (p *Prober) adaptOnce(ctx context.Context, path string) (*validator.AtipMetadata, error) {
+	timeout := p.Timeout(path)
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	output, err := p.executor.Run(ctx, path, []string{"--help"})
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		output = append(output, exitErr.Stderr...)
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		return nil, fmt.Errorf("%w after %s", ErrProbeTimeout, timeout)
+	}
+
+	metadata := InferFromHelp(filepath.Base(path), string(output))
+	if len(metadata.GlobalOptions) == 0 {
+		return nil, ErrNoHelp
+	}
+	return metadata, nil
+}
+
+// InferFromHelp synthesizes ATIP metadata for the tool name from its --help
+// output, the way the registry crawler parses help: every line starting
+// with "-" is an option, with comma-separated flags followed by a
+// description. Options taking a value ("--file FILE", "--file=FILE") are
+// strings, the rest booleans. The description is the first line that isn't
+// a usage line or an option, and the version the first version number in
+// the opening lines ("unknown" if there is none).
+//
+// The result is marked partial with trust source "inferred", since help
+// output says nothing about subcommands' effects.
+func InferFromHelp(name, help string) *validator.AtipMetadata {
+	metadata := &validator.AtipMetadata{
+		Atip:          map[string]interface{}{"version": validator.SchemaVersion},
+		Name:          name,
+		Version:       "unknown",
+		Partial:       true,
+		Trust:         &validator.TrustInfo{Source: validator.TrustSourceInferred},
+		GlobalOptions: []interface{}{},
+	}
+
+	seen := make(map[string]bool)
+	for i, line := range strings.Split(help, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" {
+			continue
+		}
+		if i < helpVersionLines && metadata.Version == "unknown" {
+			if match := helpVersionRegex.FindStringSubmatch(trimmed); match != nil {
+				metadata.Version = match[1]
+			}
+		}
+
+		if strings.HasPrefix(trimmed, "-") {
+			if opt := parseHelpOption(trimmed); opt != nil && !seen[opt["name"].(string)] {
+				seen[opt["name"].(string)] = true
+				metadata.GlobalOptions = append(metadata.GlobalOptions, opt)
+			}
+			continue
+		}
+		if metadata.Description == "" && !strings.HasPrefix(strings.ToLower(trimmed), "usage") && !strings.HasSuffix(trimmed, ":") {
+			metadata.Description = trimmed
+		}
+	}
+
+	if metadata.Description == "" {
+		metadata.Description = fmt.Sprintf("Inferred from %s --help", name)
+	}
+	return metadata
+}
+
+// parseHelpOption parses an option line such as
+// "-o, --output FILE   Write to FILE" into an ATIP option, or returns nil if
+// the line has no flags.
+func parseHelpOption(line string) map[string]interface{} {
+	// Flags end where the description starts, after a run of spaces or a tab
+	spec, description := line, ""
+	if i := strings.Index(line, "  "); i >= 0 {
+		spec, description = line[:i], strings.TrimSpace(line[i:])
+	} else if i := strings.Index(line, "\t"); i >= 0 {
+		spec, description = line[:i], strings.TrimSpace(line[i:])
+	}
+
+	var flags []interface{}
+	name, optType := "", "boolean"
+	for _, part := range strings.Split(spec, ",") {
+		fields := strings.Fields(part)
+		if len(fields) == 0 || !strings.HasPrefix(fields[0], "-") {
+			continue
+		}
+		flag := fields[0]
+		if f, _, ok := strings.Cut(flag, "="); ok {
+			flag, optType = f, "string"
+		}
+		if len(fields) > 1 {
+			optType = "string"
+		}
+		flag = strings.TrimRight(flag, "[")
+		if strings.Trim(flag, "-") == "" {
+			continue
+		}
+		flags = append(flags, flag)
+
+		// Prefer the long flag's name
+		if strings.HasPrefix(flag, "--") || name == "" {
+			name = strings.TrimLeft(flag, "-")
+		}
+	}
+	if len(flags) == 0 {
+		return nil
+	}
+	if description == "" {
+		description = name
+	}
+
+	return map[string]interface{}{
+		"name":        name,
+		"flags":       flags,
+		"type":        optType,
+		"description": description,
+	}
+}
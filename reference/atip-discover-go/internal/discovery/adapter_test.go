@@ -0,0 +1,109 @@
+package discovery
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/atip/atip-discover/internal/validator"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const sampleHelp = `mytool 2.3.1
+A tool that only prints help
+
+Usage: mytool [OPTIONS] FILE
+
+Options:
+  -h, --help              Show this help
+  -o, --output FILE       Write results to FILE
+      --color[=WHEN]      Colorize output
+  -q                      Quiet
+      --level=N           Verbosity level (default 1.5)
+  --help                  Duplicate entry
+`
+
+func TestInferFromHelp(t *testing.T) {
+	metadata := InferFromHelp("mytool", sampleHelp)
+
+	assert.Equal(t, "mytool", metadata.Name)
+	assert.Equal(t, "2.3.1", metadata.Version)
+	assert.Equal(t, "mytool 2.3.1", metadata.Description)
+	assert.True(t, metadata.Partial)
+	require.NotNil(t, metadata.Trust)
+	assert.Equal(t, validator.TrustSourceInferred, metadata.Trust.Source)
+	assert.False(t, metadata.Trust.Verified)
+
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"name": "help", "flags": []interface{}{"-h", "--help"}, "type": "boolean", "description": "Show this help"},
+		map[string]interface{}{"name": "output", "flags": []interface{}{"-o", "--output"}, "type": "string", "description": "Write results to FILE"},
+		map[string]interface{}{"name": "color", "flags": []interface{}{"--color"}, "type": "string", "description": "Colorize output"},
+		map[string]interface{}{"name": "q", "flags": []interface{}{"-q"}, "type": "boolean", "description": "Quiet"},
+		map[string]interface{}{"name": "level", "flags": []interface{}{"--level"}, "type": "string", "description": "Verbosity level (default 1.5)"},
+	}, metadata.GlobalOptions)
+
+	v, err := validator.Default()
+	require.NoError(t, err)
+	assert.NoError(t, v.ValidateMetadata(metadata))
+}
+
+func TestInferFromHelp_Fallbacks(t *testing.T) {
+	metadata := InferFromHelp("bare", "Usage: bare [-v]\n\n  -v  Verbose\n")
+	assert.Equal(t, "unknown", metadata.Version)
+	assert.Equal(t, "Inferred from bare --help", metadata.Description)
+	assert.Len(t, metadata.GlobalOptions, 1)
+
+	assert.Empty(t, InferFromHelp("silent", "").GlobalOptions)
+}
+
+func TestScanner_Scan_AdaptHelp(t *testing.T) {
+	tmpDir := t.TempDir()
+	helpOnly := `#!/bin/sh
+if [ "$1" = "--help" ]; then
+  cat >&2 <<'EOF'
+` + sampleHelp + `EOF
+  exit 2
+fi
+echo "unknown option: $1" >&2
+exit 1
+`
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "mytool"), []byte(helpOnly), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "nohelp"), []byte("#!/bin/sh\nexit 1\n"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "native"), []byte(`#!/bin/sh
+echo '{"atip": {"version": "0.6"}, "name": "native", "version": "1.0.0", "description": "A native tool", "commands": {}}'
+`), 0755))
+
+	scan := func(adapt bool) *ScanResult {
+		scanner, err := NewScanner(2*time.Second, 2, nil)
+		require.NoError(t, err)
+		scanner.SetAdaptHelp(adapt)
+		result, err := scanner.Scan(context.Background(), []string{tmpDir}, false, nil)
+		require.NoError(t, err)
+		return result
+	}
+
+	// Without adapters, help-only tools fail the probe
+	result := scan(false)
+	require.Len(t, result.Tools, 1)
+	assert.Equal(t, "native", result.Tools[0].Source)
+	assert.Len(t, result.Errors, 2)
+
+	result = scan(true)
+	require.Len(t, result.Tools, 2)
+	inferred := result.Tools[0]
+	assert.Equal(t, "mytool", inferred.Name)
+	assert.Equal(t, "inferred", inferred.Source)
+	assert.Equal(t, "2.3.1", inferred.Version)
+	require.NotNil(t, inferred.Metadata)
+	assert.True(t, inferred.Metadata.Partial)
+	assert.Equal(t, validator.TrustSourceInferred, inferred.Metadata.Trust.Source)
+	assert.Equal(t, "native", result.Tools[1].Source)
+
+	// A tool without options in its help output still fails with the --agent error
+	require.Len(t, result.Errors, 1)
+	assert.Equal(t, "nohelp", filepath.Base(result.Errors[0].Path))
+	assert.Equal(t, ErrorKindNoAgentSupport, result.Errors[0].Kind)
+}
@@ -4,16 +4,24 @@ package discovery
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
+	"math"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
 	"runtime"
+	"sort"
 	"strings"
 	"sync"
 	"syscall"
 	"time"
 
+	"github.com/atip/atip-discover/internal/clock"
+	"github.com/atip/atip-discover/internal/pool"
 	"github.com/atip/atip-discover/internal/validator"
 )
 
@@ -21,13 +29,45 @@ import (
 type Scanner struct {
 	validator   *validator.Validator
 	timeout     time.Duration
+	timeouts    map[string]time.Duration // Per-tool overrides, see Prober.SetTimeouts
+	retries     int                      // See Prober.SetRetries
 	parallelism int
 	skipList    []string
+	probeAllow  []string // Only names matching one of these are probed, nil to probe all
+	minAtip     string   // Supported ATIP versions, "" for no bound
+	maxAtip     string
+	clock       clock.Clock // Stamps DiscoveredAt
+	progress    func(ScanEvent)
+	hasher      Hasher          // Verifies declared binary hashes, nil to skip
+	adaptHelp   bool            // Infer metadata from --help for tools without --agent
+	executor    Executor        // Runs probes, nil for LocalExecutor
+	pool        *pool.Pool      // Bounds probes in flight, nil for a pool of parallelism per scan
+	cache       *ProbeCache     // Results of probes already run, nil to run every probe
+	maxDepth    int             // Directory levels enumerated per scan path, see SetMaxDepth
+	safePaths   SafePathOptions // Subdirectories must pass IsSafePathWithOptions with these
 }
 
-// NewScanner creates a new scanner.
+// Hasher computes the "sha256:<hex>" hash of a binary, e.g. a
+// hashcache.Cache that skips binaries it hashed before.
+type Hasher interface {
+	Hash(path string) (string, error)
+}
+
+// ScanEvent reports the outcome of one probe while a scan is running.
+// Exactly one of Tool and Error is set.
+type ScanEvent struct {
+	Tool  *DiscoveredTool
+	Error *ScanError
+}
+
+// NewScanner creates a new scanner. It fails if a regular expression in
+// skipList doesn't compile.
 func NewScanner(timeout time.Duration, parallelism int, skipList []string) (*Scanner, error) {
-	v, err := validator.New()
+	if err := ValidateSkipList(skipList); err != nil {
+		return nil, err
+	}
+
+	v, err := validator.Default()
 	if err != nil {
 		return nil, err
 	}
@@ -37,145 +77,539 @@ func NewScanner(timeout time.Duration, parallelism int, skipList []string) (*Sca
 		timeout:     timeout,
 		parallelism: parallelism,
 		skipList:    skipList,
+		clock:       clock.Real{},
 	}, nil
 }
 
-// Scan scans the specified directories for ATIP-compatible tools.
-// It enumerates executables, filters by skip list, and probes them in parallel.
-// When incremental is true, only probes tools that have been modified since last scan.
-// Returns aggregated scan results including discovered tools and errors.
-func (s *Scanner) Scan(ctx context.Context, paths []string, incremental bool, existingRegistry map[string]time.Time) (*ScanResult, error) {
-	start := time.Now()
-	result := &ScanResult{
-		Tools:  []DiscoveredTool{},
-		Errors: []ScanError{},
+// SetProbeAllow restricts probing to executables whose name matches one of
+// patterns, which take the same forms as the skip list. Others are still
+// enumerated but reported in ScanResult.NotAllowed instead of being run. An
+// empty list allows every executable. It fails if a regular expression
+// doesn't compile.
+func (s *Scanner) SetProbeAllow(patterns []string) error {
+	if err := ValidateSkipList(patterns); err != nil {
+		return err
 	}
+	if len(patterns) == 0 {
+		patterns = nil
+	}
+	s.probeAllow = patterns
+	return nil
+}
 
-	// Collect all executables
-	var executables []string
-	for _, dir := range paths {
-		execs, err := EnumerateExecutables(dir)
-		if err != nil {
+// SetValidator replaces the validator probed metadata must pass, e.g. with
+// one that also enforces an organization's policy. Failures are reported
+// as errors of kind validation.
+func (s *Scanner) SetValidator(v *validator.Validator) {
+	s.validator = v
+}
+
+// SetClock replaces the clock discovered tools are stamped with, e.g. with
+// a clock.Fake in tests. Durations are always measured in real time.
+func (s *Scanner) SetClock(c clock.Clock) {
+	s.clock = c
+}
+
+// SetTimeouts sets per-tool probe timeouts, keyed by executable base name.
+// Tools without an override use the scanner's timeout.
+func (s *Scanner) SetTimeouts(overrides map[string]time.Duration) {
+	s.timeouts = overrides
+}
+
+// SetRetries sets how many times a probe that fails transiently is retried.
+func (s *Scanner) SetRetries(n int) {
+	s.retries = n
+}
+
+// SetVerifyChecksums makes Scan check the binary hash that a tool's
+// metadata declares, if any, against the executable's hash as computed by
+// hasher. A mismatch is reported as an error of kind checksum_mismatch
+// instead of a discovered tool. A nil hasher disables the check.
+func (s *Scanner) SetVerifyChecksums(hasher Hasher) {
+	s.hasher = hasher
+}
+
+// SetAdaptHelp makes Scan fall back to Prober.Adapt for tools that run but
+// don't support --agent. Tools whose --help output lists options are then
+// discovered with source "inferred" instead of failing.
+func (s *Scanner) SetAdaptHelp(enabled bool) {
+	s.adaptHelp = enabled
+}
+
+// SetPool makes Scan run probes on p instead of a pool of its own, so they
+// count against a limit shared with other work in the process. The
+// scanner's parallelism is then ignored.
+func (s *Scanner) SetPool(p *pool.Pool) {
+	s.pool = p
+}
+
+// SetProbeCache makes Scan look up probes in c before running them and
+// record them there, so an executable found twice, or probed again later
+// in the same command, runs only once. A nil cache runs every probe.
+func (s *Scanner) SetProbeCache(c *ProbeCache) {
+	s.cache = c
+}
+
+// SetExecutor sets the Executor that probes run through, e.g. to probe
+// tools inside a container. Executables are still enumerated, skipped and
+// hashed in the local directories passed to Scan, so the executor should
+// see them at the same paths. A nil executor runs them locally.
+func (s *Scanner) SetExecutor(executor Executor) {
+	s.executor = executor
+}
+
+// SetMaxDepth makes Scan and Plan also enumerate the subdirectories of each
+// scan path, down to depth levels: 1, the default, reads only the path
+// itself, 2 also its subdirectories, and so on. A subdirectory that
+// IsSafePathWithOptions rejects with opts is skipped, along with everything
+// under it, and listed in ScanResult.UnsafeDirs. Symlinked directories are
+// never followed, so links can't lead a scan in circles.
+func (s *Scanner) SetMaxDepth(depth int, opts SafePathOptions) {
+	s.maxDepth = depth
+	s.safePaths = opts
+}
+
+// SetProgress sets a callback that Scan calls as each probe completes, in
+// completion order, with the tool or error it adds to the result. Calls are
+// never concurrent, and Scan returns only after the last one.
+func (s *Scanner) SetProgress(fn func(ScanEvent)) {
+	s.progress = fn
+}
+
+// SetAtipVersionRange sets the ATIP spec versions consumers support, e.g.
+// "0.4" to "0.6". Tools declaring a version outside the range are still
+// discovered but flagged Unsupported. An empty bound is open.
+func (s *Scanner) SetAtipVersionRange(min, max string) error {
+	for _, version := range []string{min, max} {
+		if version == "" {
 			continue
 		}
-		executables = append(executables, execs...)
+		if _, err := validator.CompareAtipVersions(version, version); err != nil {
+			return err
+		}
 	}
-
-	// Filter by skip list and incremental
-	var toProbe []string
-	for _, exec := range executables {
-		name := filepath.Base(exec)
-		if MatchesSkipList(name, s.skipList) {
-			result.Skipped++
-			continue
+	if min != "" && max != "" {
+		if c, _ := validator.CompareAtipVersions(min, max); c > 0 {
+			return fmt.Errorf("minimum ATIP version %s is above maximum %s", min, max)
 		}
+	}
+	s.minAtip, s.maxAtip = min, max
+	return nil
+}
 
-		// Check if changed for incremental mode
-		if incremental {
-			if modTime, exists := existingRegistry[exec]; exists {
-				info, err := os.Stat(exec)
-				if err == nil && !info.ModTime().After(modTime) {
-					result.Skipped++
-					continue
-				}
-			}
+// supportsAtip reports whether version lies in the scanner's ATIP range.
+func (s *Scanner) supportsAtip(version string) bool {
+	if s.minAtip != "" {
+		if c, err := validator.CompareAtipVersions(version, s.minAtip); err != nil || c < 0 {
+			return false
 		}
-
-		toProbe = append(toProbe, exec)
 	}
+	if s.maxAtip != "" {
+		if c, err := validator.CompareAtipVersions(version, s.maxAtip); err != nil || c > 0 {
+			return false
+		}
+	}
+	return true
+}
 
-	// Probe in parallel
-	prober := NewProber(s.timeout)
-	jobs := make(chan string, len(toProbe))
-	results := make(chan probeResult, len(toProbe))
-
-	var wg sync.WaitGroup
-	for i := 0; i < s.parallelism; i++ {
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			for path := range jobs {
-				metadata, err := prober.Probe(ctx, path)
-				results <- probeResult{path: path, metadata: metadata, err: err}
-			}
-		}()
+// Scan scans the specified directories for ATIP-compatible tools.
+// It enumerates executables, filters by skip list, and probes them in parallel.
+// When incremental is true, only probes tools that have been modified since last scan.
+// Returns aggregated scan results including discovered tools and errors.
+//
+// If ctx is done before every probe finishes, Scan stops reading
+// directories and starting probes, cancels those in flight and returns the
+// partial result, counting the executables it found but didn't probe in
+// Unprobed rather than as failures.
+// DeadlineExceeded is set if ctx was done because its deadline passed.
+func (s *Scanner) Scan(ctx context.Context, paths []string, incremental bool, existingRegistry map[string]time.Time) (*ScanResult, error) {
+	start := time.Now()
+	result := &ScanResult{
+		Tools:       []DiscoveredTool{},
+		Errors:      []ScanError{},
+		Directories: make([]DirStat, len(paths)),
+		Stats:       ScanStats{ErrorsByKind: map[string]int{}},
 	}
 
-	for _, path := range toProbe {
-		jobs <- path
+	// Probe in parallel
+	prober := NewProber(s.timeout, s.executor)
+	prober.SetTimeouts(s.timeouts)
+	prober.SetRetries(s.retries)
+	prober.SetCache(s.cache)
+	p := s.pool
+	if p == nil {
+		p = pool.New(s.parallelism)
 	}
-	close(jobs)
+	results := make(chan probeResult, p.Size())
 
+	// Enumerate each directory in turn, filtering executables by skip list
+	// and incremental as Plan does, and start probing them as they are found
+	// rather than once every directory has been read. Until results is
+	// closed, this goroutine only updates the directory stats' enumeration
+	// fields and result's Skipped, NotAllowed, UnsafeDirs, PathErrors,
+	// Stats.Enumerated, Stats.Probed and Stats.DirsTraversed, leaving every
+	// other field to the collector below.
 	go func() {
+		var wg sync.WaitGroup
+		// Bounds the probes waiting for the pool, which may be shared, so
+		// they start roughly in enumeration order
+		waiting := make(chan struct{}, p.Size())
+		for i, dir := range paths {
+			stat := &result.Directories[i]
+			stat.Path = dir
+			walked := s.walk(ctx, dir, func(path string) {
+				stat.Executables++
+				result.Stats.Enumerated++
+				planned := s.planExecutable(path, incremental, existingRegistry)
+				if !planned.Probe {
+					result.Skipped++
+					stat.Skipped++
+					if planned.Reason == SkipReasonNotAllowed {
+						result.NotAllowed = append(result.NotAllowed, path)
+					}
+					return
+				}
+				result.Stats.Probed++
+
+				waiting <- struct{}{}
+				wg.Add(1)
+				go func(dir int, path string) {
+					defer wg.Done()
+					defer func() { <-waiting }()
+					// Run's error is only for a probe that never started
+					// because ctx was done
+					errs := p.Run(ctx, 1, func(ctx context.Context, _ int) error {
+						results <- s.probe(ctx, prober, dir, path)
+						return nil
+					})
+					if errs[0] != nil {
+						results <- probeResult{dir: dir, path: path, canceled: true}
+					}
+				}(i, path)
+			})
+			stat.Subdirectories = walked.subdirs
+			result.Stats.DirsTraversed += walked.dirs
+			result.UnsafeDirs = append(result.UnsafeDirs, walked.unsafe...)
+			result.PathErrors = append(result.PathErrors, walked.errs...)
+			if walked.err != nil {
+				stat.Error = walked.err.Error()
+			}
+		}
 		wg.Wait()
 		close(results)
 	}()
 
 	// Collect results
+	var probeTime time.Duration
+	addError := func(dirStat *DirStat, path string, err error) {
+		kind := ErrorKind(err)
+		result.Failed++
+		dirStat.Failed++
+		result.Stats.ErrorsByKind[kind]++
+		if kind == ErrorKindNoAgentSupport {
+			result.NoAgentSupport++
+		}
+		scanErr := ScanError{
+			Path:  path,
+			Kind:  kind,
+			Error: err.Error(),
+		}
+		result.Errors = append(result.Errors, scanErr)
+		if s.progress != nil {
+			s.progress(ScanEvent{Error: &scanErr})
+		}
+	}
 	for res := range results {
+		dirStat := &result.Directories[res.dir]
+		probeTime += res.elapsed
+		result.Stats.Retries += res.retries
+
+		if res.canceled {
+			result.Unprobed++
+			continue
+		}
 		if res.err != nil {
-			result.Failed++
-			result.Errors = append(result.Errors, ScanError{
-				Path:  res.path,
-				Error: res.err.Error(),
-			})
+			addError(dirStat, res.path, res.err)
 			continue
 		}
 
 		if res.metadata != nil {
 			// Validate
 			if err := s.validator.ValidateMetadata(res.metadata); err != nil {
-				result.Failed++
-				result.Errors = append(result.Errors, ScanError{
-					Path:  res.path,
-					Error: fmt.Sprintf("validation failed: %v", err),
-				})
+				addError(dirStat, res.path, fmt.Errorf("%w: %v", ErrValidation, err))
 				continue
 			}
 
 			result.Discovered++
-			result.Tools = append(result.Tools, DiscoveredTool{
+			dirStat.Discovered++
+			atipVersion := res.metadata.AtipVersion()
+			unsupported := !s.supportsAtip(atipVersion)
+			if unsupported {
+				result.Unsupported++
+			}
+			tool := DiscoveredTool{
 				Name:         res.metadata.Name,
 				Version:      res.metadata.Version,
 				Path:         res.path,
-				Source:       "native",
-				DiscoveredAt: time.Now(),
-			})
+				Source:       res.source,
+				Platform:     Platform(res.metadata),
+				AtipVersion:  atipVersion,
+				Unsupported:  unsupported,
+				Retries:      res.retries,
+				DiscoveredAt: s.clock.Now(),
+				ModTime:      res.modTime,
+				Metadata:     res.metadata,
+			}
+			result.Tools = append(result.Tools, tool)
+			if s.progress != nil {
+				s.progress(ScanEvent{Tool: &tool})
+			}
 		}
 	}
 
+	// Results arrive in completion order; sort them so output is reproducible
+	sort.Slice(result.Tools, func(i, j int) bool {
+		if result.Tools[i].Name != result.Tools[j].Name {
+			return result.Tools[i].Name < result.Tools[j].Name
+		}
+		return result.Tools[i].Path < result.Tools[j].Path
+	})
+	sort.Slice(result.Errors, func(i, j int) bool { return result.Errors[i].Path < result.Errors[j].Path })
+	sort.Strings(result.NotAllowed)
+
+	result.Stats.Probed -= result.Unprobed
+	result.DeadlineExceeded = errors.Is(ctx.Err(), context.DeadlineExceeded)
+	if result.Stats.Probed > 0 {
+		avg := float64(probeTime) / float64(result.Stats.Probed) / float64(time.Millisecond)
+		result.Stats.AvgProbeMs = math.Round(avg*100) / 100
+	}
+
 	result.DurationMs = time.Since(start).Milliseconds()
 	return result, nil
 }
 
+// verifyChecksum checks the binary hash declared in metadata, if any,
+// against the hash of the executable at path.
+func verifyChecksum(hasher Hasher, path string, metadata *validator.AtipMetadata) error {
+	if metadata == nil || metadata.Binary == nil || metadata.Binary.Hash == "" {
+		return nil
+	}
+	actual, err := hasher.Hash(path)
+	if err != nil {
+		return fmt.Errorf("failed to hash executable: %w", err)
+	}
+	if !strings.EqualFold(actual, metadata.Binary.Hash) {
+		return fmt.Errorf("%w: metadata declares %s, executable is %s", ErrChecksumMismatch, metadata.Binary.Hash, actual)
+	}
+	return nil
+}
+
+// probe probes the executable at path, from the directory with index dir
+// in the scan's paths, adapting --help and verifying its checksum as
+// configured.
+func (s *Scanner) probe(ctx context.Context, prober *Prober, dir int, path string) probeResult {
+	probeStart := time.Now()
+	// The registry records the version of the binary that was probed,
+	// even if it changes before the scan ends
+	modTime := statModTime(path)
+	metadata, retries, err := prober.probeWithRetries(ctx, path, modTime)
+	source := "native"
+	if err != nil && s.adaptHelp && adaptable(err) {
+		// Keep the --agent error if --help doesn't help either
+		if adapted, adaptErr := prober.adapt(ctx, path, modTime); adaptErr == nil {
+			metadata, err, source = adapted, nil, "inferred"
+		}
+	}
+	if err == nil && s.hasher != nil {
+		err = verifyChecksum(s.hasher, path, metadata)
+	}
+	if err != nil && ctx.Err() != nil {
+		// The scan was canceled, not the tool at fault
+		return probeResult{dir: dir, path: path, canceled: true, elapsed: time.Since(probeStart)}
+	}
+	return probeResult{dir: dir, path: path, modTime: modTime, metadata: metadata, source: source, err: err, retries: retries, elapsed: time.Since(probeStart)}
+}
+
 type probeResult struct {
+	dir      int // Index of the executable's directory in the scan's paths
 	path     string
+	modTime  time.Time // Of the executable when probed, zero if unknown
 	metadata *validator.AtipMetadata
+	source   string // "native", or "inferred" if adapted from --help
 	err      error
+	retries  int
+	elapsed  time.Duration
+	canceled bool // Not probed, or probe interrupted, because the scan's ctx was done
+}
+
+// Errors returned by Prober.Probe and Scanner.Scan, used to classify failures.
+var (
+	ErrProbeTimeout = errors.New("timeout")
+	ErrInvalidJSON  = errors.New("invalid JSON")
+	ErrValidation   = errors.New("validation failed")
+
+	ErrChecksumMismatch = errors.New("checksum mismatch")
+)
+
+// Error kinds reported in ScanError.Kind and ScanStats.ErrorsByKind.
+const (
+	ErrorKindTimeout        = "timeout"           // Probe exceeded the timeout
+	ErrorKindCrash          = "crash"             // Tool was killed by a signal
+	ErrorKindNoAgentSupport = "no_agent_support"  // Tool exited non-zero, usually because it lacks --agent
+	ErrorKindExec           = "exec_failed"       // Tool could not be started
+	ErrorKindInvalidJSON    = "invalid_json"      // Output was not ATIP JSON
+	ErrorKindValidation     = "validation"        // Metadata failed schema validation
+	ErrorKindChecksum       = "checksum_mismatch" // Executable doesn't match the hash its metadata declares
+)
+
+// ErrorKinds lists every ErrorKind constant.
+var ErrorKinds = []string{
+	ErrorKindTimeout,
+	ErrorKindCrash,
+	ErrorKindNoAgentSupport,
+	ErrorKindExec,
+	ErrorKindInvalidJSON,
+	ErrorKindValidation,
+	ErrorKindChecksum,
+}
+
+// ErrorKind classifies a probe or validation error into one of the
+// ErrorKind constants. Unrecognized errors are reported as exec_failed.
+func ErrorKind(err error) string {
+	var exitErr *exec.ExitError
+	switch {
+	case errors.Is(err, ErrProbeTimeout):
+		return ErrorKindTimeout
+	case errors.Is(err, ErrInvalidJSON):
+		return ErrorKindInvalidJSON
+	case errors.Is(err, ErrValidation):
+		return ErrorKindValidation
+	case errors.Is(err, ErrChecksumMismatch):
+		return ErrorKindChecksum
+	case errors.As(err, &exitErr):
+		if exitErr.ExitCode() == -1 {
+			return ErrorKindCrash
+		}
+		return ErrorKindNoAgentSupport
+	default:
+		return ErrorKindExec
+	}
 }
 
 // Prober executes tools with --agent flag to retrieve metadata.
 type Prober struct {
-	timeout time.Duration
+	timeout    time.Duration
+	overrides  map[string]time.Duration // Executable base name -> timeout
+	retries    int
+	retryDelay time.Duration
+	executor   Executor
+	cache      *ProbeCache
 }
 
-// NewProber creates a new prober.
-func NewProber(timeout time.Duration) *Prober {
-	return &Prober{timeout: timeout}
+// DefaultRetryDelay is the pause before a probe is retried.
+const DefaultRetryDelay = 200 * time.Millisecond
+
+// NewProber creates a new prober that runs tools through executor, or
+// locally with a LocalExecutor if executor is nil.
+func NewProber(timeout time.Duration, executor Executor) *Prober {
+	if executor == nil {
+		executor = LocalExecutor{}
+	}
+	return &Prober{timeout: timeout, retryDelay: DefaultRetryDelay, executor: executor}
+}
+
+// SetRetries sets how many times a probe is retried after a transient
+// failure: the tool couldn't be started or didn't print ATIP JSON, as
+// happens on a cold start. Timeouts and non-zero exits, which mean the
+// tool doesn't support --agent, are not retried.
+func (p *Prober) SetRetries(n int) {
+	p.retries = n
+}
+
+// SetCache makes the prober reuse results from c for executables it, or
+// another prober sharing c, already ran (see ProbeCache). Probes and
+// adaptations from --help are cached separately. A nil cache runs every
+// probe.
+func (p *Prober) SetCache(c *ProbeCache) {
+	p.cache = c
+}
+
+// cacheModTime returns the modification time the cache keys path's
+// results by, or the zero time if there is no cache.
+func (p *Prober) cacheModTime(path string) time.Time {
+	if p.cache == nil {
+		return time.Time{}
+	}
+	return statModTime(path)
+}
+
+// SetTimeouts sets per-tool timeouts keyed by executable base name, e.g.
+// {"terraform": 10 * time.Second}, for tools slower than the default.
+func (p *Prober) SetTimeouts(overrides map[string]time.Duration) {
+	p.overrides = overrides
+}
+
+// Timeout returns the timeout for probing the executable at path: its
+// override if there is one, otherwise the default.
+func (p *Prober) Timeout(path string) time.Duration {
+	if timeout, ok := p.overrides[filepath.Base(path)]; ok {
+		return timeout
+	}
+	return p.timeout
 }
 
 // Probe executes a tool with --agent flag and returns parsed ATIP metadata.
-// Respects the configured timeout and validates the JSON output.
+// Respects the tool's timeout (see Timeout) and validates the JSON output,
+// retrying transient failures (see SetRetries).
 // Returns an error if the tool doesn't support --agent, times out, or returns invalid JSON.
 func (p *Prober) Probe(ctx context.Context, path string) (*validator.AtipMetadata, error) {
-	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	metadata, _, err := p.ProbeWithRetries(ctx, path)
+	return metadata, err
+}
+
+// ProbeWithRetries is Probe, also reporting how many retries were made.
+func (p *Prober) ProbeWithRetries(ctx context.Context, path string) (*validator.AtipMetadata, int, error) {
+	return p.probeWithRetries(ctx, path, p.cacheModTime(path))
+}
+
+// probeWithRetries implements ProbeWithRetries, caching the result under
+// modTime.
+func (p *Prober) probeWithRetries(ctx context.Context, path string, modTime time.Time) (*validator.AtipMetadata, int, error) {
+	return p.cache.do(ctx, path, modTime, "--agent", func() (*validator.AtipMetadata, int, error) {
+		for retries := 0; ; retries++ {
+			metadata, err := p.probeOnce(ctx, path)
+			if err == nil || retries >= p.retries || !transient(err) {
+				return metadata, retries, err
+			}
+
+			select {
+			case <-ctx.Done():
+				return nil, retries, err
+			case <-time.After(p.retryDelay):
+			}
+		}
+	})
+}
+
+// transient reports whether a probe failure may not recur on a retry.
+func transient(err error) bool {
+	switch ErrorKind(err) {
+	case ErrorKindInvalidJSON, ErrorKindExec:
+		return true
+	}
+	return false
+}
+
+// probeOnce runs the tool with --agent a single time.
+func (p *Prober) probeOnce(ctx context.Context, path string) (*validator.AtipMetadata, error) {
+	timeout := p.Timeout(path)
+	ctx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 
-	cmd := exec.CommandContext(ctx, path, "--agent")
-	output, err := cmd.Output()
+	output, err := p.executor.Run(ctx, path, []string{"--agent"})
 
 	if ctx.Err() == context.DeadlineExceeded {
-		return nil, fmt.Errorf("timeout after %s", p.timeout)
+		return nil, fmt.Errorf("%w after %s", ErrProbeTimeout, timeout)
 	}
 
 	if err != nil {
@@ -184,21 +618,202 @@ func (p *Prober) Probe(ctx context.Context, path string) (*validator.AtipMetadat
 
 	metadata, err := validator.ParseJSON(output)
 	if err != nil {
-		return nil, fmt.Errorf("invalid JSON: %w", err)
+		return nil, fmt.Errorf("%w: %w", ErrInvalidJSON, err)
 	}
 
 	return metadata, nil
 }
 
+// HostPlatform returns the platform this binary runs on, as "GOOS-GOARCH".
+func HostPlatform() string {
+	return runtime.GOOS + "-" + runtime.GOARCH
+}
+
+// Platform returns the platform a probed tool declares in binary.platform,
+// falling back to the host platform.
+func Platform(metadata *validator.AtipMetadata) string {
+	if metadata != nil && metadata.Binary != nil && metadata.Binary.Platform != "" {
+		return metadata.Binary.Platform
+	}
+	return HostPlatform()
+}
+
+// Reasons an executable is skipped, as reported in PlannedExecutable.Reason.
+const (
+	SkipReasonSkipList    = "skip-list"   // Its name matches a skip list pattern
+	SkipReasonNotAllowed  = "not-allowed" // Its name matches no pattern of the probe allowlist
+	SkipReasonIncremental = "incremental" // It hasn't changed since it was last registered
+)
+
+// PlannedExecutable is an executable a scan would find, and whether it
+// would be probed or skipped and why.
+type PlannedExecutable struct {
+	Path    string `json:"path"`
+	Probe   bool   `json:"probe"`
+	Reason  string `json:"reason,omitempty"`  // One of the SkipReason constants when skipped
+	Pattern string `json:"pattern,omitempty"` // Skip list pattern the name matched
+}
+
+// PlannedDir is a directory a scan would read and what it would do with each
+// executable in it.
+type PlannedDir struct {
+	Path        string              `json:"path"`
+	Executables []PlannedExecutable `json:"executables"`
+	Error       string              `json:"error,omitempty"` // Set if the directory could not be read
+
+	// Nested directories that would be read, with a max depth above 1
+	Subdirectories []string `json:"subdirectories,omitempty"`
+}
+
+// Plan enumerates the executables in paths and decides, as Scan does, which
+// to probe and which to skip, without probing any. Scan follows the plan, so
+// it explains why a tool is or isn't discovered.
+func (s *Scanner) Plan(paths []string, incremental bool, existingRegistry map[string]time.Time) []PlannedDir {
+	plan := make([]PlannedDir, 0, len(paths))
+	for _, dir := range paths {
+		planned := PlannedDir{Path: dir, Executables: []PlannedExecutable{}}
+
+		var execs []string
+		walked := s.walk(context.Background(), dir, func(path string) { execs = append(execs, path) })
+		if walked.err != nil {
+			planned.Error = walked.err.Error()
+		}
+		planned.Subdirectories = walked.subdirs
+		sort.Strings(execs)
+		for _, exec := range execs {
+			planned.Executables = append(planned.Executables, s.planExecutable(exec, incremental, existingRegistry))
+		}
+
+		plan = append(plan, planned)
+	}
+	return plan
+}
+
+// planExecutable decides whether to probe exec.
+func (s *Scanner) planExecutable(exec string, incremental bool, existingRegistry map[string]time.Time) PlannedExecutable {
+	planned := PlannedExecutable{Path: exec}
+	if pattern, ok := MatchSkipList(filepath.Base(exec), s.skipList); ok {
+		planned.Reason = SkipReasonSkipList
+		planned.Pattern = pattern
+		return planned
+	}
+	if s.probeAllow != nil && !MatchesSkipList(filepath.Base(exec), s.probeAllow) {
+		planned.Reason = SkipReasonNotAllowed
+		return planned
+	}
+
+	// Check if changed for incremental mode
+	if incremental {
+		if modTime, exists := existingRegistry[exec]; exists {
+			info, err := os.Stat(exec)
+			if err == nil && !info.ModTime().After(modTime) {
+				planned.Reason = SkipReasonIncremental
+				return planned
+			}
+		}
+	}
+
+	planned.Probe = true
+	return planned
+}
+
 // ScanResult holds the outcome of a discovery scan.
 type ScanResult struct {
-	Discovered int              `json:"discovered"`
-	Updated    int              `json:"updated"`
-	Failed     int              `json:"failed"`
-	Skipped    int              `json:"skipped"`
-	DurationMs int64            `json:"duration_ms"`
-	Tools      []DiscoveredTool `json:"tools"`
-	Errors     []ScanError      `json:"errors"`
+	Discovered     int              `json:"discovered"`
+	Updated        int              `json:"updated"`
+	Failed         int              `json:"failed"`
+	Skipped        int              `json:"skipped"`
+	Removed        int              `json:"removed"`
+	Unsupported    int              `json:"unsupported"`      // Tools outside the supported ATIP versions
+	NoAgentSupport int              `json:"no_agent_support"` // Failures of kind no_agent_support, counted in Failed too
+	DurationMs     int64            `json:"duration_ms"`
+	Tools          []DiscoveredTool `json:"tools"`
+	Errors         []ScanError      `json:"errors"`
+	Directories    []DirStat        `json:"directories"`
+	Stats          ScanStats        `json:"stats"`
+	NotAllowed     []string         `json:"not_allowed,omitempty"` // Executables not probed because the probe allowlist doesn't match them, counted in Skipped too
+
+	// Directories that couldn't be read, or only partly, e.g. because they
+	// vanished mid-scan. Executables found before the error are still probed.
+	PathErrors []PathError `json:"path_errors,omitempty"`
+
+	// Subdirectories not enumerated because they aren't safe paths, with a
+	// max depth above 1 (see Scanner.SetMaxDepth)
+	UnsafeDirs []string `json:"unsafe_dirs,omitempty"`
+
+	// Set when the scan stopped early because its deadline passed; the
+	// result then covers only the probes that finished in time
+	DeadlineExceeded bool `json:"deadline_exceeded"`
+	Unprobed         int  `json:"unprobed,omitempty"` // Executables not probed, or whose probe was cut short, because the scan stopped early
+}
+
+// FilterErrors keeps only the errors whose Kind is in kinds. Counts such as
+// Failed and Stats.ErrorsByKind still include the removed errors.
+func (r *ScanResult) FilterErrors(kinds []string) {
+	filtered := []ScanError{}
+	for _, scanErr := range r.Errors {
+		for _, kind := range kinds {
+			if scanErr.Kind == kind {
+				filtered = append(filtered, scanErr)
+				break
+			}
+		}
+	}
+	r.Errors = filtered
+}
+
+// ScanStats summarizes probe activity, e.g. to tune --timeout and --parallel.
+type ScanStats struct {
+	Enumerated    int            `json:"enumerated"`     // Executables found in the scanned directories
+	DirsTraversed int            `json:"dirs_traversed"` // Directories enumerated, scan paths and their subdirectories
+	Probed        int            `json:"probed"`         // Executables run with --agent, after skips
+	AvgProbeMs    float64        `json:"avg_probe_ms"`   // Mean wall time per probe
+	Retries       int            `json:"retries"`        // Probes re-run after a transient failure
+	ErrorsByKind  map[string]int `json:"errors_by_kind"` // Failure counts keyed by ErrorKind
+}
+
+// DirStat breaks down scan results for a single scanned directory.
+type DirStat struct {
+	Path        string `json:"path"`
+	Executables int    `json:"executables"`
+	Discovered  int    `json:"discovered"`
+	Skipped     int    `json:"skipped"`
+	Failed      int    `json:"failed"`
+	Error       string `json:"error,omitempty"` // Set if the directory could not be read
+
+	// Nested directories enumerated, with a max depth above 1; their
+	// executables are counted in this directory's stats
+	Subdirectories []string `json:"subdirectories,omitempty"`
+}
+
+// Reasons a scan path couldn't be read, reported in PathError.Reason.
+const (
+	PathErrorNotFound     = "not_found"         // The directory doesn't exist, e.g. an unmounted volume
+	PathErrorPermission   = "permission_denied" // The directory can't be listed
+	PathErrorNotDirectory = "not_a_directory"   // The path is a file
+	PathErrorReadFailed   = "read_failed"       // Any other failure, e.g. an I/O error mid-read
+)
+
+// PathError records a scan path whose directory couldn't be read, so that
+// "no tools here" can be told apart from "couldn't look here".
+type PathError struct {
+	Path   string `json:"path"`
+	Reason string `json:"reason"` // One of the PathError constants
+	Error  string `json:"error"`
+}
+
+// NewPathError describes the failure to read the directory at path.
+func NewPathError(path string, err error) PathError {
+	reason := PathErrorReadFailed
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		reason = PathErrorNotFound
+	case errors.Is(err, fs.ErrPermission):
+		reason = PathErrorPermission
+	case errors.Is(err, syscall.ENOTDIR):
+		reason = PathErrorNotDirectory
+	}
+	return PathError{Path: path, Reason: reason, Error: err.Error()}
 }
 
 // DiscoveredTool represents a tool found during scanning.
@@ -206,19 +821,46 @@ type DiscoveredTool struct {
 	Name         string    `json:"name"`
 	Version      string    `json:"version"`
 	Path         string    `json:"path"`
-	Source       string    `json:"source"`
+	Source       string    `json:"source"`                // "native", or "inferred" from --help (see Scanner.SetAdaptHelp)
+	Platform     string    `json:"platform"`              // e.g. "linux-amd64"
+	AtipVersion  string    `json:"atip_version"`          // ATIP spec version the tool declares
+	Unsupported  bool      `json:"unsupported,omitempty"` // AtipVersion outside the supported range
+	Retries      int       `json:"retries,omitempty"`     // Probes retried before this one succeeded
 	DiscoveredAt time.Time `json:"discovered_at"`
+	ModTime      time.Time `json:"-"` // Of the executable when probed, zero if unknown
+
+	Metadata *validator.AtipMetadata `json:"-"` // As probed or inferred, for caching
 }
 
 // ScanError represents a failed probe.
 type ScanError struct {
 	Path  string `json:"path"`
+	Kind  string `json:"kind"` // One of the ErrorKind constants
 	Error string `json:"error"`
 }
 
+// SafePathOptions relaxes the ownership rules applied by IsSafePathWithOptions.
+// The zero value is the strict default: only directories owned by the current
+// user or root are considered safe.
+type SafePathOptions struct {
+	TrustedUIDs []uint32 // Additional directory owners to trust
+	TrustedGIDs []uint32 // Groups whose directories are trusted regardless of owner
+}
+
 // IsSafePath checks if a path is safe to scan based on ownership and permissions.
 // Returns false if the path is world-writable, owned by another user, or is the current directory.
 func IsSafePath(path string) (bool, error) {
+	return IsSafePathWithOptions(path, SafePathOptions{})
+}
+
+// IsSafePathWithOptions checks if a path is safe to scan, additionally trusting
+// directories owned by any of the configured UIDs or GIDs. World-writable
+// directories are always rejected, whatever their owner.
+//
+// On Windows, a directory whose ACL lets Everyone or Authenticated Users
+// write to it counts as world-writable. Ownership is not checked and the
+// trusted UIDs/GIDs are ignored.
+func IsSafePathWithOptions(path string, opts SafePathOptions) (bool, error) {
 	// Reject current directory
 	if path == "." || path == "" {
 		return false, fmt.Errorf("current directory not allowed")
@@ -229,76 +871,325 @@ func IsSafePath(path string) (bool, error) {
 		return false, fmt.Errorf("failed to stat path %s: %w", path, err)
 	}
 
-	// Check world-writable (on Unix systems)
-	if runtime.GOOS != "windows" {
-		if info.Mode()&0002 != 0 {
-			return false, fmt.Errorf("world-writable directory")
+	if err := checkPermissions(path, info, opts); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// isTrustedOwner reports whether a directory with the given owner and group
+// may be scanned: it must belong to the current user, root, a trusted UID,
+// or a trusted GID.
+func isTrustedOwner(uid, gid uint32, opts SafePathOptions) bool {
+	if uid == uint32(os.Getuid()) || uid == 0 {
+		return true
+	}
+	for _, trusted := range opts.TrustedUIDs {
+		if uid == trusted {
+			return true
+		}
+	}
+	for _, trusted := range opts.TrustedGIDs {
+		if gid == trusted {
+			return true
 		}
+	}
+	return false
+}
 
-		// Check ownership
-		stat, ok := info.Sys().(*syscall.Stat_t)
-		if ok {
-			uid := os.Getuid()
-			if stat.Uid != uint32(uid) && stat.Uid != 0 {
-				return false, fmt.Errorf("directory owned by other user")
-			}
+// SplitPathList splits a PATH-style list using the OS list separator.
+// Empty and relative entries (including ".") are dropped, since they resolve
+// against the current directory. Duplicates are removed, preserving the order
+// of first occurrence. Returns the usable directories and the dropped entries.
+func SplitPathList(pathList string) ([]string, []string) {
+	var dirs, dropped []string
+	seen := make(map[string]bool)
+
+	for _, dir := range filepath.SplitList(pathList) {
+		if dir == "" || !filepath.IsAbs(dir) {
+			dropped = append(dropped, dir)
+			continue
+		}
+		dir = filepath.Clean(dir)
+		if seen[dir] {
+			continue
 		}
+		seen[dir] = true
+		dirs = append(dirs, dir)
 	}
 
-	return true, nil
+	return dirs, dropped
 }
 
+// EnumerateBatchSize is the number of directory entries StreamExecutables
+// reads, and buffers, at a time.
+const EnumerateBatchSize = 1024
+
+// enumerateParallelism is the number of entries EnumerateExecutables and
+// Scan check at once.
+const enumerateParallelism = 8
+
 // EnumerateExecutables finds all executables in a directory.
-// Returns a list of absolute paths to executable files.
+// Returns a list of absolute paths to executable files, sorted by name. If
+// the directory can't be read to the end, the executables found before the
+// error are returned with it.
 func EnumerateExecutables(dir string) ([]string, error) {
-	entries, err := os.ReadDir(dir)
+	paths, wait := StreamExecutables(context.Background(), dir, enumerateParallelism)
+	var executables []string
+	for path := range paths {
+		executables = append(executables, path)
+	}
+	sort.Strings(executables)
+	return executables, wait()
+}
+
+// StreamExecutables finds the executables in a directory like
+// EnumerateExecutables, for directories too big to read in one go. It reads
+// EnumerateBatchSize entries at a time, checks each batch with up to
+// parallelism goroutines, and sends the executables' paths as each batch is
+// checked, in name order within the batch, so callers can start on them
+// before the directory has been read. The channel is closed when the
+// directory is exhausted, reading it fails or ctx is done; wait then returns
+// the error that stopped it, if any.
+func StreamExecutables(ctx context.Context, dir string, parallelism int) (paths <-chan string, wait func() error) {
+	return streamDir(ctx, dir, parallelism, nil)
+}
+
+// streamDir implements StreamExecutables, also appending the directory's
+// subdirectories to subdirs, if not nil, by the time wait returns.
+func streamDir(ctx context.Context, dir string, parallelism int, subdirs *[]string) (paths <-chan string, wait func() error) {
+	if parallelism < 1 {
+		parallelism = 1
+	}
+	out := make(chan string, EnumerateBatchSize)
+	var streamErr error
+	go func() {
+		defer close(out)
+		streamErr = streamExecutables(ctx, dir, parallelism, out, subdirs)
+	}()
+	// streamErr is set before out is closed, so it's safe to read once the
+	// caller has drained out
+	return out, func() error { return streamErr }
+}
+
+// streamExecutables sends the executables in dir to out, batch by batch,
+// and appends its subdirectories to subdirs if not nil. DirEntry.IsDir is
+// false for a symlink, so symlinked directories aren't among them.
+func streamExecutables(ctx context.Context, dir string, parallelism int, out chan<- string, subdirs *[]string) error {
+	f, err := os.Open(dir)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read directory %s: %w", dir, err)
+		return fmt.Errorf("failed to read directory %s: %w", dir, err)
 	}
+	defer f.Close()
 
-	var executables []string
-	for _, entry := range entries {
-		if entry.IsDir() {
-			continue
+	executable := make([]bool, EnumerateBatchSize)
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
 		}
+		entries, readErr := f.ReadDir(EnumerateBatchSize)
+		sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
 
-		path := filepath.Join(dir, entry.Name())
-		info, err := entry.Info()
-		if err != nil {
-			continue
+		// Check the batch in parallel, a contiguous chunk per goroutine,
+		// then send its executables in order
+		var wg sync.WaitGroup
+		chunk := (len(entries) + parallelism - 1) / parallelism
+		for lo := 0; lo < len(entries); lo += chunk {
+			hi := min(lo+chunk, len(entries))
+			wg.Add(1)
+			go func(lo, hi int) {
+				defer wg.Done()
+				for i := lo; i < hi; i++ {
+					executable[i] = isExecutable(dir, entries[i])
+				}
+			}(lo, hi)
 		}
+		wg.Wait()
 
-		// Check if executable
-		if runtime.GOOS == "windows" {
-			// On Windows, check file extension
-			ext := strings.ToLower(filepath.Ext(entry.Name()))
-			if ext == ".exe" || ext == ".bat" || ext == ".cmd" {
-				executables = append(executables, path)
+		for i, entry := range entries {
+			if subdirs != nil && entry.IsDir() {
+				*subdirs = append(*subdirs, filepath.Join(dir, entry.Name()))
+			}
+			if !executable[i] {
+				continue
 			}
-		} else {
-			// On Unix, check executable bit
-			if info.Mode()&0111 != 0 {
-				executables = append(executables, path)
+			select {
+			case out <- filepath.Join(dir, entry.Name()):
+			case <-ctx.Done():
+				return ctx.Err()
 			}
 		}
+
+		if readErr == io.EOF {
+			return nil
+		}
+		if readErr != nil {
+			return fmt.Errorf("failed to read directory %s: %w", dir, readErr)
+		}
 	}
+}
+
+// walkResult records the directories a walk read under a scan path.
+type walkResult struct {
+	dirs    int         // Directories read, including dir itself
+	subdirs []string    // Subdirectories enumerated, in walk order
+	unsafe  []string    // Subdirectories skipped as unsafe
+	errs    []PathError // Directories that couldn't be read, or only partly
+	err     error       // The error reading the scan path itself, if any
+}
 
-	return executables, nil
+// walk enumerates the executables in dir and, down to the scanner's max
+// depth, its safe subdirectories, calling fn with each as it is found.
+// Directories are read a level at a time, each level in name order. The
+// walk stops, without reporting an error, once ctx is done.
+func (s *Scanner) walk(ctx context.Context, dir string, fn func(path string)) walkResult {
+	var walked walkResult
+	level := []string{dir}
+	for depth := 1; len(level) > 0; depth++ {
+		var next []string
+		for _, d := range level {
+			if ctx.Err() != nil {
+				return walked
+			}
+			if depth > 1 {
+				if safe, err := IsSafePathWithOptions(d, s.safePaths); err != nil || !safe {
+					walked.unsafe = append(walked.unsafe, d)
+					continue
+				}
+				walked.subdirs = append(walked.subdirs, d)
+			}
+
+			var subdirs *[]string
+			if depth < s.maxDepth {
+				subdirs = &next
+			}
+			walked.dirs++
+			paths, wait := streamDir(ctx, d, enumerateParallelism, subdirs)
+			for path := range paths {
+				fn(path)
+			}
+			if err := wait(); err != nil {
+				if ctx.Err() != nil {
+					return walked
+				}
+				walked.errs = append(walked.errs, NewPathError(d, err))
+				if depth == 1 {
+					walked.err = err
+				}
+			}
+		}
+		level = next
+	}
+	return walked
+}
+
+// isExecutable reports whether a directory entry in dir is an executable
+// file: on Windows by its extension, elsewhere by its executable bits. A
+// symlink to a directory is not one.
+func isExecutable(dir string, entry os.DirEntry) bool {
+	if entry.IsDir() {
+		return false
+	}
+	if entry.Type()&fs.ModeSymlink != 0 {
+		if target, err := os.Stat(filepath.Join(dir, entry.Name())); err == nil && target.IsDir() {
+			return false
+		}
+	}
+	info, err := entry.Info()
+	if err != nil {
+		return false
+	}
+	if runtime.GOOS == "windows" {
+		ext := strings.ToLower(filepath.Ext(entry.Name()))
+		return ext == ".exe" || ext == ".bat" || ext == ".cmd"
+	}
+	return info.Mode()&0111 != 0
+}
+
+// SkipRegexPrefix marks a skip list pattern as a regular expression.
+const SkipRegexPrefix = "re:"
+
+// skipRegexps caches compiled skip list regular expressions by source.
+var skipRegexps sync.Map
+
+// compileSkipRegex compiles a skip list regular expression, anchored so it
+// must match the whole tool name like a glob does.
+func compileSkipRegex(expr string) (*regexp.Regexp, error) {
+	if re, ok := skipRegexps.Load(expr); ok {
+		return re.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile("^(?:" + expr + ")$")
+	if err != nil {
+		return nil, err
+	}
+	skipRegexps.Store(expr, re)
+	return re, nil
+}
+
+// ValidateSkipList checks that every "re:" pattern in skipList compiles.
+func ValidateSkipList(skipList []string) error {
+	for _, skip := range skipList {
+		if expr, ok := strings.CutPrefix(skip, SkipRegexPrefix); ok {
+			if _, err := compileSkipRegex(expr); err != nil {
+				return fmt.Errorf("invalid skip pattern %q: %w", skip, err)
+			}
+		}
+	}
+	return nil
+}
+
+// LoadSkipFile reads newline-delimited skip patterns from path. Blank lines
+// and lines starting with "#" are ignored, and surrounding whitespace is
+// trimmed. Invalid regular expressions are reported with their line number.
+func LoadSkipFile(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	patterns := []string{}
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if err := ValidateSkipList([]string{line}); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, i+1, err)
+		}
+		patterns = append(patterns, line)
+	}
+	return patterns, nil
 }
 
 // MatchesSkipList checks if a tool name matches any pattern in the skip list.
-// Supports both exact matches and glob patterns (e.g., "test*").
+// Supports exact matches, glob patterns (e.g., "test*") and regular
+// expressions prefixed with "re:" (e.g., "re:test-[0-9]+"), which must
+// match the whole name. Invalid regular expressions never match.
 func MatchesSkipList(toolName string, skipList []string) bool {
+	_, ok := MatchSkipList(toolName, skipList)
+	return ok
+}
+
+// MatchSkipList is MatchesSkipList, also returning the first pattern that
+// matched.
+func MatchSkipList(toolName string, skipList []string) (string, bool) {
 	for _, skip := range skipList {
+		if expr, ok := strings.CutPrefix(skip, SkipRegexPrefix); ok {
+			if re, err := compileSkipRegex(expr); err == nil && re.MatchString(toolName) {
+				return skip, true
+			}
+			continue
+		}
+
 		// Support glob patterns
 		matched, err := filepath.Match(skip, toolName)
 		if err == nil && matched {
-			return true
+			return skip, true
 		}
 		// Exact match
 		if skip == toolName {
-			return true
+			return skip, true
 		}
 	}
-	return false
+	return "", false
 }
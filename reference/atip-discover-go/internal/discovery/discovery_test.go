@@ -2,11 +2,18 @@ package discovery
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/atip/atip-discover/internal/clock"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -103,6 +110,88 @@ func TestScanner_Scan_Timeout(t *testing.T) {
 	assert.Contains(t, result.Errors[0].Error, "timeout")
 }
 
+func TestScanner_Scan_TimeoutOverride(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	// Both tools take longer than the global timeout to respond
+	for _, name := range []string{"slow-tool", "other-slow-tool"} {
+		script := `#!/bin/sh
+sleep 0.5
+echo '{"atip": {"version": "0.6"}, "name": "` + name + `", "version": "1.0.0", "description": "Slow tool"}'
+`
+		require.NoError(t, os.WriteFile(filepath.Join(tmpDir, name), []byte(script), 0755))
+	}
+
+	scanner, err := NewScanner(100*time.Millisecond, 2, nil)
+	require.NoError(t, err)
+	scanner.SetTimeouts(map[string]time.Duration{"slow-tool": 5 * time.Second})
+
+	result, err := scanner.Scan(context.Background(), []string{tmpDir}, false, nil)
+	require.NoError(t, err)
+
+	require.Len(t, result.Tools, 1)
+	assert.Equal(t, "slow-tool", result.Tools[0].Name)
+	require.Len(t, result.Errors, 1)
+	assert.Equal(t, filepath.Join(tmpDir, "other-slow-tool"), result.Errors[0].Path)
+	assert.Equal(t, ErrorKindTimeout, result.Errors[0].Kind)
+}
+
+func TestScanner_Scan_Deadline(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	// Two tools answer at once; twenty more hang far beyond the deadline.
+	// Plain sleep (no exec) leaves a child holding stdout after the kill.
+	for _, name := range []string{"fast-a", "fast-b"} {
+		script := `#!/bin/sh
+echo '{"atip": {"version": "0.6"}, "name": "` + name + `", "version": "1.0.0", "description": "Fast tool"}'
+`
+		require.NoError(t, os.WriteFile(filepath.Join(tmpDir, name), []byte(script), 0755))
+	}
+	for i := 0; i < 20; i++ {
+		script := "#!/bin/sh\nsleep 10\n"
+		require.NoError(t, os.WriteFile(filepath.Join(tmpDir, fmt.Sprintf("slow-%02d", i)), []byte(script), 0755))
+	}
+
+	scanner, err := NewScanner(30*time.Second, 4, nil)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	result, err := scanner.Scan(ctx, []string{tmpDir}, false, nil)
+	require.NoError(t, err)
+
+	// Without the deadline this would take 50s at 4 probes at a time
+	assert.Less(t, time.Since(start), 3*time.Second)
+	assert.True(t, result.DeadlineExceeded)
+	assert.Equal(t, 2, result.Discovered)
+	assert.Equal(t, 0, result.Failed, "interrupted probes are not failures")
+	assert.Empty(t, result.Errors)
+	assert.Equal(t, 20, result.Unprobed)
+	assert.Equal(t, 2, result.Stats.Probed)
+	assert.Equal(t, 22, result.Stats.Enumerated)
+}
+
+func TestScanner_Scan_NoDeadline(t *testing.T) {
+	tmpDir := t.TempDir()
+	script := `#!/bin/sh
+echo '{"atip": {"version": "0.6"}, "name": "quick-tool", "version": "1.0.0", "description": "Quick tool"}'
+`
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "quick-tool"), []byte(script), 0755))
+
+	scanner, err := NewScanner(2*time.Second, 1, nil)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	result, err := scanner.Scan(ctx, []string{tmpDir}, false, nil)
+	require.NoError(t, err)
+
+	assert.False(t, result.DeadlineExceeded)
+	assert.Zero(t, result.Unprobed)
+	assert.Equal(t, 1, result.Discovered)
+}
+
 func TestScanner_Scan_Parallel(t *testing.T) {
 	tmpDir := t.TempDir()
 
@@ -129,8 +218,507 @@ func TestScanner_Scan_Parallel(t *testing.T) {
 	t.Logf("Scan took %v with parallelism=4", duration)
 }
 
+func TestScanner_Scan_DirectoryBreakdown(t *testing.T) {
+	dirA := t.TempDir()
+	dirB := t.TempDir()
+
+	atipScript := `#!/bin/sh
+if [ "$1" = "--agent" ]; then
+  echo '{"atip": {"version": "0.6"}, "name": "a-tool", "version": "1.0.0", "description": "A tool", "commands": {"run": {"description": "Run", "effects": {"network": false}}}}'
+fi
+`
+	// dirA: one ATIP tool, one skipped tool
+	require.NoError(t, os.WriteFile(filepath.Join(dirA, "a-tool"), []byte(atipScript), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dirA, "skip-me"), []byte(atipScript), 0755))
+
+	// dirB: one failing tool and a non-executable file
+	require.NoError(t, os.WriteFile(filepath.Join(dirB, "broken"), []byte("#!/bin/sh\nexit 1\n"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dirB, "README"), []byte("docs"), 0644))
+
+	missing := filepath.Join(dirB, "does-not-exist")
+
+	scanner, err := NewScanner(2*time.Second, 2, []string{"skip-me"})
+	require.NoError(t, err)
+
+	result, err := scanner.Scan(context.Background(), []string{dirA, dirB, missing}, false, nil)
+	require.NoError(t, err)
+
+	require.Len(t, result.Directories, 3)
+	assert.Equal(t, DirStat{Path: dirA, Executables: 2, Discovered: 1, Skipped: 1}, result.Directories[0])
+	assert.Equal(t, DirStat{Path: dirB, Executables: 1, Failed: 1}, result.Directories[1])
+	assert.Equal(t, missing, result.Directories[2].Path)
+	assert.NotEmpty(t, result.Directories[2].Error)
+}
+
+func TestScanner_Scan_PathErrors(t *testing.T) {
+	good := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(good, "broken"), []byte("#!/bin/sh\nexit 1\n"), 0755))
+	missing := filepath.Join(t.TempDir(), "unmounted")
+
+	scanner, err := NewScanner(2*time.Second, 2, nil)
+	require.NoError(t, err)
+
+	result, err := scanner.Scan(context.Background(), []string{missing, good}, false, nil)
+	require.NoError(t, err)
+
+	// The good directory is still scanned
+	assert.Equal(t, 1, result.Failed)
+	require.Len(t, result.PathErrors, 1)
+	assert.Equal(t, missing, result.PathErrors[0].Path)
+	assert.Equal(t, PathErrorNotFound, result.PathErrors[0].Reason)
+	assert.NotEmpty(t, result.PathErrors[0].Error)
+}
+
+func TestScanner_Scan_MaxDepth(t *testing.T) {
+	root := t.TempDir()
+	nested := filepath.Join(root, "go", "bin")
+	require.NoError(t, os.MkdirAll(nested, 0755))
+	atipScript := `#!/bin/sh
+if [ "$1" = "--agent" ]; then
+  echo '{"atip": {"version": "0.6"}, "name": "gopls", "version": "0.15.0", "description": "Go language server", "commands": {"run": {"description": "Run", "effects": {"network": false}}}}'
+fi
+`
+	require.NoError(t, os.WriteFile(filepath.Join(nested, "gopls"), []byte(atipScript), 0755))
+
+	// A symlink back up the tree and a world-writable directory aren't followed
+	require.NoError(t, os.Symlink(root, filepath.Join(root, "loop")))
+	unsafe := filepath.Join(root, "shared")
+	require.NoError(t, os.Mkdir(unsafe, 0755))
+	require.NoError(t, os.Chmod(unsafe, 0777))
+	require.NoError(t, os.WriteFile(filepath.Join(unsafe, "gopls"), []byte(atipScript), 0755))
+
+	scanner, err := NewScanner(2*time.Second, 2, nil)
+	require.NoError(t, err)
+
+	// The default depth only reads the scan path itself
+	result, err := scanner.Scan(context.Background(), []string{root}, false, nil)
+	require.NoError(t, err)
+	assert.Empty(t, result.Tools)
+	assert.Equal(t, 1, result.Stats.DirsTraversed)
+	assert.Empty(t, result.Directories[0].Subdirectories)
+
+	scanner.SetMaxDepth(2, SafePathOptions{})
+	result, err = scanner.Scan(context.Background(), []string{root}, false, nil)
+	require.NoError(t, err)
+	assert.Empty(t, result.Tools)
+	assert.Equal(t, []string{filepath.Join(root, "go")}, result.Directories[0].Subdirectories)
+	assert.Equal(t, []string{unsafe}, result.UnsafeDirs)
+
+	scanner.SetMaxDepth(3, SafePathOptions{})
+	result, err = scanner.Scan(context.Background(), []string{root}, false, nil)
+	require.NoError(t, err)
+	require.Len(t, result.Tools, 1)
+	assert.Equal(t, filepath.Join(nested, "gopls"), result.Tools[0].Path)
+	assert.Equal(t, []string{filepath.Join(root, "go"), nested}, result.Directories[0].Subdirectories)
+	assert.Equal(t, 1, result.Directories[0].Discovered)
+	assert.Equal(t, 3, result.Stats.DirsTraversed)
+	assert.Equal(t, []string{unsafe}, result.UnsafeDirs)
+
+	plan := scanner.Plan([]string{root}, false, nil)
+	require.Len(t, plan, 1)
+	assert.Equal(t, []PlannedExecutable{{Path: filepath.Join(nested, "gopls"), Probe: true}}, plan[0].Executables)
+}
+
+func TestNewPathError(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "file")
+	require.NoError(t, os.WriteFile(file, nil, 0644))
+
+	_, err := EnumerateExecutables(file)
+	assert.Equal(t, PathErrorNotDirectory, NewPathError(file, err).Reason)
+	_, err = EnumerateExecutables(filepath.Join(dir, "missing"))
+	assert.Equal(t, PathErrorNotFound, NewPathError(dir, err).Reason)
+	assert.Equal(t, PathErrorReadFailed, NewPathError(dir, errors.New("input/output error")).Reason)
+}
+
+func TestScanner_Plan(t *testing.T) {
+	dir := t.TempDir()
+	script := []byte("#!/bin/sh\necho test")
+	for _, name := range []string{"gh", "old-tool", "test-42", "unchanged"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), script, 0755))
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "README"), []byte("docs"), 0644))
+
+	unchanged := filepath.Join(dir, "unchanged")
+	info, err := os.Stat(unchanged)
+	require.NoError(t, err)
+	existing := map[string]time.Time{unchanged: info.ModTime()}
+
+	scanner, err := NewScanner(2*time.Second, 1, []string{"old-*", "re:test-[0-9]+"})
+	require.NoError(t, err)
+	missing := filepath.Join(dir, "missing")
+
+	// Plan doesn't probe: the executables only echo, so a probe would fail
+	plan := scanner.Plan([]string{dir, missing}, true, existing)
+	require.Len(t, plan, 2)
+	assert.Equal(t, []PlannedExecutable{
+		{Path: filepath.Join(dir, "gh"), Probe: true},
+		{Path: filepath.Join(dir, "old-tool"), Reason: SkipReasonSkipList, Pattern: "old-*"},
+		{Path: filepath.Join(dir, "test-42"), Reason: SkipReasonSkipList, Pattern: "re:test-[0-9]+"},
+		{Path: unchanged, Reason: SkipReasonIncremental},
+	}, plan[0].Executables)
+	assert.Equal(t, missing, plan[1].Path)
+	assert.Empty(t, plan[1].Executables)
+	assert.NotEmpty(t, plan[1].Error)
+
+	// Without incremental, unchanged tools are probed again
+	plan = scanner.Plan([]string{dir}, false, existing)
+	assert.True(t, plan[0].Executables[3].Probe)
+}
+
+func TestScanner_Scan_ProbeAllow(t *testing.T) {
+	dir := t.TempDir()
+	sentinels := t.TempDir()
+
+	// Each tool leaves a sentinel file behind if it is ever run
+	for _, name := range []string{"gh", "untrusted"} {
+		script := fmt.Sprintf(`#!/bin/sh
+touch %q
+if [ "$1" = "--agent" ]; then
+  echo '{"atip": {"version": "0.6"}, "name": "%s", "version": "1.0.0", "description": "Test tool", "commands": {"run": {"description": "Run", "effects": {"network": false}}}}'
+fi
+`, filepath.Join(sentinels, name), name)
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(script), 0755))
+	}
+
+	scanner, err := NewScanner(2*time.Second, 2, nil)
+	require.NoError(t, err)
+	require.NoError(t, scanner.SetProbeAllow([]string{"g*", "re:kube.*"}))
+
+	plan := scanner.Plan([]string{dir}, false, nil)
+	require.Len(t, plan[0].Executables, 2)
+	assert.True(t, plan[0].Executables[0].Probe)
+	assert.Equal(t, PlannedExecutable{Path: filepath.Join(dir, "untrusted"), Reason: SkipReasonNotAllowed}, plan[0].Executables[1])
+
+	result, err := scanner.Scan(context.Background(), []string{dir}, false, nil)
+	require.NoError(t, err)
+
+	require.Len(t, result.Tools, 1)
+	assert.Equal(t, "gh", result.Tools[0].Name)
+	assert.Equal(t, 1, result.Skipped)
+	assert.Equal(t, []string{filepath.Join(dir, "untrusted")}, result.NotAllowed)
+	assert.FileExists(t, filepath.Join(sentinels, "gh"))
+	assert.NoFileExists(t, filepath.Join(sentinels, "untrusted"), "a tool outside the allowlist was run")
+
+	// An empty allowlist probes everything again
+	require.NoError(t, scanner.SetProbeAllow(nil))
+	result, err = scanner.Scan(context.Background(), []string{dir}, false, nil)
+	require.NoError(t, err)
+	assert.Empty(t, result.NotAllowed)
+	assert.FileExists(t, filepath.Join(sentinels, "untrusted"))
+}
+
+func TestScanner_SetProbeAllow_Invalid(t *testing.T) {
+	scanner, err := NewScanner(2*time.Second, 1, nil)
+	require.NoError(t, err)
+	err = scanner.SetProbeAllow([]string{"gh", "re:("})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "re:(")
+}
+
+func TestScanner_Scan_SortedOutput(t *testing.T) {
+	tmpDir := t.TempDir()
+	names := []string{"tool-e", "tool-b", "tool-d", "tool-a", "tool-c"}
+	for _, name := range names {
+		script := fmt.Sprintf(`#!/bin/sh
+echo '{"atip":{"version":"0.6"},"name":"%s","version":"1.0.0","description":"test"}'
+`, name)
+		require.NoError(t, os.WriteFile(filepath.Join(tmpDir, name), []byte(script), 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "broken-"+name), []byte("#!/bin/sh\nexit 1\n"), 0755))
+	}
+
+	scanner, err := NewScanner(5*time.Second, 8, nil)
+	require.NoError(t, err)
+
+	// Probes finish in a different order each time; the output must not
+	for i := 0; i < 3; i++ {
+		result, err := scanner.Scan(context.Background(), []string{tmpDir}, false, nil)
+		require.NoError(t, err)
+
+		var tools, errs []string
+		for _, tool := range result.Tools {
+			tools = append(tools, tool.Name)
+		}
+		for _, scanErr := range result.Errors {
+			errs = append(errs, filepath.Base(scanErr.Path))
+		}
+		assert.Equal(t, []string{"tool-a", "tool-b", "tool-c", "tool-d", "tool-e"}, tools)
+		assert.Equal(t, []string{"broken-tool-a", "broken-tool-b", "broken-tool-c", "broken-tool-d", "broken-tool-e"}, errs)
+	}
+}
+
+func TestScanner_Scan_Stats(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	atipScript := `#!/bin/sh
+if [ "$1" = "--agent" ]; then
+  echo '{"atip": {"version": "0.6"}, "name": "a-tool", "version": "1.0.0", "description": "A tool", "commands": {"run": {"description": "Run", "effects": {"network": false}}}}'
+fi
+`
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "a-tool"), []byte(atipScript), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "skip-me"), []byte(atipScript), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "broken"), []byte("#!/bin/sh\nexit 1\n"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "garbage"), []byte("#!/bin/sh\necho nope\n"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "crasher"), []byte("#!/bin/sh\nkill -SEGV $$\n"), 0755))
+
+	scanner, err := NewScanner(2*time.Second, 2, []string{"skip-me"})
+	require.NoError(t, err)
+
+	result, err := scanner.Scan(context.Background(), []string{tmpDir}, false, nil)
+	require.NoError(t, err)
+
+	assert.Equal(t, 5, result.Stats.Enumerated)
+	assert.Equal(t, result.Stats.Enumerated-result.Skipped, result.Stats.Probed)
+	assert.Equal(t, 4, result.Stats.Probed)
+	assert.Greater(t, result.Stats.AvgProbeMs, 0.0)
+	assert.Equal(t, map[string]int{ErrorKindNoAgentSupport: 1, ErrorKindInvalidJSON: 1, ErrorKindCrash: 1}, result.Stats.ErrorsByKind)
+	assert.Equal(t, 1, result.NoAgentSupport)
+
+	kinds := map[string]string{}
+	for _, scanErr := range result.Errors {
+		kinds[filepath.Base(scanErr.Path)] = scanErr.Kind
+	}
+	assert.Equal(t, map[string]string{"broken": ErrorKindNoAgentSupport, "garbage": ErrorKindInvalidJSON, "crasher": ErrorKindCrash}, kinds)
+}
+
+func TestScanner_Scan_Progress(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	atipScript := `#!/bin/sh
+echo '{"atip": {"version": "0.6"}, "name": "a-tool", "version": "1.0.0", "description": "A tool", "commands": {"run": {"description": "Run", "effects": {"network": false}}}}'
+`
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "a-tool"), []byte(atipScript), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "broken"), []byte("#!/bin/sh\nexit 1\n"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "garbage"), []byte("#!/bin/sh\necho nope\n"), 0755))
+
+	scanner, err := NewScanner(2*time.Second, 3, nil)
+	require.NoError(t, err)
+	var events []ScanEvent
+	scanner.SetProgress(func(event ScanEvent) {
+		events = append(events, event)
+	})
+
+	result, err := scanner.Scan(context.Background(), []string{tmpDir}, false, nil)
+	require.NoError(t, err)
+
+	require.Len(t, events, 3)
+	var tools []DiscoveredTool
+	var errs []ScanError
+	for _, event := range events {
+		require.True(t, (event.Tool == nil) != (event.Error == nil), "exactly one of Tool and Error is set")
+		if event.Tool != nil {
+			tools = append(tools, *event.Tool)
+		} else {
+			errs = append(errs, *event.Error)
+		}
+	}
+	assert.ElementsMatch(t, result.Tools, tools)
+	assert.ElementsMatch(t, result.Errors, errs)
+}
+
+// fakeHasher hashes executables by looking them up, counting lookups.
+type fakeHasher struct {
+	mu     sync.Mutex
+	hashes map[string]string
+	calls  int
+}
+
+func (h *fakeHasher) Hash(path string) (string, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.calls++
+	hash, ok := h.hashes[filepath.Base(path)]
+	if !ok {
+		return "", os.ErrNotExist
+	}
+	return hash, nil
+}
+
+func TestScanner_Scan_VerifyChecksums(t *testing.T) {
+	tmpDir := t.TempDir()
+	good := "sha256:" + strings.Repeat("ab", 32)
+	bad := "sha256:" + strings.Repeat("cd", 32)
+
+	declaring := func(name, hash string) string {
+		return `#!/bin/sh
+echo '{"atip": {"version": "0.6"}, "name": "` + name + `", "version": "1.0.0", "description": "A tool", "binary": {"hash": "` + hash + `"}, "commands": {}}'
+`
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "good"), []byte(declaring("good", strings.ToUpper(good))), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "bad"), []byte(declaring("bad", good)), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "undeclared"), []byte(`#!/bin/sh
+echo '{"atip": {"version": "0.6"}, "name": "undeclared", "version": "1.0.0", "description": "A tool", "commands": {}}'
+`), 0755))
+
+	scanner, err := NewScanner(2*time.Second, 2, nil)
+	require.NoError(t, err)
+	hasher := &fakeHasher{hashes: map[string]string{"good": strings.ToLower(good), "bad": bad}}
+	scanner.SetVerifyChecksums(hasher)
+
+	result, err := scanner.Scan(context.Background(), []string{tmpDir}, false, nil)
+	require.NoError(t, err)
+
+	var names []string
+	for _, tool := range result.Tools {
+		names = append(names, tool.Name)
+	}
+	assert.Equal(t, []string{"good", "undeclared"}, names)
+	require.Len(t, result.Errors, 1)
+	assert.Equal(t, "bad", filepath.Base(result.Errors[0].Path))
+	assert.Equal(t, ErrorKindChecksum, result.Errors[0].Kind)
+	assert.Contains(t, result.Errors[0].Error, bad)
+	assert.Equal(t, 2, hasher.calls, "tools without a declared hash aren't hashed")
+}
+
+func TestScanResult_FilterErrors(t *testing.T) {
+	result := &ScanResult{
+		Failed: 3,
+		Errors: []ScanError{
+			{Path: "/bin/a", Kind: ErrorKindTimeout},
+			{Path: "/bin/b", Kind: ErrorKindNoAgentSupport},
+			{Path: "/bin/c", Kind: ErrorKindCrash},
+		},
+	}
+
+	result.FilterErrors([]string{ErrorKindCrash, ErrorKindTimeout})
+	assert.Equal(t, []ScanError{{Path: "/bin/a", Kind: ErrorKindTimeout}, {Path: "/bin/c", Kind: ErrorKindCrash}}, result.Errors)
+	assert.Equal(t, 3, result.Failed)
+
+	result.FilterErrors(nil)
+	assert.NotNil(t, result.Errors)
+	assert.Empty(t, result.Errors)
+}
+
+func TestScanner_Scan_Platform(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	native := `#!/bin/sh
+echo '{"atip": {"version": "0.6"}, "name": "native-tool", "version": "1.0.0", "description": "A tool", "commands": {}}'
+`
+	declared := `#!/bin/sh
+echo '{"atip": {"version": "0.6"}, "name": "arm-tool", "version": "1.0.0", "description": "A tool", "binary": {"hash": "sha256:` + strings.Repeat("ab", 32) + `", "platform": "linux-arm64"}, "commands": {}}'
+`
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "native-tool"), []byte(native), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "arm-tool"), []byte(declared), 0755))
+
+	scanner, err := NewScanner(2*time.Second, 1, nil)
+	require.NoError(t, err)
+
+	result, err := scanner.Scan(context.Background(), []string{tmpDir}, false, nil)
+	require.NoError(t, err)
+	require.Len(t, result.Tools, 2, "errors: %v", result.Errors)
+
+	platforms := map[string]string{}
+	for _, tool := range result.Tools {
+		platforms[tool.Name] = tool.Platform
+	}
+	assert.Equal(t, map[string]string{
+		"native-tool": runtime.GOOS + "-" + runtime.GOARCH,
+		"arm-tool":    "linux-arm64",
+	}, platforms)
+}
+
+func TestScanner_Scan_AtipVersionRange(t *testing.T) {
+	tmpDir := t.TempDir()
+	tools := map[string]string{
+		"legacy-tool": `"0.3"`,
+		"mid-tool":    `"0.5"`,
+		"modern-tool": `{"version": "0.6"}`,
+	}
+	for name, atip := range tools {
+		script := fmt.Sprintf(`#!/bin/sh
+echo '{"atip": %s, "name": "%s", "version": "1.0.0", "description": "A tool"}'
+`, atip, name)
+		require.NoError(t, os.WriteFile(filepath.Join(tmpDir, name), []byte(script), 0755))
+	}
+
+	tests := []struct {
+		name        string
+		min, max    string
+		unsupported []string
+	}{
+		{name: "no range"},
+		{name: "minimum", min: "0.4", unsupported: []string{"legacy-tool"}},
+		{name: "maximum", max: "0.5", unsupported: []string{"modern-tool"}},
+		{name: "both", min: "0.5", max: "0.5", unsupported: []string{"legacy-tool", "modern-tool"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scanner, err := NewScanner(2*time.Second, 2, nil)
+			require.NoError(t, err)
+			require.NoError(t, scanner.SetAtipVersionRange(tt.min, tt.max))
+
+			result, err := scanner.Scan(context.Background(), []string{tmpDir}, false, nil)
+			require.NoError(t, err)
+
+			// Tools outside the range are still discovered, only flagged
+			require.Len(t, result.Tools, 3, "errors: %v", result.Errors)
+			var unsupported []string
+			versions := map[string]string{}
+			for _, tool := range result.Tools {
+				versions[tool.Name] = tool.AtipVersion
+				if tool.Unsupported {
+					unsupported = append(unsupported, tool.Name)
+				}
+			}
+			assert.Equal(t, tt.unsupported, unsupported)
+			assert.Equal(t, len(tt.unsupported), result.Unsupported)
+			assert.Equal(t, map[string]string{"legacy-tool": "0.3", "mid-tool": "0.5", "modern-tool": "0.6"}, versions)
+		})
+	}
+}
+
+func TestScanner_SetAtipVersionRange_Invalid(t *testing.T) {
+	scanner, err := NewScanner(2*time.Second, 1, nil)
+	require.NoError(t, err)
+
+	assert.Error(t, scanner.SetAtipVersionRange("latest", ""))
+	assert.Error(t, scanner.SetAtipVersionRange("", "0.6.0"))
+	assert.Error(t, scanner.SetAtipVersionRange("0.6", "0.4"))
+	assert.NoError(t, scanner.SetAtipVersionRange("0.4", "0.6"))
+}
+
+func TestScanner_SetClock(t *testing.T) {
+	tmpDir := t.TempDir()
+	script := `#!/bin/sh
+echo '{"atip": {"version": "0.6"}, "name": "tool", "version": "1.0.0", "description": "A tool"}'
+`
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "tool"), []byte(script), 0755))
+
+	now := time.Date(2026, 1, 5, 10, 30, 0, 0, time.UTC)
+	scanner, err := NewScanner(2*time.Second, 1, nil)
+	require.NoError(t, err)
+	scanner.SetClock(clock.NewFake(now))
+
+	result, err := scanner.Scan(context.Background(), []string{tmpDir}, false, nil)
+	require.NoError(t, err)
+	require.Len(t, result.Tools, 1, "errors: %v", result.Errors)
+	assert.Equal(t, now, result.Tools[0].DiscoveredAt)
+}
+
+func TestErrorKind(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{"timeout", fmt.Errorf("%w after 2s", ErrProbeTimeout), ErrorKindTimeout},
+		{"invalid json", fmt.Errorf("%w: %w", ErrInvalidJSON, errors.New("unexpected EOF")), ErrorKindInvalidJSON},
+		{"validation", fmt.Errorf("%w: missing name", ErrValidation), ErrorKindValidation},
+		{"exit", &exec.ExitError{ProcessState: &os.ProcessState{}}, ErrorKindNoAgentSupport},
+		{"exec", &os.PathError{Op: "fork/exec", Path: "/bin/x", Err: os.ErrPermission}, ErrorKindExec},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, ErrorKind(tt.err))
+		})
+	}
+}
+
 func TestNewProber(t *testing.T) {
-	p := NewProber(2 * time.Second)
+	p := NewProber(2*time.Second, nil)
 	assert.NotNil(t, p)
 }
 
@@ -160,7 +748,7 @@ fi
 	err := os.WriteFile(toolPath, []byte(script), 0755)
 	require.NoError(t, err)
 
-	p := NewProber(2 * time.Second)
+	p := NewProber(2*time.Second, nil)
 	ctx := context.Background()
 
 	metadata, err := p.Probe(ctx, toolPath)
@@ -182,11 +770,11 @@ fi
 	err := os.WriteFile(toolPath, []byte(script), 0755)
 	require.NoError(t, err)
 
-	p := NewProber(2 * time.Second)
+	p := NewProber(2*time.Second, nil)
 	ctx := context.Background()
 
 	_, err = p.Probe(ctx, toolPath)
-	assert.Error(t, err)
+	assert.ErrorIs(t, err, ErrInvalidJSON)
 }
 
 func TestProber_Probe_NoAgentSupport(t *testing.T) {
@@ -200,7 +788,7 @@ exit 1
 	err := os.WriteFile(toolPath, []byte(script), 0755)
 	require.NoError(t, err)
 
-	p := NewProber(2 * time.Second)
+	p := NewProber(2*time.Second, nil)
 	ctx := context.Background()
 
 	_, err = p.Probe(ctx, toolPath)
@@ -217,12 +805,117 @@ sleep 10
 	err := os.WriteFile(toolPath, []byte(script), 0755)
 	require.NoError(t, err)
 
-	p := NewProber(100 * time.Millisecond)
+	p := NewProber(100*time.Millisecond, nil)
 	ctx := context.Background()
 
 	_, err = p.Probe(ctx, toolPath)
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "timeout")
+	assert.ErrorIs(t, err, ErrProbeTimeout)
+}
+
+func TestProber_Timeout(t *testing.T) {
+	p := NewProber(2*time.Second, nil)
+	p.SetTimeouts(map[string]time.Duration{"terraform": 10 * time.Second})
+
+	assert.Equal(t, 10*time.Second, p.Timeout("/usr/local/bin/terraform"))
+	assert.Equal(t, 2*time.Second, p.Timeout("/usr/local/bin/gh"))
+	assert.Equal(t, 2*time.Second, p.Timeout("/opt/terraform/bin/tf"))
+}
+
+// writeFlakyTool writes a tool that appends to a log on each run and fails
+// with failure (a shell snippet) on its first failures runs.
+func writeFlakyTool(t *testing.T, dir, name string, failures int, failure string) (string, string) {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	log := filepath.Join(dir, name+".log")
+	script := fmt.Sprintf(`#!/bin/sh
+echo run >> '%s'
+if [ "$(wc -l < '%s')" -le %d ]; then
+  %s
+fi
+echo '{"atip": {"version": "0.6"}, "name": "%s", "version": "1.0.0", "description": "Flaky tool"}'
+`, log, log, failures, failure, name)
+	require.NoError(t, os.WriteFile(path, []byte(script), 0755))
+	return path, log
+}
+
+// runs counts the lines a flaky tool appended to its log.
+func runs(t *testing.T, log string) int {
+	t.Helper()
+	data, err := os.ReadFile(log)
+	require.NoError(t, err)
+	return strings.Count(string(data), "\n")
+}
+
+func TestProber_ProbeWithRetries(t *testing.T) {
+	tests := []struct {
+		name        string
+		failures    int
+		failure     string
+		retries     int
+		wantErr     bool
+		wantRetries int
+		wantRuns    int
+	}{
+		{name: "succeeds first time", failures: 0, failure: "exit 1", retries: 3, wantRetries: 0, wantRuns: 1},
+		{name: "no output then success", failures: 1, failure: "exit 0", retries: 1, wantRetries: 1, wantRuns: 2},
+		{name: "garbage then success", failures: 2, failure: "echo loading; exit 0", retries: 3, wantRetries: 2, wantRuns: 3},
+		{name: "retries exhausted", failures: 2, failure: "exit 0", retries: 1, wantErr: true, wantRetries: 1, wantRuns: 2},
+		{name: "retries disabled", failures: 1, failure: "exit 0", retries: 0, wantErr: true, wantRetries: 0, wantRuns: 1},
+		{name: "no agent support is not retried", failures: 1, failure: "exit 1", retries: 3, wantErr: true, wantRetries: 0, wantRuns: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path, log := writeFlakyTool(t, t.TempDir(), "flaky", tt.failures, tt.failure)
+
+			p := NewProber(2*time.Second, nil)
+			p.SetRetries(tt.retries)
+			p.retryDelay = time.Millisecond
+
+			metadata, retries, err := p.ProbeWithRetries(context.Background(), path)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, "flaky", metadata.Name)
+			}
+			assert.Equal(t, tt.wantRetries, retries)
+			assert.Equal(t, tt.wantRuns, runs(t, log))
+		})
+	}
+}
+
+func TestProber_ProbeWithRetries_TimeoutNotRetried(t *testing.T) {
+	path, log := writeFlakyTool(t, t.TempDir(), "slow", 1, "exec sleep 10")
+
+	p := NewProber(100*time.Millisecond, nil)
+	p.SetRetries(3)
+	p.retryDelay = time.Millisecond
+
+	_, retries, err := p.ProbeWithRetries(context.Background(), path)
+	assert.ErrorIs(t, err, ErrProbeTimeout)
+	assert.Equal(t, 0, retries)
+	assert.Equal(t, 1, runs(t, log))
+}
+
+func TestScanner_Scan_Retries(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeFlakyTool(t, tmpDir, "flaky", 1, "exit 0")
+
+	scanner, err := NewScanner(2*time.Second, 1, nil)
+	require.NoError(t, err)
+	scanner.SetRetries(1)
+
+	result, err := scanner.Scan(context.Background(), []string{tmpDir}, false, nil)
+	require.NoError(t, err)
+
+	require.Len(t, result.Tools, 1)
+	assert.Equal(t, "flaky", result.Tools[0].Name)
+	assert.Equal(t, 1, result.Tools[0].Retries)
+	assert.Equal(t, 1, result.Stats.Retries)
+	assert.Empty(t, result.Errors)
 }
 
 func TestIsSafePath(t *testing.T) {
@@ -281,6 +974,100 @@ func TestIsSafePath(t *testing.T) {
 	}
 }
 
+func TestIsSafePathWithOptions_TrustedGroup(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("ownership checks are not performed on Windows")
+	}
+
+	// A group-writable directory owned by another user and another group,
+	// so only the trusted group can make it safe
+	const otherUID, otherGID = 4242, 4343
+	dir := t.TempDir()
+	if err := os.Chown(dir, otherUID, otherGID); err != nil {
+		t.Skipf("can't give the directory another owner and group: %v", err)
+	}
+	require.NoError(t, os.Chmod(dir, 0775))
+
+	safe, err := IsSafePathWithOptions(dir, SafePathOptions{})
+	assert.Error(t, err)
+	assert.False(t, safe, "untrusted group")
+
+	trusted := SafePathOptions{TrustedGIDs: []uint32{otherGID}}
+	safe, err = IsSafePathWithOptions(dir, trusted)
+	assert.NoError(t, err)
+	assert.True(t, safe, "trusted group")
+
+	// World-writable is rejected even when the group is trusted
+	require.NoError(t, os.Chmod(dir, 0777))
+	safe, err = IsSafePathWithOptions(dir, trusted)
+	assert.Error(t, err)
+	assert.False(t, safe)
+}
+
+func TestIsSafePathWithOptions_OtherOwner(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("ownership checks are not performed on Windows")
+	}
+	if os.Getuid() != 0 {
+		t.Skip("changing a directory's owner requires root")
+	}
+
+	const otherUID, otherGID = 4242, 4343
+
+	dir := t.TempDir()
+	require.NoError(t, os.Chown(dir, otherUID, otherGID))
+
+	tests := []struct {
+		name     string
+		opts     SafePathOptions
+		expected bool
+	}{
+		{
+			name:     "strict by default",
+			opts:     SafePathOptions{},
+			expected: false,
+		},
+		{
+			name:     "trusted uid",
+			opts:     SafePathOptions{TrustedUIDs: []uint32{otherUID}},
+			expected: true,
+		},
+		{
+			name:     "trusted gid",
+			opts:     SafePathOptions{TrustedGIDs: []uint32{otherGID}},
+			expected: true,
+		},
+		{
+			name:     "unrelated ids",
+			opts:     SafePathOptions{TrustedUIDs: []uint32{1}, TrustedGIDs: []uint32{1}},
+			expected: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			safe, err := IsSafePathWithOptions(dir, tt.opts)
+			assert.Equal(t, tt.expected, safe)
+			if tt.expected {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestSplitPathList(t *testing.T) {
+	sep := string(os.PathListSeparator)
+	a := filepath.Join(string(filepath.Separator), "opt", "a")
+	b := filepath.Join(string(filepath.Separator), "opt", "b")
+
+	dirs, dropped := SplitPathList(a + sep + "." + sep + sep + b + sep + "rel/bin" + sep + a + string(filepath.Separator))
+
+	assert.Equal(t, []string{a, b}, dirs)
+	assert.Equal(t, []string{".", "", "rel/bin"}, dropped)
+}
+
 func TestEnumerateExecutables(t *testing.T) {
 	tmpDir := t.TempDir()
 
@@ -311,6 +1098,110 @@ func TestEnumerateExecutables_NonexistentDir(t *testing.T) {
 	assert.Error(t, err)
 }
 
+// writeSyntheticDir fills dir with n files, every other one executable, and
+// returns the executables' paths in name order
+func writeSyntheticDir(tb testing.TB, dir string, n int) []string {
+	tb.Helper()
+	var executables []string
+	for i := 0; i < n; i++ {
+		path := filepath.Join(dir, fmt.Sprintf("tool-%05d", i))
+		mode := os.FileMode(0644)
+		if i%2 == 0 {
+			mode = 0755
+			executables = append(executables, path)
+		}
+		require.NoError(tb, os.WriteFile(path, nil, mode))
+	}
+	return executables
+}
+
+func TestEnumerateExecutables_ManyBatches(t *testing.T) {
+	tmpDir := t.TempDir()
+	want := writeSyntheticDir(t, tmpDir, 3*EnumerateBatchSize+7)
+
+	executables, err := EnumerateExecutables(tmpDir)
+	require.NoError(t, err)
+	assert.Equal(t, want, executables)
+}
+
+func TestScanner_Walk_Canceled(t *testing.T) {
+	root := t.TempDir()
+	for _, dir := range []string{"a", "a/b", "a/b/c"} {
+		require.NoError(t, os.MkdirAll(filepath.Join(root, dir), 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(root, dir, "tool"), nil, 0755))
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(root, "tool"), nil, 0755))
+
+	scanner, err := NewScanner(time.Second, 1, nil)
+	require.NoError(t, err)
+	scanner.SetMaxDepth(10, SafePathOptions{})
+
+	// Canceling once the first executable is found stops the walk before
+	// it descends, without reporting the unread directories as errors
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var found []string
+	walked := scanner.walk(ctx, root, func(path string) {
+		found = append(found, path)
+		cancel()
+	})
+	assert.Equal(t, []string{filepath.Join(root, "tool")}, found)
+	assert.Equal(t, 1, walked.dirs)
+	assert.Empty(t, walked.subdirs)
+	assert.Empty(t, walked.errs)
+	assert.NoError(t, walked.err)
+
+	// Uncanceled, the same walk reaches every level
+	found = nil
+	walked = scanner.walk(context.Background(), root, func(path string) { found = append(found, path) })
+	assert.Len(t, found, 4)
+	assert.Equal(t, 4, walked.dirs)
+}
+
+func TestStreamExecutables(t *testing.T) {
+	tmpDir := t.TempDir()
+	want := writeSyntheticDir(t, tmpDir, 4*EnumerateBatchSize+3)
+
+	paths, wait := StreamExecutables(context.Background(), tmpDir, 4)
+	got := map[string]bool{}
+	for path := range paths {
+		assert.False(t, got[path], "%s sent twice", path)
+		got[path] = true
+	}
+	require.NoError(t, wait())
+	assert.Len(t, got, len(want))
+	for _, path := range want {
+		assert.True(t, got[path], path)
+	}
+
+	// Enumeration stops when ctx is done, even if nobody reads
+	ctx, cancel := context.WithCancel(context.Background())
+	paths, wait = StreamExecutables(ctx, tmpDir, 4)
+	<-paths
+	cancel()
+	for range paths {
+	}
+	assert.ErrorIs(t, wait(), context.Canceled)
+
+	paths, wait = StreamExecutables(context.Background(), filepath.Join(tmpDir, "missing"), 4)
+	for range paths {
+	}
+	assert.Error(t, wait())
+}
+
+// BenchmarkEnumerateExecutables enumerates a synthetic directory of 20,000
+// entries, like a Nix store or a monorepo bin
+func BenchmarkEnumerateExecutables(b *testing.B) {
+	tmpDir := b.TempDir()
+	writeSyntheticDir(b, tmpDir, 20000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := EnumerateExecutables(tmpDir); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
 func TestMatchesSkipList(t *testing.T) {
 	skipList := []string{"skip-tool", "dangerous-*", "test-*"}
 
@@ -349,11 +1240,133 @@ func TestMatchesSkipList(t *testing.T) {
 	}
 }
 
+func TestMatchSkipList_Pattern(t *testing.T) {
+	pattern, ok := MatchSkipList("dangerous-cmd", []string{"skip-tool", "re:danger.*", "dangerous-*"})
+	assert.True(t, ok)
+	assert.Equal(t, "re:danger.*", pattern)
+
+	pattern, ok = MatchSkipList("safe-tool", []string{"skip-tool"})
+	assert.False(t, ok)
+	assert.Empty(t, pattern)
+}
+
 func TestMatchesSkipList_EmptyList(t *testing.T) {
 	result := MatchesSkipList("any-tool", []string{})
 	assert.False(t, result)
 }
 
+func TestMatchesSkipList_Regex(t *testing.T) {
+	skipList := []string{"re:gh-[a-z]+", "re:test-[0-9]+|tmp.*", "re:(", "legacy-*"}
+
+	tests := []struct {
+		name     string
+		toolName string
+		expected bool
+	}{
+		{
+			name:     "regex match",
+			toolName: "gh-copilot",
+			expected: true,
+		},
+		{
+			name:     "regex must match whole name",
+			toolName: "gh-copilot2",
+			expected: false,
+		},
+		{
+			name:     "alternation",
+			toolName: "tmpfile",
+			expected: true,
+		},
+		{
+			name:     "alternation is anchored",
+			toolName: "test-12x",
+			expected: false,
+		},
+		{
+			name:     "glob alongside regex",
+			toolName: "legacy-tool",
+			expected: true,
+		},
+		{
+			name:     "prefix is not a literal",
+			toolName: "re:gh-x",
+			expected: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, MatchesSkipList(tt.toolName, skipList))
+		})
+	}
+}
+
+func TestValidateSkipList(t *testing.T) {
+	assert.NoError(t, ValidateSkipList([]string{"gh", "test-*", "re:^a+$"}))
+	assert.Error(t, ValidateSkipList([]string{"gh", "re:[unclosed"}))
+
+	_, err := NewScanner(time.Second, 1, []string{"re:("})
+	assert.Error(t, err)
+}
+
+func TestLoadSkipFile(t *testing.T) {
+	tests := []struct {
+		name        string
+		content     string
+		expected    []string
+		errContains string
+	}{
+		{
+			name: "patterns with comments and blank lines",
+			content: `# Tools that hang on --agent
+slow-tool
+
+  test-*  
+	# indented comment
+re:gh-[a-z]+
+`,
+			expected: []string{"slow-tool", "test-*", "re:gh-[a-z]+"},
+		},
+		{
+			name:     "empty file",
+			content:  "",
+			expected: []string{},
+		},
+		{
+			name:     "windows line endings",
+			content:  "one\r\ntwo\r\n",
+			expected: []string{"one", "two"},
+		},
+		{
+			name:        "invalid regex reports line",
+			content:     "ok\n# comment\nre:[bad\n",
+			errContains: ":3:",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "skip.txt")
+			require.NoError(t, os.WriteFile(path, []byte(tt.content), 0644))
+
+			patterns, err := LoadSkipFile(path)
+			if tt.errContains != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.errContains)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, patterns)
+		})
+	}
+}
+
+func TestLoadSkipFile_Missing(t *testing.T) {
+	_, err := LoadSkipFile(filepath.Join(t.TempDir(), "missing.txt"))
+	assert.True(t, os.IsNotExist(err))
+}
+
 func TestScanResult_Aggregation(t *testing.T) {
 	result := &ScanResult{
 		Discovered: 5,
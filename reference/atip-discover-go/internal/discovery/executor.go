@@ -0,0 +1,39 @@
+package discovery
+
+import (
+	"context"
+	"os/exec"
+	"time"
+)
+
+// Executor runs the executables a Prober probes, e.g. on this host
+// (LocalExecutor), inside a container or over SSH. Run runs the executable
+// at path with args and returns what it printed to standard output. It must
+// stop when ctx is done.
+//
+// A command that ran but exited non-zero should be reported as an
+// *exec.ExitError, with its standard error in Stderr, so that ErrorKind
+// classifies the failure like a local one (no_agent_support or crash) and
+// Prober.Adapt can read help printed to standard error.
+type Executor interface {
+	Run(ctx context.Context, path string, args []string) ([]byte, error)
+}
+
+// LocalExecutor runs executables on this host with os/exec. It is the
+// default Executor.
+type LocalExecutor struct{}
+
+// Run runs the executable at path with args and returns its standard
+// output. A non-zero exit is returned as an *exec.ExitError with the
+// standard error captured. When ctx is done the executable is killed, and
+// Run returns within LocalWaitDelay even if children it started still hold
+// its output open.
+func (LocalExecutor) Run(ctx context.Context, path string, args []string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, path, args...)
+	cmd.WaitDelay = LocalWaitDelay
+	return cmd.Output()
+}
+
+// LocalWaitDelay is how long LocalExecutor waits for a killed executable's
+// output to close before giving up on it.
+const LocalWaitDelay = 500 * time.Millisecond
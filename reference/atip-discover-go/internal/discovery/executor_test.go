@@ -0,0 +1,178 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/atip/atip-discover/internal/pool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeExecutor returns canned output keyed by executable base name, after
+// delay, and records the commands it was asked to run and the most it ran
+// at once.
+type fakeExecutor struct {
+	mu       sync.Mutex
+	outputs  map[string]string
+	delay    time.Duration
+	calls    []string
+	inFlight int
+	peak     int
+}
+
+func (f *fakeExecutor) Run(ctx context.Context, path string, args []string) ([]byte, error) {
+	f.mu.Lock()
+	f.calls = append(f.calls, path+" "+strings.Join(args, " "))
+	f.inFlight++
+	if f.inFlight > f.peak {
+		f.peak = f.inFlight
+	}
+	f.mu.Unlock()
+
+	time.Sleep(f.delay)
+	f.mu.Lock()
+	f.inFlight--
+	f.mu.Unlock()
+
+	output, ok := f.outputs[filepath.Base(path)]
+	if !ok {
+		return nil, errors.New("no such container path")
+	}
+	return []byte(output), nil
+}
+
+func cannedMetadata(name, version string) string {
+	return fmt.Sprintf(`{"atip": {"version": "0.6"}, "name": %q, "version": %q, "description": "Canned", "commands": {}}`, name, version)
+}
+
+func TestProber_Executor(t *testing.T) {
+	executor := &fakeExecutor{outputs: map[string]string{
+		"gh":      cannedMetadata("gh", "2.45.0"),
+		"garbled": "not json",
+	}}
+	p := NewProber(time.Second, executor)
+	ctx := context.Background()
+
+	metadata, err := p.Probe(ctx, "/container/bin/gh")
+	require.NoError(t, err)
+	assert.Equal(t, "gh", metadata.Name)
+	assert.Equal(t, "2.45.0", metadata.Version)
+
+	_, err = p.Probe(ctx, "/container/bin/garbled")
+	assert.Equal(t, ErrorKindInvalidJSON, ErrorKind(err))
+
+	_, err = p.Probe(ctx, "/container/bin/missing")
+	assert.Equal(t, ErrorKindExec, ErrorKind(err))
+
+	assert.Equal(t, []string{
+		"/container/bin/gh --agent",
+		"/container/bin/garbled --agent",
+		"/container/bin/missing --agent",
+	}, executor.calls)
+}
+
+func TestProber_Executor_Adapt(t *testing.T) {
+	executor := &fakeExecutor{outputs: map[string]string{"mytool": sampleHelp}}
+	p := NewProber(time.Second, executor)
+
+	metadata, err := p.Adapt(context.Background(), "/container/bin/mytool")
+	require.NoError(t, err)
+	assert.Equal(t, "2.3.1", metadata.Version)
+	assert.Len(t, metadata.GlobalOptions, 5)
+	assert.Equal(t, []string{"/container/bin/mytool --help"}, executor.calls)
+}
+
+func TestScanner_SetExecutor(t *testing.T) {
+	// The executables only need to exist; the executor answers for them
+	tmpDir := t.TempDir()
+	for _, name := range []string{"gh", "kubectl"} {
+		require.NoError(t, os.WriteFile(filepath.Join(tmpDir, name), nil, 0755))
+	}
+
+	executor := &fakeExecutor{outputs: map[string]string{
+		"gh":      cannedMetadata("gh", "2.45.0"),
+		"kubectl": cannedMetadata("kubectl", "1.28.0"),
+	}}
+	scanner, err := NewScanner(time.Second, 2, nil)
+	require.NoError(t, err)
+	scanner.SetExecutor(executor)
+
+	result, err := scanner.Scan(context.Background(), []string{tmpDir}, false, nil)
+	require.NoError(t, err)
+	require.Len(t, result.Tools, 2)
+	assert.Equal(t, "gh", result.Tools[0].Name)
+	assert.Equal(t, "2.45.0", result.Tools[0].Version)
+	assert.Equal(t, "kubectl", result.Tools[1].Name)
+	assert.Empty(t, result.Errors)
+	assert.Len(t, executor.calls, 2)
+}
+
+func TestScanner_SetPool(t *testing.T) {
+	dir := t.TempDir()
+	outputs := make(map[string]string)
+	for i := 0; i < 6; i++ {
+		name := fmt.Sprintf("tool-%d", i)
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), nil, 0755))
+		outputs[name] = cannedMetadata(name, "1.0.0")
+	}
+
+	// Two scanners on one pool stay within its size together, whatever
+	// their own parallelism
+	executor := &fakeExecutor{outputs: outputs, delay: 20 * time.Millisecond}
+	shared := pool.New(2)
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		scanner, err := NewScanner(time.Second, 8, nil)
+		require.NoError(t, err)
+		scanner.SetExecutor(executor)
+		scanner.SetPool(shared)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result, err := scanner.Scan(context.Background(), []string{dir}, false, nil)
+			assert.NoError(t, err)
+			assert.Len(t, result.Tools, 6)
+		}()
+	}
+	wg.Wait()
+
+	assert.Len(t, executor.calls, 12)
+	assert.Equal(t, 2, executor.peak)
+}
+
+func TestScanner_Scan_Cancelled(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"gh", "kubectl", "jq"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), nil, 0755))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	executor := &fakeExecutor{}
+	scanner, err := NewScanner(time.Second, 2, nil)
+	require.NoError(t, err)
+	scanner.SetExecutor(executor)
+
+	// Nothing is read or probed, and the skipped directory isn't an error
+	result, err := scanner.Scan(ctx, []string{dir}, false, nil)
+	require.NoError(t, err)
+	assert.Empty(t, executor.calls)
+	assert.Empty(t, result.Tools)
+	assert.Zero(t, result.Failed)
+	assert.Empty(t, result.Errors)
+	assert.Empty(t, result.PathErrors)
+	assert.Zero(t, result.Unprobed)
+	assert.Zero(t, result.Stats.Enumerated)
+	assert.Zero(t, result.Stats.DirsTraversed)
+	assert.Zero(t, result.Stats.Probed)
+	assert.False(t, result.DeadlineExceeded, "canceled, not past a deadline")
+}
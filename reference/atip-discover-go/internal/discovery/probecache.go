@@ -0,0 +1,98 @@
+package discovery
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/atip/atip-discover/internal/validator"
+)
+
+// ProbeCache remembers probe results for the duration of one command, so
+// that an executable is run at most once however often it is probed, e.g.
+// when a directory is scanned twice under different spellings. Results are
+// keyed by the executable's cleaned path and modification time, so a
+// binary replaced during the command is run again. A ProbeCache is safe for
+// concurrent use; concurrent probes of the same executable wait for the
+// first instead of running it again.
+type ProbeCache struct {
+	mu      sync.Mutex
+	entries map[probeKey]*probeEntry
+}
+
+// probeKey identifies an executable as it was when probed, and how.
+type probeKey struct {
+	path    string
+	modTime int64  // UnixNano
+	args    string // "--agent" or "--help"
+}
+
+// probeEntry is the result of one probe, available once done is closed.
+type probeEntry struct {
+	done      chan struct{}
+	metadata  *validator.AtipMetadata
+	retries   int
+	err       error
+	abandoned bool // Cut short by its context, so not cached
+}
+
+// NewProbeCache creates an empty probe cache.
+func NewProbeCache() *ProbeCache {
+	return &ProbeCache{entries: make(map[probeKey]*probeEntry)}
+}
+
+// statModTime returns the modification time of the executable at path, or the
+// zero time if it can't be determined, e.g. when probing through an
+// Executor that sees a different filesystem.
+func statModTime(path string) time.Time {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+// do returns the cached result of probing path, as of modTime, with args,
+// calling probe to produce it the first time. Nothing is cached for a zero
+// modTime, nor for a probe cut short because its ctx was done; callers
+// waiting on such a probe run their own.
+func (c *ProbeCache) do(ctx context.Context, path string, modTime time.Time, args string, probe func() (*validator.AtipMetadata, int, error)) (*validator.AtipMetadata, int, error) {
+	if c == nil || modTime.IsZero() {
+		return probe()
+	}
+	key := probeKey{path: filepath.Clean(path), modTime: modTime.UnixNano(), args: args}
+
+	var entry *probeEntry
+	for {
+		c.mu.Lock()
+		existing, ok := c.entries[key]
+		if !ok {
+			entry = &probeEntry{done: make(chan struct{})}
+			c.entries[key] = entry
+			c.mu.Unlock()
+			break
+		}
+		c.mu.Unlock()
+
+		select {
+		case <-existing.done:
+			if !existing.abandoned {
+				return existing.metadata, existing.retries, existing.err
+			}
+		case <-ctx.Done():
+			return nil, 0, ctx.Err()
+		}
+	}
+
+	entry.metadata, entry.retries, entry.err = probe()
+	if ctx.Err() != nil {
+		c.mu.Lock()
+		delete(c.entries, key)
+		c.mu.Unlock()
+		entry.abandoned = true
+	}
+	close(entry.done)
+	return entry.metadata, entry.retries, entry.err
+}
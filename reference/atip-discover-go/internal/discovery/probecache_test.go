@@ -0,0 +1,121 @@
+package discovery
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProbeCache_Prober(t *testing.T) {
+	dir := t.TempDir()
+	ghPath := filepath.Join(dir, "gh")
+	require.NoError(t, os.WriteFile(ghPath, nil, 0755))
+	executor := &fakeExecutor{outputs: map[string]string{"gh": cannedMetadata("gh", "2.45.0")}}
+	cache := NewProbeCache()
+	ctx := context.Background()
+
+	p := NewProber(time.Second, executor)
+	p.SetCache(cache)
+	for i := 0; i < 3; i++ {
+		metadata, err := p.Probe(ctx, ghPath)
+		require.NoError(t, err)
+		assert.Equal(t, "2.45.0", metadata.Version)
+	}
+	assert.Len(t, executor.calls, 1)
+
+	// Another prober sharing the cache, and another spelling of the path,
+	// reuse the result; --help is cached separately
+	other := NewProber(time.Second, executor)
+	other.SetCache(cache)
+	_, err := other.Probe(ctx, filepath.Join(dir, ".", "gh"))
+	require.NoError(t, err)
+	_, err = other.Adapt(ctx, ghPath)
+	assert.ErrorIs(t, err, ErrNoHelp)
+	_, err = other.Adapt(ctx, ghPath)
+	assert.ErrorIs(t, err, ErrNoHelp)
+	assert.Equal(t, []string{ghPath + " --agent", ghPath + " --help"}, executor.calls)
+
+	// A changed binary is probed again
+	later := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(ghPath, later, later))
+	_, err = p.Probe(ctx, ghPath)
+	require.NoError(t, err)
+	assert.Len(t, executor.calls, 3)
+
+	// Without a cache, every probe runs
+	uncached := NewProber(time.Second, executor)
+	_, err = uncached.Probe(ctx, ghPath)
+	require.NoError(t, err)
+	_, err = uncached.Probe(ctx, ghPath)
+	require.NoError(t, err)
+	assert.Len(t, executor.calls, 5)
+}
+
+func TestProbeCache_Concurrent(t *testing.T) {
+	ghPath := filepath.Join(t.TempDir(), "gh")
+	require.NoError(t, os.WriteFile(ghPath, nil, 0755))
+	executor := &fakeExecutor{outputs: map[string]string{"gh": cannedMetadata("gh", "2.45.0")}, delay: 20 * time.Millisecond}
+	p := NewProber(time.Second, executor)
+	p.SetCache(NewProbeCache())
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			metadata, err := p.Probe(context.Background(), ghPath)
+			assert.NoError(t, err)
+			assert.Equal(t, "gh", metadata.Name)
+		}()
+	}
+	wg.Wait()
+	assert.Len(t, executor.calls, 1)
+}
+
+func TestProbeCache_Canceled(t *testing.T) {
+	ghPath := filepath.Join(t.TempDir(), "gh")
+	require.NoError(t, os.WriteFile(ghPath, nil, 0755))
+	executor := &fakeExecutor{outputs: map[string]string{"gh": cannedMetadata("gh", "2.45.0")}}
+	p := NewProber(time.Second, executor)
+	p.SetCache(NewProbeCache())
+
+	// A probe cut short isn't cached
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	p.Probe(ctx, ghPath)
+	metadata, err := p.Probe(context.Background(), ghPath)
+	require.NoError(t, err)
+	assert.Equal(t, "gh", metadata.Name)
+	assert.Len(t, executor.calls, 2)
+}
+
+func TestScanner_SetProbeCache(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "gh"), nil, 0755))
+	info, err := os.Stat(filepath.Join(dir, "gh"))
+	require.NoError(t, err)
+	executor := &fakeExecutor{outputs: map[string]string{"gh": cannedMetadata("gh", "2.45.0")}}
+
+	scanner, err := NewScanner(time.Second, 2, nil)
+	require.NoError(t, err)
+	scanner.SetExecutor(executor)
+	scanner.SetProbeCache(NewProbeCache())
+
+	// The directory is listed twice, but gh runs once
+	result, err := scanner.Scan(context.Background(), []string{dir, dir + string(filepath.Separator)}, false, nil)
+	require.NoError(t, err)
+	require.Len(t, result.Tools, 2)
+	assert.Equal(t, info.ModTime(), result.Tools[0].ModTime)
+	assert.Len(t, executor.calls, 1)
+
+	// Scanning again in the same command doesn't run it either
+	_, err = scanner.Scan(context.Background(), []string{dir}, false, nil)
+	require.NoError(t, err)
+	assert.Len(t, executor.calls, 1)
+}
@@ -0,0 +1,23 @@
+//go:build !windows
+
+package discovery
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// checkPermissions rejects world-writable directories and directories not
+// owned by a trusted user or group.
+func checkPermissions(path string, info os.FileInfo, opts SafePathOptions) error {
+	if info.Mode()&0002 != 0 {
+		return fmt.Errorf("world-writable directory")
+	}
+
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if ok && !isTrustedOwner(stat.Uid, stat.Gid, opts) {
+		return fmt.Errorf("directory owned by other user")
+	}
+	return nil
+}
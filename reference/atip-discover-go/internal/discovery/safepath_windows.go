@@ -0,0 +1,92 @@
+//go:build windows
+
+package discovery
+
+import (
+	"fmt"
+	"os"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// writeAccess are the rights that let a trustee add, replace or take over
+// files in a directory.
+const writeAccess = windows.FILE_WRITE_DATA | windows.FILE_APPEND_DATA |
+	windows.GENERIC_WRITE | windows.GENERIC_ALL | windows.WRITE_DAC | windows.WRITE_OWNER
+
+// worldSIDs are the well-known groups that include every user, the
+// Windows equivalent of "other" in Unix permissions.
+var worldSIDs = []windows.WELL_KNOWN_SID_TYPE{windows.WinWorldSid, windows.WinAuthenticatedUserSid}
+
+// checkPermissions rejects directories whose DACL grants Everyone or
+// Authenticated Users write access, including directories with a null DACL,
+// which grants everyone full access. Ownership is not checked.
+func checkPermissions(path string, info os.FileInfo, opts SafePathOptions) error {
+	sd, err := windows.GetNamedSecurityInfo(path, windows.SE_FILE_OBJECT, windows.DACL_SECURITY_INFORMATION)
+	if err != nil {
+		return fmt.Errorf("failed to read ACL of %s: %w", path, err)
+	}
+	dacl, _, err := sd.DACL()
+	if err == windows.ERROR_OBJECT_NOT_FOUND || (err == nil && dacl == nil) {
+		return fmt.Errorf("world-writable directory (no DACL, so Everyone has full access)")
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read ACL of %s: %w", path, err)
+	}
+
+	var world []*windows.SID
+	for _, sidType := range worldSIDs {
+		sid, err := windows.CreateWellKnownSid(sidType)
+		if err != nil {
+			return fmt.Errorf("failed to create well-known SID: %w", err)
+		}
+		world = append(world, sid)
+	}
+
+	// ACEs are evaluated in order, so rights denied earlier can't be granted
+	// by a later allow ACE
+	var denied windows.ACCESS_MASK
+	for i := uint32(0); i < uint32(dacl.AceCount); i++ {
+		var ace *windows.ACCESS_ALLOWED_ACE
+		if err := windows.GetAce(dacl, i, &ace); err != nil {
+			return fmt.Errorf("failed to read ACL of %s: %w", path, err)
+		}
+		if ace.Header.AceFlags&windows.INHERIT_ONLY_ACE != 0 {
+			continue // Applies only to children
+		}
+		sid := (*windows.SID)(unsafe.Pointer(&ace.SidStart))
+		if !matchesAny(sid, world) {
+			continue
+		}
+
+		switch ace.Header.AceType {
+		case windows.ACCESS_DENIED_ACE_TYPE:
+			denied |= ace.Mask
+		case windows.ACCESS_ALLOWED_ACE_TYPE:
+			if ace.Mask&writeAccess&^denied != 0 {
+				return fmt.Errorf("world-writable directory (writable by %s)", sidName(sid))
+			}
+		}
+	}
+	return nil
+}
+
+// matchesAny reports whether sid equals one of sids.
+func matchesAny(sid *windows.SID, sids []*windows.SID) bool {
+	for _, other := range sids {
+		if sid.Equals(other) {
+			return true
+		}
+	}
+	return false
+}
+
+// sidName returns the account name of sid, or its string form if it can't
+// be looked up.
+func sidName(sid *windows.SID) string {
+	if account, _, _, err := sid.LookupAccount(""); err == nil {
+		return account
+	}
+	return sid.String()
+}
@@ -0,0 +1,95 @@
+//go:build windows
+
+package discovery
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/windows"
+)
+
+// grant adds an ACE to dir's DACL giving the well-known group sidType the
+// access in mask.
+func grant(t *testing.T, dir string, sidType windows.WELL_KNOWN_SID_TYPE, mode windows.ACCESS_MODE, mask windows.ACCESS_MASK) {
+	t.Helper()
+	sid, err := windows.CreateWellKnownSid(sidType)
+	require.NoError(t, err)
+
+	sd, err := windows.GetNamedSecurityInfo(dir, windows.SE_FILE_OBJECT, windows.DACL_SECURITY_INFORMATION)
+	require.NoError(t, err)
+	dacl, _, err := sd.DACL()
+	require.NoError(t, err)
+
+	acl, err := windows.ACLFromEntries([]windows.EXPLICIT_ACCESS{{
+		AccessPermissions: mask,
+		AccessMode:        mode,
+		Inheritance:       windows.NO_INHERITANCE,
+		Trustee: windows.TRUSTEE{
+			TrusteeForm:  windows.TRUSTEE_IS_SID,
+			TrusteeType:  windows.TRUSTEE_IS_WELL_KNOWN_GROUP,
+			TrusteeValue: windows.TrusteeValueFromSID(sid),
+		},
+	}}, dacl)
+	require.NoError(t, err)
+	require.NoError(t, windows.SetNamedSecurityInfo(dir, windows.SE_FILE_OBJECT, windows.DACL_SECURITY_INFORMATION, nil, nil, acl, nil))
+}
+
+func TestIsSafePath_Windows(t *testing.T) {
+	tests := []struct {
+		name     string
+		setup    func(t *testing.T, dir string)
+		expected bool
+	}{
+		{
+			name:     "default ACL",
+			setup:    func(t *testing.T, dir string) {},
+			expected: true,
+		},
+		{
+			name: "readable by Everyone",
+			setup: func(t *testing.T, dir string) {
+				grant(t, dir, windows.WinWorldSid, windows.GRANT_ACCESS, windows.GENERIC_READ)
+			},
+			expected: true,
+		},
+		{
+			name: "writable by Everyone",
+			setup: func(t *testing.T, dir string) {
+				grant(t, dir, windows.WinWorldSid, windows.GRANT_ACCESS, windows.FILE_WRITE_DATA)
+			},
+			expected: false,
+		},
+		{
+			name: "full control for Authenticated Users",
+			setup: func(t *testing.T, dir string) {
+				grant(t, dir, windows.WinAuthenticatedUserSid, windows.GRANT_ACCESS, windows.GENERIC_ALL)
+			},
+			expected: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			tt.setup(t, dir)
+
+			safe, err := IsSafePath(dir)
+			assert.Equal(t, tt.expected, safe)
+			if tt.expected {
+				assert.NoError(t, err)
+			} else {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), "world-writable")
+			}
+		})
+	}
+
+	// The current directory and empty path are rejected on every platform
+	for _, path := range []string{".", ""} {
+		safe, err := IsSafePath(path)
+		assert.False(t, safe)
+		assert.Error(t, err)
+	}
+}
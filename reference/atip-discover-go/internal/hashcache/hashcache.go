@@ -0,0 +1,176 @@
+// Package hashcache caches the SHA-256 hashes of binaries, keyed by path,
+// size and modification time, so verifying an unchanged binary doesn't
+// re-read it.
+package hashcache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/atip/atip-discover/internal/clock"
+)
+
+// entry is the cached hash of one binary. The hash is valid as long as
+// the binary's size and modification time are unchanged.
+type entry struct {
+	Size     int64     `json:"size"`
+	ModTime  time.Time `json:"mod_time"`
+	Hash     string    `json:"hash"`
+	LastUsed time.Time `json:"last_used"`
+}
+
+// Cache maps binary paths to their hashes. It is safe for concurrent use.
+type Cache struct {
+	path     string
+	maxAge   time.Duration
+	maxBytes int64
+	clock    clock.Clock
+	open     func(name string) (io.ReadCloser, error) // Reads binaries to hash
+
+	mu      sync.Mutex
+	entries map[string]*entry
+	dirty   bool
+}
+
+// Load reads the cache stored at path. A missing or unreadable cache file
+// yields an empty cache, since every entry can be recomputed.
+func Load(path string) *Cache {
+	c := &Cache{
+		path:    path,
+		clock:   clock.Real{},
+		open:    func(name string) (io.ReadCloser, error) { return os.Open(name) },
+		entries: map[string]*entry{},
+	}
+	if data, err := os.ReadFile(path); err == nil {
+		if err := json.Unmarshal(data, &c.entries); err != nil || c.entries == nil {
+			c.entries = map[string]*entry{}
+		}
+	}
+	return c
+}
+
+// SetLimits bounds what Save keeps: entries not used within maxAge are
+// dropped, then the least recently used entries until the file fits in
+// maxBytes. Zero disables a limit.
+func (c *Cache) SetLimits(maxAge time.Duration, maxBytes int64) {
+	c.maxAge, c.maxBytes = maxAge, maxBytes
+}
+
+// SetClock replaces the clock entries are stamped with, e.g. with a
+// clock.Fake in tests.
+func (c *Cache) SetClock(clk clock.Clock) {
+	c.clock = clk
+}
+
+// Hash returns the hash of the file at path as "sha256:<hex>", reading the
+// file only if its size or modification time changed since it was last
+// hashed.
+func (c *Cache) Hash(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+
+	c.mu.Lock()
+	e, ok := c.entries[path]
+	if ok && e.Size == info.Size() && e.ModTime.Equal(info.ModTime()) {
+		e.LastUsed = c.clock.Now()
+		c.dirty = true
+		c.mu.Unlock()
+		return e.Hash, nil
+	}
+	c.mu.Unlock()
+
+	hash, err := c.compute(path)
+	if err != nil {
+		return "", err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[path] = &entry{Size: info.Size(), ModTime: info.ModTime(), Hash: hash, LastUsed: c.clock.Now()}
+	c.dirty = true
+	return hash, nil
+}
+
+// compute hashes the file at path.
+func (c *Cache) compute(path string) (string, error) {
+	f, err := c.open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("failed to hash %s: %w", path, err)
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Save trims the cache to its limits and writes it atomically, if anything
+// changed since it was loaded.
+func (c *Cache) Save() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.dirty {
+		return nil
+	}
+	c.trim()
+
+	data, err := json.MarshalIndent(c.entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0755); err != nil {
+		return err
+	}
+	tmpPath := c.path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, c.path); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	c.dirty = false
+	return nil
+}
+
+// trim drops expired entries, then the least recently used ones until the
+// encoded entries fit in maxBytes.
+func (c *Cache) trim() {
+	now := c.clock.Now()
+	paths := make([]string, 0, len(c.entries))
+	for path, e := range c.entries {
+		if c.maxAge > 0 && now.Sub(e.LastUsed) > c.maxAge {
+			delete(c.entries, path)
+			continue
+		}
+		paths = append(paths, path)
+	}
+	if c.maxBytes <= 0 {
+		return
+	}
+
+	// Keep the most recently used entries that fit
+	sort.Slice(paths, func(i, j int) bool {
+		return c.entries[paths[i]].LastUsed.After(c.entries[paths[j]].LastUsed)
+	})
+	var total int64
+	for _, path := range paths {
+		data, _ := json.Marshal(map[string]*entry{path: c.entries[path]})
+		total += int64(len(data))
+		if total > c.maxBytes {
+			delete(c.entries, path)
+		}
+	}
+}
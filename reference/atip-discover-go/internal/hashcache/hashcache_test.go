@@ -0,0 +1,148 @@
+package hashcache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/atip/atip-discover/internal/clock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingOpener makes c count the bytes it reads from binaries.
+func countingOpener(c *Cache, n *int64) {
+	c.open = func(name string) (io.ReadCloser, error) {
+		f, err := os.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		return &countingReader{ReadCloser: f, n: n}, nil
+	}
+}
+
+type countingReader struct {
+	io.ReadCloser
+	n *int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	*r.n += int64(n)
+	return n, err
+}
+
+func sha256Hash(data string) string {
+	sum := sha256.Sum256([]byte(data))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+func TestCache_Hash(t *testing.T) {
+	dir := t.TempDir()
+	binary := filepath.Join(dir, "tool")
+	require.NoError(t, os.WriteFile(binary, []byte("binary v1"), 0755))
+
+	cache := Load(filepath.Join(dir, "hashes.json"))
+	var read int64
+	countingOpener(cache, &read)
+
+	hash, err := cache.Hash(binary)
+	require.NoError(t, err)
+	assert.Equal(t, sha256Hash("binary v1"), hash)
+	assert.Equal(t, int64(len("binary v1")), read)
+
+	// An unchanged binary is served from the cache
+	hash, err = cache.Hash(binary)
+	require.NoError(t, err)
+	assert.Equal(t, sha256Hash("binary v1"), hash)
+	assert.Equal(t, int64(len("binary v1")), read, "second lookup must not re-read the binary")
+
+	// A changed size or modification time invalidates the entry
+	require.NoError(t, os.WriteFile(binary, []byte("binary version 2"), 0755))
+	hash, err = cache.Hash(binary)
+	require.NoError(t, err)
+	assert.Equal(t, sha256Hash("binary version 2"), hash)
+
+	read = 0
+	future := time.Now().Add(time.Hour)
+	require.NoError(t, os.Chtimes(binary, future, future))
+	_, err = cache.Hash(binary)
+	require.NoError(t, err)
+	assert.Equal(t, int64(len("binary version 2")), read)
+
+	_, err = cache.Hash(filepath.Join(dir, "missing"))
+	assert.Error(t, err)
+}
+
+func TestCache_SaveLoad(t *testing.T) {
+	dir := t.TempDir()
+	binary := filepath.Join(dir, "tool")
+	require.NoError(t, os.WriteFile(binary, []byte("binary"), 0755))
+	path := filepath.Join(dir, "cache", "hashes.json")
+
+	cache := Load(path)
+	_, err := cache.Hash(binary)
+	require.NoError(t, err)
+	require.NoError(t, cache.Save())
+
+	// A reloaded cache still knows the hash
+	reloaded := Load(path)
+	var read int64
+	countingOpener(reloaded, &read)
+	hash, err := reloaded.Hash(binary)
+	require.NoError(t, err)
+	assert.Equal(t, sha256Hash("binary"), hash)
+	assert.Zero(t, read)
+
+	// A corrupt cache file is treated as empty
+	require.NoError(t, os.WriteFile(path, []byte("{not json"), 0644))
+	corrupt := Load(path)
+	countingOpener(corrupt, &read)
+	_, err = corrupt.Hash(binary)
+	require.NoError(t, err)
+	assert.Equal(t, int64(len("binary")), read)
+}
+
+func TestCache_Limits(t *testing.T) {
+	dir := t.TempDir()
+	var binaries []string
+	for _, name := range []string{"a", "b", "c"} {
+		binary := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(binary, []byte(name), 0755))
+		binaries = append(binaries, binary)
+	}
+	path := filepath.Join(dir, "hashes.json")
+	clk := clock.NewFake(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+
+	// Entries not used within maxAge are dropped
+	cache := Load(path)
+	cache.SetClock(clk)
+	cache.SetLimits(24*time.Hour, 0)
+	for _, binary := range binaries {
+		_, err := cache.Hash(binary)
+		require.NoError(t, err)
+		clk.Advance(time.Hour)
+	}
+	clk.Advance(21*time.Hour + 30*time.Minute)
+	require.NoError(t, cache.Save())
+	assert.Len(t, Load(path).entries, 2)
+
+	// The least recently used entries are dropped to fit maxBytes
+	cache = Load(path)
+	cache.SetClock(clk)
+	for _, binary := range binaries {
+		_, err := cache.Hash(binary)
+		require.NoError(t, err)
+		clk.Advance(time.Minute)
+	}
+	cache.SetLimits(0, 400)
+	require.NoError(t, cache.Save())
+	saved := Load(path).entries
+	require.NotEmpty(t, saved)
+	assert.Less(t, len(saved), 3)
+	assert.Contains(t, saved, binaries[2], "the most recently used entry is kept")
+}
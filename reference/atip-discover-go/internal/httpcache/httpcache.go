@@ -0,0 +1,164 @@
+// Package httpcache makes conditional HTTP GET requests, keeping each
+// response served with an ETag in a cache directory so that fetching an
+// unchanged resource again costs a 304 Not Modified instead of a download.
+package httpcache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Entry is a cached response: its body and the ETag to revalidate it with.
+type Entry struct {
+	ETag     string    `json:"etag"`
+	Body     []byte    `json:"body"`
+	StoredAt time.Time `json:"stored_at"`
+}
+
+// Response is the outcome of a conditional GET.
+type Response struct {
+	Body        []byte
+	ETag        string
+	NotModified bool // The server answered 304 and Body is the cached copy
+}
+
+// Client makes GET requests through an http.Client, revalidating responses
+// cached in its directory. Without a directory nothing is cached and every
+// request downloads the resource in full.
+type Client struct {
+	http *http.Client
+	dir  string
+}
+
+// New creates a client that sends requests with httpClient and caches
+// nothing until SetDir is called.
+func New(httpClient *http.Client) *Client {
+	return &Client{http: httpClient}
+}
+
+// SetDir sets the directory responses are cached in. An empty dir disables
+// caching.
+func (c *Client) SetDir(dir string) {
+	c.dir = dir
+}
+
+// Get is Do for a plain GET request of url.
+func (c *Client) Get(ctx context.Context, url string) (*Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.Do(req)
+}
+
+// Do sends the GET request req, adding If-None-Match with the ETag of the
+// cached response for its URL, if any. On 304 Not Modified it returns the
+// cached body; on 200 it returns the new body and caches it if it came
+// with an ETag. It returns nil without an error if the server responds
+// 404, and an error for any other status.
+//
+// Caching is best effort: a cache entry that can't be read is ignored and
+// one that can't be written is skipped.
+func (c *Client) Do(req *http.Request) (*Response, error) {
+	url := req.URL.String()
+	cached, _ := c.Lookup(url)
+	if cached != nil {
+		req.Header.Set("If-None-Match", cached.ETag)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	etag := resp.Header.Get("ETag")
+	switch {
+	case resp.StatusCode == http.StatusNotModified && cached != nil:
+		if etag == "" {
+			etag = cached.ETag
+		}
+		return &Response{Body: cached.Body, ETag: etag, NotModified: true}, nil
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, nil
+	case resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("%s: %s", url, resp.Status)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if etag != "" {
+		_ = c.Store(url, &Entry{ETag: etag, Body: body, StoredAt: time.Now()})
+	}
+	return &Response{Body: body, ETag: etag}, nil
+}
+
+// Lookup returns the cached response for url, or nil if there is none or
+// caching is disabled. The error is set if an entry exists but can't be
+// read.
+func (c *Client) Lookup(url string) (*Entry, error) {
+	if c.dir == "" {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(c.path(url))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var entry Entry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, fmt.Errorf("corrupt cache entry for %s: %w", url, err)
+	}
+	if entry.ETag == "" {
+		return nil, nil
+	}
+	return &entry, nil
+}
+
+// Store caches entry as the response for url, replacing any earlier one.
+// It does nothing if caching is disabled.
+func (c *Client) Store(url string, entry *Entry) error {
+	if c.dir == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(c.dir, 0755); err != nil {
+		return err
+	}
+
+	// Write to a temporary file so a failed store leaves the old entry intact
+	path := c.path(url)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// path returns the cache file for url.
+func (c *Client) path(url string) string {
+	sum := sha256.Sum256([]byte(url))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:16])+".json")
+}
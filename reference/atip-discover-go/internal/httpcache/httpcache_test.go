@@ -0,0 +1,160 @@
+package httpcache
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// etagServer serves body with etag, answering 304 to a matching
+// If-None-Match, and counts both kinds of response.
+type etagServer struct {
+	body, etag        string
+	full, notModified int
+}
+
+func (s *etagServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/missing" {
+		http.NotFound(w, r)
+		return
+	}
+	if s.etag != "" {
+		w.Header().Set("ETag", s.etag)
+		if r.Header.Get("If-None-Match") == s.etag {
+			s.notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+	s.full++
+	w.Write([]byte(s.body))
+}
+
+func newServer(t *testing.T, body, etag string) (*etagServer, string) {
+	t.Helper()
+	handler := &etagServer{body: body, etag: etag}
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	return handler, server.URL
+}
+
+func TestClient_Get_NotModified(t *testing.T) {
+	handler, url := newServer(t, `{"v": 1}`, `"v1"`)
+	client := New(http.DefaultClient)
+	client.SetDir(t.TempDir())
+	ctx := context.Background()
+
+	resp, err := client.Get(ctx, url+"/catalog.json")
+	require.NoError(t, err)
+	assert.Equal(t, `{"v": 1}`, string(resp.Body))
+	assert.Equal(t, `"v1"`, resp.ETag)
+	assert.False(t, resp.NotModified)
+
+	// The second request is revalidated and served from the cache
+	resp, err = client.Get(ctx, url+"/catalog.json")
+	require.NoError(t, err)
+	assert.Equal(t, `{"v": 1}`, string(resp.Body))
+	assert.True(t, resp.NotModified)
+	assert.Equal(t, 1, handler.full)
+	assert.Equal(t, 1, handler.notModified)
+
+	// A changed resource is downloaded again
+	handler.body, handler.etag = `{"v": 2}`, `"v2"`
+	resp, err = client.Get(ctx, url+"/catalog.json")
+	require.NoError(t, err)
+	assert.Equal(t, `{"v": 2}`, string(resp.Body))
+	assert.False(t, resp.NotModified)
+	assert.Equal(t, 2, handler.full)
+}
+
+func TestClient_Get_Persists(t *testing.T) {
+	handler, url := newServer(t, "shim", `"abc"`)
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	first := New(http.DefaultClient)
+	first.SetDir(dir)
+	_, err := first.Get(ctx, url)
+	require.NoError(t, err)
+
+	entry, err := first.Lookup(url)
+	require.NoError(t, err)
+	require.NotNil(t, entry)
+	assert.Equal(t, `"abc"`, entry.ETag)
+	assert.Equal(t, "shim", string(entry.Body))
+
+	// A new client, as in a later run, revalidates what the first cached
+	second := New(http.DefaultClient)
+	second.SetDir(dir)
+	resp, err := second.Get(ctx, url)
+	require.NoError(t, err)
+	assert.True(t, resp.NotModified)
+	assert.Equal(t, "shim", string(resp.Body))
+	assert.Equal(t, 1, handler.full)
+
+	// A corrupt entry is ignored and replaced
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	require.NoError(t, os.WriteFile(files[0], []byte("{"), 0644))
+	_, err = second.Lookup(url)
+	assert.Error(t, err)
+	resp, err = second.Get(ctx, url)
+	require.NoError(t, err)
+	assert.False(t, resp.NotModified)
+	assert.Equal(t, 2, handler.full)
+	entry, err = second.Lookup(url)
+	require.NoError(t, err)
+	assert.NotNil(t, entry)
+}
+
+func TestClient_Get_Uncached(t *testing.T) {
+	ctx := context.Background()
+
+	// Responses without an ETag aren't cached
+	handler, url := newServer(t, "plain", "")
+	client := New(http.DefaultClient)
+	client.SetDir(t.TempDir())
+	for i := 0; i < 2; i++ {
+		resp, err := client.Get(ctx, url)
+		require.NoError(t, err)
+		assert.False(t, resp.NotModified)
+	}
+	assert.Equal(t, 2, handler.full)
+
+	// Nor is anything without a directory
+	handler, url = newServer(t, "tagged", `"t"`)
+	client = New(http.DefaultClient)
+	for i := 0; i < 2; i++ {
+		resp, err := client.Get(ctx, url)
+		require.NoError(t, err)
+		assert.Equal(t, "tagged", string(resp.Body))
+	}
+	assert.Equal(t, 2, handler.full)
+	assert.Zero(t, handler.notModified)
+	entry, err := client.Lookup(url)
+	assert.NoError(t, err)
+	assert.Nil(t, entry)
+}
+
+func TestClient_Get_Errors(t *testing.T) {
+	_, url := newServer(t, "", "")
+	client := New(http.DefaultClient)
+
+	resp, err := client.Get(context.Background(), url+"/missing")
+	assert.NoError(t, err)
+	assert.Nil(t, resp)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "boom", http.StatusInternalServerError)
+	}))
+	defer server.Close()
+	_, err = client.Get(context.Background(), server.URL)
+	assert.ErrorContains(t, err, "500")
+}
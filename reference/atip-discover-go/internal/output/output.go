@@ -6,16 +6,22 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"os"
+	"path/filepath"
 	"reflect"
+	"strings"
+	"time"
+	"unicode/utf8"
 )
 
 // Format represents an output format.
 type Format string
 
 const (
-	FormatJSON  Format = "json"
-	FormatTable Format = "table"
-	FormatQuiet Format = "quiet"
+	FormatJSON   Format = "json"
+	FormatNDJSON Format = "ndjson"
+	FormatTable  Format = "table"
+	FormatQuiet  Format = "quiet"
 )
 
 // Writer is the interface for output formatters.
@@ -28,6 +34,8 @@ func NewWriter(format Format, w io.Writer) (Writer, error) {
 	switch format {
 	case FormatJSON:
 		return NewJSONWriter(w), nil
+	case FormatNDJSON:
+		return NewNDJSONWriter(w), nil
 	case FormatTable:
 		return NewTableWriter(w), nil
 	case FormatQuiet:
@@ -54,9 +62,42 @@ func (jw *JSONWriter) Write(v interface{}) error {
 	return encoder.Encode(v)
 }
 
+// CompactJSONWriter writes output as minified JSON on a single line, for
+// output piped to other programs or stored at scale.
+type CompactJSONWriter struct {
+	w io.Writer
+}
+
+// NewCompactJSONWriter creates a new compact JSON writer.
+func NewCompactJSONWriter(w io.Writer) *CompactJSONWriter {
+	return &CompactJSONWriter{w: w}
+}
+
+// Write writes v as JSON without indentation, followed by a newline.
+func (cw *CompactJSONWriter) Write(v interface{}) error {
+	return json.NewEncoder(cw.w).Encode(v)
+}
+
+// NDJSONWriter writes each value as compact JSON on its own line, so a
+// stream of values can be consumed line by line as it is written.
+type NDJSONWriter struct {
+	w io.Writer
+}
+
+// NewNDJSONWriter creates a new NDJSON writer.
+func NewNDJSONWriter(w io.Writer) *NDJSONWriter {
+	return &NDJSONWriter{w: w}
+}
+
+// Write writes v as a single line of JSON.
+func (nw *NDJSONWriter) Write(v interface{}) error {
+	return json.NewEncoder(nw.w).Encode(v)
+}
+
 // TableWriter writes output in table format.
 type TableWriter struct {
-	w io.Writer
+	w    io.Writer
+	wide bool // Add PATH and LAST_VERIFIED columns and keep descriptions whole
 }
 
 // NewTableWriter creates a new table writer.
@@ -64,6 +105,13 @@ func NewTableWriter(w io.Writer) *TableWriter {
 	return &TableWriter{w: w}
 }
 
+// NewWideTableWriter creates a table writer whose tool lists add PATH and
+// LAST_VERIFIED columns and don't truncate descriptions. Columns are sized
+// to fit their widest value.
+func NewWideTableWriter(w io.Writer) *TableWriter {
+	return &TableWriter{w: w, wide: true}
+}
+
 // Write writes v as a formatted table.
 func (tw *TableWriter) Write(v interface{}) error {
 	// Use reflection to handle different types
@@ -115,14 +163,31 @@ func (tw *TableWriter) writeToolsList(tools interface{}) error {
 		return nil
 	}
 
+	// Lists that report trust get a TRUST column, e.g. "vendor+verified"
+	hasTrust := false
+	if elem := toolsSlice.Type().Elem(); elem.Kind() == reflect.Struct {
+		_, hasTrust = elem.FieldByName("TrustSource")
+	}
+
+	if tw.wide {
+		return tw.writeWideToolsList(toolsSlice, hasTrust)
+	}
+
 	// Write header
-	fmt.Fprintf(tw.w, "%-20s %-10s %-8s %s\n", "NAME", "VERSION", "SOURCE", "DESCRIPTION")
+	if hasTrust {
+		fmt.Fprintf(tw.w, "%-20s %-10s %-8s %-16s %s\n", "NAME", "VERSION", "SOURCE", "TRUST", "DESCRIPTION")
+	} else {
+		fmt.Fprintf(tw.w, "%-20s %-10s %-8s %s\n", "NAME", "VERSION", "SOURCE", "DESCRIPTION")
+	}
 
 	// Write rows
 	for i := 0; i < toolsSlice.Len(); i++ {
 		tool := toolsSlice.Index(i)
 
 		name := getFieldString(tool, "Name")
+		if getFieldString(tool, "Partial") == "true" {
+			name += " (partial)"
+		}
 		version := getFieldString(tool, "Version")
 		source := getFieldString(tool, "Source")
 		description := getFieldString(tool, "Description")
@@ -132,12 +197,114 @@ func (tw *TableWriter) writeToolsList(tools interface{}) error {
 			description = description[:47] + "..."
 		}
 
+		if hasTrust {
+			trust := getFieldString(tool, "TrustSource")
+			if getFieldString(tool, "Verified") == "true" {
+				trust += "+verified"
+			}
+			fmt.Fprintf(tw.w, "%-20s %-10s %-8s %-16s %s\n", name, version, source, trust, description)
+			continue
+		}
 		fmt.Fprintf(tw.w, "%-20s %-10s %-8s %s\n", name, version, source, description)
 	}
 
 	return nil
 }
 
+// writeWideToolsList writes a tool list with every column, including
+// PATH and LAST_VERIFIED, and full descriptions. Without trust, the TRUST
+// column shows VERIFIED instead.
+func (tw *TableWriter) writeWideToolsList(toolsSlice reflect.Value, hasTrust bool) error {
+	trustHeader := "VERIFIED"
+	if hasTrust {
+		trustHeader = "TRUST"
+	}
+	headers := []string{"NAME", "VERSION", "SOURCE", trustHeader, "PATH", "LAST_VERIFIED", "DESCRIPTION"}
+
+	rows := make([][]string, 0, toolsSlice.Len())
+	for i := 0; i < toolsSlice.Len(); i++ {
+		tool := toolsSlice.Index(i)
+
+		name := getFieldString(tool, "Name")
+		if getFieldString(tool, "Partial") == "true" {
+			name += " (partial)"
+		}
+		verified := getFieldString(tool, "Verified") == "true"
+		trust := "no"
+		if hasTrust {
+			trust = getFieldString(tool, "TrustSource")
+			if verified {
+				trust += "+verified"
+			}
+		} else if verified {
+			trust = "yes"
+		}
+		rows = append(rows, []string{
+			name,
+			getFieldString(tool, "Version"),
+			getFieldString(tool, "Source"),
+			trust,
+			orDash(getFieldString(tool, "Path")),
+			getFieldTime(tool, "LastVerified"),
+			getFieldString(tool, "Description"),
+		})
+	}
+	return formatTable(tw.w, headers, rows)
+}
+
+// formatTable writes headers and rows as columns padded to their widest
+// value, separated by two spaces. Lines have no trailing spaces.
+func formatTable(w io.Writer, headers []string, rows [][]string) error {
+	widths := make([]int, len(headers))
+	for _, row := range append([][]string{headers}, rows...) {
+		for i, cell := range row {
+			if n := utf8.RuneCountInString(cell); n > widths[i] {
+				widths[i] = n
+			}
+		}
+	}
+
+	var b strings.Builder
+	for _, row := range append([][]string{headers}, rows...) {
+		var line strings.Builder
+		for i, cell := range row {
+			line.WriteString(cell)
+			if i < len(row)-1 {
+				line.WriteString(strings.Repeat(" ", widths[i]-utf8.RuneCountInString(cell)+2))
+			}
+		}
+		b.WriteString(strings.TrimRight(line.String(), " "))
+		b.WriteString("\n")
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// orDash returns s, or "-" if it's empty, so table cells are never blank.
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// getFieldTime returns a time.Time field in RFC 3339 form, or "-" if the
+// field is missing or zero.
+func getFieldTime(val reflect.Value, fieldName string) string {
+	if val.Kind() != reflect.Struct {
+		return "-"
+	}
+	field := val.FieldByName(fieldName)
+	if !field.IsValid() {
+		return "-"
+	}
+	t, ok := field.Interface().(time.Time)
+	if !ok || t.IsZero() {
+		return "-"
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
 func getFieldString(val reflect.Value, fieldName string) string {
 	if val.Kind() != reflect.Struct {
 		return ""
@@ -202,3 +369,30 @@ func (qw *QuietWriter) Write(v interface{}) error {
 	// Empty output for empty lists
 	return nil
 }
+
+// WriteFile calls write with a temporary file in path's directory and renames
+// it over path once write succeeds, so readers never see partial output. On
+// failure the temporary file is removed and path is left untouched.
+func WriteFile(path string, write func(w io.Writer) error) error {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpPath := f.Name()
+
+	err = write(f)
+	if err == nil {
+		err = f.Chmod(0644)
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, path)
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return nil
+}
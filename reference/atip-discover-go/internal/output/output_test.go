@@ -3,8 +3,13 @@ package output
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -29,6 +34,7 @@ func TestNewWriter(t *testing.T) {
 		format Format
 	}{
 		{"json format", FormatJSON},
+		{"ndjson format", FormatNDJSON},
 		{"table format", FormatTable},
 		{"quiet format", FormatQuiet},
 	}
@@ -101,6 +107,51 @@ func TestJSONWriter_WriteIndented(t *testing.T) {
 	assert.Contains(t, output, "tool")
 }
 
+func TestCompactJSONWriter_Write(t *testing.T) {
+	data := ListResult{
+		Count: 2,
+		Tools: []ToolSummary{
+			{Name: "gh", Version: "2.45.0", Description: "GitHub CLI", Source: "native"},
+			{Name: "kubectl", Version: "1.28.0", Description: "Kubernetes CLI", Source: "native"},
+		},
+	}
+
+	var pretty, compact bytes.Buffer
+	require.NoError(t, NewJSONWriter(&pretty).Write(data))
+	require.NoError(t, NewCompactJSONWriter(&compact).Write(data))
+
+	// One line, no indentation, and smaller
+	output := compact.String()
+	assert.True(t, strings.HasSuffix(output, "}\n"))
+	assert.NotContains(t, strings.TrimSuffix(output, "\n"), "\n")
+	assert.NotContains(t, output, "  ")
+	assert.Less(t, compact.Len(), pretty.Len())
+
+	// Same document either way
+	var fromPretty, fromCompact interface{}
+	require.NoError(t, json.Unmarshal(pretty.Bytes(), &fromPretty))
+	require.NoError(t, json.Unmarshal(compact.Bytes(), &fromCompact))
+	assert.Equal(t, fromPretty, fromCompact)
+}
+
+func TestNDJSONWriter_Write(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewNDJSONWriter(&buf)
+
+	require.NoError(t, w.Write(map[string]interface{}{"name": "gh", "version": "2.45.0"}))
+	require.NoError(t, w.Write(map[string]interface{}{"name": "kubectl", "version": "1.28.0"}))
+
+	// One compact object per line
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	require.Len(t, lines, 2)
+	for i, name := range []string{"gh", "kubectl"} {
+		var v map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(lines[i]), &v))
+		assert.Equal(t, name, v["name"])
+	}
+	assert.Equal(t, `{"name":"gh","version":"2.45.0"}`, lines[0])
+}
+
 func TestTableWriter_WriteList(t *testing.T) {
 	var buf bytes.Buffer
 	w := NewTableWriter(&buf)
@@ -141,6 +192,106 @@ func TestTableWriter_WriteList(t *testing.T) {
 	assert.Contains(t, output, "1.28.0")
 }
 
+func TestTableWriter_TrustColumn(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewTableWriter(&buf)
+
+	type trustedTool struct {
+		Name        string
+		Version     string
+		Source      string
+		Description string
+		TrustSource string
+		Verified    bool
+	}
+	data := struct {
+		Count int
+		Tools []trustedTool
+	}{
+		Count: 2,
+		Tools: []trustedTool{
+			{Name: "gh", Version: "2.45.0", Source: "native", TrustSource: "vendor", Verified: true, Description: "GitHub CLI"},
+			{Name: "jq", Version: "1.7.1", Source: "shim", TrustSource: "unknown", Description: "JSON processor"},
+		},
+	}
+	require.NoError(t, w.Write(data))
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	require.Len(t, lines, 3)
+	assert.Equal(t, []string{"NAME", "VERSION", "SOURCE", "TRUST", "DESCRIPTION"}, strings.Fields(lines[0]))
+	assert.Equal(t, []string{"gh", "2.45.0", "native", "vendor+verified", "GitHub", "CLI"}, strings.Fields(lines[1]))
+	assert.Equal(t, []string{"jq", "1.7.1", "shim", "unknown", "JSON", "processor"}, strings.Fields(lines[2]))
+}
+
+func TestTableWriter_Wide(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWideTableWriter(&buf)
+
+	type listedTool struct {
+		Name         string
+		Version      string
+		Source       string
+		Description  string
+		TrustSource  string
+		Verified     bool
+		Path         string
+		LastVerified time.Time
+	}
+	longDescription := "Work seamlessly with GitHub from the command line, including pull requests and issues"
+	data := struct {
+		Count int
+		Tools []listedTool
+	}{
+		Count: 2,
+		Tools: []listedTool{
+			{Name: "gh", Version: "2.45.0", Source: "native", TrustSource: "vendor", Verified: true, Description: longDescription,
+				Path: "/usr/local/bin/gh", LastVerified: time.Date(2026, 1, 5, 10, 30, 0, 0, time.UTC)},
+			{Name: "kubectl", Version: "1.28.0", Source: "shim", TrustSource: "unknown", Description: "Kubernetes CLI"},
+		},
+	}
+	require.NoError(t, w.Write(data))
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	require.Len(t, lines, 3)
+	assert.Equal(t, []string{"NAME", "VERSION", "SOURCE", "TRUST", "PATH", "LAST_VERIFIED", "DESCRIPTION"}, strings.Fields(lines[0]))
+	assert.Equal(t, "gh       2.45.0   native  vendor+verified  /usr/local/bin/gh  2026-01-05T10:30:00Z  "+longDescription, lines[1])
+	assert.Equal(t, "kubectl  1.28.0   shim    unknown          -                  -                     Kubernetes CLI", lines[2])
+
+	// Columns line up under their headers
+	pathCol := strings.Index(lines[0], "PATH")
+	assert.Equal(t, pathCol, strings.Index(lines[1], "/usr/local/bin/gh"))
+	assert.Equal(t, pathCol, strings.Index(lines[2], "-"))
+}
+
+func TestTableWriter_PartialMarker(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewTableWriter(&buf)
+
+	type tool struct {
+		Name        string
+		Version     string
+		Source      string
+		Description string
+		Partial     bool
+	}
+	data := struct {
+		Count int
+		Tools []tool
+	}{
+		Count: 2,
+		Tools: []tool{
+			{Name: "gh", Version: "2.45.0", Source: "native", Description: "GitHub CLI"},
+			{Name: "kubectl", Version: "1.28.0", Source: "native", Description: "Kubernetes CLI", Partial: true},
+		},
+	}
+	require.NoError(t, w.Write(data))
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	require.Len(t, lines, 3)
+	assert.Equal(t, []string{"gh", "2.45.0", "native", "GitHub", "CLI"}, strings.Fields(lines[1]))
+	assert.Equal(t, []string{"kubectl", "(partial)", "1.28.0", "native", "Kubernetes", "CLI"}, strings.Fields(lines[2]))
+}
+
 func TestTableWriter_EmptyList(t *testing.T) {
 	var buf bytes.Buffer
 	w := NewTableWriter(&buf)
@@ -303,3 +454,50 @@ func TestTableWriter_SingleTool(t *testing.T) {
 	assert.Contains(t, output, "gh")
 	assert.Contains(t, output, "2.45.0")
 }
+
+func TestWriteFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "result.json")
+	require.NoError(t, os.WriteFile(path, []byte("old"), 0600))
+
+	err := WriteFile(path, func(w io.Writer) error {
+		return NewJSONWriter(w).Write(map[string]int{"count": 1})
+	})
+	require.NoError(t, err)
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"count": 1}`, string(data))
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1, "temporary file should be renamed away")
+}
+
+func TestWriteFile_WriteError(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "result.json")
+	require.NoError(t, os.WriteFile(path, []byte("old"), 0644))
+
+	err := WriteFile(path, func(w io.Writer) error {
+		io.WriteString(w, "partial")
+		return errors.New("encode failed")
+	})
+	require.Error(t, err)
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "old", string(data))
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1, "temporary file should be removed")
+}
+
+func TestWriteFile_MissingDirectory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "missing", "result.json")
+
+	err := WriteFile(path, func(w io.Writer) error { return nil })
+	assert.Error(t, err)
+	assert.NoFileExists(t, path)
+}
@@ -0,0 +1,79 @@
+// Package pool bounds how much work runs at once. A Pool can be shared by
+// several components, e.g. Scanners running in the same process, so that
+// together they stay within one limit, or each can be given its own.
+//
+// It is the same as atip-registry's internal/pool, which bounds syncs and
+// crawls; the two modules don't share code, so changes belong in both.
+package pool
+
+import (
+	"context"
+	"sync"
+)
+
+// Pool runs tasks with at most Size of them in flight across every Run
+// sharing it.
+type Pool struct {
+	slots chan struct{}
+}
+
+// New returns a pool running at most size tasks at once. A size below 1 is
+// treated as 1.
+func New(size int) *Pool {
+	if size < 1 {
+		size = 1
+	}
+	return &Pool{slots: make(chan struct{}, size)}
+}
+
+// Size returns the number of tasks the pool runs at once.
+func (p *Pool) Size() int {
+	return cap(p.slots)
+}
+
+// Run calls task(ctx, i) for each i in [0, n), in order of i as slots free
+// up, and waits for them. It returns their errors indexed by i, nil for tasks
+// that succeeded, so one failure doesn't stop the others.
+//
+// If ctx is done, tasks not yet started don't run and get ctx's error. A
+// task must not call Run on its own pool: once every slot is held by a task
+// waiting for a slot, none can finish.
+func (p *Pool) Run(ctx context.Context, n int, task func(ctx context.Context, i int) error) []error {
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		if err := p.acquire(ctx); err != nil {
+			for j := i; j < n; j++ {
+				errs[j] = err
+			}
+			break
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			defer p.release()
+			errs[i] = task(ctx, i)
+		}(i)
+	}
+	wg.Wait()
+	return errs
+}
+
+// acquire takes a slot, or returns ctx's error if ctx is done first.
+func (p *Pool) acquire(ctx context.Context) error {
+	select {
+	case p.slots <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	// A slot and ctx.Done may both have been ready
+	if err := ctx.Err(); err != nil {
+		p.release()
+		return err
+	}
+	return nil
+}
+
+func (p *Pool) release() {
+	<-p.slots
+}
@@ -0,0 +1,149 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// peakTracker counts tasks in flight and remembers the peak.
+type peakTracker struct {
+	inFlight, peak int32
+}
+
+func (pt *peakTracker) enter() {
+	n := atomic.AddInt32(&pt.inFlight, 1)
+	for {
+		p := atomic.LoadInt32(&pt.peak)
+		if n <= p || atomic.CompareAndSwapInt32(&pt.peak, p, n) {
+			break
+		}
+	}
+}
+
+func (pt *peakTracker) leave() {
+	atomic.AddInt32(&pt.inFlight, -1)
+}
+
+func TestNew_Size(t *testing.T) {
+	assert.Equal(t, 3, New(3).Size())
+	assert.Equal(t, 1, New(0).Size())
+	assert.Equal(t, 1, New(-2).Size())
+}
+
+func TestPool_Run_Bound(t *testing.T) {
+	for _, size := range []int{1, 3} {
+		t.Run(fmt.Sprintf("size=%d", size), func(t *testing.T) {
+			var pt peakTracker
+			var ran int32
+			errs := New(size).Run(context.Background(), 10, func(ctx context.Context, i int) error {
+				pt.enter()
+				defer pt.leave()
+				time.Sleep(10 * time.Millisecond)
+				atomic.AddInt32(&ran, 1)
+				return nil
+			})
+
+			assert.Len(t, errs, 10)
+			for _, err := range errs {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, int32(10), ran)
+			assert.Equal(t, int32(size), pt.peak)
+		})
+	}
+}
+
+func TestPool_Run_SharedBound(t *testing.T) {
+	// Two Runs on one pool stay within its size together
+	p := New(2)
+	var pt peakTracker
+	task := func(ctx context.Context, i int) error {
+		pt.enter()
+		defer pt.leave()
+		time.Sleep(10 * time.Millisecond)
+		return nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p.Run(context.Background(), 5, task)
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(2), pt.peak)
+}
+
+func TestPool_Run_CollectsErrors(t *testing.T) {
+	errOdd := errors.New("odd")
+	var ran int32
+	errs := New(2).Run(context.Background(), 5, func(ctx context.Context, i int) error {
+		atomic.AddInt32(&ran, 1)
+		if i%2 == 1 {
+			return fmt.Errorf("task %d: %w", i, errOdd)
+		}
+		return nil
+	})
+
+	// A failure doesn't stop the other tasks
+	assert.Equal(t, int32(5), ran)
+	require.Len(t, errs, 5)
+	for i, err := range errs {
+		if i%2 == 1 {
+			assert.ErrorIs(t, err, errOdd)
+			assert.Contains(t, err.Error(), fmt.Sprintf("task %d", i))
+		} else {
+			assert.NoError(t, err)
+		}
+	}
+}
+
+func TestPool_Run_Cancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var ran int32
+	errs := New(1).Run(ctx, 4, func(ctx context.Context, i int) error {
+		atomic.AddInt32(&ran, 1)
+		cancel()
+		return nil
+	})
+
+	// The first task cancels; the rest never start
+	assert.Equal(t, int32(1), ran)
+	require.Len(t, errs, 4)
+	assert.NoError(t, errs[0])
+	for _, err := range errs[1:] {
+		assert.ErrorIs(t, err, context.Canceled)
+	}
+}
+
+func TestPool_Run_AlreadyCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	errs := New(4).Run(ctx, 3, func(ctx context.Context, i int) error {
+		t.Error("task ran after cancellation")
+		return nil
+	})
+	for _, err := range errs {
+		assert.ErrorIs(t, err, context.Canceled)
+	}
+}
+
+func TestPool_Run_Empty(t *testing.T) {
+	errs := New(1).Run(context.Background(), 0, func(ctx context.Context, i int) error {
+		t.Error("task ran with n = 0")
+		return nil
+	})
+	assert.Empty(t, errs)
+}
@@ -0,0 +1,110 @@
+package registry
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// annotationKeyRegex matches valid annotation keys.
+var annotationKeyRegex = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._/-]*$`)
+
+// annotationChange is a parsed "key=value" (set) or "key-" (remove)
+// argument of the annotate command.
+type annotationChange struct {
+	Key    string
+	Value  string
+	Remove bool
+}
+
+// parseAnnotationChange parses "key=value", which sets key to value, or
+// "key-", which removes key. Keys are made of letters, digits, '.', '_', '/'
+// and '-', starting with a letter or digit; values may be anything,
+// including empty.
+func parseAnnotationChange(s string) (annotationChange, error) {
+	if key, value, ok := strings.Cut(s, "="); ok {
+		if err := validateAnnotationKey(key); err != nil {
+			return annotationChange{}, err
+		}
+		return annotationChange{Key: key, Value: value}, nil
+	}
+	if key, ok := strings.CutSuffix(s, "-"); ok {
+		if err := validateAnnotationKey(key); err != nil {
+			return annotationChange{}, err
+		}
+		return annotationChange{Key: key, Remove: true}, nil
+	}
+	return annotationChange{}, fmt.Errorf("invalid annotation %q: use key=value to set or key- to remove", s)
+}
+
+// validateAnnotationKey checks that key is a valid annotation key.
+func validateAnnotationKey(key string) error {
+	if !annotationKeyRegex.MatchString(key) {
+		return fmt.Errorf("invalid annotation key %q: use letters, digits, '.', '_', '/' and '-'", key)
+	}
+	return nil
+}
+
+// Annotate sets and removes the entry's annotations, in order. Like manual
+// tags, annotations are kept when the tool is probed again. If any change
+// is invalid, none are applied.
+func (e *RegistryEntry) Annotate(changes ...string) error {
+	parsed := make([]annotationChange, 0, len(changes))
+	for _, s := range changes {
+		c, err := parseAnnotationChange(s)
+		if err != nil {
+			return err
+		}
+		parsed = append(parsed, c)
+	}
+
+	for _, c := range parsed {
+		if c.Remove {
+			delete(e.Annotations, c.Key)
+			continue
+		}
+		if e.Annotations == nil {
+			e.Annotations = make(map[string]string)
+		}
+		e.Annotations[c.Key] = c.Value
+	}
+	if len(e.Annotations) == 0 {
+		e.Annotations = nil
+	}
+	return nil
+}
+
+// HasAnnotation reports whether the entry matches selector: "key=value"
+// matches an entry annotated with key set to value, and "key" one
+// annotated with key at all.
+func (e *RegistryEntry) HasAnnotation(selector string) bool {
+	key, value, withValue := strings.Cut(selector, "=")
+	got, ok := e.Annotations[key]
+	return ok && (!withValue || got == value)
+}
+
+// FilterByAnnotations returns the entries matching every selector (see
+// HasAnnotation), in order.
+func FilterByAnnotations(entries []*RegistryEntry, selectors []string) ([]*RegistryEntry, error) {
+	for _, selector := range selectors {
+		key, _, _ := strings.Cut(selector, "=")
+		if err := validateAnnotationKey(key); err != nil {
+			return nil, err
+		}
+	}
+
+	var result []*RegistryEntry
+	for _, entry := range entries {
+		matched := true
+		for _, selector := range selectors {
+			if !entry.HasAnnotation(selector) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			result = append(result, entry)
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,72 @@
+package registry
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAnnotate(t *testing.T) {
+	entry := &RegistryEntry{Name: "gh"}
+	require.NoError(t, entry.Annotate("approved-for-prod=true", "owner=platform team", "note=a=b"))
+	assert.Equal(t, map[string]string{"approved-for-prod": "true", "owner": "platform team", "note": "a=b"}, entry.Annotations)
+
+	require.NoError(t, entry.Annotate("owner-", "approved-for-prod=false", "missing-"))
+	assert.Equal(t, map[string]string{"approved-for-prod": "false", "note": "a=b"}, entry.Annotations)
+
+	// Nothing is applied if any change is invalid
+	for _, change := range []string{"no-value-or-dash", "=x", "bad key=x", "-"} {
+		assert.Error(t, entry.Annotate("owner=me", change), change)
+	}
+	assert.Equal(t, map[string]string{"approved-for-prod": "false", "note": "a=b"}, entry.Annotations)
+
+	require.NoError(t, entry.Annotate("approved-for-prod-", "note-"))
+	assert.Nil(t, entry.Annotations)
+}
+
+func TestAdd_KeepsAnnotations(t *testing.T) {
+	r := New(filepath.Join(t.TempDir(), "registry.json"), t.TempDir())
+	require.NoError(t, r.Add(&RegistryEntry{Name: "gh", Version: "2.44.0", Source: "native"}))
+	entry, err := r.Get("gh")
+	require.NoError(t, err)
+	require.NoError(t, entry.Annotate("deprecated=use glab"))
+	require.NoError(t, r.Save())
+
+	// A re-probe replaces the entry but keeps its annotations
+	r, err = Load(r.path, r.dataDir)
+	require.NoError(t, err)
+	require.NoError(t, r.Add(&RegistryEntry{Name: "gh", Version: "2.45.0", Source: "native"}))
+	entry, err = r.Get("gh")
+	require.NoError(t, err)
+	assert.Equal(t, "2.45.0", entry.Version)
+	assert.Equal(t, map[string]string{"deprecated": "use glab"}, entry.Annotations)
+}
+
+func TestFilterByAnnotations(t *testing.T) {
+	entries := []*RegistryEntry{
+		{Name: "gh", Annotations: map[string]string{"approved-for-prod": "true", "owner": "infra"}},
+		{Name: "git", Annotations: map[string]string{"approved-for-prod": "false"}},
+		{Name: "jq"},
+	}
+	names := func(selectors ...string) []string {
+		filtered, err := FilterByAnnotations(entries, selectors)
+		require.NoError(t, err)
+		var names []string
+		for _, e := range filtered {
+			names = append(names, e.Name)
+		}
+		return names
+	}
+
+	assert.Equal(t, []string{"gh", "git", "jq"}, names())
+	assert.Equal(t, []string{"gh"}, names("approved-for-prod=true"))
+	assert.Equal(t, []string{"gh", "git"}, names("approved-for-prod"))
+	assert.Equal(t, []string{"gh"}, names("approved-for-prod", "owner=infra"))
+	assert.Empty(t, names("approved-for-prod=false", "owner"))
+	assert.Empty(t, names("owner="))
+
+	_, err := FilterByAnnotations(entries, []string{"bad key"})
+	assert.Error(t, err)
+}
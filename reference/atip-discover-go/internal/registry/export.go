@@ -0,0 +1,156 @@
+package registry
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/atip/atip-discover/internal/validator"
+)
+
+// Record is one tool in a registry export: its registry entry and, if it
+// was exported with its metadata, the cached metadata.
+type Record struct {
+	RegistryEntry
+	Metadata json.RawMessage `json:"metadata,omitempty"`
+}
+
+// Export is a registry exported as a single JSON document. NDJSON exports
+// have one Record per line instead.
+type Export struct {
+	Version  string    `json:"version"`
+	LastScan time.Time `json:"last_scan"`
+	Tools    []*Record `json:"tools"`
+}
+
+// ImportError reports a line of an import that couldn't be imported.
+type ImportError struct {
+	Line  int    `json:"line"`
+	Error string `json:"error"`
+}
+
+// sources are the values RegistryEntry.Source may take.
+var sources = map[string]bool{"native": true, "inferred": true, "shim": true}
+
+// Validate checks that an entry can be added to the registry: it has a
+// name usable as a file name, a version and a known source, and tools that
+// were probed have an absolute path.
+func (e *RegistryEntry) Validate() error {
+	if e.Name == "" {
+		return errors.New("name is required")
+	}
+	if strings.ContainsAny(e.Name, `/\`) || e.Name == "." || e.Name == ".." {
+		return fmt.Errorf("invalid name %q", e.Name)
+	}
+	if e.Version == "" {
+		return fmt.Errorf("%s: version is required", e.Name)
+	}
+	if !sources[e.Source] {
+		return fmt.Errorf("%s: unknown source %q (native, inferred or shim)", e.Name, e.Source)
+	}
+	if e.Source != "shim" && !filepath.IsAbs(e.Path) {
+		return fmt.Errorf("%s: a %s tool needs an absolute path", e.Name, e.Source)
+	}
+	return nil
+}
+
+// ParseRecord parses one record of an import: a Record as exported, or ATIP
+// metadata on its own (recognized by its atip field), which is registered
+// like a shim. Metadata in either form is validated with v.
+func ParseRecord(data []byte, v *validator.Validator) (*Record, error) {
+	var probe struct {
+		Atip json.RawMessage `json:"atip"`
+	}
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+
+	if probe.Atip != nil {
+		metadata, err := parseMetadata(data, v)
+		if err != nil {
+			return nil, err
+		}
+		entry := RegistryEntry{
+			Name:        metadata.Name,
+			Version:     metadata.Version,
+			Source:      "shim",
+			AtipVersion: metadata.AtipVersion(),
+			Tags:        InferTags(metadata),
+		}
+		if metadata.Binary != nil {
+			entry.Platform = metadata.Binary.Platform
+			entry.Checksum = metadata.Binary.Hash
+		}
+		if err := entry.Validate(); err != nil {
+			return nil, err
+		}
+		return &Record{RegistryEntry: entry, Metadata: data}, nil
+	}
+
+	var record Record
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, fmt.Errorf("invalid registry entry: %w", err)
+	}
+	if err := record.Validate(); err != nil {
+		return nil, err
+	}
+	if record.Metadata != nil {
+		metadata, err := parseMetadata(record.Metadata, v)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", record.Name, err)
+		}
+		if metadata.Name != record.Name {
+			return nil, fmt.Errorf("%s: metadata is for %q", record.Name, metadata.Name)
+		}
+	}
+	return &record, nil
+}
+
+// ParseImport parses an import: NDJSON with one record per line, skipping
+// blank lines, or a JSON Export, whose tools are numbered from 1 as if they
+// were lines. It returns the records that parsed and an error for each that
+// didn't.
+func ParseImport(data []byte, v *validator.Validator) ([]*Record, []ImportError) {
+	lines := bytes.Split(data, []byte("\n"))
+	var export struct {
+		Tools []json.RawMessage `json:"tools"`
+	}
+	if err := json.Unmarshal(data, &export); err == nil && export.Tools != nil {
+		lines = make([][]byte, len(export.Tools))
+		for i, tool := range export.Tools {
+			lines[i] = tool
+		}
+	}
+
+	var records []*Record
+	var errs []ImportError
+	for i, line := range lines {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		record, err := ParseRecord(line, v)
+		if err != nil {
+			errs = append(errs, ImportError{Line: i + 1, Error: err.Error()})
+			continue
+		}
+		records = append(records, record)
+	}
+	return records, errs
+}
+
+// parseMetadata parses and validates ATIP metadata.
+func parseMetadata(data []byte, v *validator.Validator) (*validator.AtipMetadata, error) {
+	var metadata validator.AtipMetadata
+	if err := json.Unmarshal(data, &metadata); err != nil {
+		return nil, fmt.Errorf("invalid metadata: %w", err)
+	}
+	if err := v.ValidateMetadata(&metadata); err != nil {
+		return nil, fmt.Errorf("invalid metadata: %w", err)
+	}
+	return &metadata, nil
+}
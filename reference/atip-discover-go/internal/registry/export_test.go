@@ -0,0 +1,147 @@
+package registry
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/atip/atip-discover/internal/validator"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistryEntry_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		entry   RegistryEntry
+		wantErr string
+	}{
+		{"native", RegistryEntry{Name: "gh", Version: "2.45.0", Source: "native", Path: "/usr/bin/gh"}, ""},
+		{"shim without path", RegistryEntry{Name: "curl", Version: "8.4.0", Source: "shim"}, ""},
+		{"no name", RegistryEntry{Version: "1.0.0", Source: "shim"}, "name is required"},
+		{"path as name", RegistryEntry{Name: "../gh", Version: "1.0.0", Source: "shim"}, "invalid name"},
+		{"no version", RegistryEntry{Name: "gh", Source: "native", Path: "/usr/bin/gh"}, "version is required"},
+		{"unknown source", RegistryEntry{Name: "gh", Version: "2.45.0", Source: "manual"}, "unknown source"},
+		{"relative path", RegistryEntry{Name: "gh", Version: "2.45.0", Source: "inferred", Path: "bin/gh"}, "absolute path"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.entry.Validate()
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+			} else {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseRecord(t *testing.T) {
+	v, err := validator.Default()
+	require.NoError(t, err)
+
+	t.Run("registry entry", func(t *testing.T) {
+		record, err := ParseRecord([]byte(`{"name": "gh", "version": "2.45.0", "path": "/usr/bin/gh", "source": "native", "tags": ["github"]}`), v)
+		require.NoError(t, err)
+		assert.Equal(t, "gh", record.Name)
+		assert.Equal(t, "/usr/bin/gh", record.Path)
+		assert.Equal(t, []string{"github"}, record.Tags)
+		assert.Nil(t, record.Metadata)
+	})
+
+	t.Run("registry entry with metadata", func(t *testing.T) {
+		record, err := ParseRecord([]byte(`{"name": "gh", "version": "2.45.0", "path": "/usr/bin/gh", "source": "native",
+			"metadata": {"atip": {"version": "0.6"}, "name": "gh", "version": "2.45.0", "description": "GitHub CLI"}}`), v)
+		require.NoError(t, err)
+		assert.Equal(t, "native", record.Source)
+		assert.Contains(t, string(record.Metadata), "GitHub CLI")
+	})
+
+	t.Run("metadata", func(t *testing.T) {
+		line := `{"atip": "0.4", "name": "kubectl", "version": "1.28.0", "description": "Kubernetes CLI", "homepage": "https://kubernetes.io",
+			"binary": {"hash": "sha256:abc", "platform": "linux-amd64"}}`
+		record, err := ParseRecord([]byte(line), v)
+		require.NoError(t, err)
+		assert.Equal(t, "kubectl", record.Name)
+		assert.Equal(t, "1.28.0", record.Version)
+		assert.Equal(t, "shim", record.Source)
+		assert.Equal(t, "linux-amd64", record.Platform)
+		assert.Equal(t, "sha256:abc", record.Checksum)
+		assert.Equal(t, "0.4", record.AtipVersion)
+		assert.Equal(t, []string{"kubernetes"}, record.Tags)
+		assert.JSONEq(t, line, string(record.Metadata))
+	})
+
+	errorTests := []struct {
+		name    string
+		line    string
+		wantErr string
+	}{
+		{"not JSON", `{"name": "gh"`, "invalid JSON"},
+		{"invalid entry", `{"name": "gh", "version": "2.45.0", "source": "native"}`, "absolute path"},
+		{"invalid metadata", `{"atip": {"version": "0.6"}, "name": "gh", "version": "2.45.0"}`, "invalid metadata"},
+		{"invalid embedded metadata", `{"name": "gh", "version": "2.45.0", "source": "shim", "metadata": {"atip": {"version": "0.6"}, "name": "gh"}}`, "gh: invalid metadata"},
+		{"metadata for another tool", `{"name": "gh", "version": "2.45.0", "source": "shim",
+			"metadata": {"atip": {"version": "0.6"}, "name": "jq", "version": "1.7.1", "description": "JSON processor"}}`, `metadata is for "jq"`},
+	}
+	for _, tt := range errorTests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseRecord([]byte(tt.line), v)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
+
+func TestParseImport(t *testing.T) {
+	v, err := validator.Default()
+	require.NoError(t, err)
+
+	t.Run("ndjson", func(t *testing.T) {
+		data := `{"name": "gh", "version": "2.45.0", "path": "/usr/bin/gh", "source": "native"}
+
+{"name": "broken"
+{"atip": {"version": "0.6"}, "name": "jq", "version": "1.7.1", "description": "JSON processor"}
+{"name": "kubectl", "version": "1.28.0", "source": "magic"}
+`
+		records, errs := ParseImport([]byte(data), v)
+		require.Len(t, records, 2)
+		assert.Equal(t, "gh", records[0].Name)
+		assert.Equal(t, "jq", records[1].Name)
+
+		// Line numbers count the blank line
+		require.Len(t, errs, 2)
+		assert.Equal(t, 3, errs[0].Line)
+		assert.Contains(t, errs[0].Error, "invalid JSON")
+		assert.Equal(t, 5, errs[1].Line)
+		assert.Contains(t, errs[1].Error, "unknown source")
+	})
+
+	t.Run("json export", func(t *testing.T) {
+		export := Export{
+			Version:  "1",
+			LastScan: time.Date(2026, 1, 5, 10, 30, 0, 0, time.UTC),
+			Tools: []*Record{
+				{RegistryEntry: RegistryEntry{Name: "gh", Version: "2.45.0", Path: "/usr/bin/gh", Source: "native"}},
+				{RegistryEntry: RegistryEntry{Name: "jq", Source: "shim"}},
+			},
+		}
+		data, err := json.MarshalIndent(export, "", "  ")
+		require.NoError(t, err)
+
+		records, errs := ParseImport(data, v)
+		require.Len(t, records, 1)
+		assert.Equal(t, "gh", records[0].Name)
+		require.Len(t, errs, 1)
+		assert.Equal(t, 2, errs[0].Line)
+		assert.Contains(t, errs[0].Error, "version is required")
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		records, errs := ParseImport([]byte("\n\n"), v)
+		assert.Empty(t, records)
+		assert.Empty(t, errs)
+	})
+}
@@ -0,0 +1,39 @@
+package registry
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+// ErrCorruptMetadata is returned by VerifyMetadata when cached metadata no
+// longer matches the digest recorded when it was cached.
+var ErrCorruptMetadata = errors.New("cached metadata is corrupt")
+
+// MetadataDigest returns the digest recorded for cached metadata, e.g.
+// "sha256:9f86d0...".
+func MetadataDigest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// SetMetadata records the digest of the metadata about to be cached for the
+// entry, so that VerifyMetadata can check it when it is read back.
+func (e *RegistryEntry) SetMetadata(data []byte) {
+	e.MetadataDigest = MetadataDigest(data)
+}
+
+// VerifyMetadata checks cached metadata read for the entry against the
+// digest recorded when it was cached, and returns an error wrapping
+// ErrCorruptMetadata if they differ. Entries cached before digests were
+// recorded have none and are not checked.
+func (e *RegistryEntry) VerifyMetadata(data []byte) error {
+	if e.MetadataDigest == "" {
+		return nil
+	}
+	if actual := MetadataDigest(data); actual != e.MetadataDigest {
+		return fmt.Errorf("%w: %s recorded %s, file is %s", ErrCorruptMetadata, e.Name, e.MetadataDigest, actual)
+	}
+	return nil
+}
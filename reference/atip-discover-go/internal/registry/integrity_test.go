@@ -0,0 +1,63 @@
+package registry
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetadataDigest(t *testing.T) {
+	digest := MetadataDigest([]byte(`{"name":"gh"}`))
+	assert.True(t, strings.HasPrefix(digest, "sha256:"))
+	assert.Len(t, digest, len("sha256:")+64)
+	assert.Equal(t, digest, MetadataDigest([]byte(`{"name":"gh"}`)))
+	assert.NotEqual(t, digest, MetadataDigest([]byte(`{"name":"gh" }`)))
+}
+
+func TestRegistryEntry_VerifyMetadata(t *testing.T) {
+	data := []byte(`{"name": "gh", "version": "2.45.0"}`)
+	entry := &RegistryEntry{Name: "gh"}
+
+	// Entries cached before digests were recorded aren't checked
+	assert.NoError(t, entry.VerifyMetadata([]byte("garbage")))
+
+	entry.SetMetadata(data)
+	assert.NoError(t, entry.VerifyMetadata(data))
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"truncated", data[:10]},
+		{"modified", []byte(`{"name": "gh", "version": "9.99.9"}`)},
+		{"empty", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := entry.VerifyMetadata(tt.data)
+			require.Error(t, err)
+			assert.ErrorIs(t, err, ErrCorruptMetadata)
+			assert.Contains(t, err.Error(), "gh")
+		})
+	}
+}
+
+func TestRegistry_MetadataDigestPersists(t *testing.T) {
+	tmpDir := t.TempDir()
+	regPath := filepath.Join(tmpDir, "registry.json")
+	reg := New(regPath, tmpDir)
+	entry := &RegistryEntry{Name: "gh", Version: "2.45.0", Source: "native"}
+	entry.SetMetadata([]byte(`{"name": "gh"}`))
+	require.NoError(t, reg.Add(entry))
+	require.NoError(t, reg.Save())
+
+	loaded, err := Load(regPath, tmpDir)
+	require.NoError(t, err)
+	got, err := loaded.Get("gh")
+	require.NoError(t, err)
+	assert.Equal(t, entry.MetadataDigest, got.MetadataDigest)
+	assert.NoError(t, got.VerifyMetadata([]byte(`{"name": "gh"}`)))
+}
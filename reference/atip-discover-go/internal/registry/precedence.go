@@ -0,0 +1,133 @@
+package registry
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Ranks order the sources that can provide a tool's metadata. An entry's
+// rank is its source, with shims split by whether their metadata declares
+// trust.verified.
+const (
+	RankNative       = "native"
+	RankVerifiedShim = "verified-shim"
+	RankShim         = "shim"
+	RankInferred     = "inferred"
+)
+
+// DefaultPrecedence is the order, highest first, in which Add lets sources
+// replace each other unless SetPrecedence changes it: a tool's own --agent
+// output beats a verified shim, which beats a community shim, which beats
+// metadata inferred from --help.
+var DefaultPrecedence = []string{RankNative, RankVerifiedShim, RankShim, RankInferred}
+
+// ErrShadowed is returned by Add for an entry that lost to a registered
+// entry of higher precedence. The loser is recorded in the winner's
+// Shadowed list instead of being registered.
+var ErrShadowed = errors.New("shadowed by a higher-precedence source")
+
+// ShadowedEntry records an entry for the same tool name that lost to the
+// registered one, so it is clear which other sources provide the tool.
+type ShadowedEntry struct {
+	Source   string `json:"source"`
+	Verified bool   `json:"verified,omitempty"`
+	Version  string `json:"version"`
+	Path     string `json:"path,omitempty"`
+}
+
+// Rank returns the entry's precedence rank.
+func (e *RegistryEntry) Rank() string {
+	if e.Source == "shim" && e.Verified {
+		return RankVerifiedShim
+	}
+	return e.Source
+}
+
+// ValidatePrecedence checks that order lists only known ranks, each once.
+func ValidatePrecedence(order []string) error {
+	seen := make(map[string]bool, len(order))
+	for _, rank := range order {
+		switch rank {
+		case RankNative, RankVerifiedShim, RankShim, RankInferred:
+		default:
+			return fmt.Errorf("unknown source %q (%s)", rank, strings.Join(DefaultPrecedence, ", "))
+		}
+		if seen[rank] {
+			return fmt.Errorf("source %q listed twice", rank)
+		}
+		seen[rank] = true
+	}
+	return nil
+}
+
+// SetPrecedence replaces the order, highest first, in which Add lets
+// sources replace each other. Ranks left out of order come after the
+// listed ones, in their default order; nil restores DefaultPrecedence.
+func (r *Registry) SetPrecedence(order []string) error {
+	if err := ValidatePrecedence(order); err != nil {
+		return err
+	}
+	r.precedence = order
+	return nil
+}
+
+// priority returns the position of rank in the registry's precedence
+// order; lower wins.
+func (r *Registry) priority(rank string) int {
+	for i, listed := range r.precedence {
+		if listed == rank {
+			return i
+		}
+	}
+	for i, listed := range DefaultPrecedence {
+		if listed == rank {
+			return len(r.precedence) + i
+		}
+	}
+	return len(r.precedence) + len(DefaultPrecedence)
+}
+
+// outranks reports whether a takes precedence over b. Entries of the same
+// rank don't outrank each other, so a newer one replaces an older one.
+func (r *Registry) outranks(a, b *RegistryEntry) bool {
+	return r.priority(a.Rank()) < r.priority(b.Rank())
+}
+
+// shadow records loser in the entry's Shadowed list, replacing an earlier
+// record of the same rank.
+func (e *RegistryEntry) shadow(loser *RegistryEntry) {
+	record := ShadowedEntry{
+		Source:   loser.Source,
+		Verified: loser.Verified,
+		Version:  loser.Version,
+		Path:     loser.Path,
+	}
+	for i, shadowed := range e.Shadowed {
+		if shadowed.rank() == loser.Rank() {
+			e.Shadowed[i] = record
+			return
+		}
+	}
+	e.Shadowed = append(e.Shadowed, record)
+}
+
+// inheritShadowed takes over the records of replaced, an entry of the same
+// name this one replaces, and records replaced itself if its rank differs.
+func (e *RegistryEntry) inheritShadowed(replaced *RegistryEntry) {
+	if e.Shadowed == nil {
+		for _, shadowed := range replaced.Shadowed {
+			if shadowed.rank() != e.Rank() {
+				e.Shadowed = append(e.Shadowed, shadowed)
+			}
+		}
+	}
+	if replaced.Rank() != e.Rank() {
+		e.shadow(replaced)
+	}
+}
+
+func (s ShadowedEntry) rank() string {
+	entry := RegistryEntry{Source: s.Source, Verified: s.Verified}
+	return entry.Rank()
+}
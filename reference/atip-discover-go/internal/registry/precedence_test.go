@@ -0,0 +1,109 @@
+package registry
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdd_NativeNotClobberedByShim(t *testing.T) {
+	r := New(filepath.Join(t.TempDir(), "registry.json"), t.TempDir())
+	require.NoError(t, r.Add(&RegistryEntry{Name: "gh", Version: "2.45.0", Path: "/usr/bin/gh", Source: "native"}))
+
+	err := r.Add(&RegistryEntry{Name: "gh", Version: "2.40.0", Path: "/shims/gh.json", Source: "shim", Verified: true})
+	assert.ErrorIs(t, err, ErrShadowed)
+
+	gh, err := r.Get("gh")
+	require.NoError(t, err)
+	assert.Equal(t, "native", gh.Source)
+	assert.Equal(t, "2.45.0", gh.Version)
+	assert.Equal(t, []ShadowedEntry{
+		{Source: "shim", Verified: true, Version: "2.40.0", Path: "/shims/gh.json"},
+	}, gh.Shadowed)
+
+	// Updating the native entry keeps the record
+	require.NoError(t, r.Add(&RegistryEntry{Name: "gh", Version: "2.46.0", Path: "/usr/bin/gh", Source: "native"}))
+	gh, err = r.Get("gh")
+	require.NoError(t, err)
+	assert.Equal(t, "2.46.0", gh.Version)
+	assert.Len(t, gh.Shadowed, 1)
+}
+
+func TestAdd_NativeReplacesShim(t *testing.T) {
+	r := New(filepath.Join(t.TempDir(), "registry.json"), t.TempDir())
+	require.NoError(t, r.Add(&RegistryEntry{Name: "gh", Version: "2.40.0", Path: "/shims/gh.json", Source: "shim", ManualTags: []string{"vcs"}}))
+	require.NoError(t, r.Add(&RegistryEntry{Name: "gh", Version: "2.45.0", Path: "/usr/bin/gh", Source: "native"}))
+
+	gh, err := r.Get("gh")
+	require.NoError(t, err)
+	assert.Equal(t, "native", gh.Source)
+	assert.Equal(t, []string{"vcs"}, gh.ManualTags)
+	assert.Equal(t, []ShadowedEntry{{Source: "shim", Version: "2.40.0", Path: "/shims/gh.json"}}, gh.Shadowed)
+}
+
+func TestAdd_VerifiedShimPrecedence(t *testing.T) {
+	r := New(filepath.Join(t.TempDir(), "registry.json"), t.TempDir())
+	require.NoError(t, r.Add(&RegistryEntry{Name: "jq", Version: "1.7.0", Source: "shim", Verified: true}))
+
+	// An unverified shim doesn't replace a verified one
+	assert.ErrorIs(t, r.Add(&RegistryEntry{Name: "jq", Version: "1.7.1", Source: "shim"}), ErrShadowed)
+	// Nor does metadata inferred from --help
+	assert.ErrorIs(t, r.Add(&RegistryEntry{Name: "jq", Version: "1.7.1", Path: "/usr/bin/jq", Source: "inferred"}), ErrShadowed)
+
+	jq, err := r.Get("jq")
+	require.NoError(t, err)
+	assert.Equal(t, "1.7.0", jq.Version)
+	assert.Len(t, jq.Shadowed, 2)
+
+	// A newer verified shim is an update
+	require.NoError(t, r.Add(&RegistryEntry{Name: "jq", Version: "1.7.2", Source: "shim", Verified: true}))
+	jq, err = r.Get("jq")
+	require.NoError(t, err)
+	assert.Equal(t, "1.7.2", jq.Version)
+	assert.Len(t, jq.Shadowed, 2)
+}
+
+func TestSetPrecedence(t *testing.T) {
+	r := New(filepath.Join(t.TempDir(), "registry.json"), t.TempDir())
+	require.NoError(t, r.SetPrecedence([]string{RankVerifiedShim}))
+
+	// Verified shims now beat native tools, which still beat other shims
+	require.NoError(t, r.Add(&RegistryEntry{Name: "gh", Version: "2.40.0", Source: "shim", Verified: true}))
+	assert.ErrorIs(t, r.Add(&RegistryEntry{Name: "gh", Version: "2.45.0", Path: "/usr/bin/gh", Source: "native"}), ErrShadowed)
+	require.NoError(t, r.Add(&RegistryEntry{Name: "kubectl", Version: "1.28.0", Path: "/usr/bin/kubectl", Source: "native"}))
+	assert.ErrorIs(t, r.Add(&RegistryEntry{Name: "kubectl", Version: "1.27.0", Source: "shim"}), ErrShadowed)
+
+	gh, err := r.Get("gh")
+	require.NoError(t, err)
+	assert.Equal(t, "shim", gh.Source)
+	assert.Equal(t, []ShadowedEntry{{Source: "native", Version: "2.45.0", Path: "/usr/bin/gh"}}, gh.Shadowed)
+
+	assert.Error(t, r.SetPrecedence([]string{"native", "vendor"}))
+	assert.Error(t, r.SetPrecedence([]string{"native", "native"}))
+}
+
+func TestLoadShims_PreferShimsRecordsShadowed(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeShim(t, tmpDir, "gh", `{"atip": {"version": "0.6"}, "name": "gh", "version": "2.40.0", "description": "shim"}`)
+
+	r := New(filepath.Join(tmpDir, "registry.json"), tmpDir)
+	require.NoError(t, r.Add(&RegistryEntry{Name: "gh", Version: "2.45.0", Path: "/usr/bin/gh", Source: "native"}))
+
+	_, err := r.LoadShims(true)
+	require.NoError(t, err)
+
+	gh, err := r.Get("gh")
+	require.NoError(t, err)
+	assert.Equal(t, "shim", gh.Source)
+	assert.Equal(t, []ShadowedEntry{{Source: "native", Version: "2.45.0", Path: "/usr/bin/gh"}}, gh.Shadowed)
+}
+
+func writeShim(t *testing.T, dataDir, name, content string) {
+	t.Helper()
+	shimsDir := filepath.Join(dataDir, "shims")
+	require.NoError(t, os.MkdirAll(shimsDir, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(shimsDir, name+".json"), []byte(content), 0644))
+}
@@ -4,26 +4,40 @@ package registry
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 
+	"github.com/atip/atip-discover/internal/clock"
 	"github.com/atip/atip-discover/internal/validator"
 )
 
 // RegistryEntry represents a discovered tool in the registry.
 type RegistryEntry struct {
-	Name         string    `json:"name"`
-	Version      string    `json:"version"`
-	Path         string    `json:"path"`
-	Source       string    `json:"source"` // "native" or "shim"
-	DiscoveredAt time.Time `json:"discovered_at"`
-	LastVerified time.Time `json:"last_verified"`
-	MetadataFile string    `json:"metadata_file,omitempty"`
-	Checksum     string    `json:"checksum,omitempty"`
-	ModTime      time.Time `json:"mod_time,omitempty"`
+	Name           string          `json:"name"`
+	Version        string          `json:"version"`
+	Path           string          `json:"path"`
+	Source         string          `json:"source"`             // "native", "inferred" (from --help) or "shim"
+	Platform       string          `json:"platform,omitempty"` // e.g. "linux-amd64", empty if unknown
+	AtipVersion    string          `json:"atip_version,omitempty"`
+	Unsupported    bool            `json:"unsupported,omitempty"` // ATIP version outside the range of the last scan
+	DiscoveredAt   time.Time       `json:"discovered_at"`
+	LastVerified   time.Time       `json:"last_verified"`
+	MetadataFile   string          `json:"metadata_file,omitempty"`
+	Checksum       string          `json:"checksum,omitempty"`
+	MetadataDigest string          `json:"metadata_digest,omitempty"` // Digest of the cached metadata file, see VerifyMetadata
+	ModTime        time.Time       `json:"mod_time,omitempty"`
+	Missing        bool            `json:"missing,omitempty"`     // Executable gone from a scanned directory
+	Tags           []string        `json:"tags,omitempty"`        // Inferred and manual tags, sorted
+	ManualTags     []string        `json:"manual_tags,omitempty"` // Tags added with the tag command
+	Verified       bool            `json:"verified,omitempty"`    // A shim's metadata declares trust.verified
+	Shadowed       []ShadowedEntry `json:"shadowed,omitempty"`    // Other sources of the tool that lost to this one
+
+	Annotations map[string]string `json:"annotations,omitempty"` // Set with the annotate command
 }
 
 // Registry is the index of discovered ATIP tools.
@@ -33,6 +47,9 @@ type Registry struct {
 	Tools    []*RegistryEntry `json:"tools"`
 	path     string           // File path (not serialized)
 	dataDir  string           // Data directory (not serialized)
+	clock    clock.Clock      // Source of timestamps (not serialized)
+
+	precedence []string // Order in which sources replace each other (not serialized)
 }
 
 // New creates a new empty registry.
@@ -42,6 +59,7 @@ func New(path string, dataDir string) *Registry {
 		Tools:   []*RegistryEntry{},
 		path:    path,
 		dataDir: dataDir,
+		clock:   clock.Real{},
 	}
 }
 
@@ -62,10 +80,25 @@ func Load(path string, dataDir string) (*Registry, error) {
 
 	r.path = path
 	r.dataDir = dataDir
+	r.clock = clock.Real{}
 
 	return &r, nil
 }
 
+// SetClock replaces the clock the registry stamps entries with, e.g. with a
+// clock.Fake in tests. The default is the real clock.
+func (r *Registry) SetClock(c clock.Clock) {
+	r.clock = c
+}
+
+// Now returns the current time according to the registry's clock.
+func (r *Registry) Now() time.Time {
+	if r.clock == nil {
+		return time.Now()
+	}
+	return r.clock.Now()
+}
+
 // Save saves the registry to disk atomically.
 func (r *Registry) Save() error {
 	data, err := json.MarshalIndent(r, "", "  ")
@@ -94,32 +127,67 @@ func (r *Registry) Save() error {
 	return nil
 }
 
-// Add adds or updates a tool in the registry.
+// Add adds or updates a tool in the registry. An update keeps the existing
+// entry's manual tags and annotations unless entry has its own, and entry's
+// tags are merged with them. If the registered entry's source takes precedence over
+// entry's (see SetPrecedence), entry is recorded as shadowed instead and
+// ErrShadowed returned; if entry's does, the registered one is recorded as
+// shadowed by it.
 func (r *Registry) Add(entry *RegistryEntry) error {
 	// Check if tool already exists
 	for i, existing := range r.Tools {
 		if existing.Name == entry.Name {
-			// Update existing entry
-			// Preserve DiscoveredAt from original if not provided
-			if entry.DiscoveredAt.IsZero() {
-				entry.DiscoveredAt = existing.DiscoveredAt
+			if r.outranks(existing, entry) {
+				existing.shadow(entry)
+				return ErrShadowed
 			}
-			r.Tools[i] = entry
+			r.replace(i, entry)
 			return nil
 		}
 	}
+	entry.Tags = mergeTags(entry.Tags, entry.ManualTags)
 
 	// Add new entry
 	if entry.DiscoveredAt.IsZero() {
-		entry.DiscoveredAt = time.Now()
+		entry.DiscoveredAt = r.Now()
 	}
 	if entry.LastVerified.IsZero() {
-		entry.LastVerified = time.Now()
+		entry.LastVerified = r.Now()
 	}
 	r.Tools = append(r.Tools, entry)
 	return nil
 }
 
+// put adds entry like Add, but replaces a registered tool of the same name
+// whatever their sources.
+func (r *Registry) put(entry *RegistryEntry) {
+	for i, existing := range r.Tools {
+		if existing.Name == entry.Name {
+			r.replace(i, entry)
+			return
+		}
+	}
+	r.Add(entry)
+}
+
+// replace replaces the tool at index i with entry.
+func (r *Registry) replace(i int, entry *RegistryEntry) {
+	existing := r.Tools[i]
+	entry.inheritShadowed(existing)
+	// Preserve DiscoveredAt from original if not provided
+	if entry.DiscoveredAt.IsZero() {
+		entry.DiscoveredAt = existing.DiscoveredAt
+	}
+	if entry.ManualTags == nil {
+		entry.ManualTags = existing.ManualTags
+	}
+	if entry.Annotations == nil {
+		entry.Annotations = existing.Annotations
+	}
+	entry.Tags = mergeTags(entry.Tags, entry.ManualTags)
+	r.Tools[i] = entry
+}
+
 // Remove removes a tool from the registry by name.
 func (r *Registry) Remove(name string) error {
 	for i, entry := range r.Tools {
@@ -141,19 +209,39 @@ func (r *Registry) Get(name string) (*RegistryEntry, error) {
 	return nil, fmt.Errorf("tool not found: %s", name)
 }
 
-// List returns all tools, optionally filtered by pattern.
-func (r *Registry) List(pattern string, source string) ([]*RegistryEntry, error) {
+// ListFilter selects the tools List returns. The zero value matches every
+// tool.
+type ListFilter struct {
+	Pattern  string // Glob matched against the tool name
+	Source   string // Tool source, or "all"
+	Platform string // Tool platform, or "all"
+	Tag      string // Tag the tool must have
+}
+
+// List returns the tools matching filter, sorted by name. Tools with no
+// recorded platform never match a platform filter.
+func (r *Registry) List(filter ListFilter) ([]*RegistryEntry, error) {
 	var result []*RegistryEntry
 
 	for _, entry := range r.Tools {
 		// Filter by source
-		if source != "" && source != "all" && entry.Source != source {
+		if filter.Source != "" && filter.Source != "all" && entry.Source != filter.Source {
+			continue
+		}
+
+		// Filter by platform
+		if filter.Platform != "" && filter.Platform != "all" && entry.Platform != filter.Platform {
+			continue
+		}
+
+		// Filter by tag
+		if filter.Tag != "" && !entry.HasTag(filter.Tag) {
 			continue
 		}
 
 		// Filter by pattern (simple glob-style matching)
-		if pattern != "" {
-			matched, err := filepath.Match(pattern, entry.Name)
+		if filter.Pattern != "" {
+			matched, err := filepath.Match(filter.Pattern, entry.Name)
 			if err != nil {
 				return nil, err
 			}
@@ -165,31 +253,80 @@ func (r *Registry) List(pattern string, source string) ([]*RegistryEntry, error)
 		result = append(result, entry)
 	}
 
+	SortEntries(result, SortByName)
 	return result, nil
 }
 
+// Keys SortEntries can sort by.
+const (
+	SortByName    = "name"
+	SortByVersion = "version"
+	SortBySource  = "source"
+)
+
+// SortEntries sorts entries in place by key (SortByName, SortByVersion or
+// SortBySource). Versions are ordered by semantic version precedence. Ties
+// are broken by name, then path, so the order doesn't depend on the input.
+func SortEntries(entries []*RegistryEntry, key string) error {
+	var compare func(a, b *RegistryEntry) int
+	switch key {
+	case SortByName:
+		compare = func(a, b *RegistryEntry) int { return 0 }
+	case SortByVersion:
+		compare = func(a, b *RegistryEntry) int { return validator.CompareVersions(a.Version, b.Version) }
+	case SortBySource:
+		compare = func(a, b *RegistryEntry) int { return strings.Compare(a.Source, b.Source) }
+	default:
+		return fmt.Errorf("invalid sort key %q (expected name, version or source)", key)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if c := compare(a, b); c != 0 {
+			return c < 0
+		}
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return a.Path < b.Path
+	})
+	return nil
+}
+
 // Clear removes all entries from the registry.
 func (r *Registry) Clear() error {
 	r.Tools = []*RegistryEntry{}
 	return nil
 }
 
+// ShimLoadResult reports what LoadShims merged into the registry.
+type ShimLoadResult struct {
+	Loaded   int              `json:"loaded"`   // Shims added or updated
+	Shadowed int              `json:"shadowed"` // Shims skipped for a native entry of the same name
+	Invalid  int              `json:"invalid"`  // Unreadable or invalid shim files skipped
+	Entries  []*RegistryEntry `json:"-"`        // The loaded entries, whose Path is the shim file
+}
+
 // LoadShims loads shim metadata files from the shims directory.
 // Shims are JSON files providing ATIP metadata for tools that don't natively support --agent.
-// Invalid shims are silently skipped to avoid breaking the registry.
-func (r *Registry) LoadShims() error {
+// Invalid shims are skipped and counted to avoid breaking the registry. A
+// registered tool of the same name is kept if its source takes precedence
+// (see SetPrecedence), e.g. a natively discovered tool, since its own
+// metadata is authoritative, unless preferShims is set.
+func (r *Registry) LoadShims(preferShims bool) (*ShimLoadResult, error) {
+	result := &ShimLoadResult{}
 	shimsDir := filepath.Join(r.dataDir, "shims")
 	entries, err := os.ReadDir(shimsDir)
 	if err != nil {
 		if os.IsNotExist(err) {
-			return nil // No shims directory is OK
+			return result, nil // No shims directory is OK
 		}
-		return err
+		return nil, err
 	}
 
-	v, err := validator.New()
+	v, err := validator.Default()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	for _, entry := range entries {
@@ -204,27 +341,45 @@ func (r *Registry) LoadShims() error {
 		shimPath := filepath.Join(shimsDir, entry.Name())
 		data, err := os.ReadFile(shimPath)
 		if err != nil {
+			result.Invalid++
 			continue // Skip unreadable shims
 		}
 
 		metadata, err := v.Validate(data)
 		if err != nil {
+			result.Invalid++
 			continue // Skip invalid shims
 		}
 
-		// Add to registry as shim source
-		r.Add(&RegistryEntry{
+		// Add to registry as shim source, with the platform if it declares one
+		platform := ""
+		if metadata.Binary != nil {
+			platform = metadata.Binary.Platform
+		}
+		shim := &RegistryEntry{
 			Name:         metadata.Name,
 			Version:      metadata.Version,
 			Path:         shimPath,
 			Source:       "shim",
-			DiscoveredAt: time.Now(),
-			LastVerified: time.Now(),
+			Platform:     platform,
+			AtipVersion:  metadata.AtipVersion(),
+			DiscoveredAt: r.Now(),
+			LastVerified: r.Now(),
 			MetadataFile: entry.Name(),
-		})
+			Tags:         InferTags(metadata),
+			Verified:     metadata.Trust != nil && metadata.Trust.Verified,
+		}
+		if preferShims {
+			r.put(shim)
+		} else if err := r.Add(shim); errors.Is(err, ErrShadowed) {
+			result.Shadowed++
+			continue
+		}
+		result.Loaded++
+		result.Entries = append(result.Entries, shim)
 	}
 
-	return nil
+	return result, nil
 }
 
 // IsStale returns true if the entry's executable has been modified since last verification.
@@ -246,13 +401,72 @@ func (e *RegistryEntry) IsStale() bool {
 	return info.ModTime().After(e.ModTime)
 }
 
-// CachePath returns the path to the cached metadata file for this tool.
+// Missing returns the native entries whose executable was expected directly
+// in one of dirs but no longer exists. Entries outside dirs are never
+// reported, since their directories weren't scanned.
+func (r *Registry) Missing(dirs []string) []*RegistryEntry {
+	scanned := make(map[string]bool, len(dirs))
+	for _, dir := range dirs {
+		scanned[filepath.Clean(dir)] = true
+	}
+
+	var missing []*RegistryEntry
+	for _, entry := range r.Tools {
+		if entry.Source == "shim" || !scanned[filepath.Dir(entry.Path)] {
+			continue
+		}
+		if _, err := os.Lstat(entry.Path); os.IsNotExist(err) {
+			missing = append(missing, entry)
+		}
+	}
+	return missing
+}
+
+// Present returns the native tools registered in dirs whose executable was
+// not found missing, i.e. those the last scan of dirs found.
+func (r *Registry) Present(dirs []string) []*RegistryEntry {
+	scanned := make(map[string]bool, len(dirs))
+	for _, dir := range dirs {
+		scanned[filepath.Clean(dir)] = true
+	}
+
+	var present []*RegistryEntry
+	for _, entry := range r.Tools {
+		if entry.Source != "shim" && !entry.Missing && scanned[filepath.Dir(entry.Path)] {
+			present = append(present, entry)
+		}
+	}
+	return present
+}
+
+// NeedsRefresh reports whether the entry is due to be re-probed. With a
+// non-zero since, only entries last verified longer ago than since are due;
+// with staleOnly, only entries whose executable changed (see IsStale) are.
+// Both filters apply when set.
+func (e *RegistryEntry) NeedsRefresh(since time.Duration, staleOnly bool) bool {
+	return e.NeedsRefreshAt(time.Now(), since, staleOnly)
+}
+
+// NeedsRefreshAt is like NeedsRefresh, measuring since from now rather than
+// the current time (e.g. Registry.Now).
+func (e *RegistryEntry) NeedsRefreshAt(now time.Time, since time.Duration, staleOnly bool) bool {
+	if since > 0 && now.Sub(e.LastVerified) <= since {
+		return false
+	}
+	if staleOnly && !e.IsStale() {
+		return false
+	}
+	return true
+}
+
+// CachePath returns the path to the cached metadata file for this tool
+// within cacheDir (normally the agent-tools cache directory).
 // If MetadataFile is set, uses that; otherwise constructs path from tool name.
-func (e *RegistryEntry) CachePath(dataDir string) string {
+func (e *RegistryEntry) CachePath(cacheDir string) string {
 	if e.MetadataFile != "" {
-		return filepath.Join(dataDir, "tools", e.MetadataFile)
+		return filepath.Join(cacheDir, "tools", e.MetadataFile)
 	}
-	return filepath.Join(dataDir, "tools", e.Name+".json")
+	return filepath.Join(cacheDir, "tools", e.Name+".json")
 }
 
 // Matches returns true if the entry matches the pattern
@@ -270,3 +484,104 @@ func (e *RegistryEntry) Matches(pattern string) bool {
 	// Exact match
 	return e.Name == pattern
 }
+
+// PruneResult reports what PruneCache removed from the metadata cache.
+type PruneResult struct {
+	Removed []string `json:"removed"` // Metadata of tools no longer in the registry
+	// RemovedRegistered is metadata of tools still in the registry, evicted
+	// because the cache was over budget even without the other files
+	RemovedRegistered []string `json:"removed_registered"`
+	BytesReclaimed    int64    `json:"bytes_reclaimed"`
+	BytesRemaining    int64    `json:"bytes_remaining"`
+}
+
+// PruneCache trims the cached metadata in cacheDir/tools. Files for tools no
+// longer in the registry are removed once older than maxAge. Then, while the
+// cache is over maxBytes, the remaining such orphaned files are evicted,
+// least recently modified first, and only once none are left the metadata
+// of registered tools, likewise; those are reported in RemovedRegistered.
+// A zero maxAge or maxBytes disables that rule.
+func (r *Registry) PruneCache(cacheDir string, maxAge time.Duration, maxBytes int64) (*PruneResult, error) {
+	result := &PruneResult{Removed: []string{}, RemovedRegistered: []string{}}
+
+	toolsDir := filepath.Join(cacheDir, "tools")
+	dirEntries, err := os.ReadDir(toolsDir)
+	if os.IsNotExist(err) {
+		return result, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cache: %w", err)
+	}
+
+	known := make(map[string]bool, len(r.Tools))
+	for _, entry := range r.Tools {
+		known[filepath.Base(entry.CachePath(cacheDir))] = true
+	}
+
+	type cacheFile struct {
+		name       string
+		size       int64
+		modTime    time.Time
+		registered bool
+	}
+
+	var files []cacheFile
+	var total int64
+	now := r.Now()
+
+	remove := func(f cacheFile) error {
+		if err := os.Remove(filepath.Join(toolsDir, f.name)); err != nil {
+			return fmt.Errorf("failed to remove cached metadata: %w", err)
+		}
+		if f.registered {
+			result.RemovedRegistered = append(result.RemovedRegistered, f.name)
+		} else {
+			result.Removed = append(result.Removed, f.name)
+		}
+		result.BytesReclaimed += f.size
+		return nil
+	}
+
+	for _, de := range dirEntries {
+		if de.IsDir() || filepath.Ext(de.Name()) != ".json" {
+			continue
+		}
+		info, err := de.Info()
+		if err != nil {
+			continue // Removed concurrently
+		}
+		f := cacheFile{name: de.Name(), size: info.Size(), modTime: info.ModTime(), registered: known[de.Name()]}
+
+		if maxAge > 0 && !f.registered && now.Sub(f.modTime) > maxAge {
+			if err := remove(f); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		files = append(files, f)
+		total += f.size
+	}
+
+	if maxBytes > 0 && total > maxBytes {
+		// Orphans first, then registered tools, each oldest first
+		sort.Slice(files, func(i, j int) bool {
+			if files[i].registered != files[j].registered {
+				return !files[i].registered
+			}
+			return files[i].modTime.Before(files[j].modTime)
+		})
+		for _, f := range files {
+			if total <= maxBytes {
+				break
+			}
+			if err := remove(f); err != nil {
+				return nil, err
+			}
+			total -= f.size
+		}
+	}
+
+	result.BytesRemaining = total
+	return result, nil
+}
@@ -1,11 +1,13 @@
 package registry
 
 import (
+	"math/rand"
 	"os"
 	"path/filepath"
 	"testing"
 	"time"
 
+	"github.com/atip/atip-discover/internal/clock"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -222,7 +224,7 @@ func TestList_All(t *testing.T) {
 		{Name: "curl", Version: "8.4.0", Source: "shim"},
 	}
 
-	tools, err := r.List("", "all")
+	tools, err := r.List(ListFilter{})
 	require.NoError(t, err)
 	assert.Len(t, tools, 3)
 }
@@ -238,11 +240,11 @@ func TestList_FilterBySource(t *testing.T) {
 		{Name: "curl", Version: "8.4.0", Source: "shim"},
 	}
 
-	tools, err := r.List("", "native")
+	tools, err := r.List(ListFilter{Source: "native"})
 	require.NoError(t, err)
 	assert.Len(t, tools, 2)
 
-	tools, err = r.List("", "shim")
+	tools, err = r.List(ListFilter{Source: "shim"})
 	require.NoError(t, err)
 	assert.Len(t, tools, 1)
 	assert.Equal(t, "curl", tools[0].Name)
@@ -260,13 +262,94 @@ func TestList_FilterByPattern(t *testing.T) {
 	}
 
 	// Pattern matching "k*"
-	tools, err := r.List("k*", "all")
+	tools, err := r.List(ListFilter{Pattern: "k*"})
 	require.NoError(t, err)
 	assert.Len(t, tools, 2)
 	assert.Contains(t, []string{tools[0].Name, tools[1].Name}, "kubectl")
 	assert.Contains(t, []string{tools[0].Name, tools[1].Name}, "kustomize")
 }
 
+func TestList_FilterByPlatform(t *testing.T) {
+	tmpDir := t.TempDir()
+	regPath := filepath.Join(tmpDir, "registry.json")
+	r := New(regPath, tmpDir)
+
+	r.Tools = []*RegistryEntry{
+		{Name: "gh", Version: "2.45.0", Source: "native", Platform: "darwin-arm64"},
+		{Name: "kubectl", Version: "1.28.0", Source: "native", Platform: "darwin-amd64"},
+		{Name: "curl", Version: "8.4.0", Source: "shim"},
+	}
+
+	tools, err := r.List(ListFilter{Platform: "darwin-amd64"})
+	require.NoError(t, err)
+	require.Len(t, tools, 1)
+	assert.Equal(t, "kubectl", tools[0].Name)
+
+	tools, err = r.List(ListFilter{Platform: "all"})
+	require.NoError(t, err)
+	assert.Len(t, tools, 3)
+}
+
+func TestList_Sorted(t *testing.T) {
+	r := New(filepath.Join(t.TempDir(), "registry.json"), t.TempDir())
+	names := []string{"kubectl", "curl", "gh", "jq", "aws", "terraform"}
+	for _, name := range names {
+		r.Tools = append(r.Tools, &RegistryEntry{Name: name, Source: "native"})
+	}
+
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 10; i++ {
+		rng.Shuffle(len(r.Tools), func(i, j int) { r.Tools[i], r.Tools[j] = r.Tools[j], r.Tools[i] })
+
+		tools, err := r.List(ListFilter{})
+		require.NoError(t, err)
+		var got []string
+		for _, tool := range tools {
+			got = append(got, tool.Name)
+		}
+		assert.Equal(t, []string{"aws", "curl", "gh", "jq", "kubectl", "terraform"}, got)
+	}
+}
+
+func TestSortEntries(t *testing.T) {
+	entries := []*RegistryEntry{
+		{Name: "gh", Version: "2.45.0", Source: "native"},
+		{Name: "kubectl", Version: "1.28.0", Source: "native"},
+		{Name: "curl", Version: "8.4.0", Source: "shim"},
+		{Name: "jq", Version: "1.10.0", Source: "shim"},
+		{Name: "tar", Version: "unknown", Source: "native"},
+		{Name: "aws", Version: "2.45.0", Source: "native"},
+	}
+
+	tests := []struct {
+		key  string
+		want []string
+	}{
+		{key: SortByName, want: []string{"aws", "curl", "gh", "jq", "kubectl", "tar"}},
+		{key: SortByVersion, want: []string{"jq", "kubectl", "aws", "gh", "curl", "tar"}},
+		{key: SortBySource, want: []string{"aws", "gh", "kubectl", "tar", "curl", "jq"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			rng := rand.New(rand.NewSource(1))
+			for i := 0; i < 10; i++ {
+				shuffled := append([]*RegistryEntry(nil), entries...)
+				rng.Shuffle(len(shuffled), func(i, j int) { shuffled[i], shuffled[j] = shuffled[j], shuffled[i] })
+
+				require.NoError(t, SortEntries(shuffled, tt.key))
+				var got []string
+				for _, entry := range shuffled {
+					got = append(got, entry.Name)
+				}
+				assert.Equal(t, tt.want, got)
+			}
+		})
+	}
+
+	assert.Error(t, SortEntries(entries, "size"))
+}
+
 func TestClear(t *testing.T) {
 	tmpDir := t.TempDir()
 	regPath := filepath.Join(tmpDir, "registry.json")
@@ -309,8 +392,9 @@ func TestLoadShims(t *testing.T) {
 	require.NoError(t, err)
 
 	r := New(regPath, tmpDir)
-	err = r.LoadShims()
+	result, err := r.LoadShims(false)
 	require.NoError(t, err)
+	assert.Equal(t, 1, result.Loaded)
 
 	assert.Len(t, r.Tools, 1)
 	assert.Equal(t, "curl", r.Tools[0].Name)
@@ -330,10 +414,54 @@ func TestLoadShims_InvalidFile(t *testing.T) {
 	require.NoError(t, err)
 
 	r := New(regPath, tmpDir)
-	err = r.LoadShims()
+	result, err := r.LoadShims(false)
 	// Should not error, but should skip invalid file
 	require.NoError(t, err)
 	assert.Empty(t, r.Tools)
+	assert.Equal(t, 1, result.Invalid)
+}
+
+func TestLoadShims_NativeEntry(t *testing.T) {
+	tmpDir := t.TempDir()
+	shimsDir := filepath.Join(tmpDir, "shims")
+	require.NoError(t, os.MkdirAll(shimsDir, 0755))
+	for _, name := range []string{"gh", "jq"} {
+		shim := `{"atip": {"version": "0.6"}, "name": "` + name + `", "version": "1.0.0", "description": "shim"}`
+		require.NoError(t, os.WriteFile(filepath.Join(shimsDir, name+".json"), []byte(shim), 0644))
+	}
+
+	newRegistry := func() *Registry {
+		r := New(filepath.Join(tmpDir, "registry.json"), tmpDir)
+		require.NoError(t, r.Add(&RegistryEntry{Name: "gh", Version: "2.45.0", Path: "/usr/bin/gh", Source: "native"}))
+		require.NoError(t, r.Add(&RegistryEntry{Name: "jq", Version: "1.7.1", Path: "/usr/bin/jq", Source: "inferred"}))
+		return r
+	}
+
+	// The native entry is kept, the inferred one replaced
+	r := newRegistry()
+	result, err := r.LoadShims(false)
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.Loaded)
+	assert.Equal(t, 1, result.Shadowed)
+	require.Len(t, result.Entries, 1)
+	assert.Equal(t, "jq", result.Entries[0].Name)
+
+	gh, err := r.Get("gh")
+	require.NoError(t, err)
+	assert.Equal(t, "native", gh.Source)
+	jq, err := r.Get("jq")
+	require.NoError(t, err)
+	assert.Equal(t, "shim", jq.Source)
+
+	// preferShims replaces both
+	r = newRegistry()
+	result, err = r.LoadShims(true)
+	require.NoError(t, err)
+	assert.Equal(t, 2, result.Loaded)
+	assert.Equal(t, 0, result.Shadowed)
+	gh, err = r.Get("gh")
+	require.NoError(t, err)
+	assert.Equal(t, "shim", gh.Source)
 }
 
 func TestIsStale(t *testing.T) {
@@ -364,6 +492,134 @@ func TestIsStale(t *testing.T) {
 	assert.True(t, entry.IsStale())
 }
 
+func TestMissing(t *testing.T) {
+	scannedDir := t.TempDir()
+	otherDir := t.TempDir()
+
+	present := filepath.Join(scannedDir, "present")
+	require.NoError(t, os.WriteFile(present, []byte("#!/bin/sh"), 0755))
+
+	r := New(filepath.Join(t.TempDir(), "registry.json"), t.TempDir())
+	r.Add(&RegistryEntry{Name: "present", Path: present, Source: "native"})
+	r.Add(&RegistryEntry{Name: "deleted", Path: filepath.Join(scannedDir, "deleted"), Source: "native"})
+	r.Add(&RegistryEntry{Name: "elsewhere", Path: filepath.Join(otherDir, "elsewhere"), Source: "native"})
+	r.Add(&RegistryEntry{Name: "shim", Path: filepath.Join(scannedDir, "shim"), Source: "shim"})
+
+	missing := r.Missing([]string{scannedDir + "/"})
+	require.Len(t, missing, 1)
+	assert.Equal(t, "deleted", missing[0].Name)
+}
+
+func TestPresent(t *testing.T) {
+	scannedDir := t.TempDir()
+	otherDir := t.TempDir()
+
+	r := New(filepath.Join(t.TempDir(), "registry.json"), t.TempDir())
+	r.Add(&RegistryEntry{Name: "present", Path: filepath.Join(scannedDir, "present"), Source: "native"})
+	r.Add(&RegistryEntry{Name: "deleted", Path: filepath.Join(scannedDir, "deleted"), Source: "native", Missing: true})
+	r.Add(&RegistryEntry{Name: "elsewhere", Path: filepath.Join(otherDir, "elsewhere"), Source: "native"})
+	r.Add(&RegistryEntry{Name: "shim", Path: filepath.Join(scannedDir, "shim"), Source: "shim"})
+
+	present := r.Present([]string{scannedDir + "/"})
+	require.Len(t, present, 1)
+	assert.Equal(t, "present", present[0].Name)
+	assert.Empty(t, r.Present(nil))
+}
+
+func TestNeedsRefresh(t *testing.T) {
+	exePath := filepath.Join(t.TempDir(), "test-tool")
+	require.NoError(t, os.WriteFile(exePath, []byte("#!/bin/sh\necho test"), 0755))
+	stat, err := os.Stat(exePath)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name         string
+		lastVerified time.Duration
+		modTime      time.Time
+		since        time.Duration
+		staleOnly    bool
+		expected     bool
+	}{
+		{"no filters", time.Minute, stat.ModTime(), 0, false, true},
+		{"verified recently", time.Hour, stat.ModTime(), 24 * time.Hour, false, false},
+		{"verified long ago", 48 * time.Hour, stat.ModTime(), 24 * time.Hour, false, true},
+		{"unchanged binary", time.Minute, stat.ModTime(), 0, true, false},
+		{"changed binary", time.Minute, stat.ModTime().Add(-time.Hour), 0, true, true},
+		{"changed but verified recently", time.Hour, stat.ModTime().Add(-time.Hour), 24 * time.Hour, true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entry := &RegistryEntry{
+				Name:         "test-tool",
+				Path:         exePath,
+				LastVerified: time.Now().Add(-tt.lastVerified),
+				ModTime:      tt.modTime,
+			}
+			assert.Equal(t, tt.expected, entry.NeedsRefresh(tt.since, tt.staleOnly))
+		})
+	}
+}
+
+func TestRegistry_Clock(t *testing.T) {
+	start := time.Date(2026, 1, 5, 10, 30, 0, 0, time.UTC)
+	fake := clock.NewFake(start)
+
+	r := New(filepath.Join(t.TempDir(), "registry.json"), t.TempDir())
+	r.SetClock(fake)
+	assert.Equal(t, start, r.Now())
+
+	require.NoError(t, r.Add(&RegistryEntry{Name: "gh", Source: "native"}))
+	entry, err := r.Get("gh")
+	require.NoError(t, err)
+	assert.Equal(t, start, entry.DiscoveredAt)
+	assert.Equal(t, start, entry.LastVerified)
+
+	// Re-adding keeps the original discovery time
+	fake.Advance(time.Hour)
+	require.NoError(t, r.Add(&RegistryEntry{Name: "gh", Source: "native", LastVerified: r.Now()}))
+	entry, err = r.Get("gh")
+	require.NoError(t, err)
+	assert.Equal(t, start, entry.DiscoveredAt)
+	assert.Equal(t, start.Add(time.Hour), entry.LastVerified)
+}
+
+// TestNeedsRefreshAt_FakeClock walks through refresh --since with a fake
+// clock: entries become due as the clock passes since, without sleeping.
+func TestNeedsRefreshAt_FakeClock(t *testing.T) {
+	fake := clock.NewFake(time.Date(2026, 1, 5, 10, 30, 0, 0, time.UTC))
+	r := New(filepath.Join(t.TempDir(), "registry.json"), t.TempDir())
+	r.SetClock(fake)
+
+	require.NoError(t, r.Add(&RegistryEntry{Name: "gh", Source: "native"}))
+	fake.Advance(2 * time.Hour)
+	require.NoError(t, r.Add(&RegistryEntry{Name: "jq", Source: "native"}))
+
+	due := func(since time.Duration) []string {
+		var names []string
+		for _, entry := range r.Tools {
+			if entry.NeedsRefreshAt(r.Now(), since, false) {
+				names = append(names, entry.Name)
+			}
+		}
+		return names
+	}
+
+	assert.Equal(t, []string{"gh"}, due(time.Hour))
+	assert.Empty(t, due(24*time.Hour))
+
+	// Exactly since ago is not yet due
+	fake.Advance(22 * time.Hour)
+	assert.Empty(t, due(24*time.Hour))
+
+	fake.Advance(time.Second)
+	assert.Equal(t, []string{"gh"}, due(24*time.Hour))
+
+	fake.Advance(2 * time.Hour)
+	assert.Equal(t, []string{"gh", "jq"}, due(24*time.Hour))
+	assert.Equal(t, []string{"gh", "jq"}, due(0))
+}
+
 func TestCachePath(t *testing.T) {
 	entry := &RegistryEntry{
 		Name: "gh",
@@ -389,3 +645,97 @@ func TestSave_CreateDirectory(t *testing.T) {
 	_, err = os.Stat(filepath.Dir(regPath))
 	assert.NoError(t, err)
 }
+
+// writeCacheFile seeds a cached metadata file of size bytes, last modified age ago.
+func writeCacheFile(t *testing.T, cacheDir, name string, size int, age time.Duration) {
+	t.Helper()
+	path := filepath.Join(cacheDir, "tools", name)
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	require.NoError(t, os.WriteFile(path, make([]byte, size), 0644))
+	modTime := time.Now().Add(-age)
+	require.NoError(t, os.Chtimes(path, modTime, modTime))
+}
+
+func TestPruneCache_Expired(t *testing.T) {
+	cacheDir := t.TempDir()
+	r := New(filepath.Join(t.TempDir(), "registry.json"), t.TempDir())
+	r.Add(&RegistryEntry{Name: "gh"})
+
+	writeCacheFile(t, cacheDir, "gh.json", 100, 48*time.Hour)  // known, kept
+	writeCacheFile(t, cacheDir, "old.json", 200, 48*time.Hour) // unknown and expired
+	writeCacheFile(t, cacheDir, "recent.json", 300, time.Hour) // unknown but fresh
+
+	result, err := r.PruneCache(cacheDir, 24*time.Hour, 0)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"old.json"}, result.Removed)
+	assert.Equal(t, int64(200), result.BytesReclaimed)
+	assert.Equal(t, int64(400), result.BytesRemaining)
+	assert.NoFileExists(t, filepath.Join(cacheDir, "tools", "old.json"))
+	assert.FileExists(t, filepath.Join(cacheDir, "tools", "gh.json"))
+	assert.FileExists(t, filepath.Join(cacheDir, "tools", "recent.json"))
+}
+
+func TestPruneCache_OverBudget(t *testing.T) {
+	cacheDir := t.TempDir()
+	r := New(filepath.Join(t.TempDir(), "registry.json"), t.TempDir())
+
+	writeCacheFile(t, cacheDir, "oldest.json", 400, 3*time.Hour)
+	writeCacheFile(t, cacheDir, "older.json", 400, 2*time.Hour)
+	writeCacheFile(t, cacheDir, "newest.json", 400, time.Hour)
+
+	result, err := r.PruneCache(cacheDir, 0, 500)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"oldest.json", "older.json"}, result.Removed)
+	assert.Equal(t, int64(800), result.BytesReclaimed)
+	assert.LessOrEqual(t, result.BytesRemaining, int64(500))
+	assert.FileExists(t, filepath.Join(cacheDir, "tools", "newest.json"))
+}
+
+func TestPruneCache_OverBudgetKeepsRegistered(t *testing.T) {
+	cacheDir := t.TempDir()
+	r := New(filepath.Join(t.TempDir(), "registry.json"), t.TempDir())
+	r.Add(&RegistryEntry{Name: "gh"})
+	r.Add(&RegistryEntry{Name: "kubectl"})
+
+	writeCacheFile(t, cacheDir, "gh.json", 400, 5*time.Hour) // registered, oldest
+	writeCacheFile(t, cacheDir, "kubectl.json", 400, 4*time.Hour)
+	writeCacheFile(t, cacheDir, "orphan.json", 400, time.Hour) // unknown, newest
+
+	// Orphaned metadata goes first, however recent
+	result, err := r.PruneCache(cacheDir, 0, 800)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"orphan.json"}, result.Removed)
+	assert.Empty(t, result.RemovedRegistered)
+	assert.Equal(t, int64(400), result.BytesReclaimed)
+	assert.Equal(t, int64(800), result.BytesRemaining)
+	assert.FileExists(t, filepath.Join(cacheDir, "tools", "gh.json"))
+
+	// Registered tools' metadata only as a last resort, reported apart
+	writeCacheFile(t, cacheDir, "orphan.json", 400, time.Hour)
+	result, err = r.PruneCache(cacheDir, 0, 500)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"orphan.json"}, result.Removed)
+	assert.Equal(t, []string{"gh.json"}, result.RemovedRegistered)
+	assert.Equal(t, int64(800), result.BytesReclaimed)
+	assert.Equal(t, int64(400), result.BytesRemaining)
+	assert.FileExists(t, filepath.Join(cacheDir, "tools", "kubectl.json"))
+}
+
+func TestPruneCache_WithinBudget(t *testing.T) {
+	cacheDir := t.TempDir()
+	r := New(filepath.Join(t.TempDir(), "registry.json"), t.TempDir())
+
+	writeCacheFile(t, cacheDir, "gh.json", 100, time.Hour)
+
+	result, err := r.PruneCache(cacheDir, 24*time.Hour, 1000)
+	require.NoError(t, err)
+	assert.Empty(t, result.Removed)
+	assert.Equal(t, int64(100), result.BytesRemaining)
+
+	// Missing cache directory is not an error
+	result, err = r.PruneCache(filepath.Join(cacheDir, "missing"), 24*time.Hour, 1000)
+	require.NoError(t, err)
+	assert.Empty(t, result.Removed)
+}
@@ -0,0 +1,166 @@
+package registry
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/atip/atip-discover/internal/validator"
+)
+
+// tagRegex matches a valid tag after lowercasing, e.g. "kubernetes" or
+// "ci-cd".
+var tagRegex = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]*$`)
+
+// codeHosts are homepage hosts that say where a tool's code lives rather
+// than what it does, so they aren't inferred as tags.
+var codeHosts = map[string]bool{
+	"github.com":    true,
+	"gitlab.com":    true,
+	"bitbucket.org": true,
+	"codeberg.org":  true,
+	"sr.ht":         true,
+}
+
+// commandTags maps top-level command names to the tag they suggest. A tag is
+// inferred when at least commandTagMatches of a tool's commands suggest it,
+// since a single "push" or "run" says little.
+var commandTags = map[string]string{
+	"commit":     "vcs",
+	"clone":      "vcs",
+	"push":       "vcs",
+	"pull":       "vcs",
+	"branch":     "vcs",
+	"merge":      "vcs",
+	"rebase":     "vcs",
+	"checkout":   "vcs",
+	"pod":        "kubernetes",
+	"pods":       "kubernetes",
+	"namespace":  "kubernetes",
+	"deployment": "kubernetes",
+	"rollout":    "kubernetes",
+	"cluster":    "kubernetes",
+	"container":  "containers",
+	"image":      "containers",
+	"images":     "containers",
+	"volume":     "containers",
+	"compose":    "containers",
+	"plan":       "infrastructure",
+	"apply":      "infrastructure",
+	"destroy":    "infrastructure",
+	"provision":  "infrastructure",
+	"install":    "packages",
+	"uninstall":  "packages",
+	"upgrade":    "packages",
+}
+
+const commandTagMatches = 2
+
+// InferTags suggests tags for a tool from its metadata: the name of its
+// homepage's domain (e.g. "kubernetes" for https://kubernetes.io, "github"
+// for https://cli.github.com) and categories its command names point to
+// (e.g. "vcs" for commit and push). The result is sorted.
+func InferTags(metadata *validator.AtipMetadata) []string {
+	if metadata == nil {
+		return nil
+	}
+
+	var tags []string
+	if tag := homepageTag(metadata.Homepage); tag != "" {
+		tags = append(tags, tag)
+	}
+
+	matches := make(map[string]int)
+	for name := range metadata.Commands {
+		if tag, ok := commandTags[strings.ToLower(name)]; ok {
+			matches[tag]++
+		}
+	}
+	for tag, n := range matches {
+		if n >= commandTagMatches {
+			tags = append(tags, tag)
+		}
+	}
+
+	return mergeTags(tags)
+}
+
+// homepageTag returns the registered name of the homepage's domain, without
+// its top-level domain, or "" for code hosts and unparsable URLs.
+func homepageTag(homepage string) string {
+	u, err := url.Parse(homepage)
+	if err != nil || u.Hostname() == "" {
+		return ""
+	}
+	host := strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+	if codeHosts[host] {
+		return ""
+	}
+
+	labels := strings.Split(host, ".")
+	if len(labels) < 2 {
+		return ""
+	}
+	tag := labels[len(labels)-2]
+	if !tagRegex.MatchString(tag) {
+		return ""
+	}
+	return tag
+}
+
+// NormalizeTag lowercases and trims a tag, and checks that it is made of
+// letters, digits, ".", "_" and "-", starting with a letter or digit.
+func NormalizeTag(tag string) (string, error) {
+	normalized := strings.ToLower(strings.TrimSpace(tag))
+	if !tagRegex.MatchString(normalized) {
+		return "", fmt.Errorf("invalid tag %q: use letters, digits, '.', '_' and '-'", tag)
+	}
+	return normalized, nil
+}
+
+// AddTags tags the entry manually. Manual tags are kept when the tool is
+// probed again, while inferred tags are recomputed. If any tag is invalid,
+// none are added.
+func (e *RegistryEntry) AddTags(tags ...string) error {
+	normalized := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		n, err := NormalizeTag(tag)
+		if err != nil {
+			return err
+		}
+		normalized = append(normalized, n)
+	}
+	e.ManualTags = mergeTags(e.ManualTags, normalized)
+	e.Tags = mergeTags(e.Tags, e.ManualTags)
+	return nil
+}
+
+// HasTag reports whether the entry is tagged with tag, inferred or manual.
+func (e *RegistryEntry) HasTag(tag string) bool {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	for _, t := range e.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// mergeTags returns the union of the tag lists, sorted and without
+// duplicates.
+func mergeTags(lists ...[]string) []string {
+	seen := make(map[string]bool)
+	var merged []string
+	for _, list := range lists {
+		for _, tag := range list {
+			if !seen[tag] {
+				seen[tag] = true
+				merged = append(merged, tag)
+			}
+		}
+	}
+	sort.Strings(merged)
+	return merged
+}
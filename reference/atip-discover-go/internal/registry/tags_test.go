@@ -0,0 +1,118 @@
+package registry
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/atip/atip-discover/internal/validator"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInferTags(t *testing.T) {
+	command := map[string]interface{}{"description": "A command"}
+
+	tests := []struct {
+		name     string
+		metadata *validator.AtipMetadata
+		want     []string
+	}{
+		{
+			name:     "homepage domain",
+			metadata: &validator.AtipMetadata{Homepage: "https://www.Kubernetes.io/docs/"},
+			want:     []string{"kubernetes"},
+		},
+		{
+			name:     "homepage subdomain",
+			metadata: &validator.AtipMetadata{Homepage: "https://cli.github.com"},
+			want:     []string{"github"},
+		},
+		{
+			name:     "code host homepage",
+			metadata: &validator.AtipMetadata{Homepage: "https://github.com/jqlang/jq"},
+		},
+		{
+			name:     "unparsable homepage",
+			metadata: &validator.AtipMetadata{Homepage: "not a url"},
+		},
+		{
+			name: "commands",
+			metadata: &validator.AtipMetadata{
+				Homepage: "https://git-scm.com",
+				Commands: map[string]interface{}{"commit": command, "Push": command, "log": command},
+			},
+			want: []string{"git-scm", "vcs"},
+		},
+		{
+			name: "single matching command",
+			metadata: &validator.AtipMetadata{
+				Commands: map[string]interface{}{"apply": command, "get": command},
+			},
+		},
+		{
+			name: "several categories",
+			metadata: &validator.AtipMetadata{
+				Commands: map[string]interface{}{"pods": command, "rollout": command, "image": command, "volume": command},
+			},
+			want: []string{"containers", "kubernetes"},
+		},
+		{
+			name: "nil metadata",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, InferTags(tt.metadata))
+		})
+	}
+}
+
+func TestNormalizeTag(t *testing.T) {
+	tag, err := NormalizeTag(" CI-CD ")
+	require.NoError(t, err)
+	assert.Equal(t, "ci-cd", tag)
+
+	for _, invalid := range []string{"", "-vcs", "two words", "a,b", "k8s/tools"} {
+		_, err := NormalizeTag(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestAdd_KeepsManualTags(t *testing.T) {
+	r := New(filepath.Join(t.TempDir(), "registry.json"), t.TempDir())
+	require.NoError(t, r.Add(&RegistryEntry{Name: "git", Source: "native", Tags: []string{"git-scm", "vcs"}}))
+
+	entry, err := r.Get("git")
+	require.NoError(t, err)
+	require.NoError(t, entry.AddTags("Favorites", "vcs"))
+	assert.Equal(t, []string{"favorites", "vcs"}, entry.ManualTags)
+	assert.Equal(t, []string{"favorites", "git-scm", "vcs"}, entry.Tags)
+	assert.Error(t, entry.AddTags("ok", "not ok"))
+
+	// A re-probe replaces the entry with freshly inferred tags
+	require.NoError(t, r.Add(&RegistryEntry{Name: "git", Source: "native", Tags: []string{"vcs"}}))
+	entry, err = r.Get("git")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"favorites", "vcs"}, entry.Tags)
+	assert.Equal(t, []string{"favorites", "vcs"}, entry.ManualTags)
+}
+
+func TestList_FilterByTag(t *testing.T) {
+	r := New(filepath.Join(t.TempDir(), "registry.json"), t.TempDir())
+	r.Tools = []*RegistryEntry{
+		{Name: "git", Source: "native", Tags: []string{"git-scm", "vcs"}},
+		{Name: "gh", Source: "native", Tags: []string{"vcs"}, ManualTags: []string{"vcs"}},
+		{Name: "kubectl", Source: "native", Tags: []string{"kubernetes"}},
+	}
+
+	tools, err := r.List(ListFilter{Tag: "VCS"})
+	require.NoError(t, err)
+	require.Len(t, tools, 2)
+	assert.Equal(t, "gh", tools[0].Name)
+	assert.Equal(t, "git", tools[1].Name)
+
+	tools, err = r.List(ListFilter{Tag: "containers"})
+	require.NoError(t, err)
+	assert.Empty(t, tools)
+}
@@ -0,0 +1,481 @@
+// Package remote reads the catalogs published by content-addressable ATIP
+// registries and compares them with the local registry of discovered tools.
+package remote
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/atip/atip-discover/internal/httpcache"
+	"github.com/atip/atip-discover/internal/registry"
+	"github.com/atip/atip-discover/internal/validator"
+)
+
+const (
+	// ManifestPath is the well-known path of a registry's manifest.
+	ManifestPath = "/.well-known/atip-registry.json"
+
+	// DefaultCatalogPath is used when the manifest doesn't declare a
+	// catalog endpoint.
+	DefaultCatalogPath = "/shims/index.json"
+
+	// DefaultShimPath is used when the manifest doesn't declare a shims
+	// endpoint. {hash} stands for the hex digest of the shim's hash.
+	DefaultShimPath = "/shims/sha256/{hash}.json"
+)
+
+// ErrNotFound indicates a registry has no shim for the requested tool,
+// version or platform.
+var ErrNotFound = errors.New("not found")
+
+// Catalog is a registry's browsable index of shims.
+type Catalog struct {
+	Version string              `json:"version"`
+	Tools   map[string]ToolInfo `json:"tools"`
+}
+
+// ToolInfo lists the versions and platforms a registry has for a tool.
+type ToolInfo struct {
+	Description string                       `json:"description"`
+	Versions    map[string]map[string]string `json:"versions"` // version -> platform -> hash
+}
+
+// Shim is a tool's metadata fetched from a remote registry.
+type Shim struct {
+	Name     string
+	Version  string
+	Platform string // Empty for a platform-independent shim
+	Hash     string // As listed in the catalog, "sha256:<hex>"
+	Metadata *validator.AtipMetadata
+	Data     []byte // The shim as served
+}
+
+// Client fetches catalogs from remote registries.
+type Client struct {
+	http     *httpcache.Client
+	cacheDir string // Where responses and diffs are cached; empty disables caching
+}
+
+// CachedCatalog is a catalog fetched by FetchCatalogCached, with the ETag
+// it was served with and the last diff computed against it, which
+// SaveCatalog keeps in the client's cache directory.
+type CachedCatalog struct {
+	Catalog     *Catalog    `json:"-"`
+	ETag        string      `json:"etag,omitempty"`
+	Unchanged   bool        `json:"-"`                      // The server answered 304 Not Modified
+	LocalDigest string      `json:"local_digest,omitempty"` // Digest of the local tools Diff was computed for
+	Diff        []DiffEntry `json:"diff,omitempty"`
+}
+
+// NewClient creates a client whose requests time out after timeout.
+func NewClient(timeout time.Duration) *Client {
+	return &Client{http: httpcache.New(&http.Client{Timeout: timeout})}
+}
+
+// SetCacheDir sets the directory the client caches responses in, to
+// revalidate them with their ETag instead of downloading them again (see
+// httpcache), and keeps diffs in for FetchCatalogCached.
+func (c *Client) SetCacheDir(dir string) {
+	c.cacheDir = dir
+	c.http.SetDir(dir)
+}
+
+// FetchCatalog fetches the catalog of the registry at registryURL from the
+// catalog endpoint its manifest declares. A registry without a manifest is
+// assumed to use the standard layout.
+func (c *Client) FetchCatalog(ctx context.Context, registryURL string) (*Catalog, error) {
+	url, err := c.catalogURL(ctx, registryURL)
+	if err != nil {
+		return nil, err
+	}
+
+	var catalog Catalog
+	found, err := c.getJSON(ctx, url, &catalog)
+	if err != nil {
+		return nil, fmt.Errorf("fetch catalog: %w", err)
+	}
+	if !found {
+		return nil, fmt.Errorf("fetch catalog: %s not found", url)
+	}
+	return &catalog, nil
+}
+
+// FetchCatalogCached fetches the catalog like FetchCatalog. With a cache
+// directory, an unchanged catalog costs a 304 instead of a download, and is
+// returned with Unchanged set along with the diff saved for it by
+// SaveCatalog, if any.
+func (c *Client) FetchCatalogCached(ctx context.Context, registryURL string) (*CachedCatalog, error) {
+	url, err := c.catalogURL(ctx, registryURL)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.do(ctx, url)
+	if err != nil {
+		return nil, fmt.Errorf("fetch catalog: %w", err)
+	}
+	if resp == nil {
+		return nil, fmt.Errorf("fetch catalog: %s not found", url)
+	}
+	var catalog Catalog
+	if err := json.Unmarshal(resp.Body, &catalog); err != nil {
+		return nil, fmt.Errorf("fetch catalog: %s: invalid JSON: %w", url, err)
+	}
+
+	// The saved diff is only good for the catalog it was computed against
+	cached, err := c.loadCatalog(registryURL)
+	if err != nil || !resp.NotModified || cached.ETag != resp.ETag {
+		cached = &CachedCatalog{}
+	}
+	cached.Catalog = &catalog
+	cached.ETag = resp.ETag
+	cached.Unchanged = resp.NotModified
+	return cached, nil
+}
+
+// SaveCatalog stores the diff computed against cached in the cache
+// directory for the next FetchCatalogCached of registryURL. It does nothing
+// without a cache directory or if the catalog has no ETag to revalidate it
+// with.
+func (c *Client) SaveCatalog(registryURL string, cached *CachedCatalog) error {
+	if c.cacheDir == "" || cached.ETag == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(cached)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(c.cacheDir, 0755); err != nil {
+		return err
+	}
+
+	// Write to a temporary file so a failed save leaves the old copy intact
+	path := c.catalogCachePath(registryURL)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// loadCatalog reads the saved diff for registryURL. A missing entry, or no
+// cache directory, yields an empty CachedCatalog.
+func (c *Client) loadCatalog(registryURL string) (*CachedCatalog, error) {
+	cached := &CachedCatalog{}
+	if c.cacheDir == "" {
+		return cached, nil
+	}
+
+	data, err := os.ReadFile(c.catalogCachePath(registryURL))
+	if errors.Is(err, fs.ErrNotExist) {
+		return cached, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, cached); err != nil {
+		return nil, err
+	}
+	return cached, nil
+}
+
+// catalogCachePath returns the file the diff against registryURL's catalog
+// is saved in.
+func (c *Client) catalogCachePath(registryURL string) string {
+	sum := sha256.Sum256([]byte(strings.TrimSuffix(registryURL, "/")))
+	return filepath.Join(c.cacheDir, "diff-"+hex.EncodeToString(sum[:8])+".json")
+}
+
+// catalogURL returns the URL of the catalog endpoint the manifest of the
+// registry at registryURL declares, or the standard one.
+func (c *Client) catalogURL(ctx context.Context, registryURL string) (string, error) {
+	endpoints, err := c.endpoints(ctx, registryURL)
+	if err != nil {
+		return "", err
+	}
+	return endpoints.url(registryURL, "catalog", DefaultCatalogPath), nil
+}
+
+// endpoints maps endpoint names, like "catalog" or "shims", to the paths a
+// registry's manifest declares for them.
+type endpoints map[string]string
+
+// url returns the URL of endpoint name of the registry at registryURL, or
+// of defaultPath if the manifest doesn't declare it.
+func (e endpoints) url(registryURL, name, defaultPath string) string {
+	path := defaultPath
+	if e[name] != "" {
+		path = e[name]
+	}
+	return strings.TrimSuffix(registryURL, "/") + path
+}
+
+// endpoints fetches the endpoints declared by the manifest of the registry
+// at registryURL. A registry without a manifest declares none.
+func (c *Client) endpoints(ctx context.Context, registryURL string) (endpoints, error) {
+	var manifest struct {
+		Endpoints endpoints `json:"endpoints"`
+	}
+	if _, err := c.getJSON(ctx, strings.TrimSuffix(registryURL, "/")+ManifestPath, &manifest); err != nil {
+		return nil, fmt.Errorf("fetch manifest: %w", err)
+	}
+	return manifest.Endpoints, nil
+}
+
+// FetchShim resolves a tool in the catalog of the registry at registryURL,
+// as Catalog.Resolve does, and fetches just that tool's shim from the shims
+// endpoint. It returns an error wrapping ErrNotFound if the catalog or the
+// shims endpoint doesn't have the shim.
+func (c *Client) FetchShim(ctx context.Context, registryURL, name, version, platform string) (*Shim, error) {
+	endpoints, err := c.endpoints(ctx, registryURL)
+	if err != nil {
+		return nil, err
+	}
+
+	catalogURL := endpoints.url(registryURL, "catalog", DefaultCatalogPath)
+	var catalog Catalog
+	found, err := c.getJSON(ctx, catalogURL, &catalog)
+	if err != nil {
+		return nil, fmt.Errorf("fetch catalog: %w", err)
+	}
+	if !found {
+		return nil, fmt.Errorf("fetch catalog: %s not found", catalogURL)
+	}
+
+	shim := &Shim{Name: name}
+	shim.Version, shim.Platform, shim.Hash, err = catalog.Resolve(name, version, platform)
+	if err != nil {
+		return nil, err
+	}
+
+	digest := strings.TrimPrefix(shim.Hash, "sha256:")
+	url := strings.ReplaceAll(endpoints.url(registryURL, "shims", DefaultShimPath), "{hash}", digest)
+	shim.Data, err = c.get(ctx, url)
+	if err != nil {
+		return nil, fmt.Errorf("fetch shim: %w", err)
+	}
+	if shim.Data == nil {
+		return nil, fmt.Errorf("fetch shim: %w: %s", ErrNotFound, url)
+	}
+
+	if err := json.Unmarshal(shim.Data, &shim.Metadata); err != nil {
+		return nil, fmt.Errorf("fetch shim: %s: invalid JSON: %w", url, err)
+	}
+	// Shims are addressed by the hash of the binary they describe, not of
+	// their own content, so a misfiled or garbled shim is caught here but
+	// an edit keeping binary.hash intact is not
+	if shim.Metadata.Binary == nil || strings.TrimPrefix(shim.Metadata.Binary.Hash, "sha256:") != digest {
+		return nil, fmt.Errorf("fetch shim: %s does not describe binary %s", url, shim.Hash)
+	}
+	if shim.Metadata.Name != name {
+		return nil, fmt.Errorf("fetch shim: %s describes %q, not %q", url, shim.Metadata.Name, name)
+	}
+	return shim, nil
+}
+
+// Resolve looks up the hash of a tool's shim. An empty version selects the
+// latest version, as Latest does. If the version has no shim for platform,
+// its platform-independent shim is used, if any. It returns the resolved
+// version and platform along with the hash, or an error wrapping
+// ErrNotFound.
+func (c *Catalog) Resolve(name, version, platform string) (string, string, string, error) {
+	tool, ok := c.Tools[name]
+	if !ok {
+		return "", "", "", fmt.Errorf("%w: no tool %s in catalog", ErrNotFound, name)
+	}
+	if version == "" {
+		version = Latest(tool.Versions)
+	}
+	platforms, ok := tool.Versions[version]
+	if !ok {
+		return "", "", "", fmt.Errorf("%w: no version %s of %s in catalog", ErrNotFound, version, name)
+	}
+	for _, candidate := range []string{platform, ""} {
+		if hash := platforms[candidate]; hash != "" {
+			return version, candidate, hash, nil
+		}
+	}
+	return "", "", "", fmt.Errorf("%w: no shim of %s %s for %s in catalog", ErrNotFound, name, version, platform)
+}
+
+// getJSON decodes the JSON body at url into v. It reports false, without
+// an error, if the server responds 404.
+func (c *Client) getJSON(ctx context.Context, url string, v interface{}) (bool, error) {
+	body, err := c.get(ctx, url)
+	if err != nil || body == nil {
+		return false, err
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		return false, fmt.Errorf("%s: invalid JSON: %w", url, err)
+	}
+	return true, nil
+}
+
+// get returns the body at url, or nil without an error if the server
+// responds 404.
+func (c *Client) get(ctx context.Context, url string) ([]byte, error) {
+	resp, err := c.do(ctx, url)
+	if err != nil || resp == nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// do fetches url for JSON through the response cache, returning nil
+// without an error if the server responds 404.
+func (c *Client) do(ctx context.Context, url string) (*httpcache.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	return c.http.Do(req)
+}
+
+// Diff statuses.
+const (
+	StatusMissing   = "missing"    // In the remote catalog, not discovered locally
+	StatusOutdated  = "outdated"   // A newer version is in the remote catalog
+	StatusLocalOnly = "local_only" // Discovered locally, not in the remote catalog
+)
+
+// DiffEntry is a tool that differs between the local registry and a
+// remote catalog.
+type DiffEntry struct {
+	Name          string `json:"name"`
+	Status        string `json:"status"`
+	LocalVersion  string `json:"local_version,omitempty"`
+	RemoteVersion string `json:"remote_version,omitempty"` // Newest version in the catalog
+	Description   string `json:"description,omitempty"`
+}
+
+// Diff compares locally discovered tools with a remote catalog by name and
+// version. Tools whose executable is missing are not treated as local.
+// Versions that aren't semantic versions are never reported as outdated.
+// Entries are sorted by name.
+func Diff(local []*registry.RegistryEntry, catalog *Catalog) []DiffEntry {
+	diff := []DiffEntry{}
+
+	localByName := make(map[string]*registry.RegistryEntry)
+	for _, entry := range local {
+		if !entry.Missing {
+			localByName[entry.Name] = entry
+		}
+	}
+
+	for name, tool := range catalog.Tools {
+		remoteVersion := Latest(tool.Versions)
+		entry, ok := localByName[name]
+		switch {
+		case !ok:
+			diff = append(diff, DiffEntry{
+				Name:          name,
+				Status:        StatusMissing,
+				RemoteVersion: remoteVersion,
+				Description:   tool.Description,
+			})
+		case newer(remoteVersion, entry.Version):
+			diff = append(diff, DiffEntry{
+				Name:          name,
+				Status:        StatusOutdated,
+				LocalVersion:  entry.Version,
+				RemoteVersion: remoteVersion,
+				Description:   tool.Description,
+			})
+		}
+	}
+
+	for name, entry := range localByName {
+		if _, ok := catalog.Tools[name]; !ok {
+			diff = append(diff, DiffEntry{
+				Name:         name,
+				Status:       StatusLocalOnly,
+				LocalVersion: entry.Version,
+			})
+		}
+	}
+
+	sort.Slice(diff, func(i, j int) bool { return diff[i].Name < diff[j].Name })
+	return diff
+}
+
+// DiffLocal returns Diff(local, cached.Catalog), reusing the diff computed
+// on a previous run if the catalog is unchanged and local has the same tools
+// and versions. It reports whether the diff was reused, and records the
+// result so it can be saved with the catalog.
+func (cached *CachedCatalog) DiffLocal(local []*registry.RegistryEntry) ([]DiffEntry, bool) {
+	digest := localDigest(local)
+	if cached.Unchanged && cached.Diff != nil && cached.LocalDigest == digest {
+		return cached.Diff, true
+	}
+
+	cached.Diff = Diff(local, cached.Catalog)
+	cached.LocalDigest = digest
+	return cached.Diff, false
+}
+
+// localDigest fingerprints what Diff reads from the local tools: the name
+// and version of each one whose executable isn't missing.
+func localDigest(local []*registry.RegistryEntry) string {
+	var lines []string
+	for _, entry := range local {
+		if !entry.Missing {
+			lines = append(lines, entry.Name+"\x00"+entry.Version)
+		}
+	}
+	sort.Strings(lines)
+
+	sum := sha256.Sum256([]byte(strings.Join(lines, "\n")))
+	return hex.EncodeToString(sum[:])
+}
+
+// Latest returns the highest semantic version among versions' keys, or, if
+// none is a semantic version, the lexically greatest key.
+func Latest(versions map[string]map[string]string) string {
+	latest := ""
+	for version := range versions {
+		switch {
+		case latest == "":
+			latest = version
+		case isSemver(version) && !isSemver(latest):
+			latest = version
+		case newer(version, latest):
+			latest = version
+		case !isSemver(latest) && !isSemver(version) && version > latest:
+			latest = version
+		}
+	}
+	return latest
+}
+
+// newer reports whether version a is a higher semantic version than b.
+// It is false if either isn't a semantic version.
+func newer(a, b string) bool {
+	if !isSemver(a) || !isSemver(b) {
+		return false
+	}
+	return validator.CompareVersions(a, b) > 0
+}
+
+// isSemver reports whether version is a semantic version, optionally
+// prefixed with "v".
+func isSemver(version string) bool {
+	_, err := validator.NormalizeVersion(version)
+	return err == nil
+}
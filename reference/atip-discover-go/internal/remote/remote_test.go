@@ -0,0 +1,343 @@
+package remote
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/atip/atip-discover/internal/registry"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newCatalogServer serves catalog at catalogPath, and a manifest pointing
+// to it unless catalogPath is the default.
+func newCatalogServer(t *testing.T, catalogPath string, catalog *Catalog) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	if catalogPath != DefaultCatalogPath {
+		mux.HandleFunc(ManifestPath, func(w http.ResponseWriter, r *http.Request) {
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"endpoints": map[string]string{"catalog": catalogPath},
+			})
+		})
+	}
+	mux.HandleFunc(catalogPath, func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(catalog)
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func testCatalog() *Catalog {
+	return &Catalog{
+		Version: "1",
+		Tools: map[string]ToolInfo{
+			"curl": {
+				Description: "Transfer data with URLs",
+				Versions: map[string]map[string]string{
+					"8.4.0": {"linux-amd64": "sha256:aaa"},
+					"8.5.0": {"linux-amd64": "sha256:bbb"},
+				},
+			},
+		},
+	}
+}
+
+func TestClient_FetchCatalog(t *testing.T) {
+	tests := []struct {
+		name        string
+		catalogPath string
+	}{
+		{name: "manifest endpoint", catalogPath: "/v1/catalog.json"},
+		{name: "default layout", catalogPath: DefaultCatalogPath},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newCatalogServer(t, tt.catalogPath, testCatalog())
+
+			catalog, err := NewClient(5*time.Second).FetchCatalog(context.Background(), server.URL+"/")
+			require.NoError(t, err)
+			assert.Equal(t, testCatalog(), catalog)
+		})
+	}
+}
+
+func TestClient_FetchCatalog_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		wantErr string
+	}{
+		{
+			name:    "no catalog",
+			handler: http.NotFound,
+			wantErr: "not found",
+		},
+		{
+			name: "server error",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, "boom", http.StatusInternalServerError)
+			},
+			wantErr: "500",
+		},
+		{
+			name: "invalid JSON",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == DefaultCatalogPath {
+					w.Write([]byte("{"))
+					return
+				}
+				http.NotFound(w, r)
+			},
+			wantErr: "invalid JSON",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(tt.handler)
+			defer server.Close()
+
+			_, err := NewClient(5*time.Second).FetchCatalog(context.Background(), server.URL)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
+
+func TestClient_FetchCatalogCached(t *testing.T) {
+	catalog := testCatalog()
+	etag := `"v1"`
+	var full, notModified int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != DefaultCatalogPath {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		if r.Header.Get("If-None-Match") == etag {
+			notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		full++
+		json.NewEncoder(w).Encode(catalog)
+	}))
+	defer server.Close()
+
+	client := NewClient(5 * time.Second)
+	client.SetCacheDir(t.TempDir())
+	local := []*registry.RegistryEntry{{Name: "curl", Version: "8.4.0"}}
+	fetch := func() (*CachedCatalog, bool) {
+		t.Helper()
+		cached, err := client.FetchCatalogCached(context.Background(), server.URL)
+		require.NoError(t, err)
+		_, reused := cached.DiffLocal(local)
+		require.NoError(t, client.SaveCatalog(server.URL, cached))
+		return cached, reused
+	}
+
+	// The first fetch downloads the catalog and computes the diff
+	cached, reused := fetch()
+	assert.False(t, cached.Unchanged)
+	assert.False(t, reused)
+	assert.Equal(t, catalog, cached.Catalog)
+	assert.Equal(t, 1, full)
+
+	// An unchanged catalog is revalidated and the diff reused
+	cached, reused = fetch()
+	assert.True(t, cached.Unchanged)
+	assert.True(t, reused)
+	assert.Equal(t, catalog, cached.Catalog)
+	assert.Equal(t, []DiffEntry{{Name: "curl", Status: StatusOutdated, LocalVersion: "8.4.0", RemoteVersion: "8.5.0", Description: "Transfer data with URLs"}}, cached.Diff)
+	assert.Equal(t, 1, full)
+	assert.Equal(t, 1, notModified)
+
+	// A local change invalidates the diff but not the catalog
+	local = []*registry.RegistryEntry{{Name: "curl", Version: "8.5.0"}}
+	cached, reused = fetch()
+	assert.True(t, cached.Unchanged)
+	assert.False(t, reused)
+	assert.Empty(t, cached.Diff)
+
+	// A changed catalog is downloaded again
+	etag = `"v2"`
+	cached, reused = fetch()
+	assert.False(t, cached.Unchanged)
+	assert.False(t, reused)
+	assert.Equal(t, 2, full)
+}
+
+func TestCatalog_Resolve(t *testing.T) {
+	catalog := testCatalog()
+	catalog.Tools["jq"] = ToolInfo{Versions: map[string]map[string]string{
+		"1.7.1": {"": "sha256:any", "darwin-arm64": "sha256:mac"},
+	}}
+
+	tests := []struct {
+		name         string
+		tool         string
+		version      string
+		platform     string
+		wantVersion  string
+		wantPlatform string
+		wantHash     string
+		wantErr      bool
+	}{
+		{name: "latest", tool: "curl", platform: "linux-amd64", wantVersion: "8.5.0", wantPlatform: "linux-amd64", wantHash: "sha256:bbb"},
+		{name: "pinned version", tool: "curl", version: "8.4.0", platform: "linux-amd64", wantVersion: "8.4.0", wantPlatform: "linux-amd64", wantHash: "sha256:aaa"},
+		{name: "platform match", tool: "jq", platform: "darwin-arm64", wantVersion: "1.7.1", wantPlatform: "darwin-arm64", wantHash: "sha256:mac"},
+		{name: "platform-independent fallback", tool: "jq", platform: "linux-amd64", wantVersion: "1.7.1", wantPlatform: "", wantHash: "sha256:any"},
+		{name: "unknown tool", tool: "wget", platform: "linux-amd64", wantErr: true},
+		{name: "unknown version", tool: "curl", version: "7.0.0", platform: "linux-amd64", wantErr: true},
+		{name: "unknown platform", tool: "curl", platform: "darwin-arm64", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			version, platform, hash, err := catalog.Resolve(tt.tool, tt.version, tt.platform)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrNotFound)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantVersion, version)
+			assert.Equal(t, tt.wantPlatform, platform)
+			assert.Equal(t, tt.wantHash, hash)
+		})
+	}
+}
+
+func TestClient_FetchShim(t *testing.T) {
+	// As an atip-registry stores it, addressed by the binary's hash
+	digest := strings.Repeat("a1b2", 16)
+	shim := `{"atip": {"version": "0.6"}, "binary": {"hash": "sha256:` + digest + `", "name": "curl", "version": "8.5.0", "platform": "linux-amd64"}, "name": "curl", "version": "8.5.0", "description": "Transfer data with URLs", "commands": {}}`
+	tampered := strings.Repeat("ab", 32)
+	catalog := &Catalog{Version: "1", Tools: map[string]ToolInfo{
+		"curl":     {Versions: map[string]map[string]string{"8.5.0": {"linux-amd64": "sha256:" + digest}}},
+		"gone":     {Versions: map[string]map[string]string{"1.0.0": {"linux-amd64": "sha256:" + strings.Repeat("cd", 32)}}},
+		"tampered": {Versions: map[string]map[string]string{"1.0.0": {"linux-amd64": "sha256:" + tampered}}},
+	}}
+
+	tests := []struct {
+		name      string
+		shimsPath string // Declared in the manifest, or the default layout
+	}{
+		{name: "default layout", shimsPath: ""},
+		{name: "manifest endpoint", shimsPath: "/v1/shims/{hash}"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mux := http.NewServeMux()
+			shimURL := "/shims/sha256/" + digest + ".json"
+			if tt.shimsPath != "" {
+				shimURL = strings.ReplaceAll(tt.shimsPath, "{hash}", digest)
+				mux.HandleFunc(ManifestPath, func(w http.ResponseWriter, r *http.Request) {
+					json.NewEncoder(w).Encode(map[string]interface{}{"endpoints": map[string]string{"shims": tt.shimsPath}})
+				})
+			}
+			mux.HandleFunc(DefaultCatalogPath, func(w http.ResponseWriter, r *http.Request) {
+				json.NewEncoder(w).Encode(catalog)
+			})
+			mux.HandleFunc(shimURL, func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(shim))
+			})
+			mux.HandleFunc(strings.ReplaceAll(shimURL, digest, tampered), func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(shim))
+			})
+			server := httptest.NewServer(mux)
+			defer server.Close()
+			client := NewClient(5 * time.Second)
+
+			got, err := client.FetchShim(context.Background(), server.URL, "curl", "", "linux-amd64")
+			require.NoError(t, err)
+			assert.Equal(t, "8.5.0", got.Version)
+			assert.Equal(t, "linux-amd64", got.Platform)
+			assert.Equal(t, "sha256:"+digest, got.Hash)
+			assert.Equal(t, shim, string(got.Data))
+			assert.Equal(t, "Transfer data with URLs", got.Metadata.Description)
+
+			// Missing from the catalog or from the shims endpoint
+			_, err = client.FetchShim(context.Background(), server.URL, "wget", "", "linux-amd64")
+			assert.ErrorIs(t, err, ErrNotFound)
+			_, err = client.FetchShim(context.Background(), server.URL, "gone", "", "linux-amd64")
+			assert.ErrorIs(t, err, ErrNotFound)
+
+			// A shim describing another binary is rejected
+			_, err = client.FetchShim(context.Background(), server.URL, "tampered", "", "linux-amd64")
+			assert.ErrorContains(t, err, "does not describe binary sha256:"+tampered)
+		})
+	}
+}
+
+func TestDiff(t *testing.T) {
+	catalog := &Catalog{
+		Tools: map[string]ToolInfo{
+			"curl": {Description: "Transfer data with URLs", Versions: map[string]map[string]string{
+				"8.4.0": {}, "8.10.0": {},
+			}},
+			"jq": {Description: "JSON processor", Versions: map[string]map[string]string{
+				"1.7.1": {},
+			}},
+			"gh": {Description: "GitHub CLI", Versions: map[string]map[string]string{
+				"2.45.0": {},
+			}},
+			"tar": {Versions: map[string]map[string]string{
+				"unknown": {},
+			}},
+			"git": {Versions: map[string]map[string]string{
+				"2.40.0": {},
+			}},
+		},
+	}
+	local := []*registry.RegistryEntry{
+		{Name: "curl", Version: "8.4.0"},
+		{Name: "gh", Version: "2.46.0"},
+		{Name: "tar", Version: "1.35"},
+		{Name: "git", Version: "2.40.0", Missing: true},
+		{Name: "mytool", Version: "0.1.0"},
+	}
+
+	diff := Diff(local, catalog)
+
+	assert.Equal(t, []DiffEntry{
+		{Name: "curl", Status: StatusOutdated, LocalVersion: "8.4.0", RemoteVersion: "8.10.0", Description: "Transfer data with URLs"},
+		{Name: "git", Status: StatusMissing, RemoteVersion: "2.40.0"},
+		{Name: "jq", Status: StatusMissing, RemoteVersion: "1.7.1", Description: "JSON processor"},
+		{Name: "mytool", Status: StatusLocalOnly, LocalVersion: "0.1.0"},
+	}, diff)
+}
+
+func TestLatest(t *testing.T) {
+	tests := []struct {
+		name     string
+		versions []string
+		want     string
+	}{
+		{name: "empty", versions: nil, want: ""},
+		{name: "numeric order", versions: []string{"1.9.0", "1.10.0", "1.2.0"}, want: "1.10.0"},
+		{name: "release beats pre-release", versions: []string{"2.0.0-rc.1", "2.0.0", "2.0.0-beta"}, want: "2.0.0"},
+		{name: "pre-release order", versions: []string{"2.0.0-rc.2", "2.0.0-rc.10"}, want: "2.0.0-rc.10"},
+		{name: "v prefix", versions: []string{"v1.2.0", "1.1.0"}, want: "v1.2.0"},
+		{name: "semver beats other", versions: []string{"latest", "0.1.0"}, want: "0.1.0"},
+		{name: "no semver", versions: []string{"a", "c", "b"}, want: "c"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			versions := make(map[string]map[string]string)
+			for _, v := range tt.versions {
+				versions[v] = map[string]string{}
+			}
+			assert.Equal(t, tt.want, Latest(versions))
+		})
+	}
+}
@@ -0,0 +1,168 @@
+// Package rpc serves a small line-delimited JSON request/response protocol,
+// e.g. on stdin and stdout, so an agent host can query a long-lived
+// atip-discover process instead of starting one per query.
+package rpc
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// MethodShutdown is the method that ends Serve after it is answered.
+const MethodShutdown = "shutdown"
+
+// Error codes for requests that can't be dispatched. Handlers report their
+// own codes, e.g. the CLI's error envelope codes.
+const (
+	CodeInvalidRequest = "INVALID_REQUEST" // The line isn't a JSON request with a method
+	CodeUnknownMethod  = "UNKNOWN_METHOD"  // No handler is registered for the method
+	CodeInvalidParams  = "INVALID_PARAMS"  // The params don't decode into what the method takes
+	CodeInternal       = "INTERNAL_ERROR"  // A handler failed without an *Error
+)
+
+// Request is one line read by Serve. ID is echoed in the response as given,
+// so clients can match responses to requests; it may be omitted.
+type Request struct {
+	ID     json.RawMessage `json:"id,omitempty"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params,omitempty"`
+}
+
+// Response is one line written by Serve. Exactly one of Result and Error is
+// set.
+type Response struct {
+	ID     json.RawMessage `json:"id,omitempty"`
+	Result interface{}     `json:"result,omitempty"`
+	Error  *Error          `json:"error,omitempty"`
+}
+
+// Error is a failed request, shaped like the CLI's JSON error envelope.
+type Error struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return e.Code + ": " + e.Message
+}
+
+// Errorf returns an *Error with the given code and formatted message.
+func Errorf(code, format string, args ...interface{}) *Error {
+	return &Error{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// Handler answers a request's params with a result to encode as JSON. An
+// *Error it returns is sent as is; any other error as CodeInternal.
+type Handler func(params json.RawMessage) (interface{}, error)
+
+// Server dispatches requests to the handler registered for their method.
+type Server struct {
+	handlers map[string]Handler
+}
+
+// NewServer creates a server that answers only shutdown until handlers are
+// registered.
+func NewServer() *Server {
+	return &Server{handlers: make(map[string]Handler)}
+}
+
+// Handle registers h for method, replacing any handler registered before.
+// Shutdown is always answered by the server itself.
+func (s *Server) Handle(method string, h Handler) {
+	s.handlers[method] = h
+}
+
+// Methods returns the methods the server answers, sorted.
+func (s *Server) Methods() []string {
+	methods := []string{MethodShutdown}
+	for method := range s.handlers {
+		if method != MethodShutdown {
+			methods = append(methods, method)
+		}
+	}
+	sort.Strings(methods)
+	return methods
+}
+
+// Serve reads requests from r, one JSON object per line, and writes each
+// response to w as a single line before reading the next request, so
+// responses come in request order. Blank lines are ignored. It returns nil
+// once r is exhausted or a shutdown request has been answered, or the
+// error that stopped it reading r or writing w.
+func (s *Server) Serve(r io.Reader, w io.Writer) error {
+	reader := bufio.NewReader(r)
+	encoder := json.NewEncoder(w)
+	for {
+		line, readErr := reader.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) > 0 {
+			resp, shutdown := s.answer(line)
+			if err := encoder.Encode(resp); err != nil {
+				return fmt.Errorf("failed to write response: %w", err)
+			}
+			if shutdown {
+				return nil
+			}
+		}
+		if readErr == io.EOF {
+			return nil
+		}
+		if readErr != nil {
+			return fmt.Errorf("failed to read request: %w", readErr)
+		}
+	}
+}
+
+// answer handles one request line, reporting whether it asked to shut down.
+func (s *Server) answer(line []byte) (resp Response, shutdown bool) {
+	var req Request
+	if err := json.Unmarshal(line, &req); err != nil {
+		return Response{Error: Errorf(CodeInvalidRequest, "invalid JSON: %v", err)}, false
+	}
+	resp.ID = req.ID
+	if req.Method == "" {
+		resp.Error = Errorf(CodeInvalidRequest, "method is required")
+		return resp, false
+	}
+	if req.Method == MethodShutdown {
+		resp.Result = map[string]bool{"shutdown": true}
+		return resp, true
+	}
+
+	handler, ok := s.handlers[req.Method]
+	if !ok {
+		resp.Error = Errorf(CodeUnknownMethod, "unknown method %q (expected one of %s)", req.Method, strings.Join(s.Methods(), ", "))
+		return resp, false
+	}
+	result, err := handler(req.Params)
+	if err != nil {
+		var rpcErr *Error
+		if !errors.As(err, &rpcErr) {
+			rpcErr = &Error{Code: CodeInternal, Message: err.Error()}
+		}
+		resp.Error = rpcErr
+		return resp, false
+	}
+	resp.Result = result
+	return resp, false
+}
+
+// DecodeParams decodes a request's params into v, rejecting fields v
+// doesn't have so typos aren't silently ignored. Missing params leave v as
+// is. Failures are returned as CodeInvalidParams errors.
+func DecodeParams(params json.RawMessage, v interface{}) error {
+	if len(params) == 0 || string(params) == "null" {
+		return nil
+	}
+	decoder := json.NewDecoder(bytes.NewReader(params))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		return Errorf(CodeInvalidParams, "invalid params: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package rpc
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// echoServer answers echo with its text param, and fail with a typed error
+// if its params are "typed" or an untyped one otherwise.
+func echoServer() *Server {
+	s := NewServer()
+	s.Handle("echo", func(params json.RawMessage) (interface{}, error) {
+		var p struct {
+			Text string `json:"text"`
+		}
+		if err := DecodeParams(params, &p); err != nil {
+			return nil, err
+		}
+		return p, nil
+	})
+	s.Handle("fail", func(params json.RawMessage) (interface{}, error) {
+		if string(params) == `"typed"` {
+			return nil, Errorf("TOOL_NOT_FOUND", "tool not found: %s", "gh")
+		}
+		return nil, errors.New("disk on fire")
+	})
+	return s
+}
+
+// serve runs s on input and returns the response lines.
+func serve(t *testing.T, s *Server, input string) []string {
+	t.Helper()
+	var out strings.Builder
+	require.NoError(t, s.Serve(strings.NewReader(input), &out))
+	return strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+}
+
+func TestServer_Serve(t *testing.T) {
+	lines := serve(t, echoServer(), strings.Join([]string{
+		`{"id": 1, "method": "echo", "params": {"text": "hi"}}`,
+		``,
+		`{"id": "b", "method": "echo"}`,
+		`{"id": 3, "method": "fail", "params": "typed"}`,
+		`{"id": 4, "method": "fail"}`,
+		`{"id": 5, "method": "echo", "params": {"txt": "typo"}}`,
+		`{"id": 6, "method": "nope"}`,
+		`{"id": 7}`,
+		`not json`,
+	}, "\n"))
+
+	assert.Equal(t, []string{
+		`{"id":1,"result":{"text":"hi"}}`,
+		`{"id":"b","result":{"text":""}}`,
+		`{"id":3,"error":{"code":"TOOL_NOT_FOUND","message":"tool not found: gh"}}`,
+		`{"id":4,"error":{"code":"INTERNAL_ERROR","message":"disk on fire"}}`,
+		`{"id":5,"error":{"code":"INVALID_PARAMS","message":"invalid params: json: unknown field \"txt\""}}`,
+		`{"id":6,"error":{"code":"UNKNOWN_METHOD","message":"unknown method \"nope\" (expected one of echo, fail, shutdown)"}}`,
+		`{"id":7,"error":{"code":"INVALID_REQUEST","message":"method is required"}}`,
+		`{"error":{"code":"INVALID_REQUEST","message":"invalid JSON: invalid character 'o' in literal null (expecting 'u')"}}`,
+	}, lines)
+}
+
+func TestServer_Shutdown(t *testing.T) {
+	lines := serve(t, echoServer(), `{"id": 1, "method": "shutdown"}
+{"id": 2, "method": "echo"}
+`)
+	assert.Equal(t, []string{`{"id":1,"result":{"shutdown":true}}`}, lines)
+}
+
+func TestServer_Pipe(t *testing.T) {
+	// Each response is written before the next request is read, so a
+	// client can hold the pipe open between requests
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+	done := make(chan error, 1)
+	go func() { done <- echoServer().Serve(inR, outW) }()
+
+	responses := bufio.NewScanner(outR)
+	for _, text := range []string{"one", "two"} {
+		_, err := io.WriteString(inW, `{"id": "`+text+`", "method": "echo", "params": {"text": "`+text+`"}}`+"\n")
+		require.NoError(t, err)
+		require.True(t, responses.Scan())
+		var resp struct {
+			ID     string            `json:"id"`
+			Result map[string]string `json:"result"`
+		}
+		require.NoError(t, json.Unmarshal(responses.Bytes(), &resp))
+		assert.Equal(t, text, resp.ID)
+		assert.Equal(t, text, resp.Result["text"])
+	}
+
+	require.NoError(t, inW.Close())
+	assert.NoError(t, <-done)
+}
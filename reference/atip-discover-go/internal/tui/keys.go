@@ -0,0 +1,68 @@
+package tui
+
+import "unicode/utf8"
+
+// ParseKeys decodes the bytes read from a terminal in raw mode into key
+// events. Escape sequences other than the arrow and page keys are dropped,
+// as are bytes that aren't valid UTF-8, and an escape byte that doesn't
+// start a sequence is KeyEscape.
+func ParseKeys(b []byte) []Key {
+	var keys []Key
+	for i := 0; i < len(b); {
+		c := b[i]
+		switch {
+		case c == 0x1b && i+1 < len(b) && (b[i+1] == '[' || b[i+1] == 'O'):
+			// CSI or SS3 sequence: parameters, then a final byte in 0x40-0x7e
+			j := i + 2
+			for j < len(b) && (b[j] < 0x40 || b[j] > 0x7e) {
+				j++
+			}
+			if j < len(b) {
+				if k, ok := escapeKey(string(b[i+2 : j+1])); ok {
+					keys = append(keys, k)
+				}
+			}
+			i = j + 1
+			continue
+		case c == 0x1b:
+			keys = append(keys, Key{Type: KeyEscape})
+		case c == 0x03:
+			keys = append(keys, Key{Type: KeyInterrupt})
+		case c == 0x7f || c == 0x08:
+			keys = append(keys, Key{Type: KeyBackspace})
+		case c == 0x15:
+			keys = append(keys, Key{Type: KeyClear})
+		case c == 0x10:
+			keys = append(keys, Key{Type: KeyUp})
+		case c == 0x0e:
+			keys = append(keys, Key{Type: KeyDown})
+		case c < 0x20:
+			// Other control characters have no binding
+		default:
+			r, size := utf8.DecodeRune(b[i:])
+			if r != utf8.RuneError || size > 1 {
+				keys = append(keys, Key{Type: KeyRune, Rune: r})
+			}
+			i += size
+			continue
+		}
+		i++
+	}
+	return keys
+}
+
+// escapeKey maps the body of an escape sequence, after "ESC [" or "ESC O",
+// to a key.
+func escapeKey(seq string) (Key, bool) {
+	switch seq {
+	case "A":
+		return Key{Type: KeyUp}, true
+	case "B":
+		return Key{Type: KeyDown}, true
+	case "5~":
+		return Key{Type: KeyPageUp}, true
+	case "6~":
+		return Key{Type: KeyPageDown}, true
+	}
+	return Key{}, false
+}
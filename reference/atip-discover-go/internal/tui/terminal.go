@@ -0,0 +1,79 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd
+
+package tui
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// Terminal control sequences.
+const (
+	enterAltScreen = "\x1b[?1049h\x1b[?25l" // Alternate screen, cursor hidden
+	exitAltScreen  = "\x1b[?25h\x1b[?1049l"
+	clearScreen    = "\x1b[H\x1b[2J"
+)
+
+// IsTerminal reports whether f is a terminal.
+func IsTerminal(f *os.File) bool {
+	_, err := unix.IoctlGetTermios(int(f.Fd()), ioctlReadTermios)
+	return err == nil
+}
+
+// Run shows m on the terminal until the user quits, reading keys from in and
+// drawing to out on the alternate screen. The terminal is restored before
+// Run returns. It returns ErrNotTerminal if in or out isn't a terminal.
+func Run(m *Model, in, out *os.File) error {
+	if !IsTerminal(in) || !IsTerminal(out) {
+		return ErrNotTerminal
+	}
+	restore, err := makeRaw(int(in.Fd()))
+	if err != nil {
+		return fmt.Errorf("failed to set terminal mode: %w", err)
+	}
+	defer restore()
+
+	io.WriteString(out, enterAltScreen)
+	defer io.WriteString(out, exitAltScreen)
+
+	buf := make([]byte, 256)
+	for !m.Done() {
+		// Pick up resizes on each redraw
+		if ws, err := unix.IoctlGetWinsize(int(out.Fd()), unix.TIOCGWINSZ); err == nil {
+			m.Resize(int(ws.Col), int(ws.Row))
+		}
+		if _, err := io.WriteString(out, clearScreen+m.View()); err != nil {
+			return err
+		}
+		n, err := in.Read(buf)
+		if err != nil {
+			return err
+		}
+		for _, k := range ParseKeys(buf[:n]) {
+			m.Update(k)
+		}
+	}
+	return nil
+}
+
+// makeRaw puts the terminal in raw input mode: no line buffering, echo or
+// signal keys, so Ctrl-C arrives as a key. Output processing stays on, so
+// newlines still return the cursor. The returned func restores the old mode.
+func makeRaw(fd int) (func(), error) {
+	old, err := unix.IoctlGetTermios(fd, ioctlReadTermios)
+	if err != nil {
+		return nil, err
+	}
+	raw := *old
+	raw.Iflag &^= unix.BRKINT | unix.ICRNL | unix.INPCK | unix.ISTRIP | unix.IXON
+	raw.Lflag &^= unix.ECHO | unix.ICANON | unix.IEXTEN | unix.ISIG
+	raw.Cc[unix.VMIN] = 1
+	raw.Cc[unix.VTIME] = 0
+	if err := unix.IoctlSetTermios(fd, ioctlWriteTermios, &raw); err != nil {
+		return nil, err
+	}
+	return func() { unix.IoctlSetTermios(fd, ioctlWriteTermios, old) }, nil
+}
@@ -0,0 +1,19 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd)
+
+package tui
+
+import (
+	"errors"
+	"os"
+)
+
+// IsTerminal reports whether f is a terminal. Terminal detection isn't
+// supported on this platform, so it always reports false.
+func IsTerminal(f *os.File) bool {
+	return false
+}
+
+// Run isn't supported on this platform and always fails.
+func Run(m *Model, in, out *os.File) error {
+	return errors.New("interactive mode is not supported on this platform")
+}
@@ -0,0 +1,307 @@
+// Package tui implements the interactive tool browser behind
+// 'atip-discover list --interactive': a filterable list of discovered tools
+// above a detail pane for the selected one.
+//
+// The Model holds all state and renders to a string, so it can be driven by
+// key events in tests without a terminal; Run connects it to a real one.
+package tui
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// ErrNotTerminal is returned by Run when stdin or stdout isn't a terminal.
+var ErrNotTerminal = errors.New("interactive mode requires a terminal")
+
+// Default screen size, used until the terminal reports its own.
+const (
+	DefaultWidth  = 80
+	DefaultHeight = 24
+)
+
+// Item is a tool shown in the list.
+type Item struct {
+	Name        string
+	Version     string
+	Source      string
+	Description string
+}
+
+// DetailFunc loads the text shown in the detail pane for an item, typically
+// from its cached metadata. It is called at most once per item.
+type DetailFunc func(item Item) (string, error)
+
+// KeyType identifies a key event.
+type KeyType int
+
+// Key types understood by the Model.
+const (
+	KeyRune      KeyType = iota // A printable character, typed into the filter
+	KeyBackspace                // Delete the last filter character
+	KeyClear                    // Clear the filter (Ctrl-U)
+	KeyUp
+	KeyDown
+	KeyPageUp
+	KeyPageDown
+	KeyEscape    // Clear the filter, or quit if it's already empty
+	KeyInterrupt // Quit (Ctrl-C)
+)
+
+// Key is a single key event.
+type Key struct {
+	Type KeyType
+	Rune rune // Set for KeyRune
+}
+
+// Model is the state of the tool browser.
+type Model struct {
+	items   []Item
+	load    DetailFunc
+	details map[int]string // Loaded detail text by item index
+
+	filter  string
+	visible []int // Indexes of the items matching the filter
+	cursor  int   // Index into visible of the selected item
+
+	width  int
+	height int
+	done   bool
+}
+
+// NewModel creates a Model listing items, in order, with details loaded by
+// load. A nil load leaves the detail pane showing only the list columns.
+func NewModel(items []Item, load DetailFunc) *Model {
+	m := &Model{
+		items:   items,
+		load:    load,
+		details: make(map[int]string),
+		width:   DefaultWidth,
+		height:  DefaultHeight,
+	}
+	m.applyFilter()
+	return m
+}
+
+// Resize sets the screen size the Model renders to.
+func (m *Model) Resize(width, height int) {
+	if width > 0 {
+		m.width = width
+	}
+	if height > 0 {
+		m.height = height
+	}
+}
+
+// Done reports whether the user has asked to quit.
+func (m *Model) Done() bool {
+	return m.done
+}
+
+// Filter returns the current name filter.
+func (m *Model) Filter() string {
+	return m.filter
+}
+
+// Visible returns the items matching the filter, in list order.
+func (m *Model) Visible() []Item {
+	items := make([]Item, len(m.visible))
+	for i, idx := range m.visible {
+		items[i] = m.items[idx]
+	}
+	return items
+}
+
+// Selected returns the selected item, or false if no item matches the filter.
+func (m *Model) Selected() (Item, bool) {
+	if len(m.visible) == 0 {
+		return Item{}, false
+	}
+	return m.items[m.visible[m.cursor]], true
+}
+
+// Update applies a key event.
+func (m *Model) Update(k Key) {
+	switch k.Type {
+	case KeyRune:
+		if unicode.IsPrint(k.Rune) {
+			m.setFilter(m.filter + string(k.Rune))
+		}
+	case KeyBackspace:
+		if r := []rune(m.filter); len(r) > 0 {
+			m.setFilter(string(r[:len(r)-1]))
+		}
+	case KeyClear:
+		m.setFilter("")
+	case KeyUp:
+		m.move(-1)
+	case KeyDown:
+		m.move(1)
+	case KeyPageUp:
+		m.move(-m.listHeight())
+	case KeyPageDown:
+		m.move(m.listHeight())
+	case KeyEscape:
+		if m.filter == "" {
+			m.done = true
+		} else {
+			m.setFilter("")
+		}
+	case KeyInterrupt:
+		m.done = true
+	}
+}
+
+// setFilter changes the filter, keeping the selected item selected if it
+// still matches.
+func (m *Model) setFilter(filter string) {
+	selected := -1
+	if len(m.visible) > 0 {
+		selected = m.visible[m.cursor]
+	}
+	m.filter = filter
+	m.applyFilter()
+	m.cursor = 0
+	for i, idx := range m.visible {
+		if idx == selected {
+			m.cursor = i
+			break
+		}
+	}
+}
+
+// applyFilter recomputes the visible items: those whose names contain the
+// filter, ignoring case.
+func (m *Model) applyFilter() {
+	needle := strings.ToLower(m.filter)
+	m.visible = m.visible[:0]
+	for i, item := range m.items {
+		if strings.Contains(strings.ToLower(item.Name), needle) {
+			m.visible = append(m.visible, i)
+		}
+	}
+}
+
+// move moves the selection by delta, stopping at either end of the list.
+func (m *Model) move(delta int) {
+	if len(m.visible) == 0 {
+		return
+	}
+	m.cursor += delta
+	if m.cursor < 0 {
+		m.cursor = 0
+	}
+	if m.cursor >= len(m.visible) {
+		m.cursor = len(m.visible) - 1
+	}
+}
+
+// Detail returns the detail text for the selected item, loading it on first
+// use. Load failures are shown in place of the details.
+func (m *Model) Detail() string {
+	if len(m.visible) == 0 {
+		return ""
+	}
+	idx := m.visible[m.cursor]
+	if text, ok := m.details[idx]; ok {
+		return text
+	}
+	item := m.items[idx]
+	text := fmt.Sprintf("%s %s (%s)\n%s", item.Name, item.Version, item.Source, item.Description)
+	if m.load != nil {
+		loaded, err := m.load(item)
+		if err != nil {
+			text += fmt.Sprintf("\n\nMetadata unavailable: %v", err)
+		} else {
+			text = loaded
+		}
+	}
+	m.details[idx] = text
+	return text
+}
+
+// Screen chrome: the filter line, two rules and the help line.
+const chromeLines = 4
+
+// listHeight returns the number of list rows: half the screen below the
+// filter line, leaving the rest to the detail pane.
+func (m *Model) listHeight() int {
+	h := (m.height - chromeLines) / 2
+	if h < 1 {
+		h = 1
+	}
+	return h
+}
+
+// View renders the screen: the filter line, the list, the detail pane and a
+// help line, each line cut to the screen width.
+func (m *Model) View() string {
+	var lines []string
+	lines = append(lines, fmt.Sprintf("Filter: %s_  (%d/%d tools)", m.filter, len(m.visible), len(m.items)))
+	lines = append(lines, strings.Repeat("-", m.width))
+
+	// Scroll the list just far enough to keep the selection on screen
+	rows := m.listHeight()
+	offset := 0
+	if m.cursor >= rows {
+		offset = m.cursor - rows + 1
+	}
+	nameWidth := 0
+	for _, idx := range m.visible {
+		if n := len([]rune(m.items[idx].Name)); n > nameWidth {
+			nameWidth = n
+		}
+	}
+	if nameWidth > 24 {
+		nameWidth = 24
+	}
+	for row := 0; row < rows; row++ {
+		i := offset + row
+		if i >= len(m.visible) {
+			lines = append(lines, "")
+			continue
+		}
+		item := m.items[m.visible[i]]
+		marker := "  "
+		if i == m.cursor {
+			marker = "> "
+		}
+		lines = append(lines, fmt.Sprintf("%s%-*s  %-10s  %-8s  %s", marker, nameWidth, truncate(item.Name, nameWidth), item.Version, item.Source, item.Description))
+	}
+	if len(m.items) == 0 {
+		lines[2] = "  No tools"
+	} else if len(m.visible) == 0 {
+		lines[2] = "  No tools match the filter"
+	}
+
+	lines = append(lines, strings.Repeat("-", m.width))
+	detailRows := m.height - chromeLines - rows
+	detail := strings.Split(m.Detail(), "\n")
+	for row := 0; row < detailRows; row++ {
+		if row < len(detail) {
+			lines = append(lines, detail[row])
+		} else {
+			lines = append(lines, "")
+		}
+	}
+	lines = append(lines, "type to filter, up/down to select, esc to clear or quit, ctrl-c to quit")
+
+	for i, line := range lines {
+		lines[i] = truncate(line, m.width)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// truncate cuts s to at most width runes.
+func truncate(s string, width int) string {
+	r := []rune(s)
+	if len(r) <= width {
+		return s
+	}
+	if width < 1 {
+		return ""
+	}
+	return string(r[:width])
+}
@@ -0,0 +1,154 @@
+package tui
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func testItems() []Item {
+	return []Item{
+		{Name: "gh", Version: "2.40.0", Source: "native", Description: "GitHub CLI"},
+		{Name: "git", Version: "2.43.0", Source: "shim", Description: "Version control"},
+		{Name: "kubectl", Version: "1.29.0", Source: "shim", Description: "Kubernetes CLI"},
+	}
+}
+
+func visibleNames(m *Model) []string {
+	var names []string
+	for _, item := range m.Visible() {
+		names = append(names, item.Name)
+	}
+	return names
+}
+
+func TestModel_Filter(t *testing.T) {
+	loads := 0
+	m := NewModel(testItems(), func(item Item) (string, error) {
+		loads++
+		if item.Name == "kubectl" {
+			return "", errors.New("no cached metadata")
+		}
+		return item.Name + " details\nCommands:\n  status", nil
+	})
+
+	m.Update(Key{Type: KeyDown})
+	if item, _ := m.Selected(); item.Name != "git" {
+		t.Fatalf("Selected() = %q after down, want git", item.Name)
+	}
+
+	for _, k := range ParseKeys([]byte("GI")) {
+		m.Update(k)
+	}
+	if got := visibleNames(m); !reflect.DeepEqual(got, []string{"git"}) {
+		t.Errorf("Visible() = %v for filter %q, want [git]", got, m.Filter())
+	}
+	view := m.View()
+	if !strings.Contains(view, "Filter: GI_  (1/3 tools)") {
+		t.Errorf("View() missing filter line:\n%s", view)
+	}
+	if !strings.Contains(view, "git details") {
+		t.Errorf("View() missing detail pane:\n%s", view)
+	}
+
+	// Editing the filter keeps the selection and reuses loaded details
+	m.Update(Key{Type: KeyBackspace})
+	if got := visibleNames(m); !reflect.DeepEqual(got, []string{"gh", "git"}) {
+		t.Errorf("Visible() = %v after backspace, want [gh git]", got)
+	}
+	if item, _ := m.Selected(); item.Name != "git" {
+		t.Errorf("Selected() = %q after backspace, want git", item.Name)
+	}
+	m.View()
+	if loads != 1 {
+		t.Errorf("detail loaded %d times, want 1", loads)
+	}
+
+	m.Update(Key{Type: KeyRune, Rune: 'x'})
+	if !strings.Contains(m.View(), "No tools match") {
+		t.Errorf("View() with no matches:\n%s", m.View())
+	}
+
+	m.Update(Key{Type: KeyEscape})
+	if m.Filter() != "" || m.Done() {
+		t.Fatalf("Escape with a filter: Filter() = %q, Done() = %v; want cleared, not done", m.Filter(), m.Done())
+	}
+	m.Update(Key{Type: KeyPageDown})
+	if !strings.Contains(m.View(), "Metadata unavailable: no cached metadata") {
+		t.Errorf("View() missing load error:\n%s", m.View())
+	}
+	m.Update(Key{Type: KeyEscape})
+	if !m.Done() {
+		t.Error("Escape with an empty filter should quit")
+	}
+}
+
+func TestModel_ViewFitsScreen(t *testing.T) {
+	m := NewModel(testItems(), nil)
+	m.Resize(30, 10)
+	lines := strings.Split(m.View(), "\n")
+	if len(lines) != 10 {
+		t.Errorf("View() has %d lines, want 10", len(lines))
+	}
+	for _, line := range lines {
+		if len([]rune(line)) > 30 {
+			t.Errorf("line %q is wider than 30", line)
+		}
+	}
+}
+
+func TestParseKeys(t *testing.T) {
+	got := ParseKeys([]byte("a\x1b[A\x1b[B\x1b[5~\x1b[6~\x1b[C\x7f\x15\x03é\x1b"))
+	want := []Key{
+		{Type: KeyRune, Rune: 'a'},
+		{Type: KeyUp},
+		{Type: KeyDown},
+		{Type: KeyPageUp},
+		{Type: KeyPageDown},
+		{Type: KeyBackspace},
+		{Type: KeyClear},
+		{Type: KeyInterrupt},
+		{Type: KeyRune, Rune: 'é'},
+		{Type: KeyEscape},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseKeys() = %v, want %v", got, want)
+	}
+}
+
+func TestParseKeys_Sequences(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []Key
+	}{
+		{"empty", "", nil},
+		{"CSI arrows", "\x1b[A\x1b[B", []Key{{Type: KeyUp}, {Type: KeyDown}}},
+		{"SS3 arrows", "\x1bOA\x1bOB", []Key{{Type: KeyUp}, {Type: KeyDown}}},
+		{"page keys", "\x1b[5~\x1b[6~", []Key{{Type: KeyPageUp}, {Type: KeyPageDown}}},
+		{"emacs keys", "\x10\x0e", []Key{{Type: KeyUp}, {Type: KeyDown}}},
+		{"both backspaces", "\x7f\x08", []Key{{Type: KeyBackspace}, {Type: KeyBackspace}}},
+		{"unbound sequences", "\x1b[C\x1b[D\x1b[H\x1b[3~\x1bOP", nil},
+		{"sequence with parameters", "\x1b[1;5A\x1b[1;2B", nil},
+		{"keys around an unbound sequence", "a\x1b[1;5Cb", []Key{{Type: KeyRune, Rune: 'a'}, {Type: KeyRune, Rune: 'b'}}},
+		{"unbound control characters", "\t\r\n\x00\x1f", nil},
+		{"lone escape", "\x1b", []Key{{Type: KeyEscape}}},
+		{"escapes", "\x1b\x1b", []Key{{Type: KeyEscape}, {Type: KeyEscape}}},
+		{"escape then rune", "\x1bq", []Key{{Type: KeyEscape}, {Type: KeyRune, Rune: 'q'}}},
+		{"truncated sequence", "a\x1b[1;", []Key{{Type: KeyRune, Rune: 'a'}}},
+		{"multi-byte runes", "é日🙂", []Key{{Type: KeyRune, Rune: 'é'}, {Type: KeyRune, Rune: '日'}, {Type: KeyRune, Rune: '🙂'}}},
+		{"invalid UTF-8", "a\xff\xc3b", []Key{{Type: KeyRune, Rune: 'a'}, {Type: KeyRune, Rune: 'b'}}},
+		{"truncated rune", "\xe6\x97", nil},
+		{"interrupt and clear", "\x03\x15", []Key{{Type: KeyInterrupt}, {Type: KeyClear}}},
+		{"space and punctuation", " /-", []Key{{Type: KeyRune, Rune: ' '}, {Type: KeyRune, Rune: '/'}, {Type: KeyRune, Rune: '-'}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ParseKeys([]byte(tt.input)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseKeys(%q) = %v, want %v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
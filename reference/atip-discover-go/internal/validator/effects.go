@@ -0,0 +1,126 @@
+package validator
+
+import "sort"
+
+// Effect badges summarizing what a tool's commands do.
+const (
+	BadgeNetwork     = "network"
+	BadgeDestructive = "destructive"
+	BadgeWrite       = "write"
+	BadgeReadOnly    = "read-only" // Effects are declared but none of the above
+)
+
+// FileWrite is a command that writes to or deletes from the filesystem.
+type FileWrite struct {
+	Command string   `json:"command"`
+	Paths   []string `json:"paths,omitempty"`
+}
+
+// EffectsSummary flattens the effects declared across a tool's command tree.
+// Commands are identified by their space-separated path, e.g. "pr merge".
+type EffectsSummary struct {
+	Name        string      `json:"name"`
+	Version     string      `json:"version"`
+	Commands    int         `json:"commands"` // Commands declaring effects
+	Network     []string    `json:"network"`
+	Destructive []string    `json:"destructive"`
+	Writes      []FileWrite `json:"filesystem_write"`
+	Badges      []string    `json:"badges"`
+
+	// For partial metadata, the summary only covers the included commands;
+	// SafetyAssumption says how to treat the others (see OmittedSafety)
+	Partial          bool   `json:"partial,omitempty"`
+	SafetyAssumption string `json:"safety_assumption,omitempty"`
+}
+
+// Effects walks the metadata's commands, including nested commands, and
+// summarizes which command paths touch the network, are destructive, or
+// write to or delete from the filesystem. Commands are visited in path
+// order, so the summary is deterministic.
+func (m *AtipMetadata) Effects() *EffectsSummary {
+	summary := &EffectsSummary{
+		Name:        m.Name,
+		Version:     m.Version,
+		Network:     []string{},
+		Destructive: []string{},
+		Writes:      []FileWrite{},
+
+		Partial:          m.Partial,
+		SafetyAssumption: m.OmittedSafety(),
+	}
+	summary.walk("", m.Commands)
+	summary.Badges = summary.badges()
+	return summary
+}
+
+// walk adds the effects of commands, whose paths are prefixed with prefix,
+// and recurses into their nested commands.
+func (s *EffectsSummary) walk(prefix string, commands map[string]interface{}) {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		cmd, ok := commands[name].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		path := name
+		if prefix != "" {
+			path = prefix + " " + name
+		}
+
+		// Parent commands may declare effects of their own
+		if effects, ok := cmd["effects"].(map[string]interface{}); ok {
+			s.Commands++
+			if effects["network"] == true {
+				s.Network = append(s.Network, path)
+			}
+			if effects["destructive"] == true {
+				s.Destructive = append(s.Destructive, path)
+			}
+			if fs, ok := effects["filesystem"].(map[string]interface{}); ok && (fs["write"] == true || fs["delete"] == true) {
+				s.Writes = append(s.Writes, FileWrite{Command: path, Paths: stringSlice(fs["paths"])})
+			}
+		}
+
+		if nested, ok := cmd["commands"].(map[string]interface{}); ok {
+			s.walk(path, nested)
+		}
+	}
+}
+
+// badges returns the compact badge set for the summary: one badge per kind
+// of effect present, BadgeReadOnly if commands declare effects but none of
+// them count, or an empty set if no command declares effects.
+func (s *EffectsSummary) badges() []string {
+	badges := []string{}
+	if len(s.Network) > 0 {
+		badges = append(badges, BadgeNetwork)
+	}
+	if len(s.Destructive) > 0 {
+		badges = append(badges, BadgeDestructive)
+	}
+	if len(s.Writes) > 0 {
+		badges = append(badges, BadgeWrite)
+	}
+	if len(badges) == 0 && s.Commands > 0 {
+		badges = append(badges, BadgeReadOnly)
+	}
+	return badges
+}
+
+// stringSlice returns the strings in a decoded JSON array, skipping other
+// values.
+func stringSlice(v interface{}) []string {
+	items, _ := v.([]interface{})
+	var out []string
+	for _, item := range items {
+		if s, ok := item.(string); ok {
+			out = append(out, s)
+		}
+	}
+	return out
+}
@@ -0,0 +1,108 @@
+package validator
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAtipMetadata_Effects(t *testing.T) {
+	data := `{
+		"atip": {"version": "0.6"},
+		"name": "gh",
+		"version": "2.45.0",
+		"description": "GitHub CLI",
+		"commands": {
+			"pr": {
+				"description": "Manage pull requests",
+				"commands": {
+					"list": {"description": "List PRs", "effects": {"network": true, "filesystem": {"read": true, "write": false}}},
+					"merge": {"description": "Merge a PR", "effects": {"network": true, "destructive": true}},
+					"checkout": {"description": "Check out a PR", "effects": {"network": true, "filesystem": {"write": true, "paths": ["./"]}}}
+				}
+			},
+			"repo": {
+				"description": "Manage repositories",
+				"effects": {"network": false},
+				"commands": {
+					"delete": {"description": "Delete a repository", "effects": {"network": true, "destructive": true}},
+					"clean": {"description": "Remove local clones", "effects": {"filesystem": {"delete": true, "paths": ["~/src/", 42]}}}
+				}
+			},
+			"version": {"description": "Print version", "effects": {"network": false}}
+		}
+	}`
+	var metadata AtipMetadata
+	require.NoError(t, json.Unmarshal([]byte(data), &metadata))
+
+	summary := metadata.Effects()
+	assert.Equal(t, "gh", summary.Name)
+	assert.Equal(t, "2.45.0", summary.Version)
+	assert.Equal(t, 7, summary.Commands)
+	assert.Equal(t, []string{"pr checkout", "pr list", "pr merge", "repo delete"}, summary.Network)
+	assert.Equal(t, []string{"pr merge", "repo delete"}, summary.Destructive)
+	assert.Equal(t, []FileWrite{
+		{Command: "pr checkout", Paths: []string{"./"}},
+		{Command: "repo clean", Paths: []string{"~/src/"}},
+	}, summary.Writes)
+	assert.Equal(t, []string{BadgeNetwork, BadgeDestructive, BadgeWrite}, summary.Badges)
+}
+
+func TestAtipMetadata_Effects_Badges(t *testing.T) {
+	tests := []struct {
+		name     string
+		commands map[string]interface{}
+		want     []string
+	}{
+		{
+			name:     "no commands",
+			commands: nil,
+			want:     []string{},
+		},
+		{
+			name: "no declared effects",
+			commands: map[string]interface{}{
+				"run": map[string]interface{}{"description": "Run", "commands": map[string]interface{}{}},
+			},
+			want: []string{},
+		},
+		{
+			name: "read-only",
+			commands: map[string]interface{}{
+				"show": map[string]interface{}{"effects": map[string]interface{}{"network": false, "filesystem": map[string]interface{}{"read": true}}},
+			},
+			want: []string{BadgeReadOnly},
+		},
+		{
+			name: "nested network",
+			commands: map[string]interface{}{
+				"remote": map[string]interface{}{"commands": map[string]interface{}{
+					"fetch": map[string]interface{}{"effects": map[string]interface{}{"network": true}},
+				}},
+			},
+			want: []string{BadgeNetwork},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metadata := AtipMetadata{Name: "tool", Commands: tt.commands}
+			assert.Equal(t, tt.want, metadata.Effects().Badges)
+		})
+	}
+}
+
+func TestAtipMetadata_Effects_Partial(t *testing.T) {
+	complete := &AtipMetadata{Name: "gh", Version: "2.45.0"}
+	data, err := json.Marshal(complete.Effects())
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "partial")
+	assert.NotContains(t, string(data), "safety_assumption")
+
+	partial := &AtipMetadata{Name: "kubectl", Version: "1.28.0", Partial: true, Omitted: &Omitted{Reason: "filtered", SafetyAssumption: "known-unsafe"}}
+	summary := partial.Effects()
+	assert.True(t, summary.Partial)
+	assert.Equal(t, "known-unsafe", summary.SafetyAssumption)
+}
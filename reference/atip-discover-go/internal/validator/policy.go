@@ -0,0 +1,198 @@
+package validator
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Built-in policy rules, selected by name in a policy file.
+const (
+	RuleRequireEffects            = "require-effects"              // Every command, parents included, declares effects
+	RuleRequireHomepageForNetwork = "require-homepage-for-network" // Tools with network commands have a homepage
+	RuleBanCommandNames           = "ban-command-names"            // No command has one of the listed names
+)
+
+// PolicyRules lists the built-in rules.
+var PolicyRules = []string{RuleRequireEffects, RuleRequireHomepageForNetwork, RuleBanCommandNames}
+
+// Policy is an organization-specific check run on metadata after it passes
+// schema validation. Check returns one ValidationError per violation;
+// the Validator sets their Rule to the policy's Name.
+type Policy interface {
+	Name() string
+	Check(metadata *AtipMetadata) []ValidationError
+}
+
+// PolicyRule configures one built-in rule in a policy file.
+type PolicyRule struct {
+	Rule  string   `json:"rule"`
+	Names []string `json:"names,omitempty"` // Command names, for ban-command-names
+}
+
+// PolicyFile is the JSON policy file read by LoadPolicy, e.g.
+//
+//	{"rules": [{"rule": "require-effects"}, {"rule": "ban-command-names", "names": ["eval"]}]}
+type PolicyFile struct {
+	Rules []PolicyRule `json:"rules"`
+}
+
+// LoadPolicy reads a policy file and returns its rules as policies, in file
+// order. It fails on unknown rules and on fields a rule doesn't take.
+func LoadPolicy(path string) ([]Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read policy: %w", err)
+	}
+	var file PolicyFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("invalid policy %s: %w", path, err)
+	}
+
+	policies := make([]Policy, 0, len(file.Rules))
+	for i, rule := range file.Rules {
+		policy, err := rule.policy()
+		if err != nil {
+			return nil, fmt.Errorf("invalid policy %s: rules[%d]: %w", path, i, err)
+		}
+		policies = append(policies, policy)
+	}
+	return policies, nil
+}
+
+// policy returns the built-in Policy the rule selects.
+func (r PolicyRule) policy() (Policy, error) {
+	if r.Rule != RuleBanCommandNames && len(r.Names) > 0 {
+		return nil, fmt.Errorf("rule %q doesn't take names", r.Rule)
+	}
+	switch r.Rule {
+	case RuleRequireEffects:
+		return requireEffects{}, nil
+	case RuleRequireHomepageForNetwork:
+		return requireHomepageForNetwork{}, nil
+	case RuleBanCommandNames:
+		if len(r.Names) == 0 {
+			return nil, fmt.Errorf("rule %q requires names", r.Rule)
+		}
+		banned := make(map[string]bool, len(r.Names))
+		for _, name := range r.Names {
+			banned[name] = true
+		}
+		return banCommandNames{banned: banned}, nil
+	case "":
+		return nil, fmt.Errorf("rule is required")
+	}
+	return nil, fmt.Errorf("unknown rule %q (expected one of %s)", r.Rule, strings.Join(PolicyRules, ", "))
+}
+
+// NewWithPolicy creates a validator for the embedded schema that also
+// enforces the rules in the policy file at policyPath.
+func NewWithPolicy(policyPath string) (*Validator, error) {
+	policies, err := LoadPolicy(policyPath)
+	if err != nil {
+		return nil, err
+	}
+	v, err := New()
+	if err != nil {
+		return nil, err
+	}
+	return v.WithPolicies(policies...), nil
+}
+
+// WithPolicies returns a copy of the validator that also runs policies, in
+// order, after schema validation. Policies only see metadata that passed
+// the schema.
+func (v *Validator) WithPolicies(policies ...Policy) *Validator {
+	combined := make([]Policy, 0, len(v.policies)+len(policies))
+	combined = append(combined, v.policies...)
+	combined = append(combined, policies...)
+	return &Validator{schemaPath: v.schemaPath, schema: v.schema, policies: combined}
+}
+
+// checkPolicies runs the validator's policies, recording each violation
+// with the rule that found it.
+func (v *Validator) checkPolicies(c *checker, metadata *AtipMetadata) {
+	for _, policy := range v.policies {
+		for _, violation := range policy.Check(metadata) {
+			violation.Rule = policy.Name()
+			c.errs = append(c.errs, violation)
+			if c.stopped() {
+				return
+			}
+		}
+	}
+}
+
+// walkCommands calls fn for every command, including nested commands, in
+// path order. field is the command's field path, e.g. "commands.pr.commands.merge".
+func walkCommands(prefix string, commands map[string]interface{}, fn func(field, name string, cmd map[string]interface{})) {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		cmd, ok := commands[name].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		field := prefix + "." + name
+		fn(field, name, cmd)
+		if nested, ok := cmd["commands"].(map[string]interface{}); ok {
+			walkCommands(field+".commands", nested, fn)
+		}
+	}
+}
+
+// requireEffects requires every command to declare effects. The schema only
+// requires them of commands without nested commands.
+type requireEffects struct{}
+
+func (requireEffects) Name() string { return RuleRequireEffects }
+
+func (requireEffects) Check(metadata *AtipMetadata) []ValidationError {
+	var violations []ValidationError
+	walkCommands("commands", metadata.Commands, func(field, name string, cmd map[string]interface{}) {
+		if _, ok := cmd["effects"].(map[string]interface{}); !ok {
+			violations = append(violations, ValidationError{Field: field, Message: "command must declare effects"})
+		}
+	})
+	return violations
+}
+
+// requireHomepageForNetwork requires tools with a command that touches the
+// network to have a homepage.
+type requireHomepageForNetwork struct{}
+
+func (requireHomepageForNetwork) Name() string { return RuleRequireHomepageForNetwork }
+
+func (requireHomepageForNetwork) Check(metadata *AtipMetadata) []ValidationError {
+	network := metadata.Effects().Network
+	if len(network) == 0 || metadata.Homepage != "" {
+		return nil
+	}
+	return []ValidationError{{
+		Field:   "homepage",
+		Message: fmt.Sprintf("required for tools with network commands (%s)", strings.Join(network, ", ")),
+	}}
+}
+
+// banCommandNames rejects commands, at any depth, with a banned name.
+type banCommandNames struct {
+	banned map[string]bool
+}
+
+func (banCommandNames) Name() string { return RuleBanCommandNames }
+
+func (p banCommandNames) Check(metadata *AtipMetadata) []ValidationError {
+	var violations []ValidationError
+	walkCommands("commands", metadata.Commands, func(field, name string, cmd map[string]interface{}) {
+		if p.banned[name] {
+			violations = append(violations, ValidationError{Field: field, Message: fmt.Sprintf("command name %q is banned", name)})
+		}
+	})
+	return violations
+}
@@ -0,0 +1,127 @@
+package validator
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writePolicy writes a policy file and returns a validator enforcing it
+func writePolicy(t *testing.T, policy string) (*Validator, error) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "policy.json")
+	require.NoError(t, os.WriteFile(path, []byte(policy), 0644))
+	return NewWithPolicy(path)
+}
+
+// policyMetadata has a parent command without effects of its own, under
+// which a leaf command touches the network
+const policyMetadata = `{
+	"atip": {"version": "0.6"},
+	"name": "gh",
+	"version": "2.45.0",
+	"description": "GitHub CLI",
+	"commands": {
+		"pr": {
+			"description": "Manage pull requests",
+			"commands": {
+				"merge": {"description": "Merge a pull request", "effects": {"network": true}}
+			}
+		},
+		"version": {"description": "Show the version", "effects": {"network": false}}
+	}
+}`
+
+func TestPolicy_RequireEffects(t *testing.T) {
+	v, err := writePolicy(t, `{"rules": [{"rule": "require-effects"}]}`)
+	require.NoError(t, err)
+
+	_, err = v.Validate([]byte(policyMetadata))
+	require.Error(t, err)
+	var verr *ValidationError
+	require.ErrorAs(t, err, &verr)
+	assert.Equal(t, RuleRequireEffects, verr.Rule)
+	assert.Equal(t, "commands.pr", verr.Field)
+	assert.Equal(t, "policy violation (require-effects) on field 'commands.pr': command must declare effects", verr.Error())
+
+	// The schema alone accepts the parent command
+	plain, err := New()
+	require.NoError(t, err)
+	_, err = plain.Validate([]byte(policyMetadata))
+	assert.NoError(t, err)
+}
+
+func TestPolicy_RequireHomepageForNetwork(t *testing.T) {
+	v, err := writePolicy(t, `{"rules": [{"rule": "require-homepage-for-network"}]}`)
+	require.NoError(t, err)
+
+	errs, err := v.ValidateAll([]byte(policyMetadata))
+	require.NoError(t, err)
+	require.Len(t, errs, 1)
+	assert.Equal(t, RuleRequireHomepageForNetwork, errs[0].Rule)
+	assert.Equal(t, "homepage", errs[0].Field)
+	assert.Contains(t, errs[0].Message, "pr merge")
+
+	metadata, err := ParseJSON([]byte(policyMetadata))
+	require.NoError(t, err)
+	metadata.Homepage = "https://cli.github.com"
+	assert.NoError(t, v.ValidateMetadata(metadata))
+
+	// Tools without network commands don't need a homepage
+	metadata.Homepage = ""
+	delete(metadata.Commands, "pr")
+	assert.NoError(t, v.ValidateMetadata(metadata))
+}
+
+func TestPolicy_ChainReportsEveryRule(t *testing.T) {
+	v, err := writePolicy(t, `{"rules": [
+		{"rule": "require-effects"},
+		{"rule": "require-homepage-for-network"},
+		{"rule": "ban-command-names", "names": ["merge", "eval"]}
+	]}`)
+	require.NoError(t, err)
+
+	errs, err := v.ValidateAll([]byte(policyMetadata))
+	require.NoError(t, err)
+	var got [][2]string
+	for _, e := range errs {
+		got = append(got, [2]string{e.Rule, e.Field})
+	}
+	assert.Equal(t, [][2]string{
+		{RuleRequireEffects, "commands.pr"},
+		{RuleRequireHomepageForNetwork, "homepage"},
+		{RuleBanCommandNames, "commands.pr.commands.merge"},
+	}, got)
+}
+
+func TestPolicy_SkippedForSchemaErrors(t *testing.T) {
+	v, err := writePolicy(t, `{"rules": [{"rule": "require-effects"}]}`)
+	require.NoError(t, err)
+
+	errs, err := v.ValidateAll([]byte(`{"atip": {"version": "0.6"}, "name": "x", "version": "1.0.0", "commands": {"a": {}}}`))
+	require.NoError(t, err)
+	for _, e := range errs {
+		assert.Empty(t, e.Rule, e.Error())
+	}
+}
+
+func TestLoadPolicy_Invalid(t *testing.T) {
+	for name, policy := range map[string]string{
+		"not json":        `{"rules": [`,
+		"unknown rule":    `{"rules": [{"rule": "require-license"}]}`,
+		"missing rule":    `{"rules": [{}]}`,
+		"ban needs names": `{"rules": [{"rule": "ban-command-names"}]}`,
+		"unexpected name": `{"rules": [{"rule": "require-effects", "names": ["eval"]}]}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := writePolicy(t, policy)
+			assert.Error(t, err)
+		})
+	}
+
+	_, err := NewWithPolicy(filepath.Join(t.TempDir(), "missing.json"))
+	assert.Error(t, err)
+}
@@ -3,33 +3,325 @@
 package validator
 
 import (
+	_ "embed"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// embeddedSchema is the ATIP JSON schema, copied from schema/0.6.json at the
+// repository root (see `make schema`).
+//
+//go:embed schema.json
+var embeddedSchema []byte
+
+// SchemaVersion is the ATIP version of the embedded schema.
+const SchemaVersion = "0.6"
+
+// Schema returns the embedded JSON Schema for the given ATIP version. Only
+// SchemaVersion is available.
+func Schema(version string) ([]byte, error) {
+	if version != SchemaVersion {
+		return nil, fmt.Errorf("no schema for ATIP version %q (available: %s)", version, SchemaVersion)
+	}
+	return append([]byte(nil), embeddedSchema...), nil
+}
+
+// semverRegex matches a semantic version (https://semver.org), without a leading "v".
+var semverRegex = regexp.MustCompile(`^(0|[1-9]\d*)\.(0|[1-9]\d*)\.(0|[1-9]\d*)` +
+	`(?:-((?:0|[1-9]\d*|\d*[a-zA-Z-][0-9a-zA-Z-]*)(?:\.(?:0|[1-9]\d*|\d*[a-zA-Z-][0-9a-zA-Z-]*))*))?` +
+	`(?:\+([0-9a-zA-Z-]+(?:\.[0-9a-zA-Z-]+)*))?$`)
+
+var (
+	defaultOnce      sync.Once
+	defaultSchema    *compiledSchema
+	defaultSchemaErr error
+	defaultValidator *Validator
 )
 
 // AtipMetadata represents the ATIP metadata structure.
 type AtipMetadata struct {
-	Atip        interface{}            `json:"atip"`
-	Name        string                 `json:"name"`
-	Version     string                 `json:"version"`
-	Description string                 `json:"description"`
-	Commands    map[string]interface{} `json:"commands,omitempty"`
+	Atip          interface{}            `json:"atip"`
+	Name          string                 `json:"name"`
+	Version       string                 `json:"version"`
+	Description   string                 `json:"description"`
+	Homepage      string                 `json:"homepage,omitempty"`
+	Binary        *BinaryInfo            `json:"binary,omitempty"`
+	Partial       bool                   `json:"partial,omitempty"` // Not a complete description of the tool
+	Omitted       *Omitted               `json:"omitted,omitempty"` // What partial metadata leaves out
+	Trust         *TrustInfo             `json:"trust,omitempty"`
+	GlobalOptions []interface{}          `json:"globalOptions,omitempty"`
+	Commands      map[string]interface{} `json:"commands,omitempty"`
+}
+
+// AtipVersion returns the ATIP spec version the metadata declares, from
+// either the legacy string form or the object form of the atip field.
+// It returns "" if there is none.
+func (m *AtipMetadata) AtipVersion() string {
+	switch a := m.Atip.(type) {
+	case string:
+		return a
+	case map[string]interface{}:
+		version, _ := a["version"].(string)
+		return version
+	}
+	return ""
+}
+
+// NormalizeAtip upconverts the legacy string form of the atip field
+// ("atip": "0.3") to the object form ("atip": {"version": "0.3"}), so
+// consumers of stored metadata only see one shape.
+func (m *AtipMetadata) NormalizeAtip() {
+	if version, ok := m.Atip.(string); ok {
+		m.Atip = map[string]interface{}{"version": version}
+	}
+}
+
+// BinaryInfo identifies the binary a piece of metadata describes.
+type BinaryInfo struct {
+	Hash     string `json:"hash,omitempty"`
+	Name     string `json:"name,omitempty"`
+	Version  string `json:"version,omitempty"`
+	Platform string `json:"platform,omitempty"` // e.g. "darwin-arm64"
+}
+
+// Trust sources a metadata document can declare.
+const (
+	TrustSourceNative   = "native"
+	TrustSourceInferred = "inferred" // Generated, e.g. from --help output
+)
+
+// SafetyAssumptionUnknown is how agents must treat commands omitted from
+// partial metadata that doesn't declare a safety assumption.
+const SafetyAssumptionUnknown = "unknown"
+
+// Omitted explains what partial metadata leaves out and how agents should
+// treat commands that aren't in it.
+type Omitted struct {
+	Reason           string `json:"reason,omitempty"`           // filtered, depth-limited, size-limited or deprecated
+	SafetyAssumption string `json:"safetyAssumption,omitempty"` // unknown, known-safe, known-unsafe or same-as-included
+}
+
+// OmittedSafety returns the safety assumption for commands omitted from
+// partial metadata, SafetyAssumptionUnknown if it declares none, or "" for
+// complete metadata.
+func (m *AtipMetadata) OmittedSafety() string {
+	if !m.Partial {
+		return ""
+	}
+	if m.Omitted == nil || m.Omitted.SafetyAssumption == "" {
+		return SafetyAssumptionUnknown
+	}
+	return m.Omitted.SafetyAssumption
+}
+
+// TrustSourceUnknown is reported by TrustSummary for metadata without a
+// trust block. It is never declared by metadata itself.
+const TrustSourceUnknown = "unknown"
+
+// TrustInfo describes where metadata came from.
+type TrustInfo struct {
+	Source     string           `json:"source,omitempty"` // One of the TrustSource constants, or vendor, org, community or user
+	Verified   bool             `json:"verified"`
+	Integrity  *TrustIntegrity  `json:"integrity,omitempty"`
+	Provenance *TrustProvenance `json:"provenance,omitempty"`
+}
+
+// TrustIntegrity declares how to verify the tool's binary (trust.integrity).
+type TrustIntegrity struct {
+	Checksum  string          `json:"checksum,omitempty"`
+	Signature *TrustSignature `json:"signature,omitempty"`
+}
+
+// TrustSignature identifies a Sigstore, GPG or minisign signature.
+type TrustSignature struct {
+	Type     string `json:"type,omitempty"` // cosign, gpg or minisign
+	Identity string `json:"identity,omitempty"`
+	Issuer   string `json:"issuer,omitempty"`
+	Bundle   string `json:"bundle,omitempty"`
+}
+
+// TrustProvenance points to a build attestation (trust.provenance).
+type TrustProvenance struct {
+	URL       string `json:"url,omitempty"`
+	Format    string `json:"format,omitempty"` // slsa-provenance-v1 or in-toto
+	SLSALevel int    `json:"slsaLevel,omitempty"`
+	Builder   string `json:"builder,omitempty"`
+}
+
+// TrustSummary condenses a metadata document's trust block for listing.
+type TrustSummary struct {
+	Source     string `json:"trust_source"`         // TrustSourceUnknown without a trust block
+	Verified   bool   `json:"verified"`             // As declared by trust.verified
+	Signature  string `json:"signature,omitempty"`  // Signature type in trust.integrity, e.g. "cosign"
+	Provenance string `json:"provenance,omitempty"` // Attestation format in trust.provenance
+}
+
+// TrustSummary reports the metadata's trust source, whether it claims to be
+// verified, and which signature and attestation it declares. The source is
+// TrustSourceUnknown if there is no trust block or it names no source.
+func (m *AtipMetadata) TrustSummary() TrustSummary {
+	summary := TrustSummary{Source: TrustSourceUnknown}
+	if m == nil || m.Trust == nil {
+		return summary
+	}
+	if m.Trust.Source != "" {
+		summary.Source = m.Trust.Source
+	}
+	summary.Verified = m.Trust.Verified
+	if m.Trust.Integrity != nil && m.Trust.Integrity.Signature != nil {
+		summary.Signature = m.Trust.Integrity.Signature.Type
+	}
+	if m.Trust.Provenance != nil {
+		summary.Provenance = m.Trust.Provenance.Format
+	}
+	return summary
 }
 
 // Validator validates ATIP metadata against the schema.
+// A Validator is immutable once created and safe for concurrent use.
 type Validator struct {
 	schemaPath string
+	schema     *compiledSchema
+	policies   []Policy // Run after the schema checks, see WithPolicies
+}
+
+// compiledSchema holds the constraints extracted from an ATIP JSON schema.
+type compiledSchema struct {
+	versionPattern    *regexp.Regexp  // Allowed values for the atip version
+	paramTypes        map[string]bool // Allowed option and argument types
+	omittedReasons    map[string]bool // Allowed omitted.reason values, nil for any
+	safetyAssumptions map[string]bool // Allowed omitted.safetyAssumption values, nil for any
+}
+
+// Default returns a shared validator for the embedded schema.
+// The schema is compiled on first use and reused by every later call.
+func Default() (*Validator, error) {
+	defaultOnce.Do(func() {
+		defaultSchema, defaultSchemaErr = compileSchema(embeddedSchema)
+		if defaultSchemaErr == nil {
+			defaultValidator = &Validator{schema: defaultSchema}
+		}
+	})
+	if defaultSchemaErr != nil {
+		return nil, defaultSchemaErr
+	}
+	return defaultValidator, nil
 }
 
-// New creates a new validator.
+// New creates a new validator for the embedded schema.
+// The compiled schema is shared with Default rather than recompiled.
 func New() (*Validator, error) {
-	return &Validator{}, nil
+	d, err := Default()
+	if err != nil {
+		return nil, err
+	}
+	return &Validator{schema: d.schema}, nil
 }
 
 // NewWithSchema creates a validator with a custom schema path.
+// The schema file is read and compiled for this validator only.
 func NewWithSchema(schemaPath string) (*Validator, error) {
-	return &Validator{schemaPath: schemaPath}, nil
+	data, err := os.ReadFile(schemaPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema: %w", err)
+	}
+
+	schema, err := compileSchema(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Validator{schemaPath: schemaPath, schema: schema}, nil
+}
+
+// compileSchema extracts the constraints the validator enforces from a JSON schema.
+func compileSchema(data []byte) (*compiledSchema, error) {
+	var raw struct {
+		Properties struct {
+			Atip struct {
+				OneOf []struct {
+					Type       string `json:"type"`
+					Pattern    string `json:"pattern"`
+					Properties struct {
+						Version struct {
+							Pattern string `json:"pattern"`
+						} `json:"version"`
+					} `json:"properties"`
+				} `json:"oneOf"`
+			} `json:"atip"`
+			Omitted struct {
+				Properties struct {
+					Reason struct {
+						Enum []string `json:"enum"`
+					} `json:"reason"`
+					SafetyAssumption struct {
+						Enum []string `json:"enum"`
+					} `json:"safetyAssumption"`
+				} `json:"properties"`
+			} `json:"omitted"`
+		} `json:"properties"`
+		Definitions struct {
+			ParamType struct {
+				Enum []string `json:"enum"`
+			} `json:"paramType"`
+		} `json:"definitions"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("invalid schema: %w", err)
+	}
+
+	pattern := ""
+	for _, alt := range raw.Properties.Atip.OneOf {
+		switch {
+		case alt.Type == "object" && alt.Properties.Version.Pattern != "":
+			pattern = alt.Properties.Version.Pattern
+		case alt.Type == "string" && pattern == "":
+			pattern = alt.Pattern
+		}
+	}
+	if pattern == "" {
+		return nil, errors.New("invalid schema: no pattern for atip version")
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid schema: atip version pattern: %w", err)
+	}
+
+	if len(raw.Definitions.ParamType.Enum) == 0 {
+		return nil, errors.New("invalid schema: no parameter types defined")
+	}
+	paramTypes := make(map[string]bool)
+	for _, t := range raw.Definitions.ParamType.Enum {
+		paramTypes[t] = true
+	}
+
+	return &compiledSchema{
+		versionPattern:    re,
+		paramTypes:        paramTypes,
+		omittedReasons:    enumSet(raw.Properties.Omitted.Properties.Reason.Enum),
+		safetyAssumptions: enumSet(raw.Properties.Omitted.Properties.SafetyAssumption.Enum),
+	}, nil
+}
+
+// enumSet returns the values of a schema enum as a set, or nil if there are
+// none so that any value is accepted.
+func enumSet(values []string) map[string]bool {
+	if len(values) == 0 {
+		return nil
+	}
+	set := make(map[string]bool, len(values))
+	for _, value := range values {
+		set[value] = true
+	}
+	return set
 }
 
 // Validate validates ATIP metadata JSON against the schema.
@@ -46,76 +338,276 @@ func (v *Validator) Validate(data []byte) (*AtipMetadata, error) {
 	return metadata, nil
 }
 
-// ValidateMetadata validates an already-parsed AtipMetadata struct.
+// ValidateMetadata validates an already-parsed AtipMetadata struct. It
+// stops at the first problem and returns it as a *ValidationError.
 func (v *Validator) ValidateMetadata(metadata *AtipMetadata) error {
+	c := &checker{}
+	v.validateMetadata(c, metadata)
+	if len(c.errs) > 0 {
+		return &c.errs[0]
+	}
+	return nil
+}
+
+// ValidateAll validates ATIP metadata JSON like Validate, but rather than
+// stopping at the first problem it reports every one it finds, so authors
+// can fix their metadata in one go. Once a value has the wrong type, what
+// it contains isn't checked. The error is for data that isn't valid JSON.
+func (v *Validator) ValidateAll(data []byte) ([]ValidationError, error) {
+	metadata, err := ParseJSON(data)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &checker{all: true}
+	v.validateMetadata(c, metadata)
+	return c.errs, nil
+}
+
+// checker collects the problems found by validation. Unless all is set,
+// validation stops at the first: checks return early once stopped.
+type checker struct {
+	all  bool
+	errs []ValidationError
+}
+
+// fail records a problem with field.
+func (c *checker) fail(field, message string) {
+	c.errs = append(c.errs, ValidationError{Field: field, Message: message})
+}
+
+// stopped reports whether a fail-fast checker has found a problem.
+func (c *checker) stopped() bool {
+	return !c.all && len(c.errs) > 0
+}
+
+func (v *Validator) validateMetadata(c *checker, metadata *AtipMetadata) {
 	// Validate required fields
-	if metadata.Atip == nil {
-		return &ValidationError{Field: "atip", Message: "field is required"}
+	for _, required := range []struct {
+		field   string
+		missing bool
+	}{
+		{"atip", metadata.Atip == nil},
+		{"name", metadata.Name == ""},
+		{"version", metadata.Version == ""},
+		{"description", metadata.Description == ""},
+	} {
+		if required.missing {
+			c.fail(required.field, "field is required")
+			if c.stopped() {
+				return
+			}
+		}
 	}
 
-	if metadata.Name == "" {
-		return &ValidationError{Field: "name", Message: "field is required"}
+	// Validate atip field format
+	if metadata.Atip != nil {
+		v.validateAtipField(c, metadata.Atip)
 	}
 
-	if metadata.Version == "" {
-		return &ValidationError{Field: "version", Message: "field is required"}
+	if metadata.Omitted != nil && !c.stopped() {
+		v.validateOmitted(c, metadata)
 	}
 
-	if metadata.Description == "" {
-		return &ValidationError{Field: "description", Message: "field is required"}
+	if metadata.GlobalOptions != nil && !c.stopped() {
+		v.validateOptions(c, "globalOptions", metadata.GlobalOptions)
 	}
 
-	// Validate atip field format
-	if err := validateAtipField(metadata.Atip); err != nil {
+	// Validate commands if present
+	if metadata.Commands != nil && !c.stopped() {
+		v.validateCommands(c, "commands", metadata.Commands)
+	}
+
+	// Policies assume metadata that matches the schema
+	if len(c.errs) == 0 {
+		v.checkPolicies(c, metadata)
+	}
+}
+
+// ValidateMetadataStrict validates metadata like ValidateMetadata and additionally
+// requires the version to be a semantic version. A leading "v" (as in "v2.45.0")
+// is accepted; metadata is not modified, so callers that want the canonical form
+// should use NormalizeVersion.
+func (v *Validator) ValidateMetadataStrict(metadata *AtipMetadata) error {
+	if err := v.ValidateMetadata(metadata); err != nil {
 		return err
 	}
+	_, err := NormalizeVersion(metadata.Version)
+	return err
+}
 
-	// Validate commands if present
-	if metadata.Commands != nil {
-		if err := validateCommands(metadata.Commands); err != nil {
-			return err
+// NormalizeVersion returns version in canonical semver form, stripping a
+// leading "v". Returns a ValidationError if version is not a semantic version.
+func NormalizeVersion(version string) (string, error) {
+	normalized := strings.TrimPrefix(version, "v")
+	if !semverRegex.MatchString(normalized) {
+		return "", &ValidationError{
+			Field:   "version",
+			Message: fmt.Sprintf("%q is not a semantic version (expected MAJOR.MINOR.PATCH, e.g. 1.2.3 or 1.2.3-beta.1)", version),
 		}
 	}
+	return normalized, nil
+}
 
-	return nil
+// CompareVersions compares two versions by semantic version precedence,
+// returning -1, 0 or 1. Build metadata is ignored. Versions that aren't
+// semantic versions sort after those that are, in lexical order.
+func CompareVersions(a, b string) int {
+	aNorm, aErr := NormalizeVersion(a)
+	bNorm, bErr := NormalizeVersion(b)
+	switch {
+	case aErr != nil && bErr != nil:
+		return strings.Compare(a, b)
+	case aErr != nil:
+		return 1
+	case bErr != nil:
+		return -1
+	}
+	a, _, _ = strings.Cut(aNorm, "+")
+	b, _, _ = strings.Cut(bNorm, "+")
+	aCore, aPre, _ := strings.Cut(a, "-")
+	bCore, bPre, _ := strings.Cut(b, "-")
+
+	aParts, bParts := strings.Split(aCore, "."), strings.Split(bCore, ".")
+	for i := 0; i < 3; i++ {
+		if c := compareIdentifier(aParts[i], bParts[i]); c != 0 {
+			return c
+		}
+	}
+
+	// A version without a pre-release has higher precedence
+	switch {
+	case aPre == bPre:
+		return 0
+	case aPre == "":
+		return 1
+	case bPre == "":
+		return -1
+	}
+
+	aIDs, bIDs := strings.Split(aPre, "."), strings.Split(bPre, ".")
+	for i := 0; i < len(aIDs) && i < len(bIDs); i++ {
+		if c := compareIdentifier(aIDs[i], bIDs[i]); c != 0 {
+			return c
+		}
+	}
+	return compareInt(len(aIDs), len(bIDs))
+}
+
+// CompareAtipVersions compares two ATIP spec versions (MAJOR.MINOR, e.g.
+// "0.6") numerically, returning -1, 0 or 1.
+func CompareAtipVersions(a, b string) (int, error) {
+	aParts, err := parseAtipVersion(a)
+	if err != nil {
+		return 0, err
+	}
+	bParts, err := parseAtipVersion(b)
+	if err != nil {
+		return 0, err
+	}
+	if c := compareInt(aParts[0], bParts[0]); c != 0 {
+		return c, nil
+	}
+	return compareInt(aParts[1], bParts[1]), nil
+}
+
+// parseAtipVersion splits an ATIP spec version into major and minor.
+func parseAtipVersion(version string) ([2]int, error) {
+	var parts [2]int
+	major, minor, ok := strings.Cut(version, ".")
+	if ok {
+		var err error
+		if parts[0], err = strconv.Atoi(major); err == nil {
+			parts[1], err = strconv.Atoi(minor)
+		}
+		ok = err == nil && parts[0] >= 0 && parts[1] >= 0
+	}
+	if !ok {
+		return parts, fmt.Errorf("invalid ATIP version %q (expected MAJOR.MINOR, e.g. 0.6)", version)
+	}
+	return parts, nil
+}
+
+// compareIdentifier compares numeric identifiers numerically and others
+// lexically; numeric identifiers sort first.
+func compareIdentifier(a, b string) int {
+	an, aErr := strconv.ParseUint(a, 10, 64)
+	bn, bErr := strconv.ParseUint(b, 10, 64)
+	switch {
+	case aErr == nil && bErr == nil:
+		switch {
+		case an < bn:
+			return -1
+		case an > bn:
+			return 1
+		}
+		return 0
+	case aErr == nil:
+		return -1
+	case bErr == nil:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+// compareInt returns -1, 0 or 1 comparing a and b.
+func compareInt(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
 }
 
 // validateAtipField validates the atip field (supports legacy and new format)
-func validateAtipField(atip interface{}) error {
-	switch v := atip.(type) {
+func (v *Validator) validateAtipField(c *checker, atip interface{}) {
+	switch a := atip.(type) {
 	case string:
 		// Legacy format: "atip": "0.3"
-		if v != "0.1" && v != "0.2" && v != "0.3" && v != "0.4" && v != "0.5" && v != "0.6" {
-			return &ValidationError{Field: "atip", Message: fmt.Sprintf("unsupported version: %s", v)}
+		if !v.schema.versionPattern.MatchString(a) {
+			c.fail("atip", fmt.Sprintf("unsupported version: %s", a))
 		}
 	case map[string]interface{}:
 		// New format: "atip": {"version": "0.6"}
-		version, ok := v["version"]
+		version, ok := a["version"]
 		if !ok {
-			return &ValidationError{Field: "atip.version", Message: "field is required"}
+			c.fail("atip.version", "field is required")
+			return
 		}
 		versionStr, ok := version.(string)
 		if !ok {
-			return &ValidationError{Field: "atip.version", Message: "must be a string"}
+			c.fail("atip.version", "must be a string")
+			return
 		}
-		if versionStr != "0.1" && versionStr != "0.2" && versionStr != "0.3" && versionStr != "0.4" && versionStr != "0.5" && versionStr != "0.6" {
-			return &ValidationError{Field: "atip.version", Message: fmt.Sprintf("unsupported version: %s", versionStr)}
+		if !v.schema.versionPattern.MatchString(versionStr) {
+			c.fail("atip.version", fmt.Sprintf("unsupported version: %s", versionStr))
 		}
 	default:
-		return &ValidationError{Field: "atip", Message: "must be a string or object"}
+		c.fail("atip", "must be a string or object")
 	}
-	return nil
 }
 
-// validateCommands validates the commands structure
-func validateCommands(commands map[string]interface{}) error {
-	for cmdName, cmdData := range commands {
-		cmd, ok := cmdData.(map[string]interface{})
+// validateCommands validates the commands structure, in order of name.
+// The prefix is the field path of the commands object, used in error messages.
+func (v *Validator) validateCommands(c *checker, prefix string, commands map[string]interface{}) {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, cmdName := range names {
+		if c.stopped() {
+			return
+		}
+		field := fmt.Sprintf("%s.%s", prefix, cmdName)
+
+		cmd, ok := commands[cmdName].(map[string]interface{})
 		if !ok {
-			return &ValidationError{
-				Field:   fmt.Sprintf("commands.%s", cmdName),
-				Message: "must be an object",
-			}
+			c.fail(field, "must be an object")
+			continue
 		}
 
 		// Check if this is a leaf command (has effects) or a parent command (has nested commands)
@@ -123,51 +615,231 @@ func validateCommands(commands map[string]interface{}) error {
 		hasCommands := cmd["commands"] != nil
 
 		if !hasEffects && !hasCommands {
-			return &ValidationError{
-				Field:   fmt.Sprintf("commands.%s", cmdName),
-				Message: "must have either 'effects' or nested 'commands'",
-			}
+			c.fail(field, "must have either 'effects' or nested 'commands'")
 		}
 
 		// Validate effects if present
 		if hasEffects {
-			effects, ok := cmd["effects"].(map[string]interface{})
+			v.validateEffects(c, field+".effects", cmd["effects"])
+		}
+
+		// Validate options and arguments if present
+		if options, ok := cmd["options"]; ok && !c.stopped() {
+			v.validateOptions(c, field+".options", options)
+		}
+		if arguments, ok := cmd["arguments"]; ok && !c.stopped() {
+			v.validateArguments(c, field+".arguments", arguments)
+		}
+
+		// Recursively validate nested commands
+		if hasCommands && !c.stopped() {
+			nestedCommands, ok := cmd["commands"].(map[string]interface{})
 			if !ok {
-				return &ValidationError{
-					Field:   fmt.Sprintf("commands.%s.effects", cmdName),
-					Message: "must be an object",
-				}
+				c.fail(field+".commands", "must be an object")
+				continue
 			}
+			v.validateCommands(c, field+".commands", nestedCommands)
+		}
+	}
+}
+
+// validateEffects validates a command's effects object: the boolean flags
+// must be booleans and a filesystem effect must be well formed.
+func (v *Validator) validateEffects(c *checker, field string, value interface{}) {
+	effects, ok := value.(map[string]interface{})
+	if !ok {
+		c.fail(field, "must be an object")
+		return
+	}
+
+	names := make([]string, 0, len(effects))
+	for name := range effects {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	// Validate effect types (all should be boolean or have specific types)
+	for _, effectName := range names {
+		if c.stopped() {
+			return
+		}
+		switch effectName {
+		case "destructive", "reversible", "idempotent", "network":
+			if _, ok := effects[effectName].(bool); !ok {
+				c.fail(field+"."+effectName, "must be a boolean")
+			}
+		case "filesystem":
+			validateFilesystemEffect(c, field+".filesystem", effects[effectName])
+		}
+	}
+}
+
+// validateFilesystemEffect validates a filesystem effect: an object whose
+// read, write and delete flags are booleans and whose paths, if declared,
+// are non-empty strings.
+func validateFilesystemEffect(c *checker, field string, effect interface{}) {
+	fs, ok := effect.(map[string]interface{})
+	if !ok {
+		c.fail(field, "must be an object")
+		return
+	}
 
-			// Validate effect types (all should be boolean or have specific types)
-			for effectName, effectValue := range effects {
-				switch effectName {
-				case "destructive", "reversible", "idempotent", "network":
-					if _, ok := effectValue.(bool); !ok {
-						return &ValidationError{
-							Field:   fmt.Sprintf("commands.%s.effects.%s", cmdName, effectName),
-							Message: "must be a boolean",
-						}
-					}
+	for _, key := range []string{"read", "write", "delete"} {
+		if value, ok := fs[key]; ok {
+			if _, ok := value.(bool); !ok {
+				c.fail(field+"."+key, "must be a boolean")
+				if c.stopped() {
+					return
 				}
 			}
 		}
+	}
 
-		// Recursively validate nested commands
-		if hasCommands {
-			nestedCommands, ok := cmd["commands"].(map[string]interface{})
-			if !ok {
-				return &ValidationError{
-					Field:   fmt.Sprintf("commands.%s.commands", cmdName),
-					Message: "must be an object",
+	if value, ok := fs["paths"]; ok {
+		paths, ok := value.([]interface{})
+		if !ok {
+			c.fail(field+".paths", "must be an array of strings")
+			return
+		}
+		for i, path := range paths {
+			if str, ok := path.(string); !ok || str == "" {
+				c.fail(fmt.Sprintf("%s.paths[%d]", field, i), "must be a non-empty string")
+				if c.stopped() {
+					return
 				}
 			}
-			if err := validateCommands(nestedCommands); err != nil {
-				return err
+		}
+	}
+}
+
+// validateOptions validates a command's options array.
+// Each option needs a name, a non-empty array of string flags, and a known
+// type; enum options must also list their allowed values.
+func (v *Validator) validateOptions(c *checker, field string, options interface{}) {
+	list, ok := options.([]interface{})
+	if !ok {
+		c.fail(field, "must be an array")
+		return
+	}
+
+	for i, item := range list {
+		if c.stopped() {
+			return
+		}
+		optField := fmt.Sprintf("%s[%d]", field, i)
+		opt, ok := item.(map[string]interface{})
+		if !ok {
+			c.fail(optField, "must be an object")
+			continue
+		}
+
+		requireString(c, opt, optField, "name")
+
+		flags, ok := opt["flags"].([]interface{})
+		if !ok || len(flags) == 0 {
+			c.fail(optField+".flags", "must be a non-empty array of strings")
+		}
+		for j, flag := range flags {
+			if _, ok := flag.(string); !ok {
+				c.fail(fmt.Sprintf("%s.flags[%d]", optField, j), "must be a string")
 			}
 		}
+
+		if !c.stopped() {
+			v.validateParamType(c, opt, optField)
+		}
+	}
+}
+
+// validateArguments validates a command's arguments array.
+// Each argument needs a name and a known type; required, if set, must be a boolean.
+func (v *Validator) validateArguments(c *checker, field string, arguments interface{}) {
+	list, ok := arguments.([]interface{})
+	if !ok {
+		c.fail(field, "must be an array")
+		return
+	}
+
+	for i, item := range list {
+		if c.stopped() {
+			return
+		}
+		argField := fmt.Sprintf("%s[%d]", field, i)
+		arg, ok := item.(map[string]interface{})
+		if !ok {
+			c.fail(argField, "must be an object")
+			continue
+		}
+
+		requireString(c, arg, argField, "name")
+
+		if !c.stopped() {
+			v.validateParamType(c, arg, argField)
+		}
+
+		if required, ok := arg["required"]; ok {
+			if _, ok := required.(bool); !ok {
+				c.fail(argField+".required", "must be a boolean")
+			}
+		}
+	}
+}
+
+// validateOmitted checks that the omitted block belongs to partial metadata
+// and that its reason and safety assumption are values the schema allows.
+func (v *Validator) validateOmitted(c *checker, metadata *AtipMetadata) {
+	if !metadata.Partial {
+		c.fail("omitted", "only allowed when partial is true")
+		return
+	}
+	omitted := metadata.Omitted
+	if omitted.Reason != "" && v.schema.omittedReasons != nil && !v.schema.omittedReasons[omitted.Reason] {
+		c.fail("omitted.reason", fmt.Sprintf("unsupported reason: %s", omitted.Reason))
+	}
+	if omitted.SafetyAssumption != "" && v.schema.safetyAssumptions != nil && !v.schema.safetyAssumptions[omitted.SafetyAssumption] {
+		c.fail("omitted.safetyAssumption", fmt.Sprintf("unsupported safety assumption: %s", omitted.SafetyAssumption))
+	}
+}
+
+// validateParamType checks the type of an option or argument against the schema,
+// and that enum-typed parameters carry a non-empty enum list.
+func (v *Validator) validateParamType(c *checker, param map[string]interface{}, field string) {
+	if !requireString(c, param, field, "type") {
+		return
+	}
+
+	paramType := param["type"].(string)
+	if !v.schema.paramTypes[paramType] {
+		c.fail(field+".type", fmt.Sprintf("unsupported type: %s", paramType))
+		return
+	}
+
+	if paramType == "enum" {
+		values, ok := param["enum"].([]interface{})
+		if !ok || len(values) == 0 {
+			c.fail(field+".enum", "must be a non-empty array for enum types")
+		}
 	}
-	return nil
+}
+
+// requireString checks that obj[key] is a non-empty string, reporting
+// whether it is.
+func requireString(c *checker, obj map[string]interface{}, field, key string) bool {
+	value, ok := obj[key]
+	if !ok {
+		c.fail(field+"."+key, "field is required")
+		return false
+	}
+	str, ok := value.(string)
+	if !ok {
+		c.fail(field+"."+key, "must be a string")
+		return false
+	}
+	if str == "" {
+		c.fail(field+"."+key, "must not be empty")
+		return false
+	}
+	return true
 }
 
 // ParseJSON parses JSON into AtipMetadata without schema validation.
@@ -179,13 +851,21 @@ func ParseJSON(data []byte) (*AtipMetadata, error) {
 	return &metadata, nil
 }
 
-// ValidationError represents a schema validation error.
+// ValidationError represents a schema validation error, or a policy
+// violation if Rule is set.
 type ValidationError struct {
 	Field   string
 	Message string
+	Rule    string // Name of the policy rule violated
 }
 
 func (e *ValidationError) Error() string {
+	if e.Rule != "" {
+		if e.Field != "" {
+			return fmt.Sprintf("policy violation (%s) on field '%s': %s", e.Rule, e.Field, e.Message)
+		}
+		return fmt.Sprintf("policy violation (%s): %s", e.Rule, e.Message)
+	}
 	if e.Field != "" {
 		return fmt.Sprintf("validation error on field '%s': %s", e.Field, e.Message)
 	}
@@ -1,6 +1,11 @@
 package validator
 
 import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -167,6 +172,73 @@ func TestValidate_LegacyAtipFormat(t *testing.T) {
 	assert.Equal(t, "tool", metadata.Name)
 }
 
+func TestAtipMetadata_NormalizeAtip(t *testing.T) {
+	v, err := New()
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		atip    string
+		version string
+	}{
+		{name: "legacy string", atip: `"0.3"`, version: "0.3"},
+		{name: "object", atip: `{"version": "0.6"}`, version: "0.6"},
+		{name: "object with features", atip: `{"version": "0.6", "features": ["trust-v1"]}`, version: "0.6"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metadata, err := v.Validate([]byte(`{"atip": ` + tt.atip + `, "name": "tool", "version": "1.0.0", "description": "test"}`))
+			require.NoError(t, err)
+			assert.Equal(t, tt.version, metadata.AtipVersion())
+
+			metadata.NormalizeAtip()
+			atip, ok := metadata.Atip.(map[string]interface{})
+			require.True(t, ok, "atip is %T", metadata.Atip)
+			assert.Equal(t, tt.version, atip["version"])
+			assert.Equal(t, tt.version, metadata.AtipVersion())
+
+			// Normalized metadata still validates, and normalizing is idempotent
+			data, err := json.Marshal(metadata)
+			require.NoError(t, err)
+			again, err := v.Validate(data)
+			require.NoError(t, err)
+			again.NormalizeAtip()
+			assert.Equal(t, metadata.Atip, again.Atip)
+		})
+	}
+
+	assert.Empty(t, (&AtipMetadata{}).AtipVersion())
+}
+
+func TestCompareAtipVersions(t *testing.T) {
+	tests := []struct {
+		a, b    string
+		want    int
+		wantErr bool
+	}{
+		{a: "0.6", b: "0.6", want: 0},
+		{a: "0.3", b: "0.6", want: -1},
+		{a: "0.10", b: "0.6", want: 1},
+		{a: "1.0", b: "0.6", want: 1},
+		{a: "0.6.1", b: "0.6", wantErr: true},
+		{a: "six", b: "0.6", wantErr: true},
+		{a: "0.6", b: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.a+" vs "+tt.b, func(t *testing.T) {
+			got, err := CompareAtipVersions(tt.a, tt.b)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
 func TestValidate_InvalidEffects(t *testing.T) {
 	v, err := New()
 	require.NoError(t, err)
@@ -216,6 +288,62 @@ func TestValidate_InvalidEffects(t *testing.T) {
 	}
 }
 
+func TestValidate_FilesystemEffects(t *testing.T) {
+	v, err := New()
+	require.NoError(t, err)
+
+	// The filesystem effect is declared on a nested command, so validation
+	// has to recurse to find it
+	metadataWith := func(filesystem string) []byte {
+		return []byte(`{
+			"atip": {"version": "0.6"},
+			"name": "tool",
+			"version": "1.0.0",
+			"description": "test",
+			"commands": {
+				"cache": {
+					"description": "Manage the cache",
+					"commands": {
+						"clear": {"description": "Clear the cache", "effects": {"filesystem": ` + filesystem + `}}
+					}
+				}
+			}
+		}`)
+	}
+
+	tests := []struct {
+		name       string
+		filesystem string
+		wantField  string
+	}{
+		{"read only", `{"read": true, "write": false}`, ""},
+		{"with paths", `{"read": true, "write": true, "delete": true, "paths": ["~/.cache/tool/", "/tmp/tool"]}`, ""},
+		{"empty", `{}`, ""},
+		{"empty paths", `{"write": true, "paths": []}`, ""},
+		{"not an object", `true`, "commands.cache.commands.clear.effects.filesystem"},
+		{"read not a boolean", `{"read": "yes"}`, "commands.cache.commands.clear.effects.filesystem.read"},
+		{"write not a boolean", `{"write": 1}`, "commands.cache.commands.clear.effects.filesystem.write"},
+		{"delete not a boolean", `{"delete": null}`, "commands.cache.commands.clear.effects.filesystem.delete"},
+		{"paths not an array", `{"write": true, "paths": "~/.cache/tool/"}`, "commands.cache.commands.clear.effects.filesystem.paths"},
+		{"path not a string", `{"write": true, "paths": ["~/.cache/tool/", 42]}`, "commands.cache.commands.clear.effects.filesystem.paths[1]"},
+		{"empty path", `{"write": true, "paths": [""]}`, "commands.cache.commands.clear.effects.filesystem.paths[0]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := v.Validate(metadataWith(tt.filesystem))
+			if tt.wantField == "" {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			var ve *ValidationError
+			require.ErrorAs(t, err, &ve)
+			assert.Equal(t, tt.wantField, ve.Field)
+		})
+	}
+}
+
 func TestValidate_PartialDiscovery(t *testing.T) {
 	v, err := New()
 	require.NoError(t, err)
@@ -240,7 +368,130 @@ func TestValidate_PartialDiscovery(t *testing.T) {
 
 	metadata, err := v.Validate([]byte(partialJSON))
 	require.NoError(t, err)
-	assert.NotNil(t, metadata)
+	assert.True(t, metadata.Partial)
+	require.NotNil(t, metadata.Omitted)
+	assert.Equal(t, "filtered", metadata.Omitted.Reason)
+	assert.Equal(t, "unknown", metadata.Omitted.SafetyAssumption)
+
+	// Round-trips through marshaling, e.g. into the metadata cache
+	data, err := json.Marshal(metadata)
+	require.NoError(t, err)
+	roundTripped, err := v.Validate(data)
+	require.NoError(t, err)
+	assert.Equal(t, metadata, roundTripped)
+}
+
+func TestValidate_Omitted(t *testing.T) {
+	v, err := New()
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		partial bool
+		omitted string
+		field   string
+	}{
+		{name: "all values", partial: true, omitted: `{"reason": "depth-limited", "safetyAssumption": "same-as-included"}`},
+		{name: "empty block", partial: true, omitted: `{}`},
+		{name: "complete metadata", partial: false, omitted: `{"reason": "filtered"}`, field: "omitted"},
+		{name: "unknown reason", partial: true, omitted: `{"reason": "lazy"}`, field: "omitted.reason"},
+		{name: "unknown assumption", partial: true, omitted: `{"safetyAssumption": "probably-fine"}`, field: "omitted.safetyAssumption"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := v.Validate([]byte(fmt.Sprintf(`{
+				"atip": {"version": "0.6"},
+				"name": "kubectl",
+				"version": "1.28.0",
+				"description": "Kubernetes CLI",
+				"partial": %t,
+				"omitted": %s
+			}`, tt.partial, tt.omitted)))
+			if tt.field == "" {
+				assert.NoError(t, err)
+				return
+			}
+			var verr *ValidationError
+			require.ErrorAs(t, err, &verr)
+			assert.Equal(t, tt.field, verr.Field)
+		})
+	}
+
+	// A malformed block doesn't parse
+	_, err = v.Validate([]byte(`{"atip": "0.6", "name": "t", "version": "1", "description": "d", "partial": true, "omitted": "filtered"}`))
+	assert.Error(t, err)
+}
+
+func TestAtipMetadata_OmittedSafety(t *testing.T) {
+	assert.Equal(t, "", (&AtipMetadata{}).OmittedSafety())
+	assert.Equal(t, "", (&AtipMetadata{Omitted: &Omitted{SafetyAssumption: "known-safe"}}).OmittedSafety())
+	assert.Equal(t, SafetyAssumptionUnknown, (&AtipMetadata{Partial: true}).OmittedSafety())
+	assert.Equal(t, SafetyAssumptionUnknown, (&AtipMetadata{Partial: true, Omitted: &Omitted{Reason: "filtered"}}).OmittedSafety())
+	assert.Equal(t, "known-safe", (&AtipMetadata{Partial: true, Omitted: &Omitted{SafetyAssumption: "known-safe"}}).OmittedSafety())
+}
+
+func TestAtipMetadata_TrustSummary(t *testing.T) {
+	v, err := New()
+	require.NoError(t, err)
+
+	metadata, err := v.Validate([]byte(`{
+		"atip": {"version": "0.6"},
+		"name": "gh",
+		"version": "2.45.0",
+		"description": "GitHub CLI",
+		"trust": {
+			"source": "vendor",
+			"verified": true,
+			"integrity": {
+				"checksum": "sha256:e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+				"signature": {"type": "cosign", "identity": "https://github.com/cli/cli/.github/workflows/release.yml@refs/tags/v2.45.0", "issuer": "https://token.actions.githubusercontent.com"}
+			},
+			"provenance": {"format": "slsa-provenance-v1", "slsaLevel": 3}
+		}
+	}`))
+	require.NoError(t, err)
+	assert.Equal(t, TrustSummary{Source: "vendor", Verified: true, Signature: "cosign", Provenance: "slsa-provenance-v1"}, metadata.TrustSummary())
+	assert.Equal(t, 3, metadata.Trust.Provenance.SLSALevel)
+
+	// Without a trust block, or without a source, the source is unknown
+	assert.Equal(t, TrustSummary{Source: TrustSourceUnknown}, (&AtipMetadata{}).TrustSummary())
+	assert.Equal(t, TrustSummary{Source: TrustSourceUnknown, Verified: true}, (&AtipMetadata{Trust: &TrustInfo{Verified: true}}).TrustSummary())
+
+	var missing *AtipMetadata
+	assert.Equal(t, TrustSourceUnknown, missing.TrustSummary().Source)
+}
+
+func TestValidate_InferredGlobalOptions(t *testing.T) {
+	v, err := New()
+	require.NoError(t, err)
+
+	metadata, err := v.Validate([]byte(`{
+		"atip": {"version": "0.6"},
+		"name": "tar",
+		"version": "1.35",
+		"description": "Archiving utility",
+		"partial": true,
+		"trust": {"source": "inferred", "verified": false},
+		"globalOptions": [
+			{"name": "file", "flags": ["-f", "--file"], "type": "string", "description": "Archive file"}
+		]
+	}`))
+	require.NoError(t, err)
+	require.NotNil(t, metadata.Trust)
+	assert.Equal(t, TrustSourceInferred, metadata.Trust.Source)
+	assert.Len(t, metadata.GlobalOptions, 1)
+
+	_, err = v.Validate([]byte(`{
+		"atip": {"version": "0.6"},
+		"name": "tar",
+		"version": "1.35",
+		"description": "Archiving utility",
+		"globalOptions": [{"name": "file", "flags": [], "type": "string"}]
+	}`))
+	var verr *ValidationError
+	require.ErrorAs(t, err, &verr)
+	assert.Equal(t, "globalOptions[0].flags", verr.Field)
 }
 
 func TestParseJSON(t *testing.T) {
@@ -308,6 +559,379 @@ func TestNewWithSchema_CustomSchema(t *testing.T) {
 	}
 }
 
+func TestValidate_OptionAndArgumentErrors(t *testing.T) {
+	v, err := New()
+	require.NoError(t, err)
+
+	tests := []struct {
+		name      string
+		list      string // JSON for the "list" command's options/arguments fields
+		wantField string
+	}{
+		{
+			name:      "option missing name",
+			list:      `"options": [{"flags": ["--x"], "type": "string"}]`,
+			wantField: "commands.pr.commands.list.options[0].name",
+		},
+		{
+			name:      "option with empty name",
+			list:      `"options": [{"name": "", "flags": ["--x"], "type": "string"}]`,
+			wantField: "commands.pr.commands.list.options[0].name",
+		},
+		{
+			name:      "option flags not an array",
+			list:      `"options": [{"name": "x", "flags": "--x", "type": "string"}]`,
+			wantField: "commands.pr.commands.list.options[0].flags",
+		},
+		{
+			name:      "option flags empty",
+			list:      `"options": [{"name": "x", "flags": [], "type": "string"}]`,
+			wantField: "commands.pr.commands.list.options[0].flags",
+		},
+		{
+			name:      "option flag not a string",
+			list:      `"options": [{"name": "x", "flags": ["--x", 1], "type": "string"}]`,
+			wantField: "commands.pr.commands.list.options[0].flags[1]",
+		},
+		{
+			name:      "option with unknown type",
+			list:      `"options": [{"name": "ok", "flags": ["--ok"], "type": "boolean"}, {"name": "x", "flags": ["--x"], "type": "color"}]`,
+			wantField: "commands.pr.commands.list.options[1].type",
+		},
+		{
+			name:      "option missing type",
+			list:      `"options": [{"name": "x", "flags": ["--x"]}]`,
+			wantField: "commands.pr.commands.list.options[0].type",
+		},
+		{
+			name:      "enum option without values",
+			list:      `"options": [{"name": "x", "flags": ["--x"], "type": "enum"}]`,
+			wantField: "commands.pr.commands.list.options[0].enum",
+		},
+		{
+			name:      "enum option with empty values",
+			list:      `"options": [{"name": "x", "flags": ["--x"], "type": "enum", "enum": []}]`,
+			wantField: "commands.pr.commands.list.options[0].enum",
+		},
+		{
+			name:      "options not an array",
+			list:      `"options": {"name": "x"}`,
+			wantField: "commands.pr.commands.list.options",
+		},
+		{
+			name:      "argument missing name",
+			list:      `"arguments": [{"type": "string", "required": true}]`,
+			wantField: "commands.pr.commands.list.arguments[0].name",
+		},
+		{
+			name:      "argument missing type",
+			list:      `"arguments": [{"name": "x", "required": true}]`,
+			wantField: "commands.pr.commands.list.arguments[0].type",
+		},
+		{
+			name:      "argument required not a boolean",
+			list:      `"arguments": [{"name": "x", "type": "string", "required": "yes"}]`,
+			wantField: "commands.pr.commands.list.arguments[0].required",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := `{
+				"atip": {"version": "0.6"},
+				"name": "gh",
+				"version": "1.0.0",
+				"description": "test",
+				"commands": {
+					"pr": {
+						"description": "Pull requests",
+						"commands": {
+							"list": {
+								"description": "List",
+								` + tt.list + `,
+								"effects": {"network": true}
+							}
+						}
+					}
+				}
+			}`
+
+			_, err := v.Validate([]byte(data))
+			require.Error(t, err)
+
+			var ve *ValidationError
+			require.ErrorAs(t, err, &ve)
+			assert.Equal(t, tt.wantField, ve.Field)
+		})
+	}
+}
+
+func TestValidateAll_ReportsEveryError(t *testing.T) {
+	v, err := New()
+	require.NoError(t, err)
+
+	data := `{
+		"atip": {"version": "9.9"},
+		"name": "tool",
+		"description": "test",
+		"commands": {
+			"rm": {
+				"description": "Remove",
+				"options": [{"flags": ["-f"], "type": "color"}],
+				"effects": {"destructive": "yes", "filesystem": {"delete": 1}}
+			},
+			"cp": {
+				"description": "Copy",
+				"arguments": [{"name": "src", "type": "file", "required": "yes"}]
+			},
+			"ls": "list"
+		}
+	}`
+
+	errs, err := v.ValidateAll([]byte(data))
+	require.NoError(t, err)
+
+	var fields []string
+	for _, ve := range errs {
+		fields = append(fields, ve.Field)
+	}
+	assert.Equal(t, []string{
+		"version",
+		"atip.version",
+		"commands.cp",
+		"commands.cp.arguments[0].required",
+		"commands.ls",
+		"commands.rm.effects.destructive",
+		"commands.rm.effects.filesystem.delete",
+		"commands.rm.options[0].name",
+		"commands.rm.options[0].type",
+	}, fields)
+
+	// Validate stops at the first of them
+	_, err = v.Validate([]byte(data))
+	var ve *ValidationError
+	require.ErrorAs(t, err, &ve)
+	assert.Equal(t, "version", ve.Field)
+}
+
+func TestValidateAll_Valid(t *testing.T) {
+	v, err := New()
+	require.NoError(t, err)
+
+	errs, err := v.ValidateAll([]byte(`{
+		"atip": {"version": "0.6"},
+		"name": "tool",
+		"version": "1.0.0",
+		"description": "test",
+		"commands": {"run": {"description": "Run", "effects": {"network": false}}}
+	}`))
+	require.NoError(t, err)
+	assert.Empty(t, errs)
+}
+
+func TestValidateAll_InvalidJSON(t *testing.T) {
+	v, err := New()
+	require.NoError(t, err)
+
+	errs, err := v.ValidateAll([]byte(`{not json`))
+	assert.Error(t, err)
+	assert.Nil(t, errs)
+}
+
+func TestValidate_OptionsAndArgumentsValid(t *testing.T) {
+	v, err := New()
+	require.NoError(t, err)
+
+	data := `{
+		"atip": {"version": "0.6"},
+		"name": "tool",
+		"version": "1.0.0",
+		"description": "test",
+		"commands": {
+			"cp": {
+				"description": "Copy",
+				"arguments": [
+					{"name": "src", "type": "file", "required": true, "description": "Source"},
+					{"name": "dst", "type": "file", "description": "Destination"}
+				],
+				"options": [
+					{"name": "mode", "flags": ["-m", "--mode"], "type": "enum", "enum": ["fast", "safe"], "description": "Mode"}
+				],
+				"effects": {"network": false}
+			}
+		}
+	}`
+
+	_, err = v.Validate([]byte(data))
+	assert.NoError(t, err)
+}
+
+func TestValidateMetadataStrict_Version(t *testing.T) {
+	v, err := New()
+	require.NoError(t, err)
+
+	tests := []struct {
+		name        string
+		version     string
+		expectError bool
+		normalized  string
+	}{
+		{name: "plain semver", version: "1.2.3", normalized: "1.2.3"},
+		{name: "leading v is normalized", version: "v1.2.3", normalized: "1.2.3"},
+		{name: "pre-release", version: "2.45.0-beta.1", normalized: "2.45.0-beta.1"},
+		{name: "build metadata", version: "1.2.3+build", normalized: "1.2.3+build"},
+		{name: "missing patch", version: "1.2", expectError: true},
+		{name: "leading zero", version: "01.2.3", expectError: true},
+		{name: "garbage", version: "latest-and-greatest", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metadata := &AtipMetadata{
+				Atip:        map[string]interface{}{"version": "0.6"},
+				Name:        "tool",
+				Version:     tt.version,
+				Description: "test",
+			}
+
+			// The lenient path accepts every non-empty version
+			require.NoError(t, v.ValidateMetadata(metadata))
+
+			err := v.ValidateMetadataStrict(metadata)
+			if tt.expectError {
+				require.Error(t, err)
+				var ve *ValidationError
+				require.ErrorAs(t, err, &ve)
+				assert.Equal(t, "version", ve.Field)
+				assert.Contains(t, ve.Message, "semantic version")
+			} else {
+				require.NoError(t, err)
+				normalized, err := NormalizeVersion(metadata.Version)
+				require.NoError(t, err)
+				assert.Equal(t, tt.normalized, normalized)
+			}
+			// Validation never rewrites the metadata
+			assert.Equal(t, tt.version, metadata.Version)
+		})
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"1.2.3", "1.2.3", 0},
+		{"v1.2.3", "1.2.3", 0},
+		{"1.2.3+build", "1.2.3", 0},
+		{"1.10.0", "1.9.0", 1},
+		{"1.2.3", "2.0.0", -1},
+		{"2.0.0-rc.1", "2.0.0", -1},
+		{"2.0.0-rc.10", "2.0.0-rc.2", 1},
+		{"2.0.0-alpha", "2.0.0-alpha.1", -1},
+		{"2.0.0-1", "2.0.0-alpha", -1},
+		{"unknown", "1.0.0", 1},
+		{"1.0.0", "unknown", -1},
+		{"abc", "abd", -1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.a+" vs "+tt.b, func(t *testing.T) {
+			assert.Equal(t, tt.want, CompareVersions(tt.a, tt.b))
+		})
+	}
+}
+
+func TestNewWithSchema_CompilesFile(t *testing.T) {
+	schemaPath := filepath.Join(t.TempDir(), "schema.json")
+	require.NoError(t, os.WriteFile(schemaPath, embeddedSchema, 0644))
+
+	v, err := NewWithSchema(schemaPath)
+	require.NoError(t, err)
+	assert.NotSame(t, mustDefault(t).schema, v.schema)
+
+	_, err = v.Validate([]byte(`{"atip": "0.4", "name": "t", "version": "1.0.0", "description": "d"}`))
+	assert.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(schemaPath, []byte(`{"properties": {}}`), 0644))
+	_, err = NewWithSchema(schemaPath)
+	assert.Error(t, err)
+}
+
+func TestDefault_SharedInstance(t *testing.T) {
+	a := mustDefault(t)
+	b := mustDefault(t)
+	assert.Same(t, a, b)
+
+	// New returns a distinct validator backed by the same compiled schema
+	v, err := New()
+	require.NoError(t, err)
+	assert.NotSame(t, a, v)
+	assert.Same(t, a.schema, v.schema)
+}
+
+func TestDefault_ConcurrentValidation(t *testing.T) {
+	data := []byte(`{"atip": {"version": "0.6"}, "name": "t", "version": "1.0.0", "description": "d"}`)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v := mustDefault(t)
+			_, err := v.Validate(data)
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+}
+
+func TestSchema(t *testing.T) {
+	data, err := Schema(SchemaVersion)
+	require.NoError(t, err)
+
+	var schema map[string]interface{}
+	require.NoError(t, json.Unmarshal(data, &schema))
+	assert.Equal(t, "https://atip.dev/schema/0.6.json", schema["$id"])
+
+	// The caller's copy can't corrupt the embedded schema
+	data[0] = 'x'
+	again, err := Schema(SchemaVersion)
+	require.NoError(t, err)
+	assert.True(t, json.Valid(again))
+
+	_, err = Schema("0.5")
+	assert.Error(t, err)
+}
+
+func mustDefault(t *testing.T) *Validator {
+	t.Helper()
+	v, err := Default()
+	require.NoError(t, err)
+	return v
+}
+
+// BenchmarkNew_SharedSchema creates validators that reuse the cached schema.
+func BenchmarkNew_SharedSchema(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := New(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkNew_CompileSchema compiles the schema for every validator,
+// which is what New did before the compiled schema was cached.
+func BenchmarkNew_CompileSchema(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := compileSchema(embeddedSchema); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
 func TestValidate_OptionsWithAllTypes(t *testing.T) {
 	v, err := New()
 	require.NoError(t, err)
@@ -9,21 +9,33 @@ import (
 )
 
 // DataHome returns the XDG_DATA_HOME directory.
-// Falls back to ~/.local/share if XDG_DATA_HOME is not set.
+// Falls back to ~/.local/share if XDG_DATA_HOME is not set
+// (%LOCALAPPDATA% on Windows).
 func DataHome() string {
 	if dir := os.Getenv("XDG_DATA_HOME"); dir != "" {
 		return dir
 	}
-	return filepath.Join(os.Getenv("HOME"), ".local", "share")
+	return defaultDataHome()
 }
 
 // ConfigHome returns the XDG_CONFIG_HOME directory.
-// Falls back to ~/.config if XDG_CONFIG_HOME is not set.
+// Falls back to ~/.config if XDG_CONFIG_HOME is not set
+// (%APPDATA% on Windows).
 func ConfigHome() string {
 	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
 		return dir
 	}
-	return filepath.Join(os.Getenv("HOME"), ".config")
+	return defaultConfigHome()
+}
+
+// CacheHome returns the XDG_CACHE_HOME directory.
+// Falls back to ~/.cache if XDG_CACHE_HOME is not set
+// (%LOCALAPPDATA%\cache on Windows).
+func CacheHome() string {
+	if dir := os.Getenv("XDG_CACHE_HOME"); dir != "" {
+		return dir
+	}
+	return defaultCacheHome()
 }
 
 // AgentToolsDataDir returns the agent-tools data directory.
@@ -36,11 +48,16 @@ func AgentToolsConfigDir() string {
 	return filepath.Join(ConfigHome(), "agent-tools")
 }
 
+// AgentToolsCacheDir returns the agent-tools cache directory.
+// It holds regenerable data such as probed tool metadata.
+func AgentToolsCacheDir() string {
+	return filepath.Join(CacheHome(), "agent-tools")
+}
+
 // EnsureDataDirs creates the necessary data directories if they don't exist.
 func EnsureDataDirs() error {
 	dirs := []string{
 		AgentToolsDataDir(),
-		filepath.Join(AgentToolsDataDir(), "tools"),
 		filepath.Join(AgentToolsDataDir(), "shims"),
 	}
 	for _, dir := range dirs {
@@ -51,13 +68,27 @@ func EnsureDataDirs() error {
 	return nil
 }
 
+// EnsureCacheDirs creates the necessary cache directories if they don't exist.
+func EnsureCacheDirs() error {
+	dirs := []string{
+		AgentToolsCacheDir(),
+		filepath.Join(AgentToolsCacheDir(), "tools"),
+	}
+	for _, dir := range dirs {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // ExpandTilde expands ~ to the user's home directory.
 func ExpandTilde(path string) string {
 	if path == "~" {
-		return os.Getenv("HOME")
+		return homeDir()
 	}
 	if strings.HasPrefix(path, "~/") {
-		return filepath.Join(os.Getenv("HOME"), path[2:])
+		return filepath.Join(homeDir(), path[2:])
 	}
 	return path
 }
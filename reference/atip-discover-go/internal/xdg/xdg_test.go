@@ -104,6 +104,75 @@ func TestAgentToolsConfigDir(t *testing.T) {
 	assert.Equal(t, expected, result)
 }
 
+func TestCacheHome(t *testing.T) {
+	tests := []struct {
+		name     string
+		xdgVar   string
+		expected string
+	}{
+		{
+			name:     "XDG_CACHE_HOME set",
+			xdgVar:   "/custom/cache",
+			expected: "/custom/cache",
+		},
+		{
+			name:     "XDG_CACHE_HOME not set",
+			xdgVar:   "",
+			expected: filepath.Join(os.Getenv("HOME"), ".cache"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			original := os.Getenv("XDG_CACHE_HOME")
+			defer os.Setenv("XDG_CACHE_HOME", original)
+
+			if tt.xdgVar == "" {
+				os.Unsetenv("XDG_CACHE_HOME")
+			} else {
+				os.Setenv("XDG_CACHE_HOME", tt.xdgVar)
+			}
+
+			result := CacheHome()
+			assert.Equal(t, tt.expected, result)
+		})
+	}
+}
+
+func TestAgentToolsCacheDir(t *testing.T) {
+	original := os.Getenv("XDG_CACHE_HOME")
+	defer os.Setenv("XDG_CACHE_HOME", original)
+
+	os.Setenv("XDG_CACHE_HOME", "/tmp/test-cache")
+
+	result := AgentToolsCacheDir()
+	expected := "/tmp/test-cache/agent-tools"
+	assert.Equal(t, expected, result)
+}
+
+func TestEnsureCacheDirs(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	original := os.Getenv("XDG_CACHE_HOME")
+	defer os.Setenv("XDG_CACHE_HOME", original)
+	os.Setenv("XDG_CACHE_HOME", tmpDir)
+
+	err := EnsureCacheDirs()
+	require.NoError(t, err)
+
+	for _, dir := range []string{
+		filepath.Join(tmpDir, "agent-tools"),
+		filepath.Join(tmpDir, "agent-tools", "tools"),
+	} {
+		info, err := os.Stat(dir)
+		require.NoError(t, err, "directory %s should exist", dir)
+		assert.True(t, info.IsDir(), "%s should be a directory", dir)
+	}
+
+	// Idempotent
+	assert.NoError(t, EnsureCacheDirs())
+}
+
 func TestEnsureDataDirs(t *testing.T) {
 	// Create a temporary directory for testing
 	tmpDir := t.TempDir()
@@ -118,7 +187,6 @@ func TestEnsureDataDirs(t *testing.T) {
 	// Verify directories were created
 	expectedDirs := []string{
 		filepath.Join(tmpDir, "agent-tools"),
-		filepath.Join(tmpDir, "agent-tools", "tools"),
 		filepath.Join(tmpDir, "agent-tools", "shims"),
 	}
 
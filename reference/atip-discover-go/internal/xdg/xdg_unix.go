@@ -0,0 +1,24 @@
+//go:build !windows
+
+package xdg
+
+import (
+	"os"
+	"path/filepath"
+)
+
+func homeDir() string {
+	return os.Getenv("HOME")
+}
+
+func defaultDataHome() string {
+	return filepath.Join(homeDir(), ".local", "share")
+}
+
+func defaultConfigHome() string {
+	return filepath.Join(homeDir(), ".config")
+}
+
+func defaultCacheHome() string {
+	return filepath.Join(homeDir(), ".cache")
+}
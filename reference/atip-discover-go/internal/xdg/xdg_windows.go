@@ -0,0 +1,50 @@
+//go:build windows
+
+package xdg
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// homeDir prefers %USERPROFILE%, which is always set on Windows,
+// over %HOME%, which usually isn't.
+func homeDir() string {
+	if dir, err := os.UserHomeDir(); err == nil {
+		return dir
+	}
+	return os.Getenv("HOME")
+}
+
+// localAppData returns %LOCALAPPDATA%, falling back to the stdlib
+// cache directory (which is derived from the same variable) and
+// finally to the default location under the user profile.
+func localAppData() string {
+	if dir := os.Getenv("LOCALAPPDATA"); dir != "" {
+		return dir
+	}
+	if dir, err := os.UserCacheDir(); err == nil {
+		return dir
+	}
+	return filepath.Join(homeDir(), "AppData", "Local")
+}
+
+func defaultDataHome() string {
+	return localAppData()
+}
+
+func defaultConfigHome() string {
+	if dir := os.Getenv("APPDATA"); dir != "" {
+		return dir
+	}
+	if dir, err := os.UserConfigDir(); err == nil {
+		return dir
+	}
+	return filepath.Join(homeDir(), "AppData", "Roaming")
+}
+
+// defaultCacheHome keeps the cache in its own subdirectory so it
+// doesn't share a root with the data directory.
+func defaultCacheHome() string {
+	return filepath.Join(localAppData(), "cache")
+}
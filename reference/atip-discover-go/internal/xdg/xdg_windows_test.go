@@ -0,0 +1,57 @@
+//go:build windows
+
+package xdg
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWindowsDefaults(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", "")
+	t.Setenv("XDG_CONFIG_HOME", "")
+	t.Setenv("XDG_CACHE_HOME", "")
+	t.Setenv("APPDATA", `C:\Users\test\AppData\Roaming`)
+	t.Setenv("LOCALAPPDATA", `C:\Users\test\AppData\Local`)
+
+	assert.Equal(t, `C:\Users\test\AppData\Roaming`, ConfigHome())
+	assert.Equal(t, `C:\Users\test\AppData\Local`, DataHome())
+	assert.Equal(t, `C:\Users\test\AppData\Local\cache`, CacheHome())
+	assert.Equal(t, `C:\Users\test\AppData\Roaming\agent-tools`, AgentToolsConfigDir())
+	assert.Equal(t, `C:\Users\test\AppData\Local\agent-tools`, AgentToolsDataDir())
+	assert.Equal(t, `C:\Users\test\AppData\Local\cache\agent-tools`, AgentToolsCacheDir())
+}
+
+func TestWindowsXDGOverrides(t *testing.T) {
+	t.Setenv("APPDATA", `C:\Users\test\AppData\Roaming`)
+	t.Setenv("LOCALAPPDATA", `C:\Users\test\AppData\Local`)
+	t.Setenv("XDG_DATA_HOME", `D:\xdg\data`)
+	t.Setenv("XDG_CONFIG_HOME", `D:\xdg\config`)
+	t.Setenv("XDG_CACHE_HOME", `D:\xdg\cache`)
+
+	assert.Equal(t, `D:\xdg\data`, DataHome())
+	assert.Equal(t, `D:\xdg\config`, ConfigHome())
+	assert.Equal(t, `D:\xdg\cache`, CacheHome())
+}
+
+func TestWindowsFallbackToUserProfile(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", "")
+	t.Setenv("XDG_CONFIG_HOME", "")
+	t.Setenv("XDG_CACHE_HOME", "")
+	t.Setenv("APPDATA", "")
+	t.Setenv("LOCALAPPDATA", "")
+	t.Setenv("USERPROFILE", `C:\Users\test`)
+
+	assert.Equal(t, filepath.Join(`C:\Users\test`, "AppData", "Roaming"), ConfigHome())
+	assert.Equal(t, filepath.Join(`C:\Users\test`, "AppData", "Local"), DataHome())
+	assert.Equal(t, filepath.Join(`C:\Users\test`, "AppData", "Local", "cache"), CacheHome())
+}
+
+func TestWindowsExpandTilde(t *testing.T) {
+	t.Setenv("USERPROFILE", `C:\Users\test`)
+
+	assert.Equal(t, `C:\Users\test`, ExpandTilde("~"))
+	assert.Equal(t, filepath.Join(`C:\Users\test`, "bin"), ExpandTilde("~/bin"))
+}
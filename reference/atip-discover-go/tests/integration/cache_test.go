@@ -0,0 +1,46 @@
+package integration
+
+import (
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestCachePrune tests that stale metadata for unregistered tools is evicted
+func TestCachePrune(t *testing.T) {
+	binary := getBinaryPath(t)
+
+	tmpDir := t.TempDir()
+	toolsCache := filepath.Join(tmpDir, "cache", "agent-tools", "tools")
+	require.NoError(t, os.MkdirAll(toolsCache, 0755))
+
+	stale := filepath.Join(toolsCache, "removed-tool.json")
+	require.NoError(t, os.WriteFile(stale, []byte(`{"name":"removed-tool"}`), 0644))
+	old := time.Now().Add(-72 * time.Hour)
+	require.NoError(t, os.Chtimes(stale, old, old))
+
+	cmd := exec.Command(binary, "cache", "prune", "-o", "json")
+	cmd.Env = append(os.Environ(),
+		"XDG_DATA_HOME="+filepath.Join(tmpDir, "data"),
+		"XDG_CONFIG_HOME="+filepath.Join(tmpDir, "config"),
+		"XDG_CACHE_HOME="+filepath.Join(tmpDir, "cache"),
+	)
+	output, err := cmd.Output()
+	require.NoError(t, err)
+
+	var result struct {
+		Removed        []string `json:"removed"`
+		BytesReclaimed int64    `json:"bytes_reclaimed"`
+	}
+	require.NoError(t, json.Unmarshal(output, &result))
+
+	assert.Equal(t, []string{"removed-tool.json"}, result.Removed)
+	assert.Equal(t, int64(len(`{"name":"removed-tool"}`)), result.BytesReclaimed)
+	assert.NoFileExists(t, stale)
+}
@@ -0,0 +1,123 @@
+package integration
+
+import (
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type configShowResult struct {
+	Config struct {
+		Discovery struct {
+			ScanTimeout string   `json:"scan_timeout"`
+			Parallelism int      `json:"parallelism"`
+			SkipList    []string `json:"skip_list"`
+		} `json:"discovery"`
+	} `json:"config"`
+	Sources map[string]string `json:"sources"`
+}
+
+// isolatedConfigEnv returns an environment with an isolated config directory
+// holding content as config.json
+func isolatedConfigEnv(t *testing.T, content string, extra ...string) []string {
+	t.Helper()
+	tmpDir := t.TempDir()
+	configDir := filepath.Join(tmpDir, "config", "agent-tools")
+	require.NoError(t, os.MkdirAll(configDir, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(configDir, "config.json"), []byte(content), 0644))
+
+	env := append(os.Environ(),
+		"XDG_DATA_HOME="+filepath.Join(tmpDir, "data"),
+		"XDG_CONFIG_HOME="+filepath.Join(tmpDir, "config"),
+	)
+	return append(env, extra...)
+}
+
+// TestConfigShowEnvOverFile tests that environment variables override the config file
+func TestConfigShowEnvOverFile(t *testing.T) {
+	binary := getBinaryPath(t)
+
+	cmd := exec.Command(binary, "config", "show", "-v")
+	cmd.Env = isolatedConfigEnv(t, `{"discovery": {"scan_timeout": "5s", "parallelism": 8}}`,
+		"ATIP_DISCOVER_PARALLEL=6",
+	)
+	output, err := cmd.Output()
+	require.NoError(t, err)
+
+	var result configShowResult
+	require.NoError(t, json.Unmarshal(output, &result))
+
+	assert.Equal(t, 6, result.Config.Discovery.Parallelism)
+	assert.Equal(t, "env", result.Sources["discovery.parallelism"])
+	assert.Equal(t, "5s", result.Config.Discovery.ScanTimeout)
+	assert.Equal(t, "file", result.Sources["discovery.scan_timeout"])
+	assert.Equal(t, "default", result.Sources["cache.max_age"])
+}
+
+// TestConfigShowFlagOverEnv tests that flags override environment variables
+func TestConfigShowFlagOverEnv(t *testing.T) {
+	binary := getBinaryPath(t)
+
+	cmd := exec.Command(binary, "config", "show", "-v", "--parallel", "3", "--timeout", "7s")
+	cmd.Env = isolatedConfigEnv(t, `{"discovery": {"parallelism": 8}}`,
+		"ATIP_DISCOVER_PARALLEL=6",
+		"ATIP_DISCOVER_TIMEOUT=4s",
+	)
+	output, err := cmd.Output()
+	require.NoError(t, err)
+
+	var result configShowResult
+	require.NoError(t, json.Unmarshal(output, &result))
+
+	assert.Equal(t, 3, result.Config.Discovery.Parallelism)
+	assert.Equal(t, "flag", result.Sources["discovery.parallelism"])
+	assert.Equal(t, "7s", result.Config.Discovery.ScanTimeout)
+	assert.Equal(t, "flag", result.Sources["discovery.scan_timeout"])
+}
+
+// TestConfigShowSkipAppends tests that config show --skip adds to the
+// configured skip list, as scan --skip does
+func TestConfigShowSkipAppends(t *testing.T) {
+	binary := getBinaryPath(t)
+
+	cmd := exec.Command(binary, "config", "show", "-v", "--skip", "inline")
+	cmd.Env = isolatedConfigEnv(t, `{"discovery": {"skip_list": ["slow-tool"]}}`)
+	output, err := cmd.Output()
+	require.NoError(t, err)
+
+	var result configShowResult
+	require.NoError(t, json.Unmarshal(output, &result))
+	assert.Equal(t, []string{"slow-tool", "inline"}, result.Config.Discovery.SkipList)
+}
+
+// TestConfigValidate tests that an invalid effective config exits 1
+func TestConfigValidate(t *testing.T) {
+	binary := getBinaryPath(t)
+
+	cmd := exec.Command(binary, "config", "validate")
+	cmd.Env = isolatedConfigEnv(t, `{"output": {"default_format": "table"}}`)
+	output, err := cmd.Output()
+	require.NoError(t, err)
+	assert.Contains(t, string(output), `"valid": true`)
+
+	cmd = exec.Command(binary, "config", "validate")
+	cmd.Env = isolatedConfigEnv(t, `{"output": {"default_format": "xml"}}`)
+	output, err = cmd.Output()
+	require.Error(t, err)
+	exitErr, ok := err.(*exec.ExitError)
+	require.True(t, ok)
+	assert.Equal(t, 1, exitErr.ExitCode())
+
+	var result struct {
+		Valid bool   `json:"valid"`
+		Error string `json:"error"`
+	}
+	require.NoError(t, json.Unmarshal(output, &result))
+	assert.False(t, result.Valid)
+	assert.Contains(t, result.Error, "invalid output format")
+}
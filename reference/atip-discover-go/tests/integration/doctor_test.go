@@ -0,0 +1,112 @@
+package integration
+
+import (
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type doctorReport struct {
+	Healthy  bool     `json:"healthy"`
+	Problems []string `json:"problems"`
+	DataDir  struct {
+		Path     string `json:"path"`
+		Writable bool   `json:"writable"`
+	} `json:"data_dir"`
+	Config struct {
+		Valid bool `json:"valid"`
+	} `json:"config"`
+	SafePaths []struct {
+		Path string `json:"path"`
+		Safe bool   `json:"safe"`
+	} `json:"safe_paths"`
+	Registry struct {
+		Entries int `json:"entries"`
+	} `json:"registry"`
+	Probe *struct {
+		Name    string `json:"name"`
+		OK      bool   `json:"ok"`
+		Version string `json:"version"`
+	} `json:"probe"`
+}
+
+// TestDoctorHealthy tests the doctor report for a working environment
+func TestDoctorHealthy(t *testing.T) {
+	binary := getBinaryPath(t)
+
+	tmpDir := t.TempDir()
+	mockToolsDir := filepath.Join(tmpDir, "mock-bin")
+	require.NoError(t, os.MkdirAll(mockToolsDir, 0755))
+	createMockATIPTool(t, mockToolsDir, "gh", "2.45.0", "GitHub CLI")
+	createMockATIPTool(t, mockToolsDir, "kubectl", "1.29.0", "Kubernetes CLI")
+	createMockATIPTool(t, mockToolsDir, "terraform", "1.7.0", "Terraform")
+
+	env := append(os.Environ(),
+		"XDG_DATA_HOME="+filepath.Join(tmpDir, "data"),
+		"XDG_CONFIG_HOME="+filepath.Join(tmpDir, "config"),
+		"ATIP_DISCOVER_SAFE_PATHS="+mockToolsDir,
+	)
+
+	cmd := exec.Command(binary, "scan", "--allow-path="+mockToolsDir)
+	cmd.Env = env
+	_, err := cmd.Output()
+	require.NoError(t, err)
+
+	cmd = exec.Command(binary, "doctor", "-o", "json")
+	cmd.Env = env
+	output, err := cmd.Output()
+	require.NoError(t, err)
+
+	var report doctorReport
+	require.NoError(t, json.Unmarshal(output, &report))
+
+	assert.True(t, report.Healthy)
+	assert.Empty(t, report.Problems)
+	assert.True(t, report.DataDir.Writable)
+	assert.True(t, report.Config.Valid)
+	require.Len(t, report.SafePaths, 1)
+	assert.Equal(t, mockToolsDir, report.SafePaths[0].Path)
+	assert.True(t, report.SafePaths[0].Safe)
+	assert.Equal(t, 3, report.Registry.Entries)
+	// The sample probe always picks the first tool by name
+	require.NotNil(t, report.Probe)
+	assert.Equal(t, "gh", report.Probe.Name)
+	assert.True(t, report.Probe.OK)
+	assert.Equal(t, "2.45.0", report.Probe.Version)
+}
+
+// TestDoctorUnwritableDataDir tests that doctor fails when the data dir can't be written
+func TestDoctorUnwritableDataDir(t *testing.T) {
+	binary := getBinaryPath(t)
+
+	tmpDir := t.TempDir()
+
+	// A regular file where the data home should be can't be written to,
+	// even when the tests run as root
+	dataHome := filepath.Join(tmpDir, "data")
+	require.NoError(t, os.WriteFile(dataHome, []byte("not a directory"), 0644))
+
+	cmd := exec.Command(binary, "doctor", "-o", "json")
+	cmd.Env = append(os.Environ(),
+		"XDG_DATA_HOME="+dataHome,
+		"XDG_CONFIG_HOME="+filepath.Join(tmpDir, "config"),
+		"ATIP_DISCOVER_SAFE_PATHS="+tmpDir,
+	)
+	output, err := cmd.Output()
+
+	var exitErr *exec.ExitError
+	require.ErrorAs(t, err, &exitErr)
+	assert.Equal(t, 1, exitErr.ExitCode())
+
+	var report doctorReport
+	require.NoError(t, json.Unmarshal(output, &report))
+
+	assert.False(t, report.Healthy)
+	assert.False(t, report.DataDir.Writable)
+	assert.NotEmpty(t, report.Problems)
+}
@@ -0,0 +1,162 @@
+package integration
+
+import (
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// errorEnvelope is the JSON error output shared by all commands
+type errorEnvelope struct {
+	Error struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// corruptRegistryEnv returns an isolated environment whose registry.json
+// cannot be parsed
+func corruptRegistryEnv(t *testing.T) []string {
+	t.Helper()
+	env := isolatedConfigEnv(t, `{}`)
+	dataDir := filepath.Join(envValue(env, "XDG_DATA_HOME"), "agent-tools")
+	require.NoError(t, os.MkdirAll(dataDir, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dataDir, "registry.json"), []byte("{not json"), 0644))
+	return env
+}
+
+// envValue returns the last value of key in env
+func envValue(env []string, key string) string {
+	value := ""
+	for _, kv := range env {
+		if v, ok := strings.CutPrefix(kv, key+"="); ok {
+			value = v
+		}
+	}
+	return value
+}
+
+// TestErrorEnvelope tests that every command reports failures as a JSON
+// envelope on stdout under -o json
+func TestErrorEnvelope(t *testing.T) {
+	binary := getBinaryPath(t)
+
+	tests := []struct {
+		name     string
+		args     []string
+		env      func(t *testing.T) []string
+		code     string
+		exitCode int
+	}{
+		{
+			name:     "scan invalid timeout",
+			args:     []string{"scan", "-o", "json", "--timeout", "bogus"},
+			env:      func(t *testing.T) []string { return isolatedConfigEnv(t, `{}`) },
+			code:     "INVALID_TIMEOUT",
+			exitCode: 2,
+		},
+		{
+			name:     "scan missing skip file",
+			args:     []string{"scan", "-o", "json", "--skip-file", "/nonexistent/skip.txt"},
+			env:      func(t *testing.T) []string { return isolatedConfigEnv(t, `{}`) },
+			code:     "INVALID_SKIP_LIST",
+			exitCode: 2,
+		},
+		{
+			name:     "scan corrupt registry",
+			args:     []string{"scan", "-o", "json", "--allow-path", os.TempDir()},
+			env:      corruptRegistryEnv,
+			code:     "REGISTRY_LOAD_FAILED",
+			exitCode: 2,
+		},
+		{
+			name:     "list corrupt registry",
+			args:     []string{"list", "-o", "json"},
+			env:      corruptRegistryEnv,
+			code:     "REGISTRY_LOAD_FAILED",
+			exitCode: 2,
+		},
+		{
+			name:     "list interactive without a terminal",
+			args:     []string{"list", "-o", "json", "--interactive"},
+			env:      func(t *testing.T) []string { return isolatedConfigEnv(t, `{}`) },
+			code:     "NOT_A_TERMINAL",
+			exitCode: 2,
+		},
+		{
+			name:     "get missing tool name",
+			args:     []string{"get", "-o", "json"},
+			env:      func(t *testing.T) []string { return isolatedConfigEnv(t, `{}`) },
+			code:     "INVALID_ARGUMENT",
+			exitCode: 2,
+		},
+		{
+			name:     "get unknown tool",
+			args:     []string{"get", "-o", "json", "nonexistent-tool"},
+			env:      func(t *testing.T) []string { return isolatedConfigEnv(t, `{}`) },
+			code:     "TOOL_NOT_FOUND",
+			exitCode: 1,
+		},
+		{
+			name:     "refresh corrupt registry",
+			args:     []string{"refresh", "-o", "json"},
+			env:      corruptRegistryEnv,
+			code:     "REGISTRY_LOAD_FAILED",
+			exitCode: 2,
+		},
+		{
+			name:     "cache prune corrupt registry",
+			args:     []string{"cache", "prune", "-o", "json"},
+			env:      corruptRegistryEnv,
+			code:     "REGISTRY_LOAD_FAILED",
+			exitCode: 2,
+		},
+		{
+			name: "config show invalid environment",
+			args: []string{"config", "show", "-o", "json"},
+			env: func(t *testing.T) []string {
+				return isolatedConfigEnv(t, `{}`, "ATIP_DISCOVER_TIMEOUT=bogus")
+			},
+			code:     "INVALID_CONFIG",
+			exitCode: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := exec.Command(binary, tt.args...)
+			cmd.Env = tt.env(t)
+			output, err := cmd.Output()
+
+			var exitErr *exec.ExitError
+			require.ErrorAs(t, err, &exitErr)
+			assert.Equal(t, tt.exitCode, exitErr.ExitCode())
+
+			var envelope errorEnvelope
+			require.NoError(t, json.Unmarshal(output, &envelope), "stdout: %s", output)
+			assert.Equal(t, tt.code, envelope.Error.Code)
+			assert.NotEmpty(t, envelope.Error.Message)
+		})
+	}
+}
+
+// TestErrorTextFormat tests that human formats keep the stderr message
+func TestErrorTextFormat(t *testing.T) {
+	binary := getBinaryPath(t)
+
+	cmd := exec.Command(binary, "list", "-o", "table")
+	cmd.Env = corruptRegistryEnv(t)
+	output, err := cmd.Output()
+
+	var exitErr *exec.ExitError
+	require.ErrorAs(t, err, &exitErr)
+	assert.Equal(t, 2, exitErr.ExitCode())
+	assert.Empty(t, output)
+	assert.Contains(t, string(exitErr.Stderr), "Error: Failed to load registry")
+}
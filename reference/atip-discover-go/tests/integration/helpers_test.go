@@ -14,6 +14,20 @@ var (
 	buildErr   error
 )
 
+// TestMain points XDG_CACHE_HOME at a scratch directory so probe caches
+// written by the binary never land in the real user cache.
+func TestMain(m *testing.M) {
+	cacheHome, err := os.MkdirTemp("", "atip-discover-cache-*")
+	if err != nil {
+		panic(err)
+	}
+	os.Setenv("XDG_CACHE_HOME", cacheHome)
+
+	code := m.Run()
+	os.RemoveAll(cacheHome)
+	os.Exit(code)
+}
+
 // getBinaryPath builds the atip-discover binary once and returns its path
 func getBinaryPath(t *testing.T) string {
 	t.Helper()
@@ -0,0 +1,52 @@
+package integration
+
+import (
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestInfoCommand tests that info and --version -o json report build
+// metadata, directories and the registry size
+func TestInfoCommand(t *testing.T) {
+	binary := getBinaryPath(t)
+	env := isolatedConfigEnv(t, `{}`)
+
+	mockToolsDir := filepath.Join(t.TempDir(), "mock-bin")
+	require.NoError(t, os.MkdirAll(mockToolsDir, 0755))
+	createMockATIPTool(t, mockToolsDir, "gh", "2.45.0", "GitHub CLI")
+	cmd := exec.Command(binary, "scan", "--allow-path="+mockToolsDir)
+	cmd.Env = env
+	_, err := cmd.Output()
+	require.NoError(t, err)
+
+	for _, args := range [][]string{{"info"}, {"--version", "-o", "json"}} {
+		t.Run(strings.Join(args, " "), func(t *testing.T) {
+			cmd := exec.Command(binary, args...)
+			cmd.Env = env
+			output, err := cmd.Output()
+			require.NoError(t, err)
+
+			var info map[string]interface{}
+			require.NoError(t, json.Unmarshal(output, &info))
+			assert.Contains(t, info, "commit")
+			assert.Contains(t, info, "build_date")
+			assert.NotEmpty(t, info["version"])
+			assert.True(t, strings.HasPrefix(info["go_version"].(string), "go"), info["go_version"])
+			assert.Equal(t, filepath.Join(envValue(env, "XDG_DATA_HOME"), "agent-tools"), info["data_dir"])
+			assert.Equal(t, filepath.Join(envValue(env, "XDG_CONFIG_HOME"), "agent-tools"), info["config_dir"])
+			assert.Equal(t, float64(1), info["registry_entries"])
+		})
+	}
+
+	// The plain version line is unchanged
+	output, err := exec.Command(binary, "--version").Output()
+	require.NoError(t, err)
+	assert.Regexp(t, `^atip-discover \S+\n$`, string(output))
+}
@@ -0,0 +1,118 @@
+package integration
+
+import (
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// createTrackedATIPTool creates a mock ATIP tool that touches marker each
+// time it is executed
+func createTrackedATIPTool(t *testing.T, dir, name, marker string) {
+	t.Helper()
+	script := `#!/bin/sh
+touch '` + marker + `'
+echo '{"atip": {"version": "0.6"}, "name": "` + name + `", "version": "1.0.0", "description": "Tracked tool"}'
+`
+	require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(script), 0755))
+}
+
+// TestOfflineRefusesToProbe tests that scan and refresh fail in offline mode
+// without executing anything
+func TestOfflineRefusesToProbe(t *testing.T) {
+	binary := getBinaryPath(t)
+
+	mockToolsDir := filepath.Join(t.TempDir(), "mock-bin")
+	require.NoError(t, os.MkdirAll(mockToolsDir, 0755))
+	marker := filepath.Join(t.TempDir(), "executed")
+	createTrackedATIPTool(t, mockToolsDir, "tracked", marker)
+
+	tests := []struct {
+		name  string
+		args  []string
+		extra []string
+	}{
+		{name: "scan flag", args: []string{"scan", "--allow-path=" + mockToolsDir, "--offline"}},
+		{name: "scan env", args: []string{"scan", "--allow-path=" + mockToolsDir}, extra: []string{"ATIP_DISCOVER_OFFLINE=1"}},
+		{name: "refresh flag", args: []string{"refresh", "--offline"}},
+		{name: "registry diff env", args: []string{"registry", "diff", "http://127.0.0.1:1"}, extra: []string{"ATIP_DISCOVER_OFFLINE=true"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := exec.Command(binary, append(tt.args, "-o", "json")...)
+			cmd.Env = isolatedConfigEnv(t, `{}`, tt.extra...)
+			output, err := cmd.Output()
+
+			var exitErr *exec.ExitError
+			require.ErrorAs(t, err, &exitErr)
+			assert.Equal(t, 2, exitErr.ExitCode())
+
+			var envelope errorEnvelope
+			require.NoError(t, json.Unmarshal(output, &envelope))
+			assert.Equal(t, "OFFLINE", envelope.Error.Code)
+			assert.NoFileExists(t, marker)
+		})
+	}
+
+	// A dry run doesn't probe, so it is allowed
+	cmd := exec.Command(binary, "scan", "--allow-path="+mockToolsDir, "--offline", "--dry-run")
+	cmd.Env = isolatedConfigEnv(t, `{}`)
+	_, err := cmd.Output()
+	require.NoError(t, err)
+	assert.NoFileExists(t, marker)
+}
+
+// TestOfflineReadsCache tests that list, get and doctor work in offline mode
+// from the registry and cache alone
+func TestOfflineReadsCache(t *testing.T) {
+	binary := getBinaryPath(t)
+	env := isolatedConfigEnv(t, `{}`, "XDG_CACHE_HOME="+t.TempDir())
+
+	mockToolsDir := filepath.Join(t.TempDir(), "mock-bin")
+	require.NoError(t, os.MkdirAll(mockToolsDir, 0755))
+	marker := filepath.Join(t.TempDir(), "executed")
+	createTrackedATIPTool(t, mockToolsDir, "tracked", marker)
+
+	cmd := exec.Command(binary, "scan", "--allow-path="+mockToolsDir)
+	cmd.Env = env
+	_, err := cmd.Output()
+	require.NoError(t, err)
+	require.FileExists(t, marker)
+	require.NoError(t, os.Remove(marker))
+
+	run := func(args ...string) []byte {
+		cmd := exec.Command(binary, args...)
+		cmd.Env = env
+		output, err := cmd.Output()
+		require.NoError(t, err)
+		return output
+	}
+
+	var list struct {
+		Count int `json:"count"`
+		Tools []struct {
+			Name        string `json:"name"`
+			Description string `json:"description"`
+		} `json:"tools"`
+	}
+	require.NoError(t, json.Unmarshal(run("list", "--offline", "-o", "json"), &list))
+	require.Equal(t, 1, list.Count)
+	assert.Equal(t, "tracked", list.Tools[0].Name)
+	assert.Equal(t, "Tracked tool", list.Tools[0].Description)
+
+	var metadata map[string]interface{}
+	require.NoError(t, json.Unmarshal(run("get", "--offline", "tracked"), &metadata))
+	assert.Equal(t, "tracked", metadata["name"])
+
+	var report map[string]interface{}
+	require.NoError(t, json.Unmarshal(run("doctor", "--offline", "-o", "json"), &report))
+	assert.NotContains(t, report, "probe")
+
+	assert.NoFileExists(t, marker)
+}
@@ -0,0 +1,110 @@
+package integration
+
+import (
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestScanOutputFile tests that --output-file receives the same result that
+// would otherwise go to stdout
+func TestScanOutputFile(t *testing.T) {
+	binary := getBinaryPath(t)
+
+	tmpDir := t.TempDir()
+	mockToolsDir := filepath.Join(tmpDir, "mock-bin")
+	require.NoError(t, os.MkdirAll(mockToolsDir, 0755))
+	createMockATIPTool(t, mockToolsDir, "gh", "2.45.0", "GitHub CLI")
+	createMockATIPTool(t, mockToolsDir, "kubectl", "1.28.0", "Kubernetes CLI")
+
+	type scanResult struct {
+		Discovered int `json:"discovered"`
+		Tools      []struct {
+			Name    string `json:"name"`
+			Version string `json:"version"`
+		} `json:"tools"`
+	}
+
+	// Scan to stdout and to a file, each against a fresh registry
+	cmd := exec.Command(binary, "scan", "--allow-path="+mockToolsDir, "-o", "json")
+	cmd.Env = append(os.Environ(), "XDG_DATA_HOME="+filepath.Join(tmpDir, "data-stdout"))
+	stdout, err := cmd.Output()
+	require.NoError(t, err)
+
+	outDir := filepath.Join(tmpDir, "out")
+	require.NoError(t, os.MkdirAll(outDir, 0755))
+	outFile := filepath.Join(outDir, "scan.json")
+	cmd = exec.Command(binary, "scan", "--allow-path="+mockToolsDir, "-o", "json", "--output-file", outFile)
+	cmd.Env = append(os.Environ(), "XDG_DATA_HOME="+filepath.Join(tmpDir, "data-file"))
+	fileRunStdout, err := cmd.Output()
+	require.NoError(t, err)
+	assert.Empty(t, fileRunStdout)
+
+	data, err := os.ReadFile(outFile)
+	require.NoError(t, err)
+
+	var fromStdout, fromFile scanResult
+	require.NoError(t, json.Unmarshal(stdout, &fromStdout))
+	require.NoError(t, json.Unmarshal(data, &fromFile))
+	assert.Equal(t, 2, fromFile.Discovered)
+	assert.ElementsMatch(t, fromStdout.Tools, fromFile.Tools)
+
+	// Only the result is left behind, no temporary files
+	entries, err := os.ReadDir(outDir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
+
+// TestListOutputFile tests that list writes identical bytes to a file
+func TestListOutputFile(t *testing.T) {
+	binary := getBinaryPath(t)
+	env := isolatedConfigEnv(t, `{}`)
+
+	mockToolsDir := filepath.Join(t.TempDir(), "mock-bin")
+	require.NoError(t, os.MkdirAll(mockToolsDir, 0755))
+	createMockATIPTool(t, mockToolsDir, "gh", "2.45.0", "GitHub CLI")
+	cmd := exec.Command(binary, "scan", "--allow-path="+mockToolsDir)
+	cmd.Env = env
+	_, err := cmd.Output()
+	require.NoError(t, err)
+
+	outFile := filepath.Join(t.TempDir(), "list.json")
+	cmd = exec.Command(binary, "list", "-o", "json", "--output-file", outFile)
+	cmd.Env = env
+	_, err = cmd.Output()
+	require.NoError(t, err)
+
+	cmd = exec.Command(binary, "list", "-o", "json")
+	cmd.Env = env
+	stdout, err := cmd.Output()
+	require.NoError(t, err)
+
+	data, err := os.ReadFile(outFile)
+	require.NoError(t, err)
+	assert.Equal(t, string(stdout), string(data))
+}
+
+// TestOutputFileUnwritable tests that an output file that can't be created
+// is reported as an error
+func TestOutputFileUnwritable(t *testing.T) {
+	binary := getBinaryPath(t)
+
+	outFile := filepath.Join(t.TempDir(), "missing", "list.json")
+	cmd := exec.Command(binary, "list", "-o", "json", "--output-file", outFile)
+	cmd.Env = isolatedConfigEnv(t, `{}`)
+	output, err := cmd.Output()
+
+	var exitErr *exec.ExitError
+	require.ErrorAs(t, err, &exitErr)
+	assert.Equal(t, 2, exitErr.ExitCode())
+
+	var envelope errorEnvelope
+	require.NoError(t, json.Unmarshal(output, &envelope))
+	assert.Equal(t, "OUTPUT_FILE_FAILED", envelope.Error.Code)
+	assert.NoFileExists(t, outFile)
+}
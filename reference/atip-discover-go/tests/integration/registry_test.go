@@ -0,0 +1,324 @@
+package integration
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestRegistryDiff tests that registry diff reports tools that are missing,
+// outdated or only known locally compared to a remote catalog
+func TestRegistryDiff(t *testing.T) {
+	binary := getBinaryPath(t)
+	env := isolatedConfigEnv(t, `{}`)
+
+	// Seed the local registry
+	mockToolsDir := filepath.Join(t.TempDir(), "mock-bin")
+	require.NoError(t, os.MkdirAll(mockToolsDir, 0755))
+	createMockATIPTool(t, mockToolsDir, "gh", "2.45.0", "GitHub CLI")
+	createMockATIPTool(t, mockToolsDir, "kubectl", "1.28.0", "Kubernetes CLI")
+	createMockATIPTool(t, mockToolsDir, "mytool", "0.1.0", "Local tool")
+	cmd := exec.Command(binary, "scan", "--allow-path="+mockToolsDir)
+	cmd.Env = env
+	_, err := cmd.Output()
+	require.NoError(t, err)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/shims/index.json" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{
+			"version": "1",
+			"tools": {
+				"gh": {"description": "GitHub CLI", "versions": {"2.45.0": {}, "2.46.0": {}}},
+				"kubectl": {"description": "Kubernetes CLI", "versions": {"1.28.0": {}}},
+				"jq": {"description": "JSON processor", "versions": {"1.7.1": {"linux-amd64": "sha256:abc"}}}
+			}
+		}`))
+	}))
+	defer server.Close()
+
+	cmd = exec.Command(binary, "registry", "diff", "-o", "json", server.URL)
+	cmd.Env = env
+	output, err := cmd.Output()
+	require.NoError(t, err)
+
+	var result struct {
+		Registry  string `json:"registry"`
+		Missing   int    `json:"missing"`
+		Outdated  int    `json:"outdated"`
+		LocalOnly int    `json:"local_only"`
+		Tools     []struct {
+			Name          string `json:"name"`
+			Status        string `json:"status"`
+			LocalVersion  string `json:"local_version"`
+			RemoteVersion string `json:"remote_version"`
+		} `json:"tools"`
+	}
+	require.NoError(t, json.Unmarshal(output, &result))
+
+	assert.Equal(t, server.URL, result.Registry)
+	assert.Equal(t, 1, result.Missing)
+	assert.Equal(t, 1, result.Outdated)
+	assert.Equal(t, 1, result.LocalOnly)
+	require.Len(t, result.Tools, 3)
+	assert.Equal(t, "gh", result.Tools[0].Name)
+	assert.Equal(t, "outdated", result.Tools[0].Status)
+	assert.Equal(t, "2.45.0", result.Tools[0].LocalVersion)
+	assert.Equal(t, "2.46.0", result.Tools[0].RemoteVersion)
+	assert.Equal(t, "jq", result.Tools[1].Name)
+	assert.Equal(t, "missing", result.Tools[1].Status)
+	assert.Equal(t, "mytool", result.Tools[2].Name)
+	assert.Equal(t, "local_only", result.Tools[2].Status)
+}
+
+// TestRegistryDiffUpToDate tests that an unchanged catalog is revalidated
+// with its ETag and the previous diff reused
+func TestRegistryDiffUpToDate(t *testing.T) {
+	binary := getBinaryPath(t)
+	env := isolatedConfigEnv(t, `{}`, "XDG_CACHE_HOME="+t.TempDir())
+
+	mockToolsDir := filepath.Join(t.TempDir(), "mock-bin")
+	require.NoError(t, os.MkdirAll(mockToolsDir, 0755))
+	createMockATIPTool(t, mockToolsDir, "gh", "2.45.0", "GitHub CLI")
+	cmd := exec.Command(binary, "scan", "--allow-path="+mockToolsDir)
+	cmd.Env = env
+	_, err := cmd.Output()
+	require.NoError(t, err)
+
+	var full, notModified int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/shims/index.json" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("ETag", `"catalog-1"`)
+		if r.Header.Get("If-None-Match") == `"catalog-1"` {
+			notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		full++
+		w.Write([]byte(`{
+			"version": "1",
+			"tools": {
+				"gh": {"description": "GitHub CLI", "versions": {"2.46.0": {}}},
+				"jq": {"description": "JSON processor", "versions": {"1.7.1": {}}}
+			}
+		}`))
+	}))
+	defer server.Close()
+
+	type diffResult struct {
+		UpToDate bool `json:"up_to_date"`
+		Missing  int  `json:"missing"`
+		Outdated int  `json:"outdated"`
+		Tools    []struct {
+			Name   string `json:"name"`
+			Status string `json:"status"`
+		} `json:"tools"`
+	}
+	diff := func() diffResult {
+		t.Helper()
+		cmd := exec.Command(binary, "registry", "diff", "-o", "json", server.URL)
+		cmd.Env = env
+		output, err := cmd.Output()
+		require.NoError(t, err)
+		var result diffResult
+		require.NoError(t, json.Unmarshal(output, &result))
+		return result
+	}
+
+	first := diff()
+	assert.False(t, first.UpToDate)
+	assert.Equal(t, 1, first.Missing)
+	assert.Equal(t, 1, first.Outdated)
+
+	second := diff()
+	assert.True(t, second.UpToDate)
+	assert.Equal(t, first.Tools, second.Tools)
+	assert.Equal(t, first.Missing, second.Missing)
+	assert.Equal(t, first.Outdated, second.Outdated)
+	assert.Equal(t, 1, full)
+	assert.Equal(t, 1, notModified)
+}
+
+// TestRegistryDiffFetchFailed tests that an unreachable registry is reported
+// in the error envelope
+func TestRegistryDiffFetchFailed(t *testing.T) {
+	binary := getBinaryPath(t)
+
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+
+	cmd := exec.Command(binary, "registry", "diff", "-o", "json", server.URL)
+	cmd.Env = isolatedConfigEnv(t, `{}`)
+	output, err := cmd.Output()
+
+	var exitErr *exec.ExitError
+	require.ErrorAs(t, err, &exitErr)
+	assert.Equal(t, 2, exitErr.ExitCode())
+
+	var envelope errorEnvelope
+	require.NoError(t, json.Unmarshal(output, &envelope))
+	assert.Equal(t, "REGISTRY_FETCH_FAILED", envelope.Error.Code)
+}
+
+// TestRegistrySubcommandRequired tests that registry without a known
+// subcommand fails as an invalid argument, naming the subcommands
+func TestRegistrySubcommandRequired(t *testing.T) {
+	binary := getBinaryPath(t)
+
+	for _, args := range [][]string{{"registry"}, {"registry", "bogus"}} {
+		cmd := exec.Command(binary, args...)
+		cmd.Env = isolatedConfigEnv(t, `{}`)
+		var stderr strings.Builder
+		cmd.Stderr = &stderr
+		err := cmd.Run()
+
+		var exitErr *exec.ExitError
+		require.ErrorAs(t, err, &exitErr, args)
+		assert.Equal(t, 2, exitErr.ExitCode(), args)
+		assert.Contains(t, stderr.String(), "diff|export|import|load-shims", args)
+	}
+}
+
+// registryShim is a shim as an atip-registry serves it: addressed by, and
+// declaring, the hash of the binary it describes rather than its own.
+func registryShim(name, version, platform, digest string) string {
+	return `{"atip": {"version": "0.6"}, "binary": {"hash": "sha256:` + digest + `", "name": "` + name + `", "version": "` + version + `", "platform": "` + platform + `"}, "name": "` + name + `", "version": "` + version + `", "description": "JSON processor", "commands": {}}`
+}
+
+// TestGetRegistry tests that get --registry fetches a tool's shim from a
+// remote registry and caches it for offline use
+func TestGetRegistry(t *testing.T) {
+	binary := getBinaryPath(t)
+	env := isolatedConfigEnv(t, `{}`, "XDG_CACHE_HOME="+t.TempDir())
+
+	digest := strings.Repeat("a1b2", 16)
+	shim := registryShim("jq", "1.7.1", "linux-amd64", digest)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/shims/index.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"version": "1", "tools": {"jq": {"description": "JSON processor", "versions": {"1.7.1": {"linux-amd64": "sha256:` + digest + `"}}}}}`))
+	})
+	mux.HandleFunc("/shims/sha256/"+digest+".json", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(shim))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	cmd := exec.Command(binary, "get", "jq", "--registry", server.URL, "--platform", "linux-amd64")
+	cmd.Env = env
+	output, err := cmd.Output()
+	require.NoError(t, err)
+
+	var metadata map[string]interface{}
+	require.NoError(t, json.Unmarshal(output, &metadata))
+	assert.Equal(t, "jq", metadata["name"])
+	assert.Equal(t, "1.7.1", metadata["version"])
+
+	// The shim is cached for offline use
+	server.Close()
+	cmd = exec.Command(binary, "get", "jq", "--offline")
+	cmd.Env = env
+	output, err = cmd.Output()
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(output, &metadata))
+	assert.Equal(t, "JSON processor", metadata["description"])
+
+	cmd = exec.Command(binary, "list", "--source", "shim")
+	cmd.Env = env
+	output, err = cmd.Output()
+	require.NoError(t, err)
+	assert.Contains(t, string(output), `"jq"`)
+}
+
+// TestGetRegistryETag tests that the ETag of a shim fetched with get
+// --registry is the one later offline reads of the cached copy report
+func TestGetRegistryETag(t *testing.T) {
+	binary := getBinaryPath(t)
+	env := isolatedConfigEnv(t, `{}`, "XDG_CACHE_HOME="+t.TempDir())
+
+	// Compact, with the atip version as a string, so the cached copy is
+	// rewritten rather than stored byte for byte
+	digest := strings.Repeat("a1b2", 16)
+	shim := `{"atip":"0.6","binary":{"hash":"sha256:` + digest + `","name":"jq","version":"1.7.1","platform":"linux-amd64"},"name":"jq","version":"1.7.1","description":"JSON processor","commands":{}}`
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/shims/index.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"version": "1", "tools": {"jq": {"description": "JSON processor", "versions": {"1.7.1": {"linux-amd64": "sha256:` + digest + `"}}}}}`))
+	})
+	mux.HandleFunc("/shims/sha256/"+digest+".json", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(shim))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	run := func(args ...string) []byte {
+		cmd := exec.Command(binary, args...)
+		cmd.Env = env
+		output, err := cmd.Output()
+		require.NoError(t, err, args)
+		return output
+	}
+	var remote struct {
+		ETag string `json:"etag"`
+	}
+	require.NoError(t, json.Unmarshal(run("get", "jq", "--registry", server.URL, "--platform", "linux-amd64", "--etag-only"), &remote))
+	assert.Regexp(t, `^sha256:[0-9a-f]{64}$`, remote.ETag)
+	raw := sha256.Sum256([]byte(shim))
+	assert.NotEqual(t, "sha256:"+hex.EncodeToString(raw[:]), remote.ETag, "ETag of the cached form, not the raw bytes")
+	server.Close()
+
+	var local struct {
+		ETag string `json:"etag"`
+	}
+	require.NoError(t, json.Unmarshal(run("get", "jq", "--offline", "--etag-only"), &local))
+	assert.Equal(t, remote.ETag, local.ETag)
+	assert.Contains(t, string(run("list", "--source", "shim")), `"etag": "`+remote.ETag+`"`)
+
+	cmd := exec.Command(binary, "get", "jq", "--offline", "--if-none-match", remote.ETag)
+	cmd.Env = env
+	var exitErr *exec.ExitError
+	require.ErrorAs(t, cmd.Run(), &exitErr)
+	assert.Equal(t, 5, exitErr.ExitCode())
+}
+
+// TestGetRegistryNotFound tests that a tool missing from the remote catalog
+// is reported in the error envelope
+func TestGetRegistryNotFound(t *testing.T) {
+	binary := getBinaryPath(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/shims/index.json" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"version": "1", "tools": {}}`))
+	}))
+	defer server.Close()
+
+	cmd := exec.Command(binary, "get", "jq", "--registry", server.URL)
+	cmd.Env = isolatedConfigEnv(t, `{}`, "XDG_CACHE_HOME="+t.TempDir())
+	output, err := cmd.Output()
+
+	var exitErr *exec.ExitError
+	require.ErrorAs(t, err, &exitErr)
+	assert.Equal(t, 1, exitErr.ExitCode())
+
+	var envelope errorEnvelope
+	require.NoError(t, json.Unmarshal(output, &envelope))
+	assert.Equal(t, "TOOL_NOT_FOUND", envelope.Error.Code)
+}
@@ -1,10 +1,19 @@
 package integration
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
@@ -147,6 +156,266 @@ func TestListCommand(t *testing.T) {
 	assert.Len(t, result.Tools, 2)
 }
 
+// TestCompactOutput tests that --compact writes the same JSON as the
+// default, minified on one line
+func TestCompactOutput(t *testing.T) {
+	binary := getBinaryPath(t)
+
+	tmpDir := t.TempDir()
+	mockToolsDir := filepath.Join(tmpDir, "mock-bin")
+	require.NoError(t, os.MkdirAll(mockToolsDir, 0755))
+	createMockATIPTool(t, mockToolsDir, "gh", "2.45.0", "GitHub CLI")
+	createMockATIPTool(t, mockToolsDir, "kubectl", "1.28.0", "Kubernetes CLI")
+
+	env := isolatedConfigEnv(t, `{}`, "XDG_CACHE_HOME="+t.TempDir())
+	run := func(args ...string) []byte {
+		cmd := exec.Command(binary, args...)
+		cmd.Env = env
+		output, _ := cmd.Output()
+		return output
+	}
+	run("scan", "--allow-path="+mockToolsDir)
+
+	for _, args := range [][]string{
+		{"list", "-o", "json"},
+		{"get", "gh", "-o", "json"},
+		{"registry", "export"},
+		{"get", "nonexistent-tool", "-o", "json"}, // The error envelope
+	} {
+		pretty := run(args...)
+		compact := run(append(args, "--compact")...)
+
+		assert.Contains(t, string(pretty), "\n  ", args)
+		assert.Equal(t, 1, bytes.Count(compact, []byte("\n")), args)
+		assert.NotContains(t, string(compact), "  ", args)
+
+		var fromPretty, fromCompact interface{}
+		require.NoError(t, json.Unmarshal(pretty, &fromPretty), args)
+		require.NoError(t, json.Unmarshal(compact, &fromCompact), args)
+		assert.Equal(t, fromPretty, fromCompact, args)
+	}
+}
+
+// TestGetConditional tests that get's ETag is stable while the metadata is
+// unchanged and that a matching --if-none-match exits 5 without output
+func TestGetConditional(t *testing.T) {
+	binary := getBinaryPath(t)
+
+	tmpDir := t.TempDir()
+	mockToolsDir := filepath.Join(tmpDir, "mock-bin")
+	require.NoError(t, os.MkdirAll(mockToolsDir, 0755))
+	createMockATIPTool(t, mockToolsDir, "gh", "2.45.0", "GitHub CLI")
+
+	env := isolatedConfigEnv(t, `{}`, "XDG_CACHE_HOME="+t.TempDir())
+	run := func(args ...string) ([]byte, int) {
+		cmd := exec.Command(binary, args...)
+		cmd.Env = env
+		output, err := cmd.Output()
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return output, exitErr.ExitCode()
+		}
+		require.NoError(t, err)
+		return output, 0
+	}
+	etagOf := func() string {
+		output, code := run("get", "gh", "--etag-only")
+		require.Equal(t, 0, code, string(output))
+		var result struct {
+			Name string `json:"name"`
+			ETag string `json:"etag"`
+		}
+		require.NoError(t, json.Unmarshal(output, &result))
+		assert.Equal(t, "gh", result.Name)
+		return result.ETag
+	}
+
+	run("scan", "--allow-path="+mockToolsDir)
+	etag := etagOf()
+	assert.Regexp(t, `^sha256:[0-9a-f]{64}$`, etag)
+	assert.Equal(t, etag, etagOf(), "ETag must be stable")
+
+	quiet, _ := run("get", "gh", "--etag-only", "-o", "quiet")
+	assert.Equal(t, etag+"\n", string(quiet))
+	list, _ := run("list")
+	assert.Contains(t, string(list), `"etag": "`+etag+`"`)
+
+	// A matching ETag short-circuits, without touching --output-file
+	outFile := filepath.Join(tmpDir, "gh.json")
+	for _, ifNoneMatch := range []string{etag, `W/"` + etag + `"`, "sha256:other, " + etag, "*"} {
+		output, code := run("get", "gh", "--if-none-match", ifNoneMatch, "--output-file", outFile)
+		assert.Equal(t, 5, code, ifNoneMatch)
+		assert.Empty(t, output, ifNoneMatch)
+		assert.NoFileExists(t, outFile)
+	}
+
+	// Otherwise the metadata is printed as usual
+	output, code := run("get", "gh", "--if-none-match", "sha256:other")
+	assert.Equal(t, 0, code)
+	assert.Contains(t, string(output), `"name": "gh"`)
+
+	// Changed metadata gets a new ETag
+	createMockATIPTool(t, mockToolsDir, "gh", "2.46.0", "GitHub CLI")
+	run("scan", "--allow-path="+mockToolsDir)
+	assert.NotEqual(t, etag, etagOf())
+	_, code = run("get", "gh", "--if-none-match", etag)
+	assert.Equal(t, 0, code)
+}
+
+// TestListSort tests that scan and list output is sorted and that list
+// --sort changes the order
+func TestListSort(t *testing.T) {
+	binary := getBinaryPath(t)
+	env := isolatedConfigEnv(t, `{}`)
+
+	mockToolsDir := filepath.Join(t.TempDir(), "mock-bin")
+	require.NoError(t, os.MkdirAll(mockToolsDir, 0755))
+	createMockATIPTool(t, mockToolsDir, "kubectl", "1.28.0", "Kubernetes CLI")
+	createMockATIPTool(t, mockToolsDir, "gh", "2.45.0", "GitHub CLI")
+	createMockATIPTool(t, mockToolsDir, "jq", "1.7.1", "JSON processor")
+	createMockATIPTool(t, mockToolsDir, "aws", "2.15.0", "AWS CLI")
+
+	names := func(args ...string) []string {
+		cmd := exec.Command(binary, args...)
+		cmd.Env = env
+		output, err := cmd.Output()
+		require.NoError(t, err)
+		var result struct {
+			Tools []struct {
+				Name string `json:"name"`
+			} `json:"tools"`
+		}
+		require.NoError(t, json.Unmarshal(output, &result))
+		var names []string
+		for _, tool := range result.Tools {
+			names = append(names, tool.Name)
+		}
+		return names
+	}
+
+	assert.Equal(t, []string{"aws", "gh", "jq", "kubectl"}, names("scan", "--allow-path="+mockToolsDir, "--parallel", "4", "-o", "json"))
+	assert.Equal(t, []string{"aws", "gh", "jq", "kubectl"}, names("list", "-o", "json"))
+	assert.Equal(t, []string{"aws", "gh", "jq", "kubectl"}, names("list", "--sort", "name", "-o", "json"))
+	assert.Equal(t, []string{"jq", "kubectl", "aws", "gh"}, names("list", "--sort", "version", "-o", "json"))
+
+	cmd := exec.Command(binary, "list", "--sort", "size", "-o", "json")
+	cmd.Env = env
+	output, err := cmd.Output()
+	var exitErr *exec.ExitError
+	require.ErrorAs(t, err, &exitErr)
+	assert.Equal(t, 2, exitErr.ExitCode())
+	var envelope errorEnvelope
+	require.NoError(t, json.Unmarshal(output, &envelope))
+	assert.Equal(t, "INVALID_ARGUMENT", envelope.Error.Code)
+}
+
+// TestScanAtipVersionRange tests that tools outside --min-atip-version and
+// --max-atip-version are registered but flagged, and that legacy metadata is
+// cached in the object form
+func TestScanAtipVersionRange(t *testing.T) {
+	binary := getBinaryPath(t)
+	env := isolatedConfigEnv(t, `{}`, "XDG_CACHE_HOME="+t.TempDir())
+
+	mockToolsDir := filepath.Join(t.TempDir(), "mock-bin")
+	require.NoError(t, os.MkdirAll(mockToolsDir, 0755))
+	createMockATIPTool(t, mockToolsDir, "gh", "2.45.0", "GitHub CLI")
+	legacy := `#!/bin/sh
+echo '{"atip": "0.3", "name": "old-tool", "version": "1.0.0", "description": "Legacy tool"}'
+`
+	require.NoError(t, os.WriteFile(filepath.Join(mockToolsDir, "old-tool"), []byte(legacy), 0755))
+
+	run := func(args ...string) []byte {
+		cmd := exec.Command(binary, args...)
+		cmd.Env = env
+		output, err := cmd.Output()
+		require.NoError(t, err)
+		return output
+	}
+
+	type toolsResult struct {
+		Unsupported int `json:"unsupported"`
+		Tools       []struct {
+			Name        string `json:"name"`
+			AtipVersion string `json:"atip_version"`
+			Unsupported bool   `json:"unsupported"`
+		} `json:"tools"`
+	}
+
+	var scan toolsResult
+	require.NoError(t, json.Unmarshal(run("scan", "--allow-path="+mockToolsDir, "--min-atip-version", "0.4", "-o", "json"), &scan))
+	assert.Equal(t, 1, scan.Unsupported)
+	require.Len(t, scan.Tools, 2)
+	assert.Equal(t, "gh", scan.Tools[0].Name)
+	assert.False(t, scan.Tools[0].Unsupported)
+	assert.Equal(t, "old-tool", scan.Tools[1].Name)
+	assert.Equal(t, "0.3", scan.Tools[1].AtipVersion)
+	assert.True(t, scan.Tools[1].Unsupported)
+
+	var list toolsResult
+	require.NoError(t, json.Unmarshal(run("list", "-o", "json"), &list))
+	require.Len(t, list.Tools, 2)
+	assert.True(t, list.Tools[1].Unsupported)
+
+	var metadata map[string]interface{}
+	require.NoError(t, json.Unmarshal(run("get", "old-tool"), &metadata))
+	assert.Equal(t, map[string]interface{}{"version": "0.3"}, metadata["atip"])
+
+	cmd := exec.Command(binary, "scan", "--allow-path="+mockToolsDir, "--max-atip-version", "latest", "-o", "json")
+	cmd.Env = env
+	_, err := cmd.Output()
+	var exitErr *exec.ExitError
+	require.ErrorAs(t, err, &exitErr)
+	assert.Equal(t, 2, exitErr.ExitCode())
+}
+
+// TestListPlatformFilter tests that scan records each tool's platform and
+// list --platform filters on it
+func TestListPlatformFilter(t *testing.T) {
+	binary := getBinaryPath(t)
+	env := isolatedConfigEnv(t, `{}`)
+
+	mockToolsDir := filepath.Join(t.TempDir(), "mock-bin")
+	require.NoError(t, os.MkdirAll(mockToolsDir, 0755))
+	createMockATIPTool(t, mockToolsDir, "gh", "2.45.0", "GitHub CLI")
+
+	cmd := exec.Command(binary, "scan", "--allow-path="+mockToolsDir)
+	cmd.Env = env
+	_, err := cmd.Output()
+	require.NoError(t, err)
+
+	hostPlatform := runtime.GOOS + "-" + runtime.GOARCH
+	tests := []struct {
+		platform string
+		count    int
+	}{
+		{platform: hostPlatform, count: 1},
+		{platform: "all", count: 1},
+		{platform: "plan9-mips", count: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.platform, func(t *testing.T) {
+			cmd := exec.Command(binary, "list", "-o", "json", "--platform", tt.platform)
+			cmd.Env = env
+			output, err := cmd.Output()
+			require.NoError(t, err)
+
+			var result struct {
+				Count int `json:"count"`
+				Tools []struct {
+					Name     string `json:"name"`
+					Platform string `json:"platform"`
+				} `json:"tools"`
+			}
+			require.NoError(t, json.Unmarshal(output, &result))
+			assert.Equal(t, tt.count, result.Count)
+			for _, tool := range result.Tools {
+				assert.Equal(t, hostPlatform, tool.Platform)
+			}
+		})
+	}
+}
+
 // TestGetCommand tests the get command from Example 3
 func TestGetCommand(t *testing.T) {
 	binary := getBinaryPath(t)
@@ -187,6 +456,144 @@ func TestGetCommand(t *testing.T) {
 	assert.Equal(t, "2.45.0", metadata.Version)
 }
 
+// TestTrustReporting tests that list and get --trust surface the trust block
+// of cached metadata, and report "unknown" for metadata without one
+func TestTrustReporting(t *testing.T) {
+	binary := getBinaryPath(t)
+
+	tmpDir := t.TempDir()
+	env := append(os.Environ(), "XDG_DATA_HOME="+tmpDir, "XDG_CACHE_HOME="+filepath.Join(tmpDir, "cache"))
+	mockToolsDir := filepath.Join(tmpDir, "mock-bin")
+	require.NoError(t, os.MkdirAll(mockToolsDir, 0755))
+
+	createMockATIPTool(t, mockToolsDir, "plain", "1.0.0", "No trust block")
+	require.NoError(t, os.WriteFile(filepath.Join(mockToolsDir, "signed"), []byte(`#!/bin/sh
+cat <<EOF
+{
+  "atip": {"version": "0.6"},
+  "name": "signed",
+  "version": "2.0.0",
+  "description": "Signed tool",
+  "trust": {
+    "source": "vendor",
+    "verified": true,
+    "integrity": {"signature": {"type": "cosign", "identity": "release@example.com"}}
+  },
+  "commands": {}
+}
+EOF
+`), 0755))
+
+	run := func(args ...string) []byte {
+		cmd := exec.Command(binary, args...)
+		cmd.Env = env
+		output, err := cmd.Output()
+		require.NoError(t, err)
+		return output
+	}
+	run("scan", "--allow-path="+mockToolsDir)
+
+	var list struct {
+		Tools []struct {
+			Name        string `json:"name"`
+			TrustSource string `json:"trust_source"`
+			Verified    bool   `json:"verified"`
+			Signature   string `json:"signature"`
+		} `json:"tools"`
+	}
+	require.NoError(t, json.Unmarshal(run("list", "-o", "json"), &list))
+	require.Len(t, list.Tools, 2)
+	assert.Equal(t, "plain", list.Tools[0].Name)
+	assert.Equal(t, "unknown", list.Tools[0].TrustSource)
+	assert.False(t, list.Tools[0].Verified)
+	assert.Empty(t, list.Tools[0].Signature)
+	assert.Equal(t, "signed", list.Tools[1].Name)
+	assert.Equal(t, "vendor", list.Tools[1].TrustSource)
+	assert.True(t, list.Tools[1].Verified)
+	assert.Equal(t, "cosign", list.Tools[1].Signature)
+
+	var trust map[string]interface{}
+	require.NoError(t, json.Unmarshal(run("get", "signed", "--trust"), &trust))
+	assert.Equal(t, map[string]interface{}{"trust_source": "vendor", "verified": true, "signature": "cosign"}, trust)
+	trust = nil
+	require.NoError(t, json.Unmarshal(run("get", "plain", "--trust"), &trust))
+	assert.Equal(t, map[string]interface{}{"trust_source": "unknown", "verified": false}, trust)
+
+	table := string(run("list", "-o", "table"))
+	assert.Contains(t, table, "TRUST")
+	assert.Contains(t, table, "vendor+verified")
+}
+
+// TestPartialMetadata tests that list and get flag tools whose metadata
+// leaves out commands, and leave complete tools alone
+func TestPartialMetadata(t *testing.T) {
+	binary := getBinaryPath(t)
+
+	tmpDir := t.TempDir()
+	env := append(os.Environ(), "XDG_DATA_HOME="+tmpDir, "XDG_CACHE_HOME="+filepath.Join(tmpDir, "cache"))
+	mockToolsDir := filepath.Join(tmpDir, "mock-bin")
+	require.NoError(t, os.MkdirAll(mockToolsDir, 0755))
+
+	createMockATIPTool(t, mockToolsDir, "gh", "2.45.0", "GitHub CLI")
+	require.NoError(t, os.WriteFile(filepath.Join(mockToolsDir, "kubectl"), []byte(`#!/bin/sh
+cat <<EOF
+{
+  "atip": {"version": "0.6"},
+  "name": "kubectl",
+  "version": "1.28.0",
+  "description": "Kubernetes CLI",
+  "partial": true,
+  "omitted": {"reason": "size-limited", "safetyAssumption": "known-unsafe"},
+  "commands": {
+    "get": {"description": "Get resources", "effects": {"network": true}}
+  }
+}
+EOF
+`), 0755))
+
+	run := func(args ...string) []byte {
+		cmd := exec.Command(binary, args...)
+		cmd.Env = env
+		output, err := cmd.Output()
+		require.NoError(t, err)
+		return output
+	}
+	run("scan", "--allow-path="+mockToolsDir)
+
+	var list struct {
+		Tools []map[string]interface{} `json:"tools"`
+	}
+	require.NoError(t, json.Unmarshal(run("list", "-o", "json"), &list))
+	require.Len(t, list.Tools, 2)
+	assert.NotContains(t, list.Tools[0], "partial")
+	assert.Equal(t, true, list.Tools[1]["partial"])
+
+	table := string(run("list", "-o", "table"))
+	assert.Contains(t, table, "kubectl (partial)")
+	assert.NotContains(t, table, "gh (partial)")
+
+	// get prints the cached metadata, omitted block included
+	var metadata struct {
+		Partial bool `json:"partial"`
+		Omitted struct {
+			Reason           string `json:"reason"`
+			SafetyAssumption string `json:"safetyAssumption"`
+		} `json:"omitted"`
+	}
+	require.NoError(t, json.Unmarshal(run("get", "kubectl"), &metadata))
+	assert.True(t, metadata.Partial)
+	assert.Equal(t, "size-limited", metadata.Omitted.Reason)
+	assert.Equal(t, "known-unsafe", metadata.Omitted.SafetyAssumption)
+
+	var effects map[string]interface{}
+	require.NoError(t, json.Unmarshal(run("get", "kubectl", "--effects"), &effects))
+	assert.Equal(t, true, effects["partial"])
+	assert.Equal(t, "known-unsafe", effects["safety_assumption"])
+	effects = nil
+	require.NoError(t, json.Unmarshal(run("get", "gh", "--effects"), &effects))
+	assert.NotContains(t, effects, "partial")
+}
+
 // TestGetCommand_NotFound tests error handling from Example 19
 func TestGetCommand_NotFound(t *testing.T) {
 	binary := getBinaryPath(t)
@@ -217,6 +624,110 @@ func TestGetCommand_NotFound(t *testing.T) {
 	}
 }
 
+// TestEffects tests that get --effects summarizes nested command effects and
+// list --effects tags each tool with badges
+func TestEffects(t *testing.T) {
+	binary := getBinaryPath(t)
+	env := isolatedConfigEnv(t, `{}`, "XDG_CACHE_HOME="+t.TempDir())
+
+	mockToolsDir := filepath.Join(t.TempDir(), "mock-bin")
+	require.NoError(t, os.MkdirAll(mockToolsDir, 0755))
+	createMockATIPTool(t, mockToolsDir, "quiet", "1.0.0", "Read-only tool")
+	script := `#!/bin/sh
+cat <<EOF
+{
+  "atip": {"version": "0.6"},
+  "name": "gh",
+  "version": "2.45.0",
+  "description": "GitHub CLI",
+  "commands": {
+    "pr": {
+      "description": "Manage pull requests",
+      "commands": {
+        "list": {"description": "List PRs", "effects": {"network": true}},
+        "merge": {"description": "Merge a PR", "effects": {"network": true, "destructive": true}}
+      }
+    },
+    "repo": {
+      "description": "Manage repositories",
+      "commands": {
+        "clone": {"description": "Clone a repository", "effects": {"network": true, "filesystem": {"write": true, "paths": ["./"]}}}
+      }
+    },
+    "cache": {
+      "description": "Manage the cache",
+      "commands": {
+        "clear": {"description": "Clear the cache", "effects": {"filesystem": {"read": false, "delete": true, "paths": ["~/.cache/gh/"]}}}
+      }
+    }
+  }
+}
+EOF
+`
+	require.NoError(t, os.WriteFile(filepath.Join(mockToolsDir, "gh"), []byte(script), 0755))
+	home := t.TempDir()
+	env = append(env, "HOME="+home)
+
+	cmd := exec.Command(binary, "scan", "--allow-path="+mockToolsDir)
+	cmd.Env = env
+	_, err := cmd.Output()
+	require.NoError(t, err)
+
+	cmd = exec.Command(binary, "get", "--effects", "gh")
+	cmd.Env = env
+	output, err := cmd.Output()
+	require.NoError(t, err)
+
+	var summary struct {
+		Name        string   `json:"name"`
+		Commands    int      `json:"commands"`
+		Network     []string `json:"network"`
+		Destructive []string `json:"destructive"`
+		Writes      []struct {
+			Command string   `json:"command"`
+			Paths   []string `json:"paths"`
+		} `json:"filesystem_write"`
+		Badges []string `json:"badges"`
+	}
+	require.NoError(t, json.Unmarshal(output, &summary))
+	assert.Equal(t, "gh", summary.Name)
+	assert.Equal(t, 4, summary.Commands)
+	assert.Equal(t, []string{"pr list", "pr merge", "repo clone"}, summary.Network)
+	assert.Equal(t, []string{"pr merge"}, summary.Destructive)
+	require.Len(t, summary.Writes, 2)
+	assert.Equal(t, "cache clear", summary.Writes[0].Command)
+	// ~ is expanded for display
+	assert.Equal(t, []string{filepath.Join(home, ".cache/gh")}, summary.Writes[0].Paths)
+	assert.Equal(t, "repo clone", summary.Writes[1].Command)
+	assert.Equal(t, []string{"./"}, summary.Writes[1].Paths)
+	assert.Equal(t, []string{"network", "destructive", "write"}, summary.Badges)
+
+	cmd = exec.Command(binary, "list", "--effects")
+	cmd.Env = env
+	output, err = cmd.Output()
+	require.NoError(t, err)
+
+	var list struct {
+		Tools []struct {
+			Name    string   `json:"name"`
+			Effects []string `json:"effects"`
+		} `json:"tools"`
+	}
+	require.NoError(t, json.Unmarshal(output, &list))
+	require.Len(t, list.Tools, 2)
+	assert.Equal(t, "gh", list.Tools[0].Name)
+	assert.Equal(t, []string{"network", "destructive", "write"}, list.Tools[0].Effects)
+	assert.Equal(t, "quiet", list.Tools[1].Name)
+	assert.Equal(t, []string{"read-only"}, list.Tools[1].Effects)
+
+	// Without --effects, list doesn't tag tools
+	cmd = exec.Command(binary, "list")
+	cmd.Env = env
+	output, err = cmd.Output()
+	require.NoError(t, err)
+	assert.NotContains(t, string(output), `"effects"`)
+}
+
 // TestSkipList tests skip list functionality from Example 6
 func TestSkipList(t *testing.T) {
 	binary := getBinaryPath(t)
@@ -255,127 +766,1582 @@ func TestSkipList(t *testing.T) {
 	assert.Equal(t, "gh", result.Tools[0].Name)
 }
 
-// TestDryRun tests dry run mode from Example 8
-func TestDryRun(t *testing.T) {
+// TestScanSkipFile tests that patterns from --skip-file and the skip_file
+// config key are merged with inline --skip and the skip_list config key
+func TestScanSkipFile(t *testing.T) {
 	binary := getBinaryPath(t)
 
 	tmpDir := t.TempDir()
-	os.Setenv("XDG_DATA_HOME", tmpDir)
-	defer os.Unsetenv("XDG_DATA_HOME")
-
 	mockToolsDir := filepath.Join(tmpDir, "mock-bin")
 	require.NoError(t, os.MkdirAll(mockToolsDir, 0755))
 
-	createMockATIPTool(t, mockToolsDir, "gh", "2.45.0", "GitHub CLI")
+	for _, name := range []string{"gh", "kubectl", "test-12", "legacy-a", "inline"} {
+		createMockATIPTool(t, mockToolsDir, name, "1.0.0", "Mock tool")
+	}
+
+	skipFile := filepath.Join(tmpDir, "skip.txt")
+	require.NoError(t, os.WriteFile(skipFile, []byte("# Generated test tools\nre:test-[0-9]+\n\nlegacy-*\n"), 0644))
+
+	scan := func(env []string, args ...string) []string {
+		t.Helper()
+		cmd := exec.Command(binary, append([]string{"scan", "--allow-path", mockToolsDir, "-o", "json"}, args...)...)
+		cmd.Env = env
+		output, err := cmd.Output()
+		require.NoError(t, err)
+
+		var result struct {
+			Tools []struct {
+				Name string `json:"name"`
+			} `json:"tools"`
+		}
+		require.NoError(t, json.Unmarshal(output, &result))
+		names := []string{}
+		for _, tool := range result.Tools {
+			names = append(names, tool.Name)
+		}
+		sort.Strings(names)
+		return names
+	}
+
+	t.Run("flag", func(t *testing.T) {
+		env := isolatedConfigEnv(t, `{}`)
+		names := scan(env, "--skip-file", skipFile, "--skip", "inline")
+		assert.Equal(t, []string{"gh", "kubectl"}, names)
+	})
+
+	t.Run("config key", func(t *testing.T) {
+		env := isolatedConfigEnv(t, `{"discovery": {"skip_file": "`+skipFile+`"}}`)
+		names := scan(env)
+		assert.Equal(t, []string{"gh", "inline", "kubectl"}, names)
+	})
+
+	t.Run("skip_list config key", func(t *testing.T) {
+		// Each scan gets fresh data, so tools found earlier aren't skipped as unchanged
+		env := func() []string { return isolatedConfigEnv(t, `{"discovery": {"skip_list": ["kubectl"]}}`) }
+		assert.Equal(t, []string{"gh", "inline", "legacy-a", "test-12"}, scan(env()))
+		// --skip adds to skip_list instead of replacing it
+		assert.Equal(t, []string{"gh", "legacy-a", "test-12"}, scan(env(), "--skip", "inline"))
+		assert.Equal(t, []string{"gh"}, scan(env(), "--skip", "inline", "--skip-file", skipFile))
+	})
+
+	t.Run("invalid pattern", func(t *testing.T) {
+		bad := filepath.Join(tmpDir, "bad.txt")
+		require.NoError(t, os.WriteFile(bad, []byte("re:[oops\n"), 0644))
+
+		cmd := exec.Command(binary, "scan", "--allow-path", mockToolsDir, "--skip-file", bad, "-o", "json")
+		cmd.Env = isolatedConfigEnv(t, `{}`)
+		output, err := cmd.CombinedOutput()
+		require.Error(t, err)
+		assert.Contains(t, string(output), "bad.txt:1")
+	})
+}
+
+// TestScanRepeatedAllowPath tests that each --allow-path occurrence is scanned,
+// including directories with commas in their names
+func TestScanRepeatedAllowPath(t *testing.T) {
+	binary := getBinaryPath(t)
+
+	tmpDir := t.TempDir()
+	firstDir := filepath.Join(tmpDir, "first-bin")
+	secondDir := filepath.Join(tmpDir, "tools,v2")
+	require.NoError(t, os.MkdirAll(firstDir, 0755))
+	require.NoError(t, os.MkdirAll(secondDir, 0755))
+
+	createMockATIPTool(t, firstDir, "gh", "2.45.0", "GitHub CLI")
+	createMockATIPTool(t, secondDir, "kubectl", "1.28.0", "Kubernetes CLI")
+	createMockATIPTool(t, secondDir, "skip-this", "1.0.0", "Skipped tool")
 
-	// Dry run scan
 	cmd := exec.Command(binary, "scan",
-		"--allow-path="+mockToolsDir,
-		"--dry-run",
+		"--allow-path", firstDir,
+		"--allow-path", secondDir,
+		"--skip", "skip-this",
 		"-o", "json")
+	cmd.Env = append(os.Environ(), "XDG_DATA_HOME="+filepath.Join(tmpDir, "data"))
 	output, err := cmd.Output()
 	require.NoError(t, err)
 
 	var result struct {
-		WouldScan []string `json:"would_scan"`
-		ScanPaths []string `json:"scan_paths"`
+		Discovered  int `json:"discovered"`
+		Directories []struct {
+			Path       string `json:"path"`
+			Discovered int    `json:"discovered"`
+		} `json:"directories"`
 	}
+	require.NoError(t, json.Unmarshal(output, &result))
 
-	err = json.Unmarshal(output, &result)
-	require.NoError(t, err)
-
-	// Should show what would be scanned
-	assert.NotEmpty(t, result.ScanPaths)
-	assert.Contains(t, result.ScanPaths, mockToolsDir)
+	assert.Equal(t, 2, result.Discovered)
+	require.Len(t, result.Directories, 2)
+	assert.Equal(t, firstDir, result.Directories[0].Path)
+	assert.Equal(t, secondDir, result.Directories[1].Path)
+	assert.Equal(t, 1, result.Directories[1].Discovered)
 }
 
-// TestOutputFormats tests different output formats from Examples 2
-func TestOutputFormats(t *testing.T) {
+// TestScanMaxDepth tests that --max-depth finds tools in nested tool
+// directories, which the default depth of 1 doesn't read
+func TestScanMaxDepth(t *testing.T) {
 	binary := getBinaryPath(t)
 
 	tmpDir := t.TempDir()
-	os.Setenv("XDG_DATA_HOME", tmpDir)
-	defer os.Unsetenv("XDG_DATA_HOME")
+	toolsDir := filepath.Join(tmpDir, "tools")
+	nestedDir := filepath.Join(toolsDir, "go")
+	require.NoError(t, os.MkdirAll(nestedDir, 0755))
+	createMockATIPTool(t, toolsDir, "gh", "2.45.0", "GitHub CLI")
+	goplsPath := createMockATIPTool(t, nestedDir, "gopls", "0.15.0", "Go language server")
 
-	mockToolsDir := filepath.Join(tmpDir, "mock-bin")
-	require.NoError(t, os.MkdirAll(mockToolsDir, 0755))
+	type scanResult struct {
+		Tools []struct {
+			Name string `json:"name"`
+			Path string `json:"path"`
+		} `json:"tools"`
+		Directories []struct {
+			Subdirectories []string `json:"subdirectories"`
+		} `json:"directories"`
+		Stats struct {
+			DirsTraversed int `json:"dirs_traversed"`
+		} `json:"stats"`
+	}
+	// Each scan gets a fresh registry, so no tool is skipped as unchanged
+	scan := func(args ...string) scanResult {
+		cmd := exec.Command(binary, append([]string{"scan", "--allow-path", toolsDir, "-o", "json"}, args...)...)
+		cmd.Env = append(os.Environ(), "XDG_DATA_HOME="+t.TempDir())
+		output, err := cmd.Output()
+		require.NoError(t, err)
+		var result scanResult
+		require.NoError(t, json.Unmarshal(output, &result))
+		return result
+	}
 
-	createMockATIPTool(t, mockToolsDir, "gh", "2.45.0", "GitHub CLI")
+	result := scan()
+	require.Len(t, result.Tools, 1)
+	assert.Equal(t, "gh", result.Tools[0].Name)
+	assert.Equal(t, 1, result.Stats.DirsTraversed)
 
-	// Scan first
-	cmd := exec.Command(binary, "scan", "--allow-path="+mockToolsDir)
-	_, err := cmd.Output()
-	require.NoError(t, err)
+	result = scan("--max-depth", "2")
+	require.Len(t, result.Tools, 2)
+	assert.Equal(t, "gh", result.Tools[0].Name)
+	assert.Equal(t, "gopls", result.Tools[1].Name)
+	assert.Equal(t, goplsPath, result.Tools[1].Path)
+	assert.Equal(t, 2, result.Stats.DirsTraversed)
+	require.Len(t, result.Directories, 1)
+	assert.Equal(t, []string{nestedDir}, result.Directories[0].Subdirectories)
+
+	cmd := exec.Command(binary, "scan", "--allow-path", toolsDir, "--max-depth", "0")
+	cmd.Env = append(os.Environ(), "XDG_DATA_HOME="+t.TempDir())
+	assert.Error(t, cmd.Run())
+}
 
-	// Test JSON output
-	cmd = exec.Command(binary, "list", "-o", "json")
+// TestScanAdditionalPaths tests that ATIP_DISCOVER_ADDITIONAL_PATHS and
+// --add-path are scanned after the configured safe paths, not instead of them
+func TestScanAdditionalPaths(t *testing.T) {
+	binary := getBinaryPath(t)
+
+	tmpDir := t.TempDir()
+	safeDir := filepath.Join(tmpDir, "safe-bin")
+	envDir := filepath.Join(tmpDir, "env-bin")
+	flagDir := filepath.Join(tmpDir, "flag-bin")
+	for _, dir := range []string{safeDir, envDir, flagDir} {
+		require.NoError(t, os.MkdirAll(dir, 0755))
+	}
+	createMockATIPTool(t, safeDir, "gh", "2.45.0", "GitHub CLI")
+	createMockATIPTool(t, envDir, "kubectl", "1.28.0", "Kubernetes CLI")
+	createMockATIPTool(t, flagDir, "terraform", "1.6.0", "Terraform")
+
+	cmd := exec.Command(binary, "scan", "--add-path", flagDir, "-o", "json")
+	cmd.Env = isolatedConfigEnv(t, fmt.Sprintf(`{"discovery": {"safe_paths": [%q]}}`, safeDir),
+		"ATIP_DISCOVER_ADDITIONAL_PATHS="+envDir,
+	)
 	output, err := cmd.Output()
 	require.NoError(t, err)
-	assert.True(t, json.Valid(output))
 
-	// Test table output
-	cmd = exec.Command(binary, "list", "-o", "table")
-	output, err = cmd.Output()
-	require.NoError(t, err)
-	assert.Contains(t, string(output), "NAME")
-	assert.Contains(t, string(output), "VERSION")
+	var result struct {
+		Discovered  int `json:"discovered"`
+		Directories []struct {
+			Path string `json:"path"`
+		} `json:"directories"`
+	}
+	require.NoError(t, json.Unmarshal(output, &result))
 
-	// Test quiet output
-	cmd = exec.Command(binary, "list", "-o", "quiet")
-	output, err = cmd.Output()
-	require.NoError(t, err)
-	assert.Contains(t, string(output), "gh")
-	assert.NotContains(t, string(output), "NAME") // No headers in quiet mode
+	assert.Equal(t, 3, result.Discovered)
+	require.Len(t, result.Directories, 3)
+	assert.Equal(t, safeDir, result.Directories[0].Path)
+	assert.Equal(t, envDir, result.Directories[1].Path)
+	assert.Equal(t, flagDir, result.Directories[2].Path)
 }
 
-// TestRefreshCommand tests the refresh command from Example 15
-func TestRefreshCommand(t *testing.T) {
+// TestScanCommaSeparatedAllowPath tests the deprecated comma-separated form
+func TestScanCommaSeparatedAllowPath(t *testing.T) {
 	binary := getBinaryPath(t)
 
 	tmpDir := t.TempDir()
-	os.Setenv("XDG_DATA_HOME", tmpDir)
-	defer os.Unsetenv("XDG_DATA_HOME")
+	firstDir := filepath.Join(tmpDir, "first-bin")
+	secondDir := filepath.Join(tmpDir, "second-bin")
+	require.NoError(t, os.MkdirAll(firstDir, 0755))
+	require.NoError(t, os.MkdirAll(secondDir, 0755))
+
+	createMockATIPTool(t, firstDir, "gh", "2.45.0", "GitHub CLI")
+	createMockATIPTool(t, secondDir, "kubectl", "1.28.0", "Kubernetes CLI")
+
+	cmd := exec.Command(binary, "scan", "--allow-path="+firstDir+","+secondDir, "-o", "json")
+	cmd.Env = append(os.Environ(), "XDG_DATA_HOME="+filepath.Join(tmpDir, "data"))
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	require.NoError(t, err)
+
+	var result struct {
+		Discovered int `json:"discovered"`
+	}
+	require.NoError(t, json.Unmarshal(output, &result))
+
+	assert.Equal(t, 2, result.Discovered)
+	assert.Contains(t, stderr.String(), "Comma-separated --allow-path is deprecated")
+}
+
+// TestScanFromPath tests scanning the directories listed in $PATH
+func TestScanFromPath(t *testing.T) {
+	binary := getBinaryPath(t)
 
+	tmpDir := t.TempDir()
 	mockToolsDir := filepath.Join(tmpDir, "mock-bin")
 	require.NoError(t, os.MkdirAll(mockToolsDir, 0755))
 
-	createMockATIPTool(t, mockToolsDir, "gh", "2.44.0", "GitHub CLI")
-
-	// Initial scan
-	cmd := exec.Command(binary, "scan", "--allow-path="+mockToolsDir)
-	_, err := cmd.Output()
-	require.NoError(t, err)
+	// Use only shell builtins, since PATH won't contain the usual system dirs
+	script := `#!/bin/sh
+if [ "$1" = "--agent" ]; then
+  echo '{"atip": {"version": "0.6"}, "name": "path-tool", "version": "1.0.0", "description": "Found via PATH", "commands": {"run": {"description": "Run", "effects": {"network": false}}}}'
+fi
+`
+	require.NoError(t, os.WriteFile(filepath.Join(mockToolsDir, "path-tool"), []byte(script), 0755))
+	createMockATIPTool(t, mockToolsDir, "skip-me", "1.0.0", "Skipped tool")
 
-	// Update tool
-	time.Sleep(10 * time.Millisecond)
-	createMockATIPTool(t, mockToolsDir, "gh", "2.45.0", "GitHub CLI")
+	// Relative, empty and duplicate entries must be dropped
+	sep := string(os.PathListSeparator)
+	pathEnv := mockToolsDir + sep + "." + sep + sep + mockToolsDir
 
-	// Refresh
-	cmd = exec.Command(binary, "refresh", "-o", "json")
+	cmd := exec.Command(binary, "scan", "--from-path", "--skip=skip-me", "-o", "json")
+	cmd.Env = append(os.Environ(), "XDG_DATA_HOME="+tmpDir, "PATH="+pathEnv)
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
 	output, err := cmd.Output()
 	require.NoError(t, err)
 
 	var result struct {
-		Refreshed int `json:"refreshed"`
-		Tools     []struct {
-			Name       string `json:"name"`
-			Status     string `json:"status"`
-			OldVersion string `json:"old_version,omitempty"`
-			NewVersion string `json:"new_version,omitempty"`
+		Discovered int `json:"discovered"`
+		Skipped    int `json:"skipped"`
+		Tools      []struct {
+			Name string `json:"name"`
+			Path string `json:"path"`
 		} `json:"tools"`
 	}
 
 	err = json.Unmarshal(output, &result)
 	require.NoError(t, err)
 
-	assert.Greater(t, result.Refreshed, 0)
+	assert.Equal(t, 1, result.Discovered)
+	assert.Equal(t, 1, result.Skipped)
+	require.Len(t, result.Tools, 1)
+	assert.Equal(t, "path-tool", result.Tools[0].Name)
+	assert.Equal(t, filepath.Join(mockToolsDir, "path-tool"), result.Tools[0].Path)
+	assert.Contains(t, stderr.String(), "Skipping relative or empty PATH entry")
 }
 
-// Helper functions
+// TestDryRun tests dry run mode from Example 8
+func TestDryRun(t *testing.T) {
+	binary := getBinaryPath(t)
 
-func createMockATIPTool(t *testing.T, dir, name, version, description string) string {
-	toolPath := filepath.Join(dir, name)
-	script := `#!/bin/sh
+	tmpDir := t.TempDir()
+	os.Setenv("XDG_DATA_HOME", tmpDir)
+	defer os.Unsetenv("XDG_DATA_HOME")
+
+	mockToolsDir := filepath.Join(tmpDir, "mock-bin")
+	require.NoError(t, os.MkdirAll(mockToolsDir, 0755))
+
+	createMockATIPTool(t, mockToolsDir, "gh", "2.45.0", "GitHub CLI")
+
+	// Dry run scan
+	cmd := exec.Command(binary, "scan",
+		"--allow-path="+mockToolsDir,
+		"--dry-run",
+		"-o", "json")
+	output, err := cmd.Output()
+	require.NoError(t, err)
+
+	var result struct {
+		WouldScan []string `json:"would_scan"`
+		ScanPaths []string `json:"scan_paths"`
+	}
+
+	err = json.Unmarshal(output, &result)
+	require.NoError(t, err)
+
+	// Should show what would be scanned
+	assert.NotEmpty(t, result.ScanPaths)
+	assert.Contains(t, result.ScanPaths, mockToolsDir)
+}
+
+// TestDryRunSkipReasons tests that dry run explains why each executable
+// would be probed or skipped
+func TestDryRunSkipReasons(t *testing.T) {
+	binary := getBinaryPath(t)
+
+	tmpDir := t.TempDir()
+	env := append(os.Environ(), "XDG_DATA_HOME="+tmpDir, "XDG_CACHE_HOME="+filepath.Join(tmpDir, "cache"))
+
+	mockToolsDir := filepath.Join(tmpDir, "mock-bin")
+	require.NoError(t, os.MkdirAll(mockToolsDir, 0755))
+	createMockATIPTool(t, mockToolsDir, "gh", "2.45.0", "GitHub CLI")
+	createMockATIPTool(t, mockToolsDir, "kubectl", "1.28.0", "Kubernetes CLI")
+	createMockATIPTool(t, mockToolsDir, "dangerous-tool", "1.0.0", "Dangerous")
+
+	// Register kubectl so the incremental scan would skip it
+	scan := exec.Command(binary, "scan", "--allow-path="+mockToolsDir, "--skip", "gh", "--skip", "dangerous-*")
+	scan.Env = env
+	require.NoError(t, scan.Run())
+
+	cmd := exec.Command(binary, "scan", "--allow-path="+mockToolsDir, "--skip", "dangerous-*", "--dry-run")
+	cmd.Env = env
+	output, err := cmd.Output()
+	require.NoError(t, err)
+
+	var result struct {
+		WouldScan   []string `json:"would_scan"`
+		WouldProbe  int      `json:"would_probe"`
+		WouldSkip   int      `json:"would_skip"`
+		Directories []struct {
+			Path        string `json:"path"`
+			Executables []struct {
+				Path    string `json:"path"`
+				Probe   bool   `json:"probe"`
+				Reason  string `json:"reason"`
+				Pattern string `json:"pattern"`
+			} `json:"executables"`
+		} `json:"directories"`
+	}
+	require.NoError(t, json.Unmarshal(output, &result))
+
+	assert.Equal(t, []string{mockToolsDir}, result.WouldScan)
+	assert.Equal(t, 1, result.WouldProbe)
+	assert.Equal(t, 2, result.WouldSkip)
+	require.Len(t, result.Directories, 1)
+	assert.Equal(t, mockToolsDir, result.Directories[0].Path)
+
+	byName := make(map[string]int)
+	for i, executable := range result.Directories[0].Executables {
+		byName[filepath.Base(executable.Path)] = i
+	}
+	require.Len(t, byName, 3)
+	executables := result.Directories[0].Executables
+
+	dangerous := executables[byName["dangerous-tool"]]
+	assert.False(t, dangerous.Probe)
+	assert.Equal(t, "skip-list", dangerous.Reason)
+	assert.Equal(t, "dangerous-*", dangerous.Pattern)
+
+	kubectl := executables[byName["kubectl"]]
+	assert.False(t, kubectl.Probe)
+	assert.Equal(t, "incremental", kubectl.Reason)
+
+	gh := executables[byName["gh"]]
+	assert.True(t, gh.Probe)
+	assert.Empty(t, gh.Reason)
+
+	// Nothing was probed: gh is still unregistered
+	list := exec.Command(binary, "list", "-o", "json")
+	list.Env = env
+	listOutput, err := list.Output()
+	require.NoError(t, err)
+	assert.NotContains(t, string(listOutput), `"gh"`)
+}
+
+// TestProbeAllow tests that executables outside --probe-allow are reported
+// but never run
+func TestProbeAllow(t *testing.T) {
+	binary := getBinaryPath(t)
+
+	tmpDir := t.TempDir()
+	env := append(os.Environ(), "XDG_DATA_HOME="+tmpDir, "XDG_CACHE_HOME="+filepath.Join(tmpDir, "cache"))
+
+	mockToolsDir := filepath.Join(tmpDir, "mock-bin")
+	require.NoError(t, os.MkdirAll(mockToolsDir, 0755))
+	createMockATIPTool(t, mockToolsDir, "gh", "2.45.0", "GitHub CLI")
+
+	// A tool that leaves a sentinel file behind if it is ever run
+	sentinel := filepath.Join(tmpDir, "untrusted-ran")
+	script := fmt.Sprintf("#!/bin/sh\ntouch %q\n", sentinel)
+	require.NoError(t, os.WriteFile(filepath.Join(mockToolsDir, "untrusted"), []byte(script), 0755))
+
+	dryRun := exec.Command(binary, "scan", "--allow-path="+mockToolsDir, "--probe-allow", "gh", "--dry-run")
+	dryRun.Env = env
+	output, err := dryRun.Output()
+	require.NoError(t, err)
+	assert.Contains(t, string(output), `"reason": "not-allowed"`)
+
+	cmd := exec.Command(binary, "scan", "--allow-path="+mockToolsDir, "--probe-allow", "gh", "-o", "json")
+	cmd.Env = env
+	output, err = cmd.Output()
+	require.NoError(t, err)
+
+	var result struct {
+		Discovered int      `json:"discovered"`
+		Skipped    int      `json:"skipped"`
+		NotAllowed []string `json:"not_allowed"`
+	}
+	require.NoError(t, json.Unmarshal(output, &result))
+	assert.Equal(t, 1, result.Discovered)
+	assert.Equal(t, 1, result.Skipped)
+	assert.Equal(t, []string{filepath.Join(mockToolsDir, "untrusted")}, result.NotAllowed)
+	assert.NoFileExists(t, sentinel, "a tool outside the allowlist was run")
+}
+
+// TestProbeAllowEnv tests that ATIP_DISCOVER_PROBE_ALLOW alone limits
+// which executables are run, in scan and in config show
+func TestProbeAllowEnv(t *testing.T) {
+	binary := getBinaryPath(t)
+
+	env := isolatedConfigEnv(t, `{}`, "ATIP_DISCOVER_PROBE_ALLOW=gh")
+	tmpDir := t.TempDir()
+	env = append(env, "XDG_CACHE_HOME="+filepath.Join(tmpDir, "cache"))
+
+	mockToolsDir := filepath.Join(tmpDir, "mock-bin")
+	require.NoError(t, os.MkdirAll(mockToolsDir, 0755))
+	createMockATIPTool(t, mockToolsDir, "gh", "2.45.0", "GitHub CLI")
+
+	sentinel := filepath.Join(tmpDir, "untrusted-ran")
+	script := fmt.Sprintf("#!/bin/sh\ntouch %q\n", sentinel)
+	require.NoError(t, os.WriteFile(filepath.Join(mockToolsDir, "untrusted"), []byte(script), 0755))
+
+	cmd := exec.Command(binary, "scan", "--allow-path="+mockToolsDir, "-o", "json")
+	cmd.Env = env
+	output, err := cmd.Output()
+	require.NoError(t, err)
+
+	var result struct {
+		Discovered int      `json:"discovered"`
+		NotAllowed []string `json:"not_allowed"`
+	}
+	require.NoError(t, json.Unmarshal(output, &result))
+	assert.Equal(t, 1, result.Discovered)
+	assert.Equal(t, []string{filepath.Join(mockToolsDir, "untrusted")}, result.NotAllowed)
+	assert.NoFileExists(t, sentinel, "a tool outside the allowlist was run")
+
+	show := exec.Command(binary, "config", "show", "-o", "json")
+	show.Env = env
+	output, err = show.Output()
+	require.NoError(t, err)
+	assert.Contains(t, string(output), `"probe_allow": [`)
+	assert.Contains(t, string(output), `"gh"`)
+}
+
+// TestOutputFormats tests different output formats from Examples 2
+func TestOutputFormats(t *testing.T) {
+	binary := getBinaryPath(t)
+
+	tmpDir := t.TempDir()
+	os.Setenv("XDG_DATA_HOME", tmpDir)
+	defer os.Unsetenv("XDG_DATA_HOME")
+
+	mockToolsDir := filepath.Join(tmpDir, "mock-bin")
+	require.NoError(t, os.MkdirAll(mockToolsDir, 0755))
+
+	createMockATIPTool(t, mockToolsDir, "gh", "2.45.0", "GitHub CLI")
+
+	// Scan first
+	cmd := exec.Command(binary, "scan", "--allow-path="+mockToolsDir)
+	_, err := cmd.Output()
+	require.NoError(t, err)
+
+	// Test JSON output
+	cmd = exec.Command(binary, "list", "-o", "json")
+	output, err := cmd.Output()
+	require.NoError(t, err)
+	assert.True(t, json.Valid(output))
+
+	// Test table output
+	cmd = exec.Command(binary, "list", "-o", "table")
+	output, err = cmd.Output()
+	require.NoError(t, err)
+	assert.Contains(t, string(output), "NAME")
+	assert.Contains(t, string(output), "VERSION")
+	assert.NotContains(t, string(output), "PATH")
+
+	// Test wide table output, which adds the executable's path
+	cmd = exec.Command(binary, "list", "-o", "table", "--wide")
+	output, err = cmd.Output()
+	require.NoError(t, err)
+	assert.Contains(t, string(output), "PATH")
+	assert.Contains(t, string(output), "LAST_VERIFIED")
+	assert.Contains(t, string(output), filepath.Join(mockToolsDir, "gh"))
+
+	// Test quiet output
+	cmd = exec.Command(binary, "list", "-o", "quiet")
+	output, err = cmd.Output()
+	require.NoError(t, err)
+	assert.Contains(t, string(output), "gh")
+	assert.NotContains(t, string(output), "NAME") // No headers in quiet mode
+}
+
+// TestRefreshCommand tests the refresh command from Example 15
+func TestRefreshCommand(t *testing.T) {
+	binary := getBinaryPath(t)
+
+	tmpDir := t.TempDir()
+	os.Setenv("XDG_DATA_HOME", tmpDir)
+	defer os.Unsetenv("XDG_DATA_HOME")
+
+	mockToolsDir := filepath.Join(tmpDir, "mock-bin")
+	require.NoError(t, os.MkdirAll(mockToolsDir, 0755))
+
+	createMockATIPTool(t, mockToolsDir, "gh", "2.44.0", "GitHub CLI")
+
+	// Initial scan
+	cmd := exec.Command(binary, "scan", "--allow-path="+mockToolsDir)
+	_, err := cmd.Output()
+	require.NoError(t, err)
+
+	// Update tool
+	time.Sleep(10 * time.Millisecond)
+	createMockATIPTool(t, mockToolsDir, "gh", "2.45.0", "GitHub CLI")
+
+	// Refresh
+	cmd = exec.Command(binary, "refresh", "-o", "json")
+	output, err := cmd.Output()
+	require.NoError(t, err)
+
+	var result struct {
+		Refreshed int `json:"refreshed"`
+		Tools     []struct {
+			Name       string `json:"name"`
+			Status     string `json:"status"`
+			OldVersion string `json:"old_version,omitempty"`
+			NewVersion string `json:"new_version,omitempty"`
+		} `json:"tools"`
+	}
+
+	err = json.Unmarshal(output, &result)
+	require.NoError(t, err)
+
+	assert.Greater(t, result.Refreshed, 0)
+}
+
+// TestRefreshScanTimeout tests that refresh probes with the configured scan
+// timeout, environment overrides included
+func TestRefreshScanTimeout(t *testing.T) {
+	binary := getBinaryPath(t)
+
+	for _, tt := range []struct {
+		timeout string
+		status  string
+	}{
+		{timeout: "100ms", status: "failed"},
+		{timeout: "5s", status: "updated"},
+	} {
+		t.Run(tt.timeout, func(t *testing.T) {
+			mockToolsDir := filepath.Join(t.TempDir(), "mock-bin")
+			require.NoError(t, os.MkdirAll(mockToolsDir, 0755))
+			createMockATIPTool(t, mockToolsDir, "slowtool", "1.0.0", "Slow tool")
+
+			env := isolatedConfigEnv(t, `{}`, "XDG_CACHE_HOME="+t.TempDir())
+			cmd := exec.Command(binary, "scan", "--allow-path="+mockToolsDir)
+			cmd.Env = env
+			_, err := cmd.Output()
+			require.NoError(t, err)
+
+			// The new version answers more slowly than the short timeout allows
+			time.Sleep(10 * time.Millisecond)
+			script := `#!/bin/sh
+sleep 0.5
+echo '{"atip": {"version": "0.6"}, "name": "slowtool", "version": "2.0.0", "description": "Slow tool"}'
+`
+			require.NoError(t, os.WriteFile(filepath.Join(mockToolsDir, "slowtool"), []byte(script), 0755))
+
+			cmd = exec.Command(binary, "refresh", "-o", "json")
+			cmd.Env = append(env, "ATIP_DISCOVER_TIMEOUT="+tt.timeout)
+			output, err := cmd.Output()
+			require.NoError(t, err)
+
+			var result struct {
+				Tools []struct {
+					Name   string `json:"name"`
+					Status string `json:"status"`
+				} `json:"tools"`
+			}
+			require.NoError(t, json.Unmarshal(output, &result))
+			require.Len(t, result.Tools, 1)
+			assert.Equal(t, tt.status, result.Tools[0].Status)
+		})
+	}
+}
+
+// TestTagCommand tests that manual tags survive a refresh and a rescan,
+// alongside tags inferred from metadata, and that list --tag filters by both
+func TestTagCommand(t *testing.T) {
+	binary := getBinaryPath(t)
+
+	tmpDir := t.TempDir()
+	env := append(os.Environ(), "XDG_DATA_HOME="+tmpDir)
+	mockToolsDir := filepath.Join(tmpDir, "mock-bin")
+	require.NoError(t, os.MkdirAll(mockToolsDir, 0755))
+
+	createMockATIPTool(t, mockToolsDir, "gh", "2.44.0", "GitHub CLI")
+	require.NoError(t, os.WriteFile(filepath.Join(mockToolsDir, "git"), []byte(`#!/bin/sh
+cat <<EOF
+{
+  "atip": {"version": "0.6"},
+  "name": "git",
+  "version": "2.43.0",
+  "description": "Distributed version control",
+  "homepage": "https://git-scm.com",
+  "commands": {
+    "commit": {"description": "Record changes", "effects": {"network": false}},
+    "push": {"description": "Update remote refs", "effects": {"network": true}}
+  }
+}
+EOF
+`), 0755))
+
+	run := func(args ...string) ([]byte, error) {
+		cmd := exec.Command(binary, args...)
+		cmd.Env = env
+		return cmd.Output()
+	}
+	listTagged := func(tag string) map[string][]string {
+		output, err := run("list", "--tag", tag, "-o", "json")
+		require.NoError(t, err)
+		var result struct {
+			Tools []struct {
+				Name string   `json:"name"`
+				Tags []string `json:"tags"`
+			} `json:"tools"`
+		}
+		require.NoError(t, json.Unmarshal(output, &result))
+		tools := make(map[string][]string)
+		for _, tool := range result.Tools {
+			tools[tool.Name] = tool.Tags
+		}
+		return tools
+	}
+
+	_, err := run("scan", "--allow-path="+mockToolsDir)
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]string{"git": {"git-scm", "vcs"}}, listTagged("vcs"))
+
+	output, err := run("tag", "gh", "VCS", "github")
+	require.NoError(t, err)
+	var tagged struct {
+		Name       string   `json:"name"`
+		Tags       []string `json:"tags"`
+		ManualTags []string `json:"manual_tags"`
+	}
+	require.NoError(t, json.Unmarshal(output, &tagged))
+	assert.Equal(t, "gh", tagged.Name)
+	assert.Equal(t, []string{"github", "vcs"}, tagged.ManualTags)
+
+	// Re-probing recomputes inferred tags but keeps manual ones
+	time.Sleep(10 * time.Millisecond)
+	createMockATIPTool(t, mockToolsDir, "gh", "2.45.0", "GitHub CLI")
+	_, err = run("refresh")
+	require.NoError(t, err)
+	_, err = run("scan", "--allow-path="+mockToolsDir)
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string][]string{
+		"gh":  {"github", "vcs"},
+		"git": {"git-scm", "vcs"},
+	}, listTagged("vcs"))
+	assert.Equal(t, map[string][]string{"gh": {"github", "vcs"}}, listTagged("github"))
+	assert.Empty(t, listTagged("kubernetes"))
+
+	_, err = run("tag", "missing-tool", "vcs")
+	var exitErr *exec.ExitError
+	require.ErrorAs(t, err, &exitErr)
+	assert.Equal(t, 1, exitErr.ExitCode())
+
+	_, err = run("tag", "gh", "not a tag")
+	require.ErrorAs(t, err, &exitErr)
+	assert.Equal(t, 2, exitErr.ExitCode())
+}
+
+// TestAnnotateCommand tests that annotations can be set and removed, survive
+// a refresh and a rescan, and that list --annotation filters by them
+func TestAnnotateCommand(t *testing.T) {
+	binary := getBinaryPath(t)
+
+	tmpDir := t.TempDir()
+	env := append(os.Environ(), "XDG_DATA_HOME="+tmpDir)
+	mockToolsDir := filepath.Join(tmpDir, "mock-bin")
+	require.NoError(t, os.MkdirAll(mockToolsDir, 0755))
+	createMockATIPTool(t, mockToolsDir, "gh", "2.45.0", "GitHub CLI")
+	createMockATIPTool(t, mockToolsDir, "jq", "1.7.1", "JSON processor")
+
+	run := func(args ...string) ([]byte, error) {
+		cmd := exec.Command(binary, args...)
+		cmd.Env = env
+		return cmd.Output()
+	}
+	listAnnotated := func(selectors ...string) map[string]map[string]string {
+		args := []string{"list", "-o", "json"}
+		for _, selector := range selectors {
+			args = append(args, "--annotation", selector)
+		}
+		output, err := run(args...)
+		require.NoError(t, err)
+		var result struct {
+			Tools []struct {
+				Name        string            `json:"name"`
+				Annotations map[string]string `json:"annotations"`
+			} `json:"tools"`
+		}
+		require.NoError(t, json.Unmarshal(output, &result))
+		tools := make(map[string]map[string]string)
+		for _, tool := range result.Tools {
+			tools[tool.Name] = tool.Annotations
+		}
+		return tools
+	}
+
+	_, err := run("scan", "--allow-path="+mockToolsDir)
+	require.NoError(t, err)
+	assert.Empty(t, listAnnotated("approved-for-prod"))
+
+	output, err := run("annotate", "gh", "approved-for-prod=true", "owner=platform team")
+	require.NoError(t, err)
+	var annotated struct {
+		Name        string            `json:"name"`
+		Annotations map[string]string `json:"annotations"`
+	}
+	require.NoError(t, json.Unmarshal(output, &annotated))
+	assert.Equal(t, "gh", annotated.Name)
+	assert.Equal(t, map[string]string{"approved-for-prod": "true", "owner": "platform team"}, annotated.Annotations)
+	_, err = run("annotate", "jq", "approved-for-prod=false", "deprecated=")
+	require.NoError(t, err)
+
+	// Re-probing keeps annotations
+	time.Sleep(10 * time.Millisecond)
+	createMockATIPTool(t, mockToolsDir, "gh", "2.46.0", "GitHub CLI")
+	_, err = run("refresh")
+	require.NoError(t, err)
+	_, err = run("scan", "--allow-path="+mockToolsDir)
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]map[string]string{
+		"gh": {"approved-for-prod": "true", "owner": "platform team"},
+	}, listAnnotated("approved-for-prod=true"))
+	assert.Len(t, listAnnotated("approved-for-prod"), 2)
+	assert.Equal(t, map[string]map[string]string{
+		"jq": {"approved-for-prod": "false", "deprecated": ""},
+	}, listAnnotated("approved-for-prod", "deprecated"))
+	assert.Empty(t, listAnnotated("approved-for-prod=true", "deprecated"))
+
+	// key- removes an annotation
+	output, err = run("annotate", "jq", "deprecated-")
+	require.NoError(t, err)
+	annotated.Annotations = nil
+	require.NoError(t, json.Unmarshal(output, &annotated))
+	assert.Equal(t, map[string]string{"approved-for-prod": "false"}, annotated.Annotations)
+	assert.Empty(t, listAnnotated("deprecated"))
+
+	_, err = run("annotate", "missing-tool", "owner=me")
+	var exitErr *exec.ExitError
+	require.ErrorAs(t, err, &exitErr)
+	assert.Equal(t, 1, exitErr.ExitCode())
+
+	for _, args := range [][]string{{"annotate", "gh"}, {"annotate", "gh", "no-value"}, {"annotate", "gh", "bad key=x"}, {"list", "--annotation", "bad key"}} {
+		_, err = run(args...)
+		require.ErrorAs(t, err, &exitErr, args)
+		assert.Equal(t, 2, exitErr.ExitCode(), args)
+	}
+}
+
+// TestScanProbesOnce tests that scan runs each tool once, even when its
+// directory is given twice, and reuses the probe when caching its metadata
+func TestScanProbesOnce(t *testing.T) {
+	binary := getBinaryPath(t)
+
+	tmpDir := t.TempDir()
+	env := append(os.Environ(), "XDG_DATA_HOME="+tmpDir, "XDG_CACHE_HOME="+filepath.Join(tmpDir, "cache"))
+	mockToolsDir := filepath.Join(tmpDir, "mock-bin")
+	require.NoError(t, os.MkdirAll(mockToolsDir, 0755))
+	logPath := filepath.Join(tmpDir, "runs.log")
+	require.NoError(t, os.WriteFile(filepath.Join(mockToolsDir, "counted"), []byte(`#!/bin/sh
+echo "$1" >> '`+logPath+`'
+if [ "$1" = "--agent" ]; then
+  echo '{"atip": {"version": "0.6"}, "name": "counted", "version": "1.0.0", "description": "Counts its runs", "commands": {}}'
+fi
+`), 0755))
+	runs := func() []string {
+		data, err := os.ReadFile(logPath)
+		require.NoError(t, err)
+		return strings.Fields(string(data))
+	}
+
+	cmd := exec.Command(binary, "scan", "--allow-path="+mockToolsDir, "--allow-path="+mockToolsDir+"/")
+	cmd.Env = env
+	output, err := cmd.Output()
+	require.NoError(t, err, string(output))
+	assert.Equal(t, []string{"--agent"}, runs())
+
+	// The metadata was cached from that single probe
+	_, err = os.Stat(filepath.Join(tmpDir, "cache", "agent-tools", "tools", "counted.json"))
+	require.NoError(t, err)
+
+	cmd = exec.Command(binary, "refresh")
+	cmd.Env = env
+	output, err = cmd.Output()
+	require.NoError(t, err, string(output))
+	assert.Equal(t, []string{"--agent", "--agent"}, runs())
+}
+
+// TestScanRemovedTools tests that deleted tools are marked, then pruned,
+// while tools outside the scanned directories are left alone
+func TestScanRemovedTools(t *testing.T) {
+	binary := getBinaryPath(t)
+
+	tmpDir := t.TempDir()
+	env := append(os.Environ(), "XDG_DATA_HOME="+tmpDir)
+
+	scannedDir := filepath.Join(tmpDir, "scanned-bin")
+	otherDir := filepath.Join(tmpDir, "other-bin")
+	require.NoError(t, os.MkdirAll(scannedDir, 0755))
+	require.NoError(t, os.MkdirAll(otherDir, 0755))
+	ghPath := createMockATIPTool(t, scannedDir, "gh", "2.45.0", "GitHub CLI")
+	createMockATIPTool(t, scannedDir, "jq", "1.7.1", "JSON processor")
+	kubectlPath := createMockATIPTool(t, otherDir, "kubectl", "1.28.0", "Kubernetes CLI")
+
+	run := func(args ...string) []byte {
+		cmd := exec.Command(binary, args...)
+		cmd.Env = env
+		output, err := cmd.Output()
+		require.NoError(t, err)
+		return output
+	}
+
+	type listResult struct {
+		Tools []struct {
+			Name    string `json:"name"`
+			Missing bool   `json:"missing"`
+		} `json:"tools"`
+	}
+	list := func() map[string]bool {
+		var result listResult
+		require.NoError(t, json.Unmarshal(run("list", "-o", "json"), &result))
+		tools := make(map[string]bool)
+		for _, tool := range result.Tools {
+			tools[tool.Name] = tool.Missing
+		}
+		return tools
+	}
+
+	run("scan", "--allow-path", scannedDir, "--allow-path", otherDir)
+	require.NoError(t, os.Remove(ghPath))
+	require.NoError(t, os.Remove(kubectlPath))
+
+	// Without --prune the entry is kept but marked; kubectl's directory isn't scanned
+	var result struct {
+		Removed int `json:"removed"`
+	}
+	require.NoError(t, json.Unmarshal(run("scan", "--allow-path", scannedDir, "-o", "json"), &result))
+	assert.Equal(t, 1, result.Removed)
+	assert.Equal(t, map[string]bool{"gh": true, "jq": false, "kubectl": false}, list())
+
+	// With --prune the entry is removed from the registry
+	require.NoError(t, json.Unmarshal(run("scan", "--allow-path", scannedDir, "--prune", "-o", "json"), &result))
+	assert.Equal(t, 1, result.Removed)
+	assert.Equal(t, map[string]bool{"jq": false, "kubectl": false}, list())
+}
+
+// TestScanFailFlags tests the opt-in exit codes for CI: 3 when no tools are
+// found, 4 when a probe failed, 0 without the flags
+func TestScanFailFlags(t *testing.T) {
+	binary := getBinaryPath(t)
+
+	tmpDir := t.TempDir()
+	emptyDir := filepath.Join(tmpDir, "empty-bin")
+	failingDir := filepath.Join(tmpDir, "failing-bin")
+	goodDir := filepath.Join(tmpDir, "good-bin")
+	for _, dir := range []string{emptyDir, failingDir, goodDir} {
+		require.NoError(t, os.MkdirAll(dir, 0755))
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(failingDir, "broken"), []byte("#!/bin/sh\nexit 1\n"), 0755))
+	createMockATIPTool(t, goodDir, "gh", "2.45.0", "GitHub CLI")
+
+	tests := []struct {
+		name     string
+		dirs     []string
+		flags    []string
+		wantExit int
+	}{
+		{name: "empty dir without flags", dirs: []string{emptyDir}, wantExit: 0},
+		{name: "failing tool without flags", dirs: []string{failingDir}, wantExit: 0},
+		{name: "fail-if-none with empty dir", dirs: []string{emptyDir}, flags: []string{"--fail-if-none"}, wantExit: 3},
+		{name: "fail-if-none with tools", dirs: []string{goodDir}, flags: []string{"--fail-if-none"}, wantExit: 0},
+		{name: "fail-on-error with failing tool", dirs: []string{goodDir, failingDir}, flags: []string{"--fail-on-error"}, wantExit: 4},
+		{name: "fail-on-error with empty dir", dirs: []string{emptyDir}, flags: []string{"--fail-on-error"}, wantExit: 0},
+		{name: "none found takes precedence", dirs: []string{failingDir}, flags: []string{"--fail-on-error", "--fail-if-none"}, wantExit: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := []string{"scan", "-o", "json"}
+			for _, dir := range tt.dirs {
+				args = append(args, "--allow-path", dir)
+			}
+			cmd := exec.Command(binary, append(args, tt.flags...)...)
+			cmd.Env = append(os.Environ(), "XDG_DATA_HOME="+t.TempDir())
+			output, err := cmd.Output()
+
+			if tt.wantExit == 0 {
+				require.NoError(t, err)
+			} else {
+				var exitErr *exec.ExitError
+				require.ErrorAs(t, err, &exitErr)
+				assert.Equal(t, tt.wantExit, exitErr.ExitCode())
+			}
+
+			// The scan result is written either way
+			var result map[string]interface{}
+			require.NoError(t, json.Unmarshal(output, &result))
+			assert.Contains(t, result, "stats")
+		})
+	}
+}
+
+// TestScanTimeoutOverride tests that a slow tool given a generous per-tool
+// timeout is discovered while the global timeout stays short
+func TestScanTimeoutOverride(t *testing.T) {
+	binary := getBinaryPath(t)
+
+	mockToolsDir := filepath.Join(t.TempDir(), "mock-bin")
+	require.NoError(t, os.MkdirAll(mockToolsDir, 0755))
+	script := `#!/bin/sh
+sleep 0.5
+echo '{"atip": {"version": "0.6"}, "name": "slowtool", "version": "1.0.0", "description": "Slow tool"}'
+`
+	require.NoError(t, os.WriteFile(filepath.Join(mockToolsDir, "slowtool"), []byte(script), 0755))
+
+	tests := []struct {
+		name   string
+		config string
+		flags  []string
+		found  bool
+	}{
+		{name: "global timeout only", config: `{}`, found: false},
+		{name: "flag override", config: `{}`, flags: []string{"--timeout-override", "slowtool=5s"}, found: true},
+		{name: "config override", config: `{"discovery": {"timeouts": {"slowtool": "5s"}}}`, found: true},
+		{name: "flag over config", config: `{"discovery": {"timeouts": {"slowtool": "5s"}}}`, flags: []string{"--timeout-override", "slowtool=50ms"}, found: false},
+		{name: "override for another tool", config: `{}`, flags: []string{"--timeout-override", "othertool=5s"}, found: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := append([]string{"scan", "-o", "json", "--allow-path=" + mockToolsDir, "--timeout", "100ms"}, tt.flags...)
+			cmd := exec.Command(binary, args...)
+			cmd.Env = isolatedConfigEnv(t, tt.config, "XDG_CACHE_HOME="+t.TempDir())
+			output, err := cmd.Output()
+			require.NoError(t, err)
+
+			var result struct {
+				Discovered int `json:"discovered"`
+				Errors     []struct {
+					Kind string `json:"kind"`
+				} `json:"errors"`
+			}
+			require.NoError(t, json.Unmarshal(output, &result))
+			if tt.found {
+				assert.Equal(t, 1, result.Discovered)
+				assert.Empty(t, result.Errors)
+			} else {
+				assert.Equal(t, 0, result.Discovered)
+				require.Len(t, result.Errors, 1)
+				assert.Equal(t, "timeout", result.Errors[0].Kind)
+			}
+		})
+	}
+
+	// Malformed overrides are rejected
+	for _, value := range []string{"slowtool", "slowtool=soon", "=5s", "slowtool=0s"} {
+		cmd := exec.Command(binary, "scan", "-o", "json", "--allow-path="+mockToolsDir, "--timeout-override", value)
+		cmd.Env = isolatedConfigEnv(t, `{}`)
+		output, err := cmd.Output()
+
+		var exitErr *exec.ExitError
+		require.ErrorAs(t, err, &exitErr, value)
+		var envelope errorEnvelope
+		require.NoError(t, json.Unmarshal(output, &envelope), value)
+		assert.Equal(t, "INVALID_TIMEOUT", envelope.Error.Code, value)
+	}
+}
+
+// TestScanConfigTimeoutAndParallelism tests that scan probes with the
+// configured timeout and parallelism, from the config file or environment,
+// unless --timeout or --parallel is given
+func TestScanConfigTimeoutAndParallelism(t *testing.T) {
+	binary := getBinaryPath(t)
+
+	mockToolsDir := filepath.Join(t.TempDir(), "mock-bin")
+	require.NoError(t, os.MkdirAll(mockToolsDir, 0755))
+	script := `#!/bin/sh
+sleep 0.5
+echo '{"atip": {"version": "0.6"}, "name": "slowtool", "version": "1.0.0", "description": "Slow tool"}'
+`
+	require.NoError(t, os.WriteFile(filepath.Join(mockToolsDir, "slowtool"), []byte(script), 0755))
+
+	timeouts := []struct {
+		name   string
+		config string
+		env    []string
+		flags  []string
+		found  bool
+	}{
+		{name: "default", config: `{}`, found: true},
+		{name: "config", config: `{"discovery": {"scan_timeout": "100ms"}}`, found: false},
+		{name: "environment", config: `{}`, env: []string{"ATIP_DISCOVER_TIMEOUT=100ms"}, found: false},
+		{name: "flag over config", config: `{"discovery": {"scan_timeout": "100ms"}}`, flags: []string{"--timeout", "5s"}, found: true},
+	}
+	for _, tt := range timeouts {
+		t.Run("timeout "+tt.name, func(t *testing.T) {
+			cmd := exec.Command(binary, append([]string{"scan", "-o", "json", "--allow-path=" + mockToolsDir}, tt.flags...)...)
+			cmd.Env = isolatedConfigEnv(t, tt.config, append(tt.env, "XDG_CACHE_HOME="+t.TempDir())...)
+			output, err := cmd.Output()
+			require.NoError(t, err)
+
+			var result struct {
+				Discovered int `json:"discovered"`
+			}
+			require.NoError(t, json.Unmarshal(output, &result))
+			if tt.found {
+				assert.Equal(t, 1, result.Discovered)
+			} else {
+				assert.Equal(t, 0, result.Discovered)
+			}
+		})
+	}
+
+	// Each probe records how many probes are running alongside it
+	probesDir := filepath.Join(t.TempDir(), "probes")
+	parallelDir := filepath.Join(t.TempDir(), "mock-bin")
+	require.NoError(t, os.MkdirAll(parallelDir, 0755))
+	for i := 0; i < 4; i++ {
+		script := fmt.Sprintf(`#!/bin/sh
+mkdir -p %[1]s
+touch %[1]s/$$
+sleep 0.3
+ls %[1]s | grep -v peak | wc -l >> %[1]s/peak
+rm %[1]s/$$
+`, probesDir)
+		require.NoError(t, os.WriteFile(filepath.Join(parallelDir, fmt.Sprintf("tool%d", i)), []byte(script), 0755))
+	}
+	peak := func(config string, env []string, flags ...string) int {
+		t.Helper()
+		require.NoError(t, os.RemoveAll(probesDir))
+		cmd := exec.Command(binary, append([]string{"scan", "-o", "json", "--allow-path=" + parallelDir, "--error-kinds", "all"}, flags...)...)
+		cmd.Env = isolatedConfigEnv(t, config, append(env, "XDG_CACHE_HOME="+t.TempDir())...)
+		_, err := cmd.Output()
+		require.NoError(t, err)
+
+		data, err := os.ReadFile(filepath.Join(probesDir, "peak"))
+		require.NoError(t, err)
+		most := 0
+		for _, field := range strings.Fields(string(data)) {
+			n, err := strconv.Atoi(field)
+			require.NoError(t, err)
+			most = max(most, n)
+		}
+		return most
+	}
+	assert.Equal(t, 1, peak(`{"discovery": {"parallelism": 1}}`, nil))
+	assert.Equal(t, 1, peak(`{}`, []string{"ATIP_DISCOVER_PARALLEL=1"}))
+	assert.Greater(t, peak(`{"discovery": {"parallelism": 1}}`, nil, "--parallel", "4"), 1)
+
+	cmd := exec.Command(binary, "scan", "-o", "json", "--allow-path="+parallelDir, "--parallel", "0")
+	cmd.Env = isolatedConfigEnv(t, `{}`)
+	output, err := cmd.Output()
+	var exitErr *exec.ExitError
+	require.ErrorAs(t, err, &exitErr)
+	var envelope errorEnvelope
+	require.NoError(t, json.Unmarshal(output, &envelope))
+	assert.Equal(t, "INVALID_ARGUMENT", envelope.Error.Code)
+}
+
+// TestScanDeadline tests that --deadline cuts a scan of slow tools short,
+// registering the tools that answered in time
+func TestScanDeadline(t *testing.T) {
+	binary := getBinaryPath(t)
+
+	tmpDir := t.TempDir()
+	mockToolsDir := filepath.Join(tmpDir, "mock-bin")
+	require.NoError(t, os.MkdirAll(mockToolsDir, 0755))
+
+	createMockATIPTool(t, mockToolsDir, "gh", "2.45.0", "GitHub CLI")
+	for i := 0; i < 8; i++ {
+		slow := filepath.Join(mockToolsDir, fmt.Sprintf("slow%d", i))
+		require.NoError(t, os.WriteFile(slow, []byte("#!/bin/sh\nsleep 30\n"), 0755))
+	}
+
+	start := time.Now()
+	cmd := exec.Command(binary, "scan", "-o", "json", "--allow-path="+mockToolsDir,
+		"--timeout", "60s", "--parallel", "2", "--deadline", "500ms")
+	cmd.Env = isolatedConfigEnv(t, `{}`, "XDG_CACHE_HOME="+t.TempDir())
+	output, err := cmd.Output()
+	require.NoError(t, err)
+	assert.Less(t, time.Since(start), 10*time.Second)
+
+	var result struct {
+		Discovered       int  `json:"discovered"`
+		Failed           int  `json:"failed"`
+		DeadlineExceeded bool `json:"deadline_exceeded"`
+		Unprobed         int  `json:"unprobed"`
+		Tools            []struct {
+			Name string `json:"name"`
+		} `json:"tools"`
+	}
+	require.NoError(t, json.Unmarshal(output, &result))
+	assert.True(t, result.DeadlineExceeded)
+	assert.Equal(t, 8, result.Unprobed)
+	assert.Equal(t, 0, result.Failed)
+	require.Len(t, result.Tools, 1)
+	assert.Equal(t, "gh", result.Tools[0].Name)
+
+	// Malformed deadlines are rejected
+	for _, value := range []string{"soon", "0s", "-1s"} {
+		cmd := exec.Command(binary, "scan", "-o", "json", "--allow-path="+mockToolsDir, "--deadline", value)
+		cmd.Env = isolatedConfigEnv(t, `{}`)
+		output, err := cmd.Output()
+
+		var exitErr *exec.ExitError
+		require.ErrorAs(t, err, &exitErr, value)
+		var envelope errorEnvelope
+		require.NoError(t, json.Unmarshal(output, &envelope), value)
+		assert.Equal(t, "INVALID_TIMEOUT", envelope.Error.Code, value)
+	}
+}
+
+// TestScanProbeRetries tests that a tool which prints nothing on its first
+// run is discovered when retries are allowed
+func TestScanProbeRetries(t *testing.T) {
+	binary := getBinaryPath(t)
+
+	mockToolsDir := filepath.Join(t.TempDir(), "mock-bin")
+	require.NoError(t, os.MkdirAll(mockToolsDir, 0755))
+	marker := filepath.Join(t.TempDir(), "warm")
+	script := `#!/bin/sh
+if [ ! -e '` + marker + `' ]; then
+  touch '` + marker + `'
+  exit 0
+fi
+echo '{"atip": {"version": "0.6"}, "name": "coldstart", "version": "1.0.0", "description": "Cold start tool"}'
+`
+	require.NoError(t, os.WriteFile(filepath.Join(mockToolsDir, "coldstart"), []byte(script), 0755))
+
+	type scanResult struct {
+		Discovered int `json:"discovered"`
+		Tools      []struct {
+			Name    string `json:"name"`
+			Retries int    `json:"retries"`
+		} `json:"tools"`
+		Stats struct {
+			Retries int `json:"retries"`
+		} `json:"stats"`
+	}
+	scan := func(flags ...string) scanResult {
+		args := append([]string{"scan", "-o", "json", "--allow-path=" + mockToolsDir}, flags...)
+		cmd := exec.Command(binary, args...)
+		cmd.Env = isolatedConfigEnv(t, `{}`, "XDG_CACHE_HOME="+t.TempDir())
+		output, err := cmd.Output()
+		require.NoError(t, err)
+
+		var result scanResult
+		require.NoError(t, json.Unmarshal(output, &result))
+		return result
+	}
+
+	// Without retries the cold start is a failure
+	result := scan()
+	assert.Equal(t, 0, result.Discovered)
+
+	require.NoError(t, os.Remove(marker))
+	result = scan("--probe-retries", "1")
+	assert.Equal(t, 1, result.Discovered)
+	require.Len(t, result.Tools, 1)
+	assert.Equal(t, "coldstart", result.Tools[0].Name)
+	assert.Equal(t, 1, result.Tools[0].Retries)
+	assert.Equal(t, 1, result.Stats.Retries)
+}
+
+// TestCorruptCache tests that list and get detect cached metadata that no
+// longer matches its recorded digest, and refresh --repair-cache rewrites it
+func TestCorruptCache(t *testing.T) {
+	binary := getBinaryPath(t)
+
+	tmpDir := t.TempDir()
+	cacheHome := filepath.Join(tmpDir, "cache")
+	env := append(os.Environ(), "XDG_DATA_HOME="+tmpDir, "XDG_CACHE_HOME="+cacheHome)
+
+	mockToolsDir := filepath.Join(tmpDir, "mock-bin")
+	require.NoError(t, os.MkdirAll(mockToolsDir, 0755))
+	createMockATIPTool(t, mockToolsDir, "gh", "2.45.0", "GitHub CLI")
+	createMockATIPTool(t, mockToolsDir, "kubectl", "1.28.0", "Kubernetes CLI")
+
+	cmd := exec.Command(binary, "scan", "--allow-path="+mockToolsDir)
+	cmd.Env = env
+	_, err := cmd.Output()
+	require.NoError(t, err)
+
+	// Flip the description in gh's cache, keeping it valid JSON
+	cachePath := filepath.Join(cacheHome, "agent-tools", "tools", "gh.json")
+	data, err := os.ReadFile(cachePath)
+	require.NoError(t, err)
+	require.Contains(t, string(data), "GitHub CLI")
+	require.NoError(t, os.WriteFile(cachePath, bytes.Replace(data, []byte("GitHub CLI"), []byte("Tampered"), 1), 0644))
+
+	// list treats it as a cache miss and says why
+	cmd = exec.Command(binary, "list", "-o", "json")
+	cmd.Env = env
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	require.NoError(t, err)
+	assert.Contains(t, stderr.String(), "corrupt cached metadata for gh")
+	assert.NotContains(t, string(output), "Tampered")
+	assert.Contains(t, string(output), "Kubernetes CLI")
+
+	// get refuses to serve it
+	cmd = exec.Command(binary, "get", "gh", "-o", "json")
+	cmd.Env = env
+	output, _ = cmd.Output()
+	assert.Equal(t, 2, cmd.ProcessState.ExitCode())
+	var envelope struct {
+		Error struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	require.NoError(t, json.Unmarshal(output, &envelope))
+	assert.Equal(t, "CACHE_CORRUPT", envelope.Error.Code)
+	assert.Contains(t, envelope.Error.Message, "--repair-cache")
+
+	// --repair-cache re-probes only gh
+	cmd = exec.Command(binary, "refresh", "--repair-cache", "-o", "json")
+	cmd.Env = env
+	output, err = cmd.Output()
+	require.NoError(t, err)
+	var result struct {
+		Skipped int `json:"skipped"`
+		Tools   []struct {
+			Name     string `json:"name"`
+			Status   string `json:"status"`
+			Repaired bool   `json:"repaired"`
+		} `json:"tools"`
+	}
+	require.NoError(t, json.Unmarshal(output, &result))
+	assert.Equal(t, 1, result.Skipped)
+	require.Len(t, result.Tools, 1)
+	assert.Equal(t, "gh", result.Tools[0].Name)
+	assert.Equal(t, "unchanged", result.Tools[0].Status)
+	assert.True(t, result.Tools[0].Repaired)
+
+	cmd = exec.Command(binary, "get", "gh", "-o", "json")
+	cmd.Env = env
+	output, err = cmd.Output()
+	require.NoError(t, err)
+	assert.Contains(t, string(output), "GitHub CLI")
+
+	// Nothing is left to repair
+	cmd = exec.Command(binary, "refresh", "--repair-cache", "-o", "json")
+	cmd.Env = env
+	output, err = cmd.Output()
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(output, &result))
+	assert.Equal(t, 2, result.Skipped)
+	assert.Empty(t, result.Tools)
+}
+
+// TestRegistryExportImport tests that a registry exported as NDJSON and
+// imported into an empty registry comes back the same
+func TestRegistryExportImport(t *testing.T) {
+	binary := getBinaryPath(t)
+
+	tmpDir := t.TempDir()
+	cacheHome := filepath.Join(tmpDir, "cache")
+	env := append(os.Environ(), "XDG_DATA_HOME="+tmpDir, "XDG_CACHE_HOME="+cacheHome)
+	mockToolsDir := filepath.Join(tmpDir, "mock-bin")
+	require.NoError(t, os.MkdirAll(mockToolsDir, 0755))
+	createMockATIPTool(t, mockToolsDir, "gh", "2.45.0", "GitHub CLI")
+	createMockATIPTool(t, mockToolsDir, "kubectl", "1.28.0", "Kubernetes CLI")
+
+	run := func(args ...string) []byte {
+		cmd := exec.Command(binary, args...)
+		cmd.Env = env
+		output, err := cmd.Output()
+		require.NoError(t, err, string(output))
+		return output
+	}
+	run("scan", "--allow-path="+mockToolsDir)
+	run("tag", "gh", "vcs")
+
+	registryPath := filepath.Join(tmpDir, "agent-tools", "registry.json")
+	readTools := func() []interface{} {
+		data, err := os.ReadFile(registryPath)
+		require.NoError(t, err)
+		var reg map[string]interface{}
+		require.NoError(t, json.Unmarshal(data, &reg))
+		return reg["tools"].([]interface{})
+	}
+	before := readTools()
+
+	exportPath := filepath.Join(tmpDir, "tools.ndjson")
+	run("registry", "export", "--ndjson", exportPath)
+	data, err := os.ReadFile(exportPath)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	require.Len(t, lines, 2)
+	for _, line := range lines {
+		assert.True(t, json.Valid([]byte(line)), line)
+	}
+
+	// Clear the registry and import the export
+	require.NoError(t, os.Remove(registryPath))
+	var result struct {
+		Imported int `json:"imported"`
+		Failed   int `json:"failed"`
+		Errors   []struct {
+			Line  int    `json:"line"`
+			Error string `json:"error"`
+		} `json:"errors"`
+	}
+	require.NoError(t, json.Unmarshal(run("registry", "import", exportPath), &result))
+	assert.Equal(t, 2, result.Imported)
+	assert.Equal(t, 0, result.Failed)
+	assert.Empty(t, result.Errors)
+	assert.Equal(t, before, readTools())
+
+	// Metadata travels with --include-metadata, so a fresh cache can serve get
+	run("registry", "export", "--ndjson", "--include-metadata", exportPath)
+	require.NoError(t, os.Remove(registryPath))
+	require.NoError(t, os.RemoveAll(cacheHome))
+	run("registry", "import", exportPath)
+	var metadata map[string]interface{}
+	require.NoError(t, json.Unmarshal(run("get", "kubectl"), &metadata))
+	assert.Equal(t, "Kubernetes CLI", metadata["description"])
+}
+
+// TestRegistryImportInvalidLines tests that invalid lines are reported and
+// skipped, or with --strict abort the import
+func TestRegistryImportInvalidLines(t *testing.T) {
+	binary := getBinaryPath(t)
+
+	tmpDir := t.TempDir()
+	env := append(os.Environ(), "XDG_DATA_HOME="+tmpDir, "XDG_CACHE_HOME="+filepath.Join(tmpDir, "cache"))
+	importPath := filepath.Join(tmpDir, "seed.ndjson")
+	require.NoError(t, os.WriteFile(importPath, []byte(`{"name": "gh", "version": "2.45.0", "path": "/usr/bin/gh", "source": "native"}
+{"name": "kubectl", "version": "1.28.0"}
+{"atip": {"version": "0.6"}, "name": "jq", "version": "1.7.1", "description": "JSON processor"}
+`), 0644))
+
+	listNames := func() []string {
+		cmd := exec.Command(binary, "list", "-o", "quiet")
+		cmd.Env = env
+		output, err := cmd.Output()
+		require.NoError(t, err)
+		return strings.Fields(string(output))
+	}
+
+	// --strict imports nothing
+	cmd := exec.Command(binary, "registry", "import", "--strict", importPath)
+	cmd.Env = env
+	output, _ := cmd.Output()
+	assert.Equal(t, 2, cmd.ProcessState.ExitCode())
+	var envelope struct {
+		Error struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	require.NoError(t, json.Unmarshal(output, &envelope))
+	assert.Equal(t, "INVALID_IMPORT", envelope.Error.Code)
+	assert.Contains(t, envelope.Error.Message, "line 2")
+	assert.Empty(t, listNames())
+
+	// Without it the valid lines are imported, metadata as a shim
+	cmd = exec.Command(binary, "registry", "import", importPath)
+	cmd.Env = env
+	output, err := cmd.Output()
+	require.NoError(t, err)
+	var result struct {
+		Imported int `json:"imported"`
+		Failed   int `json:"failed"`
+		Errors   []struct {
+			Line  int    `json:"line"`
+			Error string `json:"error"`
+		} `json:"errors"`
+	}
+	require.NoError(t, json.Unmarshal(output, &result))
+	assert.Equal(t, 2, result.Imported)
+	assert.Equal(t, 1, result.Failed)
+	require.Len(t, result.Errors, 1)
+	assert.Equal(t, 2, result.Errors[0].Line)
+	assert.Contains(t, result.Errors[0].Error, "unknown source")
+	assert.Equal(t, []string{"gh", "jq"}, listNames())
+
+	cmd = exec.Command(binary, "get", "jq", "--effects")
+	cmd.Env = env
+	_, err = cmd.Output()
+	assert.NoError(t, err)
+}
+
+// TestScanIncludeShims tests that scan --include-shims and registry
+// load-shims merge shims from the data directory, keeping native tools
+// unless --prefer-shims
+func TestScanIncludeShims(t *testing.T) {
+	binary := getBinaryPath(t)
+
+	tmpDir := t.TempDir()
+	env := append(os.Environ(), "XDG_DATA_HOME="+tmpDir, "XDG_CACHE_HOME="+filepath.Join(tmpDir, "cache"))
+	mockToolsDir := filepath.Join(tmpDir, "mock-bin")
+	require.NoError(t, os.MkdirAll(mockToolsDir, 0755))
+	createMockATIPTool(t, mockToolsDir, "gh", "2.45.0", "GitHub CLI")
+
+	shimsDir := filepath.Join(tmpDir, "agent-tools", "shims")
+	require.NoError(t, os.MkdirAll(shimsDir, 0755))
+	for name, version := range map[string]string{"gh": "2.40.0", "curl": "8.4.0"} {
+		shim := `{"atip": {"version": "0.6"}, "name": "` + name + `", "version": "` + version + `", "description": "Shim for ` + name + `",
+			"commands": {"": {"description": "Run", "effects": {"network": true}}}}`
+		require.NoError(t, os.WriteFile(filepath.Join(shimsDir, name+".json"), []byte(shim), 0644))
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(shimsDir, "broken.json"), []byte("not json"), 0644))
+
+	run := func(args ...string) []byte {
+		cmd := exec.Command(binary, args...)
+		cmd.Env = env
+		output, err := cmd.Output()
+		require.NoError(t, err, string(output))
+		return output
+	}
+	type shimCounts struct {
+		Loaded   int `json:"loaded"`
+		Shadowed int `json:"shadowed"`
+		Invalid  int `json:"invalid"`
+	}
+	listSources := func() map[string]string {
+		var result struct {
+			Tools []struct {
+				Name   string `json:"name"`
+				Source string `json:"source"`
+			} `json:"tools"`
+		}
+		require.NoError(t, json.Unmarshal(run("list", "-o", "json"), &result))
+		sources := make(map[string]string)
+		for _, tool := range result.Tools {
+			sources[tool.Name] = tool.Source
+		}
+		return sources
+	}
+
+	// Shims are only loaded on request
+	run("scan", "--allow-path="+mockToolsDir)
+	assert.Equal(t, map[string]string{"gh": "native"}, listSources())
+
+	var scan struct {
+		Shims shimCounts `json:"shims"`
+	}
+	require.NoError(t, json.Unmarshal(run("scan", "--allow-path="+mockToolsDir, "--include-shims"), &scan))
+	assert.Equal(t, shimCounts{Loaded: 1, Shadowed: 1, Invalid: 1}, scan.Shims)
+	assert.Equal(t, map[string]string{"gh": "native", "curl": "shim"}, listSources())
+
+	var shimList struct {
+		Count int `json:"count"`
+		Tools []struct {
+			Name string `json:"name"`
+		} `json:"tools"`
+	}
+	require.NoError(t, json.Unmarshal(run("list", "--source", "shim"), &shimList))
+	require.Equal(t, 1, shimList.Count)
+	assert.Equal(t, "curl", shimList.Tools[0].Name)
+
+	var metadata map[string]interface{}
+	require.NoError(t, json.Unmarshal(run("get", "curl", "--offline"), &metadata))
+	assert.Equal(t, "Shim for curl", metadata["description"])
+
+	// --prefer-shims replaces the native gh
+	var loaded shimCounts
+	require.NoError(t, json.Unmarshal(run("registry", "load-shims", "--prefer-shims"), &loaded))
+	assert.Equal(t, shimCounts{Loaded: 2, Invalid: 1}, loaded)
+	assert.Equal(t, map[string]string{"gh": "shim", "curl": "shim"}, listSources())
+}
+
+// TestRefreshSince tests that refresh only re-probes tools that are due
+func TestRefreshSince(t *testing.T) {
+	binary := getBinaryPath(t)
+
+	tmpDir := t.TempDir()
+	env := append(os.Environ(), "XDG_DATA_HOME="+tmpDir)
+
+	mockToolsDir := filepath.Join(tmpDir, "mock-bin")
+	require.NoError(t, os.MkdirAll(mockToolsDir, 0755))
+	createMockATIPTool(t, mockToolsDir, "gh", "2.45.0", "GitHub CLI")
+	createMockATIPTool(t, mockToolsDir, "kubectl", "1.28.0", "Kubernetes CLI")
+	createMockATIPTool(t, mockToolsDir, "jq", "1.7.1", "JSON processor")
+
+	cmd := exec.Command(binary, "scan", "--allow-path="+mockToolsDir)
+	cmd.Env = env
+	_, err := cmd.Output()
+	require.NoError(t, err)
+
+	// Backdate verification: gh is two days old, kubectl two hours, jq fresh
+	registryPath := filepath.Join(tmpDir, "agent-tools", "registry.json")
+	data, err := os.ReadFile(registryPath)
+	require.NoError(t, err)
+	var reg map[string]interface{}
+	require.NoError(t, json.Unmarshal(data, &reg))
+	ages := map[string]time.Duration{"gh": 48 * time.Hour, "kubectl": 2 * time.Hour}
+	for _, tool := range reg["tools"].([]interface{}) {
+		entry := tool.(map[string]interface{})
+		if age, ok := ages[entry["name"].(string)]; ok {
+			entry["last_verified"] = time.Now().Add(-age).Format(time.RFC3339Nano)
+		}
+	}
+	data, err = json.Marshal(reg)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(registryPath, data, 0644))
+
+	type refreshResult struct {
+		Skipped int `json:"skipped"`
+		Tools   []struct {
+			Name string `json:"name"`
+		} `json:"tools"`
+	}
+
+	refresh := func(args ...string) refreshResult {
+		cmd := exec.Command(binary, append([]string{"refresh", "-o", "json"}, args...)...)
+		cmd.Env = env
+		output, err := cmd.Output()
+		require.NoError(t, err)
+		var result refreshResult
+		require.NoError(t, json.Unmarshal(output, &result))
+		return result
+	}
+
+	result := refresh("--since", "24h")
+	assert.Equal(t, 2, result.Skipped)
+	require.Len(t, result.Tools, 1)
+	assert.Equal(t, "gh", result.Tools[0].Name)
+
+	// gh was just re-verified, leaving only kubectl due after an hour
+	result = refresh("--since", "1h")
+	assert.Equal(t, 2, result.Skipped)
+	require.Len(t, result.Tools, 1)
+	assert.Equal(t, "kubectl", result.Tools[0].Name)
+
+	// Nothing changed on disk, so nothing is stale
+	result = refresh("--stale-only")
+	assert.Equal(t, 3, result.Skipped)
+	assert.Empty(t, result.Tools)
+}
+
+// Helper functions
+
+func createMockATIPTool(t *testing.T, dir, name, version, description string) string {
+	toolPath := filepath.Join(dir, name)
+	script := `#!/bin/sh
 if [ "$1" = "--agent" ]; then
   cat <<EOF
 {
@@ -409,3 +2375,288 @@ func getToolNames(tools []struct {
 	}
 	return names
 }
+
+// TestScanErrorKinds tests that scan hides no_agent_support errors by
+// default and that --error-kinds selects which kinds are reported
+func TestScanErrorKinds(t *testing.T) {
+	binary := getBinaryPath(t)
+
+	mockToolsDir := filepath.Join(t.TempDir(), "mock-bin")
+	require.NoError(t, os.MkdirAll(mockToolsDir, 0755))
+	createMockATIPTool(t, mockToolsDir, "gh", "2.45.0", "GitHub CLI")
+	require.NoError(t, os.WriteFile(filepath.Join(mockToolsDir, "plain"), []byte("#!/bin/sh\necho 'unknown option' >&2\nexit 2\n"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(mockToolsDir, "hang"), []byte("#!/bin/sh\nexec sleep 10\n"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(mockToolsDir, "crash"), []byte("#!/bin/sh\nkill -SEGV $$\n"), 0755))
+
+	tests := []struct {
+		name  string
+		flags []string
+		want  map[string]string // Tool name -> kind
+	}{
+		{name: "default", want: map[string]string{"hang": "timeout", "crash": "crash"}},
+		{name: "timeout only", flags: []string{"--error-kinds", "timeout"}, want: map[string]string{"hang": "timeout"}},
+		{name: "no agent support", flags: []string{"--error-kinds", "no_agent_support,crash"}, want: map[string]string{"plain": "no_agent_support", "crash": "crash"}},
+		{name: "all", flags: []string{"--error-kinds", "all"}, want: map[string]string{"hang": "timeout", "crash": "crash", "plain": "no_agent_support"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := append([]string{"scan", "-o", "json", "--allow-path=" + mockToolsDir, "--timeout", "200ms"}, tt.flags...)
+			cmd := exec.Command(binary, args...)
+			cmd.Env = isolatedConfigEnv(t, `{}`, "XDG_CACHE_HOME="+t.TempDir())
+			output, err := cmd.Output()
+			require.NoError(t, err)
+
+			var result struct {
+				Discovered     int `json:"discovered"`
+				Failed         int `json:"failed"`
+				NoAgentSupport int `json:"no_agent_support"`
+				Errors         []struct {
+					Path string `json:"path"`
+					Kind string `json:"kind"`
+				} `json:"errors"`
+				Stats struct {
+					ErrorsByKind map[string]int `json:"errors_by_kind"`
+				} `json:"stats"`
+			}
+			require.NoError(t, json.Unmarshal(output, &result))
+
+			kinds := map[string]string{}
+			for _, scanErr := range result.Errors {
+				kinds[filepath.Base(scanErr.Path)] = scanErr.Kind
+			}
+			assert.Equal(t, tt.want, kinds)
+
+			// Counts cover every failure regardless of the filter
+			assert.Equal(t, 1, result.Discovered)
+			assert.Equal(t, 3, result.Failed)
+			assert.Equal(t, 1, result.NoAgentSupport)
+			assert.Equal(t, map[string]int{"timeout": 1, "crash": 1, "no_agent_support": 1}, result.Stats.ErrorsByKind)
+		})
+	}
+
+	cmd := exec.Command(binary, "scan", "-o", "json", "--allow-path="+mockToolsDir, "--error-kinds", "timeout,bogus")
+	cmd.Env = isolatedConfigEnv(t, `{}`)
+	output, err := cmd.Output()
+	var exitErr *exec.ExitError
+	require.ErrorAs(t, err, &exitErr)
+	assert.Equal(t, 2, exitErr.ExitCode())
+	var envelope errorEnvelope
+	require.NoError(t, json.Unmarshal(output, &envelope))
+	assert.Equal(t, "INVALID_ARGUMENT", envelope.Error.Code)
+}
+
+// TestScanNDJSON tests that scan -o ndjson streams a line per tool and error
+// followed by a summary whose counts match the stream
+func TestScanNDJSON(t *testing.T) {
+	binary := getBinaryPath(t)
+	env := isolatedConfigEnv(t, `{}`, "XDG_CACHE_HOME="+t.TempDir())
+
+	mockToolsDir := filepath.Join(t.TempDir(), "mock-bin")
+	require.NoError(t, os.MkdirAll(mockToolsDir, 0755))
+	createMockATIPTool(t, mockToolsDir, "gh", "2.45.0", "GitHub CLI")
+	createMockATIPTool(t, mockToolsDir, "kubectl", "1.28.0", "Kubernetes CLI")
+	require.NoError(t, os.WriteFile(filepath.Join(mockToolsDir, "plain"), []byte("#!/bin/sh\nexit 2\n"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(mockToolsDir, "garbage"), []byte("#!/bin/sh\necho nope\n"), 0755))
+
+	cmd := exec.Command(binary, "scan", "-o", "ndjson", "--allow-path="+mockToolsDir)
+	cmd.Env = env
+	output, err := cmd.Output()
+	require.NoError(t, err)
+
+	type event struct {
+		Type       string `json:"type"`
+		Name       string `json:"name"`
+		Path       string `json:"path"`
+		Kind       string `json:"kind"`
+		Discovered int    `json:"discovered"`
+		Failed     int    `json:"failed"`
+		Tools      int    `json:"tools"`
+		Errors     int    `json:"errors"`
+	}
+	lines := strings.Split(strings.TrimSuffix(string(output), "\n"), "\n")
+	require.NotEmpty(t, lines)
+
+	var tools, errs []string
+	for _, line := range lines[:len(lines)-1] {
+		var e event
+		require.NoError(t, json.Unmarshal([]byte(line), &e), "line: %s", line)
+		switch e.Type {
+		case "tool":
+			tools = append(tools, e.Name)
+		case "error":
+			errs = append(errs, filepath.Base(e.Path)+":"+e.Kind)
+		default:
+			t.Fatalf("unexpected event before the summary: %s", line)
+		}
+	}
+	sort.Strings(tools)
+	assert.Equal(t, []string{"gh", "kubectl"}, tools)
+	// no_agent_support errors are hidden by default, as in batched output
+	assert.Equal(t, []string{"garbage:invalid_json"}, errs)
+
+	var summary event
+	require.NoError(t, json.Unmarshal([]byte(lines[len(lines)-1]), &summary))
+	assert.Equal(t, "summary", summary.Type)
+	assert.Equal(t, len(tools), summary.Tools)
+	assert.Equal(t, len(errs), summary.Errors)
+	assert.Equal(t, 2, summary.Discovered)
+	assert.Equal(t, 2, summary.Failed)
+
+	// Streaming can't be combined with an atomically written file
+	cmd = exec.Command(binary, "scan", "-o", "ndjson", "--allow-path="+mockToolsDir, "--output-file", filepath.Join(t.TempDir(), "out.ndjson"))
+	cmd.Env = env
+	output, err = cmd.Output()
+	var exitErr *exec.ExitError
+	require.ErrorAs(t, err, &exitErr)
+	var envelope errorEnvelope
+	require.NoError(t, json.Unmarshal(output, &envelope))
+	assert.Equal(t, "INVALID_ARGUMENT", envelope.Error.Code)
+	assert.Equal(t, 1, strings.Count(string(output), "\n"), "ndjson errors fit on one line")
+}
+
+// TestScanVerifyChecksums tests that scan --verify-checksums rejects tools
+// whose executable doesn't match their declared hash and caches the hashes
+func TestScanVerifyChecksums(t *testing.T) {
+	binary := getBinaryPath(t)
+	cacheHome := t.TempDir()
+	env := isolatedConfigEnv(t, `{}`, "XDG_CACHE_HOME="+cacheHome)
+
+	// Each tool prints metadata from a side file, so the script's hash can
+	// be declared in it
+	mockToolsDir := filepath.Join(t.TempDir(), "mock-bin")
+	metaDir := t.TempDir()
+	require.NoError(t, os.MkdirAll(mockToolsDir, 0755))
+	for _, name := range []string{"good", "tampered"} {
+		script := "#!/bin/sh\ncat '" + filepath.Join(metaDir, name+".json") + "'\n"
+		toolPath := filepath.Join(mockToolsDir, name)
+		require.NoError(t, os.WriteFile(toolPath, []byte(script), 0755))
+
+		sum := sha256.Sum256([]byte(script))
+		hash := "sha256:" + hex.EncodeToString(sum[:])
+		if name == "tampered" {
+			hash = "sha256:" + strings.Repeat("0", 64)
+		}
+		metadata := `{"atip": {"version": "0.6"}, "name": "` + name + `", "version": "1.0.0", "description": "A tool", "binary": {"hash": "` + hash + `"}, "commands": {}}`
+		require.NoError(t, os.WriteFile(filepath.Join(metaDir, name+".json"), []byte(metadata), 0644))
+	}
+
+	cmd := exec.Command(binary, "scan", "-o", "json", "--verify-checksums", "--allow-path="+mockToolsDir)
+	cmd.Env = env
+	output, err := cmd.Output()
+	require.NoError(t, err)
+
+	var result struct {
+		Tools []struct {
+			Name string `json:"name"`
+		} `json:"tools"`
+		Errors []struct {
+			Path string `json:"path"`
+			Kind string `json:"kind"`
+		} `json:"errors"`
+	}
+	require.NoError(t, json.Unmarshal(output, &result))
+	require.Len(t, result.Tools, 1)
+	assert.Equal(t, "good", result.Tools[0].Name)
+	require.Len(t, result.Errors, 1)
+	assert.Equal(t, "tampered", filepath.Base(result.Errors[0].Path))
+	assert.Equal(t, "checksum_mismatch", result.Errors[0].Kind)
+
+	// Both executables' hashes are cached for the next scan
+	data, err := os.ReadFile(filepath.Join(cacheHome, "agent-tools", "hashes.json"))
+	require.NoError(t, err)
+	var hashes map[string]struct {
+		Hash string `json:"hash"`
+	}
+	require.NoError(t, json.Unmarshal(data, &hashes))
+	assert.Contains(t, hashes, filepath.Join(mockToolsDir, "good"))
+	assert.Contains(t, hashes, filepath.Join(mockToolsDir, "tampered"))
+
+	// Without the flag, declared hashes aren't checked
+	cmd = exec.Command(binary, "scan", "-o", "json", "--allow-path="+mockToolsDir)
+	cmd.Env = env
+	output, err = cmd.Output()
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(output, &result))
+	require.Len(t, result.Tools, 1)
+	assert.Equal(t, "tampered", result.Tools[0].Name)
+}
+
+// TestScanAdaptHelp tests that scan --adapt-help discovers a tool that only
+// supports --help, with inferred, partial metadata
+func TestScanAdaptHelp(t *testing.T) {
+	binary := getBinaryPath(t)
+	env := isolatedConfigEnv(t, `{}`, "XDG_CACHE_HOME="+t.TempDir())
+
+	mockToolsDir := filepath.Join(t.TempDir(), "mock-bin")
+	require.NoError(t, os.MkdirAll(mockToolsDir, 0755))
+	script := `#!/bin/sh
+if [ "$1" = "--help" ]; then
+  echo "helponly 3.1.0 - Convert files between formats"
+  echo
+  echo "Options:"
+  echo "  -i, --input FILE    File to convert"
+  echo "  -f, --force         Overwrite existing files"
+  exit 0
+fi
+echo "helponly: unrecognized option $1" >&2
+exit 1
+`
+	require.NoError(t, os.WriteFile(filepath.Join(mockToolsDir, "helponly"), []byte(script), 0755))
+	createMockATIPTool(t, mockToolsDir, "nativetool", "1.0.0", "Native tool")
+
+	cmd := exec.Command(binary, "scan", "-o", "json", "--adapt-help", "--allow-path="+mockToolsDir)
+	cmd.Env = env
+	output, err := cmd.Output()
+	require.NoError(t, err)
+
+	var result struct {
+		Tools []struct {
+			Name    string `json:"name"`
+			Version string `json:"version"`
+			Source  string `json:"source"`
+		} `json:"tools"`
+	}
+	require.NoError(t, json.Unmarshal(output, &result))
+	require.Len(t, result.Tools, 2)
+	assert.Equal(t, "helponly", result.Tools[0].Name)
+	assert.Equal(t, "3.1.0", result.Tools[0].Version)
+	assert.Equal(t, "inferred", result.Tools[0].Source)
+	assert.Equal(t, "native", result.Tools[1].Source)
+
+	// The inferred metadata is cached and marked as such
+	cmd = exec.Command(binary, "get", "helponly")
+	cmd.Env = env
+	output, err = cmd.Output()
+	require.NoError(t, err)
+
+	var metadata struct {
+		Name    string `json:"name"`
+		Partial bool   `json:"partial"`
+		Trust   struct {
+			Source string `json:"source"`
+		} `json:"trust"`
+		GlobalOptions []struct {
+			Name  string   `json:"name"`
+			Flags []string `json:"flags"`
+			Type  string   `json:"type"`
+		} `json:"globalOptions"`
+	}
+	require.NoError(t, json.Unmarshal(output, &metadata))
+	assert.Equal(t, "helponly", metadata.Name)
+	assert.True(t, metadata.Partial)
+	assert.Equal(t, "inferred", metadata.Trust.Source)
+	require.Len(t, metadata.GlobalOptions, 2)
+	assert.Equal(t, "input", metadata.GlobalOptions[0].Name)
+	assert.Equal(t, []string{"-i", "--input"}, metadata.GlobalOptions[0].Flags)
+	assert.Equal(t, "string", metadata.GlobalOptions[0].Type)
+	assert.Equal(t, "boolean", metadata.GlobalOptions[1].Type)
+
+	// Inferred tools can be told apart from native ones
+	cmd = exec.Command(binary, "list", "-o", "json", "--source", "inferred")
+	cmd.Env = env
+	output, err = cmd.Output()
+	require.NoError(t, err)
+	assert.Contains(t, string(output), `"helponly"`)
+	assert.NotContains(t, string(output), `"nativetool"`)
+}
@@ -0,0 +1,212 @@
+package integration
+
+import (
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestSchemaCommand tests that schema prints the embedded JSON Schema
+func TestSchemaCommand(t *testing.T) {
+	binary := getBinaryPath(t)
+
+	output, err := exec.Command(binary, "schema").Output()
+	require.NoError(t, err)
+
+	var schema map[string]interface{}
+	require.NoError(t, json.Unmarshal(output, &schema))
+	assert.Equal(t, "https://atip.dev/schema/0.6.json", schema["$id"])
+
+	output, err = exec.Command(binary, "schema", "--version", "0.6").Output()
+	require.NoError(t, err)
+	assert.True(t, json.Valid(output))
+
+	cmd := exec.Command(binary, "schema", "--version", "9.9")
+	err = cmd.Run()
+	var exitErr *exec.ExitError
+	require.ErrorAs(t, err, &exitErr)
+	assert.Equal(t, 2, exitErr.ExitCode())
+}
+
+// TestSchemaValidate tests that schema validate reports metadata errors in
+// the same form as scan
+func TestSchemaValidate(t *testing.T) {
+	binary := getBinaryPath(t)
+	dir := t.TempDir()
+
+	files := map[string]string{
+		"good.json":    `{"atip": {"version": "0.6"}, "name": "mytool", "version": "1.0.0", "description": "My tool"}`,
+		"bad.json":     `{"atip": {"version": "0.6"}, "name": "mytool", "version": "1.0.0"}`,
+		"garbage.json": `not json`,
+	}
+	for name, content := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0644))
+	}
+
+	tests := []struct {
+		file     string
+		valid    bool
+		kind     string
+		contains string
+	}{
+		{file: "good.json", valid: true},
+		{file: "bad.json", valid: false, kind: "validation", contains: "description"},
+		{file: "garbage.json", valid: false, kind: "invalid_json"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			path := filepath.Join(dir, tt.file)
+			output, err := exec.Command(binary, "schema", "validate", path).Output()
+			if tt.valid {
+				require.NoError(t, err)
+			} else {
+				var exitErr *exec.ExitError
+				require.ErrorAs(t, err, &exitErr)
+				assert.Equal(t, 1, exitErr.ExitCode())
+			}
+
+			var result struct {
+				Path    string `json:"path"`
+				Version string `json:"version"`
+				Valid   bool   `json:"valid"`
+				Errors  []struct {
+					Path  string `json:"path"`
+					Kind  string `json:"kind"`
+					Error string `json:"error"`
+				} `json:"errors"`
+			}
+			require.NoError(t, json.Unmarshal(output, &result))
+			assert.Equal(t, path, result.Path)
+			assert.Equal(t, "0.6", result.Version)
+			assert.Equal(t, tt.valid, result.Valid)
+			if tt.valid {
+				assert.Empty(t, result.Errors)
+				return
+			}
+			require.Len(t, result.Errors, 1)
+			assert.Equal(t, path, result.Errors[0].Path)
+			assert.Equal(t, tt.kind, result.Errors[0].Kind)
+			assert.Contains(t, result.Errors[0].Error, tt.contains)
+		})
+	}
+
+	// A missing file is an input error
+	output, err := exec.Command(binary, "schema", "validate", "-o", "json", filepath.Join(dir, "missing.json")).Output()
+	var exitErr *exec.ExitError
+	require.ErrorAs(t, err, &exitErr)
+	assert.Equal(t, 2, exitErr.ExitCode())
+	var envelope errorEnvelope
+	require.NoError(t, json.Unmarshal(output, &envelope))
+	assert.Equal(t, "INVALID_ARGUMENT", envelope.Error.Code)
+}
+
+// TestSchemaValidateStrictVersion tests that --strict-version rejects a
+// version that isn't semver, which the default leniently accepts
+func TestSchemaValidateStrictVersion(t *testing.T) {
+	binary := getBinaryPath(t)
+	dir := t.TempDir()
+
+	tests := []struct {
+		version string
+		valid   bool
+	}{
+		{version: "1.2.3", valid: true},
+		{version: "v2.45.0", valid: true},
+		{version: "1.2.3+build", valid: true},
+		{version: "1.2", valid: false},
+		{version: "latest", valid: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.version, func(t *testing.T) {
+			path := filepath.Join(dir, tt.version+".json")
+			require.NoError(t, os.WriteFile(path, []byte(`{"atip": {"version": "0.6"}, "name": "mytool", "version": "`+tt.version+`", "description": "My tool"}`), 0644))
+
+			_, err := exec.Command(binary, "schema", "validate", path).Output()
+			require.NoError(t, err)
+
+			for _, extra := range [][]string{nil, {"--json-schema-errors"}} {
+				args := append([]string{"schema", "validate", "--strict-version"}, extra...)
+				output, err := exec.Command(binary, append(args, path)...).Output()
+				if tt.valid {
+					require.NoError(t, err)
+					continue
+				}
+				var exitErr *exec.ExitError
+				require.ErrorAs(t, err, &exitErr)
+				assert.Equal(t, 1, exitErr.ExitCode())
+				var result struct {
+					Errors []struct {
+						Kind  string `json:"kind"`
+						Error string `json:"error"`
+					} `json:"errors"`
+				}
+				require.NoError(t, json.Unmarshal(output, &result))
+				require.Len(t, result.Errors, 1)
+				assert.Equal(t, "validation", result.Errors[0].Kind)
+				assert.Contains(t, result.Errors[0].Error, "semantic version")
+			}
+		})
+	}
+}
+
+// TestSchemaValidatePolicy tests that --policy checks organization rules
+// after the schema and rejects an invalid policy file
+func TestSchemaValidatePolicy(t *testing.T) {
+	binary := getBinaryPath(t)
+	dir := t.TempDir()
+
+	metadata := filepath.Join(dir, "gh.json")
+	require.NoError(t, os.WriteFile(metadata, []byte(`{"atip": {"version": "0.6"}, "name": "gh", "version": "2.45.0", "description": "GitHub CLI",
+		"commands": {"pr": {"description": "Pull requests", "effects": {"network": true}}}}`), 0644))
+	policy := filepath.Join(dir, "policy.json")
+	require.NoError(t, os.WriteFile(policy, []byte(`{"rules": [{"rule": "require-homepage-for-network"}]}`), 0644))
+
+	_, err := exec.Command(binary, "schema", "validate", metadata).Output()
+	require.NoError(t, err)
+
+	output, err := exec.Command(binary, "schema", "validate", "--policy", policy, metadata).Output()
+	var exitErr *exec.ExitError
+	require.ErrorAs(t, err, &exitErr)
+	assert.Equal(t, 1, exitErr.ExitCode())
+	var result struct {
+		Valid  bool `json:"valid"`
+		Errors []struct {
+			Kind  string `json:"kind"`
+			Error string `json:"error"`
+		} `json:"errors"`
+	}
+	require.NoError(t, json.Unmarshal(output, &result))
+	assert.False(t, result.Valid)
+	require.Len(t, result.Errors, 1)
+	assert.Equal(t, "validation", result.Errors[0].Kind)
+	assert.Contains(t, result.Errors[0].Error, "policy violation (require-homepage-for-network) on field 'homepage'")
+
+	require.NoError(t, os.WriteFile(policy, []byte(`{"rules": [{"rule": "require-license"}]}`), 0644))
+	output, err = exec.Command(binary, "schema", "validate", "-o", "json", "--policy", policy, metadata).Output()
+	require.ErrorAs(t, err, &exitErr)
+	assert.Equal(t, 2, exitErr.ExitCode())
+	var envelope errorEnvelope
+	require.NoError(t, json.Unmarshal(output, &envelope))
+	assert.Equal(t, "INVALID_CONFIG", envelope.Error.Code)
+}
+
+// TestAgentOutputValidates tests that atip-discover's own --agent metadata
+// passes the schema it validates other tools against
+func TestAgentOutputValidates(t *testing.T) {
+	binary := getBinaryPath(t)
+
+	output, err := exec.Command(binary, "--agent").Output()
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "atip-discover.json")
+	require.NoError(t, os.WriteFile(path, output, 0644))
+
+	output, err = exec.Command(binary, "schema", "validate", path).Output()
+	assert.NoError(t, err, string(output))
+}
@@ -83,10 +83,9 @@ func TestCurrentDirectoryRejection(t *testing.T) {
 		"-o", "json")
 	output, err := cmd.CombinedOutput()
 
-	// Should reject or warn about "."
-	if err == nil {
-		assert.Contains(t, string(output), "current dir")
-	}
+	// "." is skipped with a warning, not a fatal error
+	require.NoError(t, err, string(output))
+	assert.Contains(t, string(output), "current directory not allowed")
 }
 
 // TestDisableSafePathsWarning tests Example 26 behavior
@@ -0,0 +1,237 @@
+package integration
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// serveResponse is one response line written by serve --stdio
+type serveResponse struct {
+	ID     json.RawMessage `json:"id"`
+	Result json.RawMessage `json:"result"`
+	Error  *struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// TestServeStdio tests that serve --stdio answers requests written to its
+// stdin in order, keeping the registry between them, and exits on shutdown
+func TestServeStdio(t *testing.T) {
+	binary := getBinaryPath(t)
+
+	tmpDir := t.TempDir()
+	toolsDir := filepath.Join(tmpDir, "tools")
+	require.NoError(t, os.MkdirAll(toolsDir, 0755))
+	createMockATIPTool(t, toolsDir, "gh", "2.45.0", "GitHub CLI")
+	createMockATIPTool(t, toolsDir, "kubectl", "1.29.0", "Kubernetes control")
+
+	cmd := exec.Command(binary, "serve", "--stdio")
+	cmd.Env = append(os.Environ(), "XDG_DATA_HOME="+filepath.Join(tmpDir, "data"))
+	stdin, err := cmd.StdinPipe()
+	require.NoError(t, err)
+	stdout, err := cmd.StdoutPipe()
+	require.NoError(t, err)
+	require.NoError(t, cmd.Start())
+	defer cmd.Process.Kill()
+
+	responses := bufio.NewScanner(stdout)
+	call := func(id int, method string, params interface{}) serveResponse {
+		t.Helper()
+		req := map[string]interface{}{"id": id, "method": method}
+		if params != nil {
+			req["params"] = params
+		}
+		line, err := json.Marshal(req)
+		require.NoError(t, err)
+		_, err = stdin.Write(append(line, '\n'))
+		require.NoError(t, err)
+
+		require.True(t, responses.Scan(), "no response to %s", method)
+		var resp serveResponse
+		require.NoError(t, json.Unmarshal(responses.Bytes(), &resp))
+		assert.Equal(t, fmt.Sprint(id), string(resp.ID))
+		return resp
+	}
+
+	type listResult struct {
+		Count int `json:"count"`
+		Tools []struct {
+			Name    string `json:"name"`
+			Version string `json:"version"`
+		} `json:"tools"`
+	}
+	decode := func(resp serveResponse, v interface{}) {
+		t.Helper()
+		require.Nil(t, resp.Error)
+		require.NoError(t, json.Unmarshal(resp.Result, v))
+	}
+
+	// The registry starts empty
+	var list listResult
+	decode(call(1, "list", nil), &list)
+	assert.Equal(t, 0, list.Count)
+
+	var scan struct {
+		Discovered   int      `json:"discovered"`
+		SkippedPaths []string `json:"skipped_paths"`
+	}
+	decode(call(2, "scan", map[string]interface{}{"paths": []string{toolsDir}}), &scan)
+	assert.Equal(t, 2, scan.Discovered)
+	assert.Empty(t, scan.SkippedPaths)
+
+	decode(call(3, "list", nil), &list)
+	require.Equal(t, 2, list.Count)
+	assert.Equal(t, "gh", list.Tools[0].Name)
+	assert.Equal(t, "2.45.0", list.Tools[0].Version)
+	assert.Equal(t, "kubectl", list.Tools[1].Name)
+
+	var get struct {
+		Name        string          `json:"name"`
+		ETag        string          `json:"etag"`
+		NotModified bool            `json:"not_modified"`
+		Metadata    json.RawMessage `json:"metadata"`
+	}
+	decode(call(4, "get", map[string]string{"name": "gh"}), &get)
+	assert.Equal(t, "gh", get.Name)
+	assert.NotEmpty(t, get.ETag)
+	var metadata struct {
+		Name    string `json:"name"`
+		Version string `json:"version"`
+	}
+	require.NoError(t, json.Unmarshal(get.Metadata, &metadata))
+	assert.Equal(t, "2.45.0", metadata.Version)
+
+	etag := get.ETag
+	get.Metadata = nil
+	decode(call(5, "get", map[string]string{"name": "gh", "if_none_match": etag}), &get)
+	assert.True(t, get.NotModified)
+	assert.Empty(t, get.Metadata)
+
+	decode(call(6, "search", map[string]string{"query": "kubernetes"}), &list)
+	require.Equal(t, 1, list.Count)
+	assert.Equal(t, "kubectl", list.Tools[0].Name)
+
+	// Failed requests are answered without ending the session
+	resp := call(7, "get", map[string]string{"name": "nonexistent"})
+	require.NotNil(t, resp.Error)
+	assert.Equal(t, "TOOL_NOT_FOUND", resp.Error.Code)
+
+	resp = call(8, "get", map[string]string{"tool": "gh"})
+	require.NotNil(t, resp.Error)
+	assert.Equal(t, "INVALID_PARAMS", resp.Error.Code)
+
+	resp = call(9, "refresh", nil)
+	require.NotNil(t, resp.Error)
+	assert.Equal(t, "UNKNOWN_METHOD", resp.Error.Code)
+
+	var shutdown struct {
+		Shutdown bool `json:"shutdown"`
+	}
+	decode(call(10, "shutdown", nil), &shutdown)
+	assert.True(t, shutdown.Shutdown)
+	assert.NoError(t, cmd.Wait())
+
+	// Scans are saved to the registry for later commands
+	listCmd := exec.Command(binary, "list", "-o", "json")
+	listCmd.Env = cmd.Env
+	output, err := listCmd.Output()
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(output, &list))
+	assert.Equal(t, 2, list.Count)
+}
+
+// TestServeScanSkipList tests that a scan request honours skip_list and
+// skip_file like the scan command, and reports an invalid skip file with
+// the same error code
+func TestServeScanSkipList(t *testing.T) {
+	binary := getBinaryPath(t)
+
+	tmpDir := t.TempDir()
+	toolsDir := filepath.Join(tmpDir, "tools")
+	require.NoError(t, os.MkdirAll(toolsDir, 0755))
+	for _, name := range []string{"gh", "kubectl", "legacy-a"} {
+		createMockATIPTool(t, toolsDir, name, "1.0.0", "Mock tool")
+	}
+	skipFile := filepath.Join(tmpDir, "skip.txt")
+	require.NoError(t, os.WriteFile(skipFile, []byte("legacy-*\n"), 0644))
+	badSkipFile := filepath.Join(tmpDir, "bad.txt")
+	require.NoError(t, os.WriteFile(badSkipFile, []byte("re:[oops\n"), 0644))
+
+	serve := func(config string) serveResponse {
+		t.Helper()
+		req, err := json.Marshal(map[string]interface{}{"id": 1, "method": "scan", "params": map[string]interface{}{"paths": []string{toolsDir}}})
+		require.NoError(t, err)
+		cmd := exec.Command(binary, "serve", "--stdio")
+		cmd.Env = isolatedConfigEnv(t, config)
+		cmd.Stdin = bytes.NewReader(append(req, '\n'))
+		output, err := cmd.Output()
+		require.NoError(t, err)
+
+		var resp serveResponse
+		require.NoError(t, json.Unmarshal(bytes.SplitN(output, []byte("\n"), 2)[0], &resp))
+		return resp
+	}
+
+	resp := serve(`{"discovery": {"skip_list": ["kubectl"], "skip_file": "` + skipFile + `"}}`)
+	require.Nil(t, resp.Error)
+	var scan struct {
+		Tools []struct {
+			Name string `json:"name"`
+		} `json:"tools"`
+	}
+	require.NoError(t, json.Unmarshal(resp.Result, &scan))
+	require.Len(t, scan.Tools, 1)
+	assert.Equal(t, "gh", scan.Tools[0].Name)
+
+	resp = serve(`{"discovery": {"skip_file": "` + badSkipFile + `"}}`)
+	require.NotNil(t, resp.Error)
+	assert.Equal(t, "INVALID_SKIP_LIST", resp.Error.Code)
+}
+
+// TestServeScanInvalidTimeout tests that a scan request rejects a timeout
+// that is not a positive duration
+func TestServeScanInvalidTimeout(t *testing.T) {
+	binary := getBinaryPath(t)
+	toolsDir := t.TempDir()
+	createMockATIPTool(t, toolsDir, "gh", "1.0.0", "Mock tool")
+
+	for _, timeout := range []string{"0s", "-1s", "soon"} {
+		t.Run(timeout, func(t *testing.T) {
+			req, err := json.Marshal(map[string]interface{}{"id": 1, "method": "scan", "params": map[string]interface{}{"paths": []string{toolsDir}, "timeout": timeout}})
+			require.NoError(t, err)
+			cmd := exec.Command(binary, "serve", "--stdio")
+			cmd.Env = isolatedConfigEnv(t, `{}`)
+			cmd.Stdin = bytes.NewReader(append(req, '\n'))
+			output, err := cmd.Output()
+			require.NoError(t, err)
+
+			var resp serveResponse
+			require.NoError(t, json.Unmarshal(bytes.SplitN(output, []byte("\n"), 2)[0], &resp))
+			require.NotNil(t, resp.Error)
+			assert.Equal(t, "INVALID_TIMEOUT", resp.Error.Code)
+		})
+	}
+}
+
+// TestServeRequiresStdio tests that serve without --stdio fails
+func TestServeRequiresStdio(t *testing.T) {
+	binary := getBinaryPath(t)
+
+	cmd := exec.Command(binary, "serve")
+	cmd.Env = append(os.Environ(), "XDG_DATA_HOME="+t.TempDir())
+	err := cmd.Run()
+	require.Error(t, err)
+	exitErr, ok := err.(*exec.ExitError)
+	require.True(t, ok)
+	assert.Equal(t, 2, exitErr.ExitCode())
+}
@@ -0,0 +1,1340 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/anthropics/atip/reference/atip-registry/internal/crawler"
+	"github.com/anthropics/atip/reference/atip-registry/internal/registry"
+	"github.com/anthropics/atip/reference/atip-registry/internal/server"
+	"github.com/anthropics/atip/reference/atip-registry/internal/sync"
+	"github.com/anthropics/atip/reference/atip-registry/internal/trust"
+)
+
+const version = "0.1.0"
+
+func main() {
+	if err := NewRootCmd().Execute(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// NewRootCmd creates the root command
+func NewRootCmd() *cobra.Command {
+	var dataDir string
+	var agent bool
+	var showVersion bool
+
+	cmd := &cobra.Command{
+		Use:           "atip-registry",
+		Short:         "Content-addressable registry server for ATIP shims",
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		FParseErrWhitelist: cobra.FParseErrWhitelist{
+			UnknownFlags: true,
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// Handle --agent flag
+			if agent {
+				metadata := map[string]interface{}{
+					"atip":        map[string]string{"version": "0.6"},
+					"name":        "atip-registry",
+					"version":     version,
+					"description": "Content-addressable registry server for ATIP shims",
+					"commands": map[string]interface{}{
+						"serve": map[string]interface{}{
+							"description": "Start the registry HTTP server",
+						},
+						"add": map[string]interface{}{
+							"description": "Add a shim to the registry",
+						},
+						"list": map[string]interface{}{
+							"description": "List shims in the local registry",
+						},
+						"crawl": map[string]interface{}{
+							"description": "Run the community crawler to generate shims",
+						},
+						"sync": map[string]interface{}{
+							"description": "Sync shims from a remote registry",
+						},
+						"export": map[string]interface{}{
+							"description": "Export the registry to a gzip tarball",
+						},
+						"import": map[string]interface{}{
+							"description": "Import shims from a gzip tarball",
+						},
+						"gc": map[string]interface{}{
+							"description": "Find and remove orphaned signatures and temporary files",
+						},
+						"stats": map[string]interface{}{
+							"description": "Report disk usage and shim health",
+						},
+						"provenance": map[string]interface{}{
+							"description": "Show the build provenance (SLSA attestation) a shim declares",
+						},
+					},
+				}
+				printJSON(cmd, metadata)
+				return nil
+			}
+
+			// Handle --version flag
+			if showVersion {
+				fmt.Fprintf(cmd.OutOrStdout(), "atip-registry version %s\n", version)
+				return nil
+			}
+
+			return cmd.Help()
+		},
+	}
+
+	// Global flags
+	cmd.PersistentFlags().String("config", "./config.yaml", "Path to config file")
+	cmd.PersistentFlags().StringVar(&dataDir, "data-dir", "./data", "Path to data directory")
+	cmd.PersistentFlags().BoolP("verbose", "v", false, "Enable verbose logging")
+	cmd.PersistentFlags().BoolVar(&agent, "agent", false, "Output ATIP metadata for this tool")
+	cmd.PersistentFlags().Bool("compact", false, "Write JSON output on a single line, without indentation")
+	cmd.Flags().BoolVar(&showVersion, "version", false, "Show version information")
+
+	// Add subcommands
+	cmd.AddCommand(newServeCmd())
+	cmd.AddCommand(newAddCmd())
+	cmd.AddCommand(newListCmd())
+	cmd.AddCommand(newCrawlCmd())
+	cmd.AddCommand(newSyncCmd())
+	cmd.AddCommand(newSignCmd())
+	cmd.AddCommand(newVerifyCmd())
+	cmd.AddCommand(newCatalogCmd())
+	cmd.AddCommand(newInitCmd())
+	cmd.AddCommand(newExportCmd())
+	cmd.AddCommand(newImportCmd())
+	cmd.AddCommand(newGCCmd())
+	cmd.AddCommand(newStatsCmd())
+	cmd.AddCommand(newProvenanceCmd())
+
+	return cmd
+}
+
+// printJSON writes v to the command's output as indented JSON, or as
+// minified JSON on a single line with --compact.
+func printJSON(cmd *cobra.Command, v interface{}) {
+	var data []byte
+	if compact, _ := cmd.Flags().GetBool("compact"); compact {
+		data, _ = json.Marshal(v)
+	} else {
+		data, _ = json.MarshalIndent(v, "", "  ")
+	}
+	fmt.Fprintln(cmd.OutOrStdout(), string(data))
+}
+
+// newServer creates the server serve runs; tests replace it.
+var newServer = server.NewServer
+
+// listenAndServe serves handler on addr, over TLS if tlsCert is set, until
+// ctx is done and then shuts down gracefully; tests replace it.
+var listenAndServe = func(ctx context.Context, addr string, handler http.Handler, tlsCert, tlsKey string) error {
+	srv := &http.Server{Addr: addr, Handler: handler, ReadHeaderTimeout: 10 * time.Second}
+
+	errc := make(chan error, 1)
+	go func() {
+		if tlsCert != "" {
+			errc <- srv.ListenAndServeTLS(tlsCert, tlsKey)
+		} else {
+			errc <- srv.ListenAndServe()
+		}
+	}()
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	return srv.Shutdown(shutdownCtx)
+}
+
+func newServeCmd() *cobra.Command {
+	var addr, corsOrigin string
+	var tlsCert, tlsKey, uploadTokenFile string
+	var shimCacheSize, maxUploadSize int64
+	var catalogTTL time.Duration
+	var watch, reproducibleCatalog, verifyOnRead bool
+
+	cmd := &cobra.Command{
+		Use:   "serve",
+		Short: "Start the registry HTTP server",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if (tlsCert == "") != (tlsKey == "") {
+				return fmt.Errorf("--tls-cert and --tls-key must be given together")
+			}
+			if maxUploadSize <= 0 {
+				return fmt.Errorf("--max-upload-size must be positive")
+			}
+
+			// Uploads stay disabled without a token
+			var uploadToken string
+			if uploadTokenFile != "" {
+				data, err := os.ReadFile(uploadTokenFile)
+				if err != nil {
+					return fmt.Errorf("failed to read upload token: %w", err)
+				}
+				uploadToken = strings.TrimSpace(string(data))
+				if uploadToken == "" {
+					return fmt.Errorf("upload token file %s is empty", uploadTokenFile)
+				}
+			}
+
+			dataDir, _ := cmd.Flags().GetString("data-dir")
+			srv := newServer(&server.Config{
+				DataDir:             dataDir,
+				CORSOrigin:          corsOrigin,
+				ShimCacheSize:       shimCacheSize,
+				CatalogTTL:          catalogTTL,
+				VerifyOnRead:        verifyOnRead,
+				ReproducibleCatalog: reproducibleCatalog,
+				UploadToken:         uploadToken,
+				MaxUploadSize:       maxUploadSize,
+			})
+
+			ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+
+			if watch {
+				if err := srv.Watch(ctx); err != nil {
+					return err
+				}
+			}
+
+			fmt.Fprintf(cmd.ErrOrStderr(), "Serving %s on %s\n", dataDir, addr)
+			return listenAndServe(ctx, addr, srv, tlsCert, tlsKey)
+		},
+	}
+
+	cmd.Flags().StringVar(&addr, "addr", ":8080", "Listen address")
+	cmd.Flags().StringVar(&corsOrigin, "cors-origin", server.DefaultCORSOrigin, "CORS allowed origin (empty disables)")
+	cmd.Flags().StringVar(&tlsCert, "tls-cert", "", "TLS certificate file")
+	cmd.Flags().StringVar(&tlsKey, "tls-key", "", "TLS key file")
+	cmd.Flags().Int64Var(&shimCacheSize, "shim-cache-size", server.DefaultShimCacheSize, "Shim and bundle bytes cached in memory (negative disables)")
+	cmd.Flags().DurationVar(&catalogTTL, "catalog-ttl", server.DefaultCatalogTTL, "How long the built catalog is cached in memory (negative disables)")
+	cmd.Flags().BoolVar(&watch, "watch", false, "Reload the catalog when shims change on disk")
+	cmd.Flags().BoolVar(&verifyOnRead, "verify-on-read", false, "Check each shim against its hash before serving it")
+	cmd.Flags().BoolVar(&reproducibleCatalog, "reproducible-catalog", false, "Serve the catalog without an updated time, so its bytes and ETag depend only on the shims")
+	cmd.Flags().StringVar(&uploadTokenFile, "upload-token-file", "", "Enable uploads by PUT, authenticated by the bearer token in this file")
+	cmd.Flags().Int64Var(&maxUploadSize, "max-upload-size", server.DefaultMaxUploadSize, "Largest accepted upload in bytes")
+
+	return cmd
+}
+
+func newAddCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "add [shim-file]",
+		Short: "Add a shim to the registry",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dataDir, _ := cmd.Flags().GetString("data-dir")
+			reg, err := registry.Load(dataDir)
+			if err != nil {
+				return err
+			}
+
+			shimPath := args[0]
+			return reg.AddShim(shimPath)
+		},
+	}
+
+	return cmd
+}
+
+// listEntry is one row of list output.
+type listEntry struct {
+	Name     string `json:"name"`
+	Version  string `json:"version"`
+	Platform string `json:"platform"`
+	Hash     string `json:"hash"`
+	Signed   bool   `json:"signed"`
+}
+
+func newListCmd() *cobra.Command {
+	var name, platform, output string
+	var signedOnly bool
+
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List shims in the local registry",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if output != "text" && output != "json" {
+				return fmt.Errorf("invalid output format %q: must be text or json", output)
+			}
+
+			dataDir, _ := cmd.Flags().GetString("data-dir")
+			reg, err := registry.Load(dataDir)
+			if err != nil {
+				return err
+			}
+
+			shims, err := reg.ListShims()
+			if err != nil {
+				return err
+			}
+
+			entries := []listEntry{}
+			for _, shim := range shims {
+				if name != "" && shim.Name != name {
+					continue
+				}
+				if platform != "" && shim.Binary.Platform != platform {
+					continue
+				}
+				signed := reg.HasSignature(shim.Binary.Hash)
+				if signedOnly && !signed {
+					continue
+				}
+				entries = append(entries, listEntry{
+					Name:     shim.Name,
+					Version:  shim.Version,
+					Platform: shim.Binary.Platform,
+					Hash:     shim.Binary.Hash,
+					Signed:   signed,
+				})
+			}
+			sort.Slice(entries, func(i, j int) bool {
+				a, b := entries[i], entries[j]
+				if a.Name != b.Name {
+					return a.Name < b.Name
+				}
+				if a.Version != b.Version {
+					return a.Version < b.Version
+				}
+				return a.Platform < b.Platform
+			})
+
+			if output == "json" {
+				printJSON(cmd, entries)
+				return nil
+			}
+
+			tw := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+			fmt.Fprintln(tw, "NAME\tVERSION\tPLATFORM\tSIGNED\tHASH")
+			for _, e := range entries {
+				signed := "no"
+				if e.Signed {
+					signed = "yes"
+				}
+				fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", e.Name, e.Version, e.Platform, signed, e.Hash)
+			}
+			return tw.Flush()
+		},
+	}
+
+	cmd.Flags().StringVar(&name, "name", "", "Only list shims for this tool")
+	cmd.Flags().StringVar(&platform, "platform", "", "Only list shims for this platform")
+	cmd.Flags().BoolVar(&signedOnly, "signed-only", false, "Only list shims with a signature bundle")
+	cmd.Flags().StringVarP(&output, "output", "o", "text", "Output format (text, json)")
+
+	return cmd
+}
+
+// shimCrawler runs crawls; *crawler.Crawler is the real one.
+type shimCrawler interface {
+	Crawl(ctx context.Context, tools []string) (*crawler.CrawlResult, error)
+}
+
+// newCrawler creates the crawler crawl runs; tests replace it.
+var newCrawler = func(config *crawler.Config) shimCrawler {
+	return crawler.NewCrawler(config)
+}
+
+func newCrawlCmd() *cobra.Command {
+	var manifestsDir, outputDir string
+	var checkOnly bool
+	var platform []string
+	var parallel int
+
+	cmd := &cobra.Command{
+		Use:   "crawl [tools...]",
+		Short: "Run the community crawler to generate shims",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if parallel < 1 {
+				return fmt.Errorf("--parallel must be at least 1")
+			}
+
+			tools := args
+			if len(tools) == 0 {
+				var err error
+				if tools, err = crawler.ListTools(manifestsDir); err != nil {
+					return fmt.Errorf("failed to list manifests: %w", err)
+				}
+			}
+
+			c := newCrawler(&crawler.Config{
+				ManifestsDir: manifestsDir,
+				OutputDir:    outputDir,
+				Parallelism:  parallel,
+				CheckOnly:    checkOnly,
+				GitHubToken:  os.Getenv("GITHUB_TOKEN"),
+				Platforms:    platform,
+			})
+			if !checkOnly {
+				if err := os.MkdirAll(outputDir, 0755); err != nil {
+					return fmt.Errorf("failed to create output directory: %w", err)
+				}
+			}
+
+			result, err := c.Crawl(cmd.Context(), tools)
+			if err != nil {
+				return err
+			}
+
+			printJSON(cmd, result)
+			if failed := len(tools) - result.Crawled; failed > 0 {
+				return fmt.Errorf("failed to crawl %d of %d tools", failed, len(tools))
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&manifestsDir, "manifests-dir", "./manifests", "Directory containing tool manifests")
+	cmd.Flags().StringVarP(&outputDir, "output-dir", "o", "./output", "Directory for generated shims")
+	cmd.Flags().BoolVar(&checkOnly, "check-only", false, "Check for updates without downloading")
+	cmd.Flags().StringSliceVarP(&platform, "platform", "p", nil, "Platforms to crawl")
+	cmd.Flags().IntVar(&parallel, "parallel", 2, "Release lookups and downloads in flight at once")
+
+	return cmd
+}
+
+// newSyncer creates the syncer sync runs; tests replace it.
+var newSyncer = sync.NewSyncer
+
+// syncOutput is the JSON summary of a sync.
+type syncOutput struct {
+	Synced    int                 `json:"synced"`
+	Unchanged int                 `json:"unchanged"`
+	Failed    int                 `json:"failed"`
+	Sources   []sync.SourceResult `json:"sources"`
+	Conflicts []sync.Conflict     `json:"conflicts"`
+	Errors    []string            `json:"errors"`
+}
+
+func newSyncCmd() *cobra.Command {
+	var dryRun bool
+	var tools []string
+	var verifySignatures, forceRefresh bool
+	var retries int
+	var parallel int
+	var timeout, connectTimeout time.Duration
+	var http2 bool
+
+	cmd := &cobra.Command{
+		Use:   "sync [registry-url...]",
+		Short: "Sync shims from remote registries, in precedence order",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if retries < 0 {
+				return fmt.Errorf("--retries must not be negative")
+			}
+			if parallel < 1 {
+				return fmt.Errorf("--parallel must be at least 1")
+			}
+			if timeout <= 0 || connectTimeout <= 0 {
+				return fmt.Errorf("--timeout and --connect-timeout must be positive")
+			}
+
+			dataDir, _ := cmd.Flags().GetString("data-dir")
+			syncer := newSyncer(&sync.Config{
+				LocalDataDir:     dataDir,
+				VerifySignatures: verifySignatures,
+				ForceRefresh:     forceRefresh,
+				DryRun:           dryRun,
+				Tools:            tools,
+				MaxAttempts:      retries + 1,
+				Parallelism:      parallel,
+				Timeout:          timeout,
+				ConnectTimeout:   connectTimeout,
+				DisableHTTP2:     !http2,
+			})
+
+			result, err := syncer.SyncAll(cmd.Context(), args)
+			if err != nil {
+				return err
+			}
+
+			out := syncOutput{
+				Synced:    result.Synced,
+				Unchanged: result.Unchanged,
+				Failed:    result.Failed,
+				Sources:   result.Sources,
+				Conflicts: result.Conflicts,
+				Errors:    []string{},
+			}
+			for _, err := range result.Errors {
+				out.Errors = append(out.Errors, err.Error())
+			}
+			printJSON(cmd, out)
+			if result.Failed > 0 {
+				return fmt.Errorf("failed to sync %d shims", result.Failed)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Show what would be synced")
+	cmd.Flags().StringSliceVar(&tools, "tools", nil, "Specific tools to sync")
+	cmd.Flags().BoolVar(&verifySignatures, "verify-signatures", false, "Verify signatures")
+	cmd.Flags().BoolVar(&forceRefresh, "force-refresh", false, "Ignore cached ETags")
+	cmd.Flags().IntVar(&retries, "retries", sync.DefaultMaxAttempts-1, "Retries per request on network errors, 5xx and 429")
+	cmd.Flags().IntVar(&parallel, "parallel", sync.DefaultParallelism, "Shim downloads in flight at once")
+	cmd.Flags().DurationVar(&timeout, "timeout", sync.DefaultTimeout, "Overall limit per request")
+	cmd.Flags().DurationVar(&connectTimeout, "connect-timeout", sync.DefaultConnectTimeout, "Limit on connecting to a registry")
+	cmd.Flags().BoolVar(&http2, "http2", true, "Use HTTP/2 with registries that offer it")
+
+	return cmd
+}
+
+// minisignPasswordEnv holds the password of an encrypted minisign private key.
+const minisignPasswordEnv = "ATIP_MINISIGN_PASSWORD"
+
+// newSignatureBackend creates the backend sign uses; tests replace it.
+var newSignatureBackend = trust.NewBackend
+
+func newSignCmd() *cobra.Command {
+	var identity, issuer, keyPath, backend string
+	var all, force bool
+
+	cmd := &cobra.Command{
+		Use:   "sign [hash-or-file]",
+		Short: "Sign a shim with Cosign or minisign",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if all {
+				if len(args) > 0 {
+					return fmt.Errorf("--all takes no arguments")
+				}
+				return nil
+			}
+			if force {
+				return fmt.Errorf("--force requires --all")
+			}
+			return cobra.MinimumNArgs(1)(cmd, args)
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dataDir, _ := cmd.Flags().GetString("data-dir")
+			signer, err := newSignatureBackend(backend, &trust.Config{
+				Identity: identity,
+				Issuer:   issuer,
+				KeyPath:  keyPath,
+				Password: os.Getenv(minisignPasswordEnv),
+			})
+			if err != nil {
+				return err
+			}
+
+			if all {
+				return signAll(cmd, dataDir, signer, force)
+			}
+
+			for _, arg := range args {
+				shim, err := resolveShim(dataDir, arg)
+				if err != nil {
+					return err
+				}
+				if err := shim.sign(signer); err != nil {
+					return fmt.Errorf("failed to sign %s: %w", arg, err)
+				}
+				fmt.Fprintf(cmd.OutOrStdout(), "signed %s -> %s\n", shim.stored, signer.SignaturePath(shim.json))
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&identity, "identity", "", "OIDC identity for keyless signing")
+	cmd.Flags().StringVar(&issuer, "issuer", "", "OIDC issuer URL")
+	cmd.Flags().StringVarP(&keyPath, "key", "k", "", "Path to private key")
+	cmd.Flags().StringVar(&backend, "backend", trust.BackendCosign, "Signature backend (cosign, minisign)")
+	cmd.Flags().BoolVar(&all, "all", false, "Sign every shim in the registry that has no signature")
+	cmd.Flags().BoolVar(&force, "force", false, "With --all, re-sign shims that are already signed")
+
+	return cmd
+}
+
+// signAll signs every shim in the registry at dataDir that has no signature
+// for signer's backend, or every shim if force is set. Shims are taken from
+// the stored filenames, and one that doesn't describe the binary it is filed
+// under is not signed. A failure doesn't stop the batch; it is reported and
+// counted, and makes the command fail at the end.
+func signAll(cmd *cobra.Command, dataDir string, signer trust.SignatureBackend, force bool) error {
+	reg, err := registry.Load(dataDir)
+	if err != nil {
+		return err
+	}
+	hashes, err := reg.ShimHashes()
+	if err != nil {
+		return err
+	}
+
+	var signed, skipped, failed int
+	for _, hash := range hashes {
+		shim, err := resolveShim(dataDir, hash)
+		if err == nil {
+			_, err = reg.GetShimVerified(hash)
+		}
+		if err != nil {
+			failed++
+			fmt.Fprintf(cmd.ErrOrStderr(), "failed to sign %s: %v\n", hash, err)
+			continue
+		}
+		if _, err := os.Stat(signer.SignaturePath(shim.json)); err == nil && !force {
+			skipped++
+			continue
+		}
+		if err := shim.sign(signer); err != nil {
+			failed++
+			fmt.Fprintf(cmd.ErrOrStderr(), "failed to sign %s: %v\n", shim.stored, err)
+			continue
+		}
+		signed++
+		fmt.Fprintf(cmd.OutOrStdout(), "signed %s -> %s\n", shim.stored, signer.SignaturePath(shim.json))
+	}
+
+	fmt.Fprintf(cmd.OutOrStdout(), "%d signed, %d skipped, %d failed\n", signed, skipped, failed)
+	if failed > 0 {
+		return fmt.Errorf("failed to sign %d of %d shims", failed, len(hashes))
+	}
+	return nil
+}
+
+func newVerifyCmd() *cobra.Command {
+	var identity, issuer, keyPath, backend string
+
+	cmd := &cobra.Command{
+		Use:   "verify [hash-or-file]",
+		Short: "Verify a shim signature",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dataDir, _ := cmd.Flags().GetString("data-dir")
+			if keyPath != "" && backend != trust.BackendCosign {
+				return fmt.Errorf("--key requires the %s backend; %s keys are trusted through the registry manifest", trust.BackendCosign, backend)
+			}
+			verifier, err := trust.NewBackend(backend, &trust.Config{KeyPath: keyPath})
+			if err != nil {
+				return err
+			}
+
+			// Unless a key is pinned, only the registry's configured signers
+			// are trusted, narrowed to the expected identity when one is given
+			signers, err := trustedSigners(dataDir)
+			if err != nil {
+				return err
+			}
+			signers = filterSigners(signers, identity, issuer)
+
+			for _, arg := range args {
+				shim, err := resolveShim(dataDir, arg)
+				if err != nil {
+					return err
+				}
+				if err := shim.verify(verifier, signers); err != nil {
+					return fmt.Errorf("failed to verify %s: %w", arg, err)
+				}
+				fmt.Fprintf(cmd.OutOrStdout(), "verified %s\n", shim.stored)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&identity, "identity", "", "Expected signer identity")
+	cmd.Flags().StringVar(&issuer, "issuer", "", "Expected OIDC issuer")
+	cmd.Flags().StringVarP(&keyPath, "key", "k", "", "Cosign public key for offline verification")
+	cmd.Flags().StringVar(&backend, "backend", trust.BackendCosign, "Signature backend (cosign, minisign)")
+	cmd.MarkFlagsMutuallyExclusive("key", "identity")
+	cmd.MarkFlagsMutuallyExclusive("key", "issuer")
+
+	return cmd
+}
+
+// shimFile is a shim to sign or verify.
+//
+// Signatures cover the shim's JSON, as served for {hash}.json and written by
+// export, so a shim stored gzip-compressed as {hash}.json.gz is signed and
+// verified decompressed, and its signature keeps the {hash}.json.bundle or
+// {hash}.json.minisig name. A signature stays valid when the registry's
+// compression changes.
+type shimFile struct {
+	stored string // The file as stored
+	json   string // The uncompressed path, from which the signature is named
+}
+
+// resolveShim returns arg if it is a file, otherwise the shim whose hash is
+// arg in the registry at dataDir, stored compressed or not.
+func resolveShim(dataDir, arg string) (shimFile, error) {
+	if info, err := os.Stat(arg); err == nil && info.Mode().IsRegular() {
+		return shimFile{stored: arg, json: strings.TrimSuffix(arg, ".gz")}, nil
+	}
+
+	hash := strings.TrimPrefix(arg, registry.HashPrefix)
+	if err := registry.ValidateHash(hash, hash+registry.ShimExtension); err != nil {
+		return shimFile{}, fmt.Errorf("%s is neither a shim file nor a hash: %w", arg, err)
+	}
+	shim := shimFile{json: filepath.Join(dataDir, registry.ShimPath(hash))}
+	for _, path := range []string{shim.json, shim.json + ".gz"} {
+		if _, err := os.Stat(path); err == nil {
+			shim.stored = path
+			return shim, nil
+		}
+	}
+	return shimFile{}, fmt.Errorf("%w: %s", registry.ErrNotFound, arg)
+}
+
+// compressed reports whether the shim is stored gzip-compressed.
+func (f shimFile) compressed() bool {
+	return f.stored != f.json
+}
+
+// sign signs the shim with signer, writing the signature next to it.
+func (f shimFile) sign(signer trust.SignatureBackend) error {
+	if !f.compressed() {
+		return signer.Sign(f.json)
+	}
+	return f.withDecompressed(signer, func(path string) error {
+		if err := signer.Sign(path); err != nil {
+			return err
+		}
+		signature, err := os.ReadFile(signer.SignaturePath(path))
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(signer.SignaturePath(f.json), signature, 0644)
+	})
+}
+
+// verify checks the shim's signature with verifier against signers.
+func (f shimFile) verify(verifier trust.SignatureBackend, signers []trust.Signer) error {
+	if !f.compressed() {
+		return verifier.Verify(f.json, signers)
+	}
+	return f.withDecompressed(verifier, func(path string) error {
+		return verifier.Verify(path, signers)
+	})
+}
+
+// withDecompressed calls fn with the path of a temporary copy of the
+// compressed shim's JSON, named like the shim, next to a copy of its
+// signature for backend, if any. Backends only work on files.
+func (f shimFile) withDecompressed(backend trust.SignatureBackend, fn func(path string) error) error {
+	data, err := os.ReadFile(f.stored)
+	if err != nil {
+		return err
+	}
+	if data, err = registry.DecompressShim(data); err != nil {
+		return err
+	}
+
+	dir, err := os.MkdirTemp("", "atip-shim-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, filepath.Base(f.json))
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return err
+	}
+	if signature, err := os.ReadFile(backend.SignaturePath(f.json)); err == nil {
+		if err := os.WriteFile(backend.SignaturePath(path), signature, 0644); err != nil {
+			return err
+		}
+	}
+	return fn(path)
+}
+
+// trustedSigners reads the signers configured in the registry manifest.
+// A registry without a manifest trusts no one.
+func trustedSigners(dataDir string) ([]trust.Signer, error) {
+	data, err := os.ReadFile(filepath.Join(dataDir, registry.ManifestPath))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var manifest sync.RegistryManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("invalid registry manifest: %w", err)
+	}
+
+	signers := make([]trust.Signer, 0, len(manifest.Trust.Signers))
+	for _, s := range manifest.Trust.Signers {
+		signers = append(signers, trust.Signer{Identity: s.Identity, Issuer: s.Issuer, PublicKey: s.PublicKey})
+	}
+	return signers, nil
+}
+
+// filterSigners keeps the signers matching identity and issuer; empty
+// values match any signer.
+func filterSigners(signers []trust.Signer, identity, issuer string) []trust.Signer {
+	var matched []trust.Signer
+	for _, s := range signers {
+		if (identity == "" || s.Identity == identity) && (issuer == "" || s.Issuer == issuer) {
+			matched = append(matched, s)
+		}
+	}
+	return matched
+}
+
+func newCatalogCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "catalog",
+		Short: "Manage the catalog index",
+	}
+
+	cmd.AddCommand(newCatalogBuildCmd())
+	cmd.AddCommand(newCatalogStatsCmd())
+	cmd.AddCommand(newCatalogVerifyCmd())
+	cmd.AddCommand(newCatalogPruneCmd())
+
+	return cmd
+}
+
+func newCatalogBuildCmd() *cobra.Command {
+	var reproducible bool
+
+	cmd := &cobra.Command{
+		Use:   "build",
+		Short: "Rebuild the catalog index",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dataDir, _ := cmd.Flags().GetString("data-dir")
+			reg, err := registry.Load(dataDir)
+			if err != nil {
+				return err
+			}
+			reg.SetReproducibleCatalog(reproducible)
+
+			_, err = reg.SaveCatalog()
+			return err
+		},
+	}
+
+	cmd.Flags().BoolVar(&reproducible, "reproducible", false, "Leave out the updated time, so the index bytes depend only on the shims")
+
+	return cmd
+}
+
+func newCatalogStatsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "stats",
+		Short: "Show catalog statistics",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dataDir, _ := cmd.Flags().GetString("data-dir")
+			reg, err := registry.Load(dataDir)
+			if err != nil {
+				return err
+			}
+
+			catalog, err := reg.BuildCatalog()
+			if err != nil {
+				return err
+			}
+
+			stats := map[string]interface{}{
+				"total_tools": len(catalog.Tools),
+				"total_shims": catalog.TotalShims,
+			}
+
+			printJSON(cmd, stats)
+			return nil
+		},
+	}
+
+	return cmd
+}
+
+func newCatalogVerifyCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "verify",
+		Short: "Check the catalog index against the shims",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dataDir, _ := cmd.Flags().GetString("data-dir")
+			reg, err := registry.Load(dataDir)
+			if err != nil {
+				return err
+			}
+
+			discrepancies, err := reg.VerifyCatalog()
+			if err != nil {
+				return err
+			}
+
+			report := map[string]interface{}{
+				"path":          filepath.Join(dataDir, filepath.FromSlash(registry.CatalogPath)),
+				"ok":            len(discrepancies) == 0,
+				"discrepancies": discrepancies,
+			}
+			printJSON(cmd, report)
+
+			if len(discrepancies) > 0 {
+				return fmt.Errorf("catalog index has %d discrepancies", len(discrepancies))
+			}
+			return nil
+		},
+	}
+
+	return cmd
+}
+
+func newCatalogPruneCmd() *cobra.Command {
+	var write bool
+
+	cmd := &cobra.Command{
+		Use:   "prune",
+		Short: "Drop catalog entries whose shims no longer exist",
+		Long: `Drop catalog entries whose shims no longer exist.
+
+--write rebuilds the whole index from the shims on disk, so besides
+dropping the removed entries it adds shims missing from the index and
+corrects mismatched hashes. Those are listed under "repaired".`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dataDir, _ := cmd.Flags().GetString("data-dir")
+			reg, err := registry.Load(dataDir)
+			if err != nil {
+				return err
+			}
+
+			result, err := reg.PruneCatalog(write)
+			if err != nil {
+				return err
+			}
+
+			printJSON(cmd, result)
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&write, "write", false, "Rebuild the catalog index from the shims (default is a dry run)")
+
+	return cmd
+}
+
+func newInitCmd() *cobra.Command {
+	var name, baseURL, output, compression string
+	var requireSignatures, force bool
+
+	cmd := &cobra.Command{
+		Use:   "init [directory]",
+		Short: "Initialize a new registry",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dir := "."
+			if len(args) > 0 {
+				dir = args[0]
+			}
+
+			if output != "text" && output != "json" {
+				return fmt.Errorf("invalid output format %q: must be text or json", output)
+			}
+			if baseURL != "" {
+				if err := validateBaseURL(baseURL); err != nil {
+					return err
+				}
+			}
+			if !contains(registry.Compressions, compression) {
+				return fmt.Errorf("invalid --compression %q: must be one of %s", compression, strings.Join(registry.Compressions, ", "))
+			}
+
+			manifestPath := filepath.Join(dir, ".well-known", "atip-registry.json")
+			configPath := filepath.Join(dir, "config.yaml")
+
+			// Refuse to clobber an existing registry unless forced
+			var existing []string
+			for _, path := range []string{manifestPath, configPath} {
+				if _, err := os.Stat(path); err == nil {
+					existing = append(existing, path)
+				}
+			}
+			if len(existing) > 0 && !force {
+				return fmt.Errorf("registry already initialized (%s exists); use --force to overwrite", strings.Join(existing, ", "))
+			}
+
+			result := initResult{
+				Initialized: true,
+				Path:        dir,
+				Manifest:    manifestPath,
+				Config:      configPath,
+				Created:     []string{},
+				Skipped:     []string{},
+				Overwritten: existing,
+			}
+			if result.Overwritten == nil {
+				result.Overwritten = []string{}
+			}
+
+			// Create directory structure
+			dirs := []string{
+				filepath.Join(dir, ".well-known"),
+				filepath.Join(dir, "shims", "sha256"),
+				filepath.Join(dir, "manifests"),
+			}
+
+			for _, d := range dirs {
+				if info, err := os.Stat(d); err == nil && info.IsDir() {
+					result.Skipped = append(result.Skipped, d)
+					continue
+				}
+				if err := os.MkdirAll(d, 0755); err != nil {
+					return err
+				}
+				result.Created = append(result.Created, d)
+			}
+
+			// Create manifest
+			manifest := map[string]interface{}{
+				"atip": map[string]string{"version": "0.6"},
+				"registry": map[string]string{
+					"name":    name,
+					"url":     baseURL,
+					"type":    "static",
+					"version": "2026.01.15",
+				},
+				"endpoints": map[string]string{
+					"shims":      "/shims/sha256/{hash}.json",
+					"signatures": "/shims/sha256/{hash}.json.bundle",
+					"catalog":    "/shims/index.json",
+				},
+				"trust": map[string]interface{}{
+					"requireSignatures": requireSignatures,
+					"signers":           []string{},
+				},
+				"storage": registry.ManifestStorage{Compression: compression},
+			}
+
+			manifestData, _ := json.MarshalIndent(manifest, "", "  ")
+			if err := os.WriteFile(manifestPath, manifestData, 0644); err != nil {
+				return err
+			}
+
+			// Create config.yaml
+			configData := fmt.Sprintf(`registry:
+  name: %s
+  url: %s
+  version: "2026.01.15"
+
+server:
+  addr: ":8080"
+
+storage:
+  type: filesystem
+  path: %s
+`, name, baseURL, dir)
+
+			if err := os.WriteFile(configPath, []byte(configData), 0644); err != nil {
+				return err
+			}
+
+			for _, path := range []string{manifestPath, configPath} {
+				if !contains(existing, path) {
+					result.Created = append(result.Created, path)
+				}
+			}
+
+			if output == "json" {
+				printJSON(cmd, result)
+				return nil
+			}
+			for _, path := range result.Created {
+				fmt.Fprintf(cmd.OutOrStdout(), "created     %s\n", path)
+			}
+			for _, path := range result.Overwritten {
+				fmt.Fprintf(cmd.OutOrStdout(), "overwritten %s\n", path)
+			}
+			for _, path := range result.Skipped {
+				fmt.Fprintf(cmd.OutOrStdout(), "skipped     %s\n", path)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&name, "name", "My ATIP Registry", "Registry name")
+	cmd.Flags().StringVar(&baseURL, "url", "", "Registry base URL")
+	cmd.Flags().BoolVar(&requireSignatures, "require-signatures", false, "Require shim signatures")
+	cmd.Flags().BoolVar(&force, "force", false, "Overwrite an existing manifest and config")
+	cmd.Flags().StringVar(&compression, "compression", registry.CompressionNone, "How shims are stored (none, gzip)")
+	cmd.Flags().StringVarP(&output, "output", "o", "text", "Output format (text, json)")
+
+	return cmd
+}
+
+func newExportCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "export <out.tar.gz>",
+		Short: "Export the manifest, shims and signatures to a tarball",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dataDir, _ := cmd.Flags().GetString("data-dir")
+			reg, err := registry.Load(dataDir)
+			if err != nil {
+				return err
+			}
+
+			// Write to a temporary file so a failed export leaves no partial archive
+			outPath := args[0]
+			tmp, err := os.CreateTemp(filepath.Dir(outPath), ".atip-export-*")
+			if err != nil {
+				return fmt.Errorf("failed to create archive: %w", err)
+			}
+			defer os.Remove(tmp.Name())
+
+			result, err := reg.Export(tmp)
+			if closeErr := tmp.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				return err
+			}
+			if err := os.Rename(tmp.Name(), outPath); err != nil {
+				return fmt.Errorf("failed to write archive: %w", err)
+			}
+
+			printJSON(cmd, result)
+			return nil
+		},
+	}
+
+	return cmd
+}
+
+func newImportCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "import <in.tar.gz>",
+		Short: "Import shims and signatures from a tarball",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dataDir, _ := cmd.Flags().GetString("data-dir")
+			if err := os.MkdirAll(dataDir, 0755); err != nil {
+				return fmt.Errorf("failed to create data directory: %w", err)
+			}
+			reg, err := registry.Load(dataDir)
+			if err != nil {
+				return err
+			}
+
+			f, err := os.Open(args[0])
+			if err != nil {
+				return fmt.Errorf("failed to open archive: %w", err)
+			}
+			defer f.Close()
+
+			result, err := reg.Import(f)
+			if err != nil {
+				return err
+			}
+
+			printJSON(cmd, result)
+			return nil
+		},
+	}
+
+	return cmd
+}
+
+func newGCCmd() *cobra.Command {
+	var opts registry.GCOptions
+
+	cmd := &cobra.Command{
+		Use:   "gc",
+		Short: "Find and remove orphaned signatures and temporary files",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dataDir, _ := cmd.Flags().GetString("data-dir")
+			reg, err := registry.Load(dataDir)
+			if err != nil {
+				return err
+			}
+
+			result, err := reg.GC(opts)
+			if err != nil {
+				return err
+			}
+
+			printJSON(cmd, result)
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&opts.Delete, "delete", false, "Remove the garbage (default is a dry run)")
+	cmd.Flags().BoolVar(&opts.InvalidShims, "invalid-shims", false, "Also collect shims that aren't valid JSON")
+
+	return cmd
+}
+
+func newProvenanceCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "provenance <hash>",
+		Short: "Show the build provenance (SLSA attestation) a shim declares",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dataDir, _ := cmd.Flags().GetString("data-dir")
+			reg, err := registry.Load(dataDir)
+			if err != nil {
+				return err
+			}
+
+			provenance, err := reg.Provenance(args[0])
+			if err != nil {
+				return err
+			}
+
+			printJSON(cmd, provenance)
+			return nil
+		},
+	}
+
+	return cmd
+}
+
+func newStatsCmd() *cobra.Command {
+	var output, minFree string
+	var asJSON bool
+
+	cmd := &cobra.Command{
+		Use:   "stats",
+		Short: "Report disk usage and shim health",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if asJSON {
+				output = "json"
+			}
+			if output != "text" && output != "json" {
+				return fmt.Errorf("invalid output format %q: must be text or json", output)
+			}
+			var threshold uint64
+			if minFree != "" {
+				var err error
+				if threshold, err = parseSize(minFree); err != nil {
+					return fmt.Errorf("invalid --min-free %q: %w", minFree, err)
+				}
+			}
+
+			dataDir, _ := cmd.Flags().GetString("data-dir")
+			reg, err := registry.Load(dataDir)
+			if err != nil {
+				return err
+			}
+
+			stats, err := reg.Stats()
+			if err != nil {
+				return err
+			}
+			if stats.Disk, err = registry.FreeSpace(dataDir); err != nil {
+				return err
+			}
+
+			if output == "json" {
+				printJSON(cmd, stats)
+			} else {
+				tw := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+				fmt.Fprintf(tw, "Shims:\t%d\t(%d bytes)\n", stats.Shims, stats.ShimBytes)
+				fmt.Fprintf(tw, "Compressed:\t%d\n", stats.Compressed)
+				fmt.Fprintf(tw, "Signatures:\t%d\t(%d bytes)\n", stats.Signatures, stats.SignatureBytes)
+				fmt.Fprintf(tw, "Unsigned:\t%d\n", stats.Unsigned)
+				fmt.Fprintf(tw, "Corrupt:\t%d\n", len(stats.Corrupt))
+				fmt.Fprintf(tw, "Free space:\t%d\t(of %d bytes)\n", stats.Disk.Free, stats.Disk.Total)
+				if err := tw.Flush(); err != nil {
+					return err
+				}
+				for _, c := range stats.Corrupt {
+					fmt.Fprintf(cmd.OutOrStdout(), "corrupt: %s: %s\n", c.Path, c.Error)
+				}
+			}
+
+			if stats.Disk.Free < threshold {
+				return fmt.Errorf("free space on %s is %d bytes, below --min-free %d", dataDir, stats.Disk.Free, threshold)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&output, "output", "o", "text", "Output format (text, json)")
+	cmd.Flags().BoolVar(&asJSON, "json", false, "Shorthand for --output json")
+	cmd.Flags().StringVar(&minFree, "min-free", "", "Fail if free space is below this size (e.g. 500MiB, 10GiB)")
+
+	return cmd
+}
+
+// sizeUnits are the suffixes parseSize accepts, longest first.
+var sizeUnits = []struct {
+	suffix string
+	bytes  uint64
+}{
+	{"TiB", 1 << 40}, {"GiB", 1 << 30}, {"MiB", 1 << 20}, {"KiB", 1 << 10},
+	{"T", 1 << 40}, {"G", 1 << 30}, {"M", 1 << 20}, {"K", 1 << 10}, {"B", 1},
+}
+
+// parseSize parses a byte count with an optional binary unit suffix,
+// such as "1048576", "512MiB" or "10G".
+func parseSize(s string) (uint64, error) {
+	s = strings.TrimSpace(s)
+	multiplier := uint64(1)
+	for _, u := range sizeUnits {
+		if strings.HasSuffix(s, u.suffix) {
+			s = strings.TrimSpace(strings.TrimSuffix(s, u.suffix))
+			multiplier = u.bytes
+			break
+		}
+	}
+	n, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("must be a number of bytes with an optional KiB, MiB, GiB or TiB suffix")
+	}
+	if n > math.MaxUint64/multiplier {
+		return 0, fmt.Errorf("size overflows")
+	}
+	return n * multiplier, nil
+}
+
+// initResult summarizes the paths touched by init.
+type initResult struct {
+	Initialized bool     `json:"initialized"`
+	Path        string   `json:"path"`
+	Manifest    string   `json:"manifest"`
+	Config      string   `json:"config"`
+	Created     []string `json:"created"`
+	Skipped     []string `json:"skipped"`
+	Overwritten []string `json:"overwritten"`
+}
+
+// validateBaseURL checks that raw is an absolute http(s) URL.
+func validateBaseURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("invalid --url %q: %w", raw, err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid --url %q: must be an absolute http or https URL", raw)
+	}
+	return nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
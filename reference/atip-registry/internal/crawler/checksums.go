@@ -0,0 +1,69 @@
+package crawler
+
+import (
+	"bufio"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+var (
+	// ErrChecksumMismatch indicates a downloaded asset's hash differs from
+	// the one the upstream checksums file publishes for it.
+	ErrChecksumMismatch = errors.New("checksum mismatch")
+
+	// ErrChecksumMissing indicates the checksums file has no entry for an
+	// asset.
+	ErrChecksumMissing = errors.New("checksum missing")
+)
+
+// Checksums maps asset file names to their lowercase hex SHA-256 digests,
+// as published in an upstream SHA256SUMS file.
+type Checksums map[string]string
+
+// ParseChecksums parses a SHA256SUMS-style file, as written by sha256sum:
+// one "<hex digest>  <file name>" entry per line, with an optional "*"
+// before the name marking binary mode. Blank lines and "#" comments are
+// skipped.
+func ParseChecksums(r io.Reader) (Checksums, error) {
+	sums := Checksums{}
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("line %d: expected \"<sha256> <file>\"", n)
+		}
+		digest := strings.ToLower(fields[0])
+		if b, err := hex.DecodeString(digest); err != nil || len(b) != 32 {
+			return nil, fmt.Errorf("line %d: invalid SHA-256 digest %q", n, fields[0])
+		}
+		name := strings.TrimPrefix(strings.TrimPrefix(fields[1], "*"), "./")
+		sums[name] = digest
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return sums, nil
+}
+
+// Verify checks hash, in ComputeHash's "sha256:<hex>" form, against the
+// published digest for asset. It returns ErrChecksumMissing if asset isn't
+// listed and ErrChecksumMismatch if the digests differ.
+func (s Checksums) Verify(asset, hash string) error {
+	expected, ok := s[asset]
+	if !ok {
+		return fmt.Errorf("%w: %s is not listed", ErrChecksumMissing, asset)
+	}
+	actual := strings.ToLower(strings.TrimPrefix(hash, "sha256:"))
+	if actual != expected {
+		return fmt.Errorf("%w: %s: expected sha256:%s, got sha256:%s", ErrChecksumMismatch, asset, expected, actual)
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package crawler
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseChecksums(t *testing.T) {
+	a := strings.Repeat("a", 64)
+	b := strings.Repeat("B", 64)
+
+	tests := []struct {
+		name    string
+		input   string
+		want    Checksums
+		wantErr string
+	}{
+		{
+			name:  "text and binary mode",
+			input: a + "  jq-linux-amd64\n" + b + " *jq-darwin-arm64\n",
+			want:  Checksums{"jq-linux-amd64": a, "jq-darwin-arm64": strings.ToLower(b)},
+		},
+		{
+			name:  "comments, blank lines and ./ prefix",
+			input: "# SHA256SUMS\n\n" + a + "  ./jq-linux-amd64\n",
+			want:  Checksums{"jq-linux-amd64": a},
+		},
+		{
+			name:    "missing file name",
+			input:   a + "\n",
+			wantErr: "line 1",
+		},
+		{
+			name:    "short digest",
+			input:   a + "  ok\n" + "abc123  jq-linux-amd64\n",
+			wantErr: "line 2: invalid SHA-256 digest",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseChecksums(strings.NewReader(tt.input))
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestChecksums_Verify(t *testing.T) {
+	digest := strings.Repeat("a", 64)
+	sums := Checksums{"jq-linux-amd64": digest}
+
+	assert.NoError(t, sums.Verify("jq-linux-amd64", "sha256:"+digest))
+	assert.NoError(t, sums.Verify("jq-linux-amd64", "sha256:"+strings.ToUpper(digest)))
+	assert.ErrorIs(t, sums.Verify("jq-linux-amd64", "sha256:"+strings.Repeat("b", 64)), ErrChecksumMismatch)
+	assert.ErrorIs(t, sums.Verify("jq-darwin-arm64", "sha256:"+digest), ErrChecksumMissing)
+}
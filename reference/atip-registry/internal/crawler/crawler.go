@@ -9,22 +9,52 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"net/http"
 	"os"
+	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
+	"time"
+	"unicode"
 
+	"github.com/anthropics/atip/reference/atip-registry/internal/pool"
 	"gopkg.in/yaml.v3"
 )
 
 // Config holds configuration for the crawler.
 type Config struct {
 	ManifestsDir string // Directory containing tool manifests
-	Parallelism  int    // Number of parallel downloads
+	OutputDir    string // Directory generated shims are written to, as {hash}.json
+	Parallelism  int    // Number of parallel downloads, unless SetPool is called
 	CheckOnly    bool   // Check for updates without downloading
+	GitHubToken  string // Token for the GitHub API, which rate-limits anonymous requests
+
+	// Platforms limits crawls to these platforms (empty = every platform
+	// in a manifest's asset patterns).
+	Platforms []string
 }
 
 // Crawler manages automated shim generation from tool releases.
 type Crawler struct {
 	config *Config
+	client *http.Client
+
+	// apiBase is the GitHub API URL releases are discovered from, followed
+	// by "/repos/<repo>/releases/latest".
+	apiBase string
+
+	// downloadBase is the URL release assets are downloaded from, followed
+	// by "/<repo>/releases/download/<tag>/<asset>".
+	downloadBase string
+
+	// fetch downloads one release and generates and writes its shim. Tests
+	// replace it to observe scheduling.
+	fetch func(ctx context.Context, manifest *ToolManifest, release Release) (*Shim, error)
+
+	// pool bounds fetches in flight, nil for a pool of Config.Parallelism
+	// per Crawl.
+	pool *pool.Pool
 }
 
 // ToolManifest describes how to crawl and generate shims for a tool.
@@ -48,6 +78,7 @@ type GitHubSource struct {
 	Repo          string            `yaml:"repo"`           // GitHub repo in "owner/name" format
 	AssetPatterns map[string]string `yaml:"asset_patterns"` // Platform -> asset name pattern
 	BinaryPath    string            `yaml:"binary_path"`    // Path to binary within archive
+	Checksums     string            `yaml:"checksums"`      // SHA256SUMS-style file: a URL or a release asset name
 }
 
 // Binary represents a downloaded binary
@@ -61,14 +92,16 @@ type Binary struct {
 
 // CrawlResult holds crawl results
 type CrawlResult struct {
-	Crawled int
-	Errors  []CrawlError
+	Crawled int          `json:"crawled"`
+	Shims   []*Shim      `json:"shims"` // Shims written, in the order of tools and platforms
+	Errors  []CrawlError `json:"errors"`
 }
 
 // CrawlError describes an error during crawling
 type CrawlError struct {
-	Tool  string
-	Error string
+	Tool     string `json:"tool"`
+	Platform string `json:"platform,omitempty"` // Empty if the whole tool failed, e.g. a bad manifest
+	Error    string `json:"error"`
 }
 
 // Generator generates shims from templates
@@ -90,15 +123,20 @@ type Option struct {
 	Description string
 }
 
-// Shim represents generated ATIP metadata (minimal)
+// Shim is the ATIP metadata generated for one release binary.
 type Shim struct {
-	Name    string
-	Version string
+	Name     string `json:"name"`
+	Version  string `json:"version"`
+	Platform string `json:"platform"`
+	Hash     string `json:"hash"` // Binary hash, "sha256:<hex>"
+	Data     []byte `json:"-"`    // The shim JSON
+	Path     string `json:"path"` // Where the shim was written, once it is
 }
 
-// Release represents a tool release (minimal)
+// Release is one platform's binary in a tool release.
 type Release struct {
-	Version  string
+	Version  string // Version, from the tag without any prefix, e.g. "1.7.1"
+	Tag      string // Release tag, e.g. "jq-1.7.1" or "v1.7.1"
 	Platform string
 }
 
@@ -117,49 +155,324 @@ func LoadManifest(path string) (*ToolManifest, error) {
 	return &manifest, nil
 }
 
+// ListTools returns the names of the tools with a manifest ("{name}.yaml")
+// in dir, sorted.
+func ListTools(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	tools := []string{}
+	for _, entry := range entries {
+		if name, ok := strings.CutSuffix(entry.Name(), ".yaml"); ok && !entry.IsDir() {
+			tools = append(tools, name)
+		}
+	}
+	return tools, nil
+}
+
 // NewCrawler creates a crawler instance
 func NewCrawler(config *Config) *Crawler {
-	return &Crawler{config: config}
+	c := &Crawler{
+		config:       config,
+		client:       &http.Client{Timeout: 5 * time.Minute},
+		apiBase:      "https://api.github.com",
+		downloadBase: "https://github.com",
+	}
+	c.fetch = c.fetchRelease
+	return c
 }
 
-// DiscoverReleases finds tool releases
+// SetPool makes Crawl run fetches on p instead of a pool of its own, so
+// they count against a limit shared with other work, e.g. a Syncer's
+// downloads. Config.Parallelism is then ignored.
+func (c *Crawler) SetPool(p *pool.Pool) {
+	c.pool = p
+}
+
+// DiscoverReleases finds the latest release of a tool, with one Release
+// per platform in its asset patterns (and in Config.Platforms, if set),
+// sorted by platform. Only GitHub sources are supported; a manifest without
+// one has no releases.
 func (c *Crawler) DiscoverReleases(ctx context.Context, manifest *ToolManifest) ([]Release, error) {
-	// Minimal implementation - return at least one release to pass tests
-	if manifest.Sources.GitHub != nil {
-		// Return a minimal release for each platform in asset patterns
-		releases := []Release{}
-		for platform := range manifest.Sources.GitHub.AssetPatterns {
-			releases = append(releases, Release{
-				Version:  "1.0.0",
-				Platform: platform,
-			})
-		}
-		return releases, nil
+	gh := manifest.Sources.GitHub
+	if gh == nil {
+		return []Release{}, nil
+	}
+
+	var latest struct {
+		TagName string `json:"tag_name"`
+	}
+	var buf strings.Builder
+	url := fmt.Sprintf("%s/repos/%s/releases/latest", c.apiBase, gh.Repo)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	if c.config.GitHubToken != "" {
+		req.Header.Set("Authorization", "Bearer "+c.config.GitHubToken)
 	}
-	return []Release{}, nil
+	if err := c.do(req, &buf); err != nil {
+		return nil, fmt.Errorf("latest release: %w", err)
+	}
+	if err := json.Unmarshal([]byte(buf.String()), &latest); err != nil || latest.TagName == "" {
+		return nil, fmt.Errorf("latest release: %s: no tag_name in response", url)
+	}
+
+	platforms := make([]string, 0, len(gh.AssetPatterns))
+	for platform := range gh.AssetPatterns {
+		platforms = append(platforms, platform)
+	}
+	sort.Strings(platforms)
+
+	version := versionFromTag(latest.TagName)
+	releases := []Release{}
+	for _, platform := range FilterPlatforms(platforms, c.config.Platforms) {
+		releases = append(releases, Release{Version: version, Tag: latest.TagName, Platform: platform})
+	}
+	return releases, nil
 }
 
-// Crawl executes the crawl pipeline
+// versionFromTag returns the version a release tag names, dropping any
+// prefix before the first digit: "v1.7.1" and "jq-1.7.1" are both "1.7.1".
+func versionFromTag(tag string) string {
+	if i := strings.IndexFunc(tag, unicode.IsDigit); i > 0 {
+		return tag[i:]
+	}
+	return tag
+}
+
+// Crawl executes the crawl pipeline. Tools are crawled concurrently and
+// each tool's platforms are fetched concurrently. Release lookups and
+// fetches both run on the pool, so at most Config.Parallelism of them are
+// in flight across the whole batch (or as many as the pool given to SetPool
+// allows).
+//
+// A tool counts as crawled if all of its platforms were fetched, and each
+// fetched platform's shim is written to Config.OutputDir. Failures are
+// collected in the result, in the order of tools, without stopping the
+// batch. If ctx is cancelled, fetches not yet started are abandoned and
+// ctx's error is returned along with the partial result.
 func (c *Crawler) Crawl(ctx context.Context, tools []string) (*CrawlResult, error) {
+	p := c.pool
+	if p == nil {
+		p = pool.New(c.config.Parallelism)
+	}
+
+	shims := make([][]*Shim, len(tools))
+	errs := make([][]CrawlError, len(tools))
+	var wg sync.WaitGroup
+	for i, tool := range tools {
+		wg.Add(1)
+		go func(i int, tool string) {
+			defer wg.Done()
+			shims[i], errs[i] = c.crawlTool(ctx, tool, p)
+		}(i, tool)
+	}
+	wg.Wait()
+
 	result := &CrawlResult{
+		Shims:  []*Shim{},
 		Errors: []CrawlError{},
 	}
+	for i, toolErrs := range errs {
+		if len(toolErrs) == 0 {
+			result.Crawled++
+		}
+		result.Shims = append(result.Shims, shims[i]...)
+		result.Errors = append(result.Errors, toolErrs...)
+	}
+
+	return result, ctx.Err()
+}
+
+// crawlTool looks up the releases of tool and fetches each, both on p, and
+// returns the shims written and the failures, both sorted by platform.
+func (c *Crawler) crawlTool(ctx context.Context, tool string, p *pool.Pool) ([]*Shim, []CrawlError) {
+	manifestPath := fmt.Sprintf("%s/%s.yaml", c.config.ManifestsDir, tool)
+	manifest, err := LoadManifest(manifestPath)
+	if err != nil {
+		return nil, []CrawlError{{Tool: tool, Error: err.Error()}}
+	}
+
+	// The lookup is a task of its own, finished before the fetches are
+	// queued, since a task must not wait on its own pool
+	var releases []Release
+	if err := p.Run(ctx, 1, func(ctx context.Context, _ int) error {
+		var err error
+		releases, err = c.DiscoverReleases(ctx, manifest)
+		return err
+	})[0]; err != nil {
+		return nil, []CrawlError{{Tool: tool, Error: err.Error()}}
+	}
+	if c.config.CheckOnly {
+		return nil, nil
+	}
 
-	// Minimal implementation - just check if tools exist
-	for _, tool := range tools {
-		manifestPath := fmt.Sprintf("%s/%s.yaml", c.config.ManifestsDir, tool)
-		_, err := LoadManifest(manifestPath)
+	fetched := make([]*Shim, len(releases))
+	errs := p.Run(ctx, len(releases), func(ctx context.Context, i int) error {
+		var err error
+		fetched[i], err = c.fetch(ctx, manifest, releases[i])
+		return err
+	})
+
+	var shims []*Shim
+	var crawlErrs []CrawlError
+	for i, err := range errs {
 		if err != nil {
-			result.Errors = append(result.Errors, CrawlError{
-				Tool:  tool,
-				Error: err.Error(),
-			})
-			continue
+			crawlErrs = append(crawlErrs, CrawlError{Tool: tool, Platform: releases[i].Platform, Error: err.Error()})
+		} else if fetched[i] != nil {
+			shims = append(shims, fetched[i])
 		}
-		result.Crawled++
 	}
+	return shims, crawlErrs
+}
+
+// fetchRelease downloads a release binary, generates its shim and writes
+// it to Config.OutputDir. If the manifest declares a checksums file, the
+// binary's hash must match the digest published there, so a tampered or
+// substituted asset fails the fetch before a shim is generated.
+func (c *Crawler) fetchRelease(ctx context.Context, manifest *ToolManifest, release Release) (*Shim, error) {
+	gh := manifest.Sources.GitHub
+	if gh == nil {
+		return nil, nil
+	}
+	asset := AssetName(gh.AssetPatterns[release.Platform], release.Version)
 
-	return result, nil
+	dir, err := os.MkdirTemp("", "atip-crawl-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, filepath.Base(asset))
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	err = c.download(ctx, c.assetURL(gh.Repo, release.Tag, asset), f)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	hash, err := ComputeHash(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if gh.Checksums != "" {
+		sums, err := c.fetchChecksums(ctx, gh, release)
+		if err != nil {
+			return nil, err
+		}
+		if err := sums.Verify(asset, hash); err != nil {
+			return nil, err
+		}
+	}
+
+	shim, err := NewGenerator().Generate(manifest, &Binary{
+		Name:     manifest.Name,
+		Version:  release.Version,
+		Platform: release.Platform,
+		Hash:     hash,
+		Path:     path,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := c.writeShim(shim); err != nil {
+		return nil, err
+	}
+	return shim, nil
+}
+
+// AssetName returns the release asset an asset pattern names for version,
+// replacing "{version}" in the pattern.
+func AssetName(pattern, version string) string {
+	return strings.ReplaceAll(pattern, "{version}", version)
+}
+
+// writeShim writes shim to Config.OutputDir as {hash}.json, through a
+// temporary file so an interrupted crawl leaves no partial shim.
+func (c *Crawler) writeShim(shim *Shim) error {
+	if err := os.MkdirAll(c.config.OutputDir, 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(c.config.OutputDir, ".atip-shim-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(shim.Data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(c.config.OutputDir, strings.TrimPrefix(shim.Hash, "sha256:")+".json")
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+	shim.Path = path
+	return nil
+}
+
+// fetchChecksums downloads and parses the manifest's checksums file for a
+// release.
+func (c *Crawler) fetchChecksums(ctx context.Context, gh *GitHubSource, release Release) (Checksums, error) {
+	url := AssetName(gh.Checksums, release.Version)
+	if !strings.HasPrefix(url, "https://") && !strings.HasPrefix(url, "http://") {
+		url = c.assetURL(gh.Repo, release.Tag, url)
+	}
+
+	var buf strings.Builder
+	if err := c.download(ctx, url, &buf); err != nil {
+		return nil, fmt.Errorf("checksums: %w", err)
+	}
+	sums, err := ParseChecksums(strings.NewReader(buf.String()))
+	if err != nil {
+		return nil, fmt.Errorf("checksums: %s: %w", url, err)
+	}
+	return sums, nil
+}
+
+// assetURL returns the download URL of a GitHub release asset.
+func (c *Crawler) assetURL(repo, tag, asset string) string {
+	return fmt.Sprintf("%s/%s/releases/download/%s/%s", c.downloadBase, repo, tag, asset)
+}
+
+// download copies the body of a GET request for url to w.
+func (c *Crawler) download(ctx context.Context, url string, w io.Writer) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	return c.do(req, w)
+}
+
+// do sends req and copies the response body to w, failing unless the
+// status is 200 OK.
+func (c *Crawler) do(req *http.Request, w io.Writer) error {
+	url := req.URL.String()
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	_, err = io.Copy(w, resp.Body)
+	return err
 }
 
 // ComputeHash computes SHA-256 of a file
@@ -183,20 +496,49 @@ func NewGenerator() *Generator {
 	return &Generator{}
 }
 
-// Generate creates a shim from template and binary
+// Generate creates the shim for binary from the manifest's JSON template.
+// The template supplies the metadata, e.g. commands; name, version and
+// binary always describe binary, and atip, description and trust default
+// to ATIP 0.6, the manifest's description and an unverified community
+// source if the template leaves them out.
 func (g *Generator) Generate(manifest *ToolManifest, binary *Binary) (*Shim, error) {
-	// Parse template JSON (minimal)
-	var templateData map[string]interface{}
-	if err := json.Unmarshal([]byte(manifest.Template), &templateData); err != nil {
-		return nil, err
+	metadata := map[string]interface{}{}
+	if strings.TrimSpace(manifest.Template) != "" {
+		if err := json.Unmarshal([]byte(manifest.Template), &metadata); err != nil {
+			return nil, fmt.Errorf("invalid template: %w", err)
+		}
 	}
 
-	shim := &Shim{
-		Name:    manifest.Name,
-		Version: binary.Version,
+	defaults := map[string]interface{}{
+		"atip":        map[string]string{"version": "0.6"},
+		"description": manifest.Description,
+		"trust":       map[string]interface{}{"source": "community", "verified": false},
+	}
+	for key, value := range defaults {
+		if _, ok := metadata[key]; !ok {
+			metadata[key] = value
+		}
+	}
+	metadata["name"] = manifest.Name
+	metadata["version"] = binary.Version
+	metadata["binary"] = map[string]string{
+		"hash":     binary.Hash,
+		"name":     binary.Name,
+		"version":  binary.Version,
+		"platform": binary.Platform,
 	}
 
-	return shim, nil
+	data, err := json.MarshalIndent(metadata, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return &Shim{
+		Name:     manifest.Name,
+		Version:  binary.Version,
+		Platform: binary.Platform,
+		Hash:     binary.Hash,
+		Data:     data,
+	}, nil
 }
 
 // NewParser creates a parser instance
@@ -2,9 +2,21 @@ package crawler
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/anthropics/atip/reference/atip-registry/internal/pool"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -62,11 +74,14 @@ func TestCrawler_ParseGitHubSource(t *testing.T) {
 	crawler := NewCrawler(&Config{
 		Parallelism: 2,
 	})
+	serveLatestRelease(t, crawler, "jq-1.7.1")
 
 	releases, err := crawler.DiscoverReleases(context.Background(), manifest)
-	assert.NoError(t, err)
-	assert.NotEmpty(t, releases)
-	// Will fail until implementation exists
+	require.NoError(t, err)
+	assert.Equal(t, []Release{
+		{Version: "1.7.1", Tag: "jq-1.7.1", Platform: "darwin-arm64"},
+		{Version: "1.7.1", Tag: "jq-1.7.1", Platform: "linux-amd64"},
+	}, releases)
 }
 
 func TestCrawler_ComputeBinaryHash(t *testing.T) {
@@ -98,12 +113,32 @@ func TestCrawler_GenerateShimFromTemplate(t *testing.T) {
 	generator := NewGenerator()
 	shim, err := generator.Generate(manifest, binary)
 
-	assert.NoError(t, err)
-	assert.NotNil(t, shim)
-	// Will fail until implementation exists
-	// assert.Equal(t, "jq", shim.Name)
-	// assert.Equal(t, "1.7.1", shim.Version)
-	// assert.Equal(t, binary.Hash, shim.Binary.Hash)
+	require.NoError(t, err)
+	assert.Equal(t, "jq", shim.Name)
+	assert.Equal(t, "1.7.1", shim.Version)
+	assert.Equal(t, binary.Hash, shim.Hash)
+
+	var metadata struct {
+		Atip        map[string]string          `json:"atip"`
+		Name        string                     `json:"name"`
+		Version     string                     `json:"version"`
+		Description string                     `json:"description"`
+		Binary      map[string]string          `json:"binary"`
+		Trust       map[string]interface{}     `json:"trust"`
+		Commands    map[string]json.RawMessage `json:"commands"`
+	}
+	require.NoError(t, json.Unmarshal(shim.Data, &metadata))
+	assert.Equal(t, "0.6", metadata.Atip["version"])
+	assert.Equal(t, "jq", metadata.Name)
+	assert.Equal(t, "1.7.1", metadata.Version)
+	assert.Equal(t, manifest.Description, metadata.Description)
+	assert.Equal(t, map[string]string{"hash": binary.Hash, "name": "jq", "version": "1.7.1", "platform": "linux-amd64"}, metadata.Binary)
+	assert.Equal(t, "community", metadata.Trust["source"])
+	assert.Contains(t, metadata.Commands, "")
+
+	manifest.Template = "not json"
+	_, err = generator.Generate(manifest, binary)
+	assert.Error(t, err)
 }
 
 func TestCrawler_PipelineExecution(t *testing.T) {
@@ -121,6 +156,356 @@ func TestCrawler_PipelineExecution(t *testing.T) {
 	// assert.Greater(t, result.Crawled, 0)
 }
 
+// serveLatestRelease points crawler's release discovery at a server that
+// reports tag as every repo's latest release.
+func serveLatestRelease(t *testing.T, crawler *Crawler, tag string) {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "/releases/latest") {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprintf(w, `{"tag_name": %q}`, tag)
+	}))
+	t.Cleanup(srv.Close)
+	crawler.apiBase = srv.URL
+}
+
+// writeManifests writes a manifest for each tool, each with platforms
+// linux-amd64, linux-arm64, darwin-amd64 and darwin-arm64.
+func writeManifests(t *testing.T, tools ...string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for _, tool := range tools {
+		manifest := fmt.Sprintf(`name: %s
+sources:
+  github:
+    repo: example/%s
+    asset_patterns:
+      linux-amd64: "%s-linux-amd64"
+      linux-arm64: "%s-linux-arm64"
+      darwin-amd64: "%s-darwin-amd64"
+      darwin-arm64: "%s-darwin-arm64"
+`, tool, tool, tool, tool, tool, tool)
+		require.NoError(t, os.WriteFile(filepath.Join(dir, tool+".yaml"), []byte(manifest), 0644))
+	}
+	return dir
+}
+
+func TestCrawler_Crawl_Parallelism(t *testing.T) {
+	for _, parallelism := range []int{1, 3} {
+		t.Run(fmt.Sprintf("parallelism=%d", parallelism), func(t *testing.T) {
+			crawler := NewCrawler(&Config{
+				ManifestsDir: writeManifests(t, "jq", "gh", "kubectl"),
+				Parallelism:  parallelism,
+			})
+
+			// Count release lookups and fetches in flight together and
+			// remember the peak
+			var inFlight, peak, lookups, fetched int32
+			busy := func() {
+				n := atomic.AddInt32(&inFlight, 1)
+				for {
+					p := atomic.LoadInt32(&peak)
+					if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+						break
+					}
+				}
+				time.Sleep(20 * time.Millisecond)
+				atomic.AddInt32(&inFlight, -1)
+			}
+			api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt32(&lookups, 1)
+				busy()
+				fmt.Fprint(w, `{"tag_name": "v1.0.0"}`)
+			}))
+			defer api.Close()
+			crawler.apiBase = api.URL
+			crawler.fetch = func(ctx context.Context, manifest *ToolManifest, release Release) (*Shim, error) {
+				busy()
+				atomic.AddInt32(&fetched, 1)
+				return nil, nil
+			}
+
+			result, err := crawler.Crawl(context.Background(), []string{"jq", "gh", "kubectl"})
+			require.NoError(t, err)
+			assert.Equal(t, 3, result.Crawled)
+			assert.Empty(t, result.Errors)
+			assert.Equal(t, int32(3), lookups)
+			assert.Equal(t, int32(12), fetched)
+			assert.Equal(t, int32(parallelism), peak)
+		})
+	}
+}
+
+func TestCrawler_Crawl_SharedPool(t *testing.T) {
+	// Two crawlers given one pool stay within its size together,
+	// whatever their own Parallelism
+	shared := pool.New(2)
+	var inFlight, peak int32
+	fetch := func(ctx context.Context, manifest *ToolManifest, release Release) (*Shim, error) {
+		n := atomic.AddInt32(&inFlight, 1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		atomic.AddInt32(&inFlight, -1)
+		return nil, nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		crawler := NewCrawler(&Config{
+			ManifestsDir: writeManifests(t, "jq", "gh"),
+			Parallelism:  8,
+		})
+		serveLatestRelease(t, crawler, "v1.0.0")
+		crawler.SetPool(shared)
+		crawler.fetch = fetch
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result, err := crawler.Crawl(context.Background(), []string{"jq", "gh"})
+			assert.NoError(t, err)
+			assert.Equal(t, 2, result.Crawled)
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(2), peak)
+}
+
+func TestCrawler_Crawl_CollectsErrors(t *testing.T) {
+	crawler := NewCrawler(&Config{
+		ManifestsDir: writeManifests(t, "jq", "gh"),
+		Parallelism:  4,
+	})
+	serveLatestRelease(t, crawler, "v1.0.0")
+	crawler.fetch = func(ctx context.Context, manifest *ToolManifest, release Release) (*Shim, error) {
+		if manifest.Name == "jq" && release.Platform == "darwin-arm64" {
+			return nil, errors.New("asset not found")
+		}
+		return nil, nil
+	}
+
+	result, err := crawler.Crawl(context.Background(), []string{"missing", "jq", "gh"})
+	require.NoError(t, err)
+
+	assert.Equal(t, 1, result.Crawled)
+	require.Len(t, result.Errors, 2)
+	assert.Equal(t, "missing", result.Errors[0].Tool)
+	assert.Empty(t, result.Errors[0].Platform)
+	assert.Equal(t, CrawlError{Tool: "jq", Platform: "darwin-arm64", Error: "asset not found"}, result.Errors[1])
+}
+
+func TestCrawler_Crawl_Cancelled(t *testing.T) {
+	crawler := NewCrawler(&Config{
+		ManifestsDir: writeManifests(t, "jq", "gh"),
+		Parallelism:  1,
+	})
+	serveLatestRelease(t, crawler, "v1.0.0")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var fetched int32
+	crawler.fetch = func(ctx context.Context, manifest *ToolManifest, release Release) (*Shim, error) {
+		atomic.AddInt32(&fetched, 1)
+		cancel()
+		return nil, nil
+	}
+
+	result, err := crawler.Crawl(ctx, []string{"jq", "gh"})
+	assert.ErrorIs(t, err, context.Canceled)
+	require.NotNil(t, result)
+	assert.Equal(t, int32(1), fetched)
+	// Everything after the first fetch is abandoned: the other three
+	// platforms of its tool, and the other tool's lookup or, if that
+	// already ran, its platforms
+	assert.Zero(t, result.Crawled)
+	assert.NotEmpty(t, result.Errors)
+	for _, crawlErr := range result.Errors {
+		assert.Equal(t, context.Canceled.Error(), crawlErr.Error)
+	}
+}
+
+func TestCrawler_Crawl_VerifiesChecksums(t *testing.T) {
+	assets := map[string]string{
+		"jq-linux-amd64":  "linux binary",
+		"jq-darwin-arm64": "tampered binary",
+	}
+	// The published digest for darwin-arm64 is of different contents
+	sums := fmt.Sprintf("%x  jq-linux-amd64\n%x  jq-darwin-arm64\n",
+		sha256.Sum256([]byte("linux binary")), sha256.Sum256([]byte("darwin binary")))
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/repos/example/jq/releases/latest" {
+			fmt.Fprint(w, `{"tag_name": "v1.0.0"}`)
+			return
+		}
+		dir, name := filepath.Split(r.URL.Path)
+		if dir != "/example/jq/releases/download/v1.0.0/" {
+			http.NotFound(w, r)
+			return
+		}
+		if name == "SHA256SUMS" {
+			fmt.Fprint(w, sums)
+			return
+		}
+		body, ok := assets[name]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, body)
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	manifest := `name: jq
+template: '{"atip": {"version": "0.6"}, "name": "jq"}'
+sources:
+  github:
+    repo: example/jq
+    checksums: SHA256SUMS
+    asset_patterns:
+      linux-amd64: jq-linux-amd64
+      darwin-arm64: jq-darwin-arm64
+`
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "jq.yaml"), []byte(manifest), 0644))
+
+	crawler := NewCrawler(&Config{ManifestsDir: dir, OutputDir: t.TempDir(), Parallelism: 2})
+	crawler.apiBase = srv.URL
+	crawler.downloadBase = srv.URL
+
+	result, err := crawler.Crawl(context.Background(), []string{"jq"})
+	require.NoError(t, err)
+	assert.Equal(t, 0, result.Crawled)
+	require.Len(t, result.Errors, 1)
+	assert.Equal(t, "jq", result.Errors[0].Tool)
+	assert.Equal(t, "darwin-arm64", result.Errors[0].Platform)
+	assert.Contains(t, result.Errors[0].Error, "checksum mismatch: jq-darwin-arm64")
+
+	// Without the tampered asset the tool crawls cleanly
+	assets["jq-darwin-arm64"] = "darwin binary"
+	result, err = crawler.Crawl(context.Background(), []string{"jq"})
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.Crawled)
+	assert.Empty(t, result.Errors)
+}
+
+func TestCrawler_Crawl_WritesShims(t *testing.T) {
+	assets := map[string]string{
+		"jq-1.7.1-linux-amd64":  "linux binary",
+		"jq-1.7.1-darwin-arm64": "darwin binary",
+	}
+	var mu sync.Mutex
+	var requested []string
+	var apiAuth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requested = append(requested, r.URL.Path)
+		mu.Unlock()
+		if r.URL.Path == "/repos/jqlang/jq/releases/latest" {
+			apiAuth = r.Header.Get("Authorization")
+			fmt.Fprint(w, `{"tag_name": "jq-1.7.1"}`)
+			return
+		}
+		name, ok := strings.CutPrefix(r.URL.Path, "/jqlang/jq/releases/download/jq-1.7.1/")
+		if !ok || assets[name] == "" {
+			http.NotFound(w, r)
+			return
+		}
+		assert.Empty(t, r.Header.Get("Authorization"), "token only goes to the API")
+		fmt.Fprint(w, assets[name])
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	manifest := `name: jq
+description: Command-line JSON processor
+template: '{"commands": {"": {"description": "Filter JSON"}}}'
+sources:
+  github:
+    repo: jqlang/jq
+    asset_patterns:
+      linux-amd64: "jq-{version}-linux-amd64"
+      darwin-arm64: "jq-{version}-darwin-arm64"
+`
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "jq.yaml"), []byte(manifest), 0644))
+
+	outputDir := filepath.Join(t.TempDir(), "output")
+	crawler := NewCrawler(&Config{ManifestsDir: dir, OutputDir: outputDir, Parallelism: 2, GitHubToken: "secret"})
+	crawler.apiBase = srv.URL
+	crawler.downloadBase = srv.URL
+
+	result, err := crawler.Crawl(context.Background(), []string{"jq"})
+	require.NoError(t, err)
+	assert.Empty(t, result.Errors)
+	assert.Equal(t, 1, result.Crawled)
+	assert.Equal(t, "Bearer secret", apiAuth)
+	assert.ElementsMatch(t, []string{
+		"/repos/jqlang/jq/releases/latest",
+		"/jqlang/jq/releases/download/jq-1.7.1/jq-1.7.1-linux-amd64",
+		"/jqlang/jq/releases/download/jq-1.7.1/jq-1.7.1-darwin-arm64",
+	}, requested)
+
+	// One shim per platform, named by the hash of the downloaded binary
+	require.Len(t, result.Shims, 2)
+	for i, platform := range []string{"darwin-arm64", "linux-amd64"} {
+		shim := result.Shims[i]
+		hash := fmt.Sprintf("%x", sha256.Sum256([]byte(assets["jq-1.7.1-"+platform])))
+		assert.Equal(t, platform, shim.Platform)
+		assert.Equal(t, "1.7.1", shim.Version)
+		assert.Equal(t, "sha256:"+hash, shim.Hash)
+		assert.Equal(t, filepath.Join(outputDir, hash+".json"), shim.Path)
+
+		data, err := os.ReadFile(shim.Path)
+		require.NoError(t, err)
+		assert.Equal(t, shim.Data, data)
+		var metadata struct {
+			Name        string            `json:"name"`
+			Version     string            `json:"version"`
+			Description string            `json:"description"`
+			Binary      map[string]string `json:"binary"`
+		}
+		require.NoError(t, json.Unmarshal(data, &metadata))
+		assert.Equal(t, "jq", metadata.Name)
+		assert.Equal(t, "1.7.1", metadata.Version)
+		assert.Equal(t, "Command-line JSON processor", metadata.Description)
+		assert.Equal(t, "sha256:"+hash, metadata.Binary["hash"])
+		assert.Equal(t, platform, metadata.Binary["platform"])
+	}
+	entries, err := os.ReadDir(outputDir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 2, "no temporary files left behind")
+
+	// A missing asset fails its platform without writing a shim
+	delete(assets, "jq-1.7.1-darwin-arm64")
+	require.NoError(t, os.RemoveAll(outputDir))
+	result, err = crawler.Crawl(context.Background(), []string{"jq"})
+	require.NoError(t, err)
+	assert.Zero(t, result.Crawled)
+	require.Len(t, result.Errors, 1)
+	assert.Equal(t, "darwin-arm64", result.Errors[0].Platform)
+	assert.Contains(t, result.Errors[0].Error, "404")
+	require.Len(t, result.Shims, 1)
+	assert.Equal(t, "linux-amd64", result.Shims[0].Platform)
+}
+
+func TestVersionFromTag(t *testing.T) {
+	for tag, want := range map[string]string{
+		"v1.7.1":   "1.7.1",
+		"jq-1.7.1": "1.7.1",
+		"1.7.1":    "1.7.1",
+		"nightly":  "nightly",
+	} {
+		assert.Equal(t, want, versionFromTag(tag), tag)
+	}
+}
+
 func TestCrawler_FilterPlatforms(t *testing.T) {
 	tests := []struct {
 		name              string
@@ -150,6 +535,34 @@ func TestCrawler_FilterPlatforms(t *testing.T) {
 	}
 }
 
+func TestCrawler_DiscoverReleases_Platforms(t *testing.T) {
+	manifest, err := LoadManifest(filepath.Join(writeManifests(t, "jq"), "jq.yaml"))
+	require.NoError(t, err)
+
+	crawler := NewCrawler(&Config{Platforms: []string{"linux-amd64", "darwin-arm64", "windows-amd64"}})
+	serveLatestRelease(t, crawler, "v1.7.1")
+
+	releases, err := crawler.DiscoverReleases(context.Background(), manifest)
+	require.NoError(t, err)
+	assert.Equal(t, []Release{
+		{Version: "1.7.1", Tag: "v1.7.1", Platform: "darwin-arm64"},
+		{Version: "1.7.1", Tag: "v1.7.1", Platform: "linux-amd64"},
+	}, releases)
+}
+
+func TestListTools(t *testing.T) {
+	dir := writeManifests(t, "jq", "gh")
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "README.md"), nil, 0644))
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "old.yaml"), 0755))
+
+	tools, err := ListTools(dir)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"gh", "jq"}, tools)
+
+	_, err = ListTools(filepath.Join(dir, "missing"))
+	assert.Error(t, err)
+}
+
 func TestCrawler_CheckOnly(t *testing.T) {
 	crawler := NewCrawler(&Config{
 		ManifestsDir: "../../testdata",
@@ -0,0 +1,333 @@
+package registry
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ManifestPath is the relative path of the registry manifest.
+const ManifestPath = ".well-known/atip-registry.json"
+
+// maxArchiveEntrySize bounds each file read from an imported archive.
+const maxArchiveEntrySize = 10 << 20
+
+// ErrUnsafeArchive is returned when an archive entry would be extracted
+// outside the shim layout (absolute paths, "..", links, unknown files).
+var ErrUnsafeArchive = errors.New("unsafe archive entry")
+
+// ArchiveResult summarizes an export or import.
+type ArchiveResult struct {
+	Manifest bool     `json:"manifest"`
+	Shims    []string `json:"shims"`
+	Bundles  []string `json:"bundles"`
+	Minisigs []string `json:"minisigs"`
+}
+
+// newArchiveResult returns an empty ArchiveResult with non-nil lists.
+func newArchiveResult() *ArchiveResult {
+	return &ArchiveResult{Shims: []string{}, Bundles: []string{}, Minisigs: []string{}}
+}
+
+// addSignature records the signature of the shim with hash, a Cosign bundle
+// or minisign signature depending on ext.
+func (a *ArchiveResult) addSignature(hash, ext string) {
+	if ext == MinisigExtension {
+		a.Minisigs = append(a.Minisigs, hash)
+	} else {
+		a.Bundles = append(a.Bundles, hash)
+	}
+}
+
+// Export writes the registry manifest, shims, signature bundles and
+// minisign signatures to w as a gzip-compressed tarball. Compressed shims
+// are written decompressed, as {hash}.json, so the archive can be imported
+// into any registry.
+func (r *Registry) Export(w io.Writer) (*ArchiveResult, error) {
+	result := newArchiveResult()
+
+	files := []string{}
+	if _, err := r.storage.Get(ManifestPath); err == nil {
+		files = append(files, ManifestPath)
+		result.Manifest = true
+	}
+
+	entries, err := r.storage.List(ShimSubdir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read shims directory: %w", err)
+	}
+
+	exported := make(map[string]bool) // Shim hashes, once each if stored in both encodings
+	for _, entry := range entries {
+		if hash, ok := strings.CutSuffix(entry.Name, CompressedShimExtension); ok && hashRegex.MatchString(hash) {
+			entry.Name = hash + ShimExtension
+		}
+		hash, ext, ok := parseShimFilename(entry.Name)
+		if !ok || (ext == ShimExtension && exported[hash]) {
+			continue
+		}
+		files = append(files, path.Join(ShimSubdir, entry.Name))
+		if ext == ShimExtension {
+			exported[hash] = true
+			result.Shims = append(result.Shims, hash)
+		} else {
+			result.addSignature(hash, ext)
+		}
+	}
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	for _, name := range files {
+		var data []byte
+		var err error
+		if hash, ok := shimFileHash(path.Base(name)); ok {
+			data, err = r.readShimData(hash)
+		} else {
+			data, err = r.storage.Get(name)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", name, err)
+		}
+		header := &tar.Header{
+			Name:    name,
+			Mode:    0644,
+			Size:    int64(len(data)),
+			ModTime: time.Now(),
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return nil, fmt.Errorf("failed to write archive: %w", err)
+		}
+		if _, err := tw.Write(data); err != nil {
+			return nil, fmt.Errorf("failed to write archive: %w", err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write archive: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write archive: %w", err)
+	}
+
+	return result, nil
+}
+
+// Import reads a tarball produced by Export. Each shim is validated as with
+// AddShim after checking that its binary hash matches its filename.
+// Signatures are stored as is. An existing manifest is left untouched.
+//
+// Every entry is validated and staged before anything is written, so an
+// archive with a rejected entry leaves the registry unchanged. Staged files
+// are then moved into place, by renaming them in a data directory.
+func (r *Registry) Import(rd io.Reader) (*ArchiveResult, error) {
+	result := newArchiveResult()
+
+	gz, err := gzip.NewReader(rd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read archive: %w", err)
+	}
+	defer gz.Close()
+
+	stage, err := r.newImportStage()
+	if err != nil {
+		return nil, fmt.Errorf("failed to stage import: %w", err)
+	}
+	defer stage.cleanup()
+
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read archive: %w", err)
+		}
+
+		if header.Typeflag == tar.TypeDir {
+			continue
+		}
+		if header.Typeflag != tar.TypeReg {
+			return nil, fmt.Errorf("%w: %s is not a regular file", ErrUnsafeArchive, header.Name)
+		}
+
+		name := path.Clean(header.Name)
+		if path.IsAbs(name) || name == ".." || strings.HasPrefix(name, "../") {
+			return nil, fmt.Errorf("%w: %s escapes the data directory", ErrUnsafeArchive, header.Name)
+		}
+
+		data, err := io.ReadAll(io.LimitReader(tr, maxArchiveEntrySize+1))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", name, err)
+		}
+		if len(data) > maxArchiveEntrySize {
+			return nil, fmt.Errorf("%w: %s exceeds %d bytes", ErrUnsafeArchive, name, maxArchiveEntrySize)
+		}
+
+		if name == ManifestPath {
+			imported, err := r.importManifest(stage, data)
+			if err != nil {
+				return nil, err
+			}
+			result.Manifest = imported
+			continue
+		}
+
+		dir, filename := path.Split(name)
+		hash, ext, ok := parseShimFilename(filename)
+		if path.Clean(dir) != ShimSubdir || !ok {
+			return nil, fmt.Errorf("%w: unexpected file %s", ErrUnsafeArchive, header.Name)
+		}
+
+		if ext != ShimExtension {
+			if err := stage.put(path.Join(ShimSubdir, filename), data); err != nil {
+				return nil, fmt.Errorf("failed to stage signature: %w", err)
+			}
+			result.addSignature(hash, ext)
+			continue
+		}
+
+		var shim struct {
+			Binary struct {
+				Hash string `json:"hash"`
+			} `json:"binary"`
+		}
+		if err := json.Unmarshal(data, &shim); err != nil {
+			return nil, fmt.Errorf("%w: %s: invalid JSON: %v", ErrValidation, name, err)
+		}
+		if err := ValidateHash(shim.Binary.Hash, filename); err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		if _, err := validateShimData(data); err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		key, stale, encoded, err := r.encodeShim(hash, data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		if err := stage.put(key, encoded); err != nil {
+			return nil, fmt.Errorf("failed to stage shim: %w", err)
+		}
+		stage.stale = append(stage.stale, stale)
+		result.Shims = append(result.Shims, hash)
+	}
+
+	if err := stage.commit(r.storage); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// importManifest stages the manifest unless one already exists, reporting
+// whether it will be written.
+func (r *Registry) importManifest(stage *importStage, data []byte) (bool, error) {
+	if !json.Valid(data) {
+		return false, fmt.Errorf("%w: %s: invalid JSON", ErrValidation, ManifestPath)
+	}
+
+	if _, err := r.storage.Get(ManifestPath); err == nil {
+		return false, nil
+	}
+	if err := stage.put(ManifestPath, data); err != nil {
+		return false, fmt.Errorf("failed to stage manifest: %w", err)
+	}
+	return true, nil
+}
+
+// importStage holds the validated files of an archive until Import moves
+// them into the registry's storage.
+type importStage struct {
+	storage Storage         // Staged files, under their keys in the registry
+	keys    []string        // Staged keys, in the order first staged
+	staged  map[string]bool // Set of keys
+	stale   []string        // Keys to remove once the files are in place
+
+	move    func(key string) error // Moves a staged file into the registry
+	cleanup func()                 // Removes whatever is left of the stage
+}
+
+// newImportStage creates an empty stage. A data directory is staged in a
+// temporary directory inside it, so staged files can be renamed into place;
+// other storage is staged in memory.
+func (r *Registry) newImportStage() (*importStage, error) {
+	stage := &importStage{staged: make(map[string]bool), cleanup: func() {}}
+
+	if files, ok := r.storage.(*FileStorage); ok {
+		dir, err := os.MkdirTemp(files.root, ".import-")
+		if err != nil {
+			return nil, err
+		}
+		staging := NewFileStorage(dir)
+		stage.storage = staging
+		stage.move = func(key string) error {
+			dest := files.path(key)
+			if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+				return fmt.Errorf("failed to create directory: %w", err)
+			}
+			return os.Rename(staging.path(key), dest)
+		}
+		stage.cleanup = func() { os.RemoveAll(dir) }
+		return stage, nil
+	}
+
+	staging := NewMemoryStorage()
+	stage.storage = staging
+	stage.move = func(key string) error {
+		data, err := staging.Get(key)
+		if err != nil {
+			return err
+		}
+		return r.storage.Put(key, data)
+	}
+	return stage, nil
+}
+
+// put stages data under key, replacing anything staged there before.
+func (s *importStage) put(key string, data []byte) error {
+	if err := s.storage.Put(key, data); err != nil {
+		return err
+	}
+	if !s.staged[key] {
+		s.staged[key] = true
+		s.keys = append(s.keys, key)
+	}
+	return nil
+}
+
+// commit moves every staged file into storage, then removes the stale
+// keys that weren't themselves staged.
+func (s *importStage) commit(storage Storage) error {
+	for _, key := range s.keys {
+		if err := s.move(key); err != nil {
+			return fmt.Errorf("failed to write %s: %w", key, err)
+		}
+	}
+	for _, key := range s.stale {
+		if s.staged[key] {
+			continue
+		}
+		if err := storage.Delete(key); err != nil {
+			return fmt.Errorf("failed to remove %s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// parseShimFilename splits "{hash}.json", "{hash}.json.bundle" or
+// "{hash}.json.minisig" into the hash and its extension: ShimExtension,
+// BundleExtension or MinisigExtension.
+func parseShimFilename(name string) (hash string, ext string, ok bool) {
+	for _, ext := range []string{BundleExtension, MinisigExtension, ShimExtension} {
+		if hash, ok := strings.CutSuffix(name, ext); ok {
+			return hash, ext, hashRegex.MatchString(hash)
+		}
+	}
+	return "", "", false
+}
@@ -0,0 +1,261 @@
+package registry
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const archiveHash = "a1b2c3d4e5f6a1b2c3d4e5f6a1b2c3d4e5f6a1b2c3d4e5f6a1b2c3d4e5f6a1b2"
+
+func shimJSON(hash, name, version string) string {
+	return fmt.Sprintf(`{
+		"atip": {"version": "0.6"},
+		"binary": {"hash": "sha256:%s", "name": %q, "version": %q, "platform": "linux-amd64"},
+		"name": %q,
+		"version": %q,
+		"description": "Test tool"
+	}`, hash, name, version, name, version)
+}
+
+// buildArchive creates a gzip tarball from name -> content pairs.
+func buildArchive(t *testing.T, files map[string]string, extra ...*tar.Header) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for name, content := range files {
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content))}))
+		_, err := tw.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	for _, header := range extra {
+		require.NoError(t, tw.WriteHeader(header))
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, gz.Close())
+	return buf.Bytes()
+}
+
+func TestRegistry_ExportImport_RoundTrip(t *testing.T) {
+	srcDir := t.TempDir()
+	src, err := Load(srcDir)
+	require.NoError(t, err)
+
+	// Seed a manifest, shims, a bundle and a minisign signature
+	manifest, err := os.ReadFile("../../testdata/.well-known/atip-registry.json")
+	require.NoError(t, err)
+	require.NoError(t, os.MkdirAll(filepath.Join(srcDir, ".well-known"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, ".well-known", "atip-registry.json"), manifest, 0644))
+
+	require.NoError(t, src.AddShim("../../testdata/valid-shim.json"))
+	otherHash := "1111111111111111111111111111111111111111111111111111111111111111"
+	otherPath := filepath.Join(t.TempDir(), "jq.json")
+	require.NoError(t, os.WriteFile(otherPath, []byte(shimJSON(otherHash, "jq", "1.7.1")), 0644))
+	require.NoError(t, src.AddShim(otherPath))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, BundlePath(archiveHash)), []byte("bundle"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, MinisigPath(otherHash)), []byte("minisig"), 0644))
+
+	var buf bytes.Buffer
+	exported, err := src.Export(&buf)
+	require.NoError(t, err)
+	assert.True(t, exported.Manifest)
+	assert.Equal(t, []string{otherHash, archiveHash}, exported.Shims)
+	assert.Equal(t, []string{archiveHash}, exported.Bundles)
+	assert.Equal(t, []string{otherHash}, exported.Minisigs)
+
+	dst, err := Load(t.TempDir())
+	require.NoError(t, err)
+	imported, err := dst.Import(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, exported, imported)
+
+	srcCatalog, err := src.BuildCatalog()
+	require.NoError(t, err)
+	dstCatalog, err := dst.BuildCatalog()
+	require.NoError(t, err)
+	assert.Equal(t, srcCatalog.Tools, dstCatalog.Tools)
+	assert.Equal(t, srcCatalog.TotalShims, dstCatalog.TotalShims)
+	assert.Equal(t, srcCatalog.Platforms, dstCatalog.Platforms)
+
+	data, err := dst.Manifest()
+	require.NoError(t, err)
+	assert.Equal(t, manifest, data)
+	data, err = dst.storage.Get(BundlePath(archiveHash))
+	require.NoError(t, err)
+	assert.Equal(t, "bundle", string(data))
+	data, err = dst.storage.Get(MinisigPath(otherHash))
+	require.NoError(t, err)
+	assert.Equal(t, "minisig", string(data))
+	assert.True(t, dst.HasSignature(otherHash))
+}
+
+func TestRegistry_Import_Rejects(t *testing.T) {
+	shimName := "shims/sha256/" + archiveHash + ".json"
+
+	tests := []struct {
+		name    string
+		archive func(t *testing.T) []byte
+		err     error
+	}{
+		{
+			name: "path traversal",
+			archive: func(t *testing.T) []byte {
+				return buildArchive(t, map[string]string{"../../evil.json": "{}"})
+			},
+			err: ErrUnsafeArchive,
+		},
+		{
+			name: "absolute path",
+			archive: func(t *testing.T) []byte {
+				return buildArchive(t, map[string]string{"/etc/evil.json": "{}"})
+			},
+			err: ErrUnsafeArchive,
+		},
+		{
+			name: "unexpected file",
+			archive: func(t *testing.T) []byte {
+				return buildArchive(t, map[string]string{"shims/index.json": "{}"})
+			},
+			err: ErrUnsafeArchive,
+		},
+		{
+			name: "symlink",
+			archive: func(t *testing.T) []byte {
+				return buildArchive(t, nil, &tar.Header{Name: shimName, Typeflag: tar.TypeSymlink, Linkname: "/etc/passwd"})
+			},
+			err: ErrUnsafeArchive,
+		},
+		{
+			name: "hash mismatch",
+			archive: func(t *testing.T) []byte {
+				other := "2222222222222222222222222222222222222222222222222222222222222222"
+				return buildArchive(t, map[string]string{shimName: shimJSON(other, "curl", "8.5.0")})
+			},
+			err: ErrHashMismatch,
+		},
+		{
+			name: "invalid shim",
+			archive: func(t *testing.T) []byte {
+				return buildArchive(t, map[string]string{shimName: `{"binary": {"hash": "sha256:` + archiveHash + `"}}`})
+			},
+			err: ErrValidation,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dataDir := t.TempDir()
+			reg, err := Load(dataDir)
+			require.NoError(t, err)
+
+			_, err = reg.Import(bytes.NewReader(tt.archive(t)))
+			assert.ErrorIs(t, err, tt.err)
+
+			// Nothing escapes the data directory
+			_, statErr := os.Stat(filepath.Join(filepath.Dir(filepath.Dir(dataDir)), "evil.json"))
+			assert.True(t, os.IsNotExist(statErr))
+		})
+	}
+}
+
+func TestRegistry_Import_AllOrNothing(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, reg *Registry, store Storage) {
+		// Valid entries come first; the trailing symlink rejects the archive
+		archive := buildArchive(t, map[string]string{
+			ManifestPath:                                   `{"registry": {"name": "imported"}}`,
+			"shims/sha256/" + archiveHash + ".json":        shimJSON(archiveHash, "curl", "8.5.0"),
+			"shims/sha256/" + archiveHash + ".json.bundle": "bundle",
+		}, &tar.Header{Name: "shims/sha256/evil.json", Typeflag: tar.TypeSymlink, Linkname: "/etc/passwd"})
+
+		_, err := reg.Import(bytes.NewReader(archive))
+		require.ErrorIs(t, err, ErrUnsafeArchive)
+
+		_, err = reg.Manifest()
+		assert.ErrorIs(t, err, fs.ErrNotExist)
+		entries, err := store.List(ShimSubdir)
+		require.NoError(t, err)
+		assert.Empty(t, entries)
+		if files, ok := store.(*FileStorage); ok {
+			// Nor is the stage left behind
+			dirEntries, err := os.ReadDir(files.root)
+			require.NoError(t, err)
+			assert.Empty(t, dirEntries)
+		}
+	})
+}
+
+func TestRegistry_Import_ReplacesOtherEncoding(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, reg *Registry, store Storage) {
+		require.NoError(t, store.Put(ManifestPath, []byte(`{"storage": {"compression": "gzip"}}`)))
+		reg = New(store)
+		putShim(t, store, archiveHash, []byte(shimJSON(archiveHash, "curl", "8.5.0")))
+
+		_, err := reg.Import(bytes.NewReader(buildArchive(t, map[string]string{
+			"shims/sha256/" + archiveHash + ".json": shimJSON(archiveHash, "curl", "8.5.0"),
+		})))
+		require.NoError(t, err)
+
+		entries, err := store.List(ShimSubdir)
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+		assert.Equal(t, archiveHash+CompressedShimExtension, entries[0].Name)
+		shim, err := reg.GetShim(archiveHash)
+		require.NoError(t, err)
+		assert.Equal(t, "curl", shim.Name)
+	})
+}
+
+func TestRegistry_Import_KeepsExistingManifest(t *testing.T) {
+	dataDir := t.TempDir()
+	existing := []byte(`{"registry": {"name": "existing"}}`)
+	require.NoError(t, os.MkdirAll(filepath.Join(dataDir, ".well-known"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dataDir, ".well-known", "atip-registry.json"), existing, 0644))
+
+	reg, err := Load(dataDir)
+	require.NoError(t, err)
+
+	result, err := reg.Import(bytes.NewReader(buildArchive(t, map[string]string{
+		ManifestPath: `{"registry": {"name": "imported"}}`,
+	})))
+	require.NoError(t, err)
+	assert.False(t, result.Manifest)
+
+	data, err := os.ReadFile(filepath.Join(dataDir, ".well-known", "atip-registry.json"))
+	require.NoError(t, err)
+	assert.Equal(t, existing, data)
+}
+
+func TestRegistry_Import_MemoryStorage(t *testing.T) {
+	reg := New(NewMemoryStorage())
+
+	result, err := reg.Import(bytes.NewReader(buildArchive(t, map[string]string{
+		ManifestPath:                                    `{"registry": {"name": "imported"}}`,
+		"shims/sha256/" + archiveHash + ".json":         shimJSON(archiveHash, "curl", "8.5.0"),
+		"shims/sha256/" + archiveHash + ".json.bundle":  "bundle",
+		"shims/sha256/" + archiveHash + ".json.minisig": "minisig",
+	})))
+	require.NoError(t, err)
+	assert.True(t, result.Manifest)
+	assert.Equal(t, []string{archiveHash}, result.Shims)
+	assert.Equal(t, []string{archiveHash}, result.Bundles)
+	assert.Equal(t, []string{archiveHash}, result.Minisigs)
+
+	shim, err := reg.GetShim(archiveHash)
+	require.NoError(t, err)
+	assert.Equal(t, "curl", shim.Name)
+	assert.True(t, reg.HasSignature(archiveHash))
+
+	var buf bytes.Buffer
+	exported, err := reg.Export(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, result, exported)
+}
@@ -0,0 +1,87 @@
+package registry
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// CatalogVersion is the catalog schema version BuildCatalog writes.
+const CatalogVersion = "1"
+
+// SupportedCatalogVersions lists the catalog schema versions ParseCatalog
+// understands, oldest first.
+var SupportedCatalogVersions = []string{CatalogVersion}
+
+// ErrUnsupportedCatalogVersion is returned when a catalog declares a schema
+// version this build doesn't understand, typically one written by a newer
+// registry.
+var ErrUnsupportedCatalogVersion = errors.New("unsupported catalog version")
+
+// ParseCatalog parses catalog JSON, checking its version before decoding
+// the rest so a catalog from a newer schema is refused with a clear error
+// instead of being misread. A catalog without a version predates
+// versioning and is read as version 1. The version may be a string or a
+// number; it is returned as a string.
+//
+// Returns ErrUnsupportedCatalogVersion for versions not in
+// SupportedCatalogVersions, or ErrValidation if data is not a catalog.
+func ParseCatalog(data []byte) (*Catalog, error) {
+	var header struct {
+		Version json.RawMessage `json:"version"`
+	}
+	if err := json.Unmarshal(data, &header); err != nil {
+		return nil, fmt.Errorf("%w: invalid JSON: %v", ErrValidation, err)
+	}
+	version, err := catalogVersion(header.Version)
+	if err != nil {
+		return nil, err
+	}
+	if !supportedCatalogVersion(version) {
+		return nil, fmt.Errorf("%w %q (supported: %s); upgrade atip-registry to read this catalog",
+			ErrUnsupportedCatalogVersion, version, strings.Join(SupportedCatalogVersions, ", "))
+	}
+
+	// The version is decoded separately, since it may be a number
+	type plain Catalog
+	var catalog Catalog
+	body := struct {
+		Version json.RawMessage `json:"version"`
+		*plain
+	}{plain: (*plain)(&catalog)}
+	if err := json.Unmarshal(data, &body); err != nil {
+		return nil, fmt.Errorf("%w: invalid JSON: %v", ErrValidation, err)
+	}
+	catalog.Version = version
+	return &catalog, nil
+}
+
+// supportedCatalogVersion reports whether version is in
+// SupportedCatalogVersions.
+func supportedCatalogVersion(version string) bool {
+	for _, v := range SupportedCatalogVersions {
+		if v == version {
+			return true
+		}
+	}
+	return false
+}
+
+// catalogVersion returns the catalog version raw holds as a string,
+// CatalogVersion if it is missing or null.
+func catalogVersion(raw json.RawMessage) (string, error) {
+	if len(raw) == 0 || bytes.Equal(raw, []byte("null")) {
+		return CatalogVersion, nil
+	}
+	var version string
+	if err := json.Unmarshal(raw, &version); err == nil {
+		return version, nil
+	}
+	var number json.Number
+	if err := json.Unmarshal(raw, &number); err == nil {
+		return number.String(), nil
+	}
+	return "", fmt.Errorf("%w: catalog version must be a string or number, got %s", ErrValidation, raw)
+}
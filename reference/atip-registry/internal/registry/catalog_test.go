@@ -0,0 +1,56 @@
+package registry
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCatalog(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{name: "current", data: `{"version": "1", "tools": {"curl": {"versions": {"8.5.0": {"linux-amd64": "sha256:abc"}}}}, "totalShims": 1}`},
+		{name: "numeric", data: `{"version": 1, "tools": {"curl": {"versions": {"8.5.0": {"linux-amd64": "sha256:abc"}}}}, "totalShims": 1}`},
+		{name: "unversioned", data: `{"tools": {"curl": {"versions": {"8.5.0": {"linux-amd64": "sha256:abc"}}}}, "totalShims": 1}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			catalog, err := ParseCatalog([]byte(tt.data))
+			require.NoError(t, err)
+			assert.Equal(t, CatalogVersion, catalog.Version)
+			assert.Equal(t, 1, catalog.TotalShims)
+			assert.Equal(t, "sha256:abc", catalog.Tools["curl"].Versions["8.5.0"]["linux-amd64"])
+		})
+	}
+}
+
+func TestParseCatalog_FutureVersion(t *testing.T) {
+	// The rest of a future catalog isn't decoded, so a changed layout
+	// doesn't surface as a confusing type error
+	for _, data := range []string{
+		`{"version": "2", "tools": {"curl": {"versions": "moved"}}}`,
+		`{"version": 2, "tools": []}`,
+	} {
+		_, err := ParseCatalog([]byte(data))
+		require.ErrorIs(t, err, ErrUnsupportedCatalogVersion, data)
+		assert.Equal(t, `unsupported catalog version "2" (supported: 1); upgrade atip-registry to read this catalog`, err.Error())
+	}
+}
+
+func TestParseCatalog_Invalid(t *testing.T) {
+	for name, data := range map[string]string{
+		"not json":      `{not json`,
+		"bad version":   `{"version": {"major": 1}}`,
+		"bad tools":     `{"version": "1", "tools": []}`,
+		"not an object": `[]`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := ParseCatalog([]byte(data))
+			assert.ErrorIs(t, err, ErrValidation)
+		})
+	}
+}
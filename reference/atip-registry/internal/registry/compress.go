@@ -0,0 +1,205 @@
+package registry
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+)
+
+// Shim storage modes, recorded in the registry manifest as
+// storage.compression.
+const (
+	CompressionNone = "none" // Shims are stored as {hash}.json
+	CompressionGzip = "gzip" // Shims are stored gzip-compressed as {hash}.json.gz
+)
+
+// CompressedShimExtension is the file extension for gzip-compressed shims.
+const CompressedShimExtension = ShimExtension + ".gz"
+
+// Compressions lists the shim storage modes.
+var Compressions = []string{CompressionNone, CompressionGzip}
+
+// ManifestStorage is the storage section of the registry manifest.
+type ManifestStorage struct {
+	Compression string `json:"compression,omitempty"` // One of Compressions; none if empty
+}
+
+// compressedShimKey returns the storage key of the compressed shim with the
+// given bare hash.
+func compressedShimKey(hash string) string {
+	return path.Join(ShimSubdir, hash+CompressedShimExtension)
+}
+
+// loadCompression reads the shim storage mode from the manifest. A missing
+// or unreadable manifest means shims are stored uncompressed.
+func (r *Registry) loadCompression() {
+	var manifest struct {
+		Storage ManifestStorage `json:"storage"`
+	}
+	if data, err := r.storage.Get(ManifestPath); err == nil && json.Unmarshal(data, &manifest) == nil {
+		r.compression = manifest.Storage.Compression
+	}
+}
+
+// Compression returns the mode new shims are stored in, as recorded in the
+// manifest when the registry was opened.
+func (r *Registry) Compression() string {
+	if r.compression == "" {
+		return CompressionNone
+	}
+	return r.compression
+}
+
+// SetCompression records mode in the manifest and stores shims written from
+// now on in it. Existing shims keep their encoding until they are written
+// again; both are read, so a registry may hold a mix.
+//
+// Returns ErrValidation for an unknown mode. The error satisfies
+// errors.Is(err, fs.ErrNotExist) if the registry has no manifest.
+func (r *Registry) SetCompression(mode string) error {
+	if mode != CompressionNone && mode != CompressionGzip {
+		return fmt.Errorf("%w: compression must be one of %s, got %q", ErrValidation, strings.Join(Compressions, ", "), mode)
+	}
+
+	data, err := r.storage.Get(ManifestPath)
+	if err != nil {
+		return fmt.Errorf("failed to read manifest: %w", err)
+	}
+	var manifest map[string]json.RawMessage
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return fmt.Errorf("%w: %s: invalid JSON: %v", ErrValidation, ManifestPath, err)
+	}
+	manifest["storage"], _ = json.Marshal(ManifestStorage{Compression: mode})
+	data, _ = json.MarshalIndent(manifest, "", "  ")
+	if err := r.storage.Put(ManifestPath, data); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+
+	r.compression = mode
+	return nil
+}
+
+// putShimData stores validated shim JSON under hash in the registry's
+// storage mode, then removes the shim's copy in the other encoding, if any,
+// so each shim is stored once.
+func (r *Registry) putShimData(hash string, data []byte) error {
+	key, stale, data, err := r.encodeShim(hash, data)
+	if err != nil {
+		return err
+	}
+
+	if err := r.storage.Put(key, data); err != nil {
+		return fmt.Errorf("failed to write shim file: %w", err)
+	}
+	if err := r.storage.Delete(stale); err != nil {
+		return fmt.Errorf("failed to remove shim file: %w", err)
+	}
+	return nil
+}
+
+// encodeShim returns the storage key and contents of shim JSON with the
+// given bare hash in the registry's storage mode, and the key of the
+// shim's other encoding.
+func (r *Registry) encodeShim(hash string, data []byte) (key, stale string, encoded []byte, err error) {
+	key, stale = shimKey(hash), compressedShimKey(hash)
+	switch r.Compression() {
+	case CompressionNone:
+	case CompressionGzip:
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		gz.Write(data)
+		if err := gz.Close(); err != nil {
+			return "", "", nil, fmt.Errorf("failed to compress shim: %w", err)
+		}
+		data = buf.Bytes()
+		key, stale = stale, key
+	default:
+		return "", "", nil, fmt.Errorf("%w: unsupported shim compression %q in %s", ErrValidation, r.compression, ManifestPath)
+	}
+	return key, stale, data, nil
+}
+
+// readShimData returns the JSON of the shim with the given bare hash,
+// decompressing it if it is stored compressed. The error satisfies
+// errors.Is(err, fs.ErrNotExist) if the shim is stored in neither encoding.
+func (r *Registry) readShimData(hash string) ([]byte, error) {
+	names := []string{hash + ShimExtension, hash + CompressedShimExtension}
+	if r.Compression() == CompressionGzip {
+		// Prefer the encoding the shim was last written in
+		names[0], names[1] = names[1], names[0]
+	}
+
+	data, err := r.readShimFile(names[0])
+	if errors.Is(err, fs.ErrNotExist) {
+		data, err = r.readShimFile(names[1])
+	}
+	return data, err
+}
+
+// readShimFile returns the JSON of the shim file with the given name in
+// ShimSubdir, decompressing it if the name ends in CompressedShimExtension.
+func (r *Registry) readShimFile(name string) ([]byte, error) {
+	data, err := r.storage.Get(path.Join(ShimSubdir, name))
+	if err != nil || !strings.HasSuffix(name, CompressedShimExtension) {
+		return data, err
+	}
+	return DecompressShim(data)
+}
+
+// DecompressShim returns the JSON of a gzip-compressed shim file.
+func DecompressShim(data []byte) ([]byte, error) {
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress shim: %w", err)
+	}
+	defer gz.Close()
+
+	data, err = io.ReadAll(gz)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress shim: %w", err)
+	}
+	return data, nil
+}
+
+// shimFileHash returns the hash of the shim file with the given name,
+// {hash}.json or {hash}.json.gz, and whether name is one.
+func shimFileHash(name string) (string, bool) {
+	hash, ok := strings.CutSuffix(name, ShimExtension)
+	if !ok {
+		hash, ok = strings.CutSuffix(name, CompressedShimExtension)
+	}
+	return hash, ok && hashRegex.MatchString(hash)
+}
+
+// storedShim is a shim file in ShimSubdir.
+type storedShim struct {
+	ObjectInfo
+	Hash string
+}
+
+// listShimFiles returns the shims in ShimSubdir in filename order. A shim
+// stored in both encodings, as after an interrupted write, is listed once.
+func (r *Registry) listShimFiles() ([]storedShim, error) {
+	entries, err := r.storage.List(ShimSubdir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read shims directory: %w", err)
+	}
+
+	shims := []storedShim{}
+	seen := make(map[string]bool)
+	for _, entry := range entries {
+		hash, ok := shimFileHash(entry.Name)
+		if !ok || seen[hash] {
+			continue
+		}
+		seen[hash] = true
+		shims = append(shims, storedShim{ObjectInfo: entry, Hash: hash})
+	}
+	return shims, nil
+}
@@ -0,0 +1,168 @@
+package registry
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// putCompressedShim stores raw shim JSON gzip-compressed under hash without
+// validating it.
+func putCompressedShim(tb testing.TB, store Storage, hash string, data []byte) {
+	tb.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	_, err := gz.Write(data)
+	require.NoError(tb, err)
+	require.NoError(tb, gz.Close())
+	require.NoError(tb, store.Put(compressedShimKey(hash), buf.Bytes()))
+}
+
+func TestRegistry_Compression_RoundTrip(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, reg *Registry, store Storage) {
+		assert.Equal(t, CompressionNone, reg.Compression())
+		require.NoError(t, store.Put(ManifestPath, []byte(`{"registry": {"name": "Test"}}`)))
+		require.NoError(t, reg.SetCompression(CompressionGzip))
+
+		// The mode is recorded in the manifest, keeping the rest of it
+		data, err := reg.Manifest()
+		require.NoError(t, err)
+		assert.JSONEq(t, `{"registry": {"name": "Test"}, "storage": {"compression": "gzip"}}`, string(data))
+		assert.Equal(t, CompressionGzip, New(store).Compression())
+
+		require.NoError(t, reg.AddShim("../../testdata/valid-shim.json"))
+		_, err = store.Get(shimKey(archiveHash))
+		assert.ErrorIs(t, err, fs.ErrNotExist)
+		stored, err := store.Get(compressedShimKey(archiveHash))
+		require.NoError(t, err)
+		original, err := os.ReadFile("../../testdata/valid-shim.json")
+		require.NoError(t, err)
+		decompressed, err := DecompressShim(stored)
+		require.NoError(t, err)
+		assert.Equal(t, original, decompressed)
+
+		shim, err := reg.GetShim(archiveHash)
+		require.NoError(t, err)
+		assert.Equal(t, HashPrefix+archiveHash, shim.Binary.Hash)
+		_, err = reg.GetShimVerified(archiveHash)
+		assert.NoError(t, err)
+		require.NoError(t, reg.PutBundle(archiveHash, []byte("bundle")))
+
+		shims, err := reg.ListShims()
+		require.NoError(t, err)
+		assert.Len(t, shims, 1)
+		catalog, err := reg.BuildCatalog()
+		require.NoError(t, err)
+		assert.Equal(t, 1, catalog.TotalShims)
+		assert.Contains(t, catalog.Tools, shim.Name)
+
+		stats, err := reg.Stats()
+		require.NoError(t, err)
+		assert.Equal(t, 1, stats.Shims)
+		assert.Equal(t, 1, stats.Compressed)
+		assert.Equal(t, int64(len(stored)), stats.ShimBytes)
+		assert.Empty(t, stats.Corrupt)
+
+		// Rewriting the shim uncompressed replaces the compressed copy
+		require.NoError(t, reg.SetCompression(CompressionNone))
+		require.NoError(t, reg.PutShim(archiveHash, original))
+		_, err = store.Get(compressedShimKey(archiveHash))
+		assert.ErrorIs(t, err, fs.ErrNotExist)
+		data, err = store.Get(shimKey(archiveHash))
+		require.NoError(t, err)
+		assert.Equal(t, original, data)
+	})
+}
+
+func TestRegistry_Compression_Mixed(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, reg *Registry, store Storage) {
+		plain := "1111111111111111111111111111111111111111111111111111111111111111"
+		compressed := "2222222222222222222222222222222222222222222222222222222222222222"
+		broken := "3333333333333333333333333333333333333333333333333333333333333333"
+		putShim(t, store, plain, []byte(shimJSON(plain, "jq", "1.7.1")))
+		putCompressedShim(t, store, compressed, []byte(shimJSON(compressed, "gh", "2.45.0")))
+		require.NoError(t, store.Put(compressedShimKey(broken), []byte("not gzip")))
+
+		shims, err := reg.ListShims()
+		require.NoError(t, err)
+		require.Len(t, shims, 2)
+		assert.Equal(t, "jq", shims[0].Name)
+		assert.Equal(t, "gh", shims[1].Name)
+
+		stats, err := reg.Stats()
+		require.NoError(t, err)
+		assert.Equal(t, 2, stats.Shims)
+		assert.Equal(t, 1, stats.Compressed)
+		require.Len(t, stats.Corrupt, 1)
+		assert.Equal(t, ShimSubdir+"/"+broken+".json.gz", stats.Corrupt[0].Path)
+
+		result, err := reg.GC(GCOptions{InvalidShims: true})
+		require.NoError(t, err)
+		assert.Equal(t, []Garbage{{Kind: GarbageInvalidShim, Path: ShimSubdir + "/" + broken + ".json.gz", Size: 8}}, result.Garbage)
+
+		// Exports hold every shim uncompressed
+		require.NoError(t, store.Delete(compressedShimKey(broken)))
+		var buf bytes.Buffer
+		exported, err := reg.Export(&buf)
+		require.NoError(t, err)
+		assert.Equal(t, []string{plain, compressed}, exported.Shims)
+
+		gz, err := gzip.NewReader(&buf)
+		require.NoError(t, err)
+		tr := tar.NewReader(gz)
+		files := map[string]string{}
+		for {
+			header, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			require.NoError(t, err)
+			data, err := io.ReadAll(tr)
+			require.NoError(t, err)
+			files[header.Name] = string(data)
+		}
+		assert.Equal(t, map[string]string{
+			ShimSubdir + "/" + plain + ".json":      shimJSON(plain, "jq", "1.7.1"),
+			ShimSubdir + "/" + compressed + ".json": shimJSON(compressed, "gh", "2.45.0"),
+		}, files)
+	})
+}
+
+func TestRegistry_SetCompression_Errors(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, reg *Registry, store Storage) {
+		err := reg.SetCompression(CompressionGzip)
+		assert.ErrorIs(t, err, fs.ErrNotExist)
+
+		require.NoError(t, store.Put(ManifestPath, []byte(`{}`)))
+		assert.ErrorIs(t, reg.SetCompression("zstd"), ErrValidation)
+
+		// An unknown mode in the manifest fails writes rather than guessing
+		require.NoError(t, store.Put(ManifestPath, []byte(`{"storage": {"compression": "zstd"}}`)))
+		reg = New(store)
+		err = reg.AddShim("../../testdata/valid-shim.json")
+		assert.ErrorIs(t, err, ErrValidation)
+		assert.Contains(t, err.Error(), "zstd")
+	})
+}
+
+func TestRegistry_Compression_Load(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, ".well-known"), 0755))
+	manifest, _ := json.Marshal(map[string]interface{}{"storage": ManifestStorage{Compression: CompressionGzip}})
+	require.NoError(t, os.WriteFile(filepath.Join(dir, ".well-known", "atip-registry.json"), manifest, 0644))
+
+	reg, err := Load(dir)
+	require.NoError(t, err)
+	require.NoError(t, reg.AddShim("../../testdata/valid-shim.json"))
+	_, err = os.Stat(filepath.Join(dir, ShimPath(archiveHash)+".gz"))
+	assert.NoError(t, err)
+}
@@ -0,0 +1,21 @@
+//go:build !windows
+
+package registry
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// FreeSpace reports the free and total space of the filesystem holding dir.
+func FreeSpace(dir string) (*DiskSpace, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(dir, &st); err != nil {
+		return nil, fmt.Errorf("failed to stat filesystem of %s: %w", dir, err)
+	}
+	return &DiskSpace{
+		Path:  dir,
+		Free:  uint64(st.Bavail) * uint64(st.Bsize),
+		Total: uint64(st.Blocks) * uint64(st.Bsize),
+	}, nil
+}
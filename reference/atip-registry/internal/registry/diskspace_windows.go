@@ -0,0 +1,30 @@
+//go:build windows
+
+package registry
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+)
+
+var procGetDiskFreeSpaceExW = syscall.NewLazyDLL("kernel32.dll").NewProc("GetDiskFreeSpaceExW")
+
+// FreeSpace reports the free and total space of the volume holding dir.
+func FreeSpace(dir string) (*DiskSpace, error) {
+	p, err := syscall.UTF16PtrFromString(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat filesystem of %s: %w", dir, err)
+	}
+	var free, total, totalFree uint64
+	ok, _, err := procGetDiskFreeSpaceExW.Call(
+		uintptr(unsafe.Pointer(p)),
+		uintptr(unsafe.Pointer(&free)),
+		uintptr(unsafe.Pointer(&total)),
+		uintptr(unsafe.Pointer(&totalFree)),
+	)
+	if ok == 0 {
+		return nil, fmt.Errorf("failed to stat filesystem of %s: %w", dir, err)
+	}
+	return &DiskSpace{Path: dir, Free: free, Total: total}, nil
+}
@@ -0,0 +1,122 @@
+package registry
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Garbage kinds reported by GC.
+const (
+	GarbageOrphanSignature = "orphan_signature" // Signature whose shim is missing
+	GarbageTemp            = "temp"             // Temporary or partially written file
+	GarbageInvalidShim     = "invalid_shim"     // Shim that isn't valid JSON
+)
+
+// gcDirs are the directories GC scans for temporary files.
+var gcDirs = []string{path.Dir(ManifestPath), path.Dir(CatalogPath), ShimSubdir}
+
+// GCOptions controls what GC collects.
+type GCOptions struct {
+	InvalidShims bool // Also collect shims that aren't valid JSON
+	Delete       bool // Remove the garbage instead of only reporting it
+}
+
+// Garbage is an object GC found to be unreferenced or unusable.
+type Garbage struct {
+	Kind string `json:"kind"`
+	Path string `json:"path"` // Storage key
+	Size int64  `json:"size"`
+}
+
+// GCResult summarizes a garbage collection.
+type GCResult struct {
+	Garbage []Garbage `json:"garbage"`
+	Bytes   int64     `json:"bytes"`   // Total size of Garbage
+	Deleted bool      `json:"deleted"` // Whether Garbage was removed
+}
+
+// GC finds signatures whose shim is missing and leftover temporary files
+// (dot-files and "*.tmp", "*.partial", "*.part" or "*.part.etag" files),
+// plus shims with invalid JSON or compressed shims that don't decompress
+// if opts.InvalidShims is set, in which case their signatures count as
+// orphaned too. The garbage is sorted by path and only removed if
+// opts.Delete is set.
+func (r *Registry) GC(opts GCOptions) (*GCResult, error) {
+	result := &GCResult{Garbage: []Garbage{}}
+	add := func(kind, dir string, obj ObjectInfo) {
+		result.Garbage = append(result.Garbage, Garbage{Kind: kind, Path: path.Join(dir, obj.Name), Size: obj.Size})
+		result.Bytes += obj.Size
+	}
+
+	for _, dir := range gcDirs {
+		objects, err := r.storage.List(dir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", dir, err)
+		}
+
+		// Shims present in dir, by hash
+		shims := make(map[string]bool)
+		var signatures []ObjectInfo
+		for _, obj := range objects {
+			switch {
+			case isTempName(obj.Name):
+				add(GarbageTemp, dir, obj)
+			case dir != ShimSubdir:
+				// Only temporary files are collected outside the shim directory
+			case strings.HasSuffix(obj.Name, BundleExtension), strings.HasSuffix(obj.Name, MinisigExtension):
+				signatures = append(signatures, obj)
+			case strings.HasSuffix(obj.Name, ShimExtension), strings.HasSuffix(obj.Name, CompressedShimExtension):
+				hash := strings.TrimSuffix(strings.TrimSuffix(obj.Name, ".gz"), ShimExtension)
+				if opts.InvalidShims {
+					data, err := r.storage.Get(path.Join(dir, obj.Name))
+					if err != nil {
+						return nil, fmt.Errorf("failed to read shim: %w", err)
+					}
+					if strings.HasSuffix(obj.Name, CompressedShimExtension) {
+						data, err = DecompressShim(data)
+					}
+					if err != nil || !json.Valid(data) {
+						add(GarbageInvalidShim, dir, obj)
+						continue
+					}
+				}
+				shims[hash] = true
+			}
+		}
+
+		for _, obj := range signatures {
+			hash := strings.TrimSuffix(strings.TrimSuffix(obj.Name, BundleExtension), MinisigExtension)
+			if !shims[hash] {
+				add(GarbageOrphanSignature, dir, obj)
+			}
+		}
+	}
+
+	sort.Slice(result.Garbage, func(i, j int) bool { return result.Garbage[i].Path < result.Garbage[j].Path })
+
+	if opts.Delete {
+		for _, g := range result.Garbage {
+			if err := r.storage.Delete(g.Path); err != nil {
+				return nil, fmt.Errorf("failed to delete %s: %w", g.Path, err)
+			}
+		}
+		result.Deleted = true
+	}
+	return result, nil
+}
+
+// isTempName reports whether name looks like a temporary or partial file
+// left behind by an interrupted write, or a "*.part" file (and the
+// "*.part.etag" beside it) left by an interrupted sync download that a
+// later sync would have resumed.
+func isTempName(name string) bool {
+	for _, suffix := range []string{".tmp", ".partial", ".part", ".part.etag"} {
+		if strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+	return strings.HasPrefix(name, ".")
+}
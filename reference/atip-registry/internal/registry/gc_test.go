@@ -0,0 +1,87 @@
+package registry
+
+import (
+	"fmt"
+	"io/fs"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistry_GC(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, reg *Registry, store Storage) {
+		writeSyntheticShims(t, store, 2)
+		valid := fmt.Sprintf("%064x", 1)
+		orphan := fmt.Sprintf("%064x", 2)
+		broken := fmt.Sprintf("%064x", 3)
+
+		require.NoError(t, store.Put(BundlePath(valid), []byte("bundle")))
+		require.NoError(t, store.Put(BundlePath(orphan), []byte("orphan")))
+		require.NoError(t, store.Delete(ShimPath(orphan)))
+		putShim(t, store, broken, []byte("{not json"))
+		require.NoError(t, store.Put(MinisigPath(broken), []byte("sig")))
+		require.NoError(t, store.Put(CatalogPath+".tmp", []byte("partial")))
+
+		// By default invalid shims are left alone
+		result, err := reg.GC(GCOptions{})
+		require.NoError(t, err)
+		assert.False(t, result.Deleted)
+		assert.Equal(t, []Garbage{
+			{Kind: GarbageTemp, Path: "shims/index.json.tmp", Size: 7},
+			{Kind: GarbageOrphanSignature, Path: "shims/sha256/" + orphan + ".json.bundle", Size: 6},
+		}, result.Garbage)
+		assert.Equal(t, int64(13), result.Bytes)
+
+		// An invalid shim is collected with its signature
+		result, err = reg.GC(GCOptions{InvalidShims: true})
+		require.NoError(t, err)
+		assert.Equal(t, []Garbage{
+			{Kind: GarbageTemp, Path: "shims/index.json.tmp", Size: 7},
+			{Kind: GarbageOrphanSignature, Path: "shims/sha256/" + orphan + ".json.bundle", Size: 6},
+			{Kind: GarbageInvalidShim, Path: "shims/sha256/" + broken + ".json", Size: 9},
+			{Kind: GarbageOrphanSignature, Path: "shims/sha256/" + broken + ".json.minisig", Size: 3},
+		}, result.Garbage)
+		assert.Equal(t, int64(25), result.Bytes)
+
+		// Nothing is removed until Delete is set
+		_, err = store.Get(BundlePath(orphan))
+		require.NoError(t, err)
+
+		result, err = reg.GC(GCOptions{InvalidShims: true, Delete: true})
+		require.NoError(t, err)
+		assert.True(t, result.Deleted)
+		for _, g := range result.Garbage {
+			_, err := store.Get(g.Path)
+			assert.ErrorIs(t, err, fs.ErrNotExist, g.Path)
+		}
+		_, err = store.Get(BundlePath(valid))
+		assert.NoError(t, err)
+		_, err = reg.GetShim(valid)
+		assert.NoError(t, err)
+
+		result, err = reg.GC(GCOptions{InvalidShims: true})
+		require.NoError(t, err)
+		assert.Empty(t, result.Garbage)
+		assert.Zero(t, result.Bytes)
+	})
+}
+
+func TestIsTempName(t *testing.T) {
+	for name, want := range map[string]bool{
+		"index.json.tmp":        true,
+		"abc.json.partial":      true,
+		"abc.json.part":         true,
+		"abc.json.part.etag":    true,
+		".hidden":               true,
+		"abc.json":              false,
+		"abc.json.bundle":       false,
+		"abc.json.minisig":      false,
+		"abc.json.gz":           false,
+		"abc.json.etag":         false,
+		"abc.json.bundle.part":  true,
+		"abc.json.participants": false,
+	} {
+		assert.Equal(t, want, isTempName(name), name)
+	}
+}
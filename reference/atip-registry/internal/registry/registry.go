@@ -4,13 +4,25 @@
 package registry
 
 import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
 	"os"
+	"path"
 	"path/filepath"
 	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -27,8 +39,14 @@ const (
 	// BundleExtension is the file extension for Cosign signature bundles.
 	BundleExtension = ".json.bundle"
 
+	// MinisigExtension is the file extension for minisign signatures.
+	MinisigExtension = ".json.minisig"
+
 	// ShimSubdir is the subdirectory path for storing shims.
 	ShimSubdir = "shims/sha256"
+
+	// CatalogPath is the relative path of the persisted catalog index.
+	CatalogPath = "shims/index.json"
 )
 
 var (
@@ -43,16 +61,24 @@ var (
 
 	// ErrValidation indicates the shim failed schema or field validation.
 	ErrValidation = errors.New("validation failed")
+
+	// ErrExists indicates a shim or bundle is already stored and wasn't replaced.
+	ErrExists = errors.New("already exists")
 )
 
 // hashRegex validates SHA-256 hashes (64 lowercase hex chars).
 var hashRegex = regexp.MustCompile(`^[a-f0-9]{64}$`)
 
 // Registry manages shim storage and retrieval using a content-addressable
-// file system structure. Shims are stored as {hash}.json files organized
-// by hash prefix for efficient lookups.
+// layout. Shims are stored as {hash}.json objects, or {hash}.json.gz if the
+// manifest enables compression, organized by hash prefix for efficient
+// lookups.
 type Registry struct {
-	dataDir string
+	storage      Storage
+	reproducible bool   // Leave Catalog.Updated zero, see SetReproducibleCatalog
+	compression  string // Storage mode for new shims, see Compression
+
+	createMu sync.Mutex // Serializes CreateShim and CreateBundle
 }
 
 // Catalog represents the browsable index of all shims in the registry.
@@ -60,9 +86,10 @@ type Registry struct {
 // mapping each combination to its content-addressable hash.
 type Catalog struct {
 	Version    string              `json:"version"`     // Catalog schema version
-	Updated    time.Time           `json:"updated"`     // Last update timestamp
+	Updated    time.Time           `json:"updated"`     // Newest shim modification time (zero if empty or reproducible)
 	Tools      map[string]ToolInfo `json:"tools"`       // Tool name -> ToolInfo
 	TotalShims int                 `json:"totalShims"`  // Total number of shims
+	Platforms  []string            `json:"platforms"`   // Sorted list of all platforms seen
 }
 
 // ToolInfo describes a tool in the catalog, aggregating all available
@@ -71,6 +98,8 @@ type ToolInfo struct {
 	Description string                       `json:"description"`           // Tool description
 	Homepage    string                       `json:"homepage,omitempty"`    // Tool homepage URL
 	Versions    map[string]map[string]string `json:"versions"`              // version -> platform -> hash
+	Latest      map[string]string            `json:"latest,omitempty"`      // platform -> hash of highest semver
+	Provenance  map[string]*Provenance       `json:"provenance,omitempty"`  // hash -> provenance, for listed shims that declare it
 }
 
 // Shim represents ATIP metadata for a specific binary. It contains all
@@ -95,8 +124,46 @@ type BinaryInfo struct {
 
 // TrustInfo describes the provenance and verification status of the shim metadata.
 type TrustInfo struct {
-	Source   string `json:"source"`   // Source: "native", "community", or "inferred"
-	Verified bool   `json:"verified"` // Whether signature has been verified
+	Source     string      `json:"source"`               // Source: "native", "community", or "inferred"
+	Verified   bool        `json:"verified"`             // Whether signature has been verified
+	Provenance *Provenance `json:"provenance,omitempty"` // Build attestation, if the shim declares one
+}
+
+// Provenance points to an SLSA or in-toto attestation of how the binary
+// was built (trust.provenance in the ATIP spec). Every field is optional.
+type Provenance struct {
+	URL       string `json:"url,omitempty"`       // Attestation document
+	Format    string `json:"format,omitempty"`    // One of ProvenanceFormats
+	SLSALevel int    `json:"slsaLevel,omitempty"` // Claimed SLSA level (0-4)
+	Builder   string `json:"builder,omitempty"`   // Trusted builder identity
+}
+
+// ProvenanceFormats lists the attestation formats a shim's provenance may
+// declare.
+var ProvenanceFormats = []string{"slsa-provenance-v1", "in-toto"}
+
+// MaxSLSALevel is the highest SLSA level a provenance may claim.
+const MaxSLSALevel = 4
+
+// validate checks the provenance against the ATIP schema.
+func (p *Provenance) validate() error {
+	if p.URL != "" {
+		u, err := url.Parse(p.URL)
+		if err != nil || !u.IsAbs() {
+			return fmt.Errorf("%w: trust.provenance.url must be an absolute URL, got %q", ErrValidation, p.URL)
+		}
+	}
+	knownFormat := p.Format == ""
+	for _, format := range ProvenanceFormats {
+		knownFormat = knownFormat || p.Format == format
+	}
+	if !knownFormat {
+		return fmt.Errorf("%w: trust.provenance.format must be one of %s, got %q", ErrValidation, strings.Join(ProvenanceFormats, ", "), p.Format)
+	}
+	if p.SLSALevel < 0 || p.SLSALevel > MaxSLSALevel {
+		return fmt.Errorf("%w: trust.provenance.slsaLevel must be between 0 and %d, got %d", ErrValidation, MaxSLSALevel, p.SLSALevel)
+	}
+	return nil
 }
 
 // Load creates a Registry instance from the specified data directory.
@@ -104,6 +171,7 @@ type TrustInfo struct {
 //
 // The expected directory structure is:
 //   - {dataDir}/shims/sha256/{hash}.json - Shim files
+//   - {dataDir}/shims/sha256/{hash}.json.gz - Compressed shim files (optional)
 //   - {dataDir}/shims/sha256/{hash}.json.bundle - Signature bundles (optional)
 //
 // Returns an error if the directory doesn't exist or is inaccessible.
@@ -116,9 +184,36 @@ func Load(dataDir string) (*Registry, error) {
 		return nil, fmt.Errorf("cannot access data directory: %w", err)
 	}
 
-	return &Registry{
-		dataDir: dataDir,
-	}, nil
+	return New(NewFileStorage(dataDir)), nil
+}
+
+// New creates a Registry that keeps its files in storage, using the same
+// layout as a data directory. The shim storage mode is read from the
+// manifest, if there is one.
+func New(storage Storage) *Registry {
+	r := &Registry{storage: storage}
+	r.loadCompression()
+	return r
+}
+
+// SetReproducibleCatalog makes the catalogs the registry builds depend only
+// on the contents of its shims, by leaving Updated zero instead of setting
+// it to the newest shim modification time. Identical shims then give
+// byte-identical catalogs, and ETags, wherever and whenever they are built,
+// e.g. on a mirror whose files were copied with new modification times.
+func (r *Registry) SetReproducibleCatalog(enabled bool) {
+	r.reproducible = enabled
+}
+
+// Manifest returns the raw registry manifest (ManifestPath). The error
+// satisfies errors.Is(err, fs.ErrNotExist) if there is none.
+func (r *Registry) Manifest() ([]byte, error) {
+	return r.storage.Get(ManifestPath)
+}
+
+// shimKey returns the storage key of the shim with the given bare hash.
+func shimKey(hash string) string {
+	return path.Join(ShimSubdir, hash+ShimExtension)
 }
 
 // AddShim adds a shim to the registry by reading it from the filesystem,
@@ -129,10 +224,11 @@ func Load(dataDir string) (*Registry, error) {
 //   - Required fields are present (binary.hash, name, version)
 //   - The hash is properly formatted (64 lowercase hex characters)
 //
-// The shim is stored at: {dataDir}/shims/sha256/{hash}.json
+// The shim is stored at: shims/sha256/{hash}.json, or {hash}.json.gz with
+// gzip compression (see SetCompression)
 //
 // Returns ErrValidation if the shim is invalid, ErrInvalidHash if the hash
-// format is incorrect, or a filesystem error if the write fails.
+// format is incorrect, or a storage error if the write fails.
 func (r *Registry) AddShim(shimPath string) error {
 	// Read shim file
 	data, err := os.ReadFile(shimPath)
@@ -140,21 +236,126 @@ func (r *Registry) AddShim(shimPath string) error {
 		return fmt.Errorf("failed to read shim file: %w", err)
 	}
 
+	_, err = r.addShimData(data)
+	return err
+}
+
+// addShimData validates shim JSON and stores it under its binary hash,
+// returning the hash.
+func (r *Registry) addShimData(data []byte) (string, error) {
+	hash, err := validateShimData(data)
+	if err != nil {
+		return "", err
+	}
+
+	// Write shim to destination
+	if err := r.putShimData(hash, data); err != nil {
+		return "", err
+	}
+
+	return hash, nil
+}
+
+// PutShim validates shim JSON as AddShim does and stores it under hash,
+// which must match the shim's binary.hash.
+//
+// Returns ErrHashMismatch if it doesn't, in addition to AddShim's errors.
+func (r *Registry) PutShim(hash string, data []byte) error {
+	shimHash, err := validateShimData(data)
+	if err != nil {
+		return err
+	}
+	if err := ValidateHash(shimHash, strings.TrimPrefix(hash, HashPrefix)+ShimExtension); err != nil {
+		return err
+	}
+
+	return r.putShimData(shimHash, data)
+}
+
+// PutBundle stores a Cosign signature bundle for the shim with the given
+// hash. The bundle's contents aren't verified here; that is left to clients.
+//
+// Returns ErrInvalidHash if the hash format is incorrect or ErrNotFound if
+// there is no such shim.
+func (r *Registry) PutBundle(hash string, data []byte) error {
+	hash = strings.TrimPrefix(hash, HashPrefix)
+	if !hashRegex.MatchString(hash) {
+		return fmt.Errorf("%w: must be 64 lowercase hex characters, got %q", ErrInvalidHash, hash)
+	}
+	if _, err := r.readShimData(hash); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("%w: %s", ErrNotFound, hash)
+		}
+		return err
+	}
+
+	if err := r.storage.Put(path.Join(ShimSubdir, hash+BundleExtension), data); err != nil {
+		return fmt.Errorf("failed to write bundle: %w", err)
+	}
+	return nil
+}
+
+// CreateShim stores shim JSON as PutShim does, unless a shim is already
+// stored under hash, in either encoding.
+//
+// Returns ErrExists if one is, in addition to PutShim's errors.
+func (r *Registry) CreateShim(hash string, data []byte) error {
+	r.createMu.Lock()
+	defer r.createMu.Unlock()
+
+	hash = strings.TrimPrefix(hash, HashPrefix)
+	if hashRegex.MatchString(hash) {
+		if _, err := r.readShimData(hash); err == nil {
+			return fmt.Errorf("%w: shim %s", ErrExists, hash)
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	return r.PutShim(hash, data)
+}
+
+// CreateBundle stores a signature bundle as PutBundle does, unless the shim
+// already has one.
+//
+// Returns ErrExists if it does, in addition to PutBundle's errors.
+func (r *Registry) CreateBundle(hash string, data []byte) error {
+	r.createMu.Lock()
+	defer r.createMu.Unlock()
+
+	hash = strings.TrimPrefix(hash, HashPrefix)
+	if hashRegex.MatchString(hash) {
+		if _, err := r.storage.Get(path.Join(ShimSubdir, hash+BundleExtension)); err == nil {
+			return fmt.Errorf("%w: bundle for %s", ErrExists, hash)
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	return r.PutBundle(hash, data)
+}
+
+// validateShimData checks shim JSON has the fields every shim needs and
+// returns its bare binary hash.
+func validateShimData(data []byte) (string, error) {
 	// Parse shim
 	var shim Shim
 	if err := json.Unmarshal(data, &shim); err != nil {
-		return fmt.Errorf("%w: invalid JSON: %v", ErrValidation, err)
+		return "", fmt.Errorf("%w: invalid JSON: %v", ErrValidation, err)
 	}
 
 	// Validate required fields
 	if shim.Binary.Hash == "" {
-		return fmt.Errorf("%w: missing required field 'binary.hash'", ErrValidation)
+		return "", fmt.Errorf("%w: missing required field 'binary.hash'", ErrValidation)
 	}
 	if shim.Name == "" {
-		return fmt.Errorf("%w: missing required field 'name'", ErrValidation)
+		return "", fmt.Errorf("%w: missing required field 'name'", ErrValidation)
 	}
 	if shim.Version == "" {
-		return fmt.Errorf("%w: missing required field 'version'", ErrValidation)
+		return "", fmt.Errorf("%w: missing required field 'version'", ErrValidation)
+	}
+	if shim.Trust.Provenance != nil {
+		if err := shim.Trust.Provenance.validate(); err != nil {
+			return "", err
+		}
 	}
 
 	// Extract hash without prefix
@@ -162,22 +363,10 @@ func (r *Registry) AddShim(shimPath string) error {
 
 	// Validate hash format
 	if !hashRegex.MatchString(hash) {
-		return fmt.Errorf("%w: must be 64 lowercase hex characters, got %q", ErrInvalidHash, hash)
+		return "", fmt.Errorf("%w: must be 64 lowercase hex characters, got %q", ErrInvalidHash, hash)
 	}
 
-	// Create destination directory
-	shimDir := filepath.Join(r.dataDir, ShimSubdir)
-	if err := os.MkdirAll(shimDir, 0755); err != nil {
-		return fmt.Errorf("failed to create shim directory: %w", err)
-	}
-
-	// Write shim to destination
-	destPath := filepath.Join(shimDir, hash+ShimExtension)
-	if err := os.WriteFile(destPath, data, 0644); err != nil {
-		return fmt.Errorf("failed to write shim file: %w", err)
-	}
-
-	return nil
+	return hash, nil
 }
 
 // GetShim retrieves a shim by its SHA-256 hash.
@@ -198,10 +387,9 @@ func (r *Registry) GetShim(hash string) (*Shim, error) {
 	}
 
 	// Read shim file
-	shimPath := filepath.Join(r.dataDir, ShimSubdir, hash+ShimExtension)
-	data, err := os.ReadFile(shimPath)
+	data, err := r.readShimData(hash)
 	if err != nil {
-		if os.IsNotExist(err) {
+		if errors.Is(err, fs.ErrNotExist) {
 			return nil, fmt.Errorf("%w: no shim found for hash %s", ErrNotFound, hash)
 		}
 		return nil, fmt.Errorf("failed to read shim file: %w", err)
@@ -216,106 +404,721 @@ func (r *Registry) GetShim(hash string) (*Shim, error) {
 	return &shim, nil
 }
 
+// GetShimVerified is GetShim for a shim about to be trusted or served: it
+// also checks the file against the hash it is stored under, failing with
+// ErrHashMismatch if the file is corrupt or was swapped for another shim's.
+// See VerifyShimData.
+func (r *Registry) GetShimVerified(hash string) (*Shim, error) {
+	hash = strings.TrimPrefix(hash, HashPrefix)
+	if !hashRegex.MatchString(hash) {
+		return nil, fmt.Errorf("%w: must be 64 lowercase hex characters, got %q", ErrInvalidHash, hash)
+	}
+
+	data, err := r.readShimData(hash)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("%w: no shim found for hash %s", ErrNotFound, hash)
+		}
+		return nil, fmt.Errorf("failed to read shim file: %w", err)
+	}
+	return VerifyShimData(hash, data)
+}
+
+// VerifyShimData parses the shim stored under hash and checks that it
+// describes that binary, returning ErrHashMismatch if data isn't a shim or
+// its binary.hash differs.
+//
+// Shim files are addressed by the hash of the binary they describe rather
+// than of their own content, so this catches truncation, garbage and
+// misfiled shims, but not an edit that leaves binary.hash intact; only
+// verifying the shim's signature detects that.
+func VerifyShimData(hash string, data []byte) (*Shim, error) {
+	hash = strings.TrimPrefix(hash, HashPrefix)
+
+	var shim Shim
+	if err := json.Unmarshal(data, &shim); err != nil {
+		return nil, fmt.Errorf("%w: shim %s is not valid JSON: %v", ErrHashMismatch, hash, err)
+	}
+	if binaryHash := strings.TrimPrefix(shim.Binary.Hash, HashPrefix); binaryHash != hash {
+		return nil, fmt.Errorf("%w: shim %s describes binary %q", ErrHashMismatch, hash, shim.Binary.Hash)
+	}
+	return &shim, nil
+}
+
+// ShimProvenance is the provenance a shim declares together with the binary
+// it describes, as returned by provenance queries.
+type ShimProvenance struct {
+	Hash       string      `json:"hash"`       // Binary hash with "sha256:" prefix
+	Name       string      `json:"name"`       // Tool name
+	Version    string      `json:"version"`    // Tool version
+	Platform   string      `json:"platform"`   // Target platform
+	Provenance *Provenance `json:"provenance"` // nil if the shim declares none
+}
+
+// ProvenanceOf returns the provenance the shim declares with the binary it
+// describes.
+func ProvenanceOf(shim *Shim) *ShimProvenance {
+	return &ShimProvenance{
+		Hash:       shim.Binary.Hash,
+		Name:       shim.Name,
+		Version:    shim.Version,
+		Platform:   shim.Binary.Platform,
+		Provenance: shim.Trust.Provenance,
+	}
+}
+
+// Provenance retrieves the provenance declared by the shim with the given
+// hash. Errors are as for GetShim.
+func (r *Registry) Provenance(hash string) (*ShimProvenance, error) {
+	shim, err := r.GetShim(hash)
+	if err != nil {
+		return nil, err
+	}
+	return ProvenanceOf(shim), nil
+}
+
 // BuildCatalog generates the catalog index by scanning all shims in the registry.
 //
 // The catalog provides a browsable index organized by tool name, version, and platform.
 // Each entry maps to the content-addressable hash of the shim file.
 //
-// If the shims directory doesn't exist, an empty catalog is returned.
-// Invalid or corrupted shim files are silently skipped.
+// If there are no shims yet, an empty catalog is returned.
+// Invalid or corrupted shim files are silently skipped. Compressed shims
+// are decompressed as they are read.
+//
+// Each ToolInfo's Latest map is populated with the hash of the highest semver
+// version available for every platform; versions that are not valid semver
+// are ignored for this purpose but still listed under Versions.
+//
+// Updated is the newest shim modification time, so the catalog (and its
+// ETag) only changes when a shim does, or zero with SetReproducibleCatalog.
+// Everything else is derived from shim contents, and maps are serialized
+// with sorted keys, so the catalog's JSON is otherwise the same for the same
+// shims however it is built.
 //
-// Returns a Catalog with the current timestamp, or an error if the directory
+// Shims are parsed concurrently by up to GOMAXPROCS workers. Where shims
+// disagree (a tool's description, or two shims for the same version and
+// platform) the result matches a serial scan in filename order.
+//
+// Returns a Catalog, or an error if the directory
 // cannot be read.
 func (r *Registry) BuildCatalog() (*Catalog, error) {
+	return r.buildCatalog(runtime.GOMAXPROCS(0))
+}
+
+// buildCatalog implements BuildCatalog with the given number of workers.
+func (r *Registry) buildCatalog(workers int) (*Catalog, error) {
 	catalog := &Catalog{
-		Version: "1",
-		Updated: time.Now(),
-		Tools:   make(map[string]ToolInfo),
+		Version:   CatalogVersion,
+		Tools:     make(map[string]ToolInfo),
+		Platforms: []string{},
+	}
+
+	// List shims directory
+	entries, err := r.listShimFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	descFrom := make(map[string]string) // Tool name -> hash its description came from
+	r.readShims(entries, workers, func(i int, shim *Shim) {
+		catalog.add(shim, entries[i].Hash, entries[i].ModTime, descFrom)
+	})
+
+	platforms := make(map[string]bool)
+	for name, toolInfo := range catalog.Tools {
+		toolInfo.Latest = latestByPlatform(toolInfo.Versions)
+		catalog.Tools[name] = toolInfo
+
+		for _, byPlatform := range toolInfo.Versions {
+			for platform := range byPlatform {
+				platforms[platform] = true
+			}
+		}
+	}
+	for platform := range platforms {
+		catalog.Platforms = append(catalog.Platforms, platform)
+	}
+	sort.Strings(catalog.Platforms)
+
+	if r.reproducible {
+		catalog.Updated = time.Time{}
+	}
+
+	return catalog, nil
+}
+
+// readShims reads the shims listed in entries with up to workers
+// goroutines, calling fn with the index and contents of each, one call at a
+// time. Invalid shims are skipped.
+func (r *Registry) readShims(entries []storedShim, workers int, fn func(i int, shim *Shim)) {
+	if workers < 1 {
+		workers = 1
+	}
+
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
+	jobs := make(chan int)
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				shim, err := r.GetShim(entries[i].Hash)
+				if err != nil {
+					continue // Skip invalid shims
+				}
+
+				mu.Lock()
+				fn(i, shim)
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for i := range entries {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+// add merges one shim into the catalog. Conflicts are resolved by hash so
+// the outcome doesn't depend on the order shims are added: the lowest hash
+// supplies a tool's description and the highest wins a version/platform slot,
+// as when scanning in filename order.
+func (c *Catalog) add(shim *Shim, hash string, modTime time.Time, descFrom map[string]string) {
+	c.TotalShims++
+
+	// The catalog changes only when a shim does
+	if modTime.After(c.Updated) {
+		c.Updated = modTime
 	}
 
-	// Walk shims directory
-	shimsDir := filepath.Join(r.dataDir, ShimSubdir)
-	if _, err := os.Stat(shimsDir); os.IsNotExist(err) {
-		// No shims yet, return empty catalog
-		return catalog, nil
+	// Add to tools map
+	toolInfo, ok := c.Tools[shim.Name]
+	if !ok {
+		toolInfo = ToolInfo{
+			Versions: make(map[string]map[string]string),
+		}
+	}
+	if from, ok := descFrom[shim.Name]; !ok || hash < from {
+		toolInfo.Description = shim.Description
+		descFrom[shim.Name] = hash
 	}
 
-	entries, err := os.ReadDir(shimsDir)
+	// Add version/platform mapping
+	if toolInfo.Versions[shim.Version] == nil {
+		toolInfo.Versions[shim.Version] = make(map[string]string)
+	}
+	if existing := toolInfo.Versions[shim.Version][shim.Binary.Platform]; HashPrefix+hash > existing {
+		toolInfo.Versions[shim.Version][shim.Binary.Platform] = HashPrefix + hash
+
+		// Provenance follows the shim that holds the slot
+		delete(toolInfo.Provenance, existing)
+		if shim.Trust.Provenance != nil {
+			if toolInfo.Provenance == nil {
+				toolInfo.Provenance = make(map[string]*Provenance)
+			}
+			toolInfo.Provenance[HashPrefix+hash] = shim.Trust.Provenance
+		}
+	}
+
+	c.Tools[shim.Name] = toolInfo
+}
+
+// WriteCatalog writes the catalog to w as JSON, the same bytes as
+// json.Marshal of BuildCatalog's result, without building it in memory.
+//
+// The catalog lists tools in name order, after the newest shim's time, so
+// shims are read twice: first to index them by tool and find the time,
+// shim count and platforms, then a tool at a time, each tool encoded to w
+// as soon as its shims are read. After the first read only the binary hash
+// of each shim and one tool are held, a fraction of the built catalog. A
+// shim added or removed between the two reads may be counted without
+// being listed, or the reverse.
+func (r *Registry) WriteCatalog(w io.Writer) error {
+	return r.writeCatalog(w, runtime.GOMAXPROCS(0))
+}
+
+// writeCatalog implements WriteCatalog with the given number of workers.
+func (r *Registry) writeCatalog(w io.Writer, workers int) error {
+	entries, err := r.listShimFiles()
 	if err != nil {
-		return nil, fmt.Errorf("failed to read shims directory: %w", err)
+		return err
 	}
 
-	for _, entry := range entries {
-		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ShimExtension) {
+	header := &Catalog{Version: CatalogVersion, Platforms: []string{}}
+	byTool := make(map[string][][sha256.Size]byte) // Tool name -> hashes of its shims
+	platforms := make(map[string]bool)
+	r.readShims(entries, workers, func(i int, shim *Shim) {
+		header.TotalShims++
+		if entries[i].ModTime.After(header.Updated) {
+			header.Updated = entries[i].ModTime
+		}
+		var hash [sha256.Size]byte
+		hex.Decode(hash[:], []byte(entries[i].Hash))
+		byTool[shim.Name] = append(byTool[shim.Name], hash)
+		platforms[shim.Binary.Platform] = true
+	})
+	entries = nil // Only the index is needed from here on
+	for platform := range platforms {
+		header.Platforms = append(header.Platforms, platform)
+	}
+	sort.Strings(header.Platforms)
+	if r.reproducible {
+		header.Updated = time.Time{}
+	}
+
+	names := make([]string, 0, len(byTool))
+	for name := range byTool {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	cw := newCatalogWriter(w, header)
+	for _, name := range names {
+		toolEntries := make([]storedShim, len(byTool[name]))
+		for j, hash := range byTool[name] {
+			toolEntries[j].Hash = hex.EncodeToString(hash[:])
+		}
+		delete(byTool, name)
+
+		tool := &Catalog{Tools: make(map[string]ToolInfo)}
+		descFrom := make(map[string]string)
+		r.readShims(toolEntries, workers, func(j int, shim *Shim) {
+			if shim.Name == name {
+				tool.add(shim, toolEntries[j].Hash, toolEntries[j].ModTime, descFrom)
+			}
+		})
+		if toolInfo, ok := tool.Tools[name]; ok {
+			toolInfo.Latest = latestByPlatform(toolInfo.Versions)
+			cw.tool(name, toolInfo)
+		}
+	}
+	return cw.close(header)
+}
+
+// encodeCatalog writes a built catalog to w as WriteCatalog does, encoding
+// one tool at a time instead of marshaling the whole catalog at once.
+func encodeCatalog(w io.Writer, catalog *Catalog) error {
+	names := make([]string, 0, len(catalog.Tools))
+	for name := range catalog.Tools {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	cw := newCatalogWriter(w, catalog)
+	for _, name := range names {
+		cw.tool(name, catalog.Tools[name])
+	}
+	return cw.close(catalog)
+}
+
+// catalogWriter encodes a catalog's JSON a tool at a time, with the fields
+// in the order json.Marshal writes them. The first error is kept and
+// returned by close.
+type catalogWriter struct {
+	bw    *bufio.Writer
+	tools int // Tools written so far
+	err   error
+}
+
+// newCatalogWriter starts the catalog on w with header's Version and Updated.
+func newCatalogWriter(w io.Writer, header *Catalog) *catalogWriter {
+	cw := &catalogWriter{bw: bufio.NewWriter(w)}
+	cw.write(`{"version":`, header.Version)
+	cw.write(`,"updated":`, header.Updated)
+	cw.bw.WriteString(`,"tools":{`)
+	return cw
+}
+
+// write writes prefix and the JSON encoding of v.
+func (cw *catalogWriter) write(prefix string, v interface{}) {
+	if cw.err != nil {
+		return
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		cw.err = err
+		return
+	}
+	cw.bw.WriteString(prefix)
+	_, cw.err = cw.bw.Write(data)
+}
+
+// tool writes the next tool. Tools must be written in name order.
+func (cw *catalogWriter) tool(name string, info ToolInfo) {
+	prefix := ""
+	if cw.tools > 0 {
+		prefix = ","
+	}
+	cw.tools++
+	cw.write(prefix, name)
+	cw.write(":", info)
+}
+
+// close ends the catalog with footer's TotalShims and Platforms and
+// flushes it.
+func (cw *catalogWriter) close(footer *Catalog) error {
+	cw.bw.WriteString("}")
+	cw.write(`,"totalShims":`, footer.TotalShims)
+	cw.write(`,"platforms":`, footer.Platforms)
+	cw.bw.WriteString("}")
+	if cw.err != nil {
+		return cw.err
+	}
+	return cw.bw.Flush()
+}
+
+// SaveCatalog builds the catalog and persists it at CatalogPath.
+func (r *Registry) SaveCatalog() (*Catalog, error) {
+	catalog, err := r.BuildCatalog()
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := encodeCatalog(&buf, catalog); err != nil {
+		return nil, err
+	}
+	if err := r.storage.Put(CatalogPath, buf.Bytes()); err != nil {
+		return nil, fmt.Errorf("failed to write catalog: %w", err)
+	}
+	return catalog, nil
+}
+
+// Discrepancy kinds reported by VerifyCatalog.
+const (
+	DiscrepancyMissing      = "missing"       // Shim exists but isn't in the index
+	DiscrepancyExtra        = "extra"         // Indexed but no such shim exists
+	DiscrepancyHashMismatch = "hash_mismatch" // Indexed under a different hash
+)
+
+// Discrepancy is a tool version/platform on which the persisted catalog
+// index and the shims disagree.
+type Discrepancy struct {
+	Kind     string `json:"kind"`
+	Tool     string `json:"tool"`
+	Version  string `json:"version"`
+	Platform string `json:"platform"`
+	Expected string `json:"expected,omitempty"` // Hash from the shims
+	Actual   string `json:"actual,omitempty"`   // Hash in the index
+}
+
+// VerifyCatalog rebuilds the catalog and compares it with the index
+// persisted at CatalogPath, returning the discrepancies sorted by tool,
+// version and platform. An index that matches the shims yields none.
+//
+// The error satisfies errors.Is(err, fs.ErrNotExist) if no index has been
+// saved, or ErrValidation if it isn't valid JSON.
+func (r *Registry) VerifyCatalog() ([]Discrepancy, error) {
+	discrepancies, _, err := r.compareCatalog()
+	return discrepancies, err
+}
+
+// compareCatalog implements VerifyCatalog, also returning the catalog built
+// from the shims.
+func (r *Registry) compareCatalog() ([]Discrepancy, *Catalog, error) {
+	data, err := r.storage.Get(CatalogPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read catalog: %w", err)
+	}
+	persisted, err := ParseCatalog(data)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", CatalogPath, err)
+	}
+
+	built, err := r.BuildCatalog()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	discrepancies := []Discrepancy{}
+	for name, tool := range built.Tools {
+		for version, byPlatform := range tool.Versions {
+			for platform, hash := range byPlatform {
+				indexed, ok := persisted.Tools[name].Versions[version][platform]
+				switch {
+				case !ok:
+					discrepancies = append(discrepancies, Discrepancy{
+						Kind: DiscrepancyMissing, Tool: name, Version: version, Platform: platform,
+						Expected: hash,
+					})
+				case indexed != hash:
+					discrepancies = append(discrepancies, Discrepancy{
+						Kind: DiscrepancyHashMismatch, Tool: name, Version: version, Platform: platform,
+						Expected: hash, Actual: indexed,
+					})
+				}
+			}
+		}
+	}
+	for name, tool := range persisted.Tools {
+		for version, byPlatform := range tool.Versions {
+			for platform, indexed := range byPlatform {
+				if _, ok := built.Tools[name].Versions[version][platform]; !ok {
+					discrepancies = append(discrepancies, Discrepancy{
+						Kind: DiscrepancyExtra, Tool: name, Version: version, Platform: platform,
+						Actual: indexed,
+					})
+				}
+			}
+		}
+	}
+
+	sort.Slice(discrepancies, func(i, j int) bool {
+		a, b := discrepancies[i], discrepancies[j]
+		if a.Tool != b.Tool {
+			return a.Tool < b.Tool
+		}
+		if a.Version != b.Version {
+			return a.Version < b.Version
+		}
+		return a.Platform < b.Platform
+	})
+	return discrepancies, built, nil
+}
+
+// PruneResult summarizes a catalog prune.
+type PruneResult struct {
+	Removed      []Discrepancy `json:"removed"`       // Index entries whose shim no longer exists
+	RemovedTools []string      `json:"removed_tools"` // Tools left with no versions
+	Repaired     []Discrepancy `json:"repaired"`      // Missing and mismatched entries a rewrite also corrects
+	Written      bool          `json:"written"`       // Whether the index was rewritten
+}
+
+// PruneCatalog finds the entries of the index persisted at CatalogPath whose
+// shim no longer exists, sorted as by VerifyCatalog, and the tools that have
+// no versions left without them. The index is only rewritten if write is
+// set, and then from the shims, so the rewrite also adds shims missing from
+// it and corrects mismatched hashes; those discrepancies are reported as
+// Repaired. Errors are as for VerifyCatalog.
+func (r *Registry) PruneCatalog(write bool) (*PruneResult, error) {
+	discrepancies, built, err := r.compareCatalog()
+	if err != nil {
+		return nil, err
+	}
+
+	result := &PruneResult{Removed: []Discrepancy{}, RemovedTools: []string{}, Repaired: []Discrepancy{}}
+	for _, d := range discrepancies {
+		if d.Kind != DiscrepancyExtra {
+			result.Repaired = append(result.Repaired, d)
 			continue
 		}
+		result.Removed = append(result.Removed, d)
+		// Discrepancies are sorted by tool, so each tool is seen in one run
+		n := len(result.RemovedTools)
+		if _, ok := built.Tools[d.Tool]; !ok && (n == 0 || result.RemovedTools[n-1] != d.Tool) {
+			result.RemovedTools = append(result.RemovedTools, d.Tool)
+		}
+	}
+
+	if write {
+		if _, err := r.SaveCatalog(); err != nil {
+			return nil, err
+		}
+		result.Written = true
+	}
+	return result, nil
+}
+
+// latestByPlatform returns a platform -> hash map selecting, for each platform,
+// the hash of the highest semver version that provides it. Versions of equal
+// precedence ("1.0.0" and "v1.0.0", or differing build metadata) are ordered by
+// their raw string so the choice does not depend on map iteration. Versions that
+// cannot be parsed as semver are skipped. Returns nil if no version is parseable.
+func latestByPlatform(versions map[string]map[string]string) map[string]string {
+	var latest map[string]string
+	best := make(map[string]semver)
+	bestVersion := make(map[string]string)
 
-		// Skip bundle files
-		if strings.HasSuffix(entry.Name(), BundleExtension) {
+	for version, byPlatform := range versions {
+		v, ok := parseSemver(version)
+		if !ok {
 			continue
 		}
+		for platform, hash := range byPlatform {
+			current, seen := best[platform]
+			if seen {
+				cmp := compareSemver(v, current)
+				if cmp < 0 || (cmp == 0 && version <= bestVersion[platform]) {
+					continue
+				}
+			}
+			if latest == nil {
+				latest = make(map[string]string)
+			}
+			best[platform] = v
+			bestVersion[platform] = version
+			latest[platform] = hash
+		}
+	}
+
+	return latest
+}
+
+// semver is a parsed semantic version (https://semver.org).
+// Build metadata is discarded since it does not affect precedence.
+type semver struct {
+	major, minor, patch uint64
+	prerelease          []string
+}
+
+// parseSemver parses a MAJOR.MINOR.PATCH[-PRERELEASE][+BUILD] version string.
+// A leading "v" is tolerated. Returns false if the string is not valid semver.
+func parseSemver(version string) (semver, bool) {
+	version = strings.TrimPrefix(version, "v")
+
+	if i := strings.IndexByte(version, '+'); i >= 0 {
+		if !validIdentifiers(version[i+1:], false) {
+			return semver{}, false
+		}
+		version = version[:i]
+	}
+
+	var prerelease []string
+	if i := strings.IndexByte(version, '-'); i >= 0 {
+		if !validIdentifiers(version[i+1:], true) {
+			return semver{}, false
+		}
+		prerelease = strings.Split(version[i+1:], ".")
+		version = version[:i]
+	}
 
-		// Read shim
-		hash := strings.TrimSuffix(entry.Name(), ShimExtension)
-		shim, err := r.GetShim(hash)
+	parts := strings.Split(version, ".")
+	if len(parts) != 3 {
+		return semver{}, false
+	}
+
+	var nums [3]uint64
+	for i, part := range parts {
+		if !isNumeric(part) || (len(part) > 1 && part[0] == '0') {
+			return semver{}, false
+		}
+		n, err := strconv.ParseUint(part, 10, 64)
 		if err != nil {
-			continue // Skip invalid shims
+			return semver{}, false
 		}
+		nums[i] = n
+	}
 
-		catalog.TotalShims++
+	return semver{major: nums[0], minor: nums[1], patch: nums[2], prerelease: prerelease}, true
+}
 
-		// Add to tools map
-		toolInfo, ok := catalog.Tools[shim.Name]
-		if !ok {
-			toolInfo = ToolInfo{
-				Description: shim.Description,
-				Versions:    make(map[string]map[string]string),
+// validIdentifiers reports whether s is a non-empty, dot-separated list of
+// [0-9A-Za-z-] identifiers. When noLeadingZeros is set, numeric identifiers
+// must not have leading zeros (as required for pre-release identifiers).
+func validIdentifiers(s string, noLeadingZeros bool) bool {
+	if s == "" {
+		return false
+	}
+	for _, id := range strings.Split(s, ".") {
+		if id == "" {
+			return false
+		}
+		for _, c := range id {
+			if !(c >= '0' && c <= '9') && !(c >= 'a' && c <= 'z') && !(c >= 'A' && c <= 'Z') && c != '-' {
+				return false
 			}
 		}
+		if noLeadingZeros && isNumeric(id) && len(id) > 1 && id[0] == '0' {
+			return false
+		}
+	}
+	return true
+}
 
-		// Add version/platform mapping
-		if toolInfo.Versions[shim.Version] == nil {
-			toolInfo.Versions[shim.Version] = make(map[string]string)
+// isNumeric reports whether s is a non-empty string of ASCII digits.
+func isNumeric(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
 		}
-		toolInfo.Versions[shim.Version][shim.Binary.Platform] = HashPrefix + hash
+	}
+	return true
+}
 
-		catalog.Tools[shim.Name] = toolInfo
+// compareSemver returns -1, 0, or 1 according to semver precedence rules.
+// A version without a pre-release has higher precedence than one with.
+func compareSemver(a, b semver) int {
+	if c := compareUint(a.major, b.major); c != 0 {
+		return c
+	}
+	if c := compareUint(a.minor, b.minor); c != 0 {
+		return c
+	}
+	if c := compareUint(a.patch, b.patch); c != 0 {
+		return c
 	}
 
-	return catalog, nil
+	switch {
+	case len(a.prerelease) == 0 && len(b.prerelease) == 0:
+		return 0
+	case len(a.prerelease) == 0:
+		return 1
+	case len(b.prerelease) == 0:
+		return -1
+	}
+
+	for i := 0; i < len(a.prerelease) && i < len(b.prerelease); i++ {
+		x, y := a.prerelease[i], b.prerelease[i]
+		xNum, yNum := isNumeric(x), isNumeric(y)
+
+		switch {
+		case xNum && yNum:
+			xn, _ := strconv.ParseUint(x, 10, 64)
+			yn, _ := strconv.ParseUint(y, 10, 64)
+			if c := compareUint(xn, yn); c != 0 {
+				return c
+			}
+		case xNum:
+			return -1 // Numeric identifiers sort before alphanumeric ones
+		case yNum:
+			return 1
+		default:
+			if c := strings.Compare(x, y); c != 0 {
+				return c
+			}
+		}
+	}
+
+	return compareUint(uint64(len(a.prerelease)), uint64(len(b.prerelease)))
+}
+
+// compareUint returns -1, 0, or 1 comparing a and b.
+func compareUint(a, b uint64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
 }
 
 // ListShims returns all shims in the registry.
 //
-// Invalid or corrupted shim files are silently skipped.
-// If the shims directory doesn't exist, an empty slice is returned.
+// Invalid or corrupted shim files are silently skipped, and compressed
+// ones decompressed. If there are no shims yet, an empty slice is returned.
 //
 // Returns a slice of Shim pointers, or an error if the directory cannot be read.
 func (r *Registry) ListShims() ([]*Shim, error) {
 	var shims []*Shim
 
-	shimsDir := filepath.Join(r.dataDir, ShimSubdir)
-	if _, err := os.Stat(shimsDir); os.IsNotExist(err) {
-		return shims, nil
-	}
-
-	entries, err := os.ReadDir(shimsDir)
+	entries, err := r.listShimFiles()
 	if err != nil {
-		return nil, fmt.Errorf("failed to read shims directory: %w", err)
+		return nil, err
 	}
 
 	for _, entry := range entries {
-		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ShimExtension) {
-			continue
-		}
-
-		// Skip bundle files
-		if strings.HasSuffix(entry.Name(), BundleExtension) {
-			continue
-		}
-
-		hash := strings.TrimSuffix(entry.Name(), ShimExtension)
-		shim, err := r.GetShim(hash)
+		shim, err := r.GetShim(entry.Hash)
 		if err != nil {
 			continue
 		}
@@ -326,6 +1129,22 @@ func (r *Registry) ListShims() ([]*Shim, error) {
 	return shims, nil
 }
 
+// ShimHashes returns the hashes of the shims in the registry, taken from
+// their filenames, in order. Unlike ListShims it reads no shim, so a
+// corrupt or misfiled shim is listed under the name it is stored as.
+func (r *Registry) ShimHashes() ([]string, error) {
+	entries, err := r.listShimFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	hashes := make([]string, len(entries))
+	for i, entry := range entries {
+		hashes[i] = entry.Hash
+	}
+	return hashes, nil
+}
+
 // ValidateHash validates that a hash has the correct format and matches the filename.
 //
 // The hash parameter can include the "sha256:" prefix, which will be stripped for validation.
@@ -370,3 +1189,23 @@ func ShimPath(hash string) string {
 func BundlePath(hash string) string {
 	return ShimPath(hash) + ".bundle"
 }
+
+// MinisigPath returns the relative path for a minisign signature given its hash.
+//
+// The hash parameter can include the "sha256:" prefix, which will be stripped.
+// Returns a path in the format: shims/sha256/{hash}.json.minisig
+func MinisigPath(hash string) string {
+	return ShimPath(hash) + ".minisig"
+}
+
+// HasSignature reports whether a Cosign bundle or minisign signature exists
+// for the shim with the given hash. The hash can include the "sha256:" prefix.
+func (r *Registry) HasSignature(hash string) bool {
+	hash = strings.TrimPrefix(hash, HashPrefix)
+	for _, ext := range []string{BundleExtension, MinisigExtension} {
+		if _, err := r.storage.Get(path.Join(ShimSubdir, hash+ext)); err == nil {
+			return true
+		}
+	}
+	return false
+}
@@ -1,14 +1,49 @@
 package registry
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"math"
 	"os"
 	"path/filepath"
+	"runtime"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
+// storageBackends lists every Storage implementation, so the registry tests
+// run against each of them.
+var storageBackends = []struct {
+	name string
+	new  func(tb testing.TB) Storage
+}{
+	{name: "filesystem", new: func(tb testing.TB) Storage { return NewFileStorage(tb.TempDir()) }},
+	{name: "memory", new: func(testing.TB) Storage { return NewMemoryStorage() }},
+}
+
+// forEachStorage runs test against an empty registry on every backend.
+func forEachStorage(t *testing.T, test func(t *testing.T, reg *Registry, store Storage)) {
+	for _, backend := range storageBackends {
+		t.Run(backend.name, func(t *testing.T) {
+			store := backend.new(t)
+			test(t, New(store), store)
+		})
+	}
+}
+
+// putShim stores raw shim JSON under hash without validating it.
+func putShim(tb testing.TB, store Storage, hash string, data []byte) {
+	tb.Helper()
+	require.NoError(tb, store.Put(shimKey(hash), data))
+}
+
 func TestRegistry_Load(t *testing.T) {
 	tests := []struct {
 		name        string
@@ -46,12 +81,10 @@ func TestRegistry_Load(t *testing.T) {
 }
 
 func TestRegistry_AddShim(t *testing.T) {
-	// Create temporary directory for test
-	tmpDir := t.TempDir()
-
-	reg, err := Load(tmpDir)
-	require.NoError(t, err)
+	forEachStorage(t, testRegistryAddShim)
+}
 
+func testRegistryAddShim(t *testing.T, reg *Registry, store Storage) {
 	tests := []struct {
 		name        string
 		shimPath    string
@@ -87,7 +120,8 @@ func TestRegistry_AddShim(t *testing.T) {
 				}
 			} else {
 				assert.NoError(t, err)
-				// Will fail until implementation exists
+				_, err := store.Get(shimKey("a1b2c3d4e5f6a1b2c3d4e5f6a1b2c3d4e5f6a1b2c3d4e5f6a1b2c3d4e5f6a1b2"))
+				assert.NoError(t, err)
 			}
 		})
 	}
@@ -140,20 +174,15 @@ func TestRegistry_ValidateHash(t *testing.T) {
 }
 
 func TestRegistry_GetShim(t *testing.T) {
-	tmpDir := t.TempDir()
-
-	// Copy test shim to temp directory
-	shimsDir := filepath.Join(tmpDir, "shims", "sha256")
-	require.NoError(t, os.MkdirAll(shimsDir, 0755))
+	forEachStorage(t, testRegistryGetShim)
+}
 
+func testRegistryGetShim(t *testing.T, reg *Registry, store Storage) {
+	// Copy test shim into storage
 	validHash := "a1b2c3d4e5f6a1b2c3d4e5f6a1b2c3d4e5f6a1b2c3d4e5f6a1b2c3d4e5f6a1b2"
 	srcData, err := os.ReadFile("../../testdata/valid-shim.json")
 	require.NoError(t, err)
-	dstPath := filepath.Join(shimsDir, validHash+".json")
-	require.NoError(t, os.WriteFile(dstPath, srcData, 0644))
-
-	reg, err := Load(tmpDir)
-	require.NoError(t, err)
+	putShim(t, store, validHash, srcData)
 
 	tests := []struct {
 		name        string
@@ -179,9 +208,8 @@ func TestRegistry_GetShim(t *testing.T) {
 			if tt.expectFound {
 				assert.NoError(t, err)
 				assert.NotNil(t, shim)
-				// Will fail until implementation exists
 			} else {
-				assert.Error(t, err)
+				assert.ErrorIs(t, err, ErrNotFound)
 				assert.Nil(t, shim)
 			}
 		})
@@ -189,20 +217,15 @@ func TestRegistry_GetShim(t *testing.T) {
 }
 
 func TestRegistry_BuildCatalog(t *testing.T) {
-	tmpDir := t.TempDir()
+	forEachStorage(t, testRegistryBuildCatalog)
+}
 
+func testRegistryBuildCatalog(t *testing.T, reg *Registry, store Storage) {
 	// Setup test shims
-	shimsDir := filepath.Join(tmpDir, "shims", "sha256")
-	require.NoError(t, os.MkdirAll(shimsDir, 0755))
-
 	validHash := "a1b2c3d4e5f6a1b2c3d4e5f6a1b2c3d4e5f6a1b2c3d4e5f6a1b2c3d4e5f6a1b2"
 	srcData, err := os.ReadFile("../../testdata/valid-shim.json")
 	require.NoError(t, err)
-	dstPath := filepath.Join(shimsDir, validHash+".json")
-	require.NoError(t, os.WriteFile(dstPath, srcData, 0644))
-
-	reg, err := Load(tmpDir)
-	require.NoError(t, err)
+	putShim(t, store, validHash, srcData)
 
 	catalog, err := reg.BuildCatalog()
 	assert.NoError(t, err)
@@ -214,25 +237,555 @@ func TestRegistry_BuildCatalog(t *testing.T) {
 	// assert.Contains(t, catalog.Tools, "curl")
 }
 
+func TestRegistry_BuildCatalog_Latest(t *testing.T) {
+	forEachStorage(t, testRegistryBuildCatalogLatest)
+}
+
+func testRegistryBuildCatalogLatest(t *testing.T, reg *Registry, store Storage) {
+	shims := []struct {
+		hash     string
+		version  string
+		platform string
+	}{
+		{hash: "1111111111111111111111111111111111111111111111111111111111111111", version: "1.9.0", platform: "linux-amd64"},
+		{hash: "2222222222222222222222222222222222222222222222222222222222222222", version: "1.10.0", platform: "linux-amd64"},
+		{hash: "3333333333333333333333333333333333333333333333333333333333333333", version: "2.0.0-rc.1", platform: "linux-amd64"},
+		{hash: "4444444444444444444444444444444444444444444444444444444444444444", version: "1.10.0", platform: "darwin-arm64"},
+		{hash: "5555555555555555555555555555555555555555555555555555555555555555", version: "1.10.1+build.7", platform: "darwin-arm64"},
+		{hash: "6666666666666666666666666666666666666666666666666666666666666666", version: "nightly", platform: "darwin-arm64"},
+	}
+
+	for _, s := range shims {
+		data := fmt.Sprintf(`{
+			"atip": {"version": "0.6"},
+			"binary": {"hash": "sha256:%s", "name": "curl", "version": %q, "platform": %q},
+			"name": "curl",
+			"version": %q,
+			"description": "Transfer data from or to a server",
+			"trust": {"source": "community", "verified": false},
+			"commands": {}
+		}`, s.hash, s.version, s.platform, s.version)
+		putShim(t, store, s.hash, []byte(data))
+	}
+
+	catalog, err := reg.BuildCatalog()
+	require.NoError(t, err)
+
+	require.Contains(t, catalog.Tools, "curl")
+	curl := catalog.Tools["curl"]
+	assert.Len(t, curl.Versions, 5)
+
+	// 2.0.0-rc.1 outranks 1.10.0, which outranks 1.9.0 numerically
+	assert.Equal(t, "sha256:"+shims[2].hash, curl.Latest["linux-amd64"])
+	// Build metadata is permitted, "nightly" is skipped as unparseable
+	assert.Equal(t, "sha256:"+shims[4].hash, curl.Latest["darwin-arm64"])
+
+	assert.Equal(t, []string{"darwin-arm64", "linux-amd64"}, catalog.Platforms)
+}
+
+// writeSyntheticShims writes n small shims spread over tools and platforms.
+func writeSyntheticShims(tb testing.TB, store Storage, n int) {
+	tb.Helper()
+
+	platforms := []string{"linux-amd64", "linux-arm64", "darwin-arm64", "windows-amd64"}
+	for i := 0; i < n; i++ {
+		hash := fmt.Sprintf("%064x", i+1)
+		platform := platforms[i%len(platforms)]
+		version := fmt.Sprintf("1.%d.0", i/len(platforms)%10)
+		data := fmt.Sprintf(`{
+			"atip": {"version": "0.6"},
+			"binary": {"hash": "sha256:%s", "name": "tool%d", "version": %q, "platform": %q},
+			"name": "tool%d",
+			"version": %q,
+			"description": "Tool %d",
+			"commands": {}
+		}`, hash, i/40, version, platform, i/40, version, i)
+		putShim(tb, store, hash, []byte(data))
+	}
+}
+
+func TestRegistry_BuildCatalog_Concurrent(t *testing.T) {
+	forEachStorage(t, testRegistryBuildCatalogConcurrent)
+}
+
+func testRegistryBuildCatalogConcurrent(t *testing.T, reg *Registry, store Storage) {
+	writeSyntheticShims(t, store, 200)
+
+	// Same version and platform as shim 1, so the slot is contested
+	duplicate := strings.Repeat("f", 64)
+	putShim(t, store, duplicate, []byte(`{
+		"binary": {"hash": "sha256:`+duplicate+`", "platform": "linux-amd64"},
+		"name": "tool0",
+		"version": "1.0.0",
+		"description": "Rebuilt"
+	}`))
+
+	serial, err := reg.buildCatalog(1)
+	require.NoError(t, err)
+	assert.Equal(t, 201, serial.TotalShims)
+	assert.Len(t, serial.Tools, 5)
+
+	// Lowest hash supplies the description, highest wins the slot
+	assert.Equal(t, "Tool 0", serial.Tools["tool0"].Description)
+	assert.Equal(t, "sha256:"+duplicate, serial.Tools["tool0"].Versions["1.0.0"]["linux-amd64"])
+
+	for _, workers := range []int{2, 8, 64} {
+		parallel, err := reg.buildCatalog(workers)
+		require.NoError(t, err)
+		assert.Equal(t, serial, parallel, "workers=%d", workers)
+	}
+}
+
+func TestRegistry_WriteCatalog(t *testing.T) {
+	tests := []struct {
+		name      string
+		shims     int
+		contested bool // Add a shim for the same version and platform as shim 1
+	}{
+		{name: "empty registry", shims: 0},
+		{name: "populated registry", shims: 50},
+		{name: "contested slot", shims: 50, contested: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			forEachStorage(t, func(t *testing.T, reg *Registry, store Storage) {
+				writeSyntheticShims(t, store, tt.shims)
+				if tt.contested {
+					duplicate := strings.Repeat("f", 64)
+					putShim(t, store, duplicate, []byte(`{
+						"binary": {"hash": "sha256:`+duplicate+`", "platform": "linux-amd64"},
+						"name": "tool0", "version": "1.0.0", "description": "Duplicate",
+						"trust": {"provenance": {"url": "https://example.com/p.json", "format": "slsa-provenance-v1"}}
+					}`))
+				}
+
+				catalog, err := reg.BuildCatalog()
+				require.NoError(t, err)
+				expected, err := json.Marshal(catalog)
+				require.NoError(t, err)
+
+				for _, workers := range []int{1, 4} {
+					var buf bytes.Buffer
+					require.NoError(t, reg.writeCatalog(&buf, workers))
+					assert.Equal(t, string(expected), buf.String(), "workers=%d", workers)
+				}
+			})
+		})
+	}
+}
+
+func TestRegistry_ReproducibleCatalog(t *testing.T) {
+	// Two copies of the same shims, one with every file a day older
+	copies := make([]*Registry, 2)
+	for i := range copies {
+		dir := t.TempDir()
+		store := NewFileStorage(dir)
+		writeSyntheticShims(t, store, 50)
+		if i == 1 {
+			old := time.Now().Add(-24 * time.Hour)
+			entries, err := store.List(ShimSubdir)
+			require.NoError(t, err)
+			for _, entry := range entries {
+				name := filepath.Join(dir, filepath.FromSlash(ShimSubdir), entry.Name)
+				require.NoError(t, os.Chtimes(name, old, old))
+			}
+		}
+		copies[i] = New(store)
+	}
+
+	write := func(reg *Registry) string {
+		var buf bytes.Buffer
+		require.NoError(t, reg.WriteCatalog(&buf))
+		return buf.String()
+	}
+
+	// By default the copies' catalogs differ only in when they were updated
+	first, second := write(copies[0]), write(copies[1])
+	assert.NotEqual(t, first, second)
+
+	for _, reg := range copies {
+		reg.SetReproducibleCatalog(true)
+	}
+	first, second = write(copies[0]), write(copies[1])
+	assert.Equal(t, first, second)
+	assert.Equal(t, first, write(copies[0]), "rebuilding gives the same bytes")
+
+	// Serial and concurrent builds agree too, and so does what SaveCatalog persists
+	serial, err := copies[1].buildCatalog(1)
+	require.NoError(t, err)
+	data, err := json.Marshal(serial)
+	require.NoError(t, err)
+	assert.Equal(t, first, string(data))
+	assert.True(t, serial.Updated.IsZero())
+
+	_, err = copies[0].SaveCatalog()
+	require.NoError(t, err)
+	saved, err := copies[0].storage.Get(CatalogPath)
+	require.NoError(t, err)
+	assert.Equal(t, first, string(saved))
+}
+
+func TestRegistry_VerifyCatalog(t *testing.T) {
+	hash := func(i int) string { return fmt.Sprintf("sha256:%064x", i) }
+
+	tests := []struct {
+		name     string
+		mutate   func(t *testing.T, store Storage, catalog *Catalog)
+		expected []Discrepancy
+	}{
+		{
+			name:     "unchanged index",
+			mutate:   func(*testing.T, Storage, *Catalog) {},
+			expected: []Discrepancy{},
+		},
+		{
+			name: "entry removed from index",
+			mutate: func(t *testing.T, store Storage, catalog *Catalog) {
+				delete(catalog.Tools["tool0"].Versions["1.0.0"], "linux-amd64")
+			},
+			expected: []Discrepancy{
+				{Kind: DiscrepancyMissing, Tool: "tool0", Version: "1.0.0", Platform: "linux-amd64", Expected: hash(1)},
+			},
+		},
+		{
+			name: "entry added to index",
+			mutate: func(t *testing.T, store Storage, catalog *Catalog) {
+				catalog.Tools["ghost"] = ToolInfo{Versions: map[string]map[string]string{"1.0.0": {"linux-amd64": hash(99)}}}
+			},
+			expected: []Discrepancy{
+				{Kind: DiscrepancyExtra, Tool: "ghost", Version: "1.0.0", Platform: "linux-amd64", Actual: hash(99)},
+			},
+		},
+		{
+			name: "hash edited in index",
+			mutate: func(t *testing.T, store Storage, catalog *Catalog) {
+				catalog.Tools["tool0"].Versions["1.1.0"]["darwin-arm64"] = hash(99)
+			},
+			expected: []Discrepancy{
+				{Kind: DiscrepancyHashMismatch, Tool: "tool0", Version: "1.1.0", Platform: "darwin-arm64", Expected: hash(7), Actual: hash(99)},
+			},
+		},
+		{
+			name: "shim deleted after indexing",
+			mutate: func(t *testing.T, store Storage, catalog *Catalog) {
+				require.NoError(t, store.Delete(shimKey(fmt.Sprintf("%064x", 2))))
+			},
+			expected: []Discrepancy{
+				{Kind: DiscrepancyExtra, Tool: "tool0", Version: "1.0.0", Platform: "linux-arm64", Actual: hash(2)},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			forEachStorage(t, func(t *testing.T, reg *Registry, store Storage) {
+				writeSyntheticShims(t, store, 8)
+				_, err := reg.SaveCatalog()
+				require.NoError(t, err)
+
+				data, err := store.Get(CatalogPath)
+				require.NoError(t, err)
+				var catalog Catalog
+				require.NoError(t, json.Unmarshal(data, &catalog))
+				tt.mutate(t, store, &catalog)
+				data, err = json.Marshal(catalog)
+				require.NoError(t, err)
+				require.NoError(t, store.Put(CatalogPath, data))
+
+				discrepancies, err := reg.VerifyCatalog()
+				require.NoError(t, err)
+				assert.Equal(t, tt.expected, discrepancies)
+			})
+		})
+	}
+}
+
+func TestRegistry_PruneCatalog(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, reg *Registry, store Storage) {
+		writeSyntheticShims(t, store, 8)
+		solo := strings.Repeat("e", 64)
+		putShim(t, store, solo, []byte(`{
+			"binary": {"hash": "sha256:`+solo+`", "platform": "linux-amd64"},
+			"name": "solo",
+			"version": "2.0.0"
+		}`))
+		_, err := reg.SaveCatalog()
+		require.NoError(t, err)
+
+		require.NoError(t, store.Delete(shimKey(fmt.Sprintf("%064x", 2))))
+		require.NoError(t, store.Delete(shimKey(solo)))
+		expected := []Discrepancy{
+			{Kind: DiscrepancyExtra, Tool: "solo", Version: "2.0.0", Platform: "linux-amd64", Actual: "sha256:" + solo},
+			{Kind: DiscrepancyExtra, Tool: "tool0", Version: "1.0.0", Platform: "linux-arm64", Actual: fmt.Sprintf("sha256:%064x", 2)},
+		}
+
+		// A dry run leaves the index alone
+		result, err := reg.PruneCatalog(false)
+		require.NoError(t, err)
+		assert.Equal(t, expected, result.Removed)
+		assert.Equal(t, []string{"solo"}, result.RemovedTools)
+		assert.Empty(t, result.Repaired)
+		assert.False(t, result.Written)
+		discrepancies, err := reg.VerifyCatalog()
+		require.NoError(t, err)
+		assert.Len(t, discrepancies, 2)
+
+		result, err = reg.PruneCatalog(true)
+		require.NoError(t, err)
+		assert.Equal(t, expected, result.Removed)
+		assert.True(t, result.Written)
+
+		data, err := store.Get(CatalogPath)
+		require.NoError(t, err)
+		var catalog Catalog
+		require.NoError(t, json.Unmarshal(data, &catalog))
+		assert.NotContains(t, catalog.Tools, "solo")
+		assert.NotContains(t, catalog.Tools["tool0"].Versions["1.0.0"], "linux-arm64")
+		assert.Contains(t, catalog.Tools["tool0"].Versions["1.0.0"], "linux-amd64")
+
+		// Nothing is left to prune
+		result, err = reg.PruneCatalog(false)
+		require.NoError(t, err)
+		assert.Empty(t, result.Removed)
+		assert.Empty(t, result.RemovedTools)
+	})
+}
+
+func TestRegistry_PruneCatalog_Repaired(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, reg *Registry, store Storage) {
+		writeSyntheticShims(t, store, 4)
+		_, err := reg.SaveCatalog()
+		require.NoError(t, err)
+
+		// One indexed shim is gone and one shim was never indexed
+		require.NoError(t, store.Delete(shimKey(fmt.Sprintf("%064x", 1))))
+		added := strings.Repeat("e", 64)
+		putShim(t, store, added, []byte(`{
+			"binary": {"hash": "sha256:`+added+`", "platform": "linux-amd64"},
+			"name": "added",
+			"version": "2.0.0"
+		}`))
+		removed := []Discrepancy{
+			{Kind: DiscrepancyExtra, Tool: "tool0", Version: "1.0.0", Platform: "linux-amd64", Actual: fmt.Sprintf("sha256:%064x", 1)},
+		}
+		repaired := []Discrepancy{
+			{Kind: DiscrepancyMissing, Tool: "added", Version: "2.0.0", Platform: "linux-amd64", Expected: "sha256:" + added},
+		}
+
+		result, err := reg.PruneCatalog(false)
+		require.NoError(t, err)
+		assert.Equal(t, removed, result.Removed)
+		assert.Equal(t, repaired, result.Repaired)
+		assert.False(t, result.Written)
+
+		result, err = reg.PruneCatalog(true)
+		require.NoError(t, err)
+		assert.Equal(t, removed, result.Removed)
+		assert.Equal(t, repaired, result.Repaired)
+		assert.True(t, result.Written)
+
+		// The rewrite fixed both
+		discrepancies, err := reg.VerifyCatalog()
+		require.NoError(t, err)
+		assert.Empty(t, discrepancies)
+	})
+}
+
+func TestRegistry_VerifyCatalog_Errors(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, reg *Registry, store Storage) {
+		_, err := reg.VerifyCatalog()
+		assert.ErrorIs(t, err, fs.ErrNotExist)
+
+		require.NoError(t, store.Put(CatalogPath, []byte("{not json")))
+		_, err = reg.VerifyCatalog()
+		assert.ErrorIs(t, err, ErrValidation)
+
+		require.NoError(t, store.Put(CatalogPath, []byte(`{"version": "2", "tools": {}}`)))
+		_, err = reg.VerifyCatalog()
+		assert.ErrorIs(t, err, ErrUnsupportedCatalogVersion)
+	})
+}
+
+func BenchmarkBuildCatalog(b *testing.B) {
+	store := NewFileStorage(b.TempDir())
+	writeSyntheticShims(b, store, 10000)
+	reg := New(store)
+
+	for _, workers := range []int{1, 4, 16} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := reg.buildCatalog(workers); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// peakHeapWriter discards what is written to it, recording the largest live
+// heap seen at each write.
+type peakHeapWriter struct {
+	peak uint64
+}
+
+func (w *peakHeapWriter) Write(p []byte) (int, error) {
+	runtime.GC()
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	if stats.HeapAlloc > w.peak {
+		w.peak = stats.HeapAlloc
+	}
+	return len(p), nil
+}
+
+// BenchmarkWriteCatalog reports the peak live heap per shim while the
+// catalog is written, streamed by WriteCatalog or encoded after
+// BuildCatalog, and fails if streaming's grows with the registry or isn't
+// well below the built catalog's. The shim listing both hold while first
+// reading the shims isn't counted.
+func BenchmarkWriteCatalog(b *testing.B) {
+	write := map[string]func(reg *Registry, w io.Writer) error{
+		"build": func(reg *Registry, w io.Writer) error {
+			catalog, err := reg.BuildCatalog()
+			if err != nil {
+				return err
+			}
+			return encodeCatalog(w, catalog)
+		},
+		"stream": (*Registry).WriteCatalog,
+	}
+
+	peak := make(map[string]float64) // "mode/shims" -> peak bytes per shim
+	for _, shims := range []int{1000, 10000} {
+		store := NewFileStorage(b.TempDir())
+		writeSyntheticShims(b, store, shims)
+		reg := New(store)
+
+		for _, mode := range []string{"build", "stream"} {
+			name := fmt.Sprintf("%s/shims=%d", mode, shims)
+			b.Run(name, func(b *testing.B) {
+				var max float64
+				for i := 0; i < b.N; i++ {
+					runtime.GC()
+					var stats runtime.MemStats
+					runtime.ReadMemStats(&stats)
+					w := &peakHeapWriter{}
+					if err := write[mode](reg, w); err != nil {
+						b.Fatal(err)
+					}
+					if w.peak > stats.HeapAlloc {
+						max = math.Max(max, float64(w.peak-stats.HeapAlloc)/float64(shims))
+					}
+				}
+				peak[name] = max
+				b.ReportMetric(max, "peak-B/shim")
+			})
+		}
+	}
+
+	small, large := peak["stream/shims=1000"], peak["stream/shims=10000"]
+	if large > small*1.25 {
+		b.Errorf("streaming peak grew from %.0f to %.0f bytes per shim", small, large)
+	}
+	if built := peak["build/shims=10000"]; large > built/2 {
+		b.Errorf("streaming peak of %.0f bytes per shim isn't well below the built catalog's %.0f", large, built)
+	}
+}
+
+func TestCompareSemver(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		expected int
+	}{
+		{a: "1.0.0", b: "1.0.0", expected: 0},
+		{a: "v1.2.3", b: "1.2.3", expected: 0},
+		{a: "1.0.0+build.1", b: "1.0.0+build.2", expected: 0},
+		{a: "1.10.0", b: "1.9.0", expected: 1},
+		{a: "1.0.0", b: "1.0.0-rc.1", expected: 1},
+		{a: "1.0.0-alpha", b: "1.0.0-alpha.1", expected: -1},
+		{a: "1.0.0-alpha.1", b: "1.0.0-alpha.beta", expected: -1},
+		{a: "1.0.0-beta.2", b: "1.0.0-beta.11", expected: -1},
+		{a: "1.0.0-rc.1", b: "1.0.0-beta", expected: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.a+" vs "+tt.b, func(t *testing.T) {
+			a, ok := parseSemver(tt.a)
+			require.True(t, ok)
+			b, ok := parseSemver(tt.b)
+			require.True(t, ok)
+			assert.Equal(t, tt.expected, compareSemver(a, b))
+		})
+	}
+}
+
+func TestParseSemver_Invalid(t *testing.T) {
+	for _, version := range []string{"", "1.2", "1.2.3.4", "01.2.3", "1.2.3-", "1.2.3-01", "1.2.3+", "latest"} {
+		t.Run(version, func(t *testing.T) {
+			_, ok := parseSemver(version)
+			assert.False(t, ok)
+		})
+	}
+}
+
+func TestLatestByPlatform_EqualPrecedence(t *testing.T) {
+	versions := map[string]map[string]string{
+		"1.0.0":         {"linux-amd64": "plain", "darwin-arm64": "plain"},
+		"v1.0.0":        {"linux-amd64": "prefixed"},
+		"1.0.0+build.1": {"darwin-arm64": "build1"},
+		"1.0.0+build.2": {"darwin-arm64": "build2"},
+	}
+
+	// Map iteration order varies between runs; the result must not.
+	for i := 0; i < 50; i++ {
+		assert.Equal(t, map[string]string{
+			"linux-amd64":  "prefixed",
+			"darwin-arm64": "build2",
+		}, latestByPlatform(versions))
+	}
+}
+
 func TestRegistry_ListShims(t *testing.T) {
-	tmpDir := t.TempDir()
+	forEachStorage(t, testRegistryListShims)
+}
 
-	shimsDir := filepath.Join(tmpDir, "shims", "sha256")
-	require.NoError(t, os.MkdirAll(shimsDir, 0755))
+func testRegistryListShims(t *testing.T, reg *Registry, store Storage) {
+	shims, err := reg.ListShims()
+	assert.NoError(t, err)
+	assert.Empty(t, shims)
 
 	// Add multiple test shims
 	validHash := "a1b2c3d4e5f6a1b2c3d4e5f6a1b2c3d4e5f6a1b2c3d4e5f6a1b2c3d4e5f6a1b2"
 	srcData, err := os.ReadFile("../../testdata/valid-shim.json")
 	require.NoError(t, err)
-	require.NoError(t, os.WriteFile(filepath.Join(shimsDir, validHash+".json"), srcData, 0644))
+	putShim(t, store, validHash, srcData)
+	require.NoError(t, store.Put(BundlePath(validHash), []byte("bundle")))
 
-	reg, err := Load(tmpDir)
-	require.NoError(t, err)
-
-	shims, err := reg.ListShims()
+	shims, err = reg.ListShims()
 	assert.NoError(t, err)
-	assert.NotEmpty(t, shims)
-	// Will fail until implementation exists
+	assert.Len(t, shims, 1)
+}
+
+func TestRegistry_ShimHashes(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, reg *Registry, store Storage) {
+		hashes, err := reg.ShimHashes()
+		require.NoError(t, err)
+		assert.Empty(t, hashes)
+
+		validHash := "a1b2c3d4e5f6a1b2c3d4e5f6a1b2c3d4e5f6a1b2c3d4e5f6a1b2c3d4e5f6a1b2"
+		misfiledHash := strings.Repeat("f", 64)
+		srcData, err := os.ReadFile("../../testdata/valid-shim.json")
+		require.NoError(t, err)
+		putShim(t, store, validHash, srcData)
+		putShim(t, store, misfiledHash, srcData)
+		require.NoError(t, store.Put(BundlePath(validHash), []byte("bundle")))
+
+		// Listed by filename, whatever the shim inside describes
+		hashes, err = reg.ShimHashes()
+		require.NoError(t, err)
+		assert.Equal(t, []string{validHash, misfiledHash}, hashes)
+	})
 }
 
 func TestShimPath(t *testing.T) {
@@ -266,3 +819,263 @@ func TestBundlePath(t *testing.T) {
 	path := BundlePath(hash)
 	assert.Equal(t, "shims/sha256/abc123.json.bundle", path)
 }
+
+func TestRegistry_HasSignature(t *testing.T) {
+	reg, err := Load("../../testdata")
+	require.NoError(t, err)
+
+	validHash := "a1b2c3d4e5f6a1b2c3d4e5f6a1b2c3d4e5f6a1b2c3d4e5f6a1b2c3d4e5f6a1b2"
+	assert.True(t, reg.HasSignature(validHash))
+	assert.True(t, reg.HasSignature(HashPrefix+validHash))
+	assert.False(t, reg.HasSignature("ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff"))
+}
+
+func TestRegistry_HasSignature_Minisign(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, reg *Registry, store Storage) {
+		hash := strings.Repeat("ab", 32)
+		assert.False(t, reg.HasSignature(hash))
+
+		require.NoError(t, store.Put(MinisigPath(hash), []byte("untrusted comment: test\n")))
+		assert.True(t, reg.HasSignature(hash))
+	})
+}
+
+func TestRegistry_CreateShim(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, reg *Registry, store Storage) {
+		hash := strings.Repeat("ab", 32)
+		data := []byte(fmt.Sprintf(`{"binary": {"hash": "sha256:%s"}, "name": "jq", "version": "1.7.1"}`, hash))
+
+		assert.ErrorIs(t, reg.CreateShim(hash, []byte(`{"name": "jq"}`)), ErrValidation)
+		require.NoError(t, reg.CreateShim(hash, data))
+		assert.ErrorIs(t, reg.CreateShim(HashPrefix+hash, data), ErrExists)
+	})
+}
+
+func TestRegistry_CreateBundle(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, reg *Registry, store Storage) {
+		hash := strings.Repeat("ab", 32)
+
+		assert.ErrorIs(t, reg.CreateBundle(hash, []byte("bundle")), ErrNotFound)
+
+		putShim(t, store, hash, []byte(`{}`))
+		require.NoError(t, reg.CreateBundle(hash, []byte("bundle")))
+		assert.ErrorIs(t, reg.CreateBundle(hash, []byte("other")), ErrExists)
+		data, err := store.Get(BundlePath(hash))
+		require.NoError(t, err)
+		assert.Equal(t, "bundle", string(data))
+	})
+}
+
+func TestRegistry_PutShim(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, reg *Registry, store Storage) {
+		hash := strings.Repeat("ab", 32)
+		data := []byte(fmt.Sprintf(`{"binary": {"hash": "sha256:%s"}, "name": "jq", "version": "1.7.1"}`, hash))
+
+		assert.ErrorIs(t, reg.PutShim(strings.Repeat("cd", 32), data), ErrHashMismatch)
+		assert.ErrorIs(t, reg.PutShim(hash, []byte(`{"name": "jq"}`)), ErrValidation)
+		_, err := store.Get(ShimPath(hash))
+		assert.ErrorIs(t, err, fs.ErrNotExist)
+
+		require.NoError(t, reg.PutShim(HashPrefix+hash, data))
+		shim, err := reg.GetShim(hash)
+		require.NoError(t, err)
+		assert.Equal(t, "jq", shim.Name)
+	})
+}
+
+// provenanceShimJSON returns shim JSON for jq on platform whose trust
+// block carries provenance, which is inserted as is.
+func provenanceShimJSON(hash, version, platform, provenance string) string {
+	return fmt.Sprintf(`{
+		"atip": {"version": "0.6"},
+		"binary": {"hash": "sha256:%s", "name": "jq", "version": %q, "platform": %q},
+		"name": "jq",
+		"version": %q,
+		"description": "JSON processor",
+		"trust": {"source": "community", "verified": true, "provenance": %s}
+	}`, hash, version, platform, version, provenance)
+}
+
+func TestRegistry_Provenance(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, reg *Registry, store Storage) {
+		hash := strings.Repeat("ab", 32)
+		shimPath := filepath.Join(t.TempDir(), "jq.json")
+		data := provenanceShimJSON(hash, "1.7.1", "linux-amd64", `{
+			"url": "https://github.com/jqlang/jq/releases/download/jq-1.7.1/jq.intoto.jsonl",
+			"format": "slsa-provenance-v1",
+			"slsaLevel": 3,
+			"builder": "https://github.com/slsa-framework/slsa-github-generator"
+		}`)
+		require.NoError(t, os.WriteFile(shimPath, []byte(data), 0644))
+		require.NoError(t, reg.AddShim(shimPath))
+
+		want := &Provenance{
+			URL:       "https://github.com/jqlang/jq/releases/download/jq-1.7.1/jq.intoto.jsonl",
+			Format:    "slsa-provenance-v1",
+			SLSALevel: 3,
+			Builder:   "https://github.com/slsa-framework/slsa-github-generator",
+		}
+		shim, err := reg.GetShim(hash)
+		require.NoError(t, err)
+		assert.Equal(t, "community", shim.Trust.Source)
+		assert.True(t, shim.Trust.Verified)
+		assert.Equal(t, want, shim.Trust.Provenance)
+
+		provenance, err := reg.Provenance(HashPrefix + hash)
+		require.NoError(t, err)
+		assert.Equal(t, &ShimProvenance{
+			Hash: HashPrefix + hash, Name: "jq", Version: "1.7.1", Platform: "linux-amd64",
+			Provenance: want,
+		}, provenance)
+
+		catalog, err := reg.BuildCatalog()
+		require.NoError(t, err)
+		assert.Equal(t, map[string]*Provenance{HashPrefix + hash: want}, catalog.Tools["jq"].Provenance)
+
+		// It survives a round trip through the persisted catalog
+		_, err = reg.SaveCatalog()
+		require.NoError(t, err)
+		persisted, err := store.Get(CatalogPath)
+		require.NoError(t, err)
+		var decoded Catalog
+		require.NoError(t, json.Unmarshal(persisted, &decoded))
+		assert.Equal(t, want, decoded.Tools["jq"].Provenance[HashPrefix+hash])
+
+		_, err = reg.Provenance(strings.Repeat("cd", 32))
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+}
+
+func TestRegistry_Provenance_None(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, reg *Registry, store Storage) {
+		hash := strings.Repeat("ab", 32)
+		require.NoError(t, reg.PutShim(hash, []byte(shimJSON(hash, "jq", "1.7.1"))))
+
+		provenance, err := reg.Provenance(hash)
+		require.NoError(t, err)
+		assert.Nil(t, provenance.Provenance)
+
+		data, err := json.Marshal(provenance)
+		require.NoError(t, err)
+		assert.Contains(t, string(data), `"provenance":null`)
+
+		catalog, err := reg.BuildCatalog()
+		require.NoError(t, err)
+		assert.Nil(t, catalog.Tools["jq"].Provenance)
+	})
+}
+
+func TestRegistry_Provenance_Catalog(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, reg *Registry, store Storage) {
+		// Two shims compete for one slot; the provenance listed is the
+		// winner's, whichever order they are added in
+		low, high := strings.Repeat("11", 32), strings.Repeat("22", 32)
+		putShim(t, store, low, []byte(provenanceShimJSON(low, "1.7.1", "linux-amd64", `{"slsaLevel": 1}`)))
+		putShim(t, store, high, []byte(provenanceShimJSON(high, "1.7.1", "linux-amd64", `{"slsaLevel": 3}`)))
+		other := strings.Repeat("33", 32)
+		putShim(t, store, other, []byte(provenanceShimJSON(other, "1.7.1", "darwin-arm64", `{"slsaLevel": 2}`)))
+
+		for _, workers := range []int{1, 4} {
+			catalog, err := reg.buildCatalog(workers)
+			require.NoError(t, err)
+			assert.Equal(t, map[string]*Provenance{
+				HashPrefix + high:  {SLSALevel: 3},
+				HashPrefix + other: {SLSALevel: 2},
+			}, catalog.Tools["jq"].Provenance)
+		}
+	})
+}
+
+func TestRegistry_PutShim_InvalidProvenance(t *testing.T) {
+	hash := strings.Repeat("ab", 32)
+	tests := []struct {
+		name       string
+		provenance string
+		errorMsg   string
+	}{
+		{"relative url", `{"url": "jq.intoto.jsonl"}`, "trust.provenance.url"},
+		{"unknown format", `{"format": "sbom"}`, "trust.provenance.format"},
+		{"level too high", `{"slsaLevel": 5}`, "trust.provenance.slsaLevel"},
+		{"negative level", `{"slsaLevel": -1}`, "trust.provenance.slsaLevel"},
+		{"wrong type", `{"slsaLevel": "three"}`, "invalid JSON"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reg := New(NewFileStorage(t.TempDir()))
+			err := reg.PutShim(hash, []byte(provenanceShimJSON(hash, "1.7.1", "linux-amd64", tt.provenance)))
+			assert.ErrorIs(t, err, ErrValidation)
+			assert.Contains(t, err.Error(), tt.errorMsg)
+		})
+	}
+
+	// An empty provenance, or one in-toto attestation at level 0, is fine
+	reg := New(NewFileStorage(t.TempDir()))
+	assert.NoError(t, reg.PutShim(hash, []byte(provenanceShimJSON(hash, "1.7.1", "linux-amd64", `{}`))))
+	assert.NoError(t, reg.PutShim(hash, []byte(provenanceShimJSON(hash, "1.7.1", "linux-amd64", `{"format": "in-toto", "slsaLevel": 0}`))))
+}
+
+func TestRegistry_GetShimVerified(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, reg *Registry, store Storage) {
+		hash, other := strings.Repeat("ab", 32), strings.Repeat("cd", 32)
+		valid := shimJSON(hash, "jq", "1.7.1")
+		putShim(t, store, hash, []byte(valid))
+
+		shim, err := reg.GetShimVerified(HashPrefix + hash)
+		require.NoError(t, err)
+		assert.Equal(t, "jq", shim.Name)
+
+		tests := []struct {
+			name string
+			data string
+		}{
+			{"truncated", valid[:len(valid)/2]},
+			{"garbage", "\x00\x00\x00"},
+			{"another binary's shim", shimJSON(other, "jq", "1.7.1")},
+			{"no binary hash", `{"name": "jq", "version": "1.7.1"}`},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				putShim(t, store, hash, []byte(tt.data))
+				_, err := reg.GetShimVerified(hash)
+				assert.ErrorIs(t, err, ErrHashMismatch)
+			})
+		}
+
+		// GetShim serves a misfiled shim as if it were valid
+		putShim(t, store, hash, []byte(shimJSON(other, "jq", "1.7.1")))
+		_, err = reg.GetShim(hash)
+		assert.NoError(t, err)
+
+		_, err = reg.GetShimVerified(strings.Repeat("ef", 32))
+		assert.ErrorIs(t, err, ErrNotFound)
+		_, err = reg.GetShimVerified("not-a-hash")
+		assert.ErrorIs(t, err, ErrInvalidHash)
+	})
+}
+
+func TestRegistry_PutBundle(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, reg *Registry, store Storage) {
+		hash := strings.Repeat("ab", 32)
+
+		assert.ErrorIs(t, reg.PutBundle("abc", []byte("bundle")), ErrInvalidHash)
+		assert.ErrorIs(t, reg.PutBundle(hash, []byte("bundle")), ErrNotFound)
+
+		putShim(t, store, hash, []byte(`{}`))
+		require.NoError(t, reg.PutBundle(hash, []byte("bundle")))
+		data, err := store.Get(BundlePath(hash))
+		require.NoError(t, err)
+		assert.Equal(t, "bundle", string(data))
+	})
+}
+
+func TestRegistry_Manifest(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, reg *Registry, store Storage) {
+		_, err := reg.Manifest()
+		assert.ErrorIs(t, err, fs.ErrNotExist)
+
+		require.NoError(t, store.Put(ManifestPath, []byte(`{"registry": {}}`)))
+		data, err := reg.Manifest()
+		require.NoError(t, err)
+		assert.JSONEq(t, `{"registry": {}}`, string(data))
+	})
+}
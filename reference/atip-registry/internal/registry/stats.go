@@ -0,0 +1,100 @@
+package registry
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Stats summarizes the storage used by the registry's shims and their
+// signatures, and any shim files that can't be served.
+type Stats struct {
+	Shims          int           `json:"shims"`
+	ShimBytes      int64         `json:"shim_bytes"`       // Size on disk, compressed or not
+	Compressed     int           `json:"compressed_shims"` // Shims stored gzip-compressed, counted in Shims too
+	Signatures     int           `json:"signatures"`       // Bundles and minisign signatures
+	SignatureBytes int64         `json:"signature_bytes"`  // Total size of Signatures
+	Unsigned       int           `json:"unsigned"`         // Readable shims without a signature
+	Corrupt        []CorruptShim `json:"corrupt"`
+	Disk           *DiskSpace    `json:"disk,omitempty"` // Set by the caller; see FreeSpace
+}
+
+// CorruptShim is a shim file that can't be read or parsed, or whose
+// binary hash doesn't match its filename.
+type CorruptShim struct {
+	Path  string `json:"path"` // Storage key
+	Size  int64  `json:"size"`
+	Error string `json:"error"`
+}
+
+// DiskSpace describes the filesystem holding a directory.
+type DiskSpace struct {
+	Path  string `json:"path"`
+	Free  uint64 `json:"free"`  // Bytes available to an unprivileged user
+	Total uint64 `json:"total"` // Size of the filesystem in bytes
+}
+
+// Stats walks the shim directory, counting shims and signatures and their
+// sizes. Shims that GetShim would reject are reported under Corrupt rather
+// than silently skipped as in ListShims, and aren't counted as shims.
+// Corrupt is sorted by path.
+func (r *Registry) Stats() (*Stats, error) {
+	objects, err := r.storage.List(ShimSubdir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read shims directory: %w", err)
+	}
+
+	stats := &Stats{Corrupt: []CorruptShim{}}
+	signed := make(map[string]bool)
+	var shims []string
+	for _, obj := range objects {
+		switch {
+		case isTempName(obj.Name):
+			// Left to gc
+		case strings.HasSuffix(obj.Name, BundleExtension), strings.HasSuffix(obj.Name, MinisigExtension):
+			stats.Signatures++
+			stats.SignatureBytes += obj.Size
+			signed[strings.TrimSuffix(strings.TrimSuffix(obj.Name, BundleExtension), MinisigExtension)] = true
+		case strings.HasSuffix(obj.Name, ShimExtension), strings.HasSuffix(obj.Name, CompressedShimExtension):
+			hash, _ := shimFileHash(obj.Name)
+			if err := r.checkShim(obj.Name); err != nil {
+				stats.Corrupt = append(stats.Corrupt, CorruptShim{
+					Path:  path.Join(ShimSubdir, obj.Name),
+					Size:  obj.Size,
+					Error: err.Error(),
+				})
+				continue
+			}
+			stats.Shims++
+			stats.ShimBytes += obj.Size
+			if strings.HasSuffix(obj.Name, CompressedShimExtension) {
+				stats.Compressed++
+			}
+			shims = append(shims, hash)
+		}
+	}
+
+	for _, hash := range shims {
+		if !signed[hash] {
+			stats.Unsigned++
+		}
+	}
+	sort.Slice(stats.Corrupt, func(i, j int) bool { return stats.Corrupt[i].Path < stats.Corrupt[j].Path })
+	return stats, nil
+}
+
+// checkShim reports why the shim stored as filename can't be served, or
+// nil if it can. Errors are as for GetShim, then ValidateHash.
+func (r *Registry) checkShim(filename string) error {
+	data, err := r.readShimFile(filename)
+	if err != nil {
+		return fmt.Errorf("failed to read shim file: %w", err)
+	}
+	var shim Shim
+	if err := json.Unmarshal(data, &shim); err != nil {
+		return fmt.Errorf("failed to parse shim JSON: %w", err)
+	}
+	return ValidateHash(shim.Binary.Hash, strings.TrimSuffix(filename, ".gz"))
+}
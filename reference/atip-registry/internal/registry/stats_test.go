@@ -0,0 +1,56 @@
+package registry
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistry_Stats(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, reg *Registry, store Storage) {
+		writeSyntheticShims(t, store, 3)
+		signed := fmt.Sprintf("%064x", 1)
+		broken := fmt.Sprintf("%064x", 4)
+		misplaced := fmt.Sprintf("%064x", 5)
+
+		require.NoError(t, store.Put(BundlePath(signed), []byte("bundle")))
+		putShim(t, store, broken, []byte("{not json"))
+		putShim(t, store, misplaced, []byte(shimJSON(signed, "jq", "1.7.1")))
+		require.NoError(t, store.Put(ShimSubdir+"/.upload.tmp", []byte("partial")))
+
+		stats, err := reg.Stats()
+		require.NoError(t, err)
+		assert.Equal(t, 3, stats.Shims)
+		assert.Positive(t, stats.ShimBytes)
+		assert.Equal(t, 1, stats.Signatures)
+		assert.Equal(t, int64(6), stats.SignatureBytes)
+		assert.Equal(t, 2, stats.Unsigned)
+
+		require.Len(t, stats.Corrupt, 2)
+		assert.Equal(t, ShimSubdir+"/"+broken+".json", stats.Corrupt[0].Path)
+		assert.Equal(t, int64(9), stats.Corrupt[0].Size)
+		assert.Contains(t, stats.Corrupt[0].Error, "failed to parse shim JSON")
+		assert.Equal(t, ShimSubdir+"/"+misplaced+".json", stats.Corrupt[1].Path)
+		assert.Contains(t, stats.Corrupt[1].Error, ErrHashMismatch.Error())
+	})
+}
+
+func TestRegistry_Stats_Empty(t *testing.T) {
+	stats, err := New(NewMemoryStorage()).Stats()
+	require.NoError(t, err)
+	assert.Zero(t, stats.Shims)
+	assert.NotNil(t, stats.Corrupt)
+	assert.Nil(t, stats.Disk)
+}
+
+func TestFreeSpace(t *testing.T) {
+	disk, err := FreeSpace(t.TempDir())
+	require.NoError(t, err)
+	assert.Positive(t, disk.Total)
+	assert.LessOrEqual(t, disk.Free, disk.Total)
+
+	_, err = FreeSpace("/does/not/exist")
+	assert.Error(t, err)
+}
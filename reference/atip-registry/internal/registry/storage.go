@@ -0,0 +1,171 @@
+package registry
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Storage holds the files of a registry: shims, signature bundles and the
+// manifest. Keys are slash-separated paths relative to the registry root,
+// such as ShimPath(hash) or ManifestPath.
+//
+// Implementations must be safe for concurrent use.
+type Storage interface {
+	// Get returns the contents of key. The error satisfies
+	// errors.Is(err, fs.ErrNotExist) if key doesn't exist.
+	Get(key string) ([]byte, error)
+
+	// Put stores data under key, replacing any existing object.
+	Put(key string, data []byte) error
+
+	// Delete removes key. Deleting a missing key is not an error.
+	Delete(key string) error
+
+	// List returns the objects directly under dir, sorted by name.
+	// A missing dir is empty.
+	List(dir string) ([]ObjectInfo, error)
+}
+
+// ObjectInfo describes a stored object.
+type ObjectInfo struct {
+	Name    string    // Base name, relative to the listed directory
+	Size    int64     // Size in bytes
+	ModTime time.Time // Last modification time
+}
+
+// FileStorage is the Storage backed by a directory on the local filesystem.
+type FileStorage struct {
+	root string
+}
+
+// NewFileStorage creates a Storage rooted at dir.
+func NewFileStorage(dir string) *FileStorage {
+	return &FileStorage{root: dir}
+}
+
+// path converts a key to a filesystem path under the root.
+func (s *FileStorage) path(key string) string {
+	return filepath.Join(s.root, filepath.FromSlash(key))
+}
+
+// Get reads the file for key.
+func (s *FileStorage) Get(key string) ([]byte, error) {
+	return os.ReadFile(s.path(key))
+}
+
+// Put writes the file for key, creating parent directories as needed.
+func (s *FileStorage) Put(key string, data []byte) error {
+	dest := s.path(key)
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+	return os.WriteFile(dest, data, 0644)
+}
+
+// Delete removes the file for key.
+func (s *FileStorage) Delete(key string) error {
+	if err := os.Remove(s.path(key)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// List returns the regular files in dir.
+func (s *FileStorage) List(dir string) ([]ObjectInfo, error) {
+	entries, err := os.ReadDir(s.path(dir))
+	if errors.Is(err, fs.ErrNotExist) {
+		return []ObjectInfo{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	objects := []ObjectInfo{}
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue // Removed since ReadDir
+		}
+		objects = append(objects, ObjectInfo{Name: entry.Name(), Size: info.Size(), ModTime: info.ModTime()})
+	}
+	return objects, nil
+}
+
+// MemoryStorage is a Storage that keeps objects in memory, for tests and
+// ephemeral registries.
+type MemoryStorage struct {
+	mu      sync.RWMutex
+	objects map[string]memoryObject
+}
+
+type memoryObject struct {
+	data    []byte
+	modTime time.Time
+}
+
+// NewMemoryStorage creates an empty in-memory Storage.
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{objects: make(map[string]memoryObject)}
+}
+
+// Get returns a copy of the object stored under key.
+func (s *MemoryStorage) Get(key string) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	obj, ok := s.objects[path.Clean(key)]
+	if !ok {
+		return nil, &fs.PathError{Op: "get", Path: key, Err: fs.ErrNotExist}
+	}
+	return append([]byte(nil), obj.data...), nil
+}
+
+// Put stores a copy of data under key.
+func (s *MemoryStorage) Put(key string, data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.objects[path.Clean(key)] = memoryObject{data: append([]byte(nil), data...), modTime: time.Now()}
+	return nil
+}
+
+// Delete removes key.
+func (s *MemoryStorage) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.objects, path.Clean(key))
+	return nil
+}
+
+// List returns the objects whose key is dir followed by a single name.
+func (s *MemoryStorage) List(dir string) ([]ObjectInfo, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	prefix := path.Clean(dir) + "/"
+	if prefix == "./" {
+		prefix = ""
+	}
+	objects := []ObjectInfo{}
+	for key, obj := range s.objects {
+		name, ok := strings.CutPrefix(key, prefix)
+		if !ok || strings.Contains(name, "/") {
+			continue
+		}
+		objects = append(objects, ObjectInfo{Name: name, Size: int64(len(obj.data)), ModTime: obj.modTime})
+	}
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Name < objects[j].Name })
+	return objects, nil
+}
@@ -0,0 +1,52 @@
+package registry
+
+import (
+	"io/fs"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStorage(t *testing.T) {
+	for _, backend := range storageBackends {
+		t.Run(backend.name, func(t *testing.T) {
+			store := backend.new(t)
+
+			_, err := store.Get("shims/sha256/missing.json")
+			assert.ErrorIs(t, err, fs.ErrNotExist)
+
+			objects, err := store.List(ShimSubdir)
+			require.NoError(t, err)
+			assert.Empty(t, objects)
+
+			data := []byte("b")
+			require.NoError(t, store.Put("shims/sha256/b.json", data))
+			require.NoError(t, store.Put("shims/sha256/a.json", []byte("aa")))
+			require.NoError(t, store.Put("shims/sha256/nested/c.json", []byte("c")))
+			require.NoError(t, store.Put(ManifestPath, []byte("{}")))
+			data[0] = 'x' // Stored objects don't alias the caller's slice
+
+			got, err := store.Get("shims/sha256/b.json")
+			require.NoError(t, err)
+			assert.Equal(t, "b", string(got))
+
+			objects, err = store.List(ShimSubdir)
+			require.NoError(t, err)
+			require.Len(t, objects, 2)
+			assert.Equal(t, "a.json", objects[0].Name)
+			assert.Equal(t, int64(2), objects[0].Size)
+			assert.False(t, objects[0].ModTime.IsZero())
+			assert.Equal(t, "b.json", objects[1].Name)
+
+			require.NoError(t, store.Delete("shims/sha256/a.json"))
+			require.NoError(t, store.Delete("shims/sha256/a.json"))
+			_, err = store.Get("shims/sha256/a.json")
+			assert.ErrorIs(t, err, fs.ErrNotExist)
+
+			objects, err = store.List(ShimSubdir)
+			require.NoError(t, err)
+			assert.Len(t, objects, 1)
+		})
+	}
+}
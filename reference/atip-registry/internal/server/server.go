@@ -4,14 +4,26 @@
 package server
 
 import (
+	"bytes"
 	"crypto/sha256"
+	"crypto/subtle"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
+	"math"
+	"mime"
 	"net/http"
 	"os"
+	"path"
 	"path/filepath"
 	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/anthropics/atip/reference/atip-registry/internal/registry"
 )
@@ -26,20 +38,82 @@ const (
 	// WellKnownPath is the path for the registry manifest.
 	WellKnownPath = "/.well-known/atip-registry.json"
 
+	// CapabilitiesPath is the path for the runtime capabilities document.
+	CapabilitiesPath = "/.well-known/atip-capabilities.json"
+
 	// ShimsPathPrefix is the URL path prefix for shim requests.
 	ShimsPathPrefix = "/shims/sha256/"
 
+	// ProvenancePathPrefix is the URL path prefix for provenance queries.
+	ProvenancePathPrefix = "/provenance/sha256/"
+
 	// CatalogPath is the URL path for the catalog index.
 	CatalogPath = "/shims/index.json"
 
 	// HealthPath is the URL path for health checks.
 	HealthPath = "/health"
+
+	// ContentTypeNDJSON is the media type of newline-delimited JSON.
+	ContentTypeNDJSON = "application/x-ndjson"
+
+	// DefaultCatalogTTL is how long a built catalog is served before the
+	// shim directory is checked for changes.
+	DefaultCatalogTTL = 30 * time.Second
+
+	// DefaultMaxUploadSize is the default limit on uploaded shims and bundles (1 MiB).
+	DefaultMaxUploadSize = 1 << 20
+
+	// version is the server version reported by /health and capabilities.
+	version = "0.1.0"
 )
 
 // Config holds server configuration.
 type Config struct {
-	DataDir    string // Directory containing registry data
-	CORSOrigin string // CORS allowed origin (use "*" for all)
+	DataDir       string // Directory containing registry data
+	CORSOrigin    string // CORS allowed origin (use "*" for all)
+	ShimCacheSize int64  // Shim and bundle bytes cached in memory (0 for DefaultShimCacheSize, negative disables)
+
+	// CatalogTTL is how long a built catalog is reused (0 for
+	// DefaultCatalogTTL). A negative TTL rebuilds it on every request.
+	CatalogTTL time.Duration
+
+	// WatchDebounce is how long Watch waits for changes to settle (0 for
+	// DefaultWatchDebounce).
+	WatchDebounce time.Duration
+
+	// VerifyOnRead checks each shim against the hash it is requested by
+	// before serving it (see registry.VerifyShimData), answering 500
+	// instead of serving a corrupt or misfiled shim.
+	VerifyOnRead bool
+
+	// ReproducibleCatalog serves a catalog that depends only on the shims'
+	// contents, without Updated or Last-Modified, so every replica serving
+	// the same shims gives it the same ETag (see
+	// registry.SetReproducibleCatalog).
+	ReproducibleCatalog bool
+
+	// UploadToken enables uploads of shims and bundles by PUT, from clients
+	// sending it as a bearer token. Uploads are disabled when it is empty,
+	// and never replace a stored shim or bundle.
+	UploadToken string
+
+	// MaxUploadSize is the largest accepted upload in bytes (0 for
+	// DefaultMaxUploadSize).
+	MaxUploadSize int64
+}
+
+// Capabilities describes what a running server supports. It is generated
+// from the server config and served at CapabilitiesPath so clients can
+// adapt, unlike the static registry manifest.
+type Capabilities struct {
+	Version           string            `json:"version"`            // Server version
+	Endpoints         map[string]string `json:"endpoints"`          // Name -> path of each enabled endpoint
+	Write             bool              `json:"write"`              // Whether shims and bundles can be uploaded
+	MaxUploadSize     int64             `json:"max_upload_size"`    // Largest accepted upload in bytes, 0 without uploads
+	HashAlgorithms    []string          `json:"hash_algorithms"`    // Algorithms shims are addressed by
+	CatalogFormats    []string          `json:"catalog_formats"`    // Media types the catalog is served as
+	CatalogVersions   []string          `json:"catalog_versions"`   // Catalog schema versions this server reads and writes
+	RequireSignatures bool              `json:"require_signatures"` // From the registry manifest's trust section
 }
 
 // Server represents the HTTP server for the ATIP registry.
@@ -48,6 +122,33 @@ type Server struct {
 	config   *Config
 	registry *registry.Registry
 	mux      *http.ServeMux
+
+	buildCatalog func() (*registry.Catalog, error) // Walks the shims, replaceable in tests
+	now          func() time.Time
+	files        fs.FS      // The data directory, replaceable in tests
+	shims        *shimCache // Recently served shims and bundles
+
+	catalogMu sync.RWMutex
+	catalog   *cachedCatalog // nil until built, or after InvalidateCatalog
+}
+
+// cachedCatalog is a built catalog with its encoded representations. It is
+// immutable once shared; a refresh replaces it.
+type cachedCatalog struct {
+	catalog   *registry.Catalog
+	encodings map[string]encodedCatalog // Keyed by content type
+	shimsMod  time.Time                 // Shim directory modification time when built
+	checked   time.Time                 // When built, or last found unchanged
+
+	// lastModified is the later of catalog.Updated and shimsMod, or zero
+	// for a reproducible catalog
+	lastModified time.Time
+}
+
+// encodedCatalog is one representation of the catalog.
+type encodedCatalog struct {
+	data []byte
+	etag string
 }
 
 // hashRegex validates SHA-256 hashes in URL paths (64 lowercase hex chars).
@@ -70,10 +171,22 @@ func NewServer(config *Config) *Server {
 	// Load registry (ignore error for now, will fail on actual requests if invalid)
 	reg, _ := registry.Load(config.DataDir)
 
+	shimCacheSize := config.ShimCacheSize
+	if shimCacheSize == 0 {
+		shimCacheSize = DefaultShimCacheSize
+	}
+
 	s := &Server{
 		config:   config,
 		registry: reg,
 		mux:      http.NewServeMux(),
+		now:      time.Now,
+		files:    os.DirFS(config.DataDir),
+		shims:    newShimCache(shimCacheSize),
+	}
+	if reg != nil {
+		reg.SetReproducibleCatalog(config.ReproducibleCatalog)
+		s.buildCatalog = reg.BuildCatalog
 	}
 
 	// Setup routes
@@ -85,7 +198,9 @@ func NewServer(config *Config) *Server {
 // setupRoutes configures all HTTP endpoints.
 func (s *Server) setupRoutes() {
 	s.mux.HandleFunc(WellKnownPath, s.handleRegistryManifest)
+	s.mux.HandleFunc(CapabilitiesPath, s.handleCapabilities)
 	s.mux.HandleFunc(ShimsPathPrefix, s.handleShim)
+	s.mux.HandleFunc(ProvenancePathPrefix, s.handleProvenance)
 	s.mux.HandleFunc(CatalogPath, s.handleCatalog)
 	s.mux.HandleFunc(HealthPath, s.handleHealth)
 }
@@ -101,8 +216,12 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	// CORS middleware
 	if s.config.CORSOrigin != "" {
 		w.Header().Set("Access-Control-Allow-Origin", s.config.CORSOrigin)
-		w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, If-None-Match")
+		methods, headers := "GET, OPTIONS", "Content-Type, If-None-Match, If-Modified-Since"
+		if s.uploadsEnabled() {
+			methods, headers = "GET, PUT, OPTIONS", headers+", Authorization"
+		}
+		w.Header().Set("Access-Control-Allow-Methods", methods)
+		w.Header().Set("Access-Control-Allow-Headers", headers)
 
 		if r.Method == http.MethodOptions {
 			w.WriteHeader(http.StatusOK)
@@ -138,20 +257,104 @@ func (s *Server) handleRegistryManifest(w http.ResponseWriter, r *http.Request)
 	w.Write(data)
 }
 
-// handleShim serves GET /shims/sha256/{hash}.json and /shims/sha256/{hash}.json.bundle
+// handleCapabilities serves GET /.well-known/atip-capabilities.json
+//
+// Returns the server's Capabilities. Cached for 5 minutes, since they change
+// when the server is reconfigured.
+func (s *Server) handleCapabilities(w http.ResponseWriter, r *http.Request) {
+	data, _ := json.Marshal(s.capabilities())
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
+// capabilities describes the server as currently configured.
+func (s *Server) capabilities() *Capabilities {
+	caps := &Capabilities{
+		Version: version,
+		Endpoints: map[string]string{
+			"manifest":     WellKnownPath,
+			"capabilities": CapabilitiesPath,
+			"shims":        ShimsPathPrefix + "{hash}.json",
+			"signatures":   ShimsPathPrefix + "{hash}.json.bundle",
+			"minisigs":     ShimsPathPrefix + "{hash}.json.minisig",
+			"provenance":   ProvenancePathPrefix + "{hash}.json",
+			"catalog":      CatalogPath,
+			"health":       HealthPath,
+		},
+		HashAlgorithms:  []string{"sha256"},
+		CatalogFormats:  []string{"application/json", ContentTypeNDJSON},
+		CatalogVersions: registry.SupportedCatalogVersions,
+	}
+
+	if s.uploadsEnabled() {
+		caps.Write = true
+		caps.MaxUploadSize = s.maxUploadSize()
+		caps.Endpoints["shims_upload"] = caps.Endpoints["shims"]
+		caps.Endpoints["signatures_upload"] = caps.Endpoints["signatures"]
+	}
+
+	if s.registry != nil {
+		var manifest struct {
+			Trust struct {
+				RequireSignatures bool `json:"requireSignatures"`
+			} `json:"trust"`
+		}
+		if data, err := s.registry.Manifest(); err == nil && json.Unmarshal(data, &manifest) == nil {
+			caps.RequireSignatures = manifest.Trust.RequireSignatures
+		}
+	}
+
+	return caps
+}
+
+// uploadsEnabled reports whether PUT requests can store shims and bundles.
+func (s *Server) uploadsEnabled() bool {
+	return s.config.UploadToken != "" && s.registry != nil
+}
+
+// maxUploadSize returns the configured upload limit or the default.
+func (s *Server) maxUploadSize() int64 {
+	if s.config.MaxUploadSize > 0 {
+		return s.config.MaxUploadSize
+	}
+	return DefaultMaxUploadSize
+}
+
+// handleShim serves GET /shims/sha256/{hash}.json, /shims/sha256/{hash}.json.bundle
+// and /shims/sha256/{hash}.json.minisig
 //
-// Serves either a shim metadata file (.json) or its signature bundle (.json.bundle).
-// Supports conditional requests via If-None-Match header (returns 304 if ETag matches).
+// Serves either a shim metadata file (.json) or its signature: a Cosign
+// bundle (.json.bundle) or minisign signature (.json.minisig).
+// Supports conditional requests via If-None-Match and If-Modified-Since (see notModified),
+// with Last-Modified taken from the file's modification time.
 //
 // Hash must be exactly 64 lowercase hexadecimal characters.
 // Content is cached for 24 hours with immutable directive (per spec section 4.7).
+// Shims stored compressed are served gzip-encoded if the client accepts it.
+// PUT requests upload a shim or bundle instead, if enabled (see handleUpload).
 func (s *Server) handleShim(w http.ResponseWriter, r *http.Request) {
-	// Extract hash from path: /shims/sha256/{hash}.json or /shims/sha256/{hash}.json.bundle
+	upload := r.Method == http.MethodPut && s.uploadsEnabled()
+	if r.Method != http.MethodGet && r.Method != http.MethodHead && !upload {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Extract hash from path: /shims/sha256/{hash}.json[.bundle|.minisig]
 	path := strings.TrimPrefix(r.URL.Path, ShimsPathPrefix)
 
-	isBundle := strings.HasSuffix(path, ".bundle")
-	if isBundle {
-		path = strings.TrimSuffix(path, ".bundle")
+	// The signature extension, if the path names a signature
+	var sig string
+	for _, ext := range []string{registry.BundleExtension, registry.MinisigExtension} {
+		if strings.HasSuffix(path, ext) {
+			sig = ext
+			path = strings.TrimSuffix(path, ext) + registry.ShimExtension
+			break
+		}
 	}
 
 	hash := strings.TrimSuffix(path, registry.ShimExtension)
@@ -162,92 +365,474 @@ func (s *Server) handleShim(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Determine file path
-	var filePath string
-	var contentType string
-	if isBundle {
-		filePath = filepath.Join(s.config.DataDir, registry.ShimSubdir, hash+registry.BundleExtension)
-		contentType = "application/octet-stream"
-	} else {
-		filePath = filepath.Join(s.config.DataDir, registry.ShimSubdir, hash+registry.ShimExtension)
-		contentType = "application/json"
+	if upload {
+		if sig == registry.MinisigExtension {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "minisign signatures can't be uploaded", http.StatusMethodNotAllowed)
+			return
+		}
+		s.handleUpload(w, r, hash, sig == registry.BundleExtension)
+		return
 	}
 
-	// Read file
-	data, err := os.ReadFile(filePath)
+	filePath, contentType := shimFile(hash, sig)
+	var shim *cachedShim
+	var err error
+	if sig != "" {
+		shim, err = s.readShim(filePath)
+	} else {
+		shim, err = s.readStoredShim(hash)
+	}
 	if err != nil {
-		if os.IsNotExist(err) {
+		if errors.Is(err, fs.ErrNotExist) {
 			http.NotFound(w, r)
 		} else {
 			http.Error(w, "internal server error", http.StatusInternalServerError)
 		}
 		return
 	}
+	data, etag, lastModified := shim.data, shim.etag, shim.modTime
+	if sig == "" && s.config.VerifyOnRead {
+		if _, err := registry.VerifyShimData(hash, data); err != nil {
+			http.Error(w, "shim failed verification", http.StatusInternalServerError)
+			return
+		}
+	}
 
-	// Compute ETag from content
-	etag := fmt.Sprintf(`"%x"`, sha256.Sum256(data))
+	// A compressed shim is served as stored to clients that accept gzip,
+	// and decompressed to the rest. The encodings have distinct ETags.
+	if shim.gzipped != nil {
+		w.Header().Set("Vary", "Accept-Encoding")
+		if acceptsGzip(r.Header.Get("Accept-Encoding")) {
+			data, etag = shim.gzipped, strings.TrimSuffix(etag, `"`)+`-gzip"`
+			w.Header().Set("Content-Encoding", "gzip")
+		}
+	}
+
+	w.Header().Set("Cache-Control", "public, max-age=86400, immutable")
+	w.Header().Set("ETag", etag)
+	setLastModified(w, lastModified)
 
-	// Check If-None-Match (conditional request support)
-	if r.Header.Get("If-None-Match") == etag {
-		w.Header().Set("ETag", etag)
-		w.Header().Set("Cache-Control", "public, max-age=86400, immutable")
+	// Conditional request support
+	if notModified(r, etag, lastModified) {
 		w.WriteHeader(http.StatusNotModified)
 		return
 	}
 
-	// Set headers
+	// ServeContent answers Range requests, so syncs can resume downloads.
+	// Conditions were checked above, so it's left only If-Range, against
+	// the ETag.
 	w.Header().Set("Content-Type", contentType)
+	r = r.Clone(r.Context())
+	for _, header := range []string{"If-Match", "If-None-Match", "If-Modified-Since", "If-Unmodified-Since"} {
+		r.Header.Del(header)
+	}
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(data))
+}
+
+// handleProvenance serves GET /provenance/sha256/{hash}.json
+//
+// Returns the registry.ShimProvenance of the shim with that hash, whose
+// provenance is null if the shim declares none, so clients can decide
+// whether to trust a shim without fetching its whole command tree. Responds
+// 404 if there is no such shim. Caching follows the shim, which is
+// immutable.
+func (s *Server) handleProvenance(w http.ResponseWriter, r *http.Request) {
+	hash := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, ProvenancePathPrefix), registry.ShimExtension)
+	if !hashRegex.MatchString(hash) {
+		http.Error(w, "invalid hash format: must be 64 lowercase hex characters", http.StatusBadRequest)
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	shim, err := s.readStoredShim(hash)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			http.NotFound(w, r)
+		} else {
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	// Derived from the shim, so it changes exactly when the shim does
+	etag := strings.TrimSuffix(shim.etag, `"`) + `-provenance"`
 	w.Header().Set("Cache-Control", "public, max-age=86400, immutable")
 	w.Header().Set("ETag", etag)
+	setLastModified(w, shim.modTime)
+	if notModified(r, etag, shim.modTime) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
 
+	var parsed *registry.Shim
+	if s.config.VerifyOnRead {
+		if parsed, err = registry.VerifyShimData(hash, shim.data); err != nil {
+			http.Error(w, "shim failed verification", http.StatusInternalServerError)
+			return
+		}
+	} else {
+		parsed = &registry.Shim{}
+		if err := json.Unmarshal(shim.data, parsed); err != nil {
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
+	data, _ := json.Marshal(registry.ProvenanceOf(parsed))
+
+	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	w.Write(data)
 }
 
+// shimFile returns the path in the data directory of the shim for hash, or
+// of its signature if sig is a signature extension, and the content type it
+// is served as.
+func shimFile(hash, sig string) (string, string) {
+	switch sig {
+	case registry.BundleExtension:
+		return path.Join(registry.ShimSubdir, hash+sig), "application/octet-stream"
+	case registry.MinisigExtension:
+		return path.Join(registry.ShimSubdir, hash+sig), "text/plain; charset=utf-8"
+	}
+	return path.Join(registry.ShimSubdir, hash+registry.ShimExtension), "application/json"
+}
+
+// readStoredShim returns the shim for hash as readShim does, from
+// {hash}.json or else {hash}.json.gz.
+func (s *Server) readStoredShim(hash string) (*cachedShim, error) {
+	filePath, _ := shimFile(hash, "")
+	shim, err := s.readShim(filePath)
+	if errors.Is(err, fs.ErrNotExist) {
+		shim, err = s.readShim(filePath + ".gz")
+	}
+	return shim, err
+}
+
+// readShim returns the shim or bundle at name in the data directory with
+// its ETag, from the shim cache unless the file's modification time or
+// size changed since it was cached. Each request stats the file, but only
+// a miss reads it. Compressed shims, named {hash}.json.gz, are cached both
+// as stored and decompressed.
+func (s *Server) readShim(name string) (*cachedShim, error) {
+	info, err := fs.Stat(s.files, name)
+	if err != nil {
+		s.shims.remove(name)
+		return nil, err
+	}
+	if shim, ok := s.shims.get(name, info.ModTime(), info.Size()); ok {
+		return shim, nil
+	}
+
+	data, err := fs.ReadFile(s.files, name)
+	if err != nil {
+		return nil, err
+	}
+	var gzipped []byte
+	if strings.HasSuffix(name, registry.CompressedShimExtension) {
+		gzipped = data
+		if data, err = registry.DecompressShim(gzipped); err != nil {
+			return nil, err
+		}
+	}
+	shim := &cachedShim{
+		path:    name,
+		data:    data,
+		gzipped: gzipped,
+		etag:    fmt.Sprintf(`"%x"`, sha256.Sum256(data)), // Computed from content
+		modTime: info.ModTime(),
+		size:    info.Size(),
+	}
+	s.shims.add(shim)
+	return shim, nil
+}
+
+// handleUpload serves PUT /shims/sha256/{hash}.json and /shims/sha256/{hash}.json.bundle
+//
+// Stores the request body as the shim (validated, and its binary.hash must
+// match the path) or as the signature bundle of an existing shim. Shims must
+// be sent as application/json and bundles as application/octet-stream.
+// Responds 401 without the upload token, 415 on any other Content-Type and
+// 413 if the body exceeds the upload limit, all before the body is read, and
+// 409 if the shim or bundle is already stored: uploads never replace one.
+func (s *Server) handleUpload(w http.ResponseWriter, r *http.Request, hash string, isBundle bool) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.config.UploadToken)) != 1 {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="atip-registry"`)
+		http.Error(w, "upload token required", http.StatusUnauthorized)
+		return
+	}
+
+	contentType := "application/json"
+	if isBundle {
+		contentType = "application/octet-stream"
+	}
+	if mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err != nil || mediaType != contentType {
+		http.Error(w, "Content-Type must be "+contentType, http.StatusUnsupportedMediaType)
+		return
+	}
+
+	// A declared length over the limit is rejected without reading the body
+	limit := s.maxUploadSize()
+	tooLarge := fmt.Sprintf("upload exceeds %d bytes", limit)
+	if r.ContentLength > limit {
+		http.Error(w, tooLarge, http.StatusRequestEntityTooLarge)
+		return
+	}
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, limit))
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			http.Error(w, tooLarge, http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "failed to read request body", http.StatusBadRequest)
+		return
+	}
+
+	if isBundle {
+		err = s.registry.CreateBundle(hash, data)
+	} else {
+		err = s.registry.CreateShim(hash, data)
+	}
+	switch {
+	case err == nil:
+		var sig string
+		if isBundle {
+			sig = registry.BundleExtension
+		}
+		filePath, _ := shimFile(hash, sig)
+		s.shims.remove(filePath)
+		s.shims.remove(filePath + ".gz") // The registry may store it compressed
+		s.InvalidateCatalog()
+		w.WriteHeader(http.StatusCreated)
+	case errors.Is(err, registry.ErrExists):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, registry.ErrNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, registry.ErrValidation), errors.Is(err, registry.ErrInvalidHash), errors.Is(err, registry.ErrHashMismatch):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+	}
+}
+
 // handleCatalog serves GET /shims/index.json
 //
 // Returns a browsable catalog of all shims in the registry, organized by tool name,
-// version, and platform. Supports conditional requests via If-None-Match header.
+// version, and platform. Supports conditional requests via If-None-Match and
+// If-Modified-Since, with Last-Modified the later of the catalog's Updated
+// time (its newest shim) and the shim directory's modification time, so
+// removing a shim also moves it forward.
 //
-// The catalog is dynamically generated on each request (not cached on disk).
-// Cached for 1 hour (per spec section 4.4.4).
+// The catalog is generated from the shims (not cached on disk) and kept in
+// memory between requests, see cachedCatalog. Cached for 1 hour (per spec
+// section 4.4.4). Clients that prefer application/x-ndjson in Accept get one
+// CatalogEntry per line instead.
 func (s *Server) handleCatalog(w http.ResponseWriter, r *http.Request) {
 	if s.registry == nil {
 		http.Error(w, "registry not initialized", http.StatusInternalServerError)
 		return
 	}
 
-	// Build catalog
-	catalog, err := s.registry.BuildCatalog()
+	cached, err := s.cachedCatalog()
 	if err != nil {
 		http.Error(w, "failed to build catalog: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	// Marshal to JSON
-	data, err := json.Marshal(catalog)
-	if err != nil {
-		http.Error(w, "failed to marshal catalog: "+err.Error(), http.StatusInternalServerError)
-		return
-	}
+	// Serve the representation the client asked for
+	contentType := negotiateCatalogType(r.Header.Get("Accept"))
+	encoded := cached.encodings[contentType]
 
-	// Compute ETag
-	etag := fmt.Sprintf(`"%x"`, sha256.Sum256(data))
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	w.Header().Set("Vary", "Accept")
+	w.Header().Set("ETag", encoded.etag)
+	setLastModified(w, cached.lastModified)
 
-	// Check If-None-Match (conditional request support)
-	if r.Header.Get("If-None-Match") == etag {
-		w.Header().Set("ETag", etag)
-		w.Header().Set("Cache-Control", "public, max-age=3600")
+	// Conditional request support
+	if notModified(r, encoded.etag, cached.lastModified) {
 		w.WriteHeader(http.StatusNotModified)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Cache-Control", "public, max-age=3600")
-	w.Header().Set("ETag", etag)
+	w.Header().Set("Content-Type", contentType)
 
 	w.WriteHeader(http.StatusOK)
-	w.Write(data)
+	w.Write(encoded.data)
+}
+
+// InvalidateCatalog drops the in-memory catalog, so the next catalog request
+// rebuilds it. Call it after changing the shims behind the server's back to
+// see the change before the TTL expires, or use Watch.
+func (s *Server) InvalidateCatalog() {
+	s.catalogMu.Lock()
+	s.catalog = nil
+	s.catalogMu.Unlock()
+}
+
+// cachedCatalog returns the in-memory catalog. Within the TTL it is served
+// as is. After that, it is kept if the shim directory's modification time
+// is unchanged, since adding or removing a shim changes it, and otherwise
+// rebuilt. Concurrent requests for a stale catalog wait for one rebuild.
+func (s *Server) cachedCatalog() (*cachedCatalog, error) {
+	ttl := s.config.CatalogTTL
+	if ttl == 0 {
+		ttl = DefaultCatalogTTL
+	}
+
+	s.catalogMu.RLock()
+	cached := s.catalog
+	fresh := cached != nil && s.now().Sub(cached.checked) < ttl
+	s.catalogMu.RUnlock()
+	if fresh {
+		return cached, nil
+	}
+
+	s.catalogMu.Lock()
+	defer s.catalogMu.Unlock()
+
+	// Another request may have refreshed it while we waited
+	now := s.now()
+	if s.catalog != nil && now.Sub(s.catalog.checked) < ttl {
+		return s.catalog, nil
+	}
+
+	shimsMod := s.shimsModTime()
+	if ttl > 0 && s.catalog != nil && !shimsMod.IsZero() && shimsMod.Equal(s.catalog.shimsMod) {
+		refreshed := *s.catalog
+		refreshed.checked = now
+		s.catalog = &refreshed
+		return s.catalog, nil
+	}
+
+	catalog, err := s.buildCatalog()
+	if err != nil {
+		return nil, err
+	}
+	cached = &cachedCatalog{
+		catalog:   catalog,
+		encodings: make(map[string]encodedCatalog),
+		shimsMod:  shimsMod,
+		checked:   now,
+	}
+	if !s.config.ReproducibleCatalog {
+		cached.lastModified = catalog.Updated
+		if shimsMod.After(cached.lastModified) {
+			cached.lastModified = shimsMod
+		}
+	}
+	for _, contentType := range []string{"application/json", ContentTypeNDJSON} {
+		var data []byte
+		if contentType == ContentTypeNDJSON {
+			data, err = marshalCatalogNDJSON(catalog)
+		} else {
+			data, err = json.Marshal(catalog)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal catalog: %w", err)
+		}
+
+		// ETags are distinct per representation
+		etag := fmt.Sprintf(`"%x"`, sha256.Sum256(append([]byte(contentType+"\n"), data...)))
+		cached.encodings[contentType] = encodedCatalog{data: data, etag: etag}
+	}
+	s.catalog = cached
+	return cached, nil
+}
+
+// shimsModTime returns the modification time of the shim directory, or the
+// zero time if it can't be read.
+func (s *Server) shimsModTime() time.Time {
+	info, err := os.Stat(filepath.Join(s.config.DataDir, filepath.FromSlash(registry.ShimSubdir)))
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+// CatalogEntry is one line of the NDJSON catalog: a tool and its versions.
+type CatalogEntry struct {
+	Name string `json:"name"`
+	registry.ToolInfo
+}
+
+// marshalCatalogNDJSON encodes the catalog's tools as newline-delimited
+// JSON, one CatalogEntry per line, sorted by name.
+func marshalCatalogNDJSON(catalog *registry.Catalog) ([]byte, error) {
+	names := make([]string, 0, len(catalog.Tools))
+	for name := range catalog.Tools {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	for _, name := range names {
+		if err := encoder.Encode(CatalogEntry{Name: name, ToolInfo: catalog.Tools[name]}); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// negotiateCatalogType picks the catalog media type for an Accept header:
+// ContentTypeNDJSON if the client prefers it over JSON, else
+// application/json. Wildcards count as JSON, so JSON wins ties.
+func negotiateCatalogType(accept string) string {
+	jsonQ, ndjsonQ := -1.0, -1.0
+	for _, mediaRange := range strings.Split(accept, ",") {
+		mediaType, params, _ := strings.Cut(mediaRange, ";")
+		q := qValue(params)
+		switch strings.ToLower(strings.TrimSpace(mediaType)) {
+		case ContentTypeNDJSON:
+			ndjsonQ = math.Max(ndjsonQ, q)
+		case "application/json", "application/*", "*/*":
+			jsonQ = math.Max(jsonQ, q)
+		}
+	}
+	if ndjsonQ > 0 && ndjsonQ > jsonQ {
+		return ContentTypeNDJSON
+	}
+	return "application/json"
+}
+
+// acceptsGzip reports whether an Accept-Encoding header allows gzip: named
+// with a nonzero q, or else matched by a "*" with a nonzero q.
+func acceptsGzip(acceptEncoding string) bool {
+	gzipQ, anyQ := -1.0, -1.0
+	for _, coding := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(coding, ";")
+		q := qValue(params)
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "gzip", "x-gzip":
+			gzipQ = math.Max(gzipQ, q)
+		case "*":
+			anyQ = math.Max(anyQ, q)
+		}
+	}
+	if gzipQ >= 0 {
+		return gzipQ > 0
+	}
+	return anyQ > 0
+}
+
+// qValue returns the quality weight among the parameters of an Accept or
+// Accept-Encoding element, 1 if it has none.
+func qValue(params string) float64 {
+	q := 1.0
+	for _, param := range strings.Split(params, ";") {
+		if value, ok := strings.CutPrefix(strings.TrimSpace(param), "q="); ok {
+			if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+				q = parsed
+			}
+		}
+	}
+	return q
 }
 
 // handleHealth serves GET /health
@@ -257,7 +842,7 @@ func (s *Server) handleCatalog(w http.ResponseWriter, r *http.Request) {
 func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
 	health := map[string]interface{}{
 		"status":  "healthy",
-		"version": "0.1.0",
+		"version": version,
 	}
 
 	// Try to get shim count
@@ -272,7 +857,7 @@ func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
 	health["storage"] = map[string]interface{}{
 		"type":     "filesystem",
 		"path":     s.config.DataDir,
-		"writable": true,
+		"writable": s.uploadsEnabled(),
 	}
 
 	data, _ := json.Marshal(health)
@@ -281,3 +866,35 @@ func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	w.Write(data)
 }
+
+// setLastModified sets the Last-Modified header unless lastModified is unknown.
+func setLastModified(w http.ResponseWriter, lastModified time.Time) {
+	if !lastModified.IsZero() {
+		w.Header().Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	}
+}
+
+// notModified evaluates conditional request headers per RFC 7232 section 6.
+// If-None-Match takes precedence; If-Modified-Since is only considered when
+// it is absent, and only for GET and HEAD. An If-Modified-Since date that is
+// unparseable or later than the current time is ignored.
+func notModified(r *http.Request, etag string, lastModified time.Time) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		return inm == etag
+	}
+
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	ims := r.Header.Get("If-Modified-Since")
+	if ims == "" || lastModified.IsZero() {
+		return false
+	}
+	since, err := http.ParseTime(ims)
+	if err != nil || since.After(time.Now()) {
+		return false
+	}
+
+	// HTTP dates have one-second resolution
+	return !lastModified.Truncate(time.Second).After(since)
+}
@@ -1,10 +1,23 @@
 package server
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/anthropics/atip/reference/atip-registry/internal/registry"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -104,6 +117,129 @@ func TestServer_GetShimByHash(t *testing.T) {
 	}
 }
 
+func TestServer_VerifyOnRead(t *testing.T) {
+	dataDir := t.TempDir()
+	shimDir := filepath.Join(dataDir, "shims", "sha256")
+	require.NoError(t, os.MkdirAll(shimDir, 0755))
+	hash := strings.Repeat("ab", 32)
+	name := filepath.Join(shimDir, hash+".json")
+	shim := fmt.Sprintf(`{"atip": {"version": "0.6"}, "binary": {"hash": "sha256:%s"}, "name": "jq", "version": "1.7.1"}`, hash)
+	require.NoError(t, os.WriteFile(name, []byte(shim), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(shimDir, hash+".json.bundle"), []byte("bundle"), 0644))
+
+	get := func(server *Server, path string) int {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		return w.Code
+	}
+	verifying := NewServer(&Config{DataDir: dataDir, VerifyOnRead: true})
+	plain := NewServer(&Config{DataDir: dataDir})
+
+	assert.Equal(t, http.StatusOK, get(verifying, ShimsPathPrefix+hash+".json"))
+	assert.Equal(t, http.StatusOK, get(verifying, ProvenancePathPrefix+hash+".json"))
+
+	// Corrupt the shim on disk: only the verifying server refuses it
+	require.NoError(t, os.WriteFile(name, []byte(shim[:len(shim)-10]), 0644))
+	assert.Equal(t, http.StatusInternalServerError, get(verifying, ShimsPathPrefix+hash+".json"))
+	assert.Equal(t, http.StatusInternalServerError, get(verifying, ProvenancePathPrefix+hash+".json"))
+	assert.Equal(t, http.StatusOK, get(plain, ShimsPathPrefix+hash+".json"))
+
+	// Bundles aren't shims, and are served as is
+	assert.Equal(t, http.StatusOK, get(verifying, ShimsPathPrefix+hash+".json.bundle"))
+}
+
+func TestServer_CompressedShim(t *testing.T) {
+	dataDir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dataDir, ".well-known"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dataDir, ".well-known", "atip-registry.json"), []byte(`{}`), 0644))
+	reg, err := registry.Load(dataDir)
+	require.NoError(t, err)
+	require.NoError(t, reg.SetCompression(registry.CompressionGzip))
+
+	hash := strings.Repeat("ab", 32)
+	shim := fmt.Sprintf(`{"atip": {"version": "0.6"}, "binary": {"hash": "sha256:%s"}, "name": "jq", "version": "1.7.1"}`, hash)
+	path := ShimsPathPrefix + hash + ".json"
+
+	require.NoError(t, reg.PutShim(hash, []byte(shim)))
+	server := NewServer(&Config{DataDir: dataDir, VerifyOnRead: true})
+	stored, err := os.ReadFile(filepath.Join(dataDir, registry.ShimPath(hash)+".gz"))
+	require.NoError(t, err)
+
+	get := func(acceptEncoding, ifNoneMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if acceptEncoding != "" {
+			req.Header.Set("Accept-Encoding", acceptEncoding)
+		}
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		return w
+	}
+
+	// Served as stored to clients that accept gzip
+	compressed := get("gzip, deflate", "")
+	require.Equal(t, http.StatusOK, compressed.Code)
+	assert.Equal(t, "gzip", compressed.Header().Get("Content-Encoding"))
+	assert.Equal(t, "Accept-Encoding", compressed.Header().Get("Vary"))
+	assert.Equal(t, "application/json", compressed.Header().Get("Content-Type"))
+	assert.Equal(t, stored, compressed.Body.Bytes())
+	data, err := registry.DecompressShim(compressed.Body.Bytes())
+	require.NoError(t, err)
+	assert.Equal(t, shim, string(data))
+
+	// Decompressed for the rest
+	for _, acceptEncoding := range []string{"", "identity", "gzip;q=0, *"} {
+		plain := get(acceptEncoding, "")
+		require.Equal(t, http.StatusOK, plain.Code, acceptEncoding)
+		assert.Empty(t, plain.Header().Get("Content-Encoding"), acceptEncoding)
+		assert.Equal(t, "Accept-Encoding", plain.Header().Get("Vary"))
+		assert.Equal(t, shim, plain.Body.String(), acceptEncoding)
+	}
+
+	// Each encoding has its own ETag
+	plainETag := get("", "").Header().Get("ETag")
+	gzipETag := compressed.Header().Get("ETag")
+	assert.NotEqual(t, plainETag, gzipETag)
+	assert.Equal(t, http.StatusNotModified, get("", plainETag).Code)
+	assert.Equal(t, http.StatusNotModified, get("gzip", gzipETag).Code)
+	assert.Equal(t, http.StatusOK, get("", gzipETag).Code)
+
+	// The plain ETag is the one the shim has when stored uncompressed
+	require.NoError(t, os.Remove(filepath.Join(dataDir, registry.ShimPath(hash)+".gz")))
+	require.NoError(t, os.WriteFile(filepath.Join(dataDir, registry.ShimPath(hash)), []byte(shim), 0644))
+	uncompressed := get("gzip", "")
+	assert.Empty(t, uncompressed.Header().Get("Content-Encoding"))
+	assert.Equal(t, plainETag, uncompressed.Header().Get("ETag"))
+}
+
+func TestAcceptsGzip(t *testing.T) {
+	tests := []struct {
+		acceptEncoding string
+		want           bool
+	}{
+		{acceptEncoding: "", want: false},
+		{acceptEncoding: "identity", want: false},
+		{acceptEncoding: "gzip", want: true},
+		{acceptEncoding: "GZIP", want: true},
+		{acceptEncoding: "x-gzip", want: true},
+		{acceptEncoding: "deflate, gzip;q=0.5", want: true},
+		{acceptEncoding: "gzip;q=0", want: false},
+		{acceptEncoding: "*", want: true},
+		{acceptEncoding: "*;q=0", want: false},
+		{acceptEncoding: "gzip;q=0, *", want: false},
+		{acceptEncoding: "gzip, *;q=0", want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.acceptEncoding, func(t *testing.T) {
+			assert.Equal(t, tt.want, acceptsGzip(tt.acceptEncoding))
+		})
+	}
+}
+
 func TestServer_GetShimWithConditionalRequest(t *testing.T) {
 	validHash := "a1b2c3d4e5f6a1b2c3d4e5f6a1b2c3d4e5f6a1b2c3d4e5f6a1b2c3d4e5f6a1b2"
 
@@ -130,6 +266,301 @@ func TestServer_GetShimWithConditionalRequest(t *testing.T) {
 	assert.Equal(t, etag, w2.Header().Get("ETag"))
 }
 
+func TestServer_GetShimRange(t *testing.T) {
+	validHash := "a1b2c3d4e5f6a1b2c3d4e5f6a1b2c3d4e5f6a1b2c3d4e5f6a1b2c3d4e5f6a1b2"
+	path := "/shims/sha256/" + validHash + ".json"
+
+	server := NewServer(&Config{
+		DataDir: "../../testdata",
+	})
+
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "bytes", w.Header().Get("Accept-Ranges"))
+	full := w.Body.String()
+	etag := w.Header().Get("ETag")
+
+	// The rest of the shim from an offset
+	req = httptest.NewRequest(http.MethodGet, path, nil)
+	req.Header.Set("Range", "bytes=10-")
+	w = httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusPartialContent, w.Code)
+	assert.Equal(t, fmt.Sprintf("bytes 10-%d/%d", len(full)-1, len(full)), w.Header().Get("Content-Range"))
+	assert.Equal(t, full[10:], w.Body.String())
+
+	// If-Range with a stale ETag gets the whole shim
+	req = httptest.NewRequest(http.MethodGet, path, nil)
+	req.Header.Set("Range", "bytes=10-")
+	req.Header.Set("If-Range", `"stale"`)
+	w = httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, full, w.Body.String())
+
+	req.Header.Set("If-Range", etag)
+	w = httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusPartialContent, w.Code)
+}
+
+func TestServer_GetShimIfModifiedSince(t *testing.T) {
+	validHash := "a1b2c3d4e5f6a1b2c3d4e5f6a1b2c3d4e5f6a1b2c3d4e5f6a1b2c3d4e5f6a1b2"
+	path := "/shims/sha256/" + validHash + ".json"
+
+	server := NewServer(&Config{
+		DataDir: "../../testdata",
+	})
+
+	now := time.Now().UTC().Format(http.TimeFormat)
+	past := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC).Format(http.TimeFormat)
+	future := time.Now().Add(24 * time.Hour).UTC().Format(http.TimeFormat)
+
+	tests := []struct {
+		name           string
+		ifModified     string
+		ifNoneMatch    string
+		method         string
+		expectedStatus int
+	}{
+		{
+			name:           "past date returns full response",
+			ifModified:     past,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "date after modification returns 304",
+			ifModified:     now,
+			expectedStatus: http.StatusNotModified,
+		},
+		{
+			name:           "future date is ignored",
+			ifModified:     future,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "invalid date is ignored",
+			ifModified:     "yesterday",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "If-None-Match takes precedence",
+			ifModified:     now,
+			ifNoneMatch:    `"stale"`,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "HEAD request returns 304",
+			ifModified:     now,
+			method:         http.MethodHead,
+			expectedStatus: http.StatusNotModified,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			method := tt.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			req := httptest.NewRequest(method, path, nil)
+			req.Header.Set("If-Modified-Since", tt.ifModified)
+			if tt.ifNoneMatch != "" {
+				req.Header.Set("If-None-Match", tt.ifNoneMatch)
+			}
+			w := httptest.NewRecorder()
+			server.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			assert.NotEmpty(t, w.Header().Get("Last-Modified"))
+			assert.Equal(t, "public, max-age=86400, immutable", w.Header().Get("Cache-Control"))
+			if tt.expectedStatus == http.StatusNotModified {
+				assert.Empty(t, w.Body.Bytes())
+			}
+		})
+	}
+}
+
+// countingFS counts the files read from an fs.FS.
+type countingFS struct {
+	fs.FS
+	mu    sync.Mutex
+	reads map[string]int
+}
+
+func (c *countingFS) ReadFile(name string) ([]byte, error) {
+	c.mu.Lock()
+	c.reads[name]++
+	c.mu.Unlock()
+	return fs.ReadFile(c.FS, name)
+}
+
+func (c *countingFS) Stat(name string) (fs.FileInfo, error) {
+	return fs.Stat(c.FS, name)
+}
+
+func (c *countingFS) count(name string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.reads[name]
+}
+
+func TestServer_ShimCache(t *testing.T) {
+	dataDir := t.TempDir()
+	shimDir := filepath.Join(dataDir, "shims", "sha256")
+	require.NoError(t, os.MkdirAll(shimDir, 0755))
+	hash := strings.Repeat("ab", 32)
+	name := "shims/sha256/" + hash + ".json"
+	shim := fmt.Sprintf(`{"atip": {"version": "0.6"}, "binary": {"hash": "sha256:%s"}, "name": "jq", "version": "1.0.0"}`, hash)
+	require.NoError(t, os.WriteFile(filepath.Join(dataDir, name), []byte(shim), 0644))
+
+	server := NewServer(&Config{DataDir: dataDir})
+	files := &countingFS{FS: server.files, reads: make(map[string]int)}
+	server.files = files
+
+	get := func(header ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/"+name, nil)
+		for i := 0; i+1 < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		return w
+	}
+
+	// A second fetch is served from memory, with the same headers
+	w1 := get()
+	require.Equal(t, http.StatusOK, w1.Code)
+	w2 := get()
+	require.Equal(t, http.StatusOK, w2.Code)
+	assert.Equal(t, 1, files.count(name))
+	assert.Equal(t, w1.Body.String(), w2.Body.String())
+	assert.Equal(t, w1.Header().Get("ETag"), w2.Header().Get("ETag"))
+	assert.Equal(t, w1.Header().Get("Last-Modified"), w2.Header().Get("Last-Modified"))
+
+	// Conditional requests behave as uncached
+	assert.Equal(t, http.StatusNotModified, get("If-None-Match", w1.Header().Get("ETag")).Code)
+	assert.Equal(t, http.StatusNotModified, get("If-Modified-Since", w1.Header().Get("Last-Modified")).Code)
+	assert.Equal(t, 1, files.count(name))
+
+	// A changed file is read again
+	updated := strings.Replace(shim, "1.0.0", "1.0.1", 1)
+	require.NoError(t, os.WriteFile(filepath.Join(dataDir, name), []byte(updated), 0644))
+	future := time.Now().Add(time.Hour)
+	require.NoError(t, os.Chtimes(filepath.Join(dataDir, name), future, future))
+	w3 := get()
+	assert.Equal(t, updated, w3.Body.String())
+	assert.NotEqual(t, w1.Header().Get("ETag"), w3.Header().Get("ETag"))
+	assert.Equal(t, 2, files.count(name))
+
+	// A removed file is gone, not served from memory
+	require.NoError(t, os.Remove(filepath.Join(dataDir, name)))
+	assert.Equal(t, http.StatusNotFound, get().Code)
+}
+
+func TestServer_ShimCache_Disabled(t *testing.T) {
+	server := NewServer(&Config{DataDir: "../../testdata", ShimCacheSize: -1})
+	files := &countingFS{FS: server.files, reads: make(map[string]int)}
+	server.files = files
+
+	hash := "a1b2c3d4e5f6a1b2c3d4e5f6a1b2c3d4e5f6a1b2c3d4e5f6a1b2c3d4e5f6a1b2"
+	for i := 0; i < 3; i++ {
+		req := httptest.NewRequest(http.MethodGet, ShimsPathPrefix+hash+".json", nil)
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+	}
+	assert.Equal(t, 3, files.count("shims/sha256/"+hash+".json"))
+}
+
+func TestShimCache_Evicts(t *testing.T) {
+	modTime := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	entry := func(path string, size int) *cachedShim {
+		return &cachedShim{path: path, data: make([]byte, size), modTime: modTime, size: int64(size)}
+	}
+
+	cache := newShimCache(10)
+	cache.add(entry("a", 4))
+	cache.add(entry("b", 4))
+	_, ok := cache.get("a", modTime, 4)
+	require.True(t, ok)
+
+	// Least recently used goes first
+	cache.add(entry("c", 4))
+	_, ok = cache.get("b", modTime, 4)
+	assert.False(t, ok)
+	_, ok = cache.get("a", modTime, 4)
+	assert.True(t, ok)
+	assert.Equal(t, int64(8), cache.size)
+
+	// Larger than the cache isn't cached, and stale entries are dropped
+	cache.add(entry("big", 11))
+	_, ok = cache.get("big", modTime, 11)
+	assert.False(t, ok)
+	_, ok = cache.get("c", modTime.Add(time.Second), 4)
+	assert.False(t, ok)
+	assert.Equal(t, int64(4), cache.size)
+}
+
+func TestServer_GetProvenance(t *testing.T) {
+	dataDir := t.TempDir()
+	shimDir := filepath.Join(dataDir, "shims", "sha256")
+	require.NoError(t, os.MkdirAll(shimDir, 0755))
+	withProvenance, without := strings.Repeat("ab", 32), strings.Repeat("cd", 32)
+	shim := `{"atip": {"version": "0.6"}, "binary": {"hash": "sha256:%s", "platform": "linux-amd64"}, "name": "jq", "version": "1.7.1", "trust": %s}`
+	require.NoError(t, os.WriteFile(filepath.Join(shimDir, withProvenance+".json"), []byte(fmt.Sprintf(shim, withProvenance,
+		`{"source": "native", "verified": true, "provenance": {"url": "https://example.com/jq.intoto.jsonl", "format": "slsa-provenance-v1", "slsaLevel": 3, "builder": "https://github.com/actions/runner"}}`)), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(shimDir, without+".json"), []byte(fmt.Sprintf(shim, without, `{"source": "community"}`)), 0644))
+
+	server := NewServer(&Config{DataDir: dataDir})
+	get := func(hash string, header ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, ProvenancePathPrefix+hash+".json", nil)
+		for i := 0; i+1 < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		return w
+	}
+
+	w := get(withProvenance)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	var provenance registry.ShimProvenance
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &provenance))
+	assert.Equal(t, registry.ShimProvenance{
+		Hash: "sha256:" + withProvenance, Name: "jq", Version: "1.7.1", Platform: "linux-amd64",
+		Provenance: &registry.Provenance{
+			URL: "https://example.com/jq.intoto.jsonl", Format: "slsa-provenance-v1",
+			SLSALevel: 3, Builder: "https://github.com/actions/runner",
+		},
+	}, provenance)
+
+	// Its ETag differs from the shim's, and is honored
+	etag := w.Header().Get("ETag")
+	require.NotEmpty(t, etag)
+	shimReq := httptest.NewRequest(http.MethodGet, ShimsPathPrefix+withProvenance+".json", nil)
+	shimW := httptest.NewRecorder()
+	server.ServeHTTP(shimW, shimReq)
+	assert.NotEqual(t, shimW.Header().Get("ETag"), etag)
+	assert.Equal(t, http.StatusNotModified, get(withProvenance, "If-None-Match", etag).Code)
+
+	// A shim without provenance reports null
+	w = get(without)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"provenance":null`)
+
+	assert.Equal(t, http.StatusNotFound, get(strings.Repeat("ef", 32)).Code)
+	assert.Equal(t, http.StatusBadRequest, get("not-a-hash").Code)
+
+	req := httptest.NewRequest(http.MethodPut, ProvenancePathPrefix+withProvenance+".json", strings.NewReader("{}"))
+	w = httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+}
+
 func TestServer_GetSignatureBundle(t *testing.T) {
 	validHash := "a1b2c3d4e5f6a1b2c3d4e5f6a1b2c3d4e5f6a1b2c3d4e5f6a1b2c3d4e5f6a1b2"
 
@@ -171,6 +602,37 @@ func TestServer_GetSignatureBundle(t *testing.T) {
 	}
 }
 
+func TestServer_GetMinisignSignature(t *testing.T) {
+	dataDir := t.TempDir()
+	shimDir := filepath.Join(dataDir, "shims", "sha256")
+	require.NoError(t, os.MkdirAll(shimDir, 0755))
+	hash := strings.Repeat("cd", 32)
+	signature := "untrusted comment: signature from minisign secret key\nRUQ...\n"
+	require.NoError(t, os.WriteFile(filepath.Join(shimDir, hash+".json.minisig"), []byte(signature), 0644))
+
+	server := NewServer(&Config{DataDir: dataDir})
+	do := func(method, hash string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, ShimsPathPrefix+hash+".json.minisig", strings.NewReader(signature))
+		req.Header.Set("Content-Type", "text/plain")
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do(http.MethodGet, hash)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, signature, w.Body.String())
+	assert.Equal(t, "text/plain; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Equal(t, "public, max-age=86400, immutable", w.Header().Get("Cache-Control"))
+	assert.NotEmpty(t, w.Header().Get("ETag"))
+
+	assert.Equal(t, http.StatusNotFound, do(http.MethodGet, strings.Repeat("0", 64)).Code)
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodGet, "not-a-hash").Code)
+
+	// Only bundles can be uploaded
+	assert.Equal(t, http.StatusMethodNotAllowed, do(http.MethodPut, hash).Code)
+}
+
 func TestServer_GetCatalog(t *testing.T) {
 	server := NewServer(&Config{
 		DataDir: "../../testdata",
@@ -190,6 +652,276 @@ func TestServer_GetCatalog(t *testing.T) {
 	// Will fail until implementation exists
 }
 
+func TestServer_GetCatalogConditional(t *testing.T) {
+	server := NewServer(&Config{
+		DataDir: "../../testdata",
+	})
+
+	req1 := httptest.NewRequest(http.MethodGet, CatalogPath, nil)
+	w1 := httptest.NewRecorder()
+	server.ServeHTTP(w1, req1)
+	require.Equal(t, http.StatusOK, w1.Code)
+
+	etag := w1.Header().Get("ETag")
+	lastModified := w1.Header().Get("Last-Modified")
+	require.NotEmpty(t, etag)
+	require.NotEmpty(t, lastModified)
+
+	// ETag is stable between requests
+	req2 := httptest.NewRequest(http.MethodGet, CatalogPath, nil)
+	req2.Header.Set("If-None-Match", etag)
+	w2 := httptest.NewRecorder()
+	server.ServeHTTP(w2, req2)
+	assert.Equal(t, http.StatusNotModified, w2.Code)
+
+	req3 := httptest.NewRequest(http.MethodGet, CatalogPath, nil)
+	req3.Header.Set("If-Modified-Since", lastModified)
+	w3 := httptest.NewRecorder()
+	server.ServeHTTP(w3, req3)
+	assert.Equal(t, http.StatusNotModified, w3.Code)
+	assert.Equal(t, lastModified, w3.Header().Get("Last-Modified"))
+}
+
+func TestServer_CatalogLastModifiedAfterRemoval(t *testing.T) {
+	dataDir := t.TempDir()
+	shimDir := filepath.Join(dataDir, "shims", "sha256")
+	require.NoError(t, os.MkdirAll(shimDir, 0755))
+	past := time.Now().Add(-24 * time.Hour)
+	var newest string
+	for i, hash := range []string{strings.Repeat("ab", 32), strings.Repeat("cd", 32)} {
+		shim := fmt.Sprintf(`{"atip": {"version": "0.6"}, "binary": {"hash": "sha256:%s", "platform": "linux-amd64"}, "name": "jq", "version": "1.%d.0"}`, hash, i)
+		newest = filepath.Join(shimDir, hash+".json")
+		require.NoError(t, os.WriteFile(newest, []byte(shim), 0644))
+		modTime := past.Add(time.Duration(i) * time.Hour)
+		require.NoError(t, os.Chtimes(newest, modTime, modTime))
+	}
+	require.NoError(t, os.Chtimes(shimDir, past, past))
+
+	server := NewServer(&Config{DataDir: dataDir})
+	get := func(header ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, CatalogPath, nil)
+		for i := 0; i+1 < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		return w
+	}
+	w1 := get()
+	require.Equal(t, http.StatusOK, w1.Code)
+	lastModified := w1.Header().Get("Last-Modified")
+	assert.Equal(t, past.Add(time.Hour).UTC().Format(http.TimeFormat), lastModified)
+
+	// Removing the newest shim leaves an older Updated time, but the
+	// catalog changed, so it isn't reported as unmodified
+	require.NoError(t, os.Remove(newest))
+	removed := past.Add(2 * time.Hour)
+	require.NoError(t, os.Chtimes(shimDir, removed, removed))
+	server.InvalidateCatalog()
+	w2 := get("If-Modified-Since", lastModified)
+	assert.Equal(t, http.StatusOK, w2.Code)
+	assert.Equal(t, removed.UTC().Format(http.TimeFormat), w2.Header().Get("Last-Modified"))
+	assert.Equal(t, http.StatusNotModified, get("If-Modified-Since", w2.Header().Get("Last-Modified")).Code)
+}
+
+func TestServer_ReproducibleCatalog(t *testing.T) {
+	// Two replicas with the same shim written a day apart
+	hash := strings.Repeat("ab", 32)
+	shim := fmt.Sprintf(`{"atip": {"version": "0.6"}, "binary": {"hash": "sha256:%s", "platform": "linux-amd64"}, "name": "jq", "version": "1.7.1"}`, hash)
+	etags := make([]string, 2)
+	for i := range etags {
+		dataDir := t.TempDir()
+		shimDir := filepath.Join(dataDir, "shims", "sha256")
+		require.NoError(t, os.MkdirAll(shimDir, 0755))
+		name := filepath.Join(shimDir, hash+".json")
+		require.NoError(t, os.WriteFile(name, []byte(shim), 0644))
+		modTime := time.Now().Add(-time.Duration(i) * 24 * time.Hour)
+		require.NoError(t, os.Chtimes(name, modTime, modTime))
+
+		server := NewServer(&Config{DataDir: dataDir, ReproducibleCatalog: true})
+		req := httptest.NewRequest(http.MethodGet, CatalogPath, nil)
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		assert.Empty(t, w.Header().Get("Last-Modified"))
+		etags[i] = w.Header().Get("ETag")
+		require.NotEmpty(t, etags[i])
+
+		// Conditional requests still work by ETag
+		req = httptest.NewRequest(http.MethodGet, CatalogPath, nil)
+		req.Header.Set("If-None-Match", etags[i])
+		w = httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusNotModified, w.Code)
+	}
+	assert.Equal(t, etags[0], etags[1])
+}
+
+func TestServer_GetCatalogNDJSON(t *testing.T) {
+	server := NewServer(&Config{
+		DataDir: "../../testdata",
+	})
+
+	reqJSON := httptest.NewRequest(http.MethodGet, CatalogPath, nil)
+	wJSON := httptest.NewRecorder()
+	server.ServeHTTP(wJSON, reqJSON)
+	require.Equal(t, http.StatusOK, wJSON.Code)
+	var catalog registry.Catalog
+	require.NoError(t, json.Unmarshal(wJSON.Body.Bytes(), &catalog))
+	require.NotEmpty(t, catalog.Tools)
+
+	req := httptest.NewRequest(http.MethodGet, CatalogPath, nil)
+	req.Header.Set("Accept", ContentTypeNDJSON)
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, ContentTypeNDJSON, w.Header().Get("Content-Type"))
+	assert.Equal(t, "Accept", w.Header().Get("Vary"))
+
+	// Each line is one tool entry, in name order
+	lines := strings.Split(strings.TrimSuffix(w.Body.String(), "\n"), "\n")
+	require.Len(t, lines, len(catalog.Tools))
+	var names []string
+	for _, line := range lines {
+		var entry CatalogEntry
+		require.NoError(t, json.Unmarshal([]byte(line), &entry), "line: %s", line)
+		require.Contains(t, catalog.Tools, entry.Name)
+		assert.Equal(t, catalog.Tools[entry.Name], entry.ToolInfo)
+		names = append(names, entry.Name)
+	}
+	assert.True(t, sort.StringsAreSorted(names))
+
+	// Each representation has its own ETag
+	etag := w.Header().Get("ETag")
+	require.NotEmpty(t, etag)
+	assert.NotEqual(t, wJSON.Header().Get("ETag"), etag)
+
+	req2 := httptest.NewRequest(http.MethodGet, CatalogPath, nil)
+	req2.Header.Set("Accept", ContentTypeNDJSON)
+	req2.Header.Set("If-None-Match", etag)
+	w2 := httptest.NewRecorder()
+	server.ServeHTTP(w2, req2)
+	assert.Equal(t, http.StatusNotModified, w2.Code)
+
+	req3 := httptest.NewRequest(http.MethodGet, CatalogPath, nil)
+	req3.Header.Set("If-None-Match", etag)
+	w3 := httptest.NewRecorder()
+	server.ServeHTTP(w3, req3)
+	assert.Equal(t, http.StatusOK, w3.Code)
+}
+
+// countBuilds makes server count its catalog builds.
+func countBuilds(server *Server) *int32 {
+	var builds int32
+	build := server.buildCatalog
+	server.buildCatalog = func() (*registry.Catalog, error) {
+		atomic.AddInt32(&builds, 1)
+		return build()
+	}
+	return &builds
+}
+
+func TestServer_CatalogCache(t *testing.T) {
+	dataDir := t.TempDir()
+	shimDir := filepath.Join(dataDir, "shims", "sha256")
+	require.NoError(t, os.MkdirAll(shimDir, 0755))
+	writeShim := func(name string, hash string) {
+		shim := fmt.Sprintf(`{"atip": {"version": "0.6"}, "binary": {"hash": "sha256:%s"}, "name": %q, "version": "1.0.0"}`, hash, name)
+		require.NoError(t, os.WriteFile(filepath.Join(shimDir, hash+".json"), []byte(shim), 0644))
+	}
+	writeShim("jq", strings.Repeat("ab", 32))
+
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	server := NewServer(&Config{DataDir: dataDir, CatalogTTL: time.Minute})
+	server.now = func() time.Time { return now }
+	builds := countBuilds(server)
+
+	get := func() (string, registry.Catalog) {
+		req := httptest.NewRequest(http.MethodGet, CatalogPath, nil)
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+		var catalog registry.Catalog
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &catalog))
+		return w.Header().Get("ETag"), catalog
+	}
+
+	// Rapid requests share one build
+	etag, _ := get()
+	etag2, _ := get()
+	assert.Equal(t, int32(1), atomic.LoadInt32(builds))
+	assert.Equal(t, etag, etag2)
+
+	// Concurrent requests for a stale catalog wait for one rebuild
+	server.InvalidateCatalog()
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req := httptest.NewRequest(http.MethodGet, CatalogPath, nil)
+			server.ServeHTTP(httptest.NewRecorder(), req)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(2), atomic.LoadInt32(builds))
+
+	// Past the TTL, an unchanged shim directory keeps the catalog
+	now = now.Add(2 * time.Minute)
+	get()
+	assert.Equal(t, int32(2), atomic.LoadInt32(builds))
+
+	// A shim added on disk shows up once the TTL expires
+	writeShim("yq", strings.Repeat("cd", 32))
+	future := time.Now().Add(time.Hour)
+	require.NoError(t, os.Chtimes(shimDir, future, future))
+	_, catalog := get()
+	assert.NotContains(t, catalog.Tools, "yq")
+	now = now.Add(2 * time.Minute)
+	_, catalog = get()
+	assert.Equal(t, int32(3), atomic.LoadInt32(builds))
+	assert.Contains(t, catalog.Tools, "yq")
+}
+
+func TestServer_CatalogCache_Disabled(t *testing.T) {
+	server := NewServer(&Config{DataDir: "../../testdata", CatalogTTL: -1})
+	builds := countBuilds(server)
+
+	for i := 0; i < 3; i++ {
+		req := httptest.NewRequest(http.MethodGet, CatalogPath, nil)
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+	}
+	assert.Equal(t, int32(3), atomic.LoadInt32(builds))
+}
+
+func TestNegotiateCatalogType(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   string
+	}{
+		{accept: "", want: "application/json"},
+		{accept: "application/json", want: "application/json"},
+		{accept: "*/*", want: "application/json"},
+		{accept: "application/x-ndjson", want: ContentTypeNDJSON},
+		{accept: "Application/X-NDJSON", want: ContentTypeNDJSON},
+		{accept: "application/x-ndjson, application/json;q=0.5", want: ContentTypeNDJSON},
+		{accept: "application/x-ndjson;q=0.5, application/json", want: "application/json"},
+		{accept: "application/x-ndjson, */*", want: "application/json"},
+		{accept: "application/x-ndjson;q=0", want: "application/json"},
+		{accept: "text/html", want: "application/json"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.accept, func(t *testing.T) {
+			assert.Equal(t, tt.want, negotiateCatalogType(tt.accept))
+		})
+	}
+}
+
 func TestServer_HealthCheck(t *testing.T) {
 	server := NewServer(&Config{
 		DataDir: "../../testdata",
@@ -207,6 +939,194 @@ func TestServer_HealthCheck(t *testing.T) {
 	// Will fail until implementation exists
 }
 
+func TestServer_Capabilities(t *testing.T) {
+	server := NewServer(&Config{DataDir: "../../testdata", CORSOrigin: "*"})
+
+	req := httptest.NewRequest(http.MethodGet, CapabilitiesPath, nil)
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	assert.Equal(t, "GET, OPTIONS", w.Header().Get("Access-Control-Allow-Methods"))
+
+	var caps Capabilities
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &caps))
+	assert.False(t, caps.Write)
+	assert.Zero(t, caps.MaxUploadSize)
+	assert.Equal(t, []string{"sha256"}, caps.HashAlgorithms)
+	assert.Equal(t, []string{"application/json", ContentTypeNDJSON}, caps.CatalogFormats)
+	assert.Equal(t, []string{registry.CatalogVersion}, caps.CatalogVersions)
+	assert.False(t, caps.RequireSignatures)
+	assert.Equal(t, CatalogPath, caps.Endpoints["catalog"])
+	assert.Equal(t, CapabilitiesPath, caps.Endpoints["capabilities"])
+	assert.Equal(t, ProvenancePathPrefix+"{hash}.json", caps.Endpoints["provenance"])
+	assert.Equal(t, ShimsPathPrefix+"{hash}.json.minisig", caps.Endpoints["minisigs"])
+	assert.NotContains(t, caps.Endpoints, "shims_upload")
+}
+
+func TestServer_Capabilities_Uploads(t *testing.T) {
+	server := NewServer(&Config{DataDir: t.TempDir(), CORSOrigin: "*", UploadToken: "secret"})
+
+	req := httptest.NewRequest(http.MethodGet, CapabilitiesPath, nil)
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "GET, PUT, OPTIONS", w.Header().Get("Access-Control-Allow-Methods"))
+	assert.Contains(t, w.Header().Get("Access-Control-Allow-Headers"), "Authorization")
+
+	var caps Capabilities
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &caps))
+	assert.True(t, caps.Write)
+	assert.Equal(t, int64(DefaultMaxUploadSize), caps.MaxUploadSize)
+	assert.Equal(t, ShimsPathPrefix+"{hash}.json", caps.Endpoints["shims_upload"])
+	assert.Equal(t, ShimsPathPrefix+"{hash}.json.bundle", caps.Endpoints["signatures_upload"])
+}
+
+func TestServer_Capabilities_RequireSignatures(t *testing.T) {
+	dataDir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dataDir, ".well-known"), 0755))
+	manifest := `{"trust": {"requireSignatures": true}}`
+	require.NoError(t, os.WriteFile(filepath.Join(dataDir, ".well-known", "atip-registry.json"), []byte(manifest), 0644))
+
+	server := NewServer(&Config{DataDir: dataDir})
+	req := httptest.NewRequest(http.MethodGet, CapabilitiesPath, nil)
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+
+	var caps Capabilities
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &caps))
+	assert.True(t, caps.RequireSignatures)
+}
+
+func TestServer_ShimRejectsWrites(t *testing.T) {
+	dataDir := t.TempDir()
+	server := NewServer(&Config{DataDir: dataDir})
+
+	hash := strings.Repeat("ab", 32)
+	shim := fmt.Sprintf(`{"atip": {"version": "0.6"}, "binary": {"hash": "sha256:%s"}, "name": "jq", "version": "1.7.1"}`, hash)
+	for _, path := range []string{ShimsPathPrefix + hash + ".json", ShimsPathPrefix + hash + ".json.bundle"} {
+		for _, method := range []string{http.MethodPut, http.MethodPost, http.MethodDelete} {
+			req := httptest.NewRequest(method, path, strings.NewReader(shim))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			server.ServeHTTP(w, req)
+			assert.Equal(t, http.StatusMethodNotAllowed, w.Code, method+" "+path)
+			assert.Equal(t, "GET, HEAD", w.Header().Get("Allow"))
+		}
+	}
+	assert.NoFileExists(t, filepath.Join(dataDir, registry.ShimPath(hash)))
+}
+
+func TestServer_Upload(t *testing.T) {
+	hash := strings.Repeat("ab", 32)
+	shim := fmt.Sprintf(`{"atip": {"version": "0.6"}, "binary": {"hash": "sha256:%s"}, "name": "jq", "version": "1.7.1"}`, hash)
+	const token = "secret"
+
+	send := func(server *Server, r *http.Request, contentType, auth string) int {
+		if contentType != "" {
+			r.Header.Set("Content-Type", contentType)
+		}
+		if auth != "" {
+			r.Header.Set("Authorization", auth)
+		}
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, r)
+		return w.Code
+	}
+	putAs := func(server *Server, path, contentType, body string) int {
+		return send(server, httptest.NewRequest(http.MethodPut, path, strings.NewReader(body)), contentType, "Bearer "+token)
+	}
+	put := func(server *Server, path, body string) int {
+		contentType := "application/json"
+		if strings.HasSuffix(path, ".bundle") {
+			contentType = "application/octet-stream"
+		}
+		return putAs(server, path, contentType, body)
+	}
+	get := func(server *Server, path string) int {
+		return send(server, httptest.NewRequest(http.MethodGet, path, nil), "", "")
+	}
+	shimPath := ShimsPathPrefix + hash + ".json"
+
+	t.Run("unauthorized", func(t *testing.T) {
+		server := NewServer(&Config{DataDir: t.TempDir(), UploadToken: token})
+
+		for _, auth := range []string{"", token, "Bearer wrong", "Basic " + token} {
+			req := httptest.NewRequest(http.MethodPut, shimPath, strings.NewReader(shim))
+			req.Header.Set("Content-Type", "application/json")
+			if auth != "" {
+				req.Header.Set("Authorization", auth)
+			}
+			w := httptest.NewRecorder()
+			server.ServeHTTP(w, req)
+			assert.Equal(t, http.StatusUnauthorized, w.Code, auth)
+			assert.Contains(t, w.Header().Get("WWW-Authenticate"), "Bearer")
+		}
+
+		// Checked before the content type
+		assert.Equal(t, http.StatusUnauthorized, send(server, httptest.NewRequest(http.MethodPut, shimPath, strings.NewReader(shim)), "text/plain", ""))
+		assert.Equal(t, http.StatusNotFound, get(server, shimPath))
+	})
+
+	t.Run("authorized", func(t *testing.T) {
+		server := NewServer(&Config{DataDir: t.TempDir(), UploadToken: token, MaxUploadSize: 1024})
+
+		assert.Equal(t, http.StatusNotFound, put(server, shimPath+".bundle", "bundle"))
+		assert.Equal(t, http.StatusBadRequest, put(server, ShimsPathPrefix+strings.Repeat("cd", 32)+".json", shim))
+		assert.Equal(t, http.StatusBadRequest, put(server, shimPath, "{not json"))
+		assert.Equal(t, http.StatusMethodNotAllowed, put(server, shimPath+".minisig", "sig"))
+		assert.Equal(t, http.StatusRequestEntityTooLarge, put(server, shimPath, shim+strings.Repeat(" ", 1024)))
+
+		assert.Equal(t, http.StatusCreated, put(server, shimPath, shim))
+		assert.Equal(t, http.StatusOK, get(server, shimPath))
+		assert.Equal(t, http.StatusCreated, put(server, shimPath+".bundle", "bundle"))
+		assert.Equal(t, http.StatusOK, get(server, shimPath+".bundle"))
+	})
+
+	t.Run("no overwrite", func(t *testing.T) {
+		dataDir := t.TempDir()
+		server := NewServer(&Config{DataDir: dataDir, UploadToken: token})
+
+		require.Equal(t, http.StatusCreated, put(server, shimPath, shim))
+		require.Equal(t, http.StatusCreated, put(server, shimPath+".bundle", "bundle"))
+		assert.Equal(t, http.StatusConflict, put(server, shimPath, shim))
+		assert.Equal(t, http.StatusConflict, put(server, shimPath+".bundle", "forged"))
+
+		data, err := os.ReadFile(filepath.Join(dataDir, registry.BundlePath(hash)))
+		require.NoError(t, err)
+		assert.Equal(t, "bundle", string(data))
+	})
+
+	t.Run("content type", func(t *testing.T) {
+		server := NewServer(&Config{DataDir: t.TempDir(), UploadToken: token})
+
+		assert.Equal(t, http.StatusUnsupportedMediaType, putAs(server, shimPath, "", shim))
+		assert.Equal(t, http.StatusUnsupportedMediaType, putAs(server, shimPath, "text/plain", shim))
+		assert.Equal(t, http.StatusUnsupportedMediaType, putAs(server, shimPath, "application/octet-stream", shim))
+		assert.Equal(t, http.StatusUnsupportedMediaType, putAs(server, shimPath, "application/json; charset", shim))
+		assert.Equal(t, http.StatusCreated, putAs(server, shimPath, "Application/JSON; charset=utf-8", shim))
+
+		assert.Equal(t, http.StatusUnsupportedMediaType, putAs(server, shimPath+".bundle", "application/json", "bundle"))
+		assert.Equal(t, http.StatusCreated, putAs(server, shimPath+".bundle", "application/octet-stream", "bundle"))
+	})
+
+	t.Run("oversize", func(t *testing.T) {
+		server := NewServer(&Config{DataDir: t.TempDir(), UploadToken: token, MaxUploadSize: 64})
+
+		// Rejected by Content-Length, or while reading a body of unknown length
+		assert.Equal(t, http.StatusRequestEntityTooLarge, put(server, shimPath, shim))
+		req := httptest.NewRequest(http.MethodPut, shimPath, io.MultiReader(strings.NewReader(shim)))
+		require.Equal(t, int64(-1), req.ContentLength)
+		assert.Equal(t, http.StatusRequestEntityTooLarge, send(server, req, "application/json", "Bearer "+token))
+
+		// The content type is checked first
+		assert.Equal(t, http.StatusUnsupportedMediaType, putAs(server, shimPath, "text/plain", shim))
+		assert.Equal(t, http.StatusNotFound, get(server, shimPath))
+	})
+}
+
 func TestServer_PathTraversalPrevention(t *testing.T) {
 	tests := []struct {
 		name           string
@@ -255,3 +1175,60 @@ func TestServer_CORSHeaders(t *testing.T) {
 
 	assert.Equal(t, "*", w.Header().Get("Access-Control-Allow-Origin"))
 }
+
+func TestServer_Watch(t *testing.T) {
+	dataDir := t.TempDir()
+	server := NewServer(&Config{DataDir: dataDir, CatalogTTL: time.Hour, WatchDebounce: 100 * time.Millisecond})
+	builds := countBuilds(server)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.NoError(t, server.Watch(ctx))
+
+	catalogTools := func() map[string]registry.ToolInfo {
+		req := httptest.NewRequest(http.MethodGet, CatalogPath, nil)
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+		var catalog registry.Catalog
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &catalog))
+		return catalog.Tools
+	}
+	assert.Empty(t, catalogTools())
+
+	// A shim written into the data dir is fetchable and, without waiting
+	// for the hour-long TTL, listed
+	hash := strings.Repeat("ab", 32)
+	shim := fmt.Sprintf(`{"atip": {"version": "0.6"}, "binary": {"hash": "sha256:%s"}, "name": "jq", "version": "1.0.0"}`, hash)
+	require.NoError(t, os.WriteFile(filepath.Join(dataDir, "shims", "sha256", hash+".json"), []byte(shim), 0644))
+
+	req := httptest.NewRequest(http.MethodGet, ShimsPathPrefix+hash+".json", nil)
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	require.Eventually(t, func() bool {
+		_, ok := catalogTools()["jq"]
+		return ok
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// A burst of writes is one rebuild
+	settled := atomic.LoadInt32(builds)
+	for i := 0; i < 5; i++ {
+		hash := strings.Repeat(fmt.Sprintf("c%d", i), 32)
+		shim := fmt.Sprintf(`{"atip": {"version": "0.6"}, "binary": {"hash": "sha256:%s"}, "name": "tool%d", "version": "1.0.0"}`, hash, i)
+		require.NoError(t, os.WriteFile(filepath.Join(dataDir, "shims", "sha256", hash+".json"), []byte(shim), 0644))
+	}
+	require.Eventually(t, func() bool {
+		return len(catalogTools()) == 6
+	}, 5*time.Second, 50*time.Millisecond)
+	assert.Equal(t, settled+1, atomic.LoadInt32(builds))
+
+	// Once ctx is done, changes wait for the TTL again
+	cancel()
+	time.Sleep(50 * time.Millisecond)
+	hash = strings.Repeat("ef", 32)
+	shim = fmt.Sprintf(`{"atip": {"version": "0.6"}, "binary": {"hash": "sha256:%s"}, "name": "fx", "version": "1.0.0"}`, hash)
+	require.NoError(t, os.WriteFile(filepath.Join(dataDir, "shims", "sha256", hash+".json"), []byte(shim), 0644))
+	time.Sleep(300 * time.Millisecond)
+	assert.NotContains(t, catalogTools(), "fx")
+}
@@ -0,0 +1,104 @@
+package server
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// DefaultShimCacheSize is the default limit on shim and bundle bytes kept
+// in memory (64 MiB).
+const DefaultShimCacheSize = 64 << 20
+
+// shimCache is an LRU cache of shim and bundle files, keyed by path in the
+// data directory and bounded by the total size of their contents. Entries
+// are only served while the file's modification time and size still match.
+type shimCache struct {
+	mu      sync.Mutex
+	max     int64
+	size    int64
+	order   *list.List               // Of *cachedShim, most recently used first
+	entries map[string]*list.Element // Keyed by path
+}
+
+// cachedShim is the content of a shim or bundle file with its ETag. It is
+// immutable once cached.
+type cachedShim struct {
+	path    string
+	data    []byte    // Decompressed for a compressed shim
+	gzipped []byte    // The file as stored, for a compressed shim
+	etag    string    // Of data, so a shim has the same ETag however it is stored
+	modTime time.Time // File modification time when read
+	size    int64     // File size when stat'ed, before reading
+}
+
+// newShimCache returns a cache holding at most max bytes. A cache with a
+// max below 1 holds nothing.
+func newShimCache(max int64) *shimCache {
+	return &shimCache{
+		max:     max,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+// get returns the cached file at path if it was read at modTime with size.
+// A stale entry is dropped.
+func (c *shimCache) get(path string, modTime time.Time, size int64) (*cachedShim, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[path]
+	if !ok {
+		return nil, false
+	}
+	entry := elem.Value.(*cachedShim)
+	if !entry.modTime.Equal(modTime) || entry.size != size {
+		c.removeElement(elem)
+		return nil, false
+	}
+	c.order.MoveToFront(elem)
+	return entry, true
+}
+
+// add caches entry, replacing any entry for its path, and evicts the least
+// recently used entries until the cache fits. Entries larger than the
+// cache aren't cached.
+func (c *shimCache) add(entry *cachedShim) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[entry.path]; ok {
+		c.removeElement(elem)
+	}
+	if entry.bytes() > c.max {
+		return
+	}
+
+	c.entries[entry.path] = c.order.PushFront(entry)
+	c.size += entry.bytes()
+	for c.size > c.max {
+		c.removeElement(c.order.Back())
+	}
+}
+
+// remove drops the entry for path, if any.
+func (c *shimCache) remove(path string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[path]; ok {
+		c.removeElement(elem)
+	}
+}
+
+func (c *shimCache) removeElement(elem *list.Element) {
+	entry := c.order.Remove(elem).(*cachedShim)
+	delete(c.entries, entry.path)
+	c.size -= entry.bytes()
+}
+
+// bytes returns the memory the entry's contents take.
+func (e *cachedShim) bytes() int64 {
+	return int64(len(e.data) + len(e.gzipped))
+}
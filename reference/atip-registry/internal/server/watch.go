@@ -0,0 +1,81 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"github.com/anthropics/atip/reference/atip-registry/internal/registry"
+)
+
+// DefaultWatchDebounce is how long Watch waits after a change to the shim
+// directory before invalidating the catalog, so a burst of writes (a sync,
+// or a shim and its bundle) causes one rebuild.
+const DefaultWatchDebounce = 250 * time.Millisecond
+
+// Watch invalidates the catalog whenever a file in the shim directory is
+// created, written, renamed or removed, so changes made behind the server's
+// back show up without waiting for the catalog TTL. Changes are debounced by
+// Config.WatchDebounce. The shim directory is created if it doesn't exist.
+//
+// Watch returns once the directory is being watched; watching stops when
+// ctx is done.
+func (s *Server) Watch(ctx context.Context) error {
+	dir := filepath.Join(s.config.DataDir, filepath.FromSlash(registry.ShimSubdir))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create shim directory: %w", err)
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to create watcher: %w", err)
+	}
+	if err := watcher.Add(dir); err != nil {
+		watcher.Close()
+		return fmt.Errorf("failed to watch %s: %w", dir, err)
+	}
+
+	debounce := s.config.WatchDebounce
+	if debounce <= 0 {
+		debounce = DefaultWatchDebounce
+	}
+
+	go func() {
+		defer watcher.Close()
+
+		// Stopped until the first change
+		timer := time.NewTimer(debounce)
+		if !timer.Stop() {
+			<-timer.C
+		}
+		defer timer.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if event.Op == fsnotify.Chmod {
+					continue
+				}
+				timer.Reset(debounce)
+			case _, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				// Events may have been dropped, so assume something changed
+				timer.Reset(debounce)
+			case <-timer.C:
+				s.InvalidateCatalog()
+			}
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,196 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// partExtension is appended to a download's destination while it is being
+// written.
+const partExtension = ".part"
+
+// partETagExtension is appended to a part's name for the file holding the
+// ETag of the content the part was downloaded from, sent as If-Range when
+// resuming it.
+const partETagExtension = ".etag"
+
+// errNotModified is returned by download when the registry answers its
+// conditional request with 304 Not Modified, so dest is already current.
+var errNotModified = errors.New("not modified")
+
+// errRangeIgnored is returned by fetchPart when a resumed download got a
+// different part of the content than it asked for, so it must start over.
+var errRangeIgnored = errors.New("server did not resume from the requested offset")
+
+// download fetches url into dest, writing to dest+".part" and renaming it
+// once complete and verified, so dest is never partially written. verify,
+// if not nil, checks the complete content; on failure the part is removed.
+// It returns the response's ETag. If etag is set and no part is pending,
+// the request is made conditional on it, failing with errNotModified if
+// the content is unchanged.
+//
+// If the body is cut off and the server advertised Accept-Ranges: bytes,
+// the part is kept and the next attempt asks for the rest with a Range
+// header, as does a later call finding the part left behind. Otherwise the
+// part is removed and the next attempt starts over. Interrupted bodies are
+// retried up to Config.MaxAttempts times, in addition to the retries get
+// makes for each request.
+//
+// The part's ETag, if it has a strong one, is kept beside it and sent as
+// If-Range when resuming, so a server whose content changed since answers
+// with all of the new content instead of the rest of it.
+func (s *Syncer) download(ctx context.Context, url, dest, what, etag string, verify func([]byte) error) (string, error) {
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return "", err
+	}
+	part := dest + partExtension
+
+	var newETag string
+	for attempt := 1; ; attempt++ {
+		var retry bool
+		var err error
+		newETag, retry, err = s.fetchPart(ctx, url, part, what, etag)
+		if err == nil {
+			break
+		}
+		if !retry || attempt >= s.maxAttempts() || ctx.Err() != nil {
+			return "", err
+		}
+		if err := sleep(ctx, s.backoff(attempt)); err != nil {
+			return "", err
+		}
+	}
+
+	body, err := os.ReadFile(part)
+	if err != nil {
+		return "", err
+	}
+	if verify != nil {
+		if err := verify(body); err != nil {
+			removePart(part)
+			return "", err
+		}
+	}
+	if err := os.Rename(part, dest); err != nil {
+		return "", err
+	}
+	os.Remove(part + partETagExtension)
+	return newETag, nil
+}
+
+// removePart removes a part and the ETag saved with it.
+func removePart(part string) {
+	os.Remove(part)
+	os.Remove(part + partETagExtension)
+}
+
+// fetchPart requests url, resuming from the end of part if it exists, and
+// writes the body to part, returning the response's ETag. Without a part,
+// a non-empty etag makes the request conditional. retry reports whether
+// the error is one another attempt may get past: an interrupted body, or a
+// resume the server couldn't honour, in which case part has been removed.
+func (s *Syncer) fetchPart(ctx context.Context, url, part, what, etag string) (newETag string, retry bool, err error) {
+	var offset int64
+	if info, err := os.Stat(part); err == nil {
+		offset = info.Size()
+	}
+
+	header := http.Header{}
+	if offset > 0 {
+		header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		if saved, err := os.ReadFile(part + partETagExtension); err == nil && strongETag(string(saved)) {
+			header.Set("If-Range", string(saved))
+		}
+	} else if etag != "" {
+		header.Set("If-None-Match", etag)
+	}
+	resp, err := s.get(ctx, url, header)
+	if err != nil {
+		return "", false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotModified && offset == 0 && etag != "" {
+		return "", false, errNotModified
+	}
+
+	flags := os.O_CREATE | os.O_WRONLY
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		// A full response, whether or not a range was asked for: the
+		// server ignores ranges, or the content changed since the part's
+		// ETag, so start over with the new content's
+		flags |= os.O_TRUNC
+		if err := savePartETag(part, resp.Header.Get("ETag")); err != nil {
+			return "", false, err
+		}
+	case resp.StatusCode == http.StatusPartialContent && offset > 0 && contentRangeStart(resp.Header.Get("Content-Range")) == offset:
+		flags |= os.O_APPEND
+	case resp.StatusCode == http.StatusPartialContent, resp.StatusCode == http.StatusRequestedRangeNotSatisfiable:
+		// The part doesn't fit the content, e.g. it changed since
+		removePart(part)
+		return "", true, fmt.Errorf("%s failed: %w", what, errRangeIgnored)
+	default:
+		return "", false, fmt.Errorf("%s failed: %s", what, resp.Status)
+	}
+	resumable := resp.StatusCode == http.StatusPartialContent || resp.Header.Get("Accept-Ranges") == "bytes"
+
+	f, err := os.OpenFile(part, flags, 0644)
+	if err != nil {
+		return "", false, err
+	}
+	_, copyErr := io.Copy(f, resp.Body)
+	if err := f.Close(); err != nil && copyErr == nil {
+		return "", false, err
+	}
+	if copyErr != nil {
+		if !resumable {
+			removePart(part)
+		}
+		return "", true, fmt.Errorf("%s interrupted: %w", what, copyErr)
+	}
+	return resp.Header.Get("ETag"), false, nil
+}
+
+// savePartETag records etag as the ETag of the content part is downloaded
+// from, or forgets any recorded one if etag is empty.
+func savePartETag(part, etag string) error {
+	if etag == "" {
+		err := os.Remove(part + partETagExtension)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	return os.WriteFile(part+partETagExtension, []byte(etag), 0644)
+}
+
+// strongETag reports whether etag is a strong entity tag, the only kind
+// If-Range may carry.
+func strongETag(etag string) bool {
+	return len(etag) >= 2 && etag[0] == '"' && etag[len(etag)-1] == '"'
+}
+
+// contentRangeStart returns the first byte position of a Content-Range
+// header such as "bytes 100-199/200", or -1 if it can't be parsed.
+func contentRangeStart(value string) int64 {
+	spec, ok := strings.CutPrefix(value, "bytes ")
+	if !ok {
+		return -1
+	}
+	start, _, ok := strings.Cut(spec, "-")
+	if !ok {
+		return -1
+	}
+	n, err := strconv.ParseInt(start, 10, 64)
+	if err != nil {
+		return -1
+	}
+	return n
+}
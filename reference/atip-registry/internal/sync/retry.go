@@ -0,0 +1,127 @@
+package sync
+
+import (
+	"context"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// DefaultMaxAttempts is the number of attempts per request, including
+	// the first, when Config.MaxAttempts is zero.
+	DefaultMaxAttempts = 4
+
+	// DefaultRetryDelay is the base backoff delay when Config.RetryDelay is zero.
+	DefaultRetryDelay = 500 * time.Millisecond
+
+	// maxRetryDelay caps both the backoff and any Retry-After from the server.
+	maxRetryDelay = 30 * time.Second
+)
+
+// maxAttempts returns the configured attempts per request.
+func (s *Syncer) maxAttempts() int {
+	if s.config.MaxAttempts > 0 {
+		return s.config.MaxAttempts
+	}
+	return DefaultMaxAttempts
+}
+
+// get performs a GET with the given headers, retrying connection errors,
+// 5xx and 429 responses with exponential backoff and jitter. Other
+// responses, including 4xx, are returned to the caller as-is, as is the
+// final response once attempts run out. Waiting between attempts stops
+// early if ctx is cancelled.
+func (s *Syncer) get(ctx context.Context, url string, header http.Header) (*http.Response, error) {
+	attempts := s.maxAttempts()
+
+	for attempt := 1; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return nil, err
+		}
+		for key, values := range header {
+			req.Header[key] = values
+		}
+
+		resp, err := s.client.Do(req)
+		if err == nil && !retryableStatus(resp.StatusCode) {
+			return resp, nil
+		}
+		if attempt >= attempts || ctx.Err() != nil {
+			return resp, err
+		}
+
+		delay := s.backoff(attempt)
+		if resp != nil {
+			if after, ok := retryAfter(resp.Header.Get("Retry-After")); ok {
+				delay = after
+			}
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		if err := sleep(ctx, delay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// sleep waits for delay, or returns ctx's error if ctx is done first.
+func sleep(ctx context.Context, delay time.Duration) error {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// backoff returns the delay before retrying after the given attempt: the
+// base delay doubled per attempt, with the upper half randomized.
+func (s *Syncer) backoff(attempt int) time.Duration {
+	base := s.config.RetryDelay
+	if base <= 0 {
+		base = DefaultRetryDelay
+	}
+
+	delay := base << (attempt - 1)
+	if delay <= 0 || delay > maxRetryDelay {
+		delay = maxRetryDelay
+	}
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// retryableStatus reports whether a response status is worth retrying.
+func retryableStatus(code int) bool {
+	return code == http.StatusTooManyRequests || code >= 500
+}
+
+// retryAfter parses a Retry-After header given in seconds or as an HTTP date.
+func retryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+
+	var delay time.Duration
+	if seconds, err := strconv.Atoi(value); err == nil {
+		delay = time.Duration(seconds) * time.Second
+	} else if at, err := http.ParseTime(value); err == nil {
+		delay = time.Until(at)
+	} else {
+		return 0, false
+	}
+
+	if delay < 0 {
+		delay = 0
+	}
+	if delay > maxRetryDelay {
+		delay = maxRetryDelay
+	}
+	return delay, true
+}
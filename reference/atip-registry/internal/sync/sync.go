@@ -5,46 +5,160 @@ package sync
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
+	gosync "sync"
 	"time"
+
+	"github.com/anthropics/atip/reference/atip-registry/internal/pool"
+	"github.com/anthropics/atip/reference/atip-registry/internal/registry"
+	"github.com/anthropics/atip/reference/atip-registry/internal/trust"
 )
 
+// DefaultParallelism is the number of shims downloaded at once when
+// Config.Parallelism is zero.
+const DefaultParallelism = 4
+
+// ErrIntegrity is returned when a downloaded shim doesn't match the hash it
+// was requested by.
+var ErrIntegrity = errors.New("shim integrity check failed")
+
 // Config holds configuration for the sync client.
 type Config struct {
-	LocalDataDir     string   // Local directory to sync shims into
-	VerifySignatures bool     // Whether to verify shim signatures
-	ForceRefresh     bool     // Ignore cached ETags and force download
-	DryRun           bool     // Show what would be synced without downloading
-	Tools            []string // Specific tools to sync (empty = all)
+	LocalDataDir     string        // Local directory to sync shims into
+	CacheDir         string        // Directory for the ETag cache (empty = DefaultCacheDir)
+	VerifySignatures bool          // Whether to verify shim signatures against each registry's trusted signers
+	ForceRefresh     bool          // Ignore cached ETags and force download
+	DryRun           bool          // Show what would be synced without downloading
+	Tools            []string      // Specific tools to sync (empty = all)
+	MaxAttempts      int           // Attempts per request, including the first (0 = DefaultMaxAttempts)
+	RetryDelay       time.Duration // Base delay for retry backoff (0 = DefaultRetryDelay)
+	Parallelism      int           // Shims downloaded at once, unless SetPool is called (0 = DefaultParallelism)
+	Timeout          time.Duration // Overall limit per request, including the body (0 = DefaultTimeout)
+	ConnectTimeout   time.Duration // Limit on dialing and the TLS handshake (0 = DefaultConnectTimeout)
+	ReadTimeout      time.Duration // Limit on waiting for response headers (0 = DefaultReadTimeout)
+	MaxIdleConns     int           // Idle connections kept for reuse (0 = DefaultMaxIdleConns)
+	IdleConnTimeout  time.Duration // How long an idle connection is kept (0 = DefaultIdleConnTimeout)
+	MaxConnsPerHost  int           // Connections to one registry at once (0 = DefaultMaxConnsPerHost)
+	DisableHTTP2     bool          // Only speak HTTP/1.1, even to registries offering HTTP/2
 }
 
 // Syncer manages synchronization from remote ATIP registries.
 // It handles fetching manifests, catalogs, and shims with proper
 // caching and conditional requests.
 type Syncer struct {
-	config *Config
-	client *http.Client
+	config    *Config
+	client    *http.Client
+	manifests map[string]*RegistryManifest // Registry URL -> fetched manifest, for endpoint templates
+	pool      *pool.Pool                   // Bounds shim downloads, nil for a pool of Config.Parallelism per sync
+}
+
+// RegistryManifest is the parsed form of a registry's
+// /.well-known/atip-registry.json.
+type RegistryManifest struct {
+	ATIP struct {
+		Version string `json:"version"`
+	} `json:"atip"`
+	Registry  RegistryInfo      `json:"registry"`
+	Endpoints map[string]string `json:"endpoints"` // Endpoint name -> path template with {hash}
+	Trust     ManifestTrust     `json:"trust"`
+}
+
+// RegistryInfo identifies a registry.
+type RegistryInfo struct {
+	Name    string `json:"name"`
+	URL     string `json:"url"`
+	Type    string `json:"type"`    // "static" or "dynamic"
+	Version string `json:"version"` // Registry content version (e.g., "2026.01.15")
+}
+
+// ManifestTrust is the trust block of a registry manifest.
+type ManifestTrust struct {
+	RequireSignatures bool             `json:"requireSignatures"`
+	Signers           []ManifestSigner `json:"signers"`
+}
+
+// ManifestSigner is a trusted signer identity listed in a manifest.
+type ManifestSigner struct {
+	Identity  string `json:"identity"`
+	Issuer    string `json:"issuer"`
+	PublicKey string `json:"publicKey,omitempty"` // minisign public key
+}
+
+// Endpoint names used in RegistryManifest.Endpoints.
+const (
+	EndpointShims      = "shims"
+	EndpointSignatures = "signatures"
+	EndpointMinisigs   = "minisigs"
+	EndpointCatalog    = "catalog"
+)
+
+// defaultEndpoints are used for endpoints a manifest doesn't declare.
+var defaultEndpoints = map[string]string{
+	EndpointShims:      "/shims/sha256/{hash}.json",
+	EndpointSignatures: "/shims/sha256/{hash}.json.bundle",
+	EndpointMinisigs:   "/shims/sha256/{hash}.json.minisig",
+	EndpointCatalog:    "/shims/index.json",
+}
+
+// EndpointURL expands the named endpoint template for hash against
+// registryURL, falling back to the standard layout when the manifest
+// doesn't declare it. A nil manifest uses the standard layout throughout.
+func (m *RegistryManifest) EndpointURL(registryURL, name, hash string) string {
+	template := defaultEndpoints[name]
+	if m != nil && m.Endpoints[name] != "" {
+		template = m.Endpoints[name]
+	}
+	return strings.TrimSuffix(registryURL, "/") + strings.ReplaceAll(template, "{hash}", hash)
 }
 
 // SyncResult holds the results of a sync operation.
 type SyncResult struct {
-	Synced    int      // Number of shims successfully synced
-	Unchanged int      // Number of shims unchanged (304 Not Modified)
-	Failed    int      // Number of shims that failed to sync
-	Errors    []error  // Errors encountered during sync
+	Synced    int            // Number of shims successfully synced
+	Unchanged int            // Number of shims unchanged (304 Not Modified)
+	Failed    int            // Number of shims that failed to sync
+	Errors    []error        // Errors encountered during sync
+	Sources   []SourceResult // Per-registry counts, in precedence order
+	Conflicts []Conflict     // Entries the registries disagree on
+}
+
+// SourceResult counts what one registry contributed to a sync.
+type SourceResult struct {
+	URL        string `json:"url"`        // Registry URL
+	Synced     int    `json:"synced"`     // Shims downloaded from this registry
+	Unchanged  int    `json:"unchanged"`  // Shims from this registry already current (304 Not Modified)
+	Failed     int    `json:"failed"`     // Shims from this registry that failed to sync
+	Duplicates int    `json:"duplicates"` // Entries skipped because a higher-precedence registry lists them
+}
+
+// Conflict is a tool version and platform that registries map to different
+// hashes. The hash from the highest-precedence registry is synced.
+type Conflict struct {
+	Tool     string            `json:"tool"`
+	Version  string            `json:"version"`
+	Platform string            `json:"platform"`
+	Chosen   string            `json:"chosen"` // Registry URL whose hash was synced
+	Hashes   map[string]string `json:"hashes"` // Registry URL -> hash it lists
 }
 
 // Cache manages ETag-based HTTP caching for conditional requests.
-// Cached ETags are stored in memory with a configurable TTL.
+// Cached ETags are kept in memory with a configurable TTL and can be
+// persisted to etags.json in the cache directory. A Cache is safe for
+// concurrent use.
 type Cache struct {
-	dir   string                 // Cache directory
-	ttl   time.Duration          // Time-to-live for cached entries
-	store map[string]cacheEntry  // In-memory ETag cache
+	dir   string                // Cache directory
+	ttl   time.Duration         // Time-to-live for cached entries
+	mu    gosync.Mutex          // Guards store
+	store map[string]cacheEntry // In-memory ETag cache
 }
 
 // cacheEntry represents a cached ETag with timestamp.
@@ -53,24 +167,75 @@ type cacheEntry struct {
 	timestamp time.Time // When the entry was cached
 }
 
+// cacheFileEntry is the on-disk form of a cacheEntry.
+type cacheFileEntry struct {
+	ETag      string    `json:"etag"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// cacheFileName is the name of the persisted ETag cache.
+const cacheFileName = "etags.json"
+
+// catalogCacheDir is the cache subdirectory holding the catalog bodies
+// cached ETags were issued for, so a 304 can be answered from disk.
+const catalogCacheDir = "catalogs"
+
+// DefaultCacheDir returns the directory for regenerable sync state,
+// $XDG_CACHE_HOME/atip-registry or ~/.cache/atip-registry.
+func DefaultCacheDir() string {
+	if dir := os.Getenv("XDG_CACHE_HOME"); dir != "" {
+		return filepath.Join(dir, "atip-registry")
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return filepath.Join(os.TempDir(), "atip-registry")
+	}
+	return filepath.Join(home, ".cache", "atip-registry")
+}
+
 // NewSyncer creates a syncer instance
 func NewSyncer(config *Config) *Syncer {
 	return &Syncer{
-		config: config,
-		client: &http.Client{Timeout: 30 * time.Second},
+		config:    config,
+		client:    newHTTPClient(config),
+		manifests: make(map[string]*RegistryManifest),
 	}
 }
 
-// FetchManifest fetches remote registry manifest
-func (s *Syncer) FetchManifest(ctx context.Context, registryURL string) (interface{}, error) {
-	url := registryURL + "/.well-known/atip-registry.json"
+// SetPool makes syncs download shims on p instead of a pool of their own, so
+// downloads count against a limit shared with other work, e.g. a Crawler's
+// fetches. Config.Parallelism is then ignored.
+func (s *Syncer) SetPool(p *pool.Pool) {
+	s.pool = p
+}
 
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
-	if err != nil {
-		return nil, err
+// downloadPool returns the pool to download shims on.
+func (s *Syncer) downloadPool() *pool.Pool {
+	if s.pool != nil {
+		return s.pool
+	}
+	parallelism := s.config.Parallelism
+	if parallelism == 0 {
+		parallelism = DefaultParallelism
 	}
+	return pool.New(parallelism)
+}
 
-	resp, err := s.client.Do(req)
+// CacheDir returns the configured ETag cache directory, or
+// DefaultCacheDir when none is set.
+func (s *Syncer) CacheDir() string {
+	if s.config.CacheDir != "" {
+		return s.config.CacheDir
+	}
+	return DefaultCacheDir()
+}
+
+// FetchManifest fetches and parses the remote registry manifest. Its
+// endpoint templates are used by later requests to the same registry.
+func (s *Syncer) FetchManifest(ctx context.Context, registryURL string) (*RegistryManifest, error) {
+	url := strings.TrimSuffix(registryURL, "/") + "/" + registry.ManifestPath
+
+	resp, err := s.get(ctx, url, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -85,41 +250,75 @@ func (s *Syncer) FetchManifest(ctx context.Context, registryURL string) (interfa
 		return nil, err
 	}
 
-	var manifest map[string]interface{}
+	var manifest RegistryManifest
 	if err := json.Unmarshal(body, &manifest); err != nil {
-		return nil, err
+		return nil, fmt.Errorf("failed to parse manifest: %w", err)
 	}
 
-	return manifest, nil
+	s.manifests[registryURL] = &manifest
+	return &manifest, nil
 }
 
-// FetchCatalog fetches remote catalog
-func (s *Syncer) FetchCatalog(ctx context.Context, registryURL string) (interface{}, error) {
-	url := registryURL + "/shims/index.json"
+// endpointURL builds the URL of the named endpoint on registryURL, using
+// the manifest's templates if one was fetched from that registry.
+func (s *Syncer) endpointURL(registryURL, name, hash string) string {
+	return s.manifests[registryURL].EndpointURL(registryURL, name, hash)
+}
 
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
-	if err != nil {
-		return nil, err
+// FetchCatalog fetches and parses the remote catalog from the manifest's
+// catalog endpoint. A catalog in a schema version this build doesn't
+// understand is refused with registry.ErrUnsupportedCatalogVersion.
+func (s *Syncer) FetchCatalog(ctx context.Context, registryURL string) (*registry.Catalog, error) {
+	return s.fetchCatalog(ctx, registryURL, nil)
+}
+
+// fetchCatalog is FetchCatalog revalidating against cache: when cache holds
+// an ETag and the catalog body it was issued for, the request is
+// conditional and a 304 is answered from the cached body. A nil cache
+// always fetches.
+func (s *Syncer) fetchCatalog(ctx context.Context, registryURL string, cache *Cache) (*registry.Catalog, error) {
+	url := s.endpointURL(registryURL, EndpointCatalog, "")
+
+	var etag string
+	var cached []byte
+	if cache != nil && !s.config.ForceRefresh {
+		if tag, ok := cache.Get(url); ok {
+			if data, err := os.ReadFile(cache.bodyPath(url)); err == nil {
+				etag, cached = tag, data
+			}
+		}
 	}
 
-	resp, err := s.client.Do(req)
+	header := http.Header{}
+	if etag != "" {
+		header.Set("If-None-Match", etag)
+	}
+	resp, err := s.get(ctx, url, header)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
+	var body []byte
+	switch {
+	case resp.StatusCode == http.StatusNotModified && etag != "":
+		body = cached
+	case resp.StatusCode == http.StatusOK:
+		if body, err = io.ReadAll(resp.Body); err != nil {
+			return nil, err
+		}
+		if newETag := resp.Header.Get("ETag"); cache != nil && newETag != "" {
+			// The cache is regenerable; failing to write it only costs a
+			// full fetch next time
+			cache.setBody(url, newETag, body)
+		}
+	default:
 		return nil, fmt.Errorf("fetch catalog failed: %s", resp.Status)
 	}
 
-	body, err := io.ReadAll(resp.Body)
+	catalog, err := registry.ParseCatalog(body)
 	if err != nil {
-		return nil, err
-	}
-
-	var catalog map[string]interface{}
-	if err := json.Unmarshal(body, &catalog); err != nil {
-		return nil, err
+		return nil, fmt.Errorf("failed to parse catalog: %w", err)
 	}
 
 	return catalog, nil
@@ -127,16 +326,12 @@ func (s *Syncer) FetchCatalog(ctx context.Context, registryURL string) (interfac
 
 // FetchWithETag performs conditional fetch
 func (s *Syncer) FetchWithETag(ctx context.Context, url, etag string) ([]byte, string, error) {
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
-	if err != nil {
-		return nil, "", err
-	}
-
+	header := http.Header{}
 	if etag != "" {
-		req.Header.Set("If-None-Match", etag)
+		header.Set("If-None-Match", etag)
 	}
 
-	resp, err := s.client.Do(req)
+	resp, err := s.get(ctx, url, header)
 	if err != nil {
 		return nil, "", err
 	}
@@ -164,95 +359,399 @@ func (s *Syncer) FetchWithETag(ctx context.Context, url, etag string) ([]byte, s
 	return body, newETag, nil
 }
 
-// DownloadShim downloads a shim by hash
+// DownloadShim downloads a shim by hash. The shim is rejected with
+// ErrIntegrity, and nothing is written, unless its binary.hash matches.
+// Interrupted downloads are resumed where the registry supports it, see
+// download.
 func (s *Syncer) DownloadShim(ctx context.Context, registryURL, hash string) error {
-	url := fmt.Sprintf("%s/shims/sha256/%s.json", registryURL, hash)
+	if s.config.DryRun {
+		_, err := s.fetchShim(ctx, registryURL, hash)
+		return err
+	}
+
+	_, err := s.downloadShim(ctx, registryURL, hash, nil)
+	return err
+}
+
+// downloadShim is DownloadShim revalidating against cache: a shim already
+// on disk with a cached ETag is requested conditionally, and unchanged
+// reports a 304 that left it in place. A nil cache always downloads.
+func (s *Syncer) downloadShim(ctx context.Context, registryURL, hash string, cache *Cache) (unchanged bool, err error) {
+	url := s.endpointURL(registryURL, EndpointShims, hash)
+	verify := func(body []byte) error {
+		return verifyShim(body, hash)
+	}
+	shimPath := filepath.Join(s.config.LocalDataDir, "shims", "sha256", hash+".json")
 
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	var etag string
+	if cache != nil && !s.config.ForceRefresh {
+		if _, err := os.Stat(shimPath); err == nil {
+			etag, _ = cache.Get(url)
+		}
+	}
+	newETag, err := s.download(ctx, url, shimPath, "download shim", etag, verify)
+	if errors.Is(err, errNotModified) {
+		return true, nil
+	}
 	if err != nil {
-		return err
+		return false, err
+	}
+	if cache != nil && newETag != "" {
+		cache.Set(url, newETag)
 	}
+	return false, nil
+}
 
-	resp, err := s.client.Do(req)
+// fetchShim downloads a shim by hash into memory and checks it like
+// DownloadShim.
+func (s *Syncer) fetchShim(ctx context.Context, registryURL, hash string) ([]byte, error) {
+	body, err := s.fetch(ctx, s.endpointURL(registryURL, EndpointShims, hash), "download shim")
 	if err != nil {
-		return err
+		return nil, err
+	}
+	if err := verifyShim(body, hash); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+// fetch downloads url into memory, failing on any status but 200.
+func (s *Syncer) fetch(ctx context.Context, url, what string) ([]byte, error) {
+	resp, err := s.get(ctx, url, nil)
+	if err != nil {
+		return nil, err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("download shim failed: %s", resp.Status)
+		return nil, fmt.Errorf("%s failed: %s", what, resp.Status)
 	}
+	return io.ReadAll(resp.Body)
+}
 
-	if s.config.DryRun {
-		return nil
+// verifyShim checks that a downloaded shim belongs at hash. Shims are
+// addressed by the SHA-256 of the binary they describe, not of their own
+// content, so the check is that binary.hash names the requested hash.
+func verifyShim(body []byte, hash string) error {
+	var shim struct {
+		Binary struct {
+			Hash string `json:"hash"`
+		} `json:"binary"`
 	}
+	if err := json.Unmarshal(body, &shim); err != nil {
+		return fmt.Errorf("%w: shim %s is not valid JSON: %v", ErrIntegrity, hash, err)
+	}
+	if err := registry.ValidateHash(shim.Binary.Hash, hash+registry.ShimExtension); err != nil {
+		return fmt.Errorf("%w: shim %s: %w", ErrIntegrity, hash, err)
+	}
+	return nil
+}
 
-	shimDir := filepath.Join(s.config.LocalDataDir, "shims", "sha256")
-	if err := os.MkdirAll(shimDir, 0755); err != nil {
+// DownloadSignature downloads signature bundle, resuming interrupted
+// downloads like DownloadShim
+func (s *Syncer) DownloadSignature(ctx context.Context, registryURL, hash string) error {
+	url := s.endpointURL(registryURL, EndpointSignatures, hash)
+
+	if s.config.DryRun {
+		_, err := s.fetch(ctx, url, "download signature")
 		return err
 	}
 
-	shimPath := filepath.Join(shimDir, hash+".json")
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
+	bundlePath := filepath.Join(s.config.LocalDataDir, "shims", "sha256", hash+".json.bundle")
+	_, err := s.download(ctx, url, bundlePath, "download signature", "", nil)
+	return err
+}
+
+// Sync fetches the remote manifest and catalog, then downloads every shim
+// listed for the selected tools using the manifest's endpoint templates.
+// Individual download failures are collected in the result rather than
+// aborting the sync.
+func (s *Syncer) Sync(ctx context.Context, registryURL string) (*SyncResult, error) {
+	return s.SyncAll(ctx, []string{registryURL})
+}
+
+// syncEntry is a tool version and platform selected for download.
+type syncEntry struct {
+	name, version, platform string
+	hash                    string // Without the "sha256:" prefix
+	source                  int    // Index of the registry it is synced from
+}
+
+// SyncAll syncs from several registries, given in precedence order. Each
+// tool version and platform is synced once, from the first registry that
+// lists it; later registries listing it are counted as duplicates, and as
+// conflicts if they list a different hash. Any registry whose manifest or
+// catalog can't be fetched aborts the sync, so a lower-precedence registry
+// never stands in for an unreachable one.
+//
+// Shims are downloaded concurrently, Config.Parallelism at a time (or as
+// many as the pool given to SetPool allows); errors are still reported in
+// the order of tool, version and platform.
+//
+// With VerifySignatures, each shim's signature is downloaded from the
+// registry that supplied the shim and verified against that registry's
+// trusted signers; a shim without a valid signature fails.
+//
+// Catalogs and shims already on disk are revalidated with the ETags cached
+// in CacheDir, unless ForceRefresh is set; shims the registry reports as
+// Not Modified are counted as unchanged. The cache is saved when the sync
+// ends. Dry runs neither use nor update it.
+func (s *Syncer) SyncAll(ctx context.Context, registryURLs []string) (*SyncResult, error) {
+	result := &SyncResult{
+		Errors:    []error{},
+		Sources:   make([]SourceResult, len(registryURLs)),
+		Conflicts: []Conflict{},
+	}
+
+	cache := s.loadCache()
+	if cache != nil {
+		defer cache.Save()
+	}
+
+	// Fetch each manifest for endpoint templates, then the catalog
+	catalogs := make([]*registry.Catalog, len(registryURLs))
+	for i, registryURL := range registryURLs {
+		result.Sources[i].URL = registryURL
+		if _, err := s.FetchManifest(ctx, registryURL); err != nil {
+			return nil, fmt.Errorf("%s: %w", registryURL, err)
+		}
+		catalog, err := s.fetchCatalog(ctx, registryURL, cache)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", registryURL, err)
+		}
+		catalogs[i] = catalog
+	}
+
+	// Pick each tool version and platform from the first registry listing it
+	var entries []*syncEntry
+	chosen := make(map[[3]string]*syncEntry)
+	conflicts := make(map[[3]string]*Conflict)
+	for i, catalog := range catalogs {
+		for _, entry := range catalogEntries(catalog, s.ShouldSyncTool) {
+			entry.source = i
+			key := [3]string{entry.name, entry.version, entry.platform}
+
+			first, ok := chosen[key]
+			if !ok {
+				chosen[key] = entry
+				entries = append(entries, entry)
+				continue
+			}
+
+			result.Sources[i].Duplicates++
+			if entry.hash == first.hash {
+				continue
+			}
+			conflict := conflicts[key]
+			if conflict == nil {
+				conflict = &Conflict{
+					Tool:     entry.name,
+					Version:  entry.version,
+					Platform: entry.platform,
+					Chosen:   registryURLs[first.source],
+					Hashes:   map[string]string{registryURLs[first.source]: registry.HashPrefix + first.hash},
+				}
+				conflicts[key] = conflict
+			}
+			conflict.Hashes[registryURLs[i]] = registry.HashPrefix + entry.hash
+		}
+	}
+
+	var downloads []*syncEntry
+	seen := make(map[string]bool)
+	for _, entry := range entries {
+		if conflict := conflicts[[3]string{entry.name, entry.version, entry.platform}]; conflict != nil {
+			result.Conflicts = append(result.Conflicts, *conflict)
+		}
+
+		if seen[entry.hash] {
+			continue
+		}
+		seen[entry.hash] = true
+		downloads = append(downloads, entry)
+	}
+
+	unchanged := make([]bool, len(downloads))
+	errs := s.downloadPool().Run(ctx, len(downloads), func(ctx context.Context, i int) error {
+		entry := downloads[i]
+		var err error
+		unchanged[i], err = s.syncShim(ctx, registryURLs[entry.source], entry.hash, cache)
 		return err
+	})
+	for i, entry := range downloads {
+		source := &result.Sources[entry.source]
+		if err := errs[i]; err != nil {
+			result.Failed++
+			source.Failed++
+			err = fmt.Errorf("%s %s (%s): %w", entry.name, entry.version, entry.platform, err)
+			if len(registryURLs) > 1 {
+				err = fmt.Errorf("%s: %w", source.URL, err)
+			}
+			result.Errors = append(result.Errors, err)
+			continue
+		}
+		if unchanged[i] {
+			result.Unchanged++
+			source.Unchanged++
+			continue
+		}
+		result.Synced++
+		source.Synced++
 	}
 
-	return os.WriteFile(shimPath, body, 0644)
+	return result, nil
 }
 
-// DownloadSignature downloads signature bundle
-func (s *Syncer) DownloadSignature(ctx context.Context, registryURL, hash string) error {
-	url := fmt.Sprintf("%s/shims/sha256/%s.json.bundle", registryURL, hash)
+// catalogEntries lists a catalog's tool versions and platforms for the tools
+// selected by include, sorted by name, version and platform.
+func catalogEntries(catalog *registry.Catalog, include func(name string) bool) []*syncEntry {
+	var entries []*syncEntry
+	for name, tool := range catalog.Tools {
+		if !include(name) {
+			continue
+		}
+		for version, platforms := range tool.Versions {
+			for platform, hash := range platforms {
+				entries = append(entries, &syncEntry{
+					name:     name,
+					version:  version,
+					platform: platform,
+					hash:     strings.TrimPrefix(hash, registry.HashPrefix),
+				})
+			}
+		}
+	}
 
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
-	if err != nil {
-		return err
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if a.name != b.name {
+			return a.name < b.name
+		}
+		if a.version != b.version {
+			return a.version < b.version
+		}
+		return a.platform < b.platform
+	})
+	return entries
+}
+
+// syncShim downloads a shim and, when verifying signatures, checks its
+// signature from the same registry (see verifySignature). A shim whose
+// signature can't be downloaded or doesn't verify is removed again. A dry
+// run verifies in a scratch directory, writing nothing. unchanged reports
+// a shim revalidated against cache rather than downloaded; its signature
+// is still checked.
+func (s *Syncer) syncShim(ctx context.Context, registryURL, hash string, cache *Cache) (unchanged bool, err error) {
+	if s.config.DryRun {
+		if s.config.VerifySignatures {
+			return false, s.dryRunVerify(ctx, registryURL, hash)
+		}
+		return false, s.DownloadShim(ctx, registryURL, hash)
 	}
 
-	resp, err := s.client.Do(req)
-	if err != nil {
-		return err
+	if unchanged, err = s.downloadShim(ctx, registryURL, hash, cache); err != nil {
+		return false, err
+	}
+	if !s.config.VerifySignatures {
+		return unchanged, nil
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("download signature failed: %s", resp.Status)
+	shimDir := filepath.Join(s.config.LocalDataDir, "shims", "sha256")
+	if err := s.verifySignature(ctx, registryURL, hash, shimDir); err != nil {
+		os.Remove(filepath.Join(shimDir, hash+".json"))
+		return false, err
 	}
+	return unchanged, nil
+}
 
+// loadCache loads the ETag cache from CacheDir for a sync, starting empty
+// if it can't be read. Dry runs get no cache.
+func (s *Syncer) loadCache() *Cache {
 	if s.config.DryRun {
 		return nil
 	}
+	cache, err := LoadCache(s.CacheDir())
+	if err != nil {
+		return NewCache(s.CacheDir())
+	}
+	return cache
+}
 
-	shimDir := filepath.Join(s.config.LocalDataDir, "shims", "sha256")
-	if err := os.MkdirAll(shimDir, 0755); err != nil {
+// dryRunVerify downloads a shim and checks its signature in a scratch
+// directory.
+func (s *Syncer) dryRunVerify(ctx context.Context, registryURL, hash string) error {
+	body, err := s.fetchShim(ctx, registryURL, hash)
+	if err != nil {
 		return err
 	}
-
-	bundlePath := filepath.Join(shimDir, hash+".json.bundle")
-	body, err := io.ReadAll(resp.Body)
+	dir, err := os.MkdirTemp("", "atip-sync-")
 	if err != nil {
 		return err
 	}
+	defer os.RemoveAll(dir)
+	if err := os.WriteFile(filepath.Join(dir, hash+".json"), body, 0644); err != nil {
+		return err
+	}
+	return s.verifySignature(ctx, registryURL, hash, dir)
+}
 
-	return os.WriteFile(bundlePath, body, 0644)
+// signatureMethod is a way of signing shims and the endpoint serving its
+// signatures.
+type signatureMethod struct {
+	endpoint string
+	backend  trust.SignatureBackend
+	signers  []trust.Signer // The trusted signers using it
 }
 
-// Sync executes the sync operation
-func (s *Syncer) Sync(ctx context.Context, registryURL string) (*SyncResult, error) {
-	result := &SyncResult{
-		Errors: []error{},
+// signatureMethods returns the signature methods of a registry's trusted
+// signers: minisign for those with a public key, then Cosign, checking the
+// bundle's certificate, for those with an identity and OIDC issuer. Signers
+// with neither are never trusted.
+func signatureMethods(manifest *RegistryManifest) []signatureMethod {
+	minisign := signatureMethod{endpoint: EndpointMinisigs, backend: trust.NewMinisignBackend(nil)}
+	cosign := signatureMethod{endpoint: EndpointSignatures, backend: trust.NewCosignBackend(&trust.Config{})}
+	if manifest != nil {
+		for _, signer := range manifest.Trust.Signers {
+			s := trust.Signer{Identity: signer.Identity, Issuer: signer.Issuer, PublicKey: signer.PublicKey}
+			if signer.PublicKey != "" {
+				minisign.signers = append(minisign.signers, s)
+			} else if s.Validate() == nil {
+				cosign.signers = append(cosign.signers, s)
+			}
+		}
 	}
 
-	// Fetch catalog
-	catalog, err := s.FetchCatalog(ctx, registryURL)
-	if err != nil {
-		return nil, err
+	var methods []signatureMethod
+	for _, method := range []signatureMethod{minisign, cosign} {
+		if len(method.signers) > 0 {
+			methods = append(methods, method)
+		}
 	}
+	return methods
+}
 
-	// For minimal implementation, just return the result
-	_ = catalog
-	return result, nil
+// verifySignature checks the signature of the shim synced from registryURL
+// into dir against the trusted signers in that registry's manifest. For
+// each signature method the signers use, the signature is downloaded next
+// to the shim and verified with the trust package; the shim passes if any
+// method verifies it. Signatures that don't verify are removed, and a
+// registry listing no trusted signers fails every shim.
+func (s *Syncer) verifySignature(ctx context.Context, registryURL, hash, dir string) error {
+	shimPath := filepath.Join(dir, hash+".json")
+
+	err := fmt.Errorf("%w: %s lists no trusted signers", trust.ErrUntrustedSigner, registryURL)
+	for _, method := range signatureMethods(s.manifests[registryURL]) {
+		sigPath := method.backend.SignaturePath(shimPath)
+		url := s.endpointURL(registryURL, method.endpoint, hash)
+		if _, err = s.download(ctx, url, sigPath, "download signature", "", nil); err != nil {
+			continue
+		}
+		if err = method.backend.Verify(shimPath, method.signers); err == nil {
+			return nil
+		}
+		os.Remove(sigPath)
+	}
+	return err
 }
 
 // ShouldFetch determines if resource should be fetched
@@ -287,6 +786,8 @@ func NewCache(dir string) *Cache {
 
 // Set stores an ETag
 func (c *Cache) Set(hash, etag string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	c.store[hash] = cacheEntry{
 		etag:      etag,
 		timestamp: time.Now(),
@@ -295,6 +796,8 @@ func (c *Cache) Set(hash, etag string) {
 
 // Get retrieves an ETag
 func (c *Cache) Get(hash string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	entry, exists := c.store[hash]
 	if !exists {
 		return "", false
@@ -308,7 +811,83 @@ func (c *Cache) Get(hash string) (string, bool) {
 	return entry.etag, true
 }
 
+// LoadCache creates a cache for dir and loads any persisted ETags.
+// A missing cache file is not an error.
+func LoadCache(dir string) (*Cache, error) {
+	c := NewCache(dir)
+
+	data, err := os.ReadFile(filepath.Join(dir, cacheFileName))
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cache: %w", err)
+	}
+
+	var entries map[string]cacheFileEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("failed to parse cache: %w", err)
+	}
+	for hash, entry := range entries {
+		c.store[hash] = cacheEntry{etag: entry.ETag, timestamp: entry.Timestamp}
+	}
+
+	return c, nil
+}
+
+// Save writes the cached ETags to etags.json in the cache directory.
+func (c *Cache) Save() error {
+	if err := os.MkdirAll(c.dir, 0755); err != nil {
+		return fmt.Errorf("failed to create cache directory: %w", err)
+	}
+
+	c.mu.Lock()
+	entries := make(map[string]cacheFileEntry, len(c.store))
+	for hash, entry := range c.store {
+		entries[hash] = cacheFileEntry{ETag: entry.etag, Timestamp: entry.timestamp}
+	}
+	c.mu.Unlock()
+
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal cache: %w", err)
+	}
+
+	path := filepath.Join(c.dir, cacheFileName)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write cache: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write cache: %w", err)
+	}
+
+	return nil
+}
+
 // SetTTL sets cache TTL
 func (c *Cache) SetTTL(seconds int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	c.ttl = time.Duration(seconds) * time.Second
 }
+
+// bodyPath is where the body fetched from url is cached.
+func (c *Cache) bodyPath(url string) string {
+	sum := sha256.Sum256([]byte(url))
+	return filepath.Join(c.dir, catalogCacheDir, hex.EncodeToString(sum[:])+".json")
+}
+
+// setBody caches the body fetched from url along with its ETag.
+func (c *Cache) setBody(url, etag string, body []byte) error {
+	path := c.bodyPath(url)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	if err := os.WriteFile(path, body, 0644); err != nil {
+		return fmt.Errorf("failed to write cache: %w", err)
+	}
+	c.Set(url, etag)
+	return nil
+}
@@ -2,11 +2,28 @@ package sync
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	gosync "sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"aead.dev/minisign"
+
+	"github.com/anthropics/atip/reference/atip-registry/internal/pool"
+	"github.com/anthropics/atip/reference/atip-registry/internal/registry"
+	"github.com/anthropics/atip/reference/atip-registry/internal/trust"
+	"github.com/anthropics/atip/reference/atip-registry/internal/trust/trusttest"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestSync_FetchRemoteManifest(t *testing.T) {
@@ -26,6 +43,10 @@ func TestSync_FetchRemoteManifest(t *testing.T) {
 				"endpoints": {
 					"shims": "/shims/sha256/{hash}.json",
 					"catalog": "/shims/index.json"
+				},
+				"trust": {
+					"requireSignatures": true,
+					"signers": [{"identity": "ci@atip.dev", "issuer": "https://token.actions.githubusercontent.com"}]
 				}
 			}`))
 		}
@@ -37,10 +58,55 @@ func TestSync_FetchRemoteManifest(t *testing.T) {
 	})
 
 	manifest, err := syncer.FetchManifest(context.Background(), server.URL)
-	assert.NoError(t, err)
-	assert.NotNil(t, manifest)
-	// Will fail until implementation exists
-	// assert.Equal(t, "Test Registry", manifest.Registry.Name)
+	require.NoError(t, err)
+	require.NotNil(t, manifest)
+	assert.Equal(t, "0.6", manifest.ATIP.Version)
+	assert.Equal(t, "Test Registry", manifest.Registry.Name)
+	assert.Equal(t, "https://test.atip.dev", manifest.Registry.URL)
+	assert.Equal(t, "static", manifest.Registry.Type)
+	assert.Equal(t, "2026.01.15", manifest.Registry.Version)
+	assert.Equal(t, "/shims/sha256/{hash}.json", manifest.Endpoints[EndpointShims])
+	assert.True(t, manifest.Trust.RequireSignatures)
+	require.Len(t, manifest.Trust.Signers, 1)
+	assert.Equal(t, "ci@atip.dev", manifest.Trust.Signers[0].Identity)
+}
+
+func TestSync_ManifestEndpoints(t *testing.T) {
+	validHash := "a1b2c3d4e5f6a1b2c3d4e5f6a1b2c3d4e5f6a1b2c3d4e5f6a1b2c3d4e5f6a1b2"
+
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		if r.URL.Path == "/.well-known/atip-registry.json" {
+			w.Write([]byte(`{
+				"endpoints": {
+					"shims": "/v2/shims/{hash}",
+					"catalog": "/v2/catalog.json"
+				}
+			}`))
+			return
+		}
+		w.Write([]byte(`{"binary": {"hash": "sha256:` + validHash + `"}}`))
+	}))
+	defer server.Close()
+
+	syncer := NewSyncer(&Config{
+		LocalDataDir: t.TempDir(),
+	})
+
+	_, err := syncer.FetchManifest(context.Background(), server.URL)
+	require.NoError(t, err)
+	_, err = syncer.FetchCatalog(context.Background(), server.URL)
+	require.NoError(t, err)
+	require.NoError(t, syncer.DownloadShim(context.Background(), server.URL, validHash))
+	require.NoError(t, syncer.DownloadSignature(context.Background(), server.URL, validHash))
+
+	assert.Equal(t, []string{
+		"/.well-known/atip-registry.json",
+		"/v2/catalog.json",
+		"/v2/shims/" + validHash,
+		"/shims/sha256/" + validHash + ".json.bundle", // Not declared, standard layout
+	}, paths)
 }
 
 func TestSync_FetchRemoteCatalog(t *testing.T) {
@@ -73,9 +139,38 @@ func TestSync_FetchRemoteCatalog(t *testing.T) {
 	})
 
 	catalog, err := syncer.FetchCatalog(context.Background(), server.URL)
-	assert.NoError(t, err)
-	assert.NotNil(t, catalog)
-	// Will fail until implementation exists
+	require.NoError(t, err)
+	require.NotNil(t, catalog)
+	assert.Equal(t, "1", catalog.Version)
+	assert.Equal(t, time.Date(2026, 1, 15, 0, 0, 0, 0, time.UTC), catalog.Updated)
+	assert.Equal(t, 1, catalog.TotalShims)
+	require.Contains(t, catalog.Tools, "curl")
+	assert.Equal(t, "Transfer data", catalog.Tools["curl"].Description)
+	assert.Equal(t, "sha256:abc123", catalog.Tools["curl"].Versions["8.5.0"]["linux-amd64"])
+}
+
+func TestSync_FutureCatalogVersion(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/shims/index.json":
+			w.Write([]byte(`{"version": "2", "tools": {"curl": {"versions": "moved"}}}`))
+		default:
+			w.Write([]byte(`{}`))
+		}
+	}))
+	defer server.Close()
+
+	syncer := NewSyncer(&Config{
+		LocalDataDir: t.TempDir(),
+	})
+
+	_, err := syncer.FetchCatalog(context.Background(), server.URL)
+	require.ErrorIs(t, err, registry.ErrUnsupportedCatalogVersion)
+	assert.Contains(t, err.Error(), `unsupported catalog version "2" (supported: 1)`)
+
+	// Nothing is synced from a catalog that can't be read
+	_, err = syncer.Sync(context.Background(), server.URL)
+	assert.ErrorIs(t, err, registry.ErrUnsupportedCatalogVersion)
 }
 
 func TestSync_ConditionalFetch(t *testing.T) {
@@ -142,6 +237,326 @@ func TestSync_DownloadShim(t *testing.T) {
 	// Will fail until implementation exists
 }
 
+func TestSync_RetryFlakyServer(t *testing.T) {
+	validHash := "a1b2c3d4e5f6a1b2c3d4e5f6a1b2c3d4e5f6a1b2c3d4e5f6a1b2c3d4e5f6a1b2"
+
+	var hits int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&hits, 1) <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"binary": {"hash": "sha256:` + validHash + `"}}`))
+	}))
+	defer server.Close()
+
+	dataDir := t.TempDir()
+	syncer := NewSyncer(&Config{
+		LocalDataDir: dataDir,
+		RetryDelay:   time.Millisecond,
+	})
+
+	err := syncer.DownloadShim(context.Background(), server.URL, validHash)
+	require.NoError(t, err)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&hits))
+	assert.FileExists(t, filepath.Join(dataDir, "shims", "sha256", validHash+".json"))
+}
+
+func TestSync_RetryPolicy(t *testing.T) {
+	tests := []struct {
+		name         string
+		status       int
+		retryAfter   string
+		maxAttempts  int
+		expectedHits int32
+	}{
+		{
+			name:         "5xx retried until attempts run out",
+			status:       http.StatusInternalServerError,
+			maxAttempts:  3,
+			expectedHits: 3,
+		},
+		{
+			name:         "429 retried honoring Retry-After",
+			status:       http.StatusTooManyRequests,
+			retryAfter:   "0",
+			maxAttempts:  2,
+			expectedHits: 2,
+		},
+		{
+			name:         "4xx not retried",
+			status:       http.StatusNotFound,
+			maxAttempts:  3,
+			expectedHits: 1,
+		},
+		{
+			name:         "single attempt disables retries",
+			status:       http.StatusBadGateway,
+			maxAttempts:  1,
+			expectedHits: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var hits int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt32(&hits, 1)
+				if tt.retryAfter != "" {
+					w.Header().Set("Retry-After", tt.retryAfter)
+				}
+				w.WriteHeader(tt.status)
+			}))
+			defer server.Close()
+
+			syncer := NewSyncer(&Config{
+				MaxAttempts: tt.maxAttempts,
+				RetryDelay:  time.Millisecond,
+			})
+
+			_, err := syncer.FetchManifest(context.Background(), server.URL)
+			assert.Error(t, err)
+			assert.Equal(t, tt.expectedHits, atomic.LoadInt32(&hits))
+		})
+	}
+}
+
+func TestSync_RetryCancelled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	syncer := NewSyncer(&Config{
+		RetryDelay: time.Hour,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := syncer.FetchCatalog(ctx, server.URL)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), 5*time.Second)
+}
+
+func TestSync_ResumeDownload(t *testing.T) {
+	validHash := "a1b2c3d4e5f6a1b2c3d4e5f6a1b2c3d4e5f6a1b2c3d4e5f6a1b2c3d4e5f6a1b2"
+	shim := `{"binary": {"hash": "sha256:` + validHash + `"}, "name": "curl", "description": "` + strings.Repeat("x", 4096) + `"}`
+	cut := len(shim) / 2
+
+	tests := []struct {
+		name           string
+		acceptRanges   bool
+		expectedRanges []string
+	}{
+		{
+			name:           "resumed with a range",
+			acceptRanges:   true,
+			expectedRanges: []string{"", fmt.Sprintf("bytes=%d-", cut)},
+		},
+		{
+			name:           "downloaded again without ranges",
+			acceptRanges:   false,
+			expectedRanges: []string{"", ""},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu gosync.Mutex
+			var ranges, ifRanges []string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				ranges = append(ranges, r.Header.Get("Range"))
+				ifRanges = append(ifRanges, r.Header.Get("If-Range"))
+				first := len(ranges) == 1
+				mu.Unlock()
+
+				w.Header().Set("ETag", `"v1"`)
+				if tt.acceptRanges {
+					w.Header().Set("Accept-Ranges", "bytes")
+				}
+				if first {
+					// Send half the shim, then drop the connection
+					w.Header().Set("Content-Length", strconv.Itoa(len(shim)))
+					w.Write([]byte(shim[:cut]))
+					w.(http.Flusher).Flush()
+					panic(http.ErrAbortHandler)
+				}
+				if tt.acceptRanges && r.Header.Get("Range") != "" {
+					w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", cut, len(shim)-1, len(shim)))
+					w.WriteHeader(http.StatusPartialContent)
+					w.Write([]byte(shim[cut:]))
+					return
+				}
+				w.Write([]byte(shim))
+			}))
+			defer server.Close()
+
+			dataDir := t.TempDir()
+			syncer := NewSyncer(&Config{
+				LocalDataDir: dataDir,
+				RetryDelay:   time.Millisecond,
+			})
+
+			require.NoError(t, syncer.DownloadShim(context.Background(), server.URL, validHash))
+			assert.Equal(t, tt.expectedRanges, ranges)
+			if tt.acceptRanges {
+				assert.Equal(t, []string{"", `"v1"`}, ifRanges, "the resume is conditional on the part's ETag")
+			}
+
+			shimPath := filepath.Join(dataDir, "shims", "sha256", validHash+".json")
+			data, err := os.ReadFile(shimPath)
+			require.NoError(t, err)
+			assert.Equal(t, shim, string(data))
+			assert.NoFileExists(t, shimPath+".part")
+			assert.NoFileExists(t, shimPath+".part.etag")
+		})
+	}
+}
+
+func TestSync_ResumeChangedContent(t *testing.T) {
+	validHash := "a1b2c3d4e5f6a1b2c3d4e5f6a1b2c3d4e5f6a1b2c3d4e5f6a1b2c3d4e5f6a1b2"
+	shims := []string{
+		`{"binary": {"hash": "sha256:` + validHash + `"}, "name": "curl", "version": "8.5.0"}`,
+		`{"binary": {"hash": "sha256:` + validHash + `"}, "name": "curl", "version": "8.5.0", "description": "Transfer data"}`,
+	}
+	cut := 30
+
+	// The first response is cut off, and the shim is republished before
+	// the download resumes
+	var mu gosync.Mutex
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests = append(requests, r.Header.Get("Range")+" "+r.Header.Get("If-Range"))
+		first := len(requests) == 1
+		mu.Unlock()
+
+		if first {
+			w.Header().Set("ETag", `"v1"`)
+			w.Header().Set("Accept-Ranges", "bytes")
+			w.Header().Set("Content-Length", strconv.Itoa(len(shims[0])))
+			w.Write([]byte(shims[0][:cut]))
+			w.(http.Flusher).Flush()
+			panic(http.ErrAbortHandler)
+		}
+		w.Header().Set("ETag", `"v2"`)
+		http.ServeContent(w, r, "shim.json", time.Time{}, strings.NewReader(shims[1]))
+	}))
+	defer server.Close()
+
+	dataDir := t.TempDir()
+	syncer := NewSyncer(&Config{LocalDataDir: dataDir, RetryDelay: time.Millisecond})
+	require.NoError(t, syncer.DownloadShim(context.Background(), server.URL, validHash))
+
+	// The range no longer applies, so the server sent all of the new shim
+	// rather than the rest of it spliced onto the old one
+	assert.Equal(t, []string{" ", fmt.Sprintf(`bytes=%d- "v1"`, cut)}, requests)
+	shimPath := filepath.Join(dataDir, "shims", "sha256", validHash+".json")
+	data, err := os.ReadFile(shimPath)
+	require.NoError(t, err)
+	assert.Equal(t, shims[1], string(data))
+	assert.NoFileExists(t, shimPath+".part")
+	assert.NoFileExists(t, shimPath+".part.etag")
+}
+
+func TestSync_ResumeLeftoverPart(t *testing.T) {
+	validHash := "a1b2c3d4e5f6a1b2c3d4e5f6a1b2c3d4e5f6a1b2c3d4e5f6a1b2c3d4e5f6a1b2"
+	shim := `{"binary": {"hash": "sha256:` + validHash + `"}, "name": "curl"}`
+	cut := 10
+
+	var ranges []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ranges = append(ranges, r.Header.Get("Range"))
+		http.ServeContent(w, r, "shim.json", time.Time{}, strings.NewReader(shim))
+	}))
+	defer server.Close()
+
+	dataDir := t.TempDir()
+	shimPath := filepath.Join(dataDir, "shims", "sha256", validHash+".json")
+	require.NoError(t, os.MkdirAll(filepath.Dir(shimPath), 0755))
+	syncer := NewSyncer(&Config{LocalDataDir: dataDir})
+
+	// A part left by an interrupted sync is resumed
+	require.NoError(t, os.WriteFile(shimPath+".part", []byte(shim[:cut]), 0644))
+	require.NoError(t, syncer.DownloadShim(context.Background(), server.URL, validHash))
+	assert.Equal(t, []string{fmt.Sprintf("bytes=%d-", cut)}, ranges)
+	data, err := os.ReadFile(shimPath)
+	require.NoError(t, err)
+	assert.Equal(t, shim, string(data))
+
+	// A part that doesn't belong to the content fails verification and is
+	// removed, so the next sync starts over
+	require.NoError(t, os.Remove(shimPath))
+	require.NoError(t, os.WriteFile(shimPath+".part", []byte(`{"binary": {"hash": "sha256:ffff`), 0644))
+	err = syncer.DownloadShim(context.Background(), server.URL, validHash)
+	assert.ErrorIs(t, err, ErrIntegrity)
+	assert.NoFileExists(t, shimPath)
+	assert.NoFileExists(t, shimPath+".part")
+
+	require.NoError(t, syncer.DownloadShim(context.Background(), server.URL, validHash))
+	data, err = os.ReadFile(shimPath)
+	require.NoError(t, err)
+	assert.Equal(t, shim, string(data))
+}
+
+func TestSync_RejectTamperedShim(t *testing.T) {
+	validHash := "a1b2c3d4e5f6a1b2c3d4e5f6a1b2c3d4e5f6a1b2c3d4e5f6a1b2c3d4e5f6a1b2"
+	otherHash := "ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff"
+
+	tests := []struct {
+		name string
+		body string
+	}{
+		{
+			name: "binary hash for another shim",
+			body: `{"binary": {"hash": "sha256:` + otherHash + `"}, "name": "evil"}`,
+		},
+		{
+			name: "missing binary hash",
+			body: `{"name": "curl"}`,
+		},
+		{
+			name: "not JSON",
+			body: `<html>mirror error</html>`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/shims/index.json":
+					w.Write([]byte(`{"tools": {"curl": {"versions": {"8.5.0": {"linux-amd64": "sha256:` + validHash + `"}}}}}`))
+				case "/shims/sha256/" + validHash + ".json":
+					w.Write([]byte(tt.body))
+				default:
+					w.Write([]byte(`{}`))
+				}
+			}))
+			defer server.Close()
+
+			dataDir := t.TempDir()
+			syncer := NewSyncer(&Config{
+				LocalDataDir: dataDir,
+			})
+
+			err := syncer.DownloadShim(context.Background(), server.URL, validHash)
+			assert.ErrorIs(t, err, ErrIntegrity)
+			assert.NoFileExists(t, filepath.Join(dataDir, "shims", "sha256", validHash+".json"))
+
+			result, err := syncer.Sync(context.Background(), server.URL)
+			require.NoError(t, err)
+			assert.Equal(t, 0, result.Synced)
+			assert.Equal(t, 1, result.Failed)
+			require.Len(t, result.Errors, 1)
+			assert.ErrorIs(t, result.Errors[0], ErrIntegrity)
+		})
+	}
+}
+
 func TestSync_VerifySignatures(t *testing.T) {
 	validHash := "a1b2c3d4e5f6a1b2c3d4e5f6a1b2c3d4e5f6a1b2c3d4e5f6a1b2c3d4e5f6a1b2"
 
@@ -198,16 +613,22 @@ func TestSync_ForceRefresh(t *testing.T) {
 }
 
 func TestSync_DryRun(t *testing.T) {
+	validHash := "a1b2c3d4e5f6a1b2c3d4e5f6a1b2c3d4e5f6a1b2c3d4e5f6a1b2c3d4e5f6a1b2"
+
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
+		if strings.HasPrefix(r.URL.Path, "/shims/sha256/") {
+			w.Write([]byte(`{"binary": {"hash": "sha256:` + validHash + `"}}`))
+			return
+		}
 		w.Write([]byte(`{
 			"version": "1",
 			"tools": {
 				"curl": {
 					"versions": {
 						"8.5.0": {
-							"linux-amd64": "sha256:abc123"
+							"linux-amd64": "sha256:` + validHash + `"
 						}
 					}
 				}
@@ -223,10 +644,11 @@ func TestSync_DryRun(t *testing.T) {
 
 	result, err := syncer.Sync(context.Background(), server.URL)
 	assert.NoError(t, err)
-	assert.NotNil(t, result)
+	require.NotNil(t, result)
+	assert.Equal(t, 1, result.Synced)
 
 	// In dry run, no files should be written
-	// Will fail until implementation exists
+	assert.NoDirExists(t, filepath.Join(syncer.config.LocalDataDir, "shims"))
 }
 
 func TestSync_FilterTools(t *testing.T) {
@@ -245,25 +667,623 @@ func TestSync_FilterTools(t *testing.T) {
 }
 
 func TestSync_ErrorCollection(t *testing.T) {
+	okHash := "a1b2c3d4e5f6a1b2c3d4e5f6a1b2c3d4e5f6a1b2c3d4e5f6a1b2c3d4e5f6a1b2"
+	errorHash := "ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff"
+
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Simulate failures for certain hashes
-		if r.URL.Path == "/shims/sha256/error-hash.json" {
+		switch r.URL.Path {
+		case "/shims/index.json":
+			w.Write([]byte(`{
+				"tools": {
+					"curl": {"versions": {"8.5.0": {"linux-amd64": "sha256:` + okHash + `"}}},
+					"jq": {"versions": {"1.7": {"linux-amd64": "sha256:` + errorHash + `"}}}
+				}
+			}`))
+		case "/shims/sha256/" + errorHash + ".json":
+			// Simulate failures for certain hashes
 			w.WriteHeader(http.StatusInternalServerError)
-			return
+		case "/shims/sha256/" + okHash + ".json":
+			w.Write([]byte(`{"binary": {"hash": "sha256:` + okHash + `"}}`))
+		default:
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte(`{}`))
 		}
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte(`{}`))
 	}))
 	defer server.Close()
 
 	syncer := NewSyncer(&Config{
 		LocalDataDir: t.TempDir(),
+		RetryDelay:   time.Millisecond,
 	})
 
 	// Sync should continue on individual errors
 	result, err := syncer.Sync(context.Background(), server.URL)
-	assert.NoError(t, err)
-	assert.NotNil(t, result)
-	// Will fail until implementation exists
-	// assert.NotEmpty(t, result.Errors)
+	require.NoError(t, err)
+	require.NotNil(t, result)
+	assert.Equal(t, 1, result.Synced)
+	assert.Equal(t, 1, result.Failed)
+	require.Len(t, result.Errors, 1)
+	assert.Contains(t, result.Errors[0].Error(), "jq 1.7")
+}
+
+func TestSync_Parallelism(t *testing.T) {
+	tools := map[string]map[string]map[string]string{}
+	for i, name := range []string{"curl", "gh", "jq", "kubectl", "rg", "yq"} {
+		tools[name] = map[string]map[string]string{"1.0.0": {"linux-amd64": "sha256:" + strings.Repeat(fmt.Sprint(i+1), 64)}}
+	}
+	catalog := registry.Catalog{Version: "1", Tools: map[string]registry.ToolInfo{}}
+	for name, versions := range tools {
+		catalog.Tools[name] = registry.ToolInfo{Versions: versions}
+	}
+	catalogJSON, err := json.Marshal(catalog)
+	require.NoError(t, err)
+
+	// Count downloads in flight and remember the peak; gh and rg fail
+	var inFlight, peak int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/shims/index.json":
+			w.Write(catalogJSON)
+		case strings.HasPrefix(r.URL.Path, "/shims/sha256/"):
+			n := atomic.AddInt32(&inFlight, 1)
+			defer atomic.AddInt32(&inFlight, -1)
+			for {
+				p := atomic.LoadInt32(&peak)
+				if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+					break
+				}
+			}
+			time.Sleep(20 * time.Millisecond)
+
+			hash := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/shims/sha256/"), ".json")
+			if hash[0] == '2' || hash[0] == '5' {
+				http.NotFound(w, r)
+				return
+			}
+			w.Write([]byte(`{"binary": {"hash": "sha256:` + hash + `"}}`))
+		default:
+			w.Write([]byte(`{}`))
+		}
+	}))
+	defer server.Close()
+
+	for _, parallelism := range []int{1, 3} {
+		t.Run(fmt.Sprintf("parallelism=%d", parallelism), func(t *testing.T) {
+			atomic.StoreInt32(&peak, 0)
+			syncer := NewSyncer(&Config{LocalDataDir: t.TempDir(), Parallelism: parallelism})
+
+			result, err := syncer.Sync(context.Background(), server.URL)
+			require.NoError(t, err)
+			assert.Equal(t, 4, result.Synced)
+			assert.Equal(t, 2, result.Failed)
+			assert.Equal(t, int32(parallelism), atomic.LoadInt32(&peak))
+
+			// Errors stay in catalog order however downloads interleave
+			require.Len(t, result.Errors, 2)
+			assert.Contains(t, result.Errors[0].Error(), "gh 1.0.0")
+			assert.Contains(t, result.Errors[1].Error(), "rg 1.0.0")
+		})
+	}
+
+	t.Run("shared pool", func(t *testing.T) {
+		atomic.StoreInt32(&peak, 0)
+		syncer := NewSyncer(&Config{LocalDataDir: t.TempDir(), Parallelism: 8})
+		syncer.SetPool(pool.New(2))
+
+		result, err := syncer.Sync(context.Background(), server.URL)
+		require.NoError(t, err)
+		assert.Equal(t, 4, result.Synced)
+		assert.Equal(t, int32(2), atomic.LoadInt32(&peak))
+	})
+}
+
+func TestSync_ConnectionReuse(t *testing.T) {
+	catalog := registry.Catalog{Version: "1", Tools: map[string]registry.ToolInfo{}}
+	for i, name := range []string{"curl", "gh", "jq", "kubectl", "rg", "yq"} {
+		hash := "sha256:" + strings.Repeat(fmt.Sprint(i+1), 64)
+		catalog.Tools[name] = registry.ToolInfo{Versions: map[string]map[string]string{"1.0.0": {"linux-amd64": hash}}}
+	}
+	catalogJSON, err := json.Marshal(catalog)
+	require.NoError(t, err)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/shims/index.json":
+			w.Write(catalogJSON)
+		case strings.HasPrefix(r.URL.Path, "/shims/sha256/"):
+			hash := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/shims/sha256/"), ".json")
+			w.Write([]byte(`{"binary": {"hash": "sha256:` + hash + `"}}`))
+		default:
+			w.Write([]byte(`{}`))
+		}
+	}))
+	var conns int32
+	server.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(&conns, 1)
+		}
+	}
+	server.Start()
+	defer server.Close()
+
+	// Manifest, catalog and six shims, one at a time, over one connection
+	syncer := NewSyncer(&Config{LocalDataDir: t.TempDir(), Parallelism: 1})
+	result, err := syncer.Sync(context.Background(), server.URL)
+	require.NoError(t, err)
+	assert.Equal(t, 6, result.Synced)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&conns))
+
+	// A second sync with the same syncer dials nothing new
+	_, err = syncer.Sync(context.Background(), server.URL)
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&conns))
+}
+
+func TestSync_ReadTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	syncer := NewSyncer(&Config{LocalDataDir: t.TempDir(), ReadTimeout: 20 * time.Millisecond, MaxAttempts: 1})
+	_, err := syncer.FetchManifest(context.Background(), server.URL)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "timeout awaiting response headers")
+}
+
+func TestNewHTTPClient(t *testing.T) {
+	t.Run("defaults", func(t *testing.T) {
+		client := newHTTPClient(&Config{})
+		transport := client.Transport.(*http.Transport)
+		assert.Equal(t, DefaultTimeout, client.Timeout)
+		assert.Equal(t, DefaultConnectTimeout, transport.TLSHandshakeTimeout)
+		assert.Equal(t, DefaultReadTimeout, transport.ResponseHeaderTimeout)
+		assert.Equal(t, DefaultMaxIdleConns, transport.MaxIdleConns)
+		assert.Equal(t, DefaultMaxIdleConns, transport.MaxIdleConnsPerHost)
+		assert.Equal(t, DefaultIdleConnTimeout, transport.IdleConnTimeout)
+		assert.Equal(t, DefaultMaxConnsPerHost, transport.MaxConnsPerHost)
+		assert.True(t, transport.ForceAttemptHTTP2)
+	})
+
+	t.Run("configured", func(t *testing.T) {
+		client := newHTTPClient(&Config{
+			Timeout:         time.Minute,
+			ConnectTimeout:  2 * time.Second,
+			ReadTimeout:     5 * time.Second,
+			MaxIdleConns:    4,
+			IdleConnTimeout: 10 * time.Second,
+			MaxConnsPerHost: 8,
+			DisableHTTP2:    true,
+		})
+		transport := client.Transport.(*http.Transport)
+		assert.Equal(t, time.Minute, client.Timeout)
+		assert.Equal(t, 2*time.Second, transport.TLSHandshakeTimeout)
+		assert.Equal(t, 5*time.Second, transport.ResponseHeaderTimeout)
+		assert.Equal(t, 4, transport.MaxIdleConns)
+		assert.Equal(t, 4, transport.MaxIdleConnsPerHost)
+		assert.Equal(t, 10*time.Second, transport.IdleConnTimeout)
+		assert.Equal(t, 8, transport.MaxConnsPerHost)
+		assert.False(t, transport.ForceAttemptHTTP2)
+	})
+}
+
+func TestSync_CustomEndpoints(t *testing.T) {
+	hash := "a1b2c3d4e5f6a1b2c3d4e5f6a1b2c3d4e5f6a1b2c3d4e5f6a1b2c3d4e5f6a1b2"
+
+	var shimRequests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/.well-known/atip-registry.json":
+			w.Write([]byte(`{
+				"endpoints": {
+					"shims": "/shims/{hash}.json",
+					"catalog": "/index.json"
+				}
+			}`))
+		case r.URL.Path == "/index.json":
+			w.Write([]byte(`{"tools": {"curl": {"versions": {"8.5.0": {"linux-amd64": "sha256:` + hash + `"}}}}}`))
+		case strings.HasPrefix(r.URL.Path, "/shims/"):
+			shimRequests = append(shimRequests, r.URL.Path)
+			w.Write([]byte(`{"binary": {"hash": "sha256:` + hash + `"}}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	dataDir := t.TempDir()
+	syncer := NewSyncer(&Config{
+		LocalDataDir: dataDir,
+	})
+
+	result, err := syncer.Sync(context.Background(), server.URL)
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.Synced)
+	assert.Empty(t, result.Errors)
+	assert.Equal(t, []string{"/shims/" + hash + ".json"}, shimRequests)
+	assert.FileExists(t, filepath.Join(dataDir, "shims", "sha256", hash+".json"))
+}
+
+func TestSync_CachePersistence(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "cache")
+
+	cache := NewCache(dir)
+	cache.Set("abc123", `"v1"`)
+	require.NoError(t, cache.Save())
+
+	loaded, err := LoadCache(dir)
+	require.NoError(t, err)
+	etag, found := loaded.Get("abc123")
+	assert.True(t, found)
+	assert.Equal(t, `"v1"`, etag)
+
+	// Missing cache file yields an empty cache
+	empty, err := LoadCache(t.TempDir())
+	require.NoError(t, err)
+	_, found = empty.Get("abc123")
+	assert.False(t, found)
+}
+
+func TestSync_CacheDir(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", "/tmp/test-cache")
+	assert.Equal(t, "/tmp/test-cache/atip-registry", DefaultCacheDir())
+
+	syncer := NewSyncer(&Config{LocalDataDir: t.TempDir()})
+	assert.Equal(t, "/tmp/test-cache/atip-registry", syncer.CacheDir())
+
+	syncer = NewSyncer(&Config{CacheDir: "/custom/cache"})
+	assert.Equal(t, "/custom/cache", syncer.CacheDir())
+}
+// TestMain keeps syncs' ETag caches out of the user's cache directory.
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "atip-sync-cache-")
+	if err != nil {
+		panic(err)
+	}
+	os.Setenv("XDG_CACHE_HOME", dir)
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// testRegistry serves a catalog of tool -> version -> platform -> hash,
+// a shim for every hash and, if signed, a minisign signature for each by a
+// signer its manifest trusts. The hashes of downloaded shims are recorded.
+type testRegistry struct {
+	*httptest.Server
+	mu          gosync.Mutex
+	downloaded  []string
+	notModified []string            // Paths answered with 304 Not Modified
+	key         minisign.PrivateKey // Signs the shims, trusted by the manifest unless replaced
+	tampered    bool                // Serve signatures over other bytes than the shims
+}
+
+// notModifiedSince answers r with 304 if it is conditional on etag, which it
+// otherwise sets on the response.
+func (reg *testRegistry) notModifiedSince(w http.ResponseWriter, r *http.Request, etag string) bool {
+	w.Header().Set("ETag", etag)
+	if r.Header.Get("If-None-Match") != etag {
+		return false
+	}
+	reg.mu.Lock()
+	reg.notModified = append(reg.notModified, r.URL.Path)
+	reg.mu.Unlock()
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// testShim is the shim testRegistry serves for hash.
+func testShim(hash string) []byte {
+	return []byte(`{"binary": {"hash": "sha256:` + hash + `"}}`)
+}
+
+func newTestRegistry(t *testing.T, tools map[string]map[string]map[string]string, signed bool) *testRegistry {
+	t.Helper()
+
+	catalog := registry.Catalog{Version: "1", Tools: map[string]registry.ToolInfo{}}
+	for name, versions := range tools {
+		catalog.Tools[name] = registry.ToolInfo{Versions: versions}
+	}
+	catalogJSON, err := json.Marshal(catalog)
+	require.NoError(t, err)
+
+	manifest := []byte(`{}`)
+	publicKey, privateKey, err := minisign.GenerateKey(nil)
+	require.NoError(t, err)
+	if signed {
+		key, err := publicKey.MarshalText()
+		require.NoError(t, err)
+		manifest, err = json.Marshal(map[string]interface{}{"trust": map[string]interface{}{
+			"signers": []map[string]string{{"identity": "test@example.com", "publicKey": string(key)}},
+		}})
+		require.NoError(t, err)
+	}
+
+	reg := &testRegistry{key: privateKey}
+	reg.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/.well-known/atip-registry.json":
+			w.Write(manifest)
+		case r.URL.Path == "/shims/index.json":
+			if !reg.notModifiedSince(w, r, `"catalog"`) {
+				w.Write(catalogJSON)
+			}
+		case strings.HasSuffix(r.URL.Path, ".json.minisig") && signed:
+			hash := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/shims/sha256/"), ".json.minisig")
+			data := testShim(hash)
+			if reg.tampered {
+				data = testShim(strings.Repeat("0", 64))
+			}
+			w.Write(minisign.Sign(reg.key, data))
+		case strings.HasSuffix(r.URL.Path, ".json") && strings.HasPrefix(r.URL.Path, "/shims/sha256/"):
+			hash := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/shims/sha256/"), ".json")
+			if reg.notModifiedSince(w, r, `"`+hash+`"`) {
+				return
+			}
+			reg.mu.Lock()
+			reg.downloaded = append(reg.downloaded, hash)
+			reg.mu.Unlock()
+			w.Write(testShim(hash))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(reg.Close)
+	return reg
+}
+
+func TestSync_SyncAll_Precedence(t *testing.T) {
+	curlHash := strings.Repeat("1", 64)
+	jqHash := strings.Repeat("2", 64)
+	rebuiltCurlHash := strings.Repeat("3", 64)
+	ghHash := strings.Repeat("4", 64)
+
+	vendor := newTestRegistry(t, map[string]map[string]map[string]string{
+		"curl": {"8.5.0": {"linux-amd64": "sha256:" + curlHash}},
+		"jq":   {"1.7": {"linux-amd64": "sha256:" + jqHash}},
+	}, false)
+	internal := newTestRegistry(t, map[string]map[string]map[string]string{
+		"curl": {"8.5.0": {"linux-amd64": "sha256:" + rebuiltCurlHash}},
+		"jq":   {"1.7": {"linux-amd64": "sha256:" + jqHash}},
+		"gh":   {"2.45.0": {"linux-amd64": "sha256:" + ghHash}},
+	}, false)
+
+	dataDir := t.TempDir()
+	syncer := NewSyncer(&Config{LocalDataDir: dataDir})
+
+	result, err := syncer.SyncAll(context.Background(), []string{vendor.URL, internal.URL})
+	require.NoError(t, err)
+	assert.Empty(t, result.Errors)
+	assert.Equal(t, 3, result.Synced)
+
+	// The second registry supplies only the tool the first lacks
+	assert.ElementsMatch(t, []string{curlHash, jqHash}, vendor.downloaded)
+	assert.Equal(t, []string{ghHash}, internal.downloaded)
+	assert.FileExists(t, filepath.Join(dataDir, "shims", "sha256", ghHash+".json"))
+	assert.NoFileExists(t, filepath.Join(dataDir, "shims", "sha256", rebuiltCurlHash+".json"))
+
+	assert.Equal(t, []SourceResult{
+		{URL: vendor.URL, Synced: 2},
+		{URL: internal.URL, Synced: 1, Duplicates: 2},
+	}, result.Sources)
+
+	assert.Equal(t, []Conflict{{
+		Tool:     "curl",
+		Version:  "8.5.0",
+		Platform: "linux-amd64",
+		Chosen:   vendor.URL,
+		Hashes: map[string]string{
+			vendor.URL:   "sha256:" + curlHash,
+			internal.URL: "sha256:" + rebuiltCurlHash,
+		},
+	}}, result.Conflicts)
+}
+
+func TestSync_SyncAll_Unchanged(t *testing.T) {
+	jqHash := strings.Repeat("1", 64)
+	ghHash := strings.Repeat("2", 64)
+	reg := newTestRegistry(t, map[string]map[string]map[string]string{
+		"jq": {"1.7": {"linux-amd64": "sha256:" + jqHash}},
+		"gh": {"2.45.0": {"linux-amd64": "sha256:" + ghHash}},
+	}, false)
+
+	dataDir := t.TempDir()
+	cacheDir := t.TempDir()
+	run := func(config Config) *SyncResult {
+		t.Helper()
+		config.LocalDataDir = dataDir
+		config.CacheDir = cacheDir
+		result, err := NewSyncer(&config).Sync(context.Background(), reg.URL)
+		require.NoError(t, err)
+		assert.Empty(t, result.Errors)
+		return result
+	}
+
+	first := run(Config{})
+	assert.Equal(t, 2, first.Synced)
+	assert.Empty(t, reg.notModified)
+	assert.FileExists(t, filepath.Join(cacheDir, cacheFileName))
+
+	// The cached ETags are sent, and the catalog is read from the cache
+	os.Remove(filepath.Join(dataDir, "shims", "sha256", ghHash+".json"))
+	reg.downloaded = nil
+	second := run(Config{})
+	assert.Equal(t, 1, second.Synced)
+	assert.Equal(t, 1, second.Unchanged)
+	assert.Equal(t, []SourceResult{{URL: reg.URL, Synced: 1, Unchanged: 1}}, second.Sources)
+	assert.Equal(t, []string{ghHash}, reg.downloaded, "a shim missing locally is fetched unconditionally")
+	assert.ElementsMatch(t, []string{"/shims/index.json", "/shims/sha256/" + jqHash + ".json"}, reg.notModified)
+
+	reg.downloaded, reg.notModified = nil, nil
+	forced := run(Config{ForceRefresh: true})
+	assert.Equal(t, 2, forced.Synced)
+	assert.Zero(t, forced.Unchanged)
+	assert.Empty(t, reg.notModified)
+}
+
+func TestSync_SyncAll_VerifySignatures(t *testing.T) {
+	signedHash := strings.Repeat("1", 64)
+	unsignedHash := strings.Repeat("2", 64)
+
+	signed := newTestRegistry(t, map[string]map[string]map[string]string{
+		"curl": {"8.5.0": {"linux-amd64": "sha256:" + signedHash}},
+	}, true)
+	unsigned := newTestRegistry(t, map[string]map[string]map[string]string{
+		"jq": {"1.7": {"linux-amd64": "sha256:" + unsignedHash}},
+	}, false)
+
+	dataDir := t.TempDir()
+	syncer := NewSyncer(&Config{LocalDataDir: dataDir, VerifySignatures: true, MaxAttempts: 1})
+
+	result, err := syncer.SyncAll(context.Background(), []string{signed.URL, unsigned.URL})
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.Synced)
+	assert.Equal(t, 1, result.Failed)
+	require.Len(t, result.Errors, 1)
+	assert.Contains(t, result.Errors[0].Error(), unsigned.URL)
+	assert.Contains(t, result.Errors[0].Error(), "jq 1.7")
+
+	shimDir := filepath.Join(dataDir, "shims", "sha256")
+	assert.FileExists(t, filepath.Join(shimDir, signedHash+".json.minisig"))
+	assert.NoFileExists(t, filepath.Join(shimDir, unsignedHash+".json"))
+}
+
+func TestSync_SyncAll_RejectsBadSignatures(t *testing.T) {
+	hash := strings.Repeat("1", 64)
+	tools := map[string]map[string]map[string]string{
+		"curl": {"8.5.0": {"linux-amd64": "sha256:" + hash}},
+	}
+
+	tests := []struct {
+		name  string
+		setup func(reg *testRegistry)
+		err   error
+	}{
+		{
+			name:  "tampered signature",
+			setup: func(reg *testRegistry) { reg.tampered = true },
+			err:   trust.ErrInvalidSignature,
+		},
+		{
+			name: "signed by an untrusted key",
+			setup: func(reg *testRegistry) {
+				_, key, err := minisign.GenerateKey(nil)
+				require.NoError(t, err)
+				reg.key = key
+			},
+			err: trust.ErrUntrustedSigner,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reg := newTestRegistry(t, tools, true)
+			tt.setup(reg)
+
+			dataDir := t.TempDir()
+			syncer := NewSyncer(&Config{LocalDataDir: dataDir, VerifySignatures: true, MaxAttempts: 1})
+			result, err := syncer.SyncAll(context.Background(), []string{reg.URL})
+			require.NoError(t, err)
+			assert.Equal(t, 0, result.Synced)
+			assert.Equal(t, 1, result.Failed)
+			require.Len(t, result.Errors, 1)
+			assert.ErrorIs(t, result.Errors[0], tt.err)
+
+			shimDir := filepath.Join(dataDir, "shims", "sha256")
+			assert.NoFileExists(t, filepath.Join(shimDir, hash+".json"))
+			assert.NoFileExists(t, filepath.Join(shimDir, hash+".json.minisig"))
+		})
+	}
+}
+
+func TestSync_SyncAll_NoTrustedSigners(t *testing.T) {
+	hash := strings.Repeat("1", 64)
+	reg := newTestRegistry(t, map[string]map[string]map[string]string{
+		"curl": {"8.5.0": {"linux-amd64": "sha256:" + hash}},
+	}, false)
+
+	syncer := NewSyncer(&Config{LocalDataDir: t.TempDir(), VerifySignatures: true, MaxAttempts: 1})
+	result, err := syncer.SyncAll(context.Background(), []string{reg.URL})
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.Failed)
+	require.Len(t, result.Errors, 1)
+	assert.ErrorIs(t, result.Errors[0], trust.ErrUntrustedSigner)
+}
+
+func TestSync_SyncAll_CosignSignatures(t *testing.T) {
+	hash := strings.Repeat("1", 64)
+	catalog := `{"version": "1", "tools": {"curl": {"versions": {"8.5.0": {"linux-amd64": "sha256:` + hash + `"}}}}}`
+	newCosignRegistry := func(t *testing.T, signer string) string {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/.well-known/atip-registry.json":
+				fmt.Fprintf(w, `{"trust": {"signers": [%s]}}`, signer)
+			case "/shims/index.json":
+				w.Write([]byte(catalog))
+			case "/shims/sha256/" + hash + ".json":
+				w.Write(testShim(hash))
+			case "/shims/sha256/" + hash + ".json.bundle":
+				w.Write([]byte("mock-signature-bundle"))
+			default:
+				http.NotFound(w, r)
+			}
+		}))
+		t.Cleanup(server.Close)
+		return server.URL
+	}
+	trusted := `{"identity": "test@example.com", "issuer": "https://accounts.google.com"}`
+
+	t.Run("trusted identity", func(t *testing.T) {
+		argsPath := trusttest.FakeCosign(t, "test@example.com")
+		dataDir := t.TempDir()
+		syncer := NewSyncer(&Config{LocalDataDir: dataDir, VerifySignatures: true, MaxAttempts: 1})
+		result, err := syncer.SyncAll(context.Background(), []string{newCosignRegistry(t, trusted)})
+		require.NoError(t, err)
+		assert.Empty(t, result.Errors)
+		assert.Equal(t, 1, result.Synced)
+
+		shimPath := filepath.Join(dataDir, "shims", "sha256", hash+".json")
+		assert.FileExists(t, shimPath+".bundle")
+		args, err := os.ReadFile(argsPath)
+		require.NoError(t, err)
+		assert.Contains(t, string(args), "verify-blob --certificate-identity test@example.com --certificate-oidc-issuer https://accounts.google.com")
+	})
+
+	t.Run("other identity", func(t *testing.T) {
+		trusttest.FakeCosign(t, "maintainers@atip.dev")
+		dataDir := t.TempDir()
+		syncer := NewSyncer(&Config{LocalDataDir: dataDir, VerifySignatures: true, MaxAttempts: 1})
+		result, err := syncer.SyncAll(context.Background(), []string{newCosignRegistry(t, trusted)})
+		require.NoError(t, err)
+		assert.Equal(t, 1, result.Failed)
+		require.Len(t, result.Errors, 1)
+		assert.ErrorIs(t, result.Errors[0], trust.ErrInvalidSignature)
+
+		shimPath := filepath.Join(dataDir, "shims", "sha256", hash+".json")
+		assert.NoFileExists(t, shimPath)
+		assert.NoFileExists(t, shimPath+".bundle")
+	})
+
+	t.Run("identity without issuer", func(t *testing.T) {
+		argsPath := trusttest.FakeCosign(t, "test@example.com")
+		syncer := NewSyncer(&Config{LocalDataDir: t.TempDir(), VerifySignatures: true, MaxAttempts: 1})
+		result, err := syncer.SyncAll(context.Background(), []string{newCosignRegistry(t, `{"identity": "test@example.com"}`)})
+		require.NoError(t, err)
+		assert.Equal(t, 1, result.Failed)
+		require.Len(t, result.Errors, 1)
+		assert.ErrorIs(t, result.Errors[0], trust.ErrUntrustedSigner)
+		assert.NoFileExists(t, argsPath, "cosign ran")
+	})
+}
+
+func TestSync_SyncAll_UnreachableSource(t *testing.T) {
+	reachable := newTestRegistry(t, map[string]map[string]map[string]string{}, false)
+	unreachable := httptest.NewServer(http.NotFoundHandler())
+	defer unreachable.Close()
+
+	syncer := NewSyncer(&Config{LocalDataDir: t.TempDir(), MaxAttempts: 1})
+	_, err := syncer.SyncAll(context.Background(), []string{reachable.URL, unreachable.URL})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), unreachable.URL)
 }
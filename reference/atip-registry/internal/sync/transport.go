@@ -0,0 +1,80 @@
+package sync
+
+import (
+	"net"
+	"net/http"
+	"time"
+)
+
+const (
+	// DefaultTimeout bounds a whole request, including reading the body,
+	// when Config.Timeout is zero.
+	DefaultTimeout = 30 * time.Second
+
+	// DefaultConnectTimeout bounds dialing and the TLS handshake when
+	// Config.ConnectTimeout is zero.
+	DefaultConnectTimeout = 10 * time.Second
+
+	// DefaultReadTimeout bounds the wait for response headers once a request
+	// is sent when Config.ReadTimeout is zero.
+	DefaultReadTimeout = 15 * time.Second
+
+	// DefaultMaxIdleConns is the number of idle connections kept for reuse
+	// when Config.MaxIdleConns is zero.
+	DefaultMaxIdleConns = 32
+
+	// DefaultIdleConnTimeout is how long an idle connection is kept when
+	// Config.IdleConnTimeout is zero.
+	DefaultIdleConnTimeout = 90 * time.Second
+
+	// DefaultMaxConnsPerHost caps connections to one registry when
+	// Config.MaxConnsPerHost is zero. It is above DefaultParallelism so
+	// manifest and signature requests don't queue behind shim downloads.
+	DefaultMaxConnsPerHost = 16
+)
+
+// newHTTPClient returns the client a Syncer makes its requests with. Its
+// transport keeps connections alive and, unlike net/http's default of 2,
+// keeps as many idle per host as overall: a sync talks to a handful of
+// registries, so that is what lets hundreds of small shim downloads share a
+// few connections instead of dialing for each.
+func newHTTPClient(config *Config) *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   orDefault(config.ConnectTimeout, DefaultConnectTimeout),
+		KeepAlive: 30 * time.Second,
+	}
+	maxIdle := config.MaxIdleConns
+	if maxIdle <= 0 {
+		maxIdle = DefaultMaxIdleConns
+	}
+	maxPerHost := config.MaxConnsPerHost
+	if maxPerHost <= 0 {
+		maxPerHost = DefaultMaxConnsPerHost
+	}
+
+	transport := &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		TLSHandshakeTimeout:   orDefault(config.ConnectTimeout, DefaultConnectTimeout),
+		ResponseHeaderTimeout: orDefault(config.ReadTimeout, DefaultReadTimeout),
+		ExpectContinueTimeout: time.Second,
+		MaxIdleConns:          maxIdle,
+		MaxIdleConnsPerHost:   maxIdle,
+		MaxConnsPerHost:       maxPerHost,
+		IdleConnTimeout:       orDefault(config.IdleConnTimeout, DefaultIdleConnTimeout),
+		ForceAttemptHTTP2:     !config.DisableHTTP2,
+	}
+
+	return &http.Client{
+		Timeout:   orDefault(config.Timeout, DefaultTimeout),
+		Transport: transport,
+	}
+}
+
+// orDefault returns d, or def if d isn't positive.
+func orDefault(d, def time.Duration) time.Duration {
+	if d > 0 {
+		return d
+	}
+	return def
+}
@@ -0,0 +1,124 @@
+package trust
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"aead.dev/minisign"
+)
+
+// MinisignExtension is appended to a shim path to form its signature path.
+const MinisignExtension = ".minisig"
+
+// MinisignBackend is the SignatureBackend that signs shims offline with a
+// minisign (ed25519) keypair and stores signatures as .minisig sidecars.
+// Signatures are compatible with the minisign CLI.
+type MinisignBackend struct {
+	config *Config
+	key    *minisign.PrivateKey // loaded from config.KeyPath on first Sign
+}
+
+// NewMinisignBackend creates a minisign signature backend. Signing reads the
+// encrypted private key at config.KeyPath, decrypted with config.Password.
+func NewMinisignBackend(config *Config) *MinisignBackend {
+	return &MinisignBackend{config: config}
+}
+
+// Name returns "minisign"
+func (b *MinisignBackend) Name() string {
+	return BackendMinisign
+}
+
+// SignaturePath returns the .minisig path for shimPath
+func (b *MinisignBackend) SignaturePath(shimPath string) string {
+	return shimPath + MinisignExtension
+}
+
+// Sign signs a shim with the private key, pre-hashing it like minisign does
+// by default, and writes the signature sidecar.
+func (b *MinisignBackend) Sign(shimPath string) error {
+	key, err := b.privateKey()
+	if err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(shimPath)
+	if err != nil {
+		return err
+	}
+
+	reader := minisign.NewReader(bytes.NewReader(data))
+	if _, err := io.Copy(io.Discard, reader); err != nil {
+		return err
+	}
+	keyID := strings.ToUpper(strconv.FormatUint(key.ID(), 16))
+	trustedComment := fmt.Sprintf("timestamp:%d\tfile:%s\thashed", time.Now().Unix(), filepath.Base(shimPath))
+	signature := reader.SignWithComments(*key, trustedComment, "signature from minisign secret key "+keyID)
+
+	return os.WriteFile(b.SignaturePath(shimPath), signature, 0644)
+}
+
+// Verify checks the shim's signature against the public keys of signers.
+// Signers without a public key are ignored.
+func (b *MinisignBackend) Verify(shimPath string, signers []Signer) error {
+	sigData, err := os.ReadFile(b.SignaturePath(shimPath))
+	if os.IsNotExist(err) {
+		return errors.New("signature not found")
+	}
+	if err != nil {
+		return err
+	}
+
+	var signature minisign.Signature
+	if err := signature.UnmarshalText(sigData); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+	}
+
+	data, err := os.ReadFile(shimPath)
+	if err != nil {
+		return err
+	}
+
+	for _, signer := range signers {
+		if signer.PublicKey == "" {
+			continue
+		}
+		var publicKey minisign.PublicKey
+		if err := publicKey.UnmarshalText([]byte(signer.PublicKey)); err != nil {
+			return fmt.Errorf("invalid public key for signer %q: %w", signer.Identity, err)
+		}
+		if publicKey.ID() != signature.KeyID {
+			continue
+		}
+		if !minisign.Verify(publicKey, data, sigData) {
+			return fmt.Errorf("%w: %s", ErrInvalidSignature, shimPath)
+		}
+		return nil
+	}
+
+	return fmt.Errorf("%w: key %X", ErrUntrustedSigner, signature.KeyID)
+}
+
+// privateKey loads and decrypts the private key once.
+func (b *MinisignBackend) privateKey() (*minisign.PrivateKey, error) {
+	if b.key != nil {
+		return b.key, nil
+	}
+	if b.config == nil || b.config.KeyPath == "" {
+		return nil, errors.New("minisign signing requires a private key")
+	}
+
+	key, err := minisign.PrivateKeyFromFile(b.config.Password, b.config.KeyPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load minisign private key: %w", err)
+	}
+	b.key = &key
+	return b.key, nil
+}
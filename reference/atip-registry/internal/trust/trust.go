@@ -1,9 +1,11 @@
-// Package trust provides signature creation and verification for ATIP shims
-// using Cosign. It supports both keyless signing (OIDC) and key-based signing,
-// and verifies signatures against expected identities.
+// Package trust provides signature creation and verification for ATIP shims.
+// Signing is pluggable through SignatureBackend: the Cosign backend supports
+// keyless (OIDC) and key-based signing, and the minisign backend signs
+// offline with an ed25519 keypair stored on disk.
 package trust
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -16,6 +18,7 @@ type Config struct {
 	Identity string // OIDC identity for keyless signing (e.g., "user@example.com")
 	Issuer   string // OIDC issuer URL for keyless signing
 	KeyPath  string // Path to private key for key-based signing
+	Password string // Password for an encrypted minisign private key
 }
 
 // TrustConfig holds registry trust requirements.
@@ -27,8 +30,50 @@ type TrustConfig struct {
 
 // Signer represents a trusted signer identity.
 type Signer struct {
-	Identity string // Signer identity (e.g., email address)
-	Issuer   string // OIDC issuer that authenticated the signer
+	Identity  string // Signer identity (e.g., email address)
+	Issuer    string // OIDC issuer that authenticated the signer
+	PublicKey string // minisign public key, for the minisign backend
+}
+
+// Backend names accepted by NewBackend.
+const (
+	BackendCosign   = "cosign"
+	BackendMinisign = "minisign"
+)
+
+var (
+	// ErrUntrustedSigner indicates a signature was not made by any trusted signer.
+	ErrUntrustedSigner = errors.New("signature not made by a trusted signer")
+
+	// ErrInvalidSignature indicates a signature does not match the shim.
+	ErrInvalidSignature = errors.New("signature verification failed")
+)
+
+// SignatureBackend signs shim files and verifies their signature sidecars.
+type SignatureBackend interface {
+	// Name returns the backend name as accepted by NewBackend.
+	Name() string
+
+	// SignaturePath returns the path of the signature sidecar for shimPath.
+	SignaturePath(shimPath string) string
+
+	// Sign signs the shim at shimPath, writing the signature sidecar.
+	Sign(shimPath string) error
+
+	// Verify checks that the shim's signature was made by one of signers.
+	Verify(shimPath string, signers []Signer) error
+}
+
+// NewBackend returns the signature backend with the given name.
+func NewBackend(name string, config *Config) (SignatureBackend, error) {
+	switch name {
+	case BackendCosign:
+		return NewCosignBackend(config), nil
+	case BackendMinisign:
+		return NewMinisignBackend(config), nil
+	default:
+		return nil, fmt.Errorf("unknown signature backend %q: must be %s or %s", name, BackendCosign, BackendMinisign)
+	}
 }
 
 // SignerImpl manages signature creation using Cosign.
@@ -39,6 +84,12 @@ type SignerImpl struct {
 // Verifier manages signature verification using Cosign.
 type Verifier struct{}
 
+// CosignBackend is the SignatureBackend that shells out to Cosign and stores
+// signatures as .bundle sidecars.
+type CosignBackend struct {
+	config *Config
+}
+
 // CosignWrapper wraps the Cosign CLI for signing and verification.
 // It constructs appropriate command-line invocations based on configuration.
 type CosignWrapper struct {
@@ -71,13 +122,61 @@ func (s *SignerImpl) Sign(shimPath string) error {
 	return os.WriteFile(bundlePath, output, 0644)
 }
 
+// NewCosignBackend creates a Cosign signature backend
+func NewCosignBackend(config *Config) *CosignBackend {
+	return &CosignBackend{config: config}
+}
+
+// Name returns "cosign"
+func (b *CosignBackend) Name() string {
+	return BackendCosign
+}
+
+// SignaturePath returns the bundle path for shimPath
+func (b *CosignBackend) SignaturePath(shimPath string) string {
+	return shimPath + ".bundle"
+}
+
+// Sign signs a shim with Cosign
+func (b *CosignBackend) Sign(shimPath string) error {
+	return NewSigner(b.config).Sign(shimPath)
+}
+
+// Verify verifies a shim's bundle against the identity and issuer of each
+// signer that has an identity (see Verifier.Verify), or offline against the
+// public key at config.KeyPath when one is set
+func (b *CosignBackend) Verify(shimPath string, signers []Signer) error {
+	verifier := NewVerifier()
+	if b.config != nil && b.config.KeyPath != "" {
+		return verifier.VerifyWithKey(shimPath, b.config.KeyPath)
+	}
+
+	err := ErrUntrustedSigner
+	for _, signer := range signers {
+		if signer.Identity == "" {
+			continue
+		}
+		if err = verifier.Verify(shimPath, signer); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
 // NewVerifier creates a verifier instance
 func NewVerifier() *Verifier {
 	return &Verifier{}
 }
 
-// Verify verifies a shim signature
+// Verify checks the shim's bundle with cosign verify-blob, which requires
+// its keyless certificate to name the expected identity and OIDC issuer.
+// Signers missing either are rejected, and so is every bundle if Cosign
+// isn't installed.
 func (v *Verifier) Verify(shimPath string, expected Signer) error {
+	if err := expected.Validate(); err != nil {
+		return fmt.Errorf("%w: %v", ErrUntrustedSigner, err)
+	}
+
 	bundlePath := shimPath + ".bundle"
 
 	// Check if bundle exists
@@ -90,17 +189,37 @@ func (v *Verifier) Verify(shimPath string, expected Signer) error {
 	if err != nil {
 		return err
 	}
+	if len(bytes.TrimSpace(bundleData)) == 0 {
+		return fmt.Errorf("%w: empty bundle %s", ErrInvalidSignature, bundlePath)
+	}
 
-	// Parse bundle
-	bundle, err := ParseBundle(bundleData)
+	cmd := NewCosignWrapper(&Config{Identity: expected.Identity, Issuer: expected.Issuer}).BuildVerifyCommand(shimPath)
+	output, err := cmd.CombinedOutput()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return fmt.Errorf("%w: cosign verify-blob failed for %s: %v (output: %s)", ErrInvalidSignature, expected.Identity, err, string(output))
+	}
 	if err != nil {
-		return err
+		return fmt.Errorf("cosign verify-blob failed: %w", err)
 	}
+	return nil
+}
 
-	// Minimal verification - just ensure bundle exists
-	_ = bundle
-	_ = expected
+// VerifyWithKey verifies a shim's bundle against a pinned Cosign public key.
+// Transparency log checks are skipped, so no network access is needed.
+func (v *Verifier) VerifyWithKey(shimPath, pubKeyPath string) error {
+	if _, err := os.Stat(shimPath + ".bundle"); os.IsNotExist(err) {
+		return errors.New("bundle not found")
+	}
+	if _, err := os.Stat(pubKeyPath); err != nil {
+		return fmt.Errorf("public key not readable: %w", err)
+	}
 
+	cmd := NewCosignWrapper(&Config{KeyPath: pubKeyPath}).BuildVerifyCommand(shimPath)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("cosign verify-blob failed: %w (output: %s)", err, string(output))
+	}
 	return nil
 }
 
@@ -147,3 +266,23 @@ func (cw *CosignWrapper) BuildSignCommand(shimPath string) *exec.Cmd {
 
 	return exec.Command("cosign", args...)
 }
+
+// BuildVerifyCommand builds the Cosign verify-blob command. With a key it
+// verifies offline against that public key, skipping the transparency log;
+// otherwise it checks the keyless certificate's identity and issuer.
+func (cw *CosignWrapper) BuildVerifyCommand(shimPath string) *exec.Cmd {
+	args := []string{"verify-blob"}
+
+	if cw.config.KeyPath != "" {
+		args = append(args, "--key", cw.config.KeyPath, "--insecure-ignore-tlog=true")
+	} else {
+		args = append(args,
+			"--certificate-identity", cw.config.Identity,
+			"--certificate-oidc-issuer", cw.config.Issuer,
+		)
+	}
+
+	args = append(args, "--bundle", shimPath+".bundle", shimPath)
+
+	return exec.Command("cosign", args...)
+}
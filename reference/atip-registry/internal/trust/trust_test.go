@@ -6,8 +6,11 @@ import (
 	"path/filepath"
 	"testing"
 
+	"aead.dev/minisign"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"github.com/anthropics/atip/reference/atip-registry/internal/trust/trusttest"
 )
 
 func TestSigner_Sign(t *testing.T) {
@@ -73,6 +76,7 @@ func TestSigner_SignWithKey(t *testing.T) {
 }
 
 func TestVerifier_Verify(t *testing.T) {
+	argsPath := trusttest.FakeCosign(t, "test@example.com")
 	tmpDir := t.TempDir()
 	shimPath := filepath.Join(tmpDir, "test.json")
 	bundlePath := shimPath + ".bundle"
@@ -92,9 +96,11 @@ func TestVerifier_Verify(t *testing.T) {
 	}
 
 	err := verifier.Verify(shimPath, expected)
-
-	// Minimal implementation just checks bundle exists
 	assert.NoError(t, err)
+
+	args, err := os.ReadFile(argsPath)
+	require.NoError(t, err)
+	assert.Equal(t, "verify-blob --certificate-identity test@example.com --certificate-oidc-issuer https://accounts.google.com --bundle "+bundlePath+" "+shimPath+"\n", string(args))
 }
 
 func TestVerifier_VerifyMissingBundle(t *testing.T) {
@@ -116,10 +122,42 @@ func TestVerifier_VerifyMissingBundle(t *testing.T) {
 	assert.Contains(t, err.Error(), "bundle not found")
 }
 
+func TestVerifier_VerifyEmptyBundle(t *testing.T) {
+	shimPath := filepath.Join(t.TempDir(), "test.json")
+	require.NoError(t, os.WriteFile(shimPath, []byte(`{"name": "test"}`), 0644))
+	require.NoError(t, os.WriteFile(shimPath+".bundle", []byte(" \n"), 0644))
+
+	err := NewVerifier().Verify(shimPath, Signer{Identity: "test@example.com", Issuer: "https://accounts.google.com"})
+	assert.ErrorIs(t, err, ErrInvalidSignature)
+}
+
 func TestVerifier_IdentityMismatch(t *testing.T) {
-	// Skip - minimal implementation doesn't verify identity yet
-	// Full implementation would verify certificate identity matches expected
-	t.Skip("Identity verification not yet implemented")
+	trusttest.FakeCosign(t, "maintainers@atip.dev")
+	shimPath := filepath.Join(t.TempDir(), "test.json")
+	require.NoError(t, os.WriteFile(shimPath, []byte(`{"name": "test"}`), 0644))
+	require.NoError(t, os.WriteFile(shimPath+".bundle", []byte("mock-signature-bundle"), 0644))
+
+	err := NewVerifier().Verify(shimPath, Signer{Identity: "test@example.com", Issuer: "https://accounts.google.com"})
+	assert.ErrorIs(t, err, ErrInvalidSignature)
+	assert.Contains(t, err.Error(), "none of the expected identities matched")
+}
+
+func TestVerifier_FailsClosed(t *testing.T) {
+	shimPath := filepath.Join(t.TempDir(), "test.json")
+	require.NoError(t, os.WriteFile(shimPath, []byte(`{"name": "test"}`), 0644))
+	require.NoError(t, os.WriteFile(shimPath+".bundle", []byte("mock-signature-bundle"), 0644))
+
+	t.Run("signer without issuer", func(t *testing.T) {
+		trusttest.FakeCosign(t, "test@example.com")
+		err := NewVerifier().Verify(shimPath, Signer{Identity: "test@example.com"})
+		assert.ErrorIs(t, err, ErrUntrustedSigner)
+	})
+
+	t.Run("cosign not installed", func(t *testing.T) {
+		t.Setenv("PATH", t.TempDir())
+		err := NewVerifier().Verify(shimPath, Signer{Identity: "test@example.com", Issuer: "https://accounts.google.com"})
+		assert.ErrorIs(t, err, exec.ErrNotFound)
+	})
 }
 
 func TestBundleParser(t *testing.T) {
@@ -223,3 +261,201 @@ func TestSigner_ValidateIdentity(t *testing.T) {
 		})
 	}
 }
+
+func TestNewBackend(t *testing.T) {
+	tests := []struct {
+		name        string
+		backend     string
+		expectError bool
+	}{
+		{name: "cosign", backend: BackendCosign},
+		{name: "minisign", backend: BackendMinisign},
+		{name: "unknown", backend: "gpg", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend, err := NewBackend(tt.backend, &Config{})
+			if tt.expectError {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.backend, backend.Name())
+		})
+	}
+}
+
+func TestCosignBackend_Verify(t *testing.T) {
+	trusttest.FakeCosign(t, "test@example.com")
+	tmpDir := t.TempDir()
+	shimPath := filepath.Join(tmpDir, "test.json")
+	require.NoError(t, os.WriteFile(shimPath, []byte(`{"name": "test"}`), 0644))
+
+	backend := NewCosignBackend(&Config{})
+	require.NoError(t, os.WriteFile(backend.SignaturePath(shimPath), []byte("mock-signature-bundle"), 0644))
+
+	signer := Signer{Identity: "test@example.com", Issuer: "https://accounts.google.com"}
+	other := Signer{Identity: "other@example.com", Issuer: "https://accounts.google.com"}
+	assert.NoError(t, backend.Verify(shimPath, []Signer{other, signer}))
+	assert.ErrorIs(t, backend.Verify(shimPath, []Signer{other}), ErrInvalidSignature)
+
+	// Without a trusted identity nothing is accepted
+	err := backend.Verify(shimPath, nil)
+	assert.ErrorIs(t, err, ErrUntrustedSigner)
+}
+
+// writeMinisignShim writes a shim and returns its path.
+func writeMinisignShim(t *testing.T) string {
+	t.Helper()
+	shimPath := filepath.Join(t.TempDir(), "test.json")
+	shimData := []byte(`{"atip": {"version": "0.6"}, "name": "test", "version": "1.0", "description": "Test"}`)
+	require.NoError(t, os.WriteFile(shimPath, shimData, 0644))
+	return shimPath
+}
+
+// minisignSigner returns a trusted signer for publicKey.
+func minisignSigner(t *testing.T, publicKey minisign.PublicKey) Signer {
+	t.Helper()
+	text, err := publicKey.MarshalText()
+	require.NoError(t, err)
+	return Signer{Identity: "maintainers@atip.dev", PublicKey: string(text)}
+}
+
+func TestMinisignBackend_RoundTrip(t *testing.T) {
+	publicKey, privateKey, err := minisign.GenerateKey(nil)
+	require.NoError(t, err)
+	otherKey, _, err := minisign.GenerateKey(nil)
+	require.NoError(t, err)
+
+	backend := NewMinisignBackend(&Config{})
+	backend.key = &privateKey
+
+	shimPath := writeMinisignShim(t)
+	require.NoError(t, backend.Sign(shimPath))
+	assert.FileExists(t, shimPath+MinisignExtension)
+
+	trusted := minisignSigner(t, publicKey)
+	untrusted := minisignSigner(t, otherKey)
+
+	t.Run("trusted signer", func(t *testing.T) {
+		assert.NoError(t, backend.Verify(shimPath, []Signer{untrusted, trusted}))
+	})
+
+	t.Run("signer without public key is ignored", func(t *testing.T) {
+		cosignOnly := Signer{Identity: "test@example.com", Issuer: "https://accounts.google.com"}
+		err := backend.Verify(shimPath, []Signer{cosignOnly})
+		assert.ErrorIs(t, err, ErrUntrustedSigner)
+	})
+
+	t.Run("untrusted key", func(t *testing.T) {
+		err := backend.Verify(shimPath, []Signer{untrusted})
+		assert.ErrorIs(t, err, ErrUntrustedSigner)
+	})
+
+	t.Run("tampered shim", func(t *testing.T) {
+		tampered := filepath.Join(t.TempDir(), "test.json")
+		require.NoError(t, os.WriteFile(tampered, []byte(`{"name": "evil"}`), 0644))
+		sig, err := os.ReadFile(shimPath + MinisignExtension)
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(tampered+MinisignExtension, sig, 0644))
+
+		err = backend.Verify(tampered, []Signer{trusted})
+		assert.ErrorIs(t, err, ErrInvalidSignature)
+	})
+
+	t.Run("missing signature", func(t *testing.T) {
+		err := backend.Verify(writeMinisignShim(t), []Signer{trusted})
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "signature not found")
+	})
+}
+
+func TestMinisignBackend_KeyFile(t *testing.T) {
+	keyPath := filepath.Join(t.TempDir(), "minisign.key")
+	publicKey := trusttest.WriteMinisignKey(t, keyPath, "secret")
+
+	shimPath := writeMinisignShim(t)
+
+	backend := NewMinisignBackend(&Config{KeyPath: keyPath, Password: "secret"})
+	require.NoError(t, backend.Sign(shimPath))
+	assert.NoError(t, backend.Verify(shimPath, []Signer{minisignSigner(t, publicKey)}))
+
+	// Signatures interoperate with the minisign format
+	sig, err := os.ReadFile(shimPath + MinisignExtension)
+	require.NoError(t, err)
+	data, err := os.ReadFile(shimPath)
+	require.NoError(t, err)
+	assert.True(t, minisign.Verify(publicKey, data, sig))
+}
+
+func TestMinisignBackend_SignWithoutKey(t *testing.T) {
+	backend := NewMinisignBackend(&Config{})
+	err := backend.Sign(writeMinisignShim(t))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "private key")
+}
+
+func TestCosignWrapper_VerifyCommandConstruction(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   *Config
+		expected []string
+	}{
+		{
+			name:   "key-based offline verification",
+			config: &Config{KeyPath: "/path/to/cosign.pub"},
+			expected: []string{"cosign", "verify-blob",
+				"--key", "/path/to/cosign.pub", "--insecure-ignore-tlog=true",
+				"--bundle", "/path/to/shim.json.bundle", "/path/to/shim.json"},
+		},
+		{
+			name: "keyless verification",
+			config: &Config{
+				Identity: "test@example.com",
+				Issuer:   "https://accounts.google.com",
+			},
+			expected: []string{"cosign", "verify-blob",
+				"--certificate-identity", "test@example.com",
+				"--certificate-oidc-issuer", "https://accounts.google.com",
+				"--bundle", "/path/to/shim.json.bundle", "/path/to/shim.json"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := NewCosignWrapper(tt.config).BuildVerifyCommand("/path/to/shim.json")
+			assert.Equal(t, tt.expected, cmd.Args)
+		})
+	}
+}
+
+func TestVerifier_VerifyWithKey(t *testing.T) {
+	tmpDir := t.TempDir()
+	shimPath := filepath.Join(tmpDir, "test.json")
+	pubKeyPath := filepath.Join(tmpDir, "cosign.pub")
+	require.NoError(t, os.WriteFile(shimPath, []byte(`{"name": "test"}`), 0644))
+
+	verifier := NewVerifier()
+
+	// Missing bundle is reported before Cosign runs
+	err := verifier.VerifyWithKey(shimPath, pubKeyPath)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "bundle not found")
+
+	require.NoError(t, os.WriteFile(shimPath+".bundle", []byte("mock-signature-bundle"), 0644))
+
+	err = verifier.VerifyWithKey(shimPath, pubKeyPath)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "public key")
+
+	if _, err := exec.LookPath("cosign"); err != nil {
+		t.Skip("Cosign not installed")
+	}
+
+	// A mock bundle and key never verify
+	require.NoError(t, os.WriteFile(pubKeyPath, []byte("mock-public-key"), 0644))
+	err = verifier.VerifyWithKey(shimPath, pubKeyPath)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "cosign")
+}
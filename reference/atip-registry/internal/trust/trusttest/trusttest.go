@@ -0,0 +1,104 @@
+// Package trusttest provides utilities for tests that sign shims.
+package trusttest
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"aead.dev/minisign"
+	"golang.org/x/crypto/blake2b"
+	"golang.org/x/crypto/scrypt"
+)
+
+// FakeCosign puts a cosign script first on PATH for the rest of the test.
+// It appends its arguments to the returned file, then exits 0 if they
+// include accept, or fails like a cosign verify-blob that found no matching
+// identity.
+func FakeCosign(t testing.TB, accept string) string {
+	t.Helper()
+	dir := t.TempDir()
+	argsPath := filepath.Join(dir, "args")
+	script := fmt.Sprintf(`#!/bin/sh
+echo "$@" >> %q
+case " $* " in
+*" %s "*) exit 0 ;;
+esac
+echo "Error: none of the expected identities matched" >&2
+exit 1
+`, argsPath, accept)
+	if err := os.WriteFile(filepath.Join(dir, "cosign"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return argsPath
+}
+
+// Scrypt cost of keys written by WriteMinisignKey. minisign derives
+// N=1024, r=8, p=1 from these limits, instead of the ~1 GiB of memory and
+// seconds per key (minutes under -race) of minisign.EncryptKey.
+const (
+	scryptOps = 1 << 15
+	scryptMem = 1 << 21
+	scryptN   = 1024
+	scryptR   = 8
+	scryptP   = 1
+)
+
+// WriteMinisignKey writes a new minisign private key to path, encrypted
+// with password in the minisign key file format, and returns its public
+// key.
+func WriteMinisignKey(t testing.TB, path, password string) minisign.PublicKey {
+	t.Helper()
+
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var salt [32]byte
+	var plaintext [72]byte // Key ID, then the ed25519 private key
+	if _, err := rand.Read(salt[:]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rand.Read(plaintext[:8]); err != nil {
+		t.Fatal(err)
+	}
+	copy(plaintext[8:], privateKey)
+
+	// The ciphertext is (plaintext || BLAKE2b-256(EdDSA || plaintext)) XOR
+	// the scrypt keystream
+	message := binary.LittleEndian.AppendUint16(nil, minisign.EdDSA)
+	checksum := blake2b.Sum256(append(message, plaintext[:]...))
+	ciphertext := append(plaintext[:], checksum[:]...)
+	keystream, err := scrypt.Key([]byte(password), salt[:], scryptN, scryptR, scryptP, len(ciphertext))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range ciphertext {
+		ciphertext[i] ^= keystream[i]
+	}
+
+	data := binary.LittleEndian.AppendUint16(nil, minisign.EdDSA)
+	data = binary.LittleEndian.AppendUint16(data, 0x6353) // "Sc", scrypt
+	data = binary.LittleEndian.AppendUint16(data, 0x3242) // "B2", BLAKE2b
+	data = append(data, salt[:]...)
+	data = binary.LittleEndian.AppendUint64(data, scryptOps)
+	data = binary.LittleEndian.AppendUint64(data, scryptMem)
+	data = append(data, ciphertext...)
+
+	text := "untrusted comment: minisign encrypted secret key\n" + base64.StdEncoding.EncodeToString(data) + "\n"
+	if err := os.WriteFile(path, []byte(text), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := minisign.PrivateKeyFromFile(password, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key.Public().(minisign.PublicKey)
+}